@@ -0,0 +1,342 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/jkosik/crypto-trader/internal/backtest"
+	"github.com/jkosik/crypto-trader/internal/config"
+	"github.com/jkosik/crypto-trader/internal/kraken"
+	"github.com/jkosik/crypto-trader/internal/marketcache"
+	"github.com/jkosik/crypto-trader/internal/numparse"
+	"github.com/jkosik/crypto-trader/internal/redact"
+)
+
+// Backtest of the spread strategy on historical bid/ask and 1-minute OHLC data.
+// Orders are placed with the trader's spread gate and narrowing logic and filled when later
+// candles trade through their prices, reporting the hypothetical P&L after fees.
+//
+// Usage:
+//   go run cmd/backtest/main.go -coin BTC -volume 0.01 [-minspread 0.5] [-spreadnarrow 0.7] [-sweep]
+//
+// Flags:
+//   -coin string       Base coin to simulate (e.g. BTC, SOL)
+//   -volume float      Base coin volume per trade
+//   -config file       YAML config file with trading parameters (see config.example.yaml)
+//   -minspread float   Minimum spread percentage (default: min_spread_percent from the config)
+//   -spreadnarrow      Spread narrowing factor (default: spread_narrow_factor from the config)
+//   -makerfee float    Maker fee percentage of the limit orders (default: 0.25)
+//   -takerfee float    Taker fee percentage of closing a stuck leg at market (default: 0.40)
+//   -maxhold duration  Give up waiting for the second leg after this long (default: 0, wait like the trader)
+//   -cooldown duration Pause between trades (default: loop_delay from the config)
+//   -quotes file       CSV of time,bid,ask (default: Kraken's recent Spread history)
+//   -candles file      CSV of time,open,high,low,close,volume (default: Kraken's recent 1-minute OHLC)
+//   -marketcache dir   Market history cached by the trader, extends Kraken's data (default: <state dir>/market, "" disables)
+//   -sweep             Report a grid of min spread and narrowing factor values instead of a single run
+//   -trades            Print the individual simulated trades
+//
+// Times in the CSV files are Unix seconds or RFC 3339, a header line is skipped.
+// Kraken serves only the last few hours of spread history and 720 minute candles. Data fetched
+// from Kraken is merged with the trader's market cache (warmup_period of the config), record
+// longer periods to CSV for meaningful results.
+
+// sweepMinSpreads and sweepNarrowFactors span the -sweep grid
+var (
+	sweepMinSpreads    = []float64{0.25, 0.5, 0.75, 1.0, 1.5, 2.0}
+	sweepNarrowFactors = []float64{0.3, 0.4, 0.5, 0.6, 0.7, 0.8, 0.9}
+)
+
+func main() {
+	// Panic values and traces may quote requests, scrub them like logs
+	defer redact.Panics()
+
+	baseCoin := flag.String("coin", "", "Base coin to simulate (e.g. BTC, SOL)")
+	volume := numparse.FloatFlag("volume", 0, "Base coin volume per trade")
+	configPath := flag.String("config", "", "YAML config file with trading parameters")
+	minSpread := numparse.FloatFlag("minspread", 0, "Minimum spread percentage (default: from the config)")
+	spreadNarrow := numparse.FloatFlag("spreadnarrow", 0, "Spread narrowing factor (default: from the config)")
+	makerFee := numparse.FloatFlag("makerfee", 0.25, "Maker fee percentage of the limit orders")
+	takerFee := numparse.FloatFlag("takerfee", 0.40, "Taker fee percentage of closing a stuck leg at market")
+	maxHold := flag.Duration("maxhold", 0, "Give up waiting for the second leg after this long (0 waits like the trader)")
+	cooldown := flag.Duration("cooldown", -1, "Pause between trades (default: loop_delay from the config)")
+	quotesPath := flag.String("quotes", "", "CSV of time,bid,ask (default: Kraken's recent Spread history)")
+	candlesPath := flag.String("candles", "", "CSV of time,open,high,low,close,volume (default: Kraken's recent 1-minute OHLC)")
+	marketCache := flag.String("marketcache", defaultMarketCache(), "Market history cached by the trader, merged with the data fetched from Kraken (empty disables)")
+	sweep := flag.Bool("sweep", false, "Report a grid of min spread and narrowing factor values")
+	showTrades := flag.Bool("trades", false, "Print the individual simulated trades")
+	flag.Parse()
+
+	if *baseCoin == "" || *volume <= 0 {
+		fmt.Println("Error: -coin and a positive -volume are required")
+		flag.Usage()
+		os.Exit(2)
+	}
+	*baseCoin = strings.ToUpper(*baseCoin)
+
+	cfg, err := config.Load(*configPath)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(2)
+	}
+	if err := kraken.SetBaseURL(cfg.APIURL); err != nil {
+		fmt.Printf("Error: invalid api_url: %v\n", err)
+		os.Exit(2)
+	}
+	cfg = cfg.ForCoin(*baseCoin)
+
+	params := backtest.Params{
+		MinSpreadPercent:    cfg.MinSpreadPercent,
+		MinNetProfitPercent: cfg.MinNetProfitPercent,
+		NarrowFactor:        cfg.SpreadNarrowFactor,
+		Volume:              *volume,
+		MakerFeePercent:     *makerFee,
+		TakerFeePercent:     *takerFee,
+		MaxHold:             *maxHold,
+		Cooldown:            cfg.LoopDelay,
+	}
+	if flagSet("minspread") {
+		params.MinSpreadPercent = *minSpread
+	}
+	if flagSet("spreadnarrow") {
+		params.NarrowFactor = *spreadNarrow
+	}
+	if *cooldown >= 0 {
+		params.Cooldown = *cooldown
+	}
+
+	ctx := context.Background()
+	quotes, err := loadQuotes(ctx, *quotesPath, *baseCoin)
+	if err != nil {
+		fmt.Printf("Error loading quotes: %v\n", err)
+		os.Exit(1)
+	}
+	candles, err := loadCandles(ctx, *candlesPath, *baseCoin)
+	if err != nil {
+		fmt.Printf("Error loading candles: %v\n", err)
+		os.Exit(1)
+	}
+	// Kraken's recent history is extended with the one the trader cached, and adds to it
+	if *marketCache != "" && cfg.WarmupPeriod > 0 && (*quotesPath == "" || *candlesPath == "") {
+		history, err := marketcache.Open(*marketCache, *baseCoin, cfg.WarmupPeriod)
+		if err != nil {
+			fmt.Printf("Warning: market cache not used: %v\n", err)
+		} else {
+			if *quotesPath == "" {
+				quotes = history.AddSpreads(quotes)
+			}
+			if *candlesPath == "" {
+				candles = history.AddCandles(candles)
+			}
+			if err := history.Save(); err != nil {
+				fmt.Printf("Warning: %v\n", err)
+			}
+		}
+	}
+	if len(quotes) == 0 || len(candles) == 0 {
+		fmt.Println("Error: no quotes or candles to simulate")
+		os.Exit(1)
+	}
+
+	// Rounding to the pair's tick size is best effort, offline data may not have a Kraken pair
+	pair, err := kraken.GetAssetPair(ctx, *baseCoin, "USD")
+	if err != nil {
+		fmt.Printf("Warning: prices won't be rounded to the pair's precision: %v\n", err)
+		pair = nil
+	}
+	if pair != nil && cfg.PriceDecimals >= 0 {
+		overridden := *pair
+		overridden.PairDecimals = cfg.PriceDecimals
+		pair = &overridden
+	}
+
+	fmt.Printf("Simulating %s/USD: %d quotes and %d candles from %s to %s\n", *baseCoin, len(quotes), len(candles),
+		quotes[0].Time.UTC().Format(time.RFC3339), time.Unix(candles[len(candles)-1].Time, 0).UTC().Format(time.RFC3339))
+	fmt.Printf("Volume %v, maker fee %.2f%%, taker fee %.2f%%, max hold %v, cooldown %v\n\n",
+		params.Volume, params.MakerFeePercent, params.TakerFeePercent, params.MaxHold, params.Cooldown)
+
+	if !*sweep {
+		result := backtest.Run(quotes, candles, params, pair)
+		printResults([]*backtest.Result{result})
+		if *showTrades {
+			printTrades(result)
+		}
+		return
+	}
+
+	var results []*backtest.Result
+	for _, minSpreadPercent := range sweepMinSpreads {
+		for _, narrowFactor := range sweepNarrowFactors {
+			p := params
+			p.MinSpreadPercent = minSpreadPercent
+			p.NarrowFactor = narrowFactor
+			results = append(results, backtest.Run(quotes, candles, p, pair))
+		}
+	}
+	printResults(results)
+}
+
+// printResults prints a row per backtest run
+func printResults(results []*backtest.Result) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintf(w, "MIN SPREAD\tNARROW\tTRADES\tCOMPLETE\tTIMEOUT\tUNFILLED\tOPEN\tWIN RATE\tFEES USD\tNET USD\t\n")
+	for _, r := range results {
+		fmt.Fprintf(w, "%.2f%%\t%.2f\t%d\t%d\t%d\t%d\t%d\t%.1f%%\t%.2f\t%.2f\t\n",
+			r.Params.MinSpreadPercent, r.Params.NarrowFactor, len(r.Trades), r.Outcomes[backtest.Complete],
+			r.Outcomes[backtest.TimedOut], r.Outcomes[backtest.Unfilled], r.Outcomes[backtest.Open],
+			r.WinRate(), r.Fees, r.Net)
+	}
+	w.Flush()
+}
+
+// printTrades prints the individual trades of a run
+func printTrades(r *backtest.Result) {
+	fmt.Println()
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintf(w, "PLACED\tCLOSED\tOUTCOME\tBUY\tSELL\tEXIT\tFEES USD\tNET USD\t\n")
+	for _, t := range r.Trades {
+		exit := "-"
+		if t.ExitPrice > 0 {
+			exit = formatFloat(t.ExitPrice)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%.4f\t%.4f\t\n",
+			t.PlacedAt.UTC().Format(time.RFC3339), t.ClosedAt.UTC().Format(time.RFC3339), t.Outcome,
+			formatFloat(t.BuyPrice), formatFloat(t.SellPrice), exit, t.Fees, t.Net)
+	}
+	w.Flush()
+}
+
+// defaultMarketCache returns the trader's market cache directory, "" if the state directory is unavailable
+func defaultMarketCache() string {
+	dir, err := kraken.StateDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "market")
+}
+
+// loadQuotes reads bid/ask snapshots from a CSV file or Kraken
+func loadQuotes(ctx context.Context, path string, coin string) ([]kraken.SpreadSnapshot, error) {
+	if path == "" {
+		return kraken.GetSpreadHistory(ctx, coin)
+	}
+	records, err := readCSV(path, 3)
+	if err != nil {
+		return nil, err
+	}
+
+	quotes := make([]kraken.SpreadSnapshot, 0, len(records))
+	for i, record := range records {
+		t, err := parseTime(record[0])
+		if err != nil {
+			return nil, fmt.Errorf("%s record %d: %v", path, i+1, err)
+		}
+		bid, err := numparse.Parse(record[1])
+		if err != nil {
+			return nil, fmt.Errorf("%s record %d: invalid bid: %v", path, i+1, err)
+		}
+		ask, err := numparse.Parse(record[2])
+		if err != nil {
+			return nil, fmt.Errorf("%s record %d: invalid ask: %v", path, i+1, err)
+		}
+		quotes = append(quotes, kraken.SpreadSnapshot{Time: t, Bid: bid, Ask: ask})
+	}
+	return quotes, nil
+}
+
+// loadCandles reads 1-minute OHLC candles from a CSV file or Kraken
+func loadCandles(ctx context.Context, path string, coin string) ([]kraken.OHLCData, error) {
+	if path == "" {
+		return kraken.GetMinuteCandles(ctx, coin)
+	}
+	records, err := readCSV(path, 6)
+	if err != nil {
+		return nil, err
+	}
+
+	candles := make([]kraken.OHLCData, 0, len(records))
+	for i, record := range records {
+		t, err := parseTime(record[0])
+		if err != nil {
+			return nil, fmt.Errorf("%s record %d: %v", path, i+1, err)
+		}
+		values := make([]float64, 5)
+		for j := range values {
+			if values[j], err = numparse.Parse(record[j+1]); err != nil {
+				return nil, fmt.Errorf("%s record %d: invalid value %q: %v", path, i+1, record[j+1], err)
+			}
+		}
+		candles = append(candles, kraken.OHLCData{
+			Time:   t.Unix(),
+			Open:   values[0],
+			High:   values[1],
+			Low:    values[2],
+			Close:  values[3],
+			Volume: values[4],
+		})
+	}
+	return candles, nil
+}
+
+// readCSV reads the records of a CSV file with at least columns fields, skipping a header line
+func readCSV(path string, columns int) ([][]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	reader := csv.NewReader(file)
+	reader.FieldsPerRecord = -1
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("error reading %s: %v", path, err)
+	}
+	if len(records) > 0 && len(records[0]) > 0 {
+		if _, err := parseTime(records[0][0]); err != nil {
+			records = records[1:]
+		}
+	}
+	for i, record := range records {
+		if len(record) < columns {
+			return nil, fmt.Errorf("%s record %d: expected %d fields, got %d", path, i+1, columns, len(record))
+		}
+	}
+	return records, nil
+}
+
+// parseTime parses Unix seconds or an RFC 3339 time
+func parseTime(s string) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	if seconds, err := strconv.ParseFloat(s, 64); err == nil {
+		return time.Unix(int64(seconds), 0), nil
+	}
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid time %q", s)
+	}
+	return t, nil
+}
+
+// flagSet reports whether a flag was passed on the command line
+func flagSet(name string) bool {
+	set := false
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			set = true
+		}
+	})
+	return set
+}
+
+// formatFloat formats a price without trailing zeros
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
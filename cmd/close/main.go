@@ -0,0 +1,230 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/jkosik/crypto-trader/internal/kraken"
+	"github.com/jkosik/crypto-trader/internal/logging"
+	"github.com/jkosik/crypto-trader/internal/manual"
+	"github.com/jkosik/crypto-trader/internal/numparse"
+	"github.com/jkosik/crypto-trader/internal/redact"
+	"github.com/jkosik/crypto-trader/internal/store"
+)
+
+// Close position: flattens a coin by selling its full available balance, or buys back a volume
+// sold, with a market order or an aggressive limit order at the bid (sell) or ask (buy). Handy
+// when one leg of a spread filled and the position should be flattened by hand.
+//
+// Usage:
+//   go run cmd/close/main.go -coin SUNDOG [-market] [-order]
+//   go run cmd/close/main.go -coin SUNDOG -buy -volume 300 [-market] [-order]
+//
+// Flags:
+//   -buy              Buy back -volume instead of selling the balance
+//   -coin string      Base coin to close (e.g. BTC, SOL)
+//   -journal file     Trade journal the order is recorded in (default: <state dir>/journal.db, "" disables)
+//   -market           Place a market order instead of a limit order at the bid or ask
+//   -order            Place the order, without it the order is only printed
+//   -quote string     Quote currency of the pair (default: USD)
+//   -validate         Let the exchange validate the order without placing it
+//   -volume float     Volume to sell or buy back (default for sells: the full available balance)
+//   -wait duration    Time a limit order may take to fill before its rest is canceled (default: 1m, 0 leaves it open)
+//
+// Volumes are rounded down to the pair's lot decimals and prices to its tick size, orders below
+// the pair's minimum size or cost are refused. The order is journaled as a manual trade. The
+// command exits 1 unless the whole volume executed.
+
+func main() {
+	// Panic values and traces may quote requests, scrub them like logs
+	defer redact.Panics()
+
+	coin := flag.String("coin", "", "Base coin to close (e.g. BTC, SOL)")
+	quote := flag.String("quote", "USD", "Quote currency of the pair, e.g. USD, EUR or USDT")
+	buy := flag.Bool("buy", false, "Buy back -volume instead of selling the balance")
+	var volume float64
+	flag.Var((*numparse.Float)(&volume), "volume", "Volume to sell or buy back (default for sells: the full available balance)")
+	market := flag.Bool("market", false, "Place a market order instead of a limit order at the bid or ask")
+	orderFlag := flag.Bool("order", false, "Place the order, without it the order is only printed")
+	validate := flag.Bool("validate", false, "Let the exchange validate the order without placing it")
+	wait := flag.Duration("wait", time.Minute, "Time a limit order may take to fill before its rest is canceled (0 leaves it open)")
+	journalPath := flag.String("journal", defaultJournalPath(), "Trade journal the order is recorded in (empty disables)")
+	flag.Parse()
+
+	if *coin == "" {
+		fmt.Println("Error: -coin is required")
+		os.Exit(2)
+	}
+	if *buy && volume <= 0 {
+		fmt.Println("Error: -buy needs a positive -volume")
+		os.Exit(2)
+	}
+	if volume < 0 || *wait < 0 {
+		fmt.Println("Error: -volume and -wait must not be negative")
+		os.Exit(2)
+	}
+	if os.Getenv("KRAKEN_API_KEY") == "" || os.Getenv("KRAKEN_PRIVATE_KEY") == "" {
+		fmt.Println("Error: KRAKEN_API_KEY and KRAKEN_PRIVATE_KEY environment variables must be set")
+		os.Exit(2)
+	}
+	kraken.Quote = *quote
+	kraken.ValidateOnly = *validate
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	pair, err := kraken.GetAssetPair(ctx, *coin, kraken.Quote)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	spread, err := kraken.GetTickerInfo(ctx, *coin)
+	if err != nil {
+		fmt.Printf("Error getting ticker: %v\n", err)
+		os.Exit(1)
+	}
+
+	if !*buy && volume == 0 {
+		balanceBody, err := kraken.GetAccountBalance(ctx)
+		if err != nil {
+			fmt.Printf("Error getting account balance: %v\n", err)
+			os.Exit(1)
+		}
+		balances, err := kraken.GetAllBalances(balanceBody)
+		if err != nil {
+			fmt.Printf("Error parsing account balance: %v\n", err)
+			os.Exit(1)
+		}
+		balance, err := kraken.GetBalance(balances, pair.Base)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		volume = balance.Available
+		if len(balance.Variants) > 1 {
+			fmt.Printf("%s balance: %s\n", balance.Asset, balance.Breakdown())
+		}
+	}
+	volume = pair.RoundVolume(volume)
+
+	// An aggressive limit crosses the spread like a market order but never fills worse than the
+	// touch it was priced at
+	side, price := "sell", spread.BidPrice
+	if *buy {
+		side, price = "buy", spread.AskPrice
+	}
+	price = pair.RoundPrice(price)
+	if err := pair.ValidateOrder(price, volume); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	orderKind := "limit at " + pair.FormatPrice(price)
+	if *market {
+		orderKind = "market"
+	}
+	fmt.Printf("%s %s %s %s (%s), about %s %s\n", side, pair.FormatVolume(volume), pair.BaseAltname(), orderKind,
+		pair.WSName, strconv.FormatFloat(price*volume, 'f', 2, 64), pair.QuoteAltname())
+	if !*orderFlag && !*validate {
+		fmt.Println("Dry run, add -order to place the order")
+		return
+	}
+
+	tradeID := logging.NewTradeID()
+	userref := kraken.UserRef(tradeID)
+	var txId string
+	if *market {
+		txId, err = kraken.PlaceMarketOrder(ctx, pair, volume, *buy, price, userref)
+	} else {
+		txId, err = kraken.PlaceLimitOrder(ctx, pair, price, volume, *buy, false, userref)
+	}
+	if err != nil {
+		fmt.Printf("Error placing order: %v\n", err)
+		os.Exit(1)
+	}
+	if *validate {
+		fmt.Println("Order validated by the exchange, nothing was placed")
+		return
+	}
+
+	var journal *store.Store
+	if *journalPath != "" {
+		if journal, err = store.Open(*journalPath); err != nil {
+			fmt.Printf("Warning: not journaling the order: %v\n", err)
+		} else {
+			defer journal.Close()
+			now := time.Now()
+			if err := journal.StartTrade(store.Trade{ID: tradeID, Pair: kraken.PairName(*coin), Volume: volume, StartedAt: now}); err != nil {
+				fmt.Printf("Warning: failed to journal the trade: %v\n", err)
+				journal = nil
+			} else if err := journal.RecordOrder(store.Order{TxID: txId, TradeID: tradeID, Side: side, Volume: volume, PlacedAt: now}); err != nil {
+				fmt.Printf("Warning: failed to journal the order: %v\n", err)
+			}
+		}
+	}
+
+	status, err := awaitOrder(ctx, txId, *wait)
+	if err != nil {
+		fmt.Printf("Error checking order %s: %v\n", txId, err)
+		os.Exit(1)
+	}
+	if journal != nil {
+		fee := kraken.ParseFloat(status.Fee)
+		fill := store.Fill{TxID: txId, Status: status.Status, Price: kraken.ParseFloat(status.Descr.Price), VolExec: kraken.ParseFloat(status.VolExec),
+			Cost: kraken.ParseFloat(status.Cost), Fee: fee, ObservedAt: time.Now()}
+		if err := journal.RecordFill(fill); err != nil {
+			fmt.Printf("Warning: failed to journal the fill: %v\n", err)
+		}
+		if err := journal.FinishTrade(tradeID, store.TradeResult{Result: manual.Result, Fees: fee, FinishedAt: time.Now()}); err != nil {
+			fmt.Printf("Warning: failed to finish the journaled trade: %v\n", err)
+		}
+	}
+
+	volExec := kraken.ParseFloat(status.VolExec)
+	fmt.Printf("Order %s %s: %s of %s executed, cost %s, fee %s\n", txId, status.Status, pair.FormatVolume(volExec),
+		pair.FormatVolume(volume), status.Cost, status.Fee)
+	if volExec < volume {
+		os.Exit(1)
+	}
+}
+
+// awaitOrder polls the order until it's done or wait passes, then cancels its rest. A zero wait
+// returns the order's first state and leaves it open.
+func awaitOrder(ctx context.Context, txId string, wait time.Duration) (*kraken.OrderStatus, error) {
+	deadline := time.Now().Add(wait)
+	for {
+		status, err := kraken.CheckOrderStatus(ctx, txId)
+		if err != nil {
+			return nil, err
+		}
+		if kraken.OrderDone(status.Status) || wait == 0 {
+			return status, nil
+		}
+		if time.Now().After(deadline) || ctx.Err() != nil {
+			fmt.Printf("Order %s not filled within %s, canceling the rest\n", txId, wait)
+			if err := kraken.CancelOrder(context.Background(), txId); err != nil {
+				return nil, err
+			}
+			return kraken.CheckOrderStatus(context.Background(), txId)
+		}
+		select {
+		case <-ctx.Done():
+		case <-time.After(2 * time.Second):
+		}
+	}
+}
+
+// defaultJournalPath returns the journal location in the state directory, or "" if it's unavailable
+func defaultJournalPath() string {
+	dir, err := kraken.StateDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "journal.db")
+}
@@ -0,0 +1,312 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"text/tabwriter"
+
+	"github.com/jkosik/crypto-trader/internal/config"
+	"github.com/jkosik/crypto-trader/internal/kraken"
+	"github.com/jkosik/crypto-trader/internal/money"
+	"github.com/jkosik/crypto-trader/internal/numparse"
+	"github.com/jkosik/crypto-trader/internal/redact"
+)
+
+// Kraken Earn: lists strategies and allocations, moves funds in and out of strategies, and parks
+// the idle balance of an asset between trades.
+//
+// Usage:
+//   go run cmd/earn/main.go strategies [-asset DOT]
+//   go run cmd/earn/main.go balances
+//   go run cmd/earn/main.go allocate -strategy ID -amount 100
+//   go run cmd/earn/main.go deallocate -strategy ID -amount 100
+//   go run cmd/earn/main.go park -asset USD [-keep 200] [-strategy ID]
+//   go run cmd/earn/main.go pull -asset USD [-amount 100]
+//
+// park allocates the available balance of the asset beyond -keep to its flexible strategy with the
+// highest estimated reward (or -strategy), pull deallocates from the asset's flexible allocations
+// (all of them without -amount). With earn.auto_deallocate set, the trader pulls a trade's missing
+// funds itself, so e.g. `earn park -asset USD -keep 200` from cron keeps idle USD earning.
+//
+// Flags of every command:
+//   -config file      YAML config file, its earn section sets the timeout of allocations
+
+func main() {
+	// Panic values and traces may quote requests, scrub them like logs
+	defer redact.Panics()
+
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+	commands := map[string]func(args []string) int{
+		"strategies": runStrategies,
+		"balances":   runBalances,
+		"allocate":   func(args []string) int { return runTransfer("allocate", args) },
+		"deallocate": func(args []string) int { return runTransfer("deallocate", args) },
+		"park":       runPark,
+		"pull":       runPull,
+	}
+	run, ok := commands[os.Args[1]]
+	if !ok {
+		usage()
+		os.Exit(2)
+	}
+	os.Exit(run(os.Args[2:]))
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "Usage: earn strategies|balances|allocate|deallocate|park|pull [flags]")
+}
+
+// setup loads the config and checks the API keys, returning the exit code on failure
+func setup(configPath string) (*config.Config, int) {
+	cfg, err := config.Load(configPath)
+	if err != nil {
+		fmt.Printf("Error loading config: %v\n", err)
+		return nil, 2
+	}
+	if err := money.SetPolicy(cfg.Money); err != nil {
+		fmt.Printf("Error: invalid money policy: %v\n", err)
+		return nil, 2
+	}
+	if err := kraken.SetBaseURL(cfg.APIURL); err != nil {
+		fmt.Printf("Error: invalid api_url: %v\n", err)
+		return nil, 2
+	}
+	if os.Getenv("KRAKEN_API_KEY") == "" || os.Getenv("KRAKEN_PRIVATE_KEY") == "" {
+		fmt.Println("Error: KRAKEN_API_KEY and KRAKEN_PRIVATE_KEY environment variables must be set")
+		return nil, 2
+	}
+	// Balance codes (ZUSD, XXBT) resolve to the altnames Earn uses through the pair metadata
+	if _, err := kraken.LoadAssetPairs(context.Background()); err != nil {
+		fmt.Printf("Error loading asset pairs: %v\n", err)
+		return nil, 1
+	}
+	return cfg, 0
+}
+
+// runStrategies lists the earn strategies, of one asset with -asset
+func runStrategies(args []string) int {
+	fs := flag.NewFlagSet("strategies", flag.ExitOnError)
+	asset := fs.String("asset", "", "List the strategies of this asset only (e.g. USD, DOT, BTC)")
+	configPath := fs.String("config", "", "Path to a YAML config file")
+	fs.Parse(args)
+	if _, code := setup(*configPath); code != 0 {
+		return code
+	}
+
+	strategies, err := kraken.GetEarnStrategies(context.Background(), *asset)
+	if err != nil {
+		fmt.Printf("Error listing earn strategies: %v\n", err)
+		return 1
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "ID\tASSET\tLOCK\tAPR %%\tMIN\tALLOCATE\tDEALLOCATE\n")
+	for _, s := range strategies {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%t\t%t\n", s.ID, s.Asset, s.LockType, formatAPR(s),
+			strconv.FormatFloat(s.MinAllocation, 'f', -1, 64), s.CanAllocate, s.CanDeallocate)
+	}
+	w.Flush()
+	return 0
+}
+
+// runBalances lists the account's earn allocations
+func runBalances(args []string) int {
+	fs := flag.NewFlagSet("balances", flag.ExitOnError)
+	configPath := fs.String("config", "", "Path to a YAML config file")
+	fs.Parse(args)
+	if _, code := setup(*configPath); code != 0 {
+		return code
+	}
+
+	allocations, err := kraken.GetEarnAllocations(context.Background())
+	if err != nil {
+		fmt.Printf("Error listing earn allocations: %v\n", err)
+		return 1
+	}
+	if len(allocations) == 0 {
+		fmt.Println("Nothing is allocated to earn strategies")
+		return 0
+	}
+	total := 0.0
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintf(w, "STRATEGY\tASSET\tALLOCATED\tREWARDED\tVALUE USD\t\n")
+	for _, a := range allocations {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t\n", a.StrategyID, a.Asset, strconv.FormatFloat(a.Allocated, 'f', -1, 64),
+			strconv.FormatFloat(a.Rewarded, 'f', -1, 64), money.Format(a.ValueUSD, "USD"))
+		total += a.ValueUSD
+	}
+	fmt.Fprintf(w, "TOTAL\t\t\t\t%s\t\n", money.Format(total, "USD"))
+	w.Flush()
+	return 0
+}
+
+// runTransfer allocates to or deallocates from a strategy and waits until Kraken processed it
+func runTransfer(command string, args []string) int {
+	fs := flag.NewFlagSet(command, flag.ExitOnError)
+	strategyID := fs.String("strategy", "", "Earn strategy ID, see the strategies command")
+	var amount float64
+	fs.Var((*numparse.Float)(&amount), "amount", "Amount of the strategy's asset")
+	configPath := fs.String("config", "", "Path to a YAML config file")
+	fs.Parse(args)
+	if *strategyID == "" || amount <= 0 {
+		fmt.Println("Error: -strategy and a positive -amount are required")
+		return 2
+	}
+	cfg, code := setup(*configPath)
+	if code != 0 {
+		return code
+	}
+
+	ctx := context.Background()
+	deallocate := command == "deallocate"
+	transfer := kraken.AllocateEarn
+	if deallocate {
+		transfer = kraken.DeallocateEarn
+	}
+	if err := transfer(ctx, *strategyID, amount); err != nil {
+		fmt.Printf("Error: failed to %s: %v\n", command, err)
+		return 1
+	}
+	if err := kraken.WaitEarn(ctx, *strategyID, deallocate, cfg.Earn.Timeout); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return 1
+	}
+	fmt.Printf("%s %g to %s done\n", command, amount, *strategyID)
+	return 0
+}
+
+// runPark allocates the asset's available balance beyond -keep to a flexible strategy
+func runPark(args []string) int {
+	fs := flag.NewFlagSet("park", flag.ExitOnError)
+	asset := fs.String("asset", "USD", "Asset whose idle balance is parked (e.g. USD, DOT)")
+	var keep float64
+	fs.Var((*numparse.Float)(&keep), "keep", "Balance left available for trades")
+	strategyID := fs.String("strategy", "", "Earn strategy ID (default: the asset's flexible strategy with the highest estimated reward)")
+	configPath := fs.String("config", "", "Path to a YAML config file")
+	fs.Parse(args)
+	if keep < 0 {
+		fmt.Println("Error: -keep must not be negative")
+		return 2
+	}
+	cfg, code := setup(*configPath)
+	if code != 0 {
+		return code
+	}
+
+	ctx := context.Background()
+	strategies, err := kraken.GetEarnStrategies(ctx, *asset)
+	if err != nil {
+		fmt.Printf("Error listing earn strategies: %v\n", err)
+		return 1
+	}
+	strategy, err := parkingStrategy(strategies, *asset, *strategyID)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return 1
+	}
+
+	balanceBody, err := kraken.GetAccountBalance(ctx)
+	if err != nil {
+		fmt.Printf("Error getting account balance: %v\n", err)
+		return 1
+	}
+	balances, err := kraken.GetAllBalances(balanceBody)
+	if err != nil {
+		fmt.Printf("Error parsing account balance: %v\n", err)
+		return 1
+	}
+	available := 0.0
+	for code, balance := range balances {
+		if kraken.SameEarnAsset(code, *asset) {
+			available += balance.Available
+		}
+	}
+
+	amount := roundDown(available-keep, 8)
+	if amount <= 0 || amount < strategy.MinAllocation {
+		fmt.Printf("Nothing to park: %g %s available, keeping %g, the strategy's minimum is %g\n", available, *asset, keep, strategy.MinAllocation)
+		return 0
+	}
+	if err := kraken.AllocateEarn(ctx, strategy.ID, amount); err != nil {
+		fmt.Printf("Error: failed to allocate: %v\n", err)
+		return 1
+	}
+	if err := kraken.WaitEarn(ctx, strategy.ID, false, cfg.Earn.Timeout); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return 1
+	}
+	fmt.Printf("Parked %g %s in %s (%s, APR %s%%), %g left available\n", amount, *asset, strategy.ID, strategy.LockType, formatAPR(strategy), available-amount)
+	return 0
+}
+
+// runPull deallocates the asset from its flexible allocations
+func runPull(args []string) int {
+	fs := flag.NewFlagSet("pull", flag.ExitOnError)
+	asset := fs.String("asset", "USD", "Asset to pull back to the spot balance (e.g. USD, DOT)")
+	var amount float64
+	fs.Var((*numparse.Float)(&amount), "amount", "Amount to pull (default: everything in flexible strategies)")
+	configPath := fs.String("config", "", "Path to a YAML config file")
+	fs.Parse(args)
+	if amount < 0 {
+		fmt.Println("Error: -amount must not be negative")
+		return 2
+	}
+	cfg, code := setup(*configPath)
+	if code != 0 {
+		return code
+	}
+	if amount == 0 {
+		amount = math.Inf(1)
+	}
+
+	pulled, err := kraken.PullFromEarn(context.Background(), *asset, amount, cfg.Earn.Timeout)
+	if err != nil {
+		fmt.Printf("Error: %v (pulled %g %s)\n", err, pulled, *asset)
+		return 1
+	}
+	fmt.Printf("Pulled %g %s from earn\n", pulled, *asset)
+	return 0
+}
+
+// parkingStrategy returns the strategy with the given ID, or the asset's allocatable flexible
+// strategy with the highest estimated reward
+func parkingStrategy(strategies []kraken.EarnStrategy, asset string, id string) (kraken.EarnStrategy, error) {
+	var candidates []kraken.EarnStrategy
+	for _, s := range strategies {
+		if id != "" && s.ID == id {
+			return s, nil
+		}
+		if s.Flexible() && s.CanAllocate && kraken.SameEarnAsset(s.Asset, asset) {
+			candidates = append(candidates, s)
+		}
+	}
+	if id != "" {
+		return kraken.EarnStrategy{}, fmt.Errorf("no earn strategy %s for %s", id, asset)
+	}
+	if len(candidates) == 0 {
+		return kraken.EarnStrategy{}, fmt.Errorf("no flexible earn strategy accepts %s", asset)
+	}
+	sort.SliceStable(candidates, func(i, j int) bool { return candidates[i].APRHigh > candidates[j].APRHigh })
+	return candidates[0], nil
+}
+
+// formatAPR formats the estimated reward range of a strategy
+func formatAPR(s kraken.EarnStrategy) string {
+	if s.APRLow == s.APRHigh {
+		return strconv.FormatFloat(s.APRHigh, 'f', 2, 64)
+	}
+	return strconv.FormatFloat(s.APRLow, 'f', 2, 64) + "-" + strconv.FormatFloat(s.APRHigh, 'f', 2, 64)
+}
+
+// roundDown rounds an amount down to decimals, so no more than the balance is allocated
+func roundDown(amount float64, decimals int) float64 {
+	factor := math.Pow(10, float64(decimals))
+	return math.Floor(amount*factor) / factor
+}
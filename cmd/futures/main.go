@@ -0,0 +1,241 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"text/tabwriter"
+
+	"github.com/jkosik/crypto-trader/internal/krakenfutures"
+	"github.com/jkosik/crypto-trader/internal/numparse"
+	"github.com/jkosik/crypto-trader/internal/redact"
+)
+
+// Kraken Futures: shows contract markets, the account's open orders and positions, and places or
+// cancels single orders. Private commands need KRAKEN_FUTURES_API_KEY and
+// KRAKEN_FUTURES_PRIVATE_KEY, keys of the demo environment with -demo.
+//
+// Usage:
+//   go run cmd/futures/main.go ticker -symbol PF_XBTUSD [-demo]
+//   go run cmd/futures/main.go orders [-symbol PF_XBTUSD] [-demo]
+//   go run cmd/futures/main.go positions [-symbol PF_XBTUSD] [-demo]
+//   go run cmd/futures/main.go order -symbol PF_XBTUSD -side buy -size 0.001 [-price 60000] [-type post] [-reduce-only] [-demo]
+//   go run cmd/futures/main.go cancel -id ORDER_ID [-demo]
+//
+// Flags of every command:
+//   -demo             Use the demo environment (demo-futures.kraken.com), paper funds only
+//   -url string       API host, e.g. a mock server (default: KRAKEN_FUTURES_API_URL or production)
+
+func main() {
+	// Panic values and traces may quote requests, scrub them like logs
+	defer redact.Panics()
+
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+	commands := map[string]func(args []string) int{
+		"ticker":    runTicker,
+		"orders":    runOrders,
+		"positions": runPositions,
+		"order":     runOrder,
+		"cancel":    runCancel,
+	}
+	run, ok := commands[os.Args[1]]
+	if !ok {
+		usage()
+		os.Exit(2)
+	}
+	os.Exit(run(os.Args[2:]))
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "Usage: futures ticker|orders|positions|order|cancel [flags]")
+}
+
+// environment holds the shared flags selecting the API host
+type environment struct {
+	demo *bool
+	url  *string
+}
+
+// newFlagSet creates the flags of a command with the shared -demo and -url flags
+func newFlagSet(name string) (*flag.FlagSet, environment) {
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	env := environment{
+		demo: fs.Bool("demo", false, "Use the demo environment (demo-futures.kraken.com), paper funds only"),
+		url:  fs.String("url", "", "API host, e.g. a mock server (default: KRAKEN_FUTURES_API_URL or https://futures.kraken.com)"),
+	}
+	return fs, env
+}
+
+// apply points the client at the selected host, returning the exit code on failure
+func (e environment) apply() int {
+	if *e.demo && *e.url != "" {
+		fmt.Println("Error: -demo and -url are mutually exclusive")
+		return 2
+	}
+	if *e.demo {
+		krakenfutures.UseDemo()
+	}
+	if err := krakenfutures.SetBaseURL(*e.url); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return 2
+	}
+	return 0
+}
+
+// runTicker shows the market of a contract
+func runTicker(args []string) int {
+	fs, env := newFlagSet("ticker")
+	symbol := fs.String("symbol", "", "Contract symbol (e.g. PF_XBTUSD)")
+	fs.Parse(args)
+	if *symbol == "" {
+		fmt.Println("Error: -symbol is required")
+		return 2
+	}
+	if code := env.apply(); code != 0 {
+		return code
+	}
+
+	t, err := krakenfutures.GetTicker(context.Background(), *symbol)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return 1
+	}
+	spread, spreadPercent := t.Spread()
+	fmt.Printf("%s (%s): bid %g (%g), ask %g (%g), spread %g (%.4f%%)\n", t.Symbol, t.Tag, t.Bid, t.BidSize, t.Ask, t.AskSize, spread, spreadPercent)
+	fmt.Printf("Last %g, mark %g, 24h volume %g, open interest %g, funding rate %g\n", t.Last, t.MarkPrice, t.Vol24h, t.OpenInterest, t.FundingRate)
+	if t.Suspended {
+		fmt.Println("Trading is suspended")
+	}
+	return 0
+}
+
+// runOrders lists the account's open orders
+func runOrders(args []string) int {
+	fs, env := newFlagSet("orders")
+	symbol := fs.String("symbol", "", "List the orders of this contract only")
+	fs.Parse(args)
+	if code := env.apply(); code != 0 {
+		return code
+	}
+
+	orders, err := krakenfutures.GetOpenOrders(context.Background(), *symbol)
+	if err != nil {
+		fmt.Printf("Error getting open orders: %v\n", err)
+		return 1
+	}
+	if len(orders) == 0 {
+		fmt.Println("No open orders")
+		return 0
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "ORDER ID\tSYMBOL\tSIDE\tTYPE\tPRICE\tFILLED\tUNFILLED\tSTATUS\n")
+	for _, o := range orders {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n", o.OrderID, o.Symbol, o.Side, o.OrderType, formatFloat(o.LimitPrice),
+			formatFloat(o.FilledSize), formatFloat(o.UnfilledSize), o.Status)
+	}
+	w.Flush()
+	return 0
+}
+
+// runPositions lists the account's open positions
+func runPositions(args []string) int {
+	fs, env := newFlagSet("positions")
+	symbol := fs.String("symbol", "", "List the position of this contract only")
+	fs.Parse(args)
+	if code := env.apply(); code != 0 {
+		return code
+	}
+
+	positions, err := krakenfutures.GetOpenPositions(context.Background(), *symbol)
+	if err != nil {
+		fmt.Printf("Error getting open positions: %v\n", err)
+		return 1
+	}
+	if len(positions) == 0 {
+		fmt.Println("No open positions")
+		return 0
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "SYMBOL\tSIDE\tSIZE\tENTRY PRICE\tUNREALIZED FUNDING\tOPENED\n")
+	for _, p := range positions {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", p.Symbol, p.Side, formatFloat(p.Size), formatFloat(p.Price),
+			formatFloat(p.UnrealizedFunding), p.FillTime)
+	}
+	w.Flush()
+	return 0
+}
+
+// runOrder places a single order, a limit order unless -type says otherwise
+func runOrder(args []string) int {
+	fs, env := newFlagSet("order")
+	symbol := fs.String("symbol", "", "Contract symbol (e.g. PF_XBTUSD)")
+	side := fs.String("side", "", "buy or sell")
+	orderType := fs.String("type", krakenfutures.Limit, "Order type: lmt, post, mkt, ioc, stp or take_profit")
+	var size, price, stop float64
+	fs.Var((*numparse.Float)(&size), "size", "Order size in contracts")
+	fs.Var((*numparse.Float)(&price), "price", "Limit price, rounded to the contract's tick size")
+	fs.Var((*numparse.Float)(&stop), "stop", "Trigger price of stp and take_profit orders")
+	reduceOnly := fs.Bool("reduce-only", false, "Only reduce an open position, never open or flip one")
+	fs.Parse(args)
+	if *symbol == "" || (*side != "buy" && *side != "sell") || size <= 0 {
+		fmt.Println("Error: -symbol, -side buy|sell and a positive -size are required")
+		return 2
+	}
+	if code := env.apply(); code != 0 {
+		return code
+	}
+
+	ctx := context.Background()
+	instrument, err := krakenfutures.GetInstrument(ctx, *symbol)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return 1
+	}
+	order := krakenfutures.OrderRequest{
+		Symbol:     instrument.Symbol,
+		Side:       *side,
+		OrderType:  *orderType,
+		Size:       instrument.RoundSize(size),
+		LimitPrice: instrument.RoundPrice(price),
+		StopPrice:  instrument.RoundPrice(stop),
+		ReduceOnly: *reduceOnly,
+	}
+	status, err := krakenfutures.SendOrder(ctx, order)
+	if err != nil {
+		fmt.Printf("Error placing order: %v\n", err)
+		return 1
+	}
+	fmt.Printf("Placed %s %s %s %s at %s: %s\n", order.OrderType, order.Side, formatFloat(order.Size), order.Symbol,
+		formatFloat(order.LimitPrice), status.OrderID)
+	return 0
+}
+
+// runCancel cancels an open order
+func runCancel(args []string) int {
+	fs, env := newFlagSet("cancel")
+	id := fs.String("id", "", "Order ID, see the orders command")
+	fs.Parse(args)
+	if *id == "" {
+		fmt.Println("Error: -id is required")
+		return 2
+	}
+	if code := env.apply(); code != 0 {
+		return code
+	}
+
+	if err := krakenfutures.CancelOrder(context.Background(), *id); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return 1
+	}
+	fmt.Printf("Canceled %s\n", *id)
+	return 0
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
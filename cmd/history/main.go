@@ -0,0 +1,644 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/jkosik/crypto-trader/internal/config"
+	"github.com/jkosik/crypto-trader/internal/kraken"
+	"github.com/jkosik/crypto-trader/internal/manual"
+	"github.com/jkosik/crypto-trader/internal/money"
+	"github.com/jkosik/crypto-trader/internal/redact"
+	"github.com/jkosik/crypto-trader/internal/store"
+	"github.com/jkosik/crypto-trader/internal/tax"
+)
+
+// Trade history report: realized P&L, fees and win rate per coin, per day and in total.
+// Reads the trader's SQLite journal, or the account's executions from Kraken's TradesHistory.
+//
+// Usage:
+//   go run cmd/history/main.go [-since 2026-01-01] [-until 2026-02-01] [-coin BTC] [-csv trades.csv]
+//
+// Flags:
+//   -coin string      Only report trades of this coin
+//   -config file      YAML config file, its money section sets the rounding of the amounts
+//   -csv file         Export the individual trades (or executions with -kraken) to a CSV file
+//   -import           Import the account's executions and ledger entries from Kraken into the journal
+//   -tax year         Report the year's disposals with their FIFO cost basis, -csv exports them
+//   -tax-currency c   Currency the tax report is in (default: USD)
+//   -journal file     Trade journal written by the trader (default: <state dir>/journal.db)
+//   -kraken           Read executions from Kraken's TradesHistory instead of the journal
+//   -since date       Only trades started on or after this day (YYYY-MM-DD)
+//   -snapshots id     Print the market snapshots journaled for a trade (order book, last trades) as JSON lines
+//   -untradeable      Include trades placed with -untradeable
+//   -until date       Only trades started before this day (YYYY-MM-DD)
+//
+// -import fetches the executions (TradesHistory) and ledger entries (Ledgers) booked after the
+// last imported ones, or after -since on the first import, and stores them next to the journaled
+// trades, so the journal can be reconciled against the exchange's records. Entries already
+// imported are skipped, running it from cron keeps the copy current.
+//
+// -tax matches every sell against the oldest remaining buys of the coin (first in, first out) over
+// the executions imported with -import, or with -kraken the whole TradesHistory, and reports the
+// proceeds, cost basis (buy fees included), sell fees and gain or loss of the sells in the year.
+// Lots are kept per coin across quote currencies, amounts are converted to -tax-currency at the
+// day's first public trade of the currency's pair. Crypto quotes are coins of their own: buying
+// ETH on ETH/BTC disposes of the BTC paid.
+//
+// Kraken executions can't be paired into spread trades, so -kraken reports the net cash flow
+// (sells - buys - fees) per coin and day and no win rate.
+//
+// Amounts are rounded with the money policy per trade, totals are sums of the rounded amounts,
+// so the per coin, per day and total tables and the CSV agree to the cent.
+
+// summary aggregates the trades of one coin, day or the total
+type summary struct {
+	Key      string
+	Quote    string // currency of the amounts
+	Trades   int
+	Canceled int
+	Wins     int
+	Gross    float64
+	Fees     float64
+	Net      float64
+	winRate  bool // false when trades can't be judged individually (Kraken executions)
+}
+
+// row is a single trade or execution contributing to the summaries
+type row struct {
+	Coin     string
+	Quote    string
+	Day      string
+	Canceled bool
+	Gross    float64
+	Fees     float64
+	Net      float64
+}
+
+func main() {
+	// Panic values and traces may quote requests, scrub them like logs
+	defer redact.Panics()
+
+	coin := flag.String("coin", "", "Only report trades of this coin (e.g. BTC)")
+	configPath := flag.String("config", "", "Path to a YAML config file, its money section sets the rounding of the amounts")
+	csvPath := flag.String("csv", "", "Export the individual trades (or executions with -kraken) to a CSV file")
+	journalPath := flag.String("journal", defaultJournalPath(), "Trade journal written by the trader")
+	fromKraken := flag.Bool("kraken", false, "Read executions from Kraken's TradesHistory instead of the journal")
+	importFlag := flag.Bool("import", false, "Import the account's executions and ledger entries from Kraken into the journal")
+	taxYear := flag.Int("tax", 0, "Report the disposals of this year with their FIFO cost basis, -csv exports them")
+	taxCurrency := flag.String("tax-currency", "USD", "Currency the tax report is in")
+	sinceFlag := flag.String("since", "", "Only trades started on or after this day (YYYY-MM-DD)")
+	untilFlag := flag.String("until", "", "Only trades started before this day (YYYY-MM-DD)")
+	untradeable := flag.Bool("untradeable", false, "Include trades placed with -untradeable")
+	snapshotsOf := flag.String("snapshots", "", "Print the market snapshots journaled for this trade ID as JSON lines")
+	flag.Parse()
+
+	if *snapshotsOf != "" {
+		if err := printSnapshots(*journalPath, *snapshotsOf); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	cfg, err := config.Load(*configPath)
+	if err != nil {
+		fmt.Printf("Error loading config: %v\n", err)
+		os.Exit(2)
+	}
+	if err := money.SetPolicy(cfg.Money); err != nil {
+		fmt.Printf("Error: invalid money policy: %v\n", err)
+		os.Exit(2)
+	}
+	if err := kraken.SetBaseURL(cfg.APIURL); err != nil {
+		fmt.Printf("Error: invalid api_url: %v\n", err)
+		os.Exit(2)
+	}
+
+	loc := cfg.Location()
+	since, err := parseDay(*sinceFlag, loc)
+	if err != nil {
+		fmt.Printf("Error: invalid -since: %v\n", err)
+		os.Exit(2)
+	}
+	until, err := parseDay(*untilFlag, loc)
+	if err != nil {
+		fmt.Printf("Error: invalid -until: %v\n", err)
+		os.Exit(2)
+	}
+
+	if *importFlag {
+		if err := importHistory(*journalPath, since); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+	if *taxYear != 0 {
+		if err := taxReport(*journalPath, *fromKraken, *taxYear, strings.ToUpper(*taxCurrency), *coin, *csvPath, loc); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	var rows []row
+	var csvRecords [][]string
+	if *fromKraken {
+		rows, csvRecords, err = krakenRows(since, until, *coin, loc)
+	} else {
+		rows, csvRecords, err = journalRows(*journalPath, since, until, *coin, *untradeable, loc)
+	}
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	if len(rows) == 0 {
+		fmt.Println("No trades found")
+	} else {
+		byCoin := summarize(rows, func(r row) string { return r.Coin }, !*fromKraken)
+		byDay := summarize(rows, func(r row) string { return r.Day }, !*fromKraken)
+		total := summarize(rows, func(r row) string { return "TOTAL" }, !*fromKraken)
+
+		printSummaries("Per coin", "COIN", byCoin)
+		printSummaries("Per day", "DAY", byDay)
+		printSummaries("Total", "", total)
+	}
+
+	if *csvPath != "" {
+		if err := writeCSV(*csvPath, csvRecords); err != nil {
+			fmt.Printf("Error writing CSV: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("\nExported %d rows to %s\n", len(csvRecords)-1, *csvPath)
+	}
+}
+
+// journalRows reads finished trades from the journal
+func journalRows(path string, since time.Time, until time.Time, coin string, untradeable bool, loc *time.Location) ([]row, [][]string, error) {
+	if _, err := os.Stat(path); err != nil {
+		return nil, nil, fmt.Errorf("trade journal %s not found: %v", path, err)
+	}
+	journal, err := store.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer journal.Close()
+
+	trades, err := journal.Trades(since, until)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var rows []row
+	records := [][]string{{"trade_id", "pair", "started_at", "finished_at", "result", "volume", "buy_price", "sell_price", "gross_profit", "fees", "net_profit", "estimated_profit", "untradeable"}}
+	for _, t := range trades {
+		tradeCoin, quote, _ := strings.Cut(t.Pair, "/")
+		if coin != "" && !strings.EqualFold(coin, tradeCoin) {
+			continue
+		}
+		if t.Untradeable && !untradeable {
+			continue
+		}
+		// Open trades have no realized P&L yet, manual sessions have none at all
+		if t.Result == "" || t.Result == manual.Result {
+			continue
+		}
+		// Journals written before the money policy hold unrounded amounts
+		gross := money.Round(t.GrossProfit, quote)
+		fees := money.Round(t.Fees, quote)
+		net := money.Round(gross-fees, quote)
+		rows = append(rows, row{
+			Coin:     tradeCoin,
+			Quote:    quote,
+			Day:      t.StartedAt.In(loc).Format("2006-01-02"),
+			Canceled: t.Result != "complete" && t.Result != "partial",
+			Gross:    gross,
+			Fees:     fees,
+			Net:      net,
+		})
+		records = append(records, []string{
+			t.ID, t.Pair, t.StartedAt.In(loc).Format(time.RFC3339), t.FinishedAt.In(loc).Format(time.RFC3339), t.Result,
+			formatFloat(t.Volume), formatFloat(t.BuyPrice), formatFloat(t.SellPrice), money.Format(gross, quote),
+			money.Format(fees, quote), money.Format(net, quote), money.Format(t.EstimatedProfit, quote), strconv.FormatBool(t.Untradeable),
+		})
+	}
+	return rows, records, nil
+}
+
+// printSnapshots prints the market snapshots of a trade, one JSON object per line
+func printSnapshots(path string, tradeID string) error {
+	if _, err := os.Stat(path); err != nil {
+		return fmt.Errorf("trade journal %s not found: %v", path, err)
+	}
+	journal, err := store.Open(path)
+	if err != nil {
+		return err
+	}
+	defer journal.Close()
+
+	snapshots, err := journal.Snapshots(tradeID)
+	if err != nil {
+		return err
+	}
+	if len(snapshots) == 0 {
+		return fmt.Errorf("no snapshots journaled for trade %s", tradeID)
+	}
+	encoder := json.NewEncoder(os.Stdout)
+	for _, snap := range snapshots {
+		if err := encoder.Encode(map[string]interface{}{
+			"trade_id": snap.TradeID,
+			"reason":   snap.Reason,
+			"taken_at": snap.TakenAt.UTC(),
+			"book":     snap.Book,
+			"trades":   snap.Trades,
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// importHistory copies the executions and ledger entries booked after the last imported ones (or
+// since, on the first import) from Kraken into the journal
+func importHistory(journalPath string, since time.Time) error {
+	ctx := context.Background()
+	if os.Getenv("KRAKEN_API_KEY") == "" || os.Getenv("KRAKEN_PRIVATE_KEY") == "" {
+		return fmt.Errorf("KRAKEN_API_KEY and KRAKEN_PRIVATE_KEY environment variables must be set")
+	}
+	if journalPath == "" {
+		return fmt.Errorf("no journal to import into, set -journal")
+	}
+	journal, err := store.Open(journalPath)
+	if err != nil {
+		return err
+	}
+	defer journal.Close()
+
+	start, err := journal.LastExecution()
+	if err != nil {
+		return err
+	}
+	if start.IsZero() {
+		start = since
+	}
+	trades, err := kraken.GetTradesHistory(ctx, start, time.Time{})
+	if err != nil {
+		return fmt.Errorf("error getting trades history: %v", err)
+	}
+	executions := make([]store.Execution, len(trades))
+	for i, t := range trades {
+		executions[i] = store.Execution{TxID: t.TxID, OrderTxID: t.OrderTxID, Pair: t.Pair, ExecutedAt: t.Time,
+			Side: t.Type, Price: t.Price, Volume: t.Volume, Cost: t.Cost, Fee: t.Fee}
+	}
+	importedExecutions, err := journal.ImportExecutions(executions)
+	if err != nil {
+		return err
+	}
+
+	start, err = journal.LastLedgerEntry()
+	if err != nil {
+		return err
+	}
+	if start.IsZero() {
+		start = since
+	}
+	ledger, err := kraken.GetLedgers(ctx, start, time.Time{})
+	if err != nil {
+		return fmt.Errorf("error getting ledger: %v", err)
+	}
+	entries := make([]store.LedgerEntry, len(ledger))
+	for i, e := range ledger {
+		entries[i] = store.LedgerEntry{ID: e.ID, RefID: e.RefID, BookedAt: e.Time, Type: e.Type, Asset: e.Asset,
+			Amount: e.Amount, Fee: e.Fee, Balance: e.Balance}
+	}
+	importedEntries, err := journal.ImportLedger(entries)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Imported %d executions and %d ledger entries into %s\n", importedExecutions, importedEntries, journalPath)
+	return nil
+}
+
+// krakenRows reads the account's executions from Kraken
+func krakenRows(since time.Time, until time.Time, coin string, loc *time.Location) ([]row, [][]string, error) {
+	ctx := context.Background()
+	if os.Getenv("KRAKEN_API_KEY") == "" || os.Getenv("KRAKEN_PRIVATE_KEY") == "" {
+		return nil, nil, fmt.Errorf("KRAKEN_API_KEY and KRAKEN_PRIVATE_KEY environment variables must be set")
+	}
+
+	pairs, err := kraken.LoadAssetPairs(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	executions, err := kraken.GetTradesHistory(ctx, since, until)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var rows []row
+	records := [][]string{{"txid", "order_txid", "pair", "time", "type", "price", "volume", "cost", "fee"}}
+	for _, e := range executions {
+		pairName, tradeCoin, quote := pairCoins(pairs, e.Pair)
+		if coin != "" && !strings.EqualFold(coin, tradeCoin) {
+			continue
+		}
+
+		cost := money.Round(e.Cost, quote)
+		fee := money.Round(e.Fee, quote)
+		cashFlow := cost
+		if e.Type == "buy" {
+			cashFlow = -cost
+		}
+		rows = append(rows, row{
+			Coin:  tradeCoin,
+			Quote: quote,
+			Day:   e.Time.In(loc).Format("2006-01-02"),
+			Gross: cashFlow,
+			Fees:  fee,
+			Net:   money.Round(cashFlow-fee, quote),
+		})
+		records = append(records, []string{
+			e.TxID, e.OrderTxID, pairName, e.Time.In(loc).Format(time.RFC3339), e.Type,
+			formatFloat(e.Price), formatFloat(e.Volume), money.Format(cost, quote), money.Format(fee, quote),
+		})
+	}
+	return rows, records, nil
+}
+
+// pairCoins reports a Kraken pair name the way the trader names it, e.g. XXBTZUSD as BTC/USD,
+// with its base coin and quote currency
+func pairCoins(pairs map[string]*kraken.AssetPair, name string) (string, string, string) {
+	pairName := name
+	if pair, ok := pairs[name]; ok && pair.WSName != "" {
+		pairName = pair.WSName
+	}
+	coin, quote, _ := strings.Cut(pairName, "/")
+	if coin == "XBT" {
+		coin = "BTC"
+	}
+	return pairName, coin, quote
+}
+
+// taxReport prints the year's disposals per coin with their FIFO cost basis in currency and exports
+// them to csvPath. The executions come from the journal's imported copy, or from Kraken with fromKraken.
+func taxReport(journalPath string, fromKraken bool, year int, currency string, coin string, csvPath string, loc *time.Location) error {
+	ctx := context.Background()
+	pairs, err := kraken.LoadAssetPairs(ctx)
+	if err != nil {
+		return err
+	}
+
+	var executions []store.Execution
+	if fromKraken {
+		if os.Getenv("KRAKEN_API_KEY") == "" || os.Getenv("KRAKEN_PRIVATE_KEY") == "" {
+			return fmt.Errorf("KRAKEN_API_KEY and KRAKEN_PRIVATE_KEY environment variables must be set")
+		}
+		trades, err := kraken.GetTradesHistory(ctx, time.Time{}, time.Time{})
+		if err != nil {
+			return fmt.Errorf("error getting trades history: %v", err)
+		}
+		for _, t := range trades {
+			executions = append(executions, store.Execution{TxID: t.TxID, Pair: t.Pair, ExecutedAt: t.Time, Side: t.Type,
+				Volume: t.Volume, Cost: t.Cost, Fee: t.Fee})
+		}
+	} else {
+		if _, err := os.Stat(journalPath); err != nil {
+			return fmt.Errorf("trade journal %s not found: %v", journalPath, err)
+		}
+		journal, err := store.Open(journalPath)
+		if err != nil {
+			return err
+		}
+		defer journal.Close()
+		if executions, err = journal.Executions(time.Time{}, time.Time{}); err != nil {
+			return err
+		}
+		if len(executions) == 0 {
+			return fmt.Errorf("no executions imported into %s, run with -import first", journalPath)
+		}
+	}
+
+	// All executions are matched, lots of a coin can come from trades against another coin, e.g.
+	// BTC bought on ETH/BTC sells; -coin only filters the report
+	var taxable []tax.Execution
+	for _, e := range executions {
+		_, tradeCoin, quote := pairCoins(pairs, e.Pair)
+		if quote == "XBT" {
+			quote = "BTC"
+		}
+		taxable = append(taxable, tax.Execution{TxID: e.TxID, Time: e.ExecutedAt, Asset: tradeCoin, Quote: quote, Side: e.Side,
+			Volume: e.Volume, Cost: e.Cost, Fee: e.Fee})
+	}
+	all, err := tax.FIFO(taxable, year, loc, currency, historicalRate(ctx, currency))
+	if err != nil {
+		return err
+	}
+	var disposals []tax.Disposal
+	for _, d := range all {
+		if coin == "" || strings.EqualFold(coin, d.Asset) {
+			disposals = append(disposals, d)
+		}
+	}
+	if len(disposals) == 0 {
+		fmt.Printf("No disposals in %d\n", year)
+		return nil
+	}
+
+	// Amounts are rounded per disposal, the totals are sums of the rounded amounts like the CSV's
+	type total struct {
+		disposals                   int
+		proceeds, basis, fees, gain float64
+		unmatched                   bool
+	}
+	totals := map[string]*total{}
+	records := [][]string{{"txid", "asset", "quote", "currency", "acquired", "disposed", "volume", "proceeds", "cost_basis", "fees", "gain", "unmatched_volume"}}
+	for _, d := range disposals {
+		proceeds, basis, fees := money.Round(d.Proceeds, currency), money.Round(d.CostBasis, currency), money.Round(d.Fees, currency)
+		gain := money.Round(proceeds-basis-fees, currency)
+		t, ok := totals[d.Asset]
+		if !ok {
+			t = &total{}
+			totals[d.Asset] = t
+		}
+		t.disposals++
+		t.proceeds += proceeds
+		t.basis += basis
+		t.fees += fees
+		t.gain += gain
+		t.unmatched = t.unmatched || d.Unmatched > 0
+
+		acquired := ""
+		if !d.Acquired.IsZero() {
+			acquired = d.Acquired.In(loc).Format(time.RFC3339)
+		}
+		records = append(records, []string{
+			d.TxID, d.Asset, d.Quote, currency, acquired, d.Time.In(loc).Format(time.RFC3339), formatFloat(d.Volume),
+			money.Format(proceeds, currency), money.Format(basis, currency), money.Format(fees, currency), money.Format(gain, currency),
+			formatFloat(d.Unmatched),
+		})
+	}
+
+	keys := make([]string, 0, len(totals))
+	for key := range totals {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	fmt.Printf("Disposals in %d (FIFO, %s):\n", year, currency)
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintf(w, "ASSET\tDISPOSALS\tPROCEEDS\tCOST BASIS\tFEES\tGAIN\t\n")
+	unmatched := false
+	for _, key := range keys {
+		t := totals[key]
+		marker := ""
+		if t.unmatched {
+			marker, unmatched = " *", true
+		}
+		fmt.Fprintf(w, "%s%s\t%d\t%s\t%s\t%s\t%s\t\n", key, marker, t.disposals, money.Format(t.proceeds, currency),
+			money.Format(t.basis, currency), money.Format(t.fees, currency), money.Format(t.gain, currency))
+	}
+	w.Flush()
+	if unmatched {
+		fmt.Println("\n* sold more than bought before, e.g. deposited coins: the excess has no cost basis")
+	}
+
+	if csvPath != "" {
+		if err := writeCSV(csvPath, records); err != nil {
+			return fmt.Errorf("error writing CSV: %v", err)
+		}
+		fmt.Printf("\nExported %d disposals to %s\n", len(records)-1, csvPath)
+	}
+	return nil
+}
+
+// historicalRate returns a tax.Rate converting to currency at the first public trade of the day of
+// the asset's pair with it, or the inverse pair's (e.g. EUR/USD or USD/JPY), cached per asset and day
+func historicalRate(ctx context.Context, currency string) tax.Rate {
+	cache := map[string]float64{}
+	return func(asset string, t time.Time) (float64, error) {
+		day := t.UTC().Truncate(24 * time.Hour)
+		key := asset + " " + day.Format(time.DateOnly)
+		if rate, ok := cache[key]; ok {
+			return rate, nil
+		}
+
+		pair, inverse := "", false
+		if p, err := kraken.GetAssetPair(ctx, asset, currency); err == nil {
+			pair = p.Altname
+		} else if p, err := kraken.GetAssetPair(ctx, currency, asset); err == nil {
+			pair, inverse = p.Altname, true
+		} else {
+			return 0, fmt.Errorf("no %s/%s pair to convert with", asset, currency)
+		}
+		trades, _, err := kraken.GetRecentTrades(ctx, pair, strconv.FormatInt(day.Unix(), 10))
+		if err != nil {
+			return 0, err
+		}
+		if len(trades) == 0 || trades[0].Price <= 0 {
+			return 0, fmt.Errorf("no %s trades on %s", pair, day.Format(time.DateOnly))
+		}
+		rate := trades[0].Price
+		if inverse {
+			rate = 1 / rate
+		}
+		cache[key] = rate
+		return rate, nil
+	}
+}
+
+// summarize groups rows by key, sorted by key
+func summarize(rows []row, key func(row) string, winRate bool) []*summary {
+	groups := map[string]*summary{}
+	for _, r := range rows {
+		k := key(r)
+		s, ok := groups[k]
+		if !ok {
+			s = &summary{Key: k, Quote: r.Quote, winRate: winRate}
+			groups[k] = s
+		}
+		if r.Canceled {
+			s.Canceled++
+			continue
+		}
+		s.Trades++
+		if r.Net > 0 {
+			s.Wins++
+		}
+		// Rows are rounded already, rounding the sums only drops float noise
+		s.Gross = money.Sum(r.Quote, s.Gross, r.Gross)
+		s.Fees = money.Sum(r.Quote, s.Fees, r.Fees)
+		s.Net = money.Sum(r.Quote, s.Net, r.Net)
+	}
+
+	summaries := make([]*summary, 0, len(groups))
+	for _, s := range groups {
+		summaries = append(summaries, s)
+	}
+	sort.Slice(summaries, func(i, j int) bool { return summaries[i].Key < summaries[j].Key })
+	return summaries
+}
+
+// printSummaries prints a summary table
+func printSummaries(title string, keyHeader string, summaries []*summary) {
+	fmt.Printf("\n%s:\n", title)
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintf(w, "%s\tTRADES\tCANCELED\tWIN RATE\tGROSS USD\tFEES USD\tNET USD\t\n", keyHeader)
+	for _, s := range summaries {
+		winRate := "-"
+		if s.winRate && s.Trades > 0 {
+			winRate = fmt.Sprintf("%.1f%%", float64(s.Wins)/float64(s.Trades)*100)
+		}
+		fmt.Fprintf(w, "%s\t%d\t%d\t%s\t%s\t%s\t%s\t\n", s.Key, s.Trades, s.Canceled, winRate,
+			money.Format(s.Gross, s.Quote), money.Format(s.Fees, s.Quote), money.Format(s.Net, s.Quote))
+	}
+	w.Flush()
+}
+
+// writeCSV writes the records to path
+func writeCSV(path string, records [][]string) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	writer := csv.NewWriter(file)
+	if err := writer.WriteAll(records); err != nil {
+		return err
+	}
+	return file.Sync()
+}
+
+// parseDay parses a YYYY-MM-DD day as its midnight in loc, empty means no bound
+func parseDay(s string, loc *time.Location) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	return time.ParseInLocation("2006-01-02", s, loc)
+}
+
+// defaultJournalPath returns the journal location in the state directory
+func defaultJournalPath() string {
+	dir, err := kraken.StateDir()
+	if err != nil {
+		return "journal.db"
+	}
+	return filepath.Join(dir, "journal.db")
+}
+
+// formatFloat formats a number for CSV without losing precision
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
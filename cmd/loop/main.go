@@ -1,24 +1,65 @@
 package main
 
 import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
 	"flag"
 	"fmt"
+	"math"
 	"os"
-	"os/exec"
-	"path/filepath"
+	"os/signal"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
 	"time"
+
+	"github.com/jkosik/crypto-trader/internal/config"
+	"github.com/jkosik/crypto-trader/internal/exitcode"
+	"github.com/jkosik/crypto-trader/internal/kraken"
+	"github.com/jkosik/crypto-trader/internal/logging"
+	"github.com/jkosik/crypto-trader/internal/money"
+	"github.com/jkosik/crypto-trader/internal/numparse"
+	"github.com/jkosik/crypto-trader/internal/redact"
+	"github.com/jkosik/crypto-trader/internal/report"
+	"github.com/jkosik/crypto-trader/internal/trader"
 )
 
-// Loop trading bot that executes multiple trades in sequence using the trader bot.
-// This program runs the trader bot multiple times with the same parameters and logs the results.
+// Loop trading bot that executes multiple trades in sequence with the trader's trading flow.
+// This program runs the trade of internal/trader multiple times with the same parameters and logs
+// the results. Iterations that time out waiting for the spread or for their orders to fill, or end
+// canceled, are skipped; timed-out, canceled and losing ones are followed by the cooldown. Any
+// other failure stops the loop with the exit code a standalone trader would have exited with.
+// SIGINT and SIGTERM stop the running trade, which cleans up its orders, and the loop after it.
+// Each iteration's result and P&L come back as a trader.TradeResult. When the loop ends, stopped
+// or not, it prints a P&L summary of the iterations, writes it to -summary and posts it to Slack.
+//
+// Several coins (repeated or comma-separated -coin, or the config's watchlist) are looped side by
+// side, each with its own iterations, cooldown, report and summary. Their trades run in this
+// process and share its API rate limiter, nonce and order settings, so coins looped together
+// can't have different leverage. A failure stops only its coin's loop; the loop exits with the
+// first failed coin's code once all are done.
 //
 // Usage:
 //   go run cmd/loop/main.go -coin BTC -volume 0.1 -iterations 20
 //
 // Flags:
-//   -coin string      Base coin to trade (e.g. BTC, SOL)
-//   -volume float     Base coin volume to trade
-//   -iterations int   Number of trades to execute (default: 10)
+//   -coin string      Base coin to trade (e.g. BTC, SOL), repeated or comma-separated for several (default: watchlist of the config)
+//   -volume float     Base coin volume to trade, unless the coin's config sets volume or usd
+//   -usd float        USD amount to trade, converted to volume by the trader each iteration (instead of -volume)
+//   -iterations int   Number of trades to execute per coin (default: 10)
+//   -config file      YAML config file with trading parameters (see config.example.yaml)
+//   -reportdir dir    Directory for the trade reports (default: current directory)
+//   -reportmaxsize    Report size in bytes after which it rotates to a new part (default: 10 MiB)
+//   -summary file     Write the run's P&L summary per coin to this file, JSON if it ends in .json, CSV otherwise
+//   -paper            Paper trade every iteration against the trader's virtual account
+//   -postonly         Place maker-only orders every iteration
+//   -spreadnarrow     Spread narrowing factor of every iteration, overriding the config
+//   -maxwait          Cancel an iteration's orders if neither has filled after this long
+//   -yes              Accept risk-relevant parameter increases since the last run
+//   -quote string     Quote currency of the traded pairs, e.g. EUR or USDT (default: USD)
+//   -loglevel         Minimum log level of the trades: debug, info, warn or error (default: info)
 //
 // Example:
 //   # Execute N iterations of trades
@@ -26,103 +67,451 @@ import (
 //
 //   # Execute 10 trades (default iteration count)
 //   go run cmd/loop/main.go -coin SUNDOG -volume 300
+//
+//   # Trade two coins side by side, $50 each
+//   go run cmd/loop/main.go -coin SUNDOG,GHIBLI -usd 50
+
+// coinList collects coin codes from repeated or comma-separated -coin flags
+type coinList []string
+
+func (c *coinList) String() string {
+	return strings.Join(*c, ",")
+}
+
+func (c *coinList) Set(value string) error {
+	for _, coin := range strings.Split(value, ",") {
+		if coin = strings.TrimSpace(coin); coin != "" {
+			*c = append(*c, coin)
+		}
+	}
+	return nil
+}
+
+// options are the loop settings shared by all coins
+type options struct {
+	cfg          *config.Config
+	iterations   int
+	paper        bool
+	postOnly     bool
+	spreadNarrow float64
+	maxWait      time.Duration
+	yes          bool
+	shutdown     chan struct{} // closed on the first SIGINT or SIGTERM
+}
+
+// coinLoop runs the iterations of one coin
+type coinLoop struct {
+	coin    string
+	volume  float64
+	usd     float64
+	prefix  string // output prefix telling the coins apart, empty for a single coin
+	report  *report.Writer
+	results []*trader.TradeResult
+}
 
 func main() {
-	baseCoin := flag.String("coin", "", "Base coin to trade (e.g. BTC, SOL)")
-	volume := flag.Float64("volume", 0.0, "Base coin volume to trade")
-	iterations := flag.Int("iterations", 10, "Number of trades to execute")
+	// Panic values and traces may quote requests, scrub them like logs
+	defer redact.Panics()
+
+	var coins coinList
+	flag.Var(&coins, "coin", "Base coin to trade (e.g. BTC, SOL), repeated or comma-separated to trade several side by side (default: the config's watchlist)")
+	volume := numparse.FloatFlag("volume", 0.0, "Base coin volume to trade, unless the coin's config sets volume or usd")
+	usd := numparse.FloatFlag("usd", 0.0, "USD amount to trade, converted to volume at the current bid each iteration (instead of -volume)")
+	iterations := flag.Int("iterations", 10, "Number of trades to execute per coin")
+	configPath := flag.String("config", "", "Path to a YAML config file with trading parameters")
+	reportDir := flag.String("reportdir", ".", "Directory for the trade reports, rotated daily")
+	reportMaxSize := flag.Int64("reportmaxsize", report.DefaultMaxSize, "Report size in bytes after which it rotates to a new part (0 disables)")
+	summaryPath := flag.String("summary", "", "Write the run's P&L summary per coin to this file, JSON if it ends in .json, CSV otherwise")
+	paper := flag.Bool("paper", false, "Paper trade every iteration instead of placing real orders")
+	postOnly := flag.Bool("postonly", false, "Place maker-only orders every iteration")
+	spreadNarrow := numparse.FloatFlag("spreadnarrow", -1, "Spread narrowing factor of every iteration, 0 to 1 (default from the config)")
+	maxWait := flag.Duration("maxwait", 0, "Cancel an iteration's orders if neither has filled after this long (0 waits forever)")
+	yes := flag.Bool("yes", false, "Accept risk-relevant parameter increases since the last run")
+	quote := flag.String("quote", "USD", "Quote currency of the traded pairs, e.g. USD, EUR or USDT")
+	logLevel := flag.String("loglevel", "info", "Minimum log level of the trades: debug, info, warn or error")
 	flag.Parse()
+	kraken.Quote = strings.ToUpper(*quote)
 
-	if *baseCoin == "" || *volume == 0.0 {
-		fmt.Println("Error: -coin and -volume flags are required")
-		fmt.Println("Usage: ./loop -coin <COIN> -volume <AMOUNT> [-iterations <NUMBER>]")
-		fmt.Println("\nFlags:")
-		fmt.Println("  -coin <COIN>    Base coin to trade (e.g. BTC, SOL)")
-		fmt.Println("  -volume <AMOUNT> Base coin volume to trade")
-		fmt.Println("  -iterations <NUMBER> Number of trades to execute (default: 10)")
-		os.Exit(1)
+	if err := logging.Setup(os.Stdout, "text", *logLevel); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(exitcode.Config)
+	}
+	if *spreadNarrow > 1 {
+		fmt.Printf("Error: -spreadnarrow must be between 0 and 1, got %g\n", *spreadNarrow)
+		os.Exit(exitcode.Config)
 	}
 
-	// Create report file
-	report := fmt.Sprintf("trades-%s-%s.txt", *baseCoin, time.Now().Format("2006-01-02-15-04"))
-	reportFile, err := os.Create(report)
-	if err != nil {
-		fmt.Printf("Error creating report file: %v\n", err)
+	if *volume != 0 && *usd != 0 {
+		fmt.Println("Error: -volume and -usd are mutually exclusive")
 		os.Exit(1)
 	}
-	defer reportFile.Close()
 
-	// Get the path to the trader binary, working from both root and cmd/loop
-	traderPath, err := getTraderPath()
+	cfg, err := config.Load(*configPath)
 	if err != nil {
-		fmt.Printf("Error finding trader path: %v\n", err)
+		fmt.Printf("Error loading config: %v\n", err)
+		os.Exit(1)
+	}
+	if err := money.SetPolicy(cfg.Money); err != nil {
+		fmt.Printf("Error: invalid money policy: %v\n", err)
+		os.Exit(1)
+	}
+	if err := kraken.SetBaseURL(cfg.APIURL); err != nil {
+		fmt.Printf("Error: invalid api_url: %v\n", err)
 		os.Exit(1)
 	}
 
-	for i := 1; i <= *iterations; i++ {
-		fmt.Printf("Running iteration %d\n", i)
+	if len(coins) == 0 {
+		coins = cfg.Watchlist
+	}
+	var loops []*coinLoop
+	seen := map[string]bool{}
+	for _, coin := range coins {
+		if seen[strings.ToUpper(coin)] {
+			continue
+		}
+		seen[strings.ToUpper(coin)] = true
 
-		// Run the trader command
-		cmd := exec.Command("go", "run", traderPath, "-coin", *baseCoin, "-order", "-volume", fmt.Sprintf("%f", *volume))
-		cmd.Stdout = os.Stdout
-		cmd.Stderr = os.Stderr
+		// The coin's configured size wins over the flags
+		loop := &coinLoop{coin: coin}
+		loop.volume, loop.usd = cfg.TradeSize(coin)
+		if loop.volume == 0 && loop.usd == 0 {
+			loop.volume, loop.usd = *volume, *usd
+		}
+		if loop.volume == 0 && loop.usd == 0 {
+			fmt.Printf("Error: no trade size for %s, set -volume or -usd, or coins.%s.volume or usd in the config\n", coin, coin)
+			os.Exit(1)
+		}
+		loops = append(loops, loop)
+	}
+	if len(loops) == 0 {
+		fmt.Println("Error: -coin (or a watchlist in the config) and -volume (or -usd) flags are required")
+		fmt.Println("Usage: ./loop -coin <COIN>[,<COIN>...] -volume <AMOUNT> [-iterations <NUMBER>]")
+		fmt.Println("\nFlags:")
+		fmt.Println("  -coin <COIN>    Base coin to trade (e.g. BTC, SOL), comma-separated for several")
+		fmt.Println("  -volume <AMOUNT> Base coin volume to trade")
+		fmt.Println("  -usd <AMOUNT>   USD amount to trade instead of -volume")
+		fmt.Println("  -iterations <NUMBER> Number of trades to execute (default: 10)")
+		os.Exit(1)
+	}
 
-		if err := cmd.Run(); err != nil {
-			fmt.Printf("Iteration %d failed at %s\n", i, time.Now().Format("2006-01-02 15:04:05"))
+	// Open the reports, one file per coin and day in the configured time zone
+	for _, loop := range loops {
+		loop.report, err = report.Open(*reportDir, "trades-"+loop.coin, *reportMaxSize, cfg.Location())
+		if err != nil {
+			fmt.Printf("Error opening report file: %v\n", err)
 			os.Exit(1)
 		}
+		defer loop.report.Close()
+		if len(loops) > 1 {
+			loop.prefix = "[" + loop.coin + "] "
+		}
+	}
 
-		// Log successful trade
-		successMsg := fmt.Sprintf("%s - SUCCESSFUL TRADE %d\n", time.Now().Format("2006-01-02 15:04:05"), i)
-		if _, err := reportFile.WriteString(successMsg); err != nil {
-			fmt.Printf("Error writing to report file: %v\n", err)
+	// The order settings are the kraken package's, shared by the coins' trades
+	leverage := cfg.ForCoin(loops[0].coin).Leverage
+	for _, loop := range loops[1:] {
+		if cfg.ForCoin(loop.coin).Leverage != leverage {
+			fmt.Printf("Error: %s and %s have different leverage, loop them separately\n", loops[0].coin, loop.coin)
+			os.Exit(exitcode.Config)
+		}
+	}
+	configured := *cfg
+	configured.Leverage = leverage
+	trader.Configure(&configured, *postOnly, false)
+
+	opts := &options{
+		cfg:          cfg,
+		iterations:   *iterations,
+		paper:        *paper,
+		postOnly:     *postOnly,
+		spreadNarrow: *spreadNarrow,
+		maxWait:      *maxWait,
+		yes:          *yes,
+		shutdown:     make(chan struct{}),
+	}
+
+	// The first signal stops every coin's running trade and loop, the trades handle repeated
+	// signals like one
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-signals
+		fmt.Println("Shutdown signal received, waiting for the trades to clean up")
+		close(opts.shutdown)
+	}()
+
+	started := time.Now()
+	codes := make([]int, len(loops))
+	var wg sync.WaitGroup
+	for i, loop := range loops {
+		wg.Add(1)
+		go func(i int, loop *coinLoop) {
+			defer wg.Done()
+			codes[i] = loop.run(opts)
+		}(i, loop)
+	}
+	wg.Wait()
+
+	// Report the iterations run, stopped or not
+	for _, loop := range loops {
+		reportSummary(loop, started, *paper, cfg.Location())
+	}
+	if *summaryPath != "" {
+		if err := writeSummary(*summaryPath, loops, started, *paper); err != nil {
+			fmt.Printf("Error writing the summary: %v\n", err)
+		} else {
+			fmt.Printf("Summary written to %s\n", *summaryPath)
+		}
+	}
+	for _, code := range codes {
+		if code != 0 {
+			os.Exit(code)
+		}
+	}
+}
+
+// run runs the coin's iterations and returns the exit code that stopped them, 0 if all ran
+func (l *coinLoop) run(opts *options) int {
+	cfg := opts.cfg
+	// The trades run with the coin's profile, the loop's delays are the config's
+	coinCfg := cfg.ForCoin(l.coin)
+	if opts.spreadNarrow >= 0 {
+		coinCfg.SpreadNarrowFactor = opts.spreadNarrow
+	}
+
+	// Consecutive canceled, timed-out or losing iterations, each shrinks the next trade by
+	// cooldown_size_factor until a profitable one resets it
+	setbacks := 0
+
+	for i := 1; i <= opts.iterations; i++ {
+		sizeFactor := math.Pow(cfg.CooldownSizeFactor, float64(setbacks))
+		fmt.Printf("%sRunning iteration %d\n", l.prefix, i)
+		if sizeFactor < 1 {
+			fmt.Printf("%sTrade size at %.4g of the requested after %d setbacks\n", l.prefix, sizeFactor, setbacks)
+		}
+
+		result := trader.Run(context.Background(), l.tradeOptions(opts, coinCfg, sizeFactor))
+		l.results = append(l.results, result)
+		stopped := opts.stopping()
+		if code := result.Code; code != exitcode.OK {
+			fmt.Printf("%sIteration %d failed at %s: %s (exit code %d)\n", l.prefix, i, time.Now().In(cfg.Location()).Format("2006-01-02 15:04:05"), exitcode.Describe(code), code)
+
+			// The market wasn't there, or other trades still hold the exposure, nothing was traded.
+			// Try again in the next iteration.
+			if (code == exitcode.SpreadTimeout || code == exitcode.RiskLimit) && !stopped {
+				if i < opts.iterations && !l.wait(opts, cfg.LoopDelay) {
+					return l.stop(cfg.Location())
+				}
+				continue
+			}
+			// The market is trending, cool down until it settles
+			if code == exitcode.Trending && !stopped {
+				if i < opts.iterations && !l.wait(opts, cooldown(cfg)) {
+					return l.stop(cfg.Location())
+				}
+				continue
+			}
+			// The market moved away from the orders or they were canceled, cool down before the
+			// next iteration and trade smaller
+			if (code == exitcode.OrderTimeout || code == exitcode.TradeCanceled) && !stopped {
+				setbacks++
+				if i < opts.iterations && !l.wait(opts, cooldown(cfg)) {
+					return l.stop(cfg.Location())
+				}
+				continue
+			}
+			return code
+		}
+
+		// Log successful trade, synced to disk before the next trade starts
+		successMsg := fmt.Sprintf("%s - SUCCESSFUL TRADE %d", time.Now().In(cfg.Location()).Format("2006-01-02 15:04:05"), i)
+		if opts.paper {
+			successMsg += " (paper)"
+		}
+		successMsg += fmt.Sprintf(" %s, net profit %s %s, trade %s", result.Result, strconv.FormatFloat(result.NetProfitUSD, 'f', -1, 64), kraken.Quote, result.TradeID)
+		if err := l.report.Append(successMsg); err != nil {
+			fmt.Printf("%sError writing to report file: %v\n", l.prefix, err)
+		}
+
+		if stopped {
+			return l.stop(cfg.Location())
+		}
+
+		// A losing trade cools down like a canceled one, a profitable one restores the full size
+		delay := cfg.LoopDelay
+		if result.NetProfitUSD < 0 {
+			fmt.Printf("%sIteration %d lost %s %s\n", l.prefix, i, strconv.FormatFloat(result.NetProfitUSD, 'f', -1, 64), kraken.Quote)
+			setbacks++
+			delay = cooldown(cfg)
+		} else {
+			setbacks = 0
 		}
 
 		// Add a delay between iterations to prevent too rapid execution
-		if i < *iterations {
-			delayMinutes := 5
-			fmt.Printf("\nWaiting %d minutes before next iteration...\n", delayMinutes)
-			time.Sleep(time.Duration(delayMinutes) * time.Minute)
+		if i < opts.iterations && !l.wait(opts, delay) {
+			return l.stop(cfg.Location())
 		}
 	}
+	return 0
 }
 
-// getTraderPath returns the correct path to the trader binary based on current directory
-// to allow running from both root and cmd/loop
-func getTraderPath() (string, error) {
-	// Get current working directory
-	cwd, err := os.Getwd()
-	if err != nil {
-		return "", fmt.Errorf("error getting current directory: %v", err)
+// tradeOptions returns the trade of an iteration trading sizeFactor of the coin's size
+func (l *coinLoop) tradeOptions(opts *options, cfg *config.Config, sizeFactor float64) trader.Options {
+	trade := trader.DefaultOptions()
+	trade.Config = cfg
+	trade.Coin = l.coin
+	trade.Volume, trade.USD = l.volume*sizeFactor, l.usd*sizeFactor
+	trade.Order, trade.Paper = !opts.paper, opts.paper
+	trade.PostOnly = opts.postOnly
+	trade.MaxParticipation = cfg.MaxParticipationPercent
+	trade.MaxWait = opts.maxWait
+	// Without a prompt, increased risk is declined unless -yes accepts it
+	trade.Yes = opts.yes
+	trade.Shutdown = opts.shutdown
+	return trade
+}
+
+// reportSummary prints the P&L summary of the coin's iterations and posts it to Slack, except for
+// paper trades or without SLACK_WEBHOOK
+func reportSummary(loop *coinLoop, started time.Time, paper bool, loc *time.Location) {
+	summary := trader.Summarize(loop.results)
+	fmt.Printf("\n%s summary of %d iterations since %s:\n", loop.coin, len(loop.results), started.In(loc).Format("2006-01-02 15:04:05"))
+	fmt.Printf("  Trades: %d (%d won, %d lost)\n", summary.Trades, summary.Wins, summary.Losses)
+	quote := kraken.Quote
+	fmt.Printf("  Net profit: %s %s (gross %s %s, fees %s %s)\n", money.FormatSigned(summary.NetProfitUSD, quote), quote,
+		money.FormatSigned(summary.GrossProfitUSD, quote), quote, money.Format(summary.FeesUSD, quote), quote)
+	fmt.Printf("  Average fill time: %s\n", summary.AvgFillTime.Round(time.Second))
+	if summary.Spreads > 0 {
+		fmt.Printf("  Spread captured: best %.4f%%, worst %.4f%%\n", summary.BestSpreadPercent, summary.WorstSpreadPercent)
 	}
 
-	// Check if we're in the project root (look for go.mod)
-	if _, err := os.Stat("go.mod"); err == nil {
-		// We're in project root, trader is at cmd/trader/main.go
-		return "cmd/trader/main.go", nil
+	if paper || os.Getenv("SLACK_WEBHOOK") == "" {
+		return
+	}
+	message := fmt.Sprintf(
+		"📊 Loop summary for %s\n"+
+			"Iterations: %d, trades: %d (%d won, %d lost)\n"+
+			"Net profit: %s %s (gross %s %s, fees %s %s)\n"+
+			"Average fill time: %s",
+		kraken.PairName(loop.coin),
+		len(loop.results), summary.Trades, summary.Wins, summary.Losses,
+		money.FormatSigned(summary.NetProfitUSD, quote), quote, money.FormatSigned(summary.GrossProfitUSD, quote), quote, money.Format(summary.FeesUSD, quote), quote,
+		summary.AvgFillTime.Round(time.Second),
+	)
+	if summary.Spreads > 0 {
+		message += fmt.Sprintf("\nSpread captured: best %.4f%%, worst %.4f%%", summary.BestSpreadPercent, summary.WorstSpreadPercent)
 	}
+	if err := kraken.SendSlackMessage(context.Background(), message); err != nil {
+		fmt.Printf("Error sending the %s summary to Slack: %v\n", loop.coin, err)
+	}
+}
 
-	// Check if we're in cmd/loop directory
-	if filepath.Base(cwd) == "loop" && filepath.Base(filepath.Dir(cwd)) == "cmd" {
-		// We're in cmd/loop, trader is at ../trader/main.go
-		return filepath.Join("..", "trader", "main.go"), nil
+// writeSummary writes the summary of each coin as a JSON array of objects if path ends in .json,
+// otherwise as CSV with a header and a row per coin
+func writeSummary(path string, loops []*coinLoop, started time.Time, paper bool) error {
+	type field struct {
+		name  string
+		value interface{}
+	}
+	finished := time.Now()
+	var rows [][]field
+	for _, loop := range loops {
+		summary := trader.Summarize(loop.results)
+		rows = append(rows, []field{
+			{"pair", kraken.PairName(loop.coin)},
+			{"paper", paper},
+			{"started_at", started.UTC().Format(time.RFC3339)},
+			{"finished_at", finished.UTC().Format(time.RFC3339)},
+			{"iterations", len(loop.results)},
+			{"trades", summary.Trades},
+			{"wins", summary.Wins},
+			{"losses", summary.Losses},
+			{"gross_profit_usd", summary.GrossProfitUSD},
+			{"fees_usd", summary.FeesUSD},
+			{"net_profit_usd", summary.NetProfitUSD},
+			{"avg_fill_seconds", summary.AvgFillTime.Seconds()},
+			{"best_spread_percent", summary.BestSpreadPercent},
+			{"worst_spread_percent", summary.WorstSpreadPercent},
+		})
 	}
 
-	// Try to find go.mod by walking up the directory tree
-	dir := cwd
-	for {
-		if _, err := os.Stat(filepath.Join(dir, "go.mod")); err == nil {
-			// Found go.mod, construct path from project root
-			return filepath.Join(dir, "cmd", "trader", "main.go"), nil
+	if strings.HasSuffix(path, ".json") {
+		objects := []map[string]interface{}{}
+		for _, row := range rows {
+			object := map[string]interface{}{}
+			for _, f := range row {
+				object[f.name] = f.value
+			}
+			objects = append(objects, object)
 		}
+		data, err := json.MarshalIndent(objects, "", "  ")
+		if err != nil {
+			return err
+		}
+		return os.WriteFile(path, append(data, '\n'), 0644)
+	}
 
-		parent := filepath.Dir(dir)
-		if parent == dir {
-			// Reached filesystem root without finding go.mod
-			break
+	var records [][]string
+	for i, row := range rows {
+		if i == 0 {
+			header := make([]string, len(row))
+			for j, f := range row {
+				header[j] = f.name
+			}
+			records = append(records, header)
+		}
+		record := make([]string, len(row))
+		for j, f := range row {
+			record[j] = fmt.Sprint(f.value)
+			if v, ok := f.value.(float64); ok {
+				record[j] = strconv.FormatFloat(v, 'f', -1, 64)
+			}
 		}
-		dir = parent
+		records = append(records, record)
+	}
+	file, err := os.Create(path)
+	if err != nil {
+		return err
 	}
+	defer file.Close()
+	writer := csv.NewWriter(file)
+	if err := writer.WriteAll(records); err != nil {
+		return err
+	}
+	return file.Sync()
+}
+
+// cooldown returns the delay after a canceled, timed-out or losing iteration
+func cooldown(cfg *config.Config) time.Duration {
+	if cfg.Cooldown > 0 {
+		return cfg.Cooldown
+	}
+	return cfg.LoopDelay
+}
+
+// wait sleeps for the loop delay, returning false if a signal arrived meanwhile
+func (l *coinLoop) wait(opts *options, delay time.Duration) bool {
+	fmt.Printf("\n%sWaiting %s before next iteration...\n", l.prefix, delay)
+	select {
+	case <-time.After(delay):
+		return true
+	case <-opts.shutdown:
+		return false
+	}
+}
+
+// stopping reports whether a shutdown signal was received
+func (o *options) stopping() bool {
+	select {
+	case <-o.shutdown:
+		return true
+	default:
+		return false
+	}
+}
 
-	return "", fmt.Errorf("could not find project root (go.mod not found)")
+// stop reports the coin's loop stopped by a shutdown signal and returns its exit code
+func (l *coinLoop) stop(loc *time.Location) int {
+	fmt.Printf("%sLoop stopped by a shutdown signal at %s\n", l.prefix, time.Now().In(loc).Format("2006-01-02 15:04:05"))
+	return exitcode.Interrupted
 }
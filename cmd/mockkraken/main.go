@@ -0,0 +1,66 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/jkosik/crypto-trader/internal/krakenmock"
+)
+
+// Mock Kraken: serves the REST API from golden-file fixtures of the XBT/USD pair, so the trader
+// and the other tools can run deterministically without touching the exchange. Orders placed
+// against it stay open until canceled, or are filled at their limit price with -fill.
+//
+// Usage:
+//   go run cmd/mockkraken/main.go [-addr localhost:8080] [-fixtures dir] [-fill]
+//   KRAKEN_API_URL=http://localhost:8080 KRAKEN_API_KEY=mock KRAKEN_PRIVATE_KEY=<krakenmock.Secret> \
+//     go run cmd/trader/main.go -coin BTC -volume 0.001 -order
+//
+// Flags:
+//   -addr string      Address to listen on (default: localhost:8080)
+//   -fixtures dir     Directory whose <Endpoint>.json files replace the embedded fixtures
+//   -fill             Fill every order as soon as it's placed
+//   -verify           Check the signatures of private requests against krakenmock.Secret
+
+func main() {
+	addr := flag.String("addr", "localhost:8080", "Address to listen on")
+	dir := flag.String("fixtures", "", "Directory whose <Endpoint>.json files replace the embedded fixtures")
+	fill := flag.Bool("fill", false, "Fill every order as soon as it's placed")
+	verify := flag.Bool("verify", false, "Check the signatures of private requests against krakenmock.Secret")
+	flag.Parse()
+
+	secret := ""
+	if *verify {
+		secret = krakenmock.Secret
+	}
+	var server *krakenmock.Server
+	if *dir != "" {
+		server = krakenmock.NewFromDir(*dir, secret)
+	} else {
+		server = krakenmock.New(secret)
+	}
+	defer server.Close()
+
+	handler := http.Handler(server)
+	if *fill {
+		handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			server.ServeHTTP(w, r)
+			server.FillAll()
+		})
+	}
+	go func() {
+		fmt.Printf("Mock Kraken API listening on http://%s\n", *addr)
+		if err := http.ListenAndServe(*addr, handler); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+	}()
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+	<-stop
+}
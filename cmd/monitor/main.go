@@ -0,0 +1,328 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/jkosik/crypto-trader/internal/config"
+	"github.com/jkosik/crypto-trader/internal/events"
+	"github.com/jkosik/crypto-trader/internal/exitcode"
+	"github.com/jkosik/crypto-trader/internal/kraken"
+	"github.com/jkosik/crypto-trader/internal/logging"
+	"github.com/jkosik/crypto-trader/internal/money"
+	"github.com/jkosik/crypto-trader/internal/redact"
+	"github.com/jkosik/crypto-trader/internal/store"
+	"github.com/jkosik/crypto-trader/internal/trader"
+	"github.com/jkosik/crypto-trader/internal/tradestate"
+)
+
+// Monitor of spread orders placed elsewhere: `trader -detach` from cron, or orders placed by hand.
+// It attaches to the trade of a pair, given by its TXIDs or read from the trade state file the
+// detached trader left, and runs the trader's fill monitoring, repricing and Slack reporting
+// (internal/trader, in this process) until the trade finishes. With -follow it stays up as a
+// service and picks up every newly detached trade.
+//
+// Usage:
+//   go run cmd/monitor/main.go -coin BTC [-quote EUR] [-buy TXID -sell TXID] [-follow]
+//
+// Flags:
+//   -coin string      Base coin of the trade (e.g. BTC, SOL)
+//   -quote string     Quote currency of the traded pair, as given to the trader (default: USD)
+//   -buy string       TXID of the buy order to attach to (with -sell, default: the trade state file)
+//   -sell string      TXID of the sell order to attach to
+//   -follow           Keep running and monitor every trade detached for the pair
+//   -poll duration    Time between trade state checks with -follow (default: 1m)
+//   -config file      YAML config file with trading parameters
+//   -journal file     Trade journal (default: <state dir>/journal.db)
+//   -maxwait          Cancel both orders if neither has filled after this long
+//   -onsignal         cancel or leave the open orders on SIGINT/SIGTERM (default: cancel)
+//   -json             Emit the trade's JSON events on stdout, logs go to stderr
+//
+// Example:
+//   # Place from cron, monitor as a long-running service
+//   */30 * * * * trader -coin SUNDOG -volume 300 -order -detach
+//   go run cmd/monitor/main.go -coin SUNDOG -follow
+//
+//   # Attach to orders placed by hand
+//   go run cmd/monitor/main.go -coin SUNDOG -buy OABCDE-FGHIJ-KLMNOP -sell OQRSTU-VWXYZ-ABCDEF
+//
+// Without -follow the exit code is the trade's, like the trader's. Run one monitor per pair, two
+// would both act on the same orders.
+
+func main() {
+	// Panic values and traces may quote requests, scrub them like logs
+	defer redact.Panics()
+
+	baseCoin := flag.String("coin", "", "Base coin of the trade (e.g. BTC, SOL)")
+	quote := flag.String("quote", "USD", "Quote currency of the traded pair, as given to the trader")
+	buyTxId := flag.String("buy", "", "TXID of the buy order to attach to (with -sell, default: the trade state file)")
+	sellTxId := flag.String("sell", "", "TXID of the sell order to attach to")
+	follow := flag.Bool("follow", false, "Keep running and monitor every trade detached for the pair")
+	poll := flag.Duration("poll", time.Minute, "Time between trade state checks with -follow")
+	configPath := flag.String("config", "", "Path to a YAML config file with trading parameters")
+	journalPath := flag.String("journal", defaultStatePath("journal.db"), "SQLite trade journal (empty disables)")
+	maxWait := flag.Duration("maxwait", 0, "Cancel both orders if neither has filled after this long (0 waits forever)")
+	onSignal := flag.String("onsignal", "cancel", "What to do with the open orders on SIGINT/SIGTERM: cancel or leave")
+	jsonOutput := flag.Bool("json", false, "Emit the trade's JSON events on stdout, logs go to stderr")
+	flag.Parse()
+
+	if *baseCoin == "" || (*buyTxId == "") != (*sellTxId == "") || *poll <= 0 {
+		fmt.Println("Error: -coin is required, -buy and -sell go together and -poll must be positive")
+		flag.Usage()
+		os.Exit(exitcode.Config)
+	}
+	if *onSignal != "cancel" && *onSignal != "leave" {
+		fmt.Printf("Error: -onsignal must be cancel or leave, got %s\n", *onSignal)
+		os.Exit(exitcode.Config)
+	}
+	*baseCoin = strings.ToUpper(*baseCoin)
+	kraken.Quote = strings.ToUpper(*quote)
+	if kraken.Quote == "" || strings.ContainsAny(kraken.Quote, "/ ") {
+		fmt.Printf("Error: -quote must be a currency code like USD or EUR, got %q\n", *quote)
+		os.Exit(exitcode.Config)
+	}
+
+	// In JSON mode stdout is reserved for the trade's events
+	logOutput := os.Stdout
+	if *jsonOutput {
+		logOutput = os.Stderr
+	}
+	if err := logging.Setup(logOutput, "text", "info"); err != nil {
+		fmt.Fprintf(logOutput, "Error: %v\n", err)
+		os.Exit(exitcode.Config)
+	}
+	cfg, err := config.Load(*configPath)
+	if err != nil {
+		fmt.Fprintf(logOutput, "Error loading config: %v\n", err)
+		os.Exit(exitcode.Config)
+	}
+	cfg = cfg.ForCoin(*baseCoin)
+	if err := money.SetPolicy(cfg.Money); err != nil {
+		fmt.Fprintf(logOutput, "Error: invalid money policy: %v\n", err)
+		os.Exit(exitcode.Config)
+	}
+	if err := kraken.SetBaseURL(cfg.APIURL); err != nil {
+		fmt.Fprintf(logOutput, "Error: invalid api_url: %v\n", err)
+		os.Exit(exitcode.Config)
+	}
+	trader.Configure(cfg, false, false)
+
+	// The state file is where detached traders hand over their orders, the trader resumes from it
+	statePath := defaultStatePath(tradestate.FileName(*baseCoin, kraken.Quote))
+	if statePath == "" {
+		fmt.Println("Error: the state directory is unavailable, set CRYPTO_TRADER_STATE_DIR")
+		os.Exit(exitcode.Config)
+	}
+
+	if *buyTxId != "" {
+		if code := attach(*baseCoin, *buyTxId, *sellTxId, statePath, *journalPath); code != exitcode.OK {
+			os.Exit(code)
+		}
+	}
+
+	// The first signal stops the running trade, which cleans up its orders per -onsignal, or the
+	// wait for the next one
+	shutdown := make(chan struct{})
+	go func() {
+		signals := make(chan os.Signal, 1)
+		signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+		<-signals
+		close(shutdown)
+	}()
+
+	for {
+		trade, err := tradestate.Load(statePath)
+		if err != nil {
+			fmt.Fprintf(logOutput, "Error reading trade state: %v\n", err)
+			os.Exit(exitcode.TradeFailed)
+		}
+
+		if trade == nil && !*follow {
+			fmt.Fprintf(logOutput, "No active trade of %s/%s to monitor (%s not found)\n", *baseCoin, kraken.Quote, statePath)
+			os.Exit(exitcode.TradeFailed)
+		}
+
+		if trade != nil {
+			fmt.Fprintf(logOutput, "%s - Monitoring trade %s (buy %s, sell %s)\n", time.Now().Format("2006-01-02 15:04:05"), trade.TradeID, trade.BuyTxID, trade.SellTxID)
+
+			// The trade resumes from the state file, on the pair it was placed on. The orders are
+			// placed already, so the parameter diff guarding placement doesn't apply.
+			if trade.Quote != "" {
+				kraken.Quote = trade.Quote
+			}
+			opts := trader.DefaultOptions()
+			opts.Config = cfg
+			opts.Coin = *baseCoin
+			opts.Volume = trade.Volume
+			opts.TradeID = trade.TradeID
+			opts.Order = true
+			opts.ParamsPath = ""
+			opts.JournalPath = *journalPath
+			opts.OnSignal = *onSignal
+			opts.MaxWait = *maxWait
+			opts.Shutdown = shutdown
+			if *jsonOutput {
+				events.Enable(os.Stdout, trade.TradeID)
+			}
+			code := trader.Run(logging.WithTradeID(context.Background(), trade.TradeID), opts).Code
+			fmt.Fprintf(logOutput, "%s - Trade %s finished: %s (exit code %d)\n", time.Now().Format("2006-01-02 15:04:05"), trade.TradeID, exitcode.Describe(code), code)
+
+			if stopping(shutdown) {
+				os.Exit(exitcode.Interrupted)
+			}
+			if !*follow {
+				os.Exit(code)
+			}
+			// Bad keys or config fail every following trade the same way
+			if code == exitcode.Auth || code == exitcode.Config {
+				os.Exit(code)
+			}
+		}
+
+		// Wait for the next detached trade, or retry a trade whose monitoring failed
+		select {
+		case <-time.After(*poll):
+		case <-shutdown:
+			fmt.Fprintf(logOutput, "Monitor stopped by a shutdown signal at %s\n", time.Now().Format("2006-01-02 15:04:05"))
+			os.Exit(exitcode.Interrupted)
+		}
+	}
+}
+
+// stopping reports whether a shutdown signal was received
+func stopping(shutdown <-chan struct{}) bool {
+	select {
+	case <-shutdown:
+		return true
+	default:
+		return false
+	}
+}
+
+// attach hands orders placed outside a detached trader to the monitoring: both are checked to be
+// the two legs of one spread trade of the coin, then recorded in the trade state and the journal
+func attach(coin string, buyTxId string, sellTxId string, statePath string, journalPath string) int {
+	existing, err := tradestate.Load(statePath)
+	if err != nil {
+		fmt.Printf("Error reading trade state: %v\n", err)
+		return exitcode.TradeFailed
+	}
+	if existing != nil {
+		if existing.BuyTxID == buyTxId && existing.SellTxID == sellTxId {
+			return exitcode.OK
+		}
+		fmt.Printf("Error: trade %s of %s/%s is still active (buy %s, sell %s), finish it first\n", existing.TradeID, coin, kraken.Quote, existing.BuyTxID, existing.SellTxID)
+		return exitcode.TradeFailed
+	}
+
+	if os.Getenv("KRAKEN_API_KEY") == "" || os.Getenv("KRAKEN_PRIVATE_KEY") == "" {
+		fmt.Println("Error: KRAKEN_API_KEY and KRAKEN_PRIVATE_KEY environment variables must be set")
+		return exitcode.Auth
+	}
+
+	ctx := context.Background()
+	pair, err := kraken.GetAssetPair(ctx, coin, kraken.Quote)
+	if err != nil {
+		fmt.Printf("Error getting asset pair: %v\n", err)
+		return exitcode.TradeFailed
+	}
+	buy, err := kraken.CheckOrderStatus(ctx, buyTxId)
+	if err != nil {
+		fmt.Printf("Error checking buy order %s: %v\n", buyTxId, err)
+		return exitcode.TradeFailed
+	}
+	sell, err := kraken.CheckOrderStatus(ctx, sellTxId)
+	if err != nil {
+		fmt.Printf("Error checking sell order %s: %v\n", sellTxId, err)
+		return exitcode.TradeFailed
+	}
+	if buy.Descr.Type != "buy" || sell.Descr.Type != "sell" {
+		fmt.Printf("Error: -buy must be a buy order and -sell a sell order, got %s and %s\n", buy.Descr.Type, sell.Descr.Type)
+		return exitcode.Config
+	}
+	for _, order := range []*kraken.OrderStatus{buy, sell} {
+		if order.Descr.Pair != pair.Altname && order.Descr.Pair != pair.WSName {
+			fmt.Printf("Error: order %q is not on %s\n", order.Descr.Order, pair.WSName)
+			return exitcode.Config
+		}
+	}
+	volume := kraken.ParseFloat(buy.Vol)
+	if volume <= 0 || volume != kraken.ParseFloat(sell.Vol) {
+		fmt.Printf("Error: the orders must have the same volume, got %s and %s\n", buy.Vol, sell.Vol)
+		return exitcode.Config
+	}
+
+	// The estimate the trader reports against, net of the maker fee of both legs
+	var estimatedProfit, estimatedPercentGain float64
+	if tradeVolume, err := kraken.GetTradeVolume(ctx, pair); err != nil {
+		fmt.Printf("Warning: failed to get fee tier, no profit estimate: %v\n", err)
+	} else {
+		buyPrice, sellPrice := kraken.ParseFloat(buy.Descr.Price), kraken.ParseFloat(sell.Descr.Price)
+		_, _, estimatedProfit = kraken.SpreadNetProfit(buyPrice, sellPrice, volume, tradeVolume.MakerFee)
+		estimatedPercentGain = estimatedProfit / (buyPrice * volume) * 100
+	}
+
+	trade := tradestate.Trade{
+		TradeID:              logging.NewTradeID(),
+		Coin:                 coin,
+		Quote:                kraken.Quote,
+		BuyTxID:              buyTxId,
+		SellTxID:             sellTxId,
+		Volume:               volume,
+		EstimatedProfit:      estimatedProfit,
+		EstimatedPercentGain: estimatedPercentGain,
+		PlacedAt:             time.Now(),
+	}
+
+	// Record the trade unless its orders are journaled already, the trader only finishes it
+	if journalPath != "" {
+		journal, err := store.Open(journalPath)
+		if err != nil {
+			fmt.Printf("Error opening trade journal: %v\n", err)
+			return exitcode.TradeFailed
+		}
+		defer journal.Close()
+		tradeID, err := journal.TradeOfOrder(buyTxId)
+		if err != nil {
+			fmt.Printf("Error reading trade journal: %v\n", err)
+			return exitcode.TradeFailed
+		}
+		if tradeID != "" {
+			trade.TradeID = tradeID
+		} else {
+			if err := journal.StartTrade(store.Trade{ID: trade.TradeID, Pair: kraken.PairName(coin), Volume: volume, StartedAt: trade.PlacedAt}); err != nil {
+				fmt.Printf("Error recording trade in journal: %v\n", err)
+				return exitcode.TradeFailed
+			}
+			for side, txId := range map[string]string{"buy": buyTxId, "sell": sellTxId} {
+				if err := journal.RecordOrder(store.Order{TxID: txId, TradeID: trade.TradeID, Side: side, Volume: volume, PlacedAt: trade.PlacedAt}); err != nil {
+					fmt.Printf("Error recording order in journal: %v\n", err)
+					return exitcode.TradeFailed
+				}
+			}
+		}
+	}
+
+	if err := tradestate.Save(statePath, trade); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return exitcode.TradeFailed
+	}
+	fmt.Printf("Attached to %s orders: buy %s, sell %s, volume %s\n", pair.WSName, buyTxId, sellTxId, pair.FormatVolume(volume))
+	return exitcode.OK
+}
+
+// defaultStatePath returns the location of a file in the state directory, or "" if it's unavailable
+func defaultStatePath(name string) string {
+	dir, err := kraken.StateDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, name)
+}
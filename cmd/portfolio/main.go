@@ -0,0 +1,212 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/jkosik/crypto-trader/internal/config"
+	"github.com/jkosik/crypto-trader/internal/kraken"
+	"github.com/jkosik/crypto-trader/internal/money"
+	"github.com/jkosik/crypto-trader/internal/portfolio"
+	"github.com/jkosik/crypto-trader/internal/redact"
+)
+
+// Portfolio valuation: every asset of the account's BalanceEx valued in USD at the current bids,
+// with its allocation and the total.
+//
+// Usage:
+//   go run cmd/portfolio/main.go [-slack] [-min 1]
+//
+// Flags:
+//   -config file      YAML config file, its money section sets the rounding of the amounts
+//   -min float        Hide holdings worth less than this many USD from the table (default: 0)
+//   -slack            Post the valuation to Slack (SLACK_WEBHOOK), e.g. as a daily snapshot from cron
+//   -snapshot file    Last posted total, the Slack message reports the change since (default: <state dir>/portfolio.json, "" disables)
+//
+// Example:
+//   # Daily snapshot to Slack
+//   0 8 * * * portfolio -slack
+//
+// Staked and rewards balances (DOT.S, XBT.F) are valued like the asset itself. Assets without a
+// USD or XBT pair are listed without a value and left out of the total.
+
+// snapshot is the last total posted to Slack
+type snapshot struct {
+	Time     time.Time `json:"time"`
+	TotalUSD float64   `json:"total_usd"`
+}
+
+func main() {
+	// Panic values and traces may quote requests, scrub them like logs
+	defer redact.Panics()
+
+	configPath := flag.String("config", "", "Path to a YAML config file, its money section sets the rounding of the amounts")
+	minValue := flag.Float64("min", 0, "Hide holdings worth less than this many USD from the table")
+	slack := flag.Bool("slack", false, "Post the valuation to Slack (SLACK_WEBHOOK), e.g. as a daily snapshot from cron")
+	snapshotPath := flag.String("snapshot", defaultSnapshotPath(), "Last total posted to Slack, the next post reports the change since (empty disables)")
+	flag.Parse()
+
+	cfg, err := config.Load(*configPath)
+	if err != nil {
+		fmt.Printf("Error loading config: %v\n", err)
+		os.Exit(2)
+	}
+	if err := money.SetPolicy(cfg.Money); err != nil {
+		fmt.Printf("Error: invalid money policy: %v\n", err)
+		os.Exit(2)
+	}
+	if err := kraken.SetBaseURL(cfg.APIURL); err != nil {
+		fmt.Printf("Error: invalid api_url: %v\n", err)
+		os.Exit(2)
+	}
+	if os.Getenv("KRAKEN_API_KEY") == "" || os.Getenv("KRAKEN_PRIVATE_KEY") == "" {
+		fmt.Println("Error: KRAKEN_API_KEY and KRAKEN_PRIVATE_KEY environment variables must be set")
+		os.Exit(2)
+	}
+
+	ctx := context.Background()
+	balanceBody, err := kraken.GetAccountBalance(ctx)
+	if err != nil {
+		fmt.Printf("Error getting account balance: %v\n", err)
+		os.Exit(1)
+	}
+	balances, err := kraken.GetAllBalances(balanceBody)
+	if err != nil {
+		fmt.Printf("Error parsing account balance: %v\n", err)
+		os.Exit(1)
+	}
+	valuation, err := portfolio.Value(ctx, balances)
+	if err != nil {
+		fmt.Printf("Error valuing the portfolio: %v\n", err)
+		os.Exit(1)
+	}
+
+	printValuation(valuation, *minValue, cfg.Location())
+
+	if !*slack {
+		return
+	}
+	var previous *snapshot
+	if *snapshotPath != "" {
+		if previous, err = loadSnapshot(*snapshotPath); err != nil {
+			fmt.Printf("Warning: ignoring the last snapshot: %v\n", err)
+		}
+	}
+	if err := kraken.SendSlackMessage(ctx, slackMessage(valuation, previous, cfg.Location())); err != nil {
+		fmt.Printf("Error sending the valuation to Slack: %v\n", err)
+		os.Exit(1)
+	}
+	if *snapshotPath != "" {
+		if err := saveSnapshot(*snapshotPath, snapshot{Time: valuation.Time, TotalUSD: valuation.TotalUSD}); err != nil {
+			fmt.Printf("Warning: failed to save the snapshot: %v\n", err)
+		}
+	}
+}
+
+// printValuation prints the holdings worth at least minValue USD, the unpriced ones and the total
+func printValuation(v *portfolio.Valuation, minValue float64, loc *time.Location) {
+	fmt.Printf("Portfolio at %s\n\n", v.Time.In(loc).Format("2006-01-02 15:04:05"))
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintf(w, "ASSET\tAMOUNT\tPRICE USD\tVALUE USD\tALLOCATION\t\n")
+	hidden := 0
+	for _, h := range v.Holdings {
+		if !h.Priced {
+			fmt.Fprintf(w, "%s\t%s\t-\t-\t-\t\n", h.Asset, formatAmount(h.Amount))
+			continue
+		}
+		if h.ValueUSD < minValue {
+			hidden++
+			continue
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%.2f%%\t\n", h.Asset, formatAmount(h.Amount), strconv.FormatFloat(h.PriceUSD, 'g', 8, 64),
+			money.Format(h.ValueUSD, "USD"), h.Allocation)
+	}
+	fmt.Fprintf(w, "TOTAL\t\t\t%s\t100.00%%\t\n", money.Format(v.TotalUSD, "USD"))
+	w.Flush()
+
+	if hidden > 0 {
+		fmt.Printf("\n%d holdings worth less than %g USD hidden\n", hidden, minValue)
+	}
+	if unpriced := v.Unpriced(); len(unpriced) > 0 {
+		fmt.Printf("\n%d assets without a USD or XBT pair are left out of the total\n", len(unpriced))
+	}
+}
+
+// slackMessage summarizes the valuation, with the change since the previous snapshot if there is one
+func slackMessage(v *portfolio.Valuation, previous *snapshot, loc *time.Location) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "💼 Portfolio: %s USD", money.Format(v.TotalUSD, "USD"))
+	if previous != nil {
+		change := v.TotalUSD - previous.TotalUSD
+		fmt.Fprintf(&b, " (%s USD", money.FormatSigned(change, "USD"))
+		if previous.TotalUSD > 0 {
+			fmt.Fprintf(&b, ", %+.2f%%", change/previous.TotalUSD*100)
+		}
+		fmt.Fprintf(&b, " since %s)", previous.Time.In(loc).Format("2006-01-02 15:04"))
+	}
+	for _, h := range v.Holdings {
+		if !h.Priced {
+			continue
+		}
+		fmt.Fprintf(&b, "\n%s: %s USD (%.2f%%)", h.Asset, money.Format(h.ValueUSD, "USD"), h.Allocation)
+	}
+	if unpriced := v.Unpriced(); len(unpriced) > 0 {
+		names := make([]string, len(unpriced))
+		for i, h := range unpriced {
+			names[i] = h.Asset
+		}
+		fmt.Fprintf(&b, "\nNot valued: %s", strings.Join(names, ", "))
+	}
+	return b.String()
+}
+
+// loadSnapshot reads the last snapshot, nil if there is none yet
+func loadSnapshot(path string) (*snapshot, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var s snapshot
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, fmt.Errorf("error parsing %s: %v", path, err)
+	}
+	return &s, nil
+}
+
+// saveSnapshot replaces the last snapshot
+func saveSnapshot(path string, s snapshot) error {
+	data, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0600)
+}
+
+// defaultSnapshotPath returns the snapshot location in the state directory, or "" if it's unavailable
+func defaultSnapshotPath() string {
+	dir, err := kraken.StateDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "portfolio.json")
+}
+
+// formatAmount prints a balance without trailing zeros
+func formatAmount(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
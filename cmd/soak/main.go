@@ -0,0 +1,155 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"sort"
+	"syscall"
+	"time"
+
+	"github.com/jkosik/crypto-trader/internal/exitcode"
+	"github.com/jkosik/crypto-trader/internal/logging"
+	"github.com/jkosik/crypto-trader/internal/numparse"
+	"github.com/jkosik/crypto-trader/internal/redact"
+	"github.com/jkosik/crypto-trader/internal/soak"
+)
+
+// Soak test of the trading pipeline: spread trades are placed on the paper exchange against a
+// simulated market, monitored, repriced and canceled like the trader does, for hours on a clock
+// running faster than real time. Goroutines, the live heap and the JSON events are tracked, the
+// run fails if they grow past their limits or events get lost.
+//
+// Nothing leaves the process: the simulated market serves Kraken's public endpoints in place of
+// the exchange and refuses private ones, no API keys are needed and no real orders are placed.
+//
+// Usage:
+//   go run cmd/soak/main.go [-duration 4h] [-speed 60]
+//
+// Flags:
+//   -duration          How long to run, in real time (default: 1h)
+//   -speed float       How much faster the simulated market runs than real time (default: 60)
+//   -check duration    Real time between order status checks (default: 1s)
+//   -sample duration   Real time between resource samples (default: 1m)
+//   -volume float      Base volume per trade (default: 0.1)
+//   -spread float      Spread of the simulated market in percent (default: 1)
+//   -volatility float  Price volatility of the simulated market in percent per simulated minute (default: 0.2)
+//   -seed int          Seed of the simulated market (default: the current time)
+//   -maxgoroutines int Allowed goroutine growth over the baseline (default: 10)
+//   -maxheap float     Allowed live heap growth over the baseline in MB (default: 32)
+//   -dir dir           Directory for the paper account and journal (default: a temporary directory, kept if the run fails)
+//   -loglevel string   Log level of the pipeline (default: warn)
+//
+// The baseline is sampled after the first trade. The exit code is 0 if the run passed, 1 if a
+// limit was exceeded or events were lost and 2 for invalid flags.
+
+func main() {
+	// Panic values and traces may quote requests, scrub them like logs
+	defer redact.Panics()
+
+	duration := flag.Duration("duration", time.Hour, "How long to run, in real time")
+	speed := numparse.FloatFlag("speed", 60, "How much faster the simulated market runs than real time")
+	checkInterval := flag.Duration("check", time.Second, "Real time between order status checks")
+	sampleInterval := flag.Duration("sample", time.Minute, "Real time between resource samples")
+	volume := numparse.FloatFlag("volume", 0.1, "Base volume per trade")
+	spread := numparse.FloatFlag("spread", 1, "Spread of the simulated market in percent")
+	volatility := numparse.FloatFlag("volatility", 0.2, "Price volatility of the simulated market in percent per simulated minute")
+	seed := flag.Int64("seed", 0, "Seed of the simulated market (default: the current time)")
+	maxGoroutines := flag.Int("maxgoroutines", 10, "Allowed goroutine growth over the baseline")
+	maxHeap := numparse.FloatFlag("maxheap", 32, "Allowed live heap growth over the baseline in MB")
+	dir := flag.String("dir", "", "Directory for the paper account and journal (default: a temporary directory)")
+	logLevel := flag.String("loglevel", "warn", "Log level of the pipeline: debug, info, warn or error")
+	flag.Parse()
+
+	if *duration <= 0 || *speed <= 0 || *checkInterval <= 0 || *sampleInterval <= 0 || *volume <= 0 || *spread <= 0 || *volatility < 0 {
+		fmt.Println("Error: -duration, -speed, -check, -sample, -volume and -spread must be positive")
+		flag.Usage()
+		os.Exit(exitcode.Config)
+	}
+	if err := logging.Setup(os.Stderr, "text", *logLevel); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(exitcode.Config)
+	}
+	if *seed == 0 {
+		*seed = time.Now().UnixNano()
+	}
+
+	if *dir == "" {
+		tmp, err := os.MkdirTemp("", "crypto-trader-soak-")
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(exitcode.TradeFailed)
+		}
+		defer os.RemoveAll(tmp)
+		*dir = tmp
+	}
+
+	// Every request of the kraken package goes to the simulated market from here on
+	market := soak.NewMarket("SOAK", 100, *spread/100, *volatility/100, *speed, *seed)
+	http.DefaultTransport = market
+
+	// Ctrl-C ends the run early with a report
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// The trader's defaults, counted in checks like its timeouts
+	minute := int(time.Minute.Seconds() / (*speed * checkInterval.Seconds()))
+	if minute < 1 {
+		minute = 1
+	}
+	opts := soak.Options{
+		Coin:               "SOAK",
+		Volume:             *volume,
+		Duration:           *duration,
+		CheckInterval:      *checkInterval,
+		SampleInterval:     *sampleInterval,
+		NarrowFactor:       0.5,
+		MakerFeePercent:    0.25,
+		LegTimeout:         5 * minute,
+		MaxWait:            30 * minute,
+		MaxHold:            120 * minute,
+		RepriceStep:        0.25,
+		MaxLossPercent:     1,
+		MaxGoroutineGrowth: *maxGoroutines,
+		MaxHeapGrowthMB:    *maxHeap,
+		Dir:                *dir,
+		OnSample: func(s soak.Sample) {
+			fmt.Printf("%-10s simulated %-12s goroutines %-4d heap %7.2f MB  trades %-6d events %d\n",
+				s.Elapsed.Round(time.Second), s.Simulated.Round(time.Minute), s.Goroutines, s.HeapMB, s.Trades, s.Events)
+		},
+	}
+
+	fmt.Printf("Soak test for %s at %gx speed (seed %d, state in %s)\n", *duration, *speed, *seed, *dir)
+	report, err := soak.Run(ctx, market, opts)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(exitcode.TradeFailed)
+	}
+
+	fmt.Printf("\nTrades: %d (%d failed)\n", report.Trades, report.Errors)
+	results := make([]string, 0, len(report.Results))
+	for result := range report.Results {
+		results = append(results, result)
+	}
+	sort.Strings(results)
+	for _, result := range results {
+		fmt.Printf("  %-14s %d\n", result, report.Results[result])
+	}
+	fmt.Printf("Events: %d emitted, %d received\n", report.EventsEmitted, report.EventsReceived)
+	for _, loss := range report.EventLosses {
+		fmt.Printf("  %s\n", loss)
+	}
+	fmt.Printf("API requests: %d\n", report.Requests)
+
+	if !report.Passed() {
+		fmt.Println("\nFAILED")
+		for _, failure := range report.Failures {
+			fmt.Printf("  %s\n", failure)
+		}
+		os.Exit(exitcode.TradeFailed)
+	}
+	fmt.Println("\nPASSED")
+}
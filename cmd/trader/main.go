@@ -1,20 +1,41 @@
 package main
 
 import (
+	"bufio"
+	"context"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
+	"log/slog"
 	"os"
+	"os/signal"
+	"path/filepath"
 	"strconv"
+	"strings"
+	"syscall"
+	"text/tabwriter"
 	"time"
 
+	"github.com/jkosik/crypto-trader/internal/balancewatch"
+	"github.com/jkosik/crypto-trader/internal/config"
+	"github.com/jkosik/crypto-trader/internal/doctor"
+	"github.com/jkosik/crypto-trader/internal/events"
+	"github.com/jkosik/crypto-trader/internal/exitcode"
 	"github.com/jkosik/crypto-trader/internal/kraken"
-)
-
-const (
-	// Trading conditions
-	minSpreadPercent   = 0.5  // Minimum spread percentage required to place orders
-	minVolume24h       = 1000 // Minimum 24h volume in USD required to place orders
-	spreadNarrowFactor = 0.7  // How much to narrow the spread (0.0 to 1.0)
+	"github.com/jkosik/crypto-trader/internal/logging"
+	"github.com/jkosik/crypto-trader/internal/maker"
+	"github.com/jkosik/crypto-trader/internal/manual"
+	"github.com/jkosik/crypto-trader/internal/money"
+	"github.com/jkosik/crypto-trader/internal/numparse"
+	"github.com/jkosik/crypto-trader/internal/reconcile"
+	"github.com/jkosik/crypto-trader/internal/redact"
+	"github.com/jkosik/crypto-trader/internal/risk"
+	"github.com/jkosik/crypto-trader/internal/scanner"
+	"github.com/jkosik/crypto-trader/internal/selfupdate"
+	"github.com/jkosik/crypto-trader/internal/store"
+	"github.com/jkosik/crypto-trader/internal/strategy"
+	"github.com/jkosik/crypto-trader/internal/trader"
 )
 
 // Kraken crypto trading bot that executes spread trades on specified cryptocurrency pairs.
@@ -24,10 +45,44 @@ const (
 //   go run cmd/trader/main.go -coin BTC -volume 0.1 -order
 //
 // Flags:
+//   -autoselect       Trade the best USD pair of a volume/spread scan instead of -coin, needs -usd
+//   -bandpercentile   Clamp order prices inside recent percentile bands, e.g. 95 (default: 0, disabled)
+//   -bandwindow       Lookback window for the volatility bands (default: 1h)
 //   -coin string      Base coin to trade (e.g. BTC, SOL)
+//   -config file      YAML config file with trading parameters (see config.example.yaml)
+//   -journal file     SQLite trade journal of orders, fills, fees and P&L (default: <state dir>/journal.db, "" disables)
+//   -detach           Place the orders and exit, cmd/monitor monitors them (requires -order)
+//   -json             Emit machine-readable JSON events on stdout, logs go to stderr
+//   -logformat        Log output format: text or json (default: text)
+//   -loglevel         Minimum log level: debug, info, warn or error (default: info)
+//   -maxparticipation Max trade volume as % of the pair's 24h volume (default: 1.0, 0 disables)
+//   -marketcache dir  Market history cached per coin to warm the volatility bands (default: <state dir>/market, "" disables)
+//   -maxwait          Cancel both orders if neither has filled after this long (default: 0, wait forever)
+//   -ohlcpolicy       Handling of bad OHLC candles: interpolate or reject (default: interpolate)
+//   -onsignal         On SIGINT/SIGTERM with orders placed: cancel the open orders or leave them (default: cancel)
 //   -order            Place actual orders (default: false)
+//   -paper            Paper trade: simulate the orders and fills against a virtual balance
+//   -postonly         Place maker-only orders (oflags=post), never executing as taker
+//   -quote string     Quote currency of the traded pair, e.g. EUR, USDT, USDC or BTC for ETH/BTC (default: USD)
+//   -usdvalue         Also report the P&L in USD when the quote currency isn't USD
+//   -postonlyretries  Re-placements of a post-only leg canceled for crossing the book (default: 3)
+//   -paperaccount     Virtual account of paper trading (default: <state dir>/paper.json)
+//   -paperbase float  Base coin amount seeded into a new paper account (default: 0)
+//   -paperfee float   Maker fee percentage charged on paper fills (default: 0.25)
+//   -paperusd float   USD seeded into a new paper account (default: 10000)
+//   -params file      Effective parameters of the last run per coin, diffed on start (default: <state dir>/last-run.json, "" disables)
+//   -record file      Record the session (inputs, API responses, decisions) for regression testing
+//   -replay file      Replay a recorded session offline and verify the decisions are unchanged
+//   -spreadnarrow     Spread narrowing factor from 0 to 1, overriding spread_narrow_factor of the config
+//   -retries int      Max attempts for API calls failing with transient errors (default: 4)
+//   -retrybackoff     Initial backoff between retries (default: 500ms)
+//   -tier string      Kraken verification tier for client-side rate limiting (default: starter)
+//   -rateshare float  Share of the account's API rate limits for this trader, for traders running side by side (default: 1)
 //   -untradeable      Place orders at untradeable prices (orders won't be executed)
+//   -validate         Run the whole trade flow but only validate the orders on the exchange, nothing is placed
+//   -usd float        USD amount to trade, converted to volume at the current bid (instead of -volume)
 //   -volume float     Base coin volume to trade
+//   -yes              Place orders even if risk-relevant parameters increased since the last run, without asking
 //
 // Example:
 //   # Place a real trade
@@ -36,251 +91,1557 @@ const (
 //   # Simulate a trade without actually placing orders
 //   go run cmd/trader/main.go -coin SUNDOG -volume 300
 //
+//   # Trade 50 USD worth of the coin, whatever its price
+//   go run cmd/trader/main.go -coin SUNDOG -usd 50 -order
+//
+//   # Trade 50 USD of the best scoring pair above min_volume_24h and min_spread_percent
+//   go run cmd/trader/main.go -autoselect -usd 50 -order
+//
+//   # Paper trade: simulated orders filled by live trades, P&L booked to a virtual balance
+//   go run cmd/trader/main.go -coin SUNDOG -volume 300 -paper -paperbase 1000
+//
 //   # Place untradeable orders in extreme prices (for testing)
 //   go run cmd/trader/main.go -coin SUNDOG -volume 300 -order -untradeable
+//
+//   # Preflight a trade: real balances and quotes, orders validated by the exchange but not placed
+//   go run cmd/trader/main.go -coin SUNDOG -volume 300 -validate
+//
+//   # Place the orders from cron and leave the monitoring to a long-running cmd/monitor
+//   go run cmd/trader/main.go -coin SUNDOG -volume 300 -order -detach
+//
+//   # Run the preflight checks (keys, connectivity, clock skew, balances, open orders, exposure, fees)
+//   go run cmd/trader/main.go doctor
+//
+//   # Watch the balances and alert on activity the bot didn't initiate (deposits, withdrawals, external trades)
+//   go run cmd/trader/main.go watch [-interval 1m] [-minchange 1.0]
+//
+//   # Compare yesterday's closed orders on the exchange with the journal, e.g. daily from cron
+//   go run cmd/trader/main.go reconcile [-date 2026-01-31] [-slack]
+//
+//   # Place, edit and cancel single limit orders by hand, with live bid/ask, bot-side checks and journaling
+//   go run cmd/trader/main.go manual -coin SUNDOG [-maxdeviation 5] [-taker]
+//
+//   # Keep a buy and a sell quote live, re-quoting each side as soon as it fills, until interrupted
+//   go run cmd/trader/main.go maker -coin SUNDOG -volume 300 [-roundtrips 10] [-paper]
+//
+//   # Run a registered strategy (see internal/strategy) until it's done or interrupted
+//   go run cmd/trader/main.go strategy -name spread -coin SUNDOG -volume 300 [-paper]
+//
+//   # Same with the trader's flags, -strategy (or strategy of the config) other than spread
+//   go run cmd/trader/main.go -coin SUNDOG -volume 300 -strategy <NAME> -order
+//
+//   # Replace a release binary with the latest signed release
+//   trader self-update [-check] [-force]
+
+// version is the release tag, set by scripts/release.sh with -ldflags "-X main.version=..."
+var version = "dev"
 
 func main() {
-	// Define command line flags
+	// Panic values and traces may quote requests, scrub them like logs
+	defer redact.Panics()
+
+	if len(os.Args) > 1 && os.Args[1] == "doctor" {
+		os.Exit(runDoctor(os.Args[2:]))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "watch" {
+		os.Exit(runWatch(os.Args[2:]))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "reconcile" {
+		os.Exit(runReconcile(os.Args[2:]))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "positions" {
+		os.Exit(runPositions(os.Args[2:]))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "manual" {
+		os.Exit(runManual(os.Args[2:]))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "maker" {
+		os.Exit(runMaker(os.Args[2:]))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "strategy" {
+		os.Exit(runStrategy(os.Args[2:]))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "self-update" {
+		os.Exit(runSelfUpdate(os.Args[2:]))
+	}
+
+	// Define command line flags, the trade's defaults are the trader package's
+	defaults := trader.DefaultOptions()
 	baseCoin := flag.String("coin", "", "Base coin to trade (e.g. BTC, SOL)")
+	quote := flag.String("quote", "USD", "Quote currency of the traded pair, e.g. USD, EUR, USDT, USDC or BTC for ETH/BTC")
+	usdValue := flag.Bool("usdvalue", false, "Also report the P&L in USD, converted at the bid of the quote currency's USD pair, when the quote currency isn't USD")
+	autoselect := flag.Bool("autoselect", false, "Scan the USD pairs and trade the best scoring one above min_volume_24h and min_spread_percent instead of -coin, needs -usd")
 	orderFlag := flag.Bool("order", false, "Place actual orders (default: false)")
+	validate := flag.Bool("validate", false, "Run the whole trade flow but only validate the orders on the exchange (validate=true), nothing is placed")
 	untradeable := flag.Bool("untradeable", false, "Place orders at untradeable prices (orders won't be executed - close them manually)")
-	volume := flag.Float64("volume", 0.0, "Base coin volume to trade")
+	volume := numparse.FloatFlag("volume", 0.0, "Base coin volume to trade")
+	usd := numparse.FloatFlag("usd", 0.0, "USD amount to trade, converted to volume at the current bid (instead of -volume)")
+	configPath := flag.String("config", "", "Path to a YAML config file with trading parameters")
+	spreadNarrow := numparse.FloatFlag("spreadnarrow", config.Default().SpreadNarrowFactor, "Spread narrowing factor from 0 (full spread) to 1 (center price), overriding spread_narrow_factor of the config")
+	maxParticipation := numparse.FloatFlag("maxparticipation", defaults.MaxParticipation, "Max trade volume as percentage of the pair's trailing 24h volume (0 disables)")
+	retries := flag.Int("retries", kraken.DefaultRetryPolicy.MaxAttempts, "Max attempts for API calls failing with transient errors")
+	retryBackoff := flag.Duration("retrybackoff", kraken.DefaultRetryPolicy.BaseDelay, "Initial backoff between retries (doubles with each attempt)")
+	bandPercentile := numparse.FloatFlag("bandpercentile", 0, "Clamp order prices inside this percentile of recent 1m highs/lows, e.g. 95 (0 disables)")
+	bandWindow := flag.Duration("bandwindow", defaults.BandWindow, "Lookback window for the volatility bands")
+	maxWait := flag.Duration("maxwait", 0, "Cancel both orders if neither has filled after this long (0 waits forever)")
+	ohlcPolicy := flag.String("ohlcpolicy", "interpolate", "How to handle bad OHLC candles (gaps, absurd wicks): interpolate or reject")
+	tier := flag.String("tier", "starter", "Kraken verification tier used for client-side rate limiting (starter, intermediate, pro)")
+	rateShare := numparse.FloatFlag("rateshare", 1.0, "Share (0 to 1] of the account's private API counter and public rate limit for this trader, when several trade side by side")
+	recordPath := flag.String("record", "", "Record the session (inputs, API responses, decisions) to a file for regression testing")
+	replayPath := flag.String("replay", "", "Replay a recorded session offline and verify the decisions match the recording")
+	logFormat := flag.String("logformat", "text", "Log output format: text or json")
+	logLevel := flag.String("loglevel", "info", "Minimum log level: debug, info, warn or error")
+	journalPath := flag.String("journal", defaults.JournalPath, "SQLite trade journal recording orders, fills, fees and P&L (empty disables)")
+	jsonOutput := flag.Bool("json", false, "Emit machine-readable JSON events (ticker, orders, fills, P&L) on stdout, logs go to stderr")
+	otp := flag.String("otp", "", "Password or code of an API key with two-factor authentication, sent as otp with private requests (default: KRAKEN_API_OTP)")
+	apiURL := flag.String("api-url", "", "Kraken REST API host, e.g. a mock server (default: api_url of the config, KRAKEN_API_URL or https://api.kraken.com)")
+	paper := flag.Bool("paper", false, "Paper trade: simulate the orders and their fills by live trades against a virtual balance")
+	paperAccount := flag.String("paperaccount", defaults.PaperAccount, "Virtual account of paper trading")
+	paperUSD := numparse.FloatFlag("paperusd", defaults.PaperUSD, "USD seeded into a new paper account")
+	paperBase := numparse.FloatFlag("paperbase", defaults.PaperBase, "Base coin amount seeded into a new paper account")
+	paperFee := numparse.FloatFlag("paperfee", defaults.PaperFee, "Maker fee percentage charged on paper fills")
+	paramsPath := flag.String("params", defaults.ParamsPath, "Effective parameters of the last run per coin, diffed against this run (empty disables)")
+	onSignal := flag.String("onsignal", defaults.OnSignal, "What to do with placed orders on SIGINT/SIGTERM: cancel the open ones or leave them on the exchange")
+	yes := flag.Bool("yes", false, "Place orders even if risk-relevant parameters increased since the last run, without asking")
+	postOnly := flag.Bool("postonly", false, "Place maker-only orders (oflags=post), the exchange cancels orders that would cross the book")
+	postOnlyRetries := flag.Int("postonlyretries", defaults.PostOnlyRetries, "How often a post-only leg canceled for crossing the book is placed again at a fresh price")
+	marketCache := flag.String("marketcache", defaults.MarketCache, "Directory caching candles and bid/ask history per coin for lookback indicators (empty disables)")
+	detach := flag.Bool("detach", false, "Place the orders and exit without monitoring them, cmd/monitor takes over (requires -order)")
+	strategyName := flag.String("strategy", "", "Strategy to trade: spread is this one-shot spread trade, other registered strategies run on the strategy runner like `trader strategy` (default: strategy of the config)")
 
 	// Parse command line flags
 	flag.Parse()
 
+	// In JSON mode stdout is reserved for events
+	logOutput := os.Stdout
+	if *jsonOutput {
+		logOutput = os.Stderr
+	}
+	if err := logging.Setup(logOutput, *logFormat, *logLevel); err != nil {
+		fmt.Fprintf(logOutput, "Error: %v\n", err)
+		os.Exit(exitcode.Config)
+	}
+
+	if *onSignal != "cancel" && *onSignal != "leave" {
+		fmt.Fprintf(logOutput, "Error: -onsignal must be cancel or leave, got %s\n", *onSignal)
+		os.Exit(exitcode.Config)
+	}
+	// Paper orders live in this process and replays place nothing, neither can be monitored elsewhere
+	if *detach && (!*orderFlag || *paper || *replayPath != "") {
+		fmt.Fprintln(logOutput, "Error: -detach needs -order and can't be combined with -paper or -replay")
+		os.Exit(exitcode.Config)
+	}
+	// Validation replaces placement, there are no orders to monitor
+	if *validate && (*orderFlag || *paper || *detach) {
+		fmt.Fprintln(logOutput, "Error: -validate can't be combined with -order, -paper or -detach")
+		os.Exit(exitcode.Config)
+	}
+	// Ctrl-C or a pod termination ends the current wait, the trader then stops at the next
+	// check. API calls in flight finish, cleanup needs them.
+	go func() {
+		signals := make(chan os.Signal, 1)
+		signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+		<-signals
+		close(shutdown)
+	}()
+
+	// Root context for all API calls. Requests without an explicit deadline
+	// get kraken.RequestTimeout applied. Every log record and event of this run carries the trade ID.
+	tradeID := logging.NewTradeID()
+	ctx := logging.WithTradeID(context.Background(), tradeID)
+	if *jsonOutput {
+		events.Enable(os.Stdout, tradeID)
+	}
+	log := logging.FromContext(ctx)
+
+	// Replays take all trading flags from the recording, recordings store them for later replays
+	if *replayPath != "" {
+		if err := kraken.StartReplay(*replayPath); err != nil {
+			log.Error("Failed to start replay", "error", err)
+			os.Exit(exitcode.Config)
+		}
+		var recordedFlags map[string]string
+		if _, err := kraken.ReplayInput("flags", &recordedFlags); err != nil {
+			log.Error("Failed to read recorded flags", "error", err)
+			os.Exit(exitcode.Config)
+		}
+		for name, value := range recordedFlags {
+			if err := flag.Set(name, value); err != nil {
+				log.Error("Failed to apply recorded flag", "flag", name, "error", err)
+				os.Exit(exitcode.Config)
+			}
+		}
+		log.Info("Replaying session", "path", *replayPath)
+	} else if *recordPath != "" {
+		if err := kraken.StartRecording(*recordPath); err != nil {
+			log.Error("Failed to start recording", "error", err)
+			os.Exit(exitcode.Config)
+		}
+		// Output flags don't affect decisions, replays keep their own
+		recordedFlags := map[string]string{}
+		flag.Visit(func(f *flag.Flag) {
+			switch f.Name {
+			case "record", "replay", "logformat", "loglevel", "json", "journal":
+			default:
+				recordedFlags[f.Name] = f.Value.String()
+			}
+		})
+		kraken.RecordInput("flags", recordedFlags)
+		log.Info("Recording session", "path", *recordPath)
+	}
+
+	if *volume != 0 && *usd != 0 {
+		fmt.Fprintln(logOutput, "Error: -volume and -usd are mutually exclusive")
+		exit(exitcode.Config)
+	}
+	if *usd < 0 {
+		fmt.Fprintln(logOutput, "Error: -usd must be positive")
+		exit(exitcode.Config)
+	}
+
+	if *autoselect && *baseCoin != "" {
+		fmt.Fprintln(logOutput, "Error: -coin and -autoselect are mutually exclusive")
+		exit(exitcode.Config)
+	}
+	// A base coin volume means nothing before the coin is known
+	if *autoselect && *usd == 0 {
+		fmt.Fprintln(logOutput, "Error: -autoselect needs -usd")
+		exit(exitcode.Config)
+	}
+
 	// Check if required flags are set
-	if *baseCoin == "" || *volume == 0.0 {
-		fmt.Println("Error: -coin flag is required")
-		fmt.Println("Usage: go run cmd/trader/main.go -coin <COIN> -volume <AMOUNT> [-order] [-untradeable]")
-		fmt.Println("\nFlags:")
-		fmt.Println("  -coin <COIN>    Base coin to trade (e.g. BTC, SOL)")
-		fmt.Println("  -order         Place actual orders (default: false)")
-		fmt.Println("  -untradeable   Place orders at untradeable prices (orders won't be executed - close them manually)")
-		os.Exit(1)
-	}
-
-	fmt.Printf("\nTrading %s/USD\n", *baseCoin)
-	fmt.Println("Traded volume:", *volume)
-	if *untradeable {
-		fmt.Println("Running in untradeable mode (orders will be placed at extreme prices)")
-	}
-
-	// Grab env variables
-	apiKey := os.Getenv("KRAKEN_API_KEY")
-	apiSecret := os.Getenv("KRAKEN_PRIVATE_KEY")
-	// Nonce is used for signature process
-	nonce := time.Now().UnixNano() / int64(time.Millisecond)
-	urlBase := "https://api.kraken.com"
-
-	if apiKey == "" || apiSecret == "" {
-		fmt.Println("Error: KRAKEN_API_KEY and KRAKEN_PRIVATE_KEY environment variables must be set")
-		os.Exit(1)
+	if (*baseCoin == "" && !*autoselect) || (*volume == 0.0 && *usd == 0.0) {
+		// Usage goes to stderr in JSON mode
+		fmt.Fprintln(logOutput, "Error: -coin flag is required")
+		fmt.Fprintln(logOutput, "Usage: go run cmd/trader/main.go -coin <COIN> -volume <AMOUNT> [-order] [-untradeable]")
+		fmt.Fprintln(logOutput, "\nFlags:")
+		fmt.Fprintln(logOutput, "  -coin <COIN>    Base coin to trade (e.g. BTC, SOL)")
+		fmt.Fprintln(logOutput, "  -autoselect    Trade the best pair of a volume/spread scan instead of -coin (needs -usd)")
+		fmt.Fprintln(logOutput, "  -volume <AMOUNT> Base coin volume to trade")
+		fmt.Fprintln(logOutput, "  -usd <AMOUNT>   USD amount to trade instead of -volume")
+		fmt.Fprintln(logOutput, "  -order         Place actual orders (default: false)")
+		fmt.Fprintln(logOutput, "  -untradeable   Place orders at untradeable prices (orders won't be executed - close them manually)")
+		exit(exitcode.Config)
 	}
 
-	// Get account balance
-	urlPath := "/0/private/BalanceEx"
-	payload := fmt.Sprintf(`{
-		"nonce": "%d"
-	}`, nonce)
+	// Every pair of the run is quoted in this currency: tickers, volumes, orders and the open order filter
+	kraken.Quote = strings.ToUpper(*quote)
+	if kraken.Quote == "" || strings.ContainsAny(kraken.Quote, "/ ") {
+		fmt.Fprintf(logOutput, "Error: invalid -quote %q\n", *quote)
+		exit(exitcode.Config)
+	}
 
-	signature, err := kraken.GetKrakenSignature(urlPath, payload, apiSecret)
+	// Trading parameters come from defaults, config file and env, explicit flags take precedence
+	cfg, err := config.Load(*configPath)
 	if err != nil {
-		fmt.Println("Error generating signature:", err)
-		os.Exit(1)
+		log.Error("Failed to load config", "error", err)
+		exit(exitcode.Config)
+	}
+	if flagSet("api-url") {
+		cfg.APIURL = *apiURL
+	}
+	if err := kraken.SetBaseURL(cfg.APIURL); err != nil {
+		log.Error("Invalid API URL", "error", err)
+		exit(exitcode.Config)
+	}
+	kraken.SetOTP(*otp)
+	if flagSet("strategy") {
+		cfg.Strategy = *strategyName
+	}
+	// Other strategies than the spread trade run on the strategy runner, which trades -volume of
+	// a USD pair and has none of the spread trade's dry runs, detaching or session recording
+	runner := cfg.Strategy != "spread"
+	if runner && (*usd != 0 || *autoselect || kraken.Quote != "USD" || *validate || *detach || *untradeable || *replayPath != "" || *recordPath != "") {
+		log.Error("Only the spread strategy supports -usd, -autoselect, -quote, -validate, -detach, -untradeable, -record and -replay", "strategy", cfg.Strategy)
+		exit(exitcode.Config)
+	}
+	if runner && !*orderFlag && !*paper {
+		log.Error("The strategy places orders right away, needs -order or -paper", "strategy", cfg.Strategy)
+		exit(exitcode.Config)
+	}
+	if *autoselect {
+		coin, err := autoselectCoin(ctx, cfg)
+		if errors.Is(err, scanner.ErrNoPair) {
+			log.Warn("No pair to trade", "error", err)
+			exit(exitcode.SpreadTimeout)
+		}
+		if err != nil {
+			log.Error("Failed to autoselect a pair", "error", err)
+			exit(trader.FailureCode(err))
+		}
+		*baseCoin = coin
+	}
+	cfg = cfg.ForCoin(*baseCoin)
+	if flagSet("spreadnarrow") {
+		if *spreadNarrow < 0 || *spreadNarrow > 1 {
+			log.Error("Invalid spread narrowing factor, must be between 0 and 1", "spreadnarrow", *spreadNarrow)
+			exit(exitcode.Config)
+		}
+		cfg.SpreadNarrowFactor = *spreadNarrow
+	}
+	if err := money.SetPolicy(cfg.Money); err != nil {
+		log.Error("Invalid money policy", "error", err)
+		exit(exitcode.Config)
 	}
+	if !flagSet("maxparticipation") {
+		*maxParticipation = cfg.MaxParticipationPercent
+	}
+	trader.Configure(cfg, *postOnly, *validate)
 
-	balanceBody, err := kraken.MakePrivateRequest(urlBase+urlPath, "POST", payload, apiKey, signature)
+	if err := kraken.SetTier(*tier); err != nil {
+		log.Error("Invalid tier", "error", err)
+		exit(exitcode.Config)
+	}
+	if err := kraken.SetRateShare(*rateShare); err != nil {
+		log.Error("Invalid rate share", "error", err)
+		exit(exitcode.Config)
+	}
+	policy, err := kraken.ParseOHLCQualityPolicy(*ohlcPolicy)
 	if err != nil {
-		fmt.Println("Error making request:", err)
-		os.Exit(1)
+		log.Error("Invalid OHLC policy", "error", err)
+		exit(exitcode.Config)
+	}
+	kraken.DefaultOHLCQualityPolicy = policy
+	kraken.DefaultRetryPolicy.MaxAttempts = *retries
+	kraken.DefaultRetryPolicy.BaseDelay = *retryBackoff
+
+	if runner {
+		exit(tradeStrategy(strategyOptions{
+			cfg:          cfg,
+			coin:         *baseCoin,
+			volume:       *volume,
+			tradeID:      tradeID,
+			journalPath:  *journalPath,
+			paper:        *paper,
+			paperAccount: *paperAccount,
+			paperUSD:     *paperUSD,
+			paperBase:    *paperBase,
+			paperFee:     *paperFee,
+		}))
+	}
+
+	opts := trader.DefaultOptions()
+	opts.Config = cfg
+	opts.Coin = *baseCoin
+	opts.Volume, opts.USD = *volume, *usd
+	opts.TradeID = tradeID
+	opts.Order, opts.Paper, opts.Validate = *orderFlag, *paper, *validate
+	opts.Untradeable, opts.Detach = *untradeable, *detach
+	opts.PostOnly, opts.PostOnlyRetries = *postOnly, *postOnlyRetries
+	opts.MaxParticipation = *maxParticipation
+	opts.BandPercentile, opts.BandWindow = *bandPercentile, *bandWindow
+	opts.MaxWait, opts.OnSignal, opts.Yes, opts.USDValue = *maxWait, *onSignal, *yes, *usdValue
+	opts.JournalPath, opts.ParamsPath, opts.MarketCache = *journalPath, *paramsPath, *marketCache
+	opts.PaperAccount, opts.PaperUSD, opts.PaperBase, opts.PaperFee = *paperAccount, *paperUSD, *paperBase, *paperFee
+	opts.Confirm = func(question string) bool { return confirm(logOutput, question) }
+	opts.Shutdown = shutdown
+	exit(trader.Run(ctx, opts).Code)
+}
+
+// runDoctor runs the preflight checks and prints a green/yellow/red report.
+// It exits non-zero if any check is red.
+func runDoctor(args []string) int {
+	fs := flag.NewFlagSet("doctor", flag.ExitOnError)
+	coin := fs.String("coin", doctor.DefaultOptions.Coin, "Coin whose USD pair is used for the fee tier check")
+	maxSkew := fs.Duration("maxskew", doctor.DefaultOptions.MaxClockSkew, "Max clock skew against the exchange before the check turns red")
+	maxExposure := fs.Float64("maxexposure", doctor.DefaultOptions.MaxExposurePct, "Max USD in open buy orders as percentage of the USD balance before the check turns red")
+	tier := fs.String("tier", "starter", "Kraken verification tier used for client-side rate limiting (starter, intermediate, pro)")
+	fs.Parse(args)
+
+	if err := kraken.SetTier(*tier); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return 1
+	}
+
+	// Report failures as they are instead of hiding them behind retries
+	kraken.DefaultRetryPolicy.MaxAttempts = 1
+
+	checks := doctor.Run(context.Background(), doctor.Options{
+		Coin:           *coin,
+		MaxClockSkew:   *maxSkew,
+		MaxExposurePct: *maxExposure,
+	})
+	doctor.Print(os.Stdout, checks)
+	if doctor.Worst(checks) == doctor.Red {
+		return 1
+	}
+	return 0
+}
+
+// runWatch polls the balances until interrupted, logging every significant change and alerting
+// on Slack about changes not explained by trades of orders in the journal
+func runWatch(args []string) int {
+	fs := flag.NewFlagSet("watch", flag.ExitOnError)
+	interval := fs.Duration("interval", balancewatch.DefaultOptions.Interval, "Time between balance polls")
+	minChange := balancewatch.DefaultOptions.MinChangePercent
+	fs.Var((*numparse.Float)(&minChange), "minchange", "Min balance change in percent of the previous balance to report")
+	journalPath := fs.String("journal", defaultJournalPath(), "Trade journal used to recognize the bot's own orders (empty treats all trades as external)")
+	tier := fs.String("tier", "starter", "Kraken verification tier used for client-side rate limiting (starter, intermediate, pro)")
+	logFormat := fs.String("logformat", "text", "Log output format: text or json")
+	logLevel := fs.String("loglevel", "info", "Minimum log level: debug, info, warn or error")
+	jsonOutput := fs.Bool("json", false, "Emit balance change events as JSON on stdout, logs go to stderr")
+	fs.Parse(args)
+
+	logOutput := os.Stdout
+	if *jsonOutput {
+		logOutput = os.Stderr
+	}
+	if err := logging.Setup(logOutput, *logFormat, *logLevel); err != nil {
+		fmt.Fprintf(logOutput, "Error: %v\n", err)
+		return exitcode.Config
+	}
+	if *jsonOutput {
+		events.Enable(os.Stdout, "")
+	}
+	if err := kraken.SetTier(*tier); err != nil {
+		slog.Error("Invalid tier", "error", err)
+		return exitcode.Config
+	}
+	if *interval <= 0 {
+		slog.Error("Invalid interval", "interval", *interval)
+		return exitcode.Config
 	}
+	if os.Getenv("KRAKEN_API_KEY") == "" || os.Getenv("KRAKEN_PRIVATE_KEY") == "" {
+		slog.Error("KRAKEN_API_KEY and KRAKEN_PRIVATE_KEY environment variables must be set")
+		return exitcode.Auth
+	}
+
+	opts := balancewatch.Options{Interval: *interval, MinChangePercent: minChange}
+	if *journalPath != "" {
+		journal, err := store.Open(*journalPath)
+		if err != nil {
+			slog.Error("Failed to open trade journal", "error", err)
+			return exitcode.Config
+		}
+		defer journal.Close()
+		opts.OwnOrder = func(txid string) bool {
+			own, err := journal.HasOrder(txid)
+			if err != nil {
+				slog.Warn("Failed to look up order in journal", "txid", txid, "error", err)
+			}
+			return own
+		}
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	slog.Info("Watching balances", "interval", *interval, "min_change_percent", minChange)
+	balancewatch.New(opts).Run(ctx, func(change balancewatch.Change) {
+		log := slog.With("asset", change.Asset, "previous", change.Previous, "current", change.Current,
+			"delta", change.Delta, "sources", change.Sources, "external", change.External)
+		events.Emit(events.Balance, map[string]interface{}{
+			"asset":    change.Asset,
+			"previous": change.Previous,
+			"current":  change.Current,
+			"delta":    change.Delta,
+			"sources":  change.Sources,
+			"external": change.External,
+		})
+		if !change.External {
+			log.Info("Balance changed by the bot's trades")
+			return
+		}
 
-	fmt.Println("Account balance:")
-	fmt.Println(string(balanceBody))
+		log.Warn("Balance changed by activity the bot didn't initiate")
+		sources := "unknown"
+		if len(change.Sources) > 0 {
+			sources = strings.Join(change.Sources, ", ")
+		}
+		slackErr := kraken.SendSlackMessage(ctx, fmt.Sprintf(
+			"⚠️ %s balance changed outside the bot\n"+
+				"Change: %s\n"+
+				"Balance: %s -> %s\n"+
+				"Source: %s",
+			change.Asset,
+			money.FormatSigned(change.Delta, change.Asset),
+			money.Format(change.Previous, change.Asset),
+			money.Format(change.Current, change.Asset),
+			sources,
+		))
+		if slackErr != nil {
+			log.Warn("Failed to send Slack message", "error", slackErr)
+		}
+	})
+	slog.Info("Stopped watching balances")
+	return exitcode.OK
+}
+
+// runReconcile compares the orders the exchange closed on a day with the journal and reports the
+// ones the bot doesn't know about or whose final state it missed. It exits non-zero if any is found.
+func runReconcile(args []string) int {
+	fs := flag.NewFlagSet("reconcile", flag.ExitOnError)
+	date := fs.String("date", "", "Day to reconcile, YYYY-MM-DD in the config's timezone (default: yesterday)")
+	configPath := fs.String("config", "", "Path to a YAML config file, its timezone sets the day")
+	journalPath := fs.String("journal", defaultJournalPath(), "Trade journal the closed orders are compared with")
+	slack := fs.Bool("slack", false, "Post discrepancies to Slack (SLACK_WEBHOOK)")
+	tier := fs.String("tier", "starter", "Kraken verification tier used for client-side rate limiting (starter, intermediate, pro)")
+	logFormat := fs.String("logformat", "text", "Log output format: text or json")
+	logLevel := fs.String("loglevel", "info", "Minimum log level: debug, info, warn or error")
+	fs.Parse(args)
+
+	if err := logging.Setup(os.Stdout, *logFormat, *logLevel); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return exitcode.Config
+	}
+	cfg, err := config.Load(*configPath)
+	if err != nil {
+		slog.Error("Failed to load config", "error", err)
+		return exitcode.Config
+	}
+	if err := kraken.SetBaseURL(cfg.APIURL); err != nil {
+		slog.Error("Invalid api_url", "error", err)
+		return exitcode.Config
+	}
+	if err := kraken.SetTier(*tier); err != nil {
+		slog.Error("Invalid tier", "error", err)
+		return exitcode.Config
+	}
+	loc := cfg.Location()
+	now := time.Now().In(loc)
+	start := time.Date(now.Year(), now.Month(), now.Day()-1, 0, 0, 0, 0, loc)
+	if *date != "" {
+		if start, err = time.ParseInLocation("2006-01-02", *date, loc); err != nil {
+			slog.Error("Invalid date", "date", *date, "error", err)
+			return exitcode.Config
+		}
+	}
+	end := start.AddDate(0, 0, 1)
+	if *journalPath == "" {
+		slog.Error("No journal to reconcile with, set -journal")
+		return exitcode.Config
+	}
+	if os.Getenv("KRAKEN_API_KEY") == "" || os.Getenv("KRAKEN_PRIVATE_KEY") == "" {
+		slog.Error("KRAKEN_API_KEY and KRAKEN_PRIVATE_KEY environment variables must be set")
+		return exitcode.Auth
+	}
+	journal, err := store.Open(*journalPath)
+	if err != nil {
+		slog.Error("Failed to open trade journal", "error", err)
+		return exitcode.Config
+	}
+	defer journal.Close()
 
-	// Get spread boundary for base coin
-	spreadInfo, err := kraken.GetTickerInfo(*baseCoin)
+	ctx := context.Background()
+	result, err := reconcile.Run(ctx, journal, start, end)
 	if err != nil {
-		fmt.Println("Error getting spread boundary:", err)
-		os.Exit(1)
+		slog.Error("Failed to reconcile", "error", err)
+		return trader.FailureCode(err)
+	}
+	day := start.Format("2006-01-02")
+	slog.Info("Reconciled closed orders", "day", day, "orders", result.Orders, "journaled", result.Journaled, "discrepancies", len(result.Discrepancies))
+	if len(result.Discrepancies) == 0 {
+		return exitcode.OK
 	}
 
-	// Get OHLC data for price comparison. Hard cap on 8 hours
-	if err := kraken.GetOHLCData(*baseCoin, 4*time.Hour); err != nil {
-		fmt.Printf("Error getting OHLC data: %v\n", err)
+	lines := make([]string, len(result.Discrepancies))
+	for i, d := range result.Discrepancies {
+		slog.Warn("Order disagrees with the journal", "kind", d.Kind, "txid", d.Order.TxID, "detail", d.String())
+		lines[i] = d.String()
+	}
+	if *slack {
+		message := fmt.Sprintf("⚠️ Reconciliation of %s: %d of %d closed orders disagree with the journal\n%s",
+			day, len(result.Discrepancies), result.Orders, strings.Join(lines, "\n"))
+		if err := kraken.SendSlackMessage(ctx, message); err != nil {
+			slog.Warn("Failed to send Slack message", "error", err)
+		}
 	}
+	return exitcode.TradeFailed
+}
+
+// runPositions lists the account's open margin positions with their unrealized P&L and the
+// account's free margin
+func runPositions(args []string) int {
+	fs := flag.NewFlagSet("positions", flag.ExitOnError)
+	coin := fs.String("coin", "", "List the positions of this coin only (e.g. BTC, SOL)")
+	quote := fs.String("quote", "USD", "Quote currency of the pair and of the margin summary")
+	tier := fs.String("tier", "starter", "Kraken verification tier used for client-side rate limiting (starter, intermediate, pro)")
+	fs.Parse(args)
 
-	// Some asset codes differ submited on CLI differ from those recognized by Kraken.
-	baseCoinBalanceCode, err := kraken.KrakenAssetCode(*baseCoin)
+	if err := kraken.SetTier(*tier); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return exitcode.Config
+	}
+	if os.Getenv("KRAKEN_API_KEY") == "" || os.Getenv("KRAKEN_PRIVATE_KEY") == "" {
+		fmt.Println("Error: KRAKEN_API_KEY and KRAKEN_PRIVATE_KEY environment variables must be set")
+		return exitcode.Auth
+	}
+	kraken.Quote = *quote
+
+	ctx := context.Background()
+	var pair *kraken.AssetPair
+	if *coin != "" {
+		var err error
+		if pair, err = kraken.GetAssetPair(ctx, *coin, kraken.Quote); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			return trader.FailureCode(err)
+		}
+	}
+	positions, err := kraken.GetOpenPositions(ctx, pair)
 	if err != nil {
-		fmt.Printf("Error getting Kraken asset code: %v\n", err)
-		os.Exit(1)
+		fmt.Printf("Error getting open positions: %v\n", err)
+		return trader.FailureCode(err)
+	}
+	if len(positions) == 0 {
+		fmt.Println("No open margin positions")
+	} else {
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintf(w, "TXID\tPAIR\tTYPE\tOPENED\tVOLUME\tCOST\tMARGIN\tVALUE\tNET\n")
+		for _, p := range positions {
+			opened := time.Unix(int64(p.Time), 0).Format("2006-01-02 15:04")
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n", p.TxID, p.Pair, p.Type, opened,
+				strconv.FormatFloat(p.Open(), 'f', -1, 64), p.Cost, p.Margin, p.Value, p.Net)
+		}
+		w.Flush()
 	}
 
-	// Check available balance for the base coin (ignoring holds from open trades)
-	baseBalance, err := kraken.GetBalance(balanceBody, baseCoinBalanceCode)
+	balance, err := kraken.GetTradeBalance(ctx, *quote)
 	if err != nil {
-		fmt.Printf("Error getting %s balance: %v\n", baseCoinBalanceCode, err)
-		os.Exit(1)
+		fmt.Printf("Error getting trade balance: %v\n", err)
+		return trader.FailureCode(err)
 	}
-	fmt.Printf("\nAvailable %s: %.8f\n", baseCoinBalanceCode, baseBalance.Available)
+	fmt.Printf("Equity %s, margin used %s, free margin %s, unrealized P&L %s\n", money.Format(balance.Equity, *quote),
+		money.Format(balance.MarginUsed, *quote), money.Format(balance.FreeMargin, *quote), money.Format(balance.UnrealizedPL, *quote))
+	return exitcode.OK
+}
 
-	if baseBalance.Available < *volume {
-		fmt.Printf("\nInsufficient %s balance (have: %.8f, need: %.8f)\n",
-			*baseCoin, baseBalance.Available, *volume)
-		os.Exit(1)
+// manualHelp lists the keys of `trader manual`
+const manualHelp = `Keys:
+  b  place a buy order      s  place a sell order
+  e  edit an order's price  c  cancel an order
+  x  cancel all open orders l  list the session's orders
+  r  refresh the orders     h  show this help
+  q  quit, open orders stay on the exchange
+Enter accepts a [default], Escape aborts a prompt.`
+
+// runManual places, edits and cancels single limit orders by hand while showing the live bid and
+// ask. Orders are checked like the bot's own (pair minimums, max_volume, book crossing, distance
+// from the market, funds, trading status) and journaled under one trade per session.
+func runManual(args []string) int {
+	fs := flag.NewFlagSet("manual", flag.ExitOnError)
+	coin := fs.String("coin", "", "Base coin to trade (e.g. BTC, SOL)")
+	configPath := fs.String("config", "", "Path to a YAML config file with trading parameters (max_volume, price_decimals, money)")
+	journalPath := fs.String("journal", defaultJournalPath(), "SQLite trade journal recording the session's orders and fills (empty disables)")
+	refresh := fs.Duration("refresh", 2*time.Second, "Time between bid/ask updates")
+	poll := fs.Duration("poll", 10*time.Second, "Time between order status checks")
+	maxDeviation := manual.DefaultOptions.MaxDeviationPercent
+	fs.Var((*numparse.Float)(&maxDeviation), "maxdeviation", "Refuse prices further than this percentage from the mid price (0 disables)")
+	taker := fs.Bool("taker", false, "Allow prices crossing the book, which fill at once as taker")
+	tier := fs.String("tier", "starter", "Kraken verification tier used for client-side rate limiting (starter, intermediate, pro)")
+	logFile := fs.String("logfile", trader.DefaultStatePath("manual.log"), "File the session's actions are logged to, the terminal shows the market and orders")
+	logLevel := fs.String("loglevel", "info", "Minimum log level: debug, info, warn or error")
+	fs.Parse(args)
+
+	if *coin == "" || *refresh <= 0 || *poll <= 0 || maxDeviation < 0 {
+		fmt.Println("Error: -coin is required, -refresh and -poll must be positive")
+		fs.Usage()
+		return exitcode.Config
+	}
+	logOutput := io.Writer(os.Stderr)
+	if *logFile != "" {
+		file, err := os.OpenFile(*logFile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+		if err != nil {
+			fmt.Printf("Error opening log file: %v\n", err)
+			return exitcode.Config
+		}
+		defer file.Close()
+		logOutput = file
+	}
+	if err := logging.Setup(logOutput, "text", *logLevel); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return exitcode.Config
+	}
+	cfg, err := config.Load(*configPath)
+	if err != nil {
+		fmt.Printf("Error loading config: %v\n", err)
+		return exitcode.Config
+	}
+	cfg = cfg.ForCoin(*coin)
+	if err := money.SetPolicy(cfg.Money); err != nil {
+		fmt.Printf("Error: invalid money policy: %v\n", err)
+		return exitcode.Config
+	}
+	if err := kraken.SetBaseURL(cfg.APIURL); err != nil {
+		fmt.Printf("Error: invalid api_url: %v\n", err)
+		return exitcode.Config
+	}
+	if err := kraken.SetTier(*tier); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return exitcode.Config
 	}
+	if os.Getenv("KRAKEN_API_KEY") == "" || os.Getenv("KRAKEN_PRIVATE_KEY") == "" {
+		fmt.Println("Error: KRAKEN_API_KEY and KRAKEN_PRIVATE_KEY environment variables must be set")
+		return exitcode.Auth
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	tradeID := logging.NewTradeID()
+	ctx = logging.WithTradeID(ctx, tradeID)
+	log := slog.With("trade_id", tradeID, "pair", *coin+"/USD")
+	ctx = logging.NewContext(ctx, log)
 
-	// Check USD balance
-	usdBalance, err := kraken.GetBalance(balanceBody, "ZUSD")
+	assetPair, err := kraken.GetAssetPair(ctx, *coin, "USD")
+	if err != nil {
+		fmt.Printf("Error getting asset pair metadata: %v\n", err)
+		return trader.FailureCode(err)
+	}
+	if cfg.PriceDecimals >= 0 {
+		overridden := *assetPair
+		overridden.PairDecimals = cfg.PriceDecimals
+		assetPair = &overridden
+	}
+	market, err := kraken.GetTickerInfo(ctx, *coin)
 	if err != nil {
-		fmt.Printf("Error getting USD balance: %v\n", err)
-		os.Exit(1)
+		fmt.Printf("Error getting ticker: %v\n", err)
+		return trader.FailureCode(err)
+	}
+
+	var journal *store.Store
+	if *journalPath != "" {
+		journal, err = store.Open(*journalPath)
+		if err != nil {
+			fmt.Printf("Error opening trade journal: %v\n", err)
+			return exitcode.Config
+		}
+		defer journal.Close()
 	}
-	fmt.Printf("Available USD: %.2f\n", usdBalance.Available)
+	session := manual.New(ctx, *coin, assetPair, journal, tradeID, manual.Options{
+		MaxVolume:           cfg.MaxVolume,
+		MaxDeviationPercent: maxDeviation,
+		AllowTaker:          *taker,
+	})
+	defer session.Finish()
+	log.Info("Manual session started", "max_volume", cfg.MaxVolume, "max_deviation_percent", maxDeviation, "taker", *taker)
 
-	requiredUSD := *volume * spreadInfo.BidPrice
-	if usdBalance.Available < requiredUSD {
-		fmt.Printf("\nInsufficient USD balance (have: %.2f, need: %.2f)\n",
-			usdBalance.Available, requiredUSD)
-		os.Exit(1)
+	restore, err := manual.RawMode()
+	if err != nil {
+		fmt.Println("Input isn't a terminal, end every key with Enter")
+	} else {
+		defer restore()
 	}
+	keys := manual.Keys(ctx, os.Stdin)
 
-	// Place spread orders
-	if *orderFlag {
-		// Place order only if spread is within the boundaries
+	printMarket := func() {
+		fmt.Printf("%s  %s  bid %s  ask %s  spread %.2f%%\n", time.Now().Format("15:04:05"), assetPair.WSName,
+			assetPair.FormatPrice(market.BidPrice), assetPair.FormatPrice(market.AskPrice), market.Spread/market.BidPrice*100)
+	}
+	printOrder := func(i int, order *manual.Order) {
+		fmt.Printf("  %d. %-4s %s @ %s  %-8s filled %s  %s\n", i+1, order.Side, assetPair.FormatVolume(order.Volume),
+			assetPair.FormatPrice(order.Price), order.Status, assetPair.FormatVolume(order.VolExec), order.TxID)
+	}
+	printOrders := func() {
+		if len(session.Orders()) == 0 {
+			fmt.Println("No orders placed in this session")
+		}
+		for i, order := range session.Orders() {
+			printOrder(i, order)
+		}
+	}
+	prompt := func(text string) (string, bool) {
+		line, ok := manual.ReadLine(ctx, keys, os.Stdout, text)
+		return strings.TrimSpace(line), ok
+	}
+	promptFloat := func(text string, def float64, format func(float64) string) (float64, bool) {
 		for {
-			// Calculate spread percentage
-			fmt.Println("\nGetting fresh spread boundary to assess max. spread and min. volume...")
-			spreadInfo, err := kraken.GetTickerInfo(*baseCoin)
-			if err != nil {
-				fmt.Println("Error getting spread boundary:", err)
-				os.Exit(1)
+			line, ok := prompt(fmt.Sprintf("%s [%s]: ", text, format(def)))
+			if !ok {
+				return 0, false
+			}
+			if line == "" {
+				return def, true
+			}
+			value, err := numparse.Parse(line)
+			if err == nil {
+				return value, true
 			}
+			fmt.Printf("Invalid number: %v\n", err)
+		}
+	}
+	confirm := func(text string) bool {
+		line, ok := prompt(text + " [y/N]: ")
+		return ok && strings.EqualFold(line, "y")
+	}
+	// pickOrder asks for one of the open orders, the only one is picked without asking
+	pickOrder := func() *manual.Order {
+		open := session.OpenOrders()
+		if len(open) == 0 {
+			fmt.Println("No open orders")
+			return nil
+		}
+		if len(open) == 1 {
+			return open[0]
+		}
+		orders := session.Orders()
+		for i, order := range orders {
+			if order.Open() {
+				printOrder(i, order)
+			}
+		}
+		line, ok := prompt("Order number: ")
+		if !ok {
+			return nil
+		}
+		n, err := strconv.Atoi(line)
+		if err != nil || n < 1 || n > len(orders) || !orders[n-1].Open() {
+			fmt.Println("No such open order")
+			return nil
+		}
+		return orders[n-1]
+	}
+	refreshOrders := func() {
+		changed, err := session.Refresh()
+		if err != nil {
+			log.Warn("Failed to refresh orders", "error", err)
+			fmt.Printf("Failed to refresh orders: %v\n", err)
+		}
+		orders := session.Orders()
+		for _, order := range changed {
+			for i := range orders {
+				if orders[i] == order {
+					printOrder(i, order)
+				}
+			}
+		}
+	}
 
-			spreadPercent := (spreadInfo.Spread / spreadInfo.BidPrice) * 100
-			fmt.Printf("\nCurrent spread: %.4f%%\n", spreadPercent)
+	volume := cfg.MaxVolume
+	placeOrder := func(isBuy bool) {
+		side, def := "Sell", market.AskPrice
+		if isBuy {
+			side, def = "Buy", market.BidPrice
+		}
+		price, ok := promptFloat(side+" price", def, assetPair.FormatPrice)
+		if !ok {
+			return
+		}
+		vol, ok := promptFloat("Volume", volume, assetPair.FormatVolume)
+		if !ok {
+			return
+		}
+		if err := session.Validate(isBuy, price, vol, market); err != nil {
+			fmt.Printf("Refused: %v\n", err)
+			return
+		}
+		if !confirm(fmt.Sprintf("%s %s %s at %s (%s)?", side, assetPair.FormatVolume(vol), *coin, assetPair.FormatPrice(price),
+			money.Format(assetPair.RoundPrice(price)*assetPair.RoundVolume(vol), assetPair.QuoteAltname()))) {
+			return
+		}
+		volume = vol
+		order, err := session.Place(isBuy, price, vol, market)
+		if err != nil {
+			log.Warn("Manual order refused", "side", strings.ToLower(side), "price", price, "volume", vol, "error", err)
+			fmt.Printf("Refused: %v\n", err)
+			return
+		}
+		fmt.Printf("Placed %s\n", order.TxID)
+	}
 
-			// Get 24h volume
-			volume24h, err := kraken.Get24hVolume(*baseCoin)
-			if err != nil {
-				fmt.Printf("Error getting 24h volume: %v\n", err)
-				os.Exit(1)
-			}
-			fmt.Printf("24h Volume: %.2f USD\n", volume24h)
+	fmt.Printf("Manual trading %s, orders are real. Session %s, log %s\n", assetPair.WSName, tradeID, *logFile)
+	fmt.Println(manualHelp)
+	printMarket()
 
-			// Skip and re-try if spread and volume are not within the boundaries
-			if spreadPercent < minSpreadPercent {
-				fmt.Println("❌ Spread is not within the boundaries. Sleeping for a while...")
-				time.Sleep(10 * time.Second)
+	refreshTicker := time.NewTicker(*refresh)
+	defer refreshTicker.Stop()
+	pollTicker := time.NewTicker(*poll)
+	defer pollTicker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			fmt.Println()
+			return manualQuit(log, session, assetPair)
+		case <-refreshTicker.C:
+			latest, err := kraken.GetTickerInfo(ctx, *coin)
+			if err != nil {
+				log.Warn("Failed to get ticker", "error", err)
 				continue
 			}
-			if volume24h < minVolume24h {
-				fmt.Println("❌ 24h volume is not within the boundaries. Sleeping for a while...")
-				time.Sleep(10 * time.Second)
-				continue
+			if latest.BidPrice != market.BidPrice || latest.AskPrice != market.AskPrice {
+				market = latest
+				printMarket()
+			}
+		case <-pollTicker.C:
+			if len(session.OpenOrders()) > 0 {
+				refreshOrders()
+			}
+		case key, ok := <-keys:
+			if !ok {
+				return manualQuit(log, session, assetPair)
+			}
+			switch key {
+			case 'b':
+				placeOrder(true)
+			case 's':
+				placeOrder(false)
+			case 'e':
+				order := pickOrder()
+				if order == nil {
+					continue
+				}
+				price, ok := promptFloat("New price", order.Price, assetPair.FormatPrice)
+				if !ok {
+					continue
+				}
+				edited, err := session.Edit(order, price, market)
+				if err != nil {
+					fmt.Printf("Refused: %v\n", err)
+					continue
+				}
+				fmt.Printf("Moved to %s, now %s\n", assetPair.FormatPrice(edited.Price), edited.TxID)
+			case 'c':
+				order := pickOrder()
+				if order == nil {
+					continue
+				}
+				if err := session.Cancel(order); err != nil {
+					fmt.Printf("Failed to cancel: %v\n", err)
+					continue
+				}
+				fmt.Printf("Canceled %s\n", order.TxID)
+			case 'x':
+				open := session.OpenOrders()
+				if len(open) == 0 {
+					fmt.Println("No open orders")
+					continue
+				}
+				if !confirm(fmt.Sprintf("Cancel %d open orders?", len(open))) {
+					continue
+				}
+				for _, order := range open {
+					if err := session.Cancel(order); err != nil {
+						fmt.Printf("Failed to cancel %s: %v\n", order.TxID, err)
+						continue
+					}
+					fmt.Printf("Canceled %s\n", order.TxID)
+				}
+			case 'l':
+				printMarket()
+				printOrders()
+			case 'r':
+				refreshOrders()
+			case 'h', '?':
+				fmt.Println(manualHelp)
+			case 'q':
+				return manualQuit(log, session, assetPair)
 			}
-
-			fmt.Println("✅ Spread and volume are within the boundaries. Placing orders.")
-			break
 		}
+	}
+}
+
+// manualQuit reports the orders a manual session leaves open on the exchange
+func manualQuit(log *slog.Logger, session *manual.Session, pair *kraken.AssetPair) int {
+	open := session.OpenOrders()
+	for _, order := range open {
+		fmt.Printf("Left open: %s %s at %s (%s)\n", order.Side, pair.FormatVolume(order.Volume), pair.FormatPrice(order.Price), order.TxID)
+	}
+	log.Info("Manual session finished", "open_orders", len(open))
+	return exitcode.OK
+}
+
+// runMaker quotes both sides of a pair continuously: a buy and a sell inside the spread, each
+// re-quoted at the current spread as soon as it's done, until interrupted, -roundtrips are filled
+// or the daily loss limit is reached. Live quotes are canceled on the way out.
+func runMaker(args []string) int {
+	fs := flag.NewFlagSet("maker", flag.ExitOnError)
+	coin := fs.String("coin", "", "Base coin to trade (e.g. BTC, SOL)")
+	var volume float64
+	fs.Var((*numparse.Float)(&volume), "volume", "Base coin volume of every quote")
+	configPath := fs.String("config", "", "Path to a YAML config file with trading parameters")
+	roundTrips := fs.Int("roundtrips", 0, "Stop after this many filled buy and sell quotes each (0 runs until interrupted)")
+	journalPath := fs.String("journal", defaultJournalPath(), "SQLite trade journal recording the session's orders, fills and P&L (empty disables)")
+	postOnly := fs.Bool("postonly", false, "Place maker-only quotes, canceled by the exchange instead of crossing the book")
+	paper := fs.Bool("paper", false, "Quote against the simulated exchange and virtual account of paper trading")
+	paperAccount := fs.String("paperaccount", trader.DefaultStatePath("paper.json"), "Virtual account of paper trading")
+	paperUSD, paperBase, paperFee := 10000.0, 0.0, 0.25
+	fs.Var((*numparse.Float)(&paperUSD), "paperusd", "USD seeded into a new paper account")
+	fs.Var((*numparse.Float)(&paperBase), "paperbase", "Base coin amount seeded into a new paper account")
+	fs.Var((*numparse.Float)(&paperFee), "paperfee", "Maker fee percentage charged on paper fills")
+	tier := fs.String("tier", "starter", "Kraken verification tier used for client-side rate limiting (starter, intermediate, pro)")
+	logFormat := fs.String("logformat", "text", "Log output format: text or json")
+	logLevel := fs.String("loglevel", "info", "Minimum log level: debug, info, warn or error")
+	jsonOutput := fs.Bool("json", false, "Emit fill and result events as JSON on stdout, logs go to stderr")
+	fs.Parse(args)
+
+	logOutput := os.Stdout
+	if *jsonOutput {
+		logOutput = os.Stderr
+	}
+	if err := logging.Setup(logOutput, *logFormat, *logLevel); err != nil {
+		fmt.Fprintf(logOutput, "Error: %v\n", err)
+		return exitcode.Config
+	}
+	if *coin == "" || volume <= 0 || *roundTrips < 0 {
+		slog.Error("-coin and a positive -volume are required, -roundtrips must not be negative")
+		return exitcode.Config
+	}
+	cfg, err := config.Load(*configPath)
+	if err != nil {
+		slog.Error("Failed to load config", "error", err)
+		return exitcode.Config
+	}
+	cfg = cfg.ForCoin(*coin)
+	if cfg.MaxVolume > 0 && volume > cfg.MaxVolume {
+		slog.Error("Volume exceeds max_volume", "volume", volume, "max_volume", cfg.MaxVolume)
+		return exitcode.Config
+	}
+	if err := money.SetPolicy(cfg.Money); err != nil {
+		slog.Error("Invalid money policy", "error", err)
+		return exitcode.Config
+	}
+	if err := kraken.SetBaseURL(cfg.APIURL); err != nil {
+		slog.Error("Invalid api_url", "error", err)
+		return exitcode.Config
+	}
+	if err := kraken.SetTier(*tier); err != nil {
+		slog.Error("Invalid tier", "error", err)
+		return exitcode.Config
+	}
+	kraken.PostOnly = *postOnly
+	if !*paper && (os.Getenv("KRAKEN_API_KEY") == "" || os.Getenv("KRAKEN_PRIVATE_KEY") == "") {
+		slog.Error("KRAKEN_API_KEY and KRAKEN_PRIVATE_KEY environment variables must be set")
+		return exitcode.Auth
+	}
 
-		buyTxId, sellTxId, estimatedProfit, estimatedPercentGain, err := kraken.PlaceSpreadOrders(*baseCoin, spreadInfo, *volume, *untradeable, spreadNarrowFactor)
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	tradeID := logging.NewTradeID()
+	ctx = logging.WithTradeID(ctx, tradeID)
+	log := slog.With("trade_id", tradeID, "pair", *coin+"/USD")
+	ctx = logging.NewContext(ctx, log)
+	if *jsonOutput {
+		events.Enable(os.Stdout, tradeID)
+	}
+
+	assetPair, err := kraken.GetAssetPair(ctx, *coin, "USD")
+	if err != nil {
+		log.Error("Failed to get asset pair metadata", "error", err)
+		return trader.FailureCode(err)
+	}
+	if cfg.PriceDecimals >= 0 {
+		overridden := *assetPair
+		overridden.PairDecimals = cfg.PriceDecimals
+		assetPair = &overridden
+	}
+
+	// Both quotes rest inside the spread and pay the maker fee of the account's tier
+	makerFee := paperFee
+	if *paper {
+		seed := map[string]float64{assetPair.Base: paperBase, assetPair.Quote: paperUSD}
+		if err := kraken.StartPaper(*paperAccount, seed, paperFee); err != nil {
+			log.Error("Failed to open paper account", "error", err)
+			return exitcode.Config
+		}
+		log.Info("Paper trading", "account", *paperAccount, "maker_fee_percent", paperFee)
+	} else {
+		tradeVolume, err := kraken.GetTradeVolume(ctx, assetPair)
 		if err != nil {
-			fmt.Printf("Error placing spread orders: %v\n", err)
-			os.Exit(1)
+			log.Error("Failed to get fee tier", "error", err)
+			return trader.FailureCode(err)
 		}
+		makerFee = tradeVolume.MakerFee
+	}
 
-		// Check status of both orders until both are closed
-		for {
-			time.Sleep(10 * time.Second)
+	opts := maker.Options{
+		Volume:              volume,
+		NarrowFactor:        cfg.SpreadNarrowFactor,
+		MinNetProfitPercent: cfg.MinNetProfitPercent,
+		MakerFeePercent:     makerFee,
+		PollInterval:        cfg.StatusCheckInterval,
+		Limits:              risk.Limits{MaxExposureUSD: cfg.MaxExposureUSD, MaxOpenSpreads: cfg.MaxOpenSpreads},
+		MaxRoundTrips:       *roundTrips,
+		InventoryTarget:     cfg.InventoryTarget,
+		MaxInventory:        cfg.MaxInventory,
+		InventorySkew:       cfg.InventorySkew,
+	}
+	if cfg.LadderLevels > 1 {
+		opts.Ladder, err = maker.Ladder(assetPair, volume, cfg.LadderLevels, cfg.LadderStepPercent, cfg.LadderSizeFactor)
+		if err != nil {
+			log.Error("Invalid quote ladder", "error", err)
+			return exitcode.Config
+		}
+		for i, level := range opts.Ladder {
+			log.Info("Ladder level", "level", i, "offset_percent", level.Offset*100, "volume", assetPair.FormatVolume(level.Volume))
+		}
+	}
 
-			fmt.Printf("\n🟢 BUY %s status check\n", *baseCoin)
-			buyOrder, err := kraken.CheckOrderStatus(buyTxId)
+	// The skew starts from the base coin balance, total including what open orders hold
+	if cfg.MaxInventory > 0 {
+		var balances map[string]kraken.Balance
+		if *paper {
+			balances = kraken.PaperBalances()
+		} else {
+			balanceBody, err := kraken.GetAccountBalance(ctx)
 			if err != nil {
-				fmt.Printf("Error checking buy order status: %v\n", err)
-				continue
+				log.Error("Failed to get account balance", "error", err)
+				return trader.FailureCode(err)
 			}
-
-			fmt.Printf("\n🔴 SELL %s status check\n", *baseCoin)
-			sellOrder, err := kraken.CheckOrderStatus(sellTxId)
+			balances, err = kraken.GetAllBalances(balanceBody)
 			if err != nil {
-				fmt.Printf("Error checking sell order status: %v\n", err)
-				continue
+				log.Error("Failed to parse account balance", "error", err)
+				return exitcode.TradeFailed
 			}
+		}
+		if balance, err := kraken.GetBalance(balances, assetPair.Base); err == nil {
+			opts.StartInventory = balance.Total
+		}
+		log.Info("Inventory", "balance", opts.StartInventory, "inventory_target", cfg.InventoryTarget, "max_inventory", cfg.MaxInventory, "inventory_skew", cfg.InventorySkew)
+	}
 
-			// If both orders are closed, print success message and exit
-			if buyOrder.Status == "closed" && sellOrder.Status == "closed" {
-				fmt.Println("\n🎉 🎉 🎉 TRADE COMPLETE! 🎉 🎉 🎉")
-				fmt.Println("Both buy and sell orders have been successfully executed.")
+	// Paper quotes aren't journaled, like paper trades
+	var journal *store.Store
+	if *journalPath != "" && !*paper {
+		journal, err = store.Open(*journalPath)
+		if err != nil {
+			log.Error("Failed to open trade journal", "error", err)
+			return exitcode.TradeFailed
+		}
+		defer journal.Close()
+	}
+	// The daily loss limit leaves the session what the day's earlier trades haven't lost yet
+	if journal != nil && cfg.DailyLossLimit > 0 {
+		now := time.Now().In(cfg.Location())
+		today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+		pnl, err := journal.RealizedPnL(today, time.Time{})
+		if err != nil {
+			log.Error("Failed to read the day's realized P&L", "error", err)
+			return exitcode.TradeFailed
+		}
+		opts.LossBudget = cfg.DailyLossLimit + pnl
+		if opts.LossBudget <= 0 {
+			log.Error("Daily loss limit reached, not quoting", "realized_pnl_usd", pnl, "daily_loss_limit_usd", cfg.DailyLossLimit)
+			return exitcode.DailyLossLimit
+		}
+	}
 
-				// Get current spread information
-				currentSpreadInfo, err := kraken.GetTickerInfo(*baseCoin)
-				if err != nil {
-					fmt.Printf("Error getting current spread info: %v\n", err)
-				}
+	notify := func(quote *maker.Quote) {
+		log.Info("Quote updated", "txid", quote.TxID, "type", quote.Side, "status", quote.Status,
+			"vol_exec", assetPair.FormatVolume(quote.VolExec), "price", assetPair.FormatPrice(quote.Price))
+		events.Emit(events.Fill, map[string]interface{}{
+			"txid":     quote.TxID,
+			"side":     quote.Side,
+			"status":   quote.Status,
+			"price":    quote.Price,
+			"volume":   quote.Volume,
+			"vol_exec": quote.VolExec,
+			"cost":     quote.Cost,
+			"fee":      quote.Fee,
+		})
+	}
 
-				// Calculate spread information
-				spread := currentSpreadInfo.Spread
-				spreadPercent := (spread / currentSpreadInfo.BidPrice) * 100
+	m := maker.New(*coin, assetPair, journal, tradeID, opts)
+	log.Info("Market maker started",
+		"volume", volume,
+		"spread_narrow_factor", opts.NarrowFactor,
+		"maker_fee_percent", makerFee,
+		"round_trips", *roundTrips,
+		"loss_budget_usd", opts.LossBudget)
+	runErr := m.Run(ctx, notify)
 
-				// Get 24h volume
-				volume24h, err := kraken.Get24hVolume(*baseCoin)
-				if err != nil {
-					fmt.Printf("Error getting 24h volume: %v\n", err)
-				}
+	// Cancel the live quotes even after a signal canceled ctx
+	finishCtx := logging.NewContext(logging.WithTradeID(context.Background(), tradeID), log)
+	m.Finish(finishCtx, notify)
 
-				// Calculate total fees
-				buyFee, _ := strconv.ParseFloat(buyOrder.Fee, 64)
-				sellFee, _ := strconv.ParseFloat(sellOrder.Fee, 64)
-				totalFees := buyFee + sellFee
-
-				// Get actual executed prices
-				buyPrice, _ := strconv.ParseFloat(buyOrder.Descr.Price, 64)
-				sellPrice, _ := strconv.ParseFloat(sellOrder.Descr.Price, 64)
-
-				fmt.Printf("Total Fees: %.2f USD (Buy: %.2f, Sell: %.2f)\n", totalFees, buyFee, sellFee)
-				slackErr := kraken.SendSlackMessage(fmt.Sprintf(
-					"✅ Trade %s/USD executed\n"+
-						"Volume: %.5f\n"+
-						"Buy price: %.6f\n"+
-						"Sell price: %.6f\n"+
-						"Estimated profit: %.2f USD (%.4f%%)\n"+
-						"Buy Order ID: %s\n"+
-						"Sell Order ID: %s\n"+
-						"Spread now: %.6f (%.4f%%)\n"+
-						"24h Volume: %.2f USD\n"+
-						"Fees: %.2f USD (Buy: %.2f, Sell: %.2f)",
-					*baseCoin,
-					*volume,
-					buyPrice,
-					sellPrice,
-					estimatedProfit,
-					estimatedPercentGain,
-					buyTxId,
-					sellTxId,
-					spread,
-					spreadPercent,
-					volume24h,
-					totalFees,
-					buyFee,
-					sellFee,
-				))
-				if slackErr != nil {
-					fmt.Printf("Error sending Slack message: %v\n", slackErr)
-				}
-				os.Exit(0)
-			}
+	stats := m.Stats()
+	gross, net := stats.Realized()
+	log.Info("Market maker stopped",
+		"bought", stats.Bought,
+		"sold", stats.Sold,
+		"inventory", stats.Inventory(),
+		"round_trips", stats.RoundTrips(),
+		"fees_usd", stats.Fees,
+		"gross_profit_usd", gross,
+		"net_profit_usd", net)
+	events.Emit(events.Result, map[string]interface{}{
+		"result":           maker.Result,
+		"bought":           stats.Bought,
+		"sold":             stats.Sold,
+		"inventory":        stats.Inventory(),
+		"round_trips":      stats.RoundTrips(),
+		"fees_usd":         stats.Fees,
+		"gross_profit_usd": gross,
+		"net_profit_usd":   net,
+	})
+	if *paper {
+		trader.LogPaperAccount(log, assetPair, nil)
+	}
+	slackErr := kraken.SendSlackMessage(finishCtx, fmt.Sprintf(
+		"Market maker on %s/USD stopped\n"+
+			"Round trips: %d, inventory %s %s\n"+
+			"Net profit: %s USD (fees %s USD)",
+		*coin,
+		stats.RoundTrips(), assetPair.FormatVolume(stats.Inventory()), *coin,
+		money.FormatSigned(net, "USD"), money.Format(stats.Fees, "USD"),
+	))
+	if slackErr != nil {
+		log.Warn("Failed to send Slack message", "error", slackErr)
+	}
 
-			if buyOrder.Status == "canceled" && sellOrder.Status == "canceled" {
-				fmt.Println("\n=== TRADE CANCELED! ===")
-				fmt.Println("Both buy and sell orders have been canceled.")
-				fmt.Printf("Unrealised Profit: %.2f USD (Gain: %.4f%%)\n", estimatedProfit, estimatedPercentGain)
-				os.Exit(0)
-			}
+	switch {
+	case runErr == nil:
+		return exitcode.OK
+	case errors.Is(runErr, maker.ErrLossLimit):
+		log.Error("Daily loss limit reached, stopped quoting", "daily_loss_limit_usd", cfg.DailyLossLimit)
+		return exitcode.DailyLossLimit
+	case ctx.Err() != nil:
+		return exitcode.Interrupted
+	}
+	log.Error("Market maker failed", "error", runErr)
+	return trader.FailureCode(runErr)
+}
+
+// runStrategy runs a registered strategy on one coin until it's done or interrupted
+func runStrategy(args []string) int {
+	fs := flag.NewFlagSet("strategy", flag.ExitOnError)
+	name := fs.String("name", "", "Strategy to run (default: strategy from the config)")
+	coin := fs.String("coin", "", "Base coin to trade (e.g. BTC, SOL)")
+	var volume float64
+	fs.Var((*numparse.Float)(&volume), "volume", "Base coin volume of a trade")
+	configPath := fs.String("config", "", "Path to a YAML config file with trading parameters")
+	journalPath := fs.String("journal", defaultJournalPath(), "SQLite trade journal recording the session's orders, fills and P&L (empty disables)")
+	postOnly := fs.Bool("postonly", false, "Place maker-only orders, canceled by the exchange instead of crossing the book")
+	paper := fs.Bool("paper", false, "Trade against the simulated exchange and virtual account of paper trading")
+	paperAccount := fs.String("paperaccount", trader.DefaultStatePath("paper.json"), "Virtual account of paper trading")
+	paperUSD, paperBase, paperFee := 10000.0, 0.0, 0.25
+	fs.Var((*numparse.Float)(&paperUSD), "paperusd", "USD seeded into a new paper account")
+	fs.Var((*numparse.Float)(&paperBase), "paperbase", "Base coin amount seeded into a new paper account")
+	fs.Var((*numparse.Float)(&paperFee), "paperfee", "Maker fee percentage charged on paper fills")
+	tier := fs.String("tier", "starter", "Kraken verification tier used for client-side rate limiting (starter, intermediate, pro)")
+	logFormat := fs.String("logformat", "text", "Log output format: text or json")
+	logLevel := fs.String("loglevel", "info", "Minimum log level: debug, info, warn or error")
+	jsonOutput := fs.Bool("json", false, "Emit fill and result events as JSON on stdout, logs go to stderr")
+	fs.Parse(args)
+
+	logOutput := os.Stdout
+	if *jsonOutput {
+		logOutput = os.Stderr
+	}
+	if err := logging.Setup(logOutput, *logFormat, *logLevel); err != nil {
+		fmt.Fprintf(logOutput, "Error: %v\n", err)
+		return exitcode.Config
+	}
+	if *coin == "" || volume <= 0 {
+		slog.Error("-coin and a positive -volume are required")
+		return exitcode.Config
+	}
+	cfg, err := config.Load(*configPath)
+	if err != nil {
+		slog.Error("Failed to load config", "error", err)
+		return exitcode.Config
+	}
+	cfg = cfg.ForCoin(*coin)
+	if *name != "" {
+		cfg.Strategy = *name
+	}
+	if err := money.SetPolicy(cfg.Money); err != nil {
+		slog.Error("Invalid money policy", "error", err)
+		return exitcode.Config
+	}
+	if err := kraken.SetBaseURL(cfg.APIURL); err != nil {
+		slog.Error("Invalid api_url", "error", err)
+		return exitcode.Config
+	}
+	if err := kraken.SetTier(*tier); err != nil {
+		slog.Error("Invalid tier", "error", err)
+		return exitcode.Config
+	}
+	kraken.PostOnly = *postOnly
+
+	tradeID := logging.NewTradeID()
+	if *jsonOutput {
+		events.Enable(os.Stdout, tradeID)
+	}
+	return tradeStrategy(strategyOptions{
+		cfg:          cfg,
+		coin:         *coin,
+		volume:       volume,
+		tradeID:      tradeID,
+		journalPath:  *journalPath,
+		paper:        *paper,
+		paperAccount: *paperAccount,
+		paperUSD:     paperUSD,
+		paperBase:    paperBase,
+		paperFee:     paperFee,
+	})
+}
+
+// strategyOptions are the inputs of a strategy run, from `trader strategy` or the trader's flags
+// when the config selects another strategy than the spread trade
+type strategyOptions struct {
+	cfg          *config.Config // cfg.Strategy names the strategy
+	coin         string
+	volume       float64
+	tradeID      string
+	journalPath  string // empty disables journaling
+	paper        bool
+	paperAccount string
+	paperUSD     float64
+	paperBase    float64
+	paperFee     float64
+}
+
+// tradeStrategy runs the registered strategy cfg.Strategy on one coin until it's done or
+// interrupted. The kraken package is set up by the caller.
+func tradeStrategy(opts strategyOptions) int {
+	cfg, volume := opts.cfg, opts.volume
+	if !strategy.Registered(cfg.Strategy) {
+		slog.Error("Unknown strategy", "strategy", cfg.Strategy, "available", strategy.Names())
+		return exitcode.Config
+	}
+	if cfg.MaxVolume > 0 && volume > cfg.MaxVolume {
+		slog.Error("Volume exceeds max_volume", "volume", volume, "max_volume", cfg.MaxVolume)
+		return exitcode.Config
+	}
+	if !opts.paper && (os.Getenv("KRAKEN_API_KEY") == "" || os.Getenv("KRAKEN_PRIVATE_KEY") == "") {
+		slog.Error("KRAKEN_API_KEY and KRAKEN_PRIVATE_KEY environment variables must be set")
+		return exitcode.Auth
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	tradeID := opts.tradeID
+	ctx = logging.WithTradeID(ctx, tradeID)
+	log := slog.With("trade_id", tradeID, "pair", opts.coin+"/USD", "strategy", cfg.Strategy)
+	ctx = logging.NewContext(ctx, log)
+
+	assetPair, err := kraken.GetAssetPair(ctx, opts.coin, "USD")
+	if err != nil {
+		log.Error("Failed to get asset pair metadata", "error", err)
+		return trader.FailureCode(err)
+	}
+	if cfg.PriceDecimals >= 0 {
+		overridden := *assetPair
+		overridden.PairDecimals = cfg.PriceDecimals
+		assetPair = &overridden
+	}
+
+	makerFee := opts.paperFee
+	if opts.paper {
+		seed := map[string]float64{assetPair.Base: opts.paperBase, assetPair.Quote: opts.paperUSD}
+		if err := kraken.StartPaper(opts.paperAccount, seed, opts.paperFee); err != nil {
+			log.Error("Failed to open paper account", "error", err)
+			return exitcode.Config
 		}
+		log.Info("Paper trading", "account", opts.paperAccount, "maker_fee_percent", opts.paperFee)
 	} else {
-		fmt.Println("\nOrder (-order) flag not set. Skipping order placement.")
+		tradeVolume, err := kraken.GetTradeVolume(ctx, assetPair)
+		if err != nil {
+			log.Error("Failed to get fee tier", "error", err)
+			return trader.FailureCode(err)
+		}
+		makerFee = tradeVolume.MakerFee
 	}
+
+	s, err := strategy.New(cfg.Strategy, strategy.Params{Coin: opts.coin, Pair: assetPair, Volume: volume, MakerFeePercent: makerFee, Config: cfg})
+	if err != nil {
+		log.Error("Failed to create strategy", "error", err)
+		return exitcode.Config
+	}
+
+	// Paper orders aren't journaled, like paper trades
+	var journal *store.Store
+	if opts.journalPath != "" && !opts.paper {
+		journal, err = store.Open(opts.journalPath)
+		if err != nil {
+			log.Error("Failed to open trade journal", "error", err)
+			return exitcode.TradeFailed
+		}
+		defer journal.Close()
+	}
+	// The daily loss limit leaves the session what the day's earlier trades haven't lost yet
+	var lossBudget float64
+	if journal != nil && cfg.DailyLossLimit > 0 {
+		now := time.Now().In(cfg.Location())
+		today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+		pnl, err := journal.RealizedPnL(today, time.Time{})
+		if err != nil {
+			log.Error("Failed to read the day's realized P&L", "error", err)
+			return exitcode.TradeFailed
+		}
+		lossBudget = cfg.DailyLossLimit + pnl
+		if lossBudget <= 0 {
+			log.Error("Daily loss limit reached, not trading", "realized_pnl_usd", pnl, "daily_loss_limit_usd", cfg.DailyLossLimit)
+			return exitcode.DailyLossLimit
+		}
+	}
+
+	runner := strategy.NewRunner(cfg.Strategy, opts.coin, assetPair, s, journal, tradeID, cfg.StatusCheckInterval, lossBudget)
+	log.Info("Strategy started", "volume", volume, "maker_fee_percent", makerFee, "loss_budget_usd", lossBudget)
+	runErr := runner.Run(ctx)
+
+	// Cancel the live orders even after a signal canceled ctx
+	finishCtx := logging.NewContext(logging.WithTradeID(context.Background(), tradeID), log)
+	runner.Finish(finishCtx)
+
+	stats := runner.Stats()
+	gross, net := stats.Realized()
+	log.Info("Strategy stopped",
+		"bought", stats.Bought,
+		"sold", stats.Sold,
+		"inventory", stats.Inventory(),
+		"fees_usd", stats.Fees,
+		"gross_profit_usd", gross,
+		"net_profit_usd", net)
+	events.Emit(events.Result, map[string]interface{}{
+		"result":           cfg.Strategy,
+		"bought":           stats.Bought,
+		"sold":             stats.Sold,
+		"inventory":        stats.Inventory(),
+		"fees_usd":         stats.Fees,
+		"gross_profit_usd": gross,
+		"net_profit_usd":   net,
+	})
+	if opts.paper {
+		trader.LogPaperAccount(log, assetPair, nil)
+	}
+
+	switch {
+	case runErr == nil:
+		return exitcode.OK
+	case errors.Is(runErr, strategy.ErrLossLimit):
+		log.Error("Daily loss limit reached, stopped trading", "daily_loss_limit_usd", cfg.DailyLossLimit)
+		return exitcode.DailyLossLimit
+	case ctx.Err() != nil:
+		return exitcode.Interrupted
+	}
+	log.Error("Strategy failed", "error", runErr)
+	return trader.FailureCode(runErr)
 }
+
+// runSelfUpdate replaces the running binary with the latest release if it's newer
+func runSelfUpdate(args []string) int {
+	fs := flag.NewFlagSet("self-update", flag.ExitOnError)
+	check := fs.Bool("check", false, "Only report whether a newer release is available")
+	force := fs.Bool("force", false, "Install the latest release even if it matches the running version")
+	fs.Parse(args)
+
+	ctx := context.Background()
+	release, err := selfupdate.Latest(ctx)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return exitcode.TradeFailed
+	}
+	fmt.Printf("Running %s, latest release %s\n", version, release.Tag)
+	if release.Tag == version && !*force {
+		fmt.Println("Already up to date")
+		return exitcode.OK
+	}
+	if *check {
+		return exitcode.OK
+	}
+
+	executable, err := os.Executable()
+	if err == nil {
+		executable, err = filepath.EvalSymlinks(executable)
+	}
+	if err != nil {
+		fmt.Printf("Error finding the running executable: %v\n", err)
+		return exitcode.TradeFailed
+	}
+	if err := selfupdate.Install(ctx, release, executable); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return exitcode.TradeFailed
+	}
+	fmt.Printf("Updated %s to %s\n", executable, release.Tag)
+	return exitcode.OK
+}
+
+// exit finishes the session recording or replay, logs the summary of the run's warnings and errors
+// and terminates the process with one of the exitcode codes. A replay that diverged from its
+// recording always exits with exitcode.TradeFailed.
+func exit(code int) {
+	// Orders left open on purpose (-detach, -onsignal leave, manual checks) must outlive the process
+	if err := kraken.DisarmDeadMansSwitch(context.Background()); err != nil {
+		slog.Error("Failed to disarm dead man's switch, open orders will be canceled", "error", err)
+	}
+	replaying := kraken.Replaying()
+	if err := kraken.FinishSession(); err != nil {
+		slog.Error("Session failed", "error", err)
+		code = exitcode.TradeFailed
+		logging.LogSummary()
+		events.Emit(events.Exit, map[string]int{"code": code})
+		os.Exit(code)
+	}
+	if replaying {
+		slog.Info("Replay matches the recorded decisions")
+	}
+	logging.LogSummary()
+	events.Emit(events.Exit, map[string]int{"code": code})
+	os.Exit(code)
+}
+
+// autoselectCoin scans the USD pairs passing the scanner filters of the config and returns the base
+// coin of the best scoring one whose 24h volume and spread exceed min_volume_24h and
+// min_spread_percent. Depth is only requested when it's part of the score.
+func autoselectCoin(ctx context.Context, cfg *config.Config) (string, error) {
+	result, err := scanner.Scan(ctx, scanner.Options{
+		MinVolumeUSD:  cfg.MinVolume24h,
+		MinSpreadPct:  cfg.MinSpreadPercent,
+		Depth:         cfg.Scanner.ScoreWeights["depth_usd"] != 0,
+		Workers:       4,
+		Weights:       cfg.Scanner.ScoreWeights,
+		MakerFeePct:   cfg.Scanner.MakerFeePercent,
+		Quote:         kraken.Quote,
+		MinPrice:      cfg.Scanner.MinPrice,
+		ExcludeStable: cfg.Scanner.ExcludeStablecoins,
+		ExcludeDark:   true,
+		Include:       cfg.Scanner.Include,
+		Exclude:       cfg.Scanner.Exclude,
+	})
+	if err != nil {
+		return "", err
+	}
+	best, err := result.Best()
+	if err != nil {
+		return "", err
+	}
+	coin := best.Base
+	logging.FromContext(ctx).Info("Autoselected pair", "pair", best.Pair, "coin", coin, "score", best.Score,
+		"spread_percent", best.SpreadPct, "net_edge_percent", best.NetEdgePct, "fills_per_hour", best.FillsPerHour, "volume_usd", best.VolumeUSD, "candidates", len(result.Qualifying()))
+	kraken.RecordDecision("autoselect", coin)
+	return coin, nil
+}
+
+// defaultJournalPath returns the journal location in the state directory, or "" if it's unavailable
+func defaultJournalPath() string {
+	return trader.DefaultStatePath("journal.db")
+}
+
+// confirm asks a yes/no question on the terminal. Without a terminal on stdin, e.g. under
+// cron, nobody can answer and the question is declined.
+func confirm(out *os.File, question string) bool {
+	info, err := os.Stdin.Stat()
+	if err != nil || info.Mode()&os.ModeCharDevice == 0 {
+		return false
+	}
+	fmt.Fprint(out, question)
+
+	// Ctrl-C at the prompt declines
+	answers := make(chan string, 1)
+	go func() {
+		answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+		answers <- answer
+	}()
+	var answer string
+	select {
+	case answer = <-answers:
+	case <-shutdown:
+		fmt.Fprintln(out)
+		return false
+	}
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes"
+}
+
+// flagSet reports whether a flag was given explicitly on the command line
+func flagSet(name string) bool {
+	set := false
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			set = true
+		}
+	})
+	return set
+}
+
+// shutdown is closed on the first SIGINT or SIGTERM
+var shutdown = make(chan struct{})
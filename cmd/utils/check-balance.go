@@ -3,14 +3,28 @@
 package main
 
 import (
+	"context"
+	"flag"
 	"fmt"
 	"os"
-	"time"
+	"sort"
+	"text/tabwriter"
 
 	"github.com/jkosik/crypto-trader/internal/kraken"
+	"github.com/jkosik/crypto-trader/internal/money"
+	"github.com/jkosik/crypto-trader/internal/portfolio"
 )
 
 func main() {
+	hideZero := flag.Bool("nonzero", false, "Hide assets with a zero balance")
+	sortBy := flag.String("sort", "asset", "Sort by asset code or by USD value (asset or value)")
+	flag.Parse()
+
+	if *sortBy != "asset" && *sortBy != "value" {
+		fmt.Printf("Error: unknown -sort %q, use asset or value\n", *sortBy)
+		os.Exit(2)
+	}
+
 	// Check for required environment variables
 	apiKey := os.Getenv("KRAKEN_API_KEY")
 	apiSecret := os.Getenv("KRAKEN_PRIVATE_KEY")
@@ -21,27 +35,59 @@ func main() {
 	}
 
 	// Get account balance
-	nonce := time.Now().UnixNano() / int64(time.Millisecond)
-	urlBase := "https://api.kraken.com"
-	urlPath := "/0/private/BalanceEx"
-
-	payload := fmt.Sprintf(`{
-		"nonce": "%d"
-	}`, nonce)
-
-	signature, err := kraken.GetKrakenSignature(urlPath, payload, apiSecret)
+	ctx := context.Background()
+	balanceBody, err := kraken.GetAccountBalance(ctx)
 	if err != nil {
-		fmt.Printf("Error generating signature: %v\n", err)
+		fmt.Printf("Error getting account balance: %v\n", err)
 		os.Exit(1)
 	}
 
-	balanceBody, err := kraken.MakePrivateRequest(urlBase+urlPath, "POST", payload, apiKey, signature)
+	balances, err := kraken.GetAllBalances(balanceBody)
 	if err != nil {
-		fmt.Printf("Error making request: %v\n", err)
+		fmt.Printf("Error parsing account balance: %v\n", err)
 		os.Exit(1)
 	}
 
-	fmt.Println("Account balance:")
-	fmt.Println(string(balanceBody))
+	// USD values are a nice-to-have, the balances are printed without them if prices are unavailable
+	values := map[string]portfolio.Holding{}
+	valuation, err := portfolio.Value(ctx, balances)
+	if err != nil {
+		fmt.Printf("Warning: USD values unavailable: %v\n", err)
+	} else {
+		for _, h := range valuation.Holdings {
+			values[h.Asset] = h
+		}
+	}
+
+	codes := make([]string, 0, len(balances))
+	for code, b := range balances {
+		if *hideZero && b.Total == 0 {
+			continue
+		}
+		codes = append(codes, code)
+	}
+	sort.Slice(codes, func(i, j int) bool {
+		if *sortBy == "value" && values[codes[i]].ValueUSD != values[codes[j]].ValueUSD {
+			return values[codes[i]].ValueUSD > values[codes[j]].ValueUSD
+		}
+		return codes[i] < codes[j]
+	})
 
+	fmt.Println("Account balance:")
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintf(w, "ASSET\tBALANCE\tHOLD\tAVAILABLE\tUSD VALUE\t\n")
+	total := 0.0
+	for _, code := range codes {
+		b := balances[code]
+		value := "-"
+		if h, ok := values[code]; ok && h.Priced {
+			value = money.Format(h.ValueUSD, "USD")
+			total += h.ValueUSD
+		}
+		fmt.Fprintf(w, "%s\t%.8f\t%.8f\t%.8f\t%s\t\n", code, b.Total, b.Hold, b.Available, value)
+	}
+	if valuation != nil {
+		fmt.Fprintf(w, "TOTAL\t\t\t\t%s\t\n", money.Format(total, "USD"))
+	}
+	w.Flush()
 }
@@ -3,13 +3,20 @@
 package main
 
 import (
+	"context"
+	"encoding/csv"
 	"encoding/json"
+	"flag"
 	"fmt"
 	"io"
-	"net/http"
+	"os"
 	"sort"
 	"strconv"
 	"strings"
+
+	"github.com/jkosik/crypto-trader/internal/config"
+	"github.com/jkosik/crypto-trader/internal/kraken"
+	"github.com/jkosik/crypto-trader/internal/scanner"
 )
 
 // Parameters
@@ -19,131 +26,149 @@ const (
 	TopPairsCount = 10        // Number of top pairs to show in each category
 )
 
-// ScannerTickerResponse represents the response from the Kraken API ticker endpoint
-type ScannerTickerResponse struct {
-	Error  []string                       `json:"error"`
-	Result map[string]ScannerTickerResult `json:"result"`
-}
-
-// ScannerTickerResult represents the ticker data for a specific trading pair
-type ScannerTickerResult struct {
-	Ask  []string `json:"a"` // Ask price and volume
-	Bid  []string `json:"b"` // Bid price and volume
-	High []string `json:"h"` // High price
-	Low  []string `json:"l"` // Low price
-	Vol  []string `json:"v"` // Volume
-}
-
-// TradingPair represents a trading pair with its metrics
-type TradingPair struct {
-	Pair      string
-	AskPrice  float64
-	BidPrice  float64
-	Spread    float64
-	SpreadPct float64
-	Volume24h float64
-	VolumeUSD float64
-}
+// info receives everything but the results, stderr with -format json or csv so stdout can be piped
+var info io.Writer = os.Stdout
 
 func main() {
-	fmt.Printf("Scanning for trading pairs with:\n")
-	fmt.Printf("- Minimum 24h volume: $%.0f USD\n", MinVolumeUSD)
-	fmt.Printf("- Minimum spread: %.1f%%\n", MinSpreadPct)
-	fmt.Printf("- Showing top %d pairs in each category\n\n", TopPairsCount)
-
-	scanPairs()
-}
+	depth := flag.Bool("depth", false, "Enrich pairs with order book depth (one request per pair)")
+	workers := flag.Int("workers", 4, "Number of concurrent depth requests")
+	configPath := flag.String("config", "", "Path to a YAML config file with scanner score weights")
+	triangles := flag.Bool("triangles", false, "Scan for triangular arbitrage from USD through two other assets instead of ranking pairs")
+	takerFee := flag.Float64("takerfee", 0.40, "Taker fee percentage of your fee tier, paid on every triangle leg")
+	execute := flag.Bool("execute", false, "Trade the best triangle if it clears -minprofit (needs KRAKEN_API_KEY and KRAKEN_PRIVATE_KEY)")
+	usd := flag.Float64("usd", 100, "USD traded around the triangle with -execute")
+	minProfit := flag.Float64("minprofit", 0.1, "Minimum round-trip profit after fees in percent for -execute")
+	format := flag.String("format", "table", "Output format: table, or json or csv with every pair (or triangle) for other tools")
+	makerFee := flag.Float64("makerfee", 0, "Maker fee percentage paid on both legs of the net edge (default scanner.maker_fee_percent)")
+	quote := flag.String("quote", "USD", "Quote currency of the scanned pairs, e.g. USD, EUR or USDT")
+	minPrice := flag.Float64("minprice", 0, "Skip pairs whose bid is below this price in the quote currency (default scanner.min_price)")
+	noStable := flag.Bool("nostable", false, "Skip pairs whose base is a stablecoin or fiat currency (default scanner.exclude_stablecoins)")
+	noDarkPool := flag.Bool("nodarkpool", false, "Skip dark pool (.d) pairs instead of listing them separately")
+	include := flag.String("include", "", "Comma-separated base coins to scan, all others are skipped (default scanner.include)")
+	exclude := flag.String("exclude", "", "Comma-separated base coins to skip (default scanner.exclude)")
+	flag.Parse()
 
-// makePublicRequest makes a request to Kraken's public API endpoints
-func makePublicRequest(url string, method string) ([]byte, error) {
-	client := &http.Client{}
-	req, err := http.NewRequest(method, url, nil)
-	if err != nil {
-		return nil, fmt.Errorf("error creating request: %v", err)
+	switch *format {
+	case "table":
+	case "json", "csv":
+		info = os.Stderr
+	default:
+		fmt.Fprintf(info, "Error: unknown -format %q, use table, json or csv\n", *format)
+		os.Exit(2)
 	}
 
-	req.Header.Add("Accept", "application/json")
-
-	resp, err := client.Do(req)
+	cfg, err := config.Load(*configPath)
 	if err != nil {
-		return nil, fmt.Errorf("error making request: %v", err)
+		fmt.Fprintf(info, "Error loading config: %v\n", err)
+		os.Exit(1)
 	}
-	defer resp.Body.Close()
 
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, fmt.Errorf("error reading response: %v", err)
+	if *triangles {
+		if err := scanTriangles(*format, *takerFee, *execute, *usd, *minProfit); err != nil {
+			fmt.Fprintf(info, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		return
 	}
 
-	return body, nil
-}
-
-func scanPairs() {
-	// Get all trading pairs
-	url := "https://api.kraken.com/0/public/Ticker"
-	body, err := makePublicRequest(url, "GET")
-	if err != nil {
-		fmt.Printf("Error getting ticker data: %v\n", err)
-		return
+	// Flags given explicitly override the scanner section of the config
+	opts := scanner.Options{
+		MinVolumeUSD:  MinVolumeUSD,
+		MinSpreadPct:  MinSpreadPct,
+		Depth:         *depth,
+		Workers:       *workers,
+		Weights:       cfg.Scanner.ScoreWeights,
+		MakerFeePct:   cfg.Scanner.MakerFeePercent,
+		Quote:         strings.ToUpper(*quote),
+		MinPrice:      cfg.Scanner.MinPrice,
+		ExcludeStable: cfg.Scanner.ExcludeStablecoins,
+		ExcludeDark:   *noDarkPool,
+		Include:       cfg.Scanner.Include,
+		Exclude:       cfg.Scanner.Exclude,
+		Progress:      printProgress,
 	}
+	flag.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "makerfee":
+			opts.MakerFeePct = *makerFee
+		case "minprice":
+			opts.MinPrice = *minPrice
+		case "nostable":
+			opts.ExcludeStable = *noStable
+		case "include":
+			opts.Include = splitCoins(*include)
+		case "exclude":
+			opts.Exclude = splitCoins(*exclude)
+		}
+	})
 
-	var response ScannerTickerResponse
-	if err := json.Unmarshal(body, &response); err != nil {
-		fmt.Printf("Error parsing ticker response: %v\n", err)
-		return
+	fmt.Fprintf(info, "Scanning for trading pairs with:\n")
+	fmt.Fprintf(info, "- Quote currency: %s\n", opts.Quote)
+	fmt.Fprintf(info, "- Minimum 24h volume: %.0f %s\n", MinVolumeUSD, opts.Quote)
+	fmt.Fprintf(info, "- Minimum spread: %.1f%%\n", MinSpreadPct)
+	if opts.MinPrice > 0 {
+		fmt.Fprintf(info, "- Minimum price: %g %s\n", opts.MinPrice, opts.Quote)
+	}
+	if opts.ExcludeStable {
+		fmt.Fprintf(info, "- Excluding stablecoins and fiat currencies\n")
 	}
+	if len(opts.Include) > 0 {
+		fmt.Fprintf(info, "- Only: %s\n", strings.Join(opts.Include, ", "))
+	}
+	if len(opts.Exclude) > 0 {
+		fmt.Fprintf(info, "- Excluding: %s\n", strings.Join(opts.Exclude, ", "))
+	}
+	if *format == "table" {
+		fmt.Printf("- Showing top %d pairs in each category\n", TopPairsCount)
+	}
+	fmt.Fprintln(info)
 
-	if len(response.Error) > 0 {
-		fmt.Printf("API error: %v\n", response.Error)
-		return
+	if err := scanPairs(*format, opts); err != nil {
+		fmt.Fprintf(info, "Error: %v\n", err)
+		os.Exit(1)
 	}
+}
 
-	// Process each trading pair
-	var pairs []TradingPair
-	for pair, data := range response.Result {
-		// Skip pairs that don't have USD as quote currency
-		if !strings.HasSuffix(pair, "USD") {
-			continue
+// scanPairs prints the top pairs by spread, volume and score, the pairs passing both thresholds
+// and the dark pool pairs, or every pair with json or csv
+func scanPairs(format string, opts scanner.Options) error {
+	weights := opts.Weights
+	result, err := scanner.Scan(context.Background(), opts)
+	if err != nil {
+		return err
+	}
+	if opts.Depth {
+		fmt.Fprintln(os.Stderr)
+		if result.DepthFailed > 0 {
+			fmt.Fprintf(info, "Warning: Depth unavailable for %d pairs\n", result.DepthFailed)
 		}
-
-		// Parse prices and volume
-		askPrice, _ := strconv.ParseFloat(data.Ask[0], 64)
-		bidPrice, _ := strconv.ParseFloat(data.Bid[0], 64)
-		volume24h, _ := strconv.ParseFloat(data.Vol[1], 64) // 24h volume
-
-		// Calculate metrics
-		spread := askPrice - bidPrice
-		spreadPct := (spread / bidPrice) * 100
-		volumeUSD := volume24h * bidPrice // Approximate USD volume
-
-		pairs = append(pairs, TradingPair{
-			Pair:      pair,
-			AskPrice:  askPrice,
-			BidPrice:  bidPrice,
-			Spread:    spread,
-			SpreadPct: spreadPct,
-			Volume24h: volume24h,
-			VolumeUSD: volumeUSD,
-		})
 	}
+	switch format {
+	case "json":
+		return writePairsJSON(result, weights)
+	case "csv":
+		return writePairsCSV(result)
+	}
+	pairs, darkPoolPairs := result.Pairs, result.DarkPool
 
-	// Sort by spread percentage (descending)
+	// Sort by net edge per hour (descending), a wide spread nobody trades at is no opportunity
 	sort.Slice(pairs, func(i, j int) bool {
-		return pairs[i].SpreadPct > pairs[j].SpreadPct
+		return pairs[i].EdgePerHour > pairs[j].EdgePerHour
 	})
 
-	// Print top 10 pairs with highest spread
-	fmt.Println("\nTop 10 Trading Pairs by Spread Percentage:")
+	// Print top 10 pairs with the highest net edge per hour
+	fmt.Printf("\nTop %d Trading Pairs by Net Edge per Hour after 2x %.2f%% Maker Fee:\n", TopPairsCount, opts.MakerFeePct)
 	fmt.Println("=========================================")
-	fmt.Printf("%-10s %-12s %-12s %-12s %-12s\n", "Pair", "Spread %", "Spread $", "24h Vol", "USD Vol")
+	fmt.Printf("%-10s %-12s %-12s %-12s %-12s %-12s\n", "Pair", "Edge %/h", "Net Edge %", "Fills/h", "Spread %", "USD Vol")
 	fmt.Println("-----------------------------------------")
 
-	for _, pair := range pairs[:10] {
-		fmt.Printf("%-10s %-12.4f %-12.4f %-12.2f %-12.2f\n",
+	for _, pair := range pairs[:min(TopPairsCount, len(pairs))] {
+		fmt.Printf("%-10s %-12.4f %-12.4f %-12.1f %-12.4f %-12.2f\n",
 			pair.Pair,
+			pair.EdgePerHour,
+			pair.NetEdgePct,
+			pair.FillsPerHour,
 			pair.SpreadPct,
-			pair.Spread,
-			pair.Volume24h,
 			pair.VolumeUSD)
 	}
 
@@ -158,7 +183,7 @@ func scanPairs() {
 	fmt.Printf("%-10s %-12s %-12s %-12s %-12s\n", "Pair", "Spread %", "Spread $", "24h Vol", "USD Vol")
 	fmt.Println("-----------------------------------")
 
-	for _, pair := range pairs[:10] {
+	for _, pair := range pairs[:min(TopPairsCount, len(pairs))] {
 		fmt.Printf("%-10s %-12.4f %-12.4f %-12.2f %-12.2f\n",
 			pair.Pair,
 			pair.SpreadPct,
@@ -174,13 +199,217 @@ func scanPairs() {
 	fmt.Println("---------------------------------------------------")
 
 	for _, pair := range pairs {
-		if pair.VolumeUSD > MinVolumeUSD && pair.SpreadPct > MinSpreadPct {
-			fmt.Printf("%-10s %-12.4f %-12.4f %-12.2f %-12.2f\n",
+		if result.Qualifies(pair) {
+			fmt.Printf("%-10s %-12.4f %-12.4f %-12.2f %-12.2f",
 				pair.Pair,
 				pair.SpreadPct,
 				pair.Spread,
 				pair.Volume24h,
 				pair.VolumeUSD)
+			if opts.Depth {
+				fmt.Printf(" bid depth $%-12.2f ask depth $%-12.2f", pair.BidDepth, pair.AskDepth)
+			}
+			fmt.Println()
 		}
 	}
+
+	// Sort by configured score (descending)
+	sort.Slice(pairs, func(i, j int) bool {
+		return pairs[i].Score > pairs[j].Score
+	})
+
+	fmt.Printf("\nTop %d Trading Pairs by Score %s:\n", TopPairsCount, scanner.FormatWeights(weights))
+	fmt.Println("=========================================")
+	fmt.Printf("%-10s %-12s %-12s %-12s %-12s\n", "Pair", "Score", "Spread %", "Volatility %", "USD Vol")
+	fmt.Println("-----------------------------------------")
+
+	for _, pair := range pairs[:min(TopPairsCount, len(pairs))] {
+		fmt.Printf("%-10s %-12.4f %-12.4f %-12.2f %-12.2f\n",
+			pair.Pair,
+			pair.Score,
+			pair.SpreadPct,
+			pair.VolatilityPct,
+			pair.VolumeUSD)
+	}
+
+	// Report dark pool volume separately, it is excluded from all rankings above
+	if len(darkPoolPairs) > 0 {
+		sort.Slice(darkPoolPairs, func(i, j int) bool {
+			return darkPoolPairs[i].VolumeUSD > darkPoolPairs[j].VolumeUSD
+		})
+
+		fmt.Println("\nDark Pool Pairs (excluded from rankings):")
+		fmt.Println("=========================================")
+		fmt.Printf("%-10s %-12s %-12s\n", "Pair", "24h Vol", "USD Vol")
+		fmt.Println("-----------------------------------------")
+
+		for _, pair := range darkPoolPairs {
+			fmt.Printf("%-10s %-12.2f %-12.2f\n",
+				pair.Pair,
+				pair.Volume24h,
+				pair.VolumeUSD)
+		}
+	}
+	return nil
+}
+
+// pairRecord is a pair of the JSON output
+type pairRecord struct {
+	scanner.Pair
+	Qualifies bool `json:"qualifies"`
+}
+
+// writePairsJSON prints the scan as one JSON document, pairs best score first
+func writePairsJSON(result *scanner.Result, weights map[string]float64) error {
+	sort.Slice(result.Pairs, func(i, j int) bool { return result.Pairs[i].Score > result.Pairs[j].Score })
+	sort.Slice(result.DarkPool, func(i, j int) bool { return result.DarkPool[i].VolumeUSD > result.DarkPool[j].VolumeUSD })
+
+	pairs := make([]pairRecord, len(result.Pairs))
+	for i, pair := range result.Pairs {
+		pairs[i] = pairRecord{Pair: pair, Qualifies: result.Qualifies(pair)}
+	}
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(map[string]interface{}{
+		"min_volume_usd": MinVolumeUSD,
+		"min_spread_pct": MinSpreadPct,
+		"score_weights":  weights,
+		"pairs":          pairs,
+		"dark_pool":      result.DarkPool,
+	})
+}
+
+// writePairsCSV prints every pair as a CSV row, best score first, the dark pool pairs last
+func writePairsCSV(result *scanner.Result) error {
+	sort.Slice(result.Pairs, func(i, j int) bool { return result.Pairs[i].Score > result.Pairs[j].Score })
+	sort.Slice(result.DarkPool, func(i, j int) bool { return result.DarkPool[i].VolumeUSD > result.DarkPool[j].VolumeUSD })
+
+	writer := csv.NewWriter(os.Stdout)
+	writer.Write([]string{"pair", "ask", "bid", "spread", "spread_pct", "volume_24h", "volume_usd", "bid_depth_usd", "ask_depth_usd", "volatility_pct", "score", "trades_24h", "fills_per_hour", "net_edge_pct", "edge_per_hour", "qualifies", "dark_pool"})
+	row := func(pair scanner.Pair, qualifies bool, darkPool bool) {
+		writer.Write([]string{pair.Pair, formatFloat(pair.AskPrice), formatFloat(pair.BidPrice), formatFloat(pair.Spread),
+			formatFloat(pair.SpreadPct), formatFloat(pair.Volume24h), formatFloat(pair.VolumeUSD), formatFloat(pair.BidDepth),
+			formatFloat(pair.AskDepth), formatFloat(pair.VolatilityPct), formatFloat(pair.Score), strconv.Itoa(pair.Trades24h), formatFloat(pair.FillsPerHour),
+			formatFloat(pair.NetEdgePct), formatFloat(pair.EdgePerHour), strconv.FormatBool(qualifies), strconv.FormatBool(darkPool)})
+	}
+	for _, pair := range result.Pairs {
+		row(pair, result.Qualifies(pair), false)
+	}
+	for _, pair := range result.DarkPool {
+		row(pair, false, true)
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+// writeTriangles prints every triangle, best net profit first, as JSON or CSV
+func writeTriangles(format string, triangles []kraken.Triangle) error {
+	if format == "json" {
+		records := make([]map[string]interface{}, len(triangles))
+		for i, t := range triangles {
+			records[i] = map[string]interface{}{
+				"path":          t.Path(),
+				"gross_percent": t.GrossPercent,
+				"net_percent":   t.NetPercent,
+				"pairs":         []string{t.Legs[0].Pair.Altname, t.Legs[1].Pair.Altname, t.Legs[2].Pair.Altname},
+			}
+		}
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(records)
+	}
+
+	writer := csv.NewWriter(os.Stdout)
+	writer.Write([]string{"path", "gross_percent", "net_percent", "pair1", "pair2", "pair3"})
+	for _, t := range triangles {
+		writer.Write([]string{t.Path(), formatFloat(t.GrossPercent), formatFloat(t.NetPercent),
+			t.Legs[0].Pair.Altname, t.Legs[1].Pair.Altname, t.Legs[2].Pair.Altname})
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+// formatFloat formats a number without rounding for machine-readable output
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
+
+// scanTriangles prints the most profitable round trips from USD through two other assets after
+// three taker fees and, with execute, trades the best one if it clears minProfit
+func scanTriangles(format string, takerFee float64, execute bool, usd float64, minProfit float64) error {
+	ctx := context.Background()
+	pairs, err := kraken.LoadAssetPairs(ctx)
+	if err != nil {
+		return err
+	}
+	tops, err := kraken.GetBookTops(ctx)
+	if err != nil {
+		return err
+	}
+	triangles := kraken.FindTriangles(pairs, tops, "ZUSD", takerFee)
+
+	if format != "table" {
+		if err := writeTriangles(format, triangles); err != nil {
+			return err
+		}
+	} else {
+		printTriangles(triangles, takerFee)
+	}
+
+	if !execute {
+		return nil
+	}
+	if len(triangles) == 0 || triangles[0].NetPercent < minProfit {
+		fmt.Fprintf(info, "No triangle clears %.2f%% after fees, nothing traded\n", minProfit)
+		return nil
+	}
+	if os.Getenv("KRAKEN_API_KEY") == "" || os.Getenv("KRAKEN_PRIVATE_KEY") == "" {
+		return fmt.Errorf("KRAKEN_API_KEY and KRAKEN_PRIVATE_KEY environment variables must be set for -execute")
+	}
+	best := triangles[0]
+	fmt.Fprintf(info, "\nTrading %.2f USD around %s (%.4f%% after fees at the scanned prices)\n", usd, best.Path(), best.NetPercent)
+	fills, err := kraken.ExecuteTriangle(ctx, &best, usd, takerFee, kraken.UserRef(best.Path()))
+	for i, fill := range fills {
+		fmt.Fprintf(info, "Leg %d %s: %s, %s executed, received %.8f %s\n", i+1, fill.Leg.Pair.Altname, fill.Status,
+			fill.Leg.Pair.FormatVolume(fill.Volume), fill.Received, fill.Leg.ToName())
+	}
+	if err != nil {
+		return fmt.Errorf("triangle stopped: %v", err)
+	}
+	fmt.Fprintf(info, "Round trip done: %.2f USD -> %.2f USD\n", usd, fills[len(fills)-1].Received)
+	return nil
+}
+
+// printTriangles prints the top triangles as a table
+func printTriangles(triangles []kraken.Triangle, takerFee float64) {
+	fmt.Printf("\nTop %d Triangles by Round-Trip Profit after %.2f%% Taker Fee per Leg:\n", TopPairsCount, takerFee)
+	fmt.Println("=========================================")
+	fmt.Printf("%-28s %-12s %-12s %s\n", "Path", "Gross %", "Net %", "Pairs")
+	fmt.Println("-----------------------------------------")
+	for _, t := range triangles[:min(TopPairsCount, len(triangles))] {
+		fmt.Printf("%-28s %-12.4f %-12.4f %s %s %s\n", t.Path(), t.GrossPercent, t.NetPercent,
+			t.Legs[0].Pair.Altname, t.Legs[1].Pair.Altname, t.Legs[2].Pair.Altname)
+	}
+	fmt.Printf("\n%d triangles scanned\n", len(triangles))
+}
+
+// splitCoins splits a comma-separated list of coins
+func splitCoins(list string) []string {
+	var coins []string
+	for _, coin := range strings.Split(list, ",") {
+		if coin = strings.TrimSpace(coin); coin != "" {
+			coins = append(coins, strings.ToUpper(coin))
+		}
+	}
+	return coins
+}
+
+// printProgress draws a progress bar on stderr, keeping stdout clean for results
+func printProgress(done int, total int) {
+	const width = 30
+	filled := 0
+	if total > 0 {
+		filled = done * width / total
+	}
+	fmt.Fprintf(os.Stderr, "\rEnriching depth [%s%s] %d/%d", strings.Repeat("#", filled), strings.Repeat(" ", width-filled), done, total)
 }
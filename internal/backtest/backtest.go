@@ -0,0 +1,171 @@
+// Package backtest simulates the spread strategy on historical data: bid/ask snapshots decide
+// when and where orders are placed, 1-minute candles decide when they fill.
+package backtest
+
+import (
+	"sort"
+	"time"
+
+	"github.com/jkosik/crypto-trader/internal/kraken"
+)
+
+// Params are the strategy and fee model settings of a backtest run
+type Params struct {
+	MinSpreadPercent    float64       // only trade when the spread is at least this wide
+	MinNetProfitPercent float64       // only trade when the profit after both legs' maker fees is at least this, % of the buy cost
+	NarrowFactor        float64       // spread narrowing, same as the trader's spread_narrow_factor
+	Volume              float64       // base coin volume per trade
+	MakerFeePercent     float64       // fee of the limit orders
+	TakerFeePercent     float64       // fee of closing a stuck leg at market
+	MaxHold             time.Duration // give up waiting for the second leg after this long
+	Cooldown            time.Duration // pause between trades, like the loop's loop_delay
+}
+
+// Trade outcomes
+const (
+	Complete = "complete" // both legs filled
+	TimedOut = "timeout"  // MaxHold ran out, a one-sided fill was closed at market
+	Unfilled = "unfilled" // MaxHold ran out without any fill, both orders canceled
+	Open     = "open"     // the data ended first, a one-sided fill is marked to the last close
+)
+
+// Trade is a simulated spread trade
+type Trade struct {
+	PlacedAt   time.Time
+	ClosedAt   time.Time
+	Outcome    string
+	BuyPrice   float64
+	SellPrice  float64
+	BuyFilled  bool
+	SellFilled bool
+	ExitPrice  float64 // market price a one-sided fill was closed or marked at
+	Fees       float64
+	Net        float64
+}
+
+// Result summarizes a backtest run
+type Result struct {
+	Params   Params
+	Trades   []Trade
+	Outcomes map[string]int
+	Wins     int
+	Fees     float64
+	Net      float64
+}
+
+// WinRate returns the share of profitable trades in percent
+func (r *Result) WinRate() float64 {
+	if len(r.Trades) == 0 {
+		return 0
+	}
+	return float64(r.Wins) / float64(len(r.Trades)) * 100
+}
+
+// Run simulates the strategy. Orders are placed at the narrowed prices of the first quote
+// passing the spread and net profit gates; a buy fills once a later candle trades below its price, a sell once
+// one trades above it. Touching the price isn't enough since the queue ahead would fill first.
+// Like the trader, a trade waits for both legs unless MaxHold is set. pair is optional and
+// rounds prices like the exchange would.
+func Run(quotes []kraken.SpreadSnapshot, candles []kraken.OHLCData, params Params, pair *kraken.AssetPair) *Result {
+	sort.Slice(quotes, func(i, j int) bool { return quotes[i].Time.Before(quotes[j].Time) })
+	sort.Slice(candles, func(i, j int) bool { return candles[i].Time < candles[j].Time })
+
+	result := &Result{Params: params, Outcomes: map[string]int{}}
+	nextAllowed := time.Time{}
+
+	for _, q := range quotes {
+		if q.Time.Before(nextAllowed) || q.Bid <= 0 || q.Ask <= q.Bid {
+			continue
+		}
+		if (q.Ask-q.Bid)/q.Bid*100 < params.MinSpreadPercent {
+			continue
+		}
+
+		buy, sell := kraken.NarrowSpread(q.Bid, q.Ask, params.NarrowFactor)
+		if pair != nil {
+			buy, sell = pair.RoundPrice(buy), pair.RoundPrice(sell)
+		}
+		if sell <= buy {
+			continue
+		}
+		if _, _, net := kraken.SpreadNetProfit(buy, sell, params.Volume, params.MakerFeePercent); net/(buy*params.Volume)*100 < params.MinNetProfitPercent {
+			continue
+		}
+
+		trade := simulate(q.Time, buy, sell, candles, params)
+		result.Trades = append(result.Trades, trade)
+		result.Outcomes[trade.Outcome]++
+		if trade.Net > 0 {
+			result.Wins++
+		}
+		result.Fees += trade.Fees
+		result.Net += trade.Net
+
+		if trade.Outcome == Open {
+			// No data left to place further trades after this one
+			break
+		}
+		nextAllowed = trade.ClosedAt.Add(params.Cooldown)
+	}
+
+	return result
+}
+
+// simulate walks the candles after placement until both legs fill or MaxHold runs out
+func simulate(placedAt time.Time, buy float64, sell float64, candles []kraken.OHLCData, params Params) Trade {
+	trade := Trade{PlacedAt: placedAt, BuyPrice: buy, SellPrice: sell}
+	maker := params.MakerFeePercent / 100
+	taker := params.TakerFeePercent / 100
+	deadline := placedAt.Add(params.MaxHold)
+
+	start := sort.Search(len(candles), func(i int) bool { return time.Unix(candles[i].Time, 0).After(placedAt) })
+	lastClose := (buy + sell) / 2
+	for _, c := range candles[start:] {
+		t := time.Unix(c.Time, 0)
+		if params.MaxHold > 0 && t.After(deadline) {
+			trade.ClosedAt = deadline
+			closeOneSided(&trade, lastClose, maker, taker, params.Volume, TimedOut)
+			return trade
+		}
+		lastClose = c.Close
+		if !trade.BuyFilled && c.Low < buy {
+			trade.BuyFilled = true
+		}
+		if !trade.SellFilled && c.High > sell {
+			trade.SellFilled = true
+		}
+		if trade.BuyFilled && trade.SellFilled {
+			trade.Outcome = Complete
+			trade.ClosedAt = t
+			trade.Fees = (buy + sell) * params.Volume * maker
+			trade.Net = (sell-buy)*params.Volume - trade.Fees
+			return trade
+		}
+	}
+
+	// The data ended while waiting, mark the position to the last close without exit fees
+	if len(candles) > 0 {
+		trade.ClosedAt = time.Unix(candles[len(candles)-1].Time, 0)
+	}
+	closeOneSided(&trade, lastClose, maker, 0, params.Volume, Open)
+	return trade
+}
+
+// closeOneSided settles a trade with at most one filled leg at the exit price
+func closeOneSided(trade *Trade, exitPrice float64, maker float64, taker float64, volume float64, outcome string) {
+	trade.Outcome = outcome
+	switch {
+	case trade.BuyFilled:
+		trade.ExitPrice = exitPrice
+		trade.Fees = trade.BuyPrice*volume*maker + exitPrice*volume*taker
+		trade.Net = (exitPrice-trade.BuyPrice)*volume - trade.Fees
+	case trade.SellFilled:
+		trade.ExitPrice = exitPrice
+		trade.Fees = trade.SellPrice*volume*maker + exitPrice*volume*taker
+		trade.Net = (trade.SellPrice-exitPrice)*volume - trade.Fees
+	default:
+		if outcome == TimedOut {
+			trade.Outcome = Unfilled
+		}
+	}
+}
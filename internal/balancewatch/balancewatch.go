@@ -0,0 +1,195 @@
+// Package balancewatch polls the account balances behind `trader watch` and reports significant
+// changes, telling the bot's own trades apart from activity it didn't initiate (deposits,
+// withdrawals, trades placed elsewhere).
+package balancewatch
+
+import (
+	"context"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/jkosik/crypto-trader/internal/kraken"
+	"github.com/jkosik/crypto-trader/internal/logging"
+)
+
+// ledgerMargin widens the ledger lookup so entries timestamped by a skewed clock aren't missed
+const ledgerMargin = time.Minute
+
+// Change is a significant change of an asset's total balance between two polls
+type Change struct {
+	Asset    string
+	Previous float64
+	Current  float64
+	Delta    float64
+	Sources  []string // ledger entry types behind the change, e.g. deposit or trade
+	External bool     // not explained by orders the bot placed
+}
+
+// Options tune the watcher
+type Options struct {
+	Interval         time.Duration // time between polls
+	MinChangePercent float64       // ignore changes smaller than this share of the previous balance
+	// OwnOrder reports whether an order was placed by the bot, trades of other orders are external.
+	// Nil treats every trade as external.
+	OwnOrder func(txid string) bool
+}
+
+// DefaultOptions are used by `trader watch` unless overridden by flags
+var DefaultOptions = Options{
+	Interval:         time.Minute,
+	MinChangePercent: 1.0,
+}
+
+// Watcher tracks the balances seen by the last poll
+type Watcher struct {
+	opts     Options
+	balances map[string]kraken.Balance
+	polledAt time.Time
+}
+
+// New returns a watcher, the first poll only records the starting balances
+func New(opts Options) *Watcher {
+	return &Watcher{opts: opts}
+}
+
+// Run polls until the context is canceled, calling notify for every significant change.
+// Failed polls are logged and retried on the next tick.
+func (w *Watcher) Run(ctx context.Context, notify func(Change)) error {
+	log := logging.FromContext(ctx)
+	ticker := time.NewTicker(w.opts.Interval)
+	defer ticker.Stop()
+
+	for {
+		changes, err := w.Poll(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			log.Warn("Failed to poll balances", "error", err)
+		}
+		for _, change := range changes {
+			notify(change)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// Poll fetches the balances and returns the significant changes since the previous poll
+func (w *Watcher) Poll(ctx context.Context) ([]Change, error) {
+	polledAt := time.Now()
+	body, err := kraken.GetAccountBalance(ctx)
+	if err != nil {
+		return nil, err
+	}
+	balances, err := kraken.GetAllBalances(body)
+	if err != nil {
+		return nil, err
+	}
+
+	previous, since := w.balances, w.polledAt
+	w.balances, w.polledAt = balances, polledAt
+	if previous == nil {
+		return nil, nil
+	}
+
+	var changes []Change
+	for _, asset := range assets(previous, balances) {
+		before, after := previous[asset].Total, balances[asset].Total
+		if !w.significant(before, after) {
+			continue
+		}
+		changes = append(changes, Change{Asset: asset, Previous: before, Current: after, Delta: after - before, External: true})
+	}
+	if len(changes) == 0 {
+		return nil, nil
+	}
+
+	w.attribute(ctx, changes, since.Add(-ledgerMargin))
+	return changes, nil
+}
+
+// significant reports whether a balance change passes the MinChangePercent threshold.
+// Any change from or to zero is significant.
+func (w *Watcher) significant(before float64, after float64) bool {
+	if before == after {
+		return false
+	}
+	if before == 0 || after == 0 {
+		return true
+	}
+	return math.Abs(after-before)/math.Abs(before)*100 >= w.opts.MinChangePercent
+}
+
+// attribute fills in the ledger sources of the changes and clears External for changes made up
+// entirely of trades of the bot's own orders. Changes stay external if the ledger can't be read.
+func (w *Watcher) attribute(ctx context.Context, changes []Change, since time.Time) {
+	log := logging.FromContext(ctx)
+
+	entries, err := kraken.GetLedgers(ctx, since, time.Time{})
+	if err != nil {
+		log.Warn("Failed to get ledger entries, treating balance changes as external", "error", err)
+		return
+	}
+
+	// Ledger entries of trades reference the execution, its order is in the trades history
+	orderOf := map[string]string{}
+	for _, entry := range entries {
+		if entry.Type == "trade" {
+			trades, err := kraken.GetTradesHistory(ctx, since, time.Time{})
+			if err != nil {
+				log.Warn("Failed to get trades history, treating trades as external", "error", err)
+				break
+			}
+			for _, trade := range trades {
+				orderOf[trade.TxID] = trade.OrderTxID
+			}
+			break
+		}
+	}
+
+	for i := range changes {
+		change := &changes[i]
+		total, own := 0, 0
+		seen := map[string]bool{}
+		for _, entry := range entries {
+			if entry.Asset != change.Asset {
+				continue
+			}
+			total++
+			if !seen[entry.Type] {
+				seen[entry.Type] = true
+				change.Sources = append(change.Sources, entry.Type)
+			}
+			if entry.Type == "trade" && w.opts.OwnOrder != nil {
+				if orderTxID, ok := orderOf[entry.RefID]; ok && w.opts.OwnOrder(orderTxID) {
+					own++
+				}
+			}
+		}
+		sort.Strings(change.Sources)
+		// A change without ledger entries is unexplained and stays external
+		change.External = total == 0 || own < total
+	}
+}
+
+// assets returns the asset codes present in either balance map, sorted
+func assets(a map[string]kraken.Balance, b map[string]kraken.Balance) []string {
+	seen := map[string]bool{}
+	var codes []string
+	for _, m := range []map[string]kraken.Balance{a, b} {
+		for code := range m {
+			if !seen[code] {
+				seen[code] = true
+				codes = append(codes, code)
+			}
+		}
+	}
+	sort.Strings(codes)
+	return codes
+}
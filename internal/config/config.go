@@ -0,0 +1,662 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+	// Time zone rules for timezone, hosts and containers without a zoneinfo database included
+	_ "time/tzdata"
+
+	"github.com/jkosik/crypto-trader/internal/money"
+	"github.com/jkosik/crypto-trader/internal/numparse"
+	"gopkg.in/yaml.v3"
+)
+
+// Config holds the trading parameters shared by cmd/trader and cmd/loop.
+// Values are resolved in order: defaults, config file, environment variables.
+// Command line flags override all of them.
+type Config struct {
+	MinSpreadPercent        float64       `yaml:"min_spread_percent"`        // Minimum spread percentage required to place orders
+	MinVolume24h            float64       `yaml:"min_volume_24h"`            // Minimum 24h volume in USD required to place orders
+	MinNetProfitPercent     float64       `yaml:"min_net_profit_percent"`    // Minimum expected profit after both legs' fees, % of the buy cost
+	SpreadNarrowFactor      float64       `yaml:"spread_narrow_factor"`      // How much to narrow the spread (0.0 to 1.0)
+	MaxParticipationPercent float64       `yaml:"max_participation_percent"` // Max trade volume as % of 24h volume (0 disables)
+	SpreadCheckInterval     time.Duration `yaml:"spread_check_interval"`     // Sleep between spread/volume checks
+	SpreadTimeout           time.Duration `yaml:"spread_timeout"`            // Give up waiting for spread/volume after this long (0 = wait forever)
+	StatusCheckInterval     time.Duration `yaml:"status_check_interval"`     // Sleep between order status checks
+	LegTimeout              time.Duration `yaml:"leg_timeout"`               // Reprice the open leg this long after the other one filled (0 = wait forever)
+	RepriceInterval         time.Duration `yaml:"reprice_interval"`          // Wait between reprices of a stalled leg
+	RepriceStep             float64       `yaml:"reprice_step"`              // Fraction of the distance to the other side of the book moved per reprice
+	MaxLossPercent          float64       `yaml:"max_loss_percent"`          // Worst stalled leg price, % below the filled buy (above the filled sell)
+	ReconcilePartialFills   bool          `yaml:"reconcile_partial_fills"`   // Shrink the open leg to the volume a partially filled, finished leg executed
+	TimeInForce             string        `yaml:"time_in_force"`             // GTC, IOC or GTD (expires after order_expiry)
+	OrderExpiry             time.Duration `yaml:"order_expiry"`              // GTD orders expire on the exchange this long after placement
+	Leverage                int           `yaml:"leverage"`                  // Trade on margin with this leverage, e.g. 2 for 2:1 (0 trades spot)
+	CloseOrderType          string        `yaml:"close_order_type"`          // Conditional close attached to every order: stop-loss, take-profit or their -limit variants ("" disables)
+	ClosePercent            float64       `yaml:"close_percent"`             // Distance of the conditional close's trigger from the order's price, in %
+	DeadManTimeout          time.Duration `yaml:"dead_man_timeout"`          // Kraken cancels all open orders if the trader stops resetting this timer (0 disables)
+	Strategy                string        `yaml:"strategy"`                  // Strategy of the trader unless -strategy (-name of `trader strategy`) is given
+	LoneLegAction           string        `yaml:"lone_leg_action"`           // cancel or reprice a spread placed with one leg only
+	TrendWindow             time.Duration `yaml:"trend_window"`              // Time the pre-trade price change is measured over
+	MaxTrendPercent         float64       `yaml:"max_trend_percent"`         // Price change within trend_window that triggers trend_action (0 disables)
+	TrendAction             string        `yaml:"trend_action"`              // warn, block or shrink a trade when the price trends past max_trend_percent
+	UntradeableBuyFactor    float64       `yaml:"untradeable_buy_factor"`    // Buy price multiplier in untradeable mode
+	UntradeableSellFactor   float64       `yaml:"untradeable_sell_factor"`   // Sell price multiplier in untradeable mode
+	LoopDelay               time.Duration `yaml:"loop_delay"`                // Delay between loop iterations
+	Cooldown                time.Duration `yaml:"cooldown"`                  // Delay after a canceled, timed-out or losing loop iteration (0 = loop_delay)
+	CooldownSizeFactor      float64       `yaml:"cooldown_size_factor"`      // Trade size multiplier per consecutive canceled, timed-out or losing iteration (1 = no backoff)
+	WarmupPeriod            time.Duration `yaml:"warmup_period"`             // Market history cached for indicators with lookback windows (0 disables the cache)
+	MaxVolume               float64       `yaml:"max_volume"`                // Max base coin volume per trade (0 = unlimited)
+	PriceDecimals           int           `yaml:"price_decimals"`            // Order price decimals (-1 = from AssetPairs)
+	MaxExposureUSD          float64       `yaml:"max_exposure_usd"`          // Max USD in open buy orders of a coin, the new trade included (0 disables)
+	MaxOpenSpreads          int           `yaml:"max_open_spreads"`          // Max spread pairs open at once across the account, the new trade included (0 disables)
+	DailyLossLimit          float64       `yaml:"daily_loss_limit"`          // Stop placing trades once the day's realized loss reaches this many USD (0 disables)
+	DailyLossCancel         bool          `yaml:"daily_loss_cancel"`         // Also cancel the bot's open orders when the daily loss limit is hit
+	MaxBookPercent          float64       `yaml:"max_book_percent"`          // Max trade volume as % of the thinner side's volume on the best book_levels levels (0 disables)
+	BookLevels              int           `yaml:"book_levels"`               // Best order book levels per side counted by max_book_percent
+	DepthVolumeRatio        float64       `yaml:"depth_volume_ratio"`        // Quote from depth-weighted prices holding this multiple of the trade volume (0 = ticker bid/ask)
+	DepthLevels             int           `yaml:"depth_levels"`              // Order book levels per side fetched for the depth-weighted prices
+	SnapshotDepth           int           `yaml:"snapshot_depth"`            // Order book levels per side journaled when a trade goes wrong (0 disables snapshots)
+	SnapshotTrades          int           `yaml:"snapshot_trades"`           // Last public trades journaled with the order book snapshot
+	InventoryTarget         float64       `yaml:"inventory_target"`          // Base coin balance `trader maker` skews its quotes towards
+	MaxInventory            float64       `yaml:"max_inventory"`             // Deviation from inventory_target at full skew, beyond it the growing side isn't quoted (0 disables skew)
+	InventorySkew           float64       `yaml:"inventory_skew"`            // Fraction of the half-spread the quotes move at full skew (0 to 1)
+	SpreadStatsWindow       time.Duration `yaml:"spread_stats_window"`       // Recent spreads the current one must beat the spread_percentile of (0 disables)
+	SpreadSampleInterval    time.Duration `yaml:"spread_sample_interval"`    // Time between spread samples while warming up the spread statistics
+	SpreadPercentile        float64       `yaml:"spread_percentile"`         // Percentile of the recent spreads the current one must reach (50 = median)
+	FillWindow              time.Duration `yaml:"fill_window"`               // Recent prints the fill estimate of the quote prices is computed from (0 disables it)
+	MinFillPercent          float64       `yaml:"min_fill_percent"`          // Volume that must have traded through each quote price within fill_window, % of the trade volume (0 only logs)
+	VolatilityWindow        time.Duration `yaml:"volatility_window"`         // Candles the realized volatility scaling min_spread_percent is computed over (0 disables scaling)
+	VolatilityReference     float64       `yaml:"volatility_reference"`      // 1-minute volatility at which min_spread_percent applies unscaled
+	VolatilityScaleMin      float64       `yaml:"volatility_scale_min"`      // Lowest factor the volatility scales min_spread_percent by
+	VolatilityScaleMax      float64       `yaml:"volatility_scale_max"`      // Highest factor the volatility scales min_spread_percent by
+	LadderLevels            int           `yaml:"ladder_levels"`             // Price levels `trader maker` splits the volume across on each side (1 = a single quote per side)
+	LadderStepPercent       float64       `yaml:"ladder_step_percent"`       // Distance between ladder levels, % of the price
+	LadderSizeFactor        float64       `yaml:"ladder_size_factor"`        // Volume of each ladder level relative to the next inner one (1 = equal split)
+
+	// Per-coin overrides keyed by coin code (e.g. BTC, GHIBLI)
+	Coins map[string]CoinConfig `yaml:"coins"`
+
+	// Coins cmd/loop trades side by side when no -coin is given
+	Watchlist []string `yaml:"watchlist"`
+
+	Scanner ScannerConfig `yaml:"scanner"`
+
+	Earn EarnConfig `yaml:"earn"`
+
+	// Rounding and display precision of money amounts in the journal, reports and notifications
+	Money money.Policy `yaml:"money"`
+
+	// Kraken REST API host, e.g. a mock server or a recording proxy. Empty uses KRAKEN_API_URL or
+	// production.
+	APIURL string `yaml:"api_url"`
+
+	// IANA time zone (e.g. Europe/Bratislava, or Local) in which days roll over for the daily
+	// reports and history
+	TimeZone string `yaml:"timezone"`
+}
+
+// Location returns the configured time zone, UTC if it can't be loaded (Validate rejects those)
+func (c *Config) Location() *time.Location {
+	loc, err := time.LoadLocation(c.TimeZone)
+	if err != nil {
+		return time.UTC
+	}
+	return loc
+}
+
+// ScannerConfig holds the scanner ranking and filter settings
+type ScannerConfig struct {
+	// Weights of the metrics combined into a pair's score, see ScoreMetrics
+	ScoreWeights map[string]float64 `yaml:"score_weights"`
+	// Maker fee percentage paid on both legs, for the net edge of a pair
+	MakerFeePercent float64 `yaml:"maker_fee_percent"`
+	// Pairs whose bid is below this price in the quote currency are skipped
+	MinPrice float64 `yaml:"min_price"`
+	// Skip pairs whose base is a stablecoin or fiat currency
+	ExcludeStablecoins bool `yaml:"exclude_stablecoins"`
+	// Base coins to scan (empty scans all) and base coins never scanned
+	Include []string `yaml:"include"`
+	Exclude []string `yaml:"exclude"`
+}
+
+// EarnConfig holds the Kraken Earn settings of the trader and cmd/earn
+type EarnConfig struct {
+	// Pull the shortfall of a trade's base coin or quote currency from flexible earn allocations
+	AutoDeallocate bool `yaml:"auto_deallocate"`
+	// Wait this long for an allocation or deallocation to be processed
+	Timeout time.Duration `yaml:"timeout"`
+}
+
+// ScoreMetrics lists the metrics available for scan scoring
+var ScoreMetrics = map[string]string{
+	"spread_pct":     "Spread as percentage of the bid price",
+	"volume_usd":     "log10 of the 24h volume in USD",
+	"volatility_pct": "24h high-low range as percentage of the low",
+	"depth_usd":      "log10 of the USD value of the top order book levels (scanner -depth only)",
+	"net_edge_pct":   "Spread minus scanner.maker_fee_percent on both legs, as percentage of the bid",
+	"fills_per_hour": "log10 of the trades per hour over the last 24h",
+	"edge_per_hour":  "Net edge times half the fills per hour, the percentage captured per hour by round trips",
+}
+
+// CoinConfig overrides trading parameters for a single coin. Unset values inherit the global ones.
+type CoinConfig struct {
+	MinSpreadPercent    *float64 `yaml:"min_spread_percent"`
+	MinVolume24h        *float64 `yaml:"min_volume_24h"`
+	MinNetProfitPercent *float64 `yaml:"min_net_profit_percent"`
+	MaxVolume           *float64 `yaml:"max_volume"`
+	MaxExposureUSD      *float64 `yaml:"max_exposure_usd"`
+	SpreadNarrowFactor  *float64 `yaml:"spread_narrow_factor"`
+	PriceDecimals       *int     `yaml:"price_decimals"`
+	InventoryTarget     *float64 `yaml:"inventory_target"`
+	MaxInventory        *float64 `yaml:"max_inventory"`
+	Leverage            *int     `yaml:"leverage"`
+
+	// Trade size of the coin's cmd/loop iterations, instead of -volume or -usd
+	Volume *float64 `yaml:"volume"`
+	USD    *float64 `yaml:"usd"`
+}
+
+// Default returns the built-in trading parameters
+func Default() *Config {
+	return &Config{
+		MinSpreadPercent:        0.5,
+		MinVolume24h:            1000,
+		SpreadNarrowFactor:      0.7,
+		MaxParticipationPercent: 1.0,
+		SpreadCheckInterval:     10 * time.Second,
+		StatusCheckInterval:     10 * time.Second,
+		RepriceInterval:         1 * time.Minute,
+		RepriceStep:             0.25,
+		MaxLossPercent:          1.0,
+		TimeInForce:             "GTC",
+		Strategy:                "spread",
+		LoneLegAction:           "cancel",
+		TrendWindow:             4 * time.Hour,
+		MaxTrendPercent:         5,
+		TrendAction:             "warn",
+		UntradeableBuyFactor:    0.1,
+		UntradeableSellFactor:   10.0,
+		LoopDelay:               5 * time.Minute,
+		CooldownSizeFactor:      1,
+		WarmupPeriod:            24 * time.Hour,
+		MaxVolume:               0,
+		PriceDecimals:           -1,
+		BookLevels:              5,
+		DepthLevels:             100,
+		SnapshotDepth:           25,
+		SnapshotTrades:          50,
+		InventorySkew:           0.5,
+		SpreadSampleInterval:    5 * time.Second,
+		SpreadPercentile:        50,
+		VolatilityReference:     0.1,
+		VolatilityScaleMin:      0.5,
+		VolatilityScaleMax:      3,
+		LadderLevels:            1,
+		LadderStepPercent:       0.2,
+		LadderSizeFactor:        1,
+		Scanner: ScannerConfig{
+			ScoreWeights: map[string]float64{
+				"spread_pct": 1.0,
+				"volume_usd": 0.5,
+			},
+			MakerFeePercent: 0.25,
+		},
+		Earn: EarnConfig{
+			Timeout: 2 * time.Minute,
+		},
+		Money:    money.Default(),
+		TimeZone: "UTC",
+	}
+}
+
+// Load builds the configuration from defaults, the YAML file at path (optional)
+// and CRYPTO_TRADER_* environment variable overrides, then validates it
+func Load(path string) (*Config, error) {
+	cfg := Default()
+
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("error reading config file: %v", err)
+		}
+		// Score weights from the file replace the defaults instead of being merged into them
+		defaultWeights := cfg.Scanner.ScoreWeights
+		cfg.Scanner.ScoreWeights = nil
+		var root yaml.Node
+		if err := yaml.Unmarshal(data, &root); err != nil {
+			return nil, fmt.Errorf("error parsing config file %s: %v", path, err)
+		}
+		if err := normalizeNumbers(&root); err != nil {
+			return nil, fmt.Errorf("error parsing config file %s: %v", path, err)
+		}
+		if err := root.Decode(cfg); err != nil {
+			return nil, fmt.Errorf("error parsing config file %s: %v", path, err)
+		}
+		if cfg.Scanner.ScoreWeights == nil {
+			cfg.Scanner.ScoreWeights = defaultWeights
+		}
+	}
+
+	if err := cfg.applyEnv(); err != nil {
+		return nil, err
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	for coin, profile := range cfg.Coins {
+		if err := cfg.ForCoin(coin).Validate(); err != nil {
+			return nil, fmt.Errorf("coins.%s: %v", coin, err)
+		}
+		if profile.Volume != nil && profile.USD != nil {
+			return nil, fmt.Errorf("coins.%s: volume and usd are mutually exclusive", coin)
+		}
+		if (profile.Volume != nil && *profile.Volume <= 0) || (profile.USD != nil && *profile.USD <= 0) {
+			return nil, fmt.Errorf("coins.%s: volume and usd must be positive", coin)
+		}
+	}
+	for _, coin := range cfg.Watchlist {
+		if strings.TrimSpace(coin) == "" {
+			return nil, fmt.Errorf("watchlist must not contain empty coin codes")
+		}
+	}
+	return cfg, nil
+}
+
+// ForCoin returns the effective configuration for a coin with its profile applied
+func (c *Config) ForCoin(coin string) *Config {
+	effective := *c
+	effective.Coins = nil
+
+	profile, ok := c.coinProfile(coin)
+	if !ok {
+		return &effective
+	}
+
+	if profile.MinSpreadPercent != nil {
+		effective.MinSpreadPercent = *profile.MinSpreadPercent
+	}
+	if profile.MinVolume24h != nil {
+		effective.MinVolume24h = *profile.MinVolume24h
+	}
+	if profile.MinNetProfitPercent != nil {
+		effective.MinNetProfitPercent = *profile.MinNetProfitPercent
+	}
+	if profile.MaxVolume != nil {
+		effective.MaxVolume = *profile.MaxVolume
+	}
+	if profile.MaxExposureUSD != nil {
+		effective.MaxExposureUSD = *profile.MaxExposureUSD
+	}
+	if profile.SpreadNarrowFactor != nil {
+		effective.SpreadNarrowFactor = *profile.SpreadNarrowFactor
+	}
+	if profile.PriceDecimals != nil {
+		effective.PriceDecimals = *profile.PriceDecimals
+	}
+	if profile.InventoryTarget != nil {
+		effective.InventoryTarget = *profile.InventoryTarget
+	}
+	if profile.MaxInventory != nil {
+		effective.MaxInventory = *profile.MaxInventory
+	}
+	if profile.Leverage != nil {
+		effective.Leverage = *profile.Leverage
+	}
+	return &effective
+}
+
+// TradeSize returns the volume and USD amount the coin's profile sets for cmd/loop iterations,
+// zero if unset
+func (c *Config) TradeSize(coin string) (volume float64, usd float64) {
+	profile, _ := c.coinProfile(coin)
+	if profile.Volume != nil {
+		volume = *profile.Volume
+	}
+	if profile.USD != nil {
+		usd = *profile.USD
+	}
+	return volume, usd
+}
+
+// coinProfile returns the coin's profile, looked up by the upper- or lowercase coin code
+func (c *Config) coinProfile(coin string) (CoinConfig, bool) {
+	profile, ok := c.Coins[strings.ToUpper(coin)]
+	if !ok {
+		// Allow lowercase keys in the file as well
+		profile, ok = c.Coins[strings.ToLower(coin)]
+	}
+	return profile, ok
+}
+
+// applyEnv overrides values from environment variables
+func (c *Config) applyEnv() error {
+	// Shared with the tools that don't load a config
+	if value, ok := os.LookupEnv("KRAKEN_API_URL"); ok {
+		c.APIURL = value
+	}
+
+	floats := map[string]*float64{
+		"CRYPTO_TRADER_MIN_SPREAD_PERCENT":        &c.MinSpreadPercent,
+		"CRYPTO_TRADER_MIN_VOLUME_24H":            &c.MinVolume24h,
+		"CRYPTO_TRADER_MIN_NET_PROFIT_PERCENT":    &c.MinNetProfitPercent,
+		"CRYPTO_TRADER_SPREAD_NARROW_FACTOR":      &c.SpreadNarrowFactor,
+		"CRYPTO_TRADER_MAX_PARTICIPATION_PERCENT": &c.MaxParticipationPercent,
+		"CRYPTO_TRADER_UNTRADEABLE_BUY_FACTOR":    &c.UntradeableBuyFactor,
+		"CRYPTO_TRADER_UNTRADEABLE_SELL_FACTOR":   &c.UntradeableSellFactor,
+		"CRYPTO_TRADER_REPRICE_STEP":              &c.RepriceStep,
+		"CRYPTO_TRADER_MAX_LOSS_PERCENT":          &c.MaxLossPercent,
+		"CRYPTO_TRADER_MAX_EXPOSURE_USD":          &c.MaxExposureUSD,
+		"CRYPTO_TRADER_DAILY_LOSS_LIMIT":          &c.DailyLossLimit,
+		"CRYPTO_TRADER_COOLDOWN_SIZE_FACTOR":      &c.CooldownSizeFactor,
+		"CRYPTO_TRADER_MAX_BOOK_PERCENT":          &c.MaxBookPercent,
+		"CRYPTO_TRADER_DEPTH_VOLUME_RATIO":        &c.DepthVolumeRatio,
+		"CRYPTO_TRADER_MAX_TREND_PERCENT":         &c.MaxTrendPercent,
+		"CRYPTO_TRADER_CLOSE_PERCENT":             &c.ClosePercent,
+		"CRYPTO_TRADER_MIN_FILL_PERCENT":          &c.MinFillPercent,
+		"CRYPTO_TRADER_SPREAD_PERCENTILE":         &c.SpreadPercentile,
+		"CRYPTO_TRADER_INVENTORY_TARGET":          &c.InventoryTarget,
+		"CRYPTO_TRADER_MAX_INVENTORY":             &c.MaxInventory,
+		"CRYPTO_TRADER_INVENTORY_SKEW":            &c.InventorySkew,
+		"CRYPTO_TRADER_LADDER_STEP_PERCENT":       &c.LadderStepPercent,
+		"CRYPTO_TRADER_VOLATILITY_REFERENCE":      &c.VolatilityReference,
+		"CRYPTO_TRADER_VOLATILITY_SCALE_MIN":      &c.VolatilityScaleMin,
+		"CRYPTO_TRADER_VOLATILITY_SCALE_MAX":      &c.VolatilityScaleMax,
+		"CRYPTO_TRADER_LADDER_SIZE_FACTOR":        &c.LadderSizeFactor,
+	}
+	for name, target := range floats {
+		value, ok := os.LookupEnv(name)
+		if !ok {
+			continue
+		}
+		parsed, err := numparse.Parse(value)
+		if err != nil {
+			return fmt.Errorf("invalid %s: %v", name, err)
+		}
+		*target = parsed
+	}
+
+	durations := map[string]*time.Duration{
+		"CRYPTO_TRADER_SPREAD_CHECK_INTERVAL":  &c.SpreadCheckInterval,
+		"CRYPTO_TRADER_SPREAD_TIMEOUT":         &c.SpreadTimeout,
+		"CRYPTO_TRADER_STATUS_CHECK_INTERVAL":  &c.StatusCheckInterval,
+		"CRYPTO_TRADER_LEG_TIMEOUT":            &c.LegTimeout,
+		"CRYPTO_TRADER_REPRICE_INTERVAL":       &c.RepriceInterval,
+		"CRYPTO_TRADER_ORDER_EXPIRY":           &c.OrderExpiry,
+		"CRYPTO_TRADER_DEAD_MAN_TIMEOUT":       &c.DeadManTimeout,
+		"CRYPTO_TRADER_LOOP_DELAY":             &c.LoopDelay,
+		"CRYPTO_TRADER_COOLDOWN":               &c.Cooldown,
+		"CRYPTO_TRADER_WARMUP_PERIOD":          &c.WarmupPeriod,
+		"CRYPTO_TRADER_TREND_WINDOW":           &c.TrendWindow,
+		"CRYPTO_TRADER_FILL_WINDOW":            &c.FillWindow,
+		"CRYPTO_TRADER_SPREAD_STATS_WINDOW":    &c.SpreadStatsWindow,
+		"CRYPTO_TRADER_SPREAD_SAMPLE_INTERVAL": &c.SpreadSampleInterval,
+		"CRYPTO_TRADER_VOLATILITY_WINDOW":      &c.VolatilityWindow,
+	}
+	for name, target := range durations {
+		value, ok := os.LookupEnv(name)
+		if !ok {
+			continue
+		}
+		parsed, err := time.ParseDuration(value)
+		if err != nil {
+			return fmt.Errorf("invalid %s: %v", name, err)
+		}
+		*target = parsed
+	}
+
+	return nil
+}
+
+// normalizeNumbers rewrites localized numbers ("0,5", "1 000") in mapping values to plain
+// floats, YAML would read them as strings. Other strings, like durations, are left alone.
+func normalizeNumbers(node *yaml.Node) error {
+	if node.Kind == yaml.MappingNode {
+		// Keys are at even positions, only values are numbers
+		for i := 1; i < len(node.Content); i += 2 {
+			value := node.Content[i]
+			if value.Kind != yaml.ScalarNode {
+				if err := normalizeNumbers(value); err != nil {
+					return err
+				}
+				continue
+			}
+			if value.Tag != "!!str" || value.Style != 0 || !strings.ContainsAny(value.Value, ", '") {
+				continue
+			}
+			if !looksNumeric(value.Value) {
+				continue
+			}
+			parsed, err := numparse.Parse(value.Value)
+			if err != nil {
+				return fmt.Errorf("%s: %v", node.Content[i-1].Value, err)
+			}
+			value.Value, value.Tag = strconv.FormatFloat(parsed, 'f', -1, 64), "!!float"
+		}
+		return nil
+	}
+	for _, child := range node.Content {
+		if err := normalizeNumbers(child); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// looksNumeric reports whether s consists of digits, signs and separators only
+func looksNumeric(s string) bool {
+	return strings.Trim(s, "0123456789+-.,' ") == "" && strings.ContainsAny(s, "0123456789")
+}
+
+// Validate checks that all parameters are within sensible bounds
+func (c *Config) Validate() error {
+	if c.MinSpreadPercent < 0 {
+		return fmt.Errorf("min_spread_percent must not be negative, got %g", c.MinSpreadPercent)
+	}
+	if c.MinVolume24h < 0 {
+		return fmt.Errorf("min_volume_24h must not be negative, got %g", c.MinVolume24h)
+	}
+	if c.MinNetProfitPercent <= -100 {
+		return fmt.Errorf("min_net_profit_percent must be greater than -100, got %g", c.MinNetProfitPercent)
+	}
+	if c.SpreadNarrowFactor < 0 || c.SpreadNarrowFactor > 1 {
+		return fmt.Errorf("spread_narrow_factor must be between 0 and 1, got %g", c.SpreadNarrowFactor)
+	}
+	if c.MaxParticipationPercent < 0 || c.MaxParticipationPercent > 100 {
+		return fmt.Errorf("max_participation_percent must be between 0 and 100, got %g", c.MaxParticipationPercent)
+	}
+	if c.SpreadCheckInterval <= 0 {
+		return fmt.Errorf("spread_check_interval must be positive, got %s", c.SpreadCheckInterval)
+	}
+	if c.SpreadTimeout < 0 {
+		return fmt.Errorf("spread_timeout must not be negative, got %s", c.SpreadTimeout)
+	}
+	if c.StatusCheckInterval <= 0 {
+		return fmt.Errorf("status_check_interval must be positive, got %s", c.StatusCheckInterval)
+	}
+	if c.WarmupPeriod < 0 {
+		return fmt.Errorf("warmup_period must not be negative, got %s", c.WarmupPeriod)
+	}
+	if c.LegTimeout < 0 {
+		return fmt.Errorf("leg_timeout must not be negative, got %s", c.LegTimeout)
+	}
+	if c.RepriceInterval <= 0 {
+		return fmt.Errorf("reprice_interval must be positive, got %s", c.RepriceInterval)
+	}
+	if c.RepriceStep <= 0 || c.RepriceStep > 1 {
+		return fmt.Errorf("reprice_step must be greater than 0 and at most 1, got %g", c.RepriceStep)
+	}
+	if c.MaxLossPercent < 0 || c.MaxLossPercent >= 100 {
+		return fmt.Errorf("max_loss_percent must be between 0 and 100, got %g", c.MaxLossPercent)
+	}
+	switch c.TimeInForce {
+	case "GTD":
+		if c.OrderExpiry <= 0 {
+			return fmt.Errorf("time_in_force GTD needs a positive order_expiry, got %s", c.OrderExpiry)
+		}
+	case "GTC", "IOC":
+		if c.OrderExpiry != 0 {
+			return fmt.Errorf("order_expiry needs time_in_force GTD, got %s", c.TimeInForce)
+		}
+	default:
+		return fmt.Errorf("time_in_force must be GTC, IOC or GTD, got %q", c.TimeInForce)
+	}
+	if c.Leverage < 0 || c.Leverage == 1 {
+		return fmt.Errorf("leverage must be 0 (spot) or at least 2, got %d", c.Leverage)
+	}
+	switch c.CloseOrderType {
+	case "":
+	case "stop-loss", "take-profit", "stop-loss-limit", "take-profit-limit":
+		if c.ClosePercent <= 0 || c.ClosePercent >= 100 {
+			return fmt.Errorf("close_order_type needs a close_percent between 0 and 100, got %g", c.ClosePercent)
+		}
+	default:
+		return fmt.Errorf("close_order_type must be stop-loss, take-profit, stop-loss-limit or take-profit-limit, got %q", c.CloseOrderType)
+	}
+	if c.DeadManTimeout != 0 && (c.DeadManTimeout < 10*time.Second || c.DeadManTimeout > 24*time.Hour) {
+		return fmt.Errorf("dead_man_timeout must be between 10s and 24h (or 0 to disable), got %s", c.DeadManTimeout)
+	}
+	if c.Strategy == "" {
+		return fmt.Errorf("strategy must name a strategy, e.g. spread")
+	}
+	if c.LoneLegAction != "cancel" && c.LoneLegAction != "reprice" {
+		return fmt.Errorf("lone_leg_action must be cancel or reprice, got %q", c.LoneLegAction)
+	}
+	if c.TrendWindow < time.Minute {
+		return fmt.Errorf("trend_window must be at least 1m, got %s", c.TrendWindow)
+	}
+	if c.MaxTrendPercent < 0 {
+		return fmt.Errorf("max_trend_percent must not be negative, got %g", c.MaxTrendPercent)
+	}
+	if c.TrendAction != "warn" && c.TrendAction != "block" && c.TrendAction != "shrink" {
+		return fmt.Errorf("trend_action must be warn, block or shrink, got %q", c.TrendAction)
+	}
+	if c.UntradeableBuyFactor <= 0 || c.UntradeableBuyFactor >= 1 {
+		return fmt.Errorf("untradeable_buy_factor must be between 0 and 1, got %g", c.UntradeableBuyFactor)
+	}
+	if c.UntradeableSellFactor <= 1 {
+		return fmt.Errorf("untradeable_sell_factor must be greater than 1, got %g", c.UntradeableSellFactor)
+	}
+	if c.LoopDelay < 0 {
+		return fmt.Errorf("loop_delay must not be negative, got %s", c.LoopDelay)
+	}
+	if c.Cooldown < 0 {
+		return fmt.Errorf("cooldown must not be negative, got %s", c.Cooldown)
+	}
+	if c.CooldownSizeFactor <= 0 || c.CooldownSizeFactor > 1 {
+		return fmt.Errorf("cooldown_size_factor must be above 0 and at most 1, got %g", c.CooldownSizeFactor)
+	}
+	if c.MaxVolume < 0 {
+		return fmt.Errorf("max_volume must not be negative, got %g", c.MaxVolume)
+	}
+	if c.PriceDecimals < -1 || c.PriceDecimals > 12 {
+		return fmt.Errorf("price_decimals must be between 0 and 12 (or -1 for exchange precision), got %d", c.PriceDecimals)
+	}
+	if c.MaxExposureUSD < 0 {
+		return fmt.Errorf("max_exposure_usd must not be negative, got %g", c.MaxExposureUSD)
+	}
+	if c.MaxOpenSpreads < 0 {
+		return fmt.Errorf("max_open_spreads must not be negative, got %d", c.MaxOpenSpreads)
+	}
+	if c.DailyLossLimit < 0 {
+		return fmt.Errorf("daily_loss_limit must not be negative, got %g", c.DailyLossLimit)
+	}
+	if c.MaxBookPercent < 0 {
+		return fmt.Errorf("max_book_percent must not be negative, got %g", c.MaxBookPercent)
+	}
+	if c.BookLevels < 1 || c.BookLevels > 500 {
+		return fmt.Errorf("book_levels must be between 1 and 500, got %d", c.BookLevels)
+	}
+	if c.DepthVolumeRatio < 0 {
+		return fmt.Errorf("depth_volume_ratio must not be negative, got %g", c.DepthVolumeRatio)
+	}
+	if c.DepthLevels < 1 || c.DepthLevels > 500 {
+		return fmt.Errorf("depth_levels must be between 1 and 500, got %d", c.DepthLevels)
+	}
+	if c.SnapshotDepth < 0 || c.SnapshotDepth > 500 {
+		return fmt.Errorf("snapshot_depth must be between 0 and 500, got %d", c.SnapshotDepth)
+	}
+	if c.SnapshotTrades < 0 || c.SnapshotTrades > 1000 {
+		return fmt.Errorf("snapshot_trades must be between 0 and 1000, got %d", c.SnapshotTrades)
+	}
+	if c.InventoryTarget < 0 {
+		return fmt.Errorf("inventory_target must not be negative, got %g", c.InventoryTarget)
+	}
+	if c.MaxInventory < 0 {
+		return fmt.Errorf("max_inventory must not be negative, got %g", c.MaxInventory)
+	}
+	if c.InventorySkew < 0 || c.InventorySkew > 1 {
+		return fmt.Errorf("inventory_skew must be between 0 and 1, got %g", c.InventorySkew)
+	}
+	if c.SpreadSampleInterval <= 0 {
+		return fmt.Errorf("spread_sample_interval must be positive, got %s", c.SpreadSampleInterval)
+	}
+	if c.SpreadStatsWindow != 0 && c.SpreadStatsWindow < c.SpreadSampleInterval {
+		return fmt.Errorf("spread_stats_window must be 0 or at least spread_sample_interval, got %s", c.SpreadStatsWindow)
+	}
+	if c.SpreadPercentile < 0 || c.SpreadPercentile > 100 {
+		return fmt.Errorf("spread_percentile must be between 0 and 100, got %g", c.SpreadPercentile)
+	}
+	if c.FillWindow < 0 {
+		return fmt.Errorf("fill_window must not be negative, got %s", c.FillWindow)
+	}
+	if c.MinFillPercent < 0 {
+		return fmt.Errorf("min_fill_percent must not be negative, got %g", c.MinFillPercent)
+	}
+	if c.MinFillPercent > 0 && c.FillWindow == 0 {
+		return fmt.Errorf("min_fill_percent needs a fill_window")
+	}
+	if c.VolatilityWindow < 0 {
+		return fmt.Errorf("volatility_window must not be negative, got %s", c.VolatilityWindow)
+	}
+	if c.VolatilityReference <= 0 {
+		return fmt.Errorf("volatility_reference must be positive, got %g", c.VolatilityReference)
+	}
+	if c.VolatilityScaleMin <= 0 || c.VolatilityScaleMax < c.VolatilityScaleMin {
+		return fmt.Errorf("volatility_scale_min must be positive and at most volatility_scale_max, got %g and %g", c.VolatilityScaleMin, c.VolatilityScaleMax)
+	}
+	if c.LadderLevels < 1 || c.LadderLevels > 20 {
+		return fmt.Errorf("ladder_levels must be between 1 and 20, got %d", c.LadderLevels)
+	}
+	if c.LadderStepPercent <= 0 {
+		return fmt.Errorf("ladder_step_percent must be positive, got %g", c.LadderStepPercent)
+	}
+	if c.LadderSizeFactor <= 0 {
+		return fmt.Errorf("ladder_size_factor must be positive, got %g", c.LadderSizeFactor)
+	}
+	if _, err := time.LoadLocation(c.TimeZone); err != nil || c.TimeZone == "" {
+		return fmt.Errorf("timezone must be an IANA time zone name (e.g. Europe/Bratislava), UTC or Local, got %q", c.TimeZone)
+	}
+	if err := c.Money.Validate(); err != nil {
+		return fmt.Errorf("money: %v", err)
+	}
+	if c.APIURL != "" {
+		if u, err := url.Parse(c.APIURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("api_url must be an http(s) URL, got %q", c.APIURL)
+		}
+	}
+	for metric := range c.Scanner.ScoreWeights {
+		if _, ok := ScoreMetrics[metric]; !ok {
+			return fmt.Errorf("scanner.score_weights: unknown metric %s", metric)
+		}
+	}
+	if c.Scanner.MakerFeePercent < 0 {
+		return fmt.Errorf("scanner.maker_fee_percent must not be negative, got %g", c.Scanner.MakerFeePercent)
+	}
+	if c.Scanner.MinPrice < 0 {
+		return fmt.Errorf("scanner.min_price must not be negative, got %g", c.Scanner.MinPrice)
+	}
+	for _, coin := range append(append([]string{}, c.Scanner.Include...), c.Scanner.Exclude...) {
+		if strings.TrimSpace(coin) == "" {
+			return fmt.Errorf("scanner.include and scanner.exclude must not contain empty coin codes")
+		}
+	}
+	if c.Earn.Timeout <= 0 {
+		return fmt.Errorf("earn.timeout must be positive, got %s", c.Earn.Timeout)
+	}
+	return nil
+}
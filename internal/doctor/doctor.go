@@ -0,0 +1,250 @@
+// Package doctor runs the preflight checks behind `trader doctor`: API keys, connectivity,
+// clock skew, balances, open orders, exposure and fee tier.
+package doctor
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"time"
+
+	"github.com/jkosik/crypto-trader/internal/kraken"
+	"github.com/jkosik/crypto-trader/internal/money"
+)
+
+// Status is the traffic-light outcome of a check
+type Status int
+
+const (
+	Green Status = iota
+	Yellow
+	Red
+)
+
+// String returns the status name
+func (s Status) String() string {
+	switch s {
+	case Green:
+		return "green"
+	case Yellow:
+		return "yellow"
+	default:
+		return "red"
+	}
+}
+
+// icon returns the report marker for the status
+func (s Status) icon() string {
+	switch s {
+	case Green:
+		return "🟢"
+	case Yellow:
+		return "🟡"
+	default:
+		return "🔴"
+	}
+}
+
+// Check is the result of a single preflight check
+type Check struct {
+	Name   string
+	Status Status
+	Detail string
+}
+
+// Options tune the thresholds of the checks
+type Options struct {
+	Coin           string        // pair used for the fee tier check
+	MaxClockSkew   time.Duration // red above this, yellow above half of it
+	MaxExposurePct float64       // open buy orders as % of the USD balance; red above this, yellow above half of it
+}
+
+// DefaultOptions are used by `trader doctor` unless overridden by flags
+var DefaultOptions = Options{
+	Coin:           "BTC",
+	MaxClockSkew:   5 * time.Second,
+	MaxExposurePct: 90,
+}
+
+// Run executes all checks in order. Private checks are skipped (red) when the API keys are missing.
+func Run(ctx context.Context, opts Options) []Check {
+	var checks []Check
+
+	keys := checkKeys()
+	checks = append(checks, keys, checkConnectivity(ctx), checkClockSkew(ctx, opts.MaxClockSkew))
+
+	if keys.Status == Red {
+		for _, name := range []string{"balances", "open orders", "exposure", "fee tier"} {
+			checks = append(checks, Check{Name: name, Status: Red, Detail: "skipped, API keys missing"})
+		}
+		return checks
+	}
+
+	balances, usd := checkBalances(ctx)
+	checks = append(checks, balances)
+
+	orders, err := kraken.GetOpenOrders(ctx, "")
+	if err != nil {
+		checks = append(checks,
+			Check{Name: "open orders", Status: Red, Detail: err.Error()},
+			Check{Name: "exposure", Status: Red, Detail: "skipped, open orders unavailable"})
+	} else {
+		checks = append(checks, checkOpenOrders(orders), checkExposure(orders, usd, opts.MaxExposurePct))
+	}
+
+	checks = append(checks, checkFeeTier(ctx, opts.Coin))
+	return checks
+}
+
+// Worst returns the most severe status of the checks
+func Worst(checks []Check) Status {
+	worst := Green
+	for _, c := range checks {
+		if c.Status > worst {
+			worst = c.Status
+		}
+	}
+	return worst
+}
+
+// Print writes the report to w
+func Print(w io.Writer, checks []Check) {
+	fmt.Fprintln(w, "Trader doctor report")
+	for _, c := range checks {
+		fmt.Fprintf(w, "%s %-12s %s\n", c.Status.icon(), c.Name, c.Detail)
+	}
+	fmt.Fprintf(w, "\nOverall: %s %s\n", Worst(checks).icon(), Worst(checks))
+}
+
+// checkKeys verifies the API credentials are present and the private key is valid base64
+func checkKeys() Check {
+	apiKey := os.Getenv("KRAKEN_API_KEY")
+	apiSecret := os.Getenv("KRAKEN_PRIVATE_KEY")
+	if apiKey == "" || apiSecret == "" {
+		return Check{Name: "api keys", Status: Red, Detail: "KRAKEN_API_KEY and KRAKEN_PRIVATE_KEY must be set"}
+	}
+	if _, err := kraken.GetKrakenSignature("/0/private/Balance", `{"nonce": "1"}`, apiSecret); err != nil {
+		return Check{Name: "api keys", Status: Red, Detail: fmt.Sprintf("invalid KRAKEN_PRIVATE_KEY: %v", err)}
+	}
+	return Check{Name: "api keys", Status: Green, Detail: "present"}
+}
+
+// checkConnectivity reports the exchange status and the round trip time
+func checkConnectivity(ctx context.Context) Check {
+	start := time.Now()
+	status, err := kraken.GetSystemStatus(ctx)
+	if err != nil {
+		return Check{Name: "connectivity", Status: Red, Detail: err.Error()}
+	}
+	detail := fmt.Sprintf("exchange %s, round trip %s", status, time.Since(start).Round(time.Millisecond))
+
+	switch status {
+	case "online":
+		return Check{Name: "connectivity", Status: Green, Detail: detail}
+	case "maintenance":
+		return Check{Name: "connectivity", Status: Red, Detail: detail}
+	default:
+		// cancel_only and post_only block new spread orders
+		return Check{Name: "connectivity", Status: Yellow, Detail: detail}
+	}
+}
+
+// checkClockSkew compares the local clock with Kraken's. Nonces are time based, a skewed
+// clock makes them collide with nonces issued by other machines using the same key.
+func checkClockSkew(ctx context.Context, maxSkew time.Duration) Check {
+	before := time.Now()
+	serverTime, err := kraken.GetServerTime(ctx)
+	if err != nil {
+		return Check{Name: "clock skew", Status: Red, Detail: err.Error()}
+	}
+	// Compare with the midpoint of the request, the server time only has second precision
+	local := before.Add(time.Since(before) / 2)
+	skew := local.Sub(serverTime)
+	detail := fmt.Sprintf("local clock is %s off the exchange", skew.Round(time.Millisecond))
+
+	switch abs := time.Duration(math.Abs(float64(skew))); {
+	case abs > maxSkew:
+		return Check{Name: "clock skew", Status: Red, Detail: detail}
+	case abs > maxSkew/2:
+		return Check{Name: "clock skew", Status: Yellow, Detail: detail}
+	default:
+		return Check{Name: "clock skew", Status: Green, Detail: detail}
+	}
+}
+
+// checkBalances verifies the keys can read balances and returns the USD balance
+func checkBalances(ctx context.Context) (Check, float64) {
+	body, err := kraken.GetAccountBalance(ctx)
+	if err != nil {
+		return Check{Name: "balances", Status: Red, Detail: err.Error()}, 0
+	}
+	balances, err := kraken.GetAllBalances(body)
+	if err != nil {
+		return Check{Name: "balances", Status: Red, Detail: err.Error()}, 0
+	}
+	// USD is summed over its variants (ZUSD, USD.F), resolved through the pair metadata
+	if _, err := kraken.LoadAssetPairs(ctx); err != nil {
+		return Check{Name: "balances", Status: Red, Detail: err.Error()}, 0
+	}
+	usd, err := kraken.GetBalance(balances, "USD")
+	if err != nil {
+		return Check{Name: "balances", Status: Red, Detail: err.Error()}, 0
+	}
+	if usd.Available <= 0 {
+		return Check{Name: "balances", Status: Yellow, Detail: "no USD available to buy with"}, 0
+	}
+	return Check{Name: "balances", Status: Green, Detail: money.Format(usd.Available, "USD") + " USD"}, usd.Available
+}
+
+// checkOpenOrders flags leftover orders, e.g. untradeable test orders that were never closed
+func checkOpenOrders(orders map[string]kraken.OrderStatus) Check {
+	if len(orders) == 0 {
+		return Check{Name: "open orders", Status: Green, Detail: "none"}
+	}
+	return Check{Name: "open orders", Status: Yellow, Detail: fmt.Sprintf("%d open USD orders, check for leftovers", len(orders))}
+}
+
+// checkExposure compares the USD locked in open buy orders with the USD balance
+func checkExposure(orders map[string]kraken.OrderStatus, usd float64, maxPct float64) Check {
+	exposure := 0.0
+	for _, order := range orders {
+		if order.Descr.Type != "buy" {
+			continue
+		}
+		remaining := kraken.ParseFloat(order.Vol) - kraken.ParseFloat(order.VolExec)
+		exposure += remaining * kraken.ParseFloat(order.Descr.Price)
+	}
+	if exposure == 0 {
+		return Check{Name: "exposure", Status: Green, Detail: "no USD in open buy orders"}
+	}
+	if usd <= 0 {
+		return Check{Name: "exposure", Status: Red, Detail: fmt.Sprintf("%s USD in open buy orders with no USD balance", money.Format(exposure, "USD"))}
+	}
+
+	pct := exposure / usd * 100
+	detail := fmt.Sprintf("%s USD in open buy orders (%.1f%% of balance)", money.Format(exposure, "USD"), pct)
+	switch {
+	case pct > maxPct:
+		return Check{Name: "exposure", Status: Red, Detail: detail}
+	case pct > maxPct/2:
+		return Check{Name: "exposure", Status: Yellow, Detail: detail}
+	default:
+		return Check{Name: "exposure", Status: Green, Detail: detail}
+	}
+}
+
+// checkFeeTier reports the 30-day volume and fees for the coin's USD pair
+func checkFeeTier(ctx context.Context, coin string) Check {
+	pair, err := kraken.GetAssetPair(ctx, coin, "USD")
+	if err != nil {
+		return Check{Name: "fee tier", Status: Red, Detail: err.Error()}
+	}
+	volume, err := kraken.GetTradeVolume(ctx, pair)
+	if err != nil {
+		return Check{Name: "fee tier", Status: Red, Detail: err.Error()}
+	}
+	return Check{Name: "fee tier", Status: Green, Detail: fmt.Sprintf("30d volume %s %s, %s maker %.4f%% / taker %.4f%%",
+		money.Format(volume.Volume, volume.Currency), volume.Currency, pair.WSName, volume.MakerFee, volume.TakerFee)}
+}
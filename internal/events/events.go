@@ -0,0 +1,68 @@
+// Package events emits machine-readable trade events as JSON lines, one object per line,
+// for tools orchestrating the trader. Emitting is a no-op until Enable is called.
+package events
+
+import (
+	"encoding/json"
+	"io"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/jkosik/crypto-trader/internal/redact"
+)
+
+// Event types
+const (
+	Ticker       = "ticker"        // market snapshot the trade decision was based on
+	OrdersPlaced = "orders_placed" // buy and sell orders accepted by the exchange
+	Fill         = "fill"          // an order changed status or filled volume
+	Reprice      = "reprice"       // a stalled leg was moved towards the market
+	Resize       = "resize"        // an open leg was shrunk to the other leg's executed volume
+	External     = "external"      // an order was canceled or amended outside the trader
+	Result       = "result"        // final outcome and P&L of the trade
+	Exit         = "exit"          // process exit code, always the last event
+	Balance      = "balance"       // significant balance change seen by `trader watch`
+)
+
+// Event is a single line of the JSON output
+type Event struct {
+	Time    time.Time   `json:"time"`
+	Type    string      `json:"type"`
+	TradeID string      `json:"trade_id,omitempty"`
+	Data    interface{} `json:"data,omitempty"`
+}
+
+var (
+	mu      sync.Mutex
+	encoder *json.Encoder
+	tradeID string
+)
+
+// Enable starts writing events to w, tagged with the trade ID
+func Enable(w io.Writer, id string) {
+	mu.Lock()
+	defer mu.Unlock()
+	encoder = json.NewEncoder(redact.Writer(w))
+	tradeID = id
+}
+
+// Enabled reports whether events are being written
+func Enabled() bool {
+	mu.Lock()
+	defer mu.Unlock()
+	return encoder != nil
+}
+
+// Emit writes an event if events are enabled
+func Emit(eventType string, data interface{}) {
+	mu.Lock()
+	defer mu.Unlock()
+	if encoder == nil {
+		return
+	}
+	event := Event{Time: time.Now().UTC(), Type: eventType, TradeID: tradeID, Data: data}
+	if err := encoder.Encode(event); err != nil {
+		slog.Warn("Failed to write event", "type", eventType, "error", err)
+	}
+}
@@ -0,0 +1,54 @@
+// Package exitcode defines the process exit codes of cmd/trader, so wrappers (shell, systemd,
+// Kubernetes, cmd/loop) can branch on the outcome of a run.
+package exitcode
+
+// Exit codes of cmd/trader
+const (
+	OK                = 0  // trade completed, or dry run (no -order) finished
+	TradeFailed       = 1  // API, order placement or any other runtime failure
+	Config            = 2  // invalid flags or configuration (also used by the flag package)
+	InsufficientFunds = 3  // not enough base coin or USD for the trade
+	Auth              = 4  // API keys missing, invalid or lacking permissions
+	SpreadTimeout     = 5  // spread/volume conditions not met within spread_timeout
+	TradeCanceled     = 6  // both orders were canceled
+	OrderTimeout      = 7  // neither order filled within -maxwait or before order_expiry, both were canceled or expired
+	PairHalted        = 8  // the pair or exchange stopped taking new orders (halt, cancel_only, delisting)
+	Interrupted       = 9  // stopped by SIGINT or SIGTERM, open orders handled per -onsignal
+	RiskLimit         = 10 // a new trade would exceed max_exposure_usd or max_open_spreads
+	DailyLossLimit    = 11 // the day's realized loss reached daily_loss_limit, no new trades until the next day
+	Trending          = 12 // the price moved more than max_trend_percent within trend_window, trend_action block
+)
+
+// Describe returns a short description of an exit code
+func Describe(code int) string {
+	switch code {
+	case OK:
+		return "trade completed"
+	case TradeFailed:
+		return "trade failed"
+	case Config:
+		return "configuration error"
+	case InsufficientFunds:
+		return "insufficient funds"
+	case Auth:
+		return "API authentication failure"
+	case SpreadTimeout:
+		return "spread timeout"
+	case TradeCanceled:
+		return "trade canceled"
+	case OrderTimeout:
+		return "order timeout"
+	case PairHalted:
+		return "pair halted"
+	case Interrupted:
+		return "interrupted"
+	case RiskLimit:
+		return "risk limit"
+	case DailyLossLimit:
+		return "daily loss limit"
+	case Trending:
+		return "trending market"
+	default:
+		return "unknown"
+	}
+}
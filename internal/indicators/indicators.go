@@ -0,0 +1,165 @@
+// Package indicators computes technical indicators from OHLC candles for strategies and pre-trade
+// filters. Every indicator returns its series oldest first, one value for every candle from the
+// first one with a full period of history on, so the last value belongs to the latest candle.
+package indicators
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/jkosik/crypto-trader/internal/kraken"
+)
+
+// Band is a Bollinger band value
+type Band struct {
+	Lower  float64
+	Middle float64 // simple moving average
+	Upper  float64
+}
+
+// Closes returns the close prices of the candles
+func Closes(candles []kraken.OHLCData) []float64 {
+	closes := make([]float64, len(candles))
+	for i, candle := range candles {
+		closes[i] = candle.Close
+	}
+	return closes
+}
+
+// Last returns the latest value of a series, or an error if it's empty
+func Last[T any](series []T) (T, error) {
+	var zero T
+	if len(series) == 0 {
+		return zero, fmt.Errorf("no indicator values")
+	}
+	return series[len(series)-1], nil
+}
+
+// SMA returns the simple moving average over period values
+func SMA(values []float64, period int) ([]float64, error) {
+	if err := check(len(values), period, period); err != nil {
+		return nil, err
+	}
+	sma := make([]float64, 0, len(values)-period+1)
+	sum := 0.0
+	for i, value := range values {
+		sum += value
+		if i >= period {
+			sum -= values[i-period]
+		}
+		if i >= period-1 {
+			sma = append(sma, sum/float64(period))
+		}
+	}
+	return sma, nil
+}
+
+// EMA returns the exponential moving average over period values, seeded with the SMA of the first
+// period values
+func EMA(values []float64, period int) ([]float64, error) {
+	if err := check(len(values), period, period); err != nil {
+		return nil, err
+	}
+	alpha := 2 / float64(period+1)
+	seed := 0.0
+	for _, value := range values[:period] {
+		seed += value
+	}
+	ema := make([]float64, 0, len(values)-period+1)
+	ema = append(ema, seed/float64(period))
+	for _, value := range values[period:] {
+		prev := ema[len(ema)-1]
+		ema = append(ema, prev+alpha*(value-prev))
+	}
+	return ema, nil
+}
+
+// RSI returns Wilder's relative strength index over period changes, from 0 to 100. It needs
+// period+1 values; a period without losses is 100, one without any change 50.
+func RSI(values []float64, period int) ([]float64, error) {
+	if err := check(len(values), period, period+1); err != nil {
+		return nil, err
+	}
+	var gain, loss float64
+	for i := 1; i <= period; i++ {
+		change := values[i] - values[i-1]
+		gain += math.Max(change, 0)
+		loss += math.Max(-change, 0)
+	}
+	gain /= float64(period)
+	loss /= float64(period)
+
+	rsi := make([]float64, 0, len(values)-period)
+	rsi = append(rsi, rsiOf(gain, loss))
+	for i := period + 1; i < len(values); i++ {
+		change := values[i] - values[i-1]
+		gain = (gain*float64(period-1) + math.Max(change, 0)) / float64(period)
+		loss = (loss*float64(period-1) + math.Max(-change, 0)) / float64(period)
+		rsi = append(rsi, rsiOf(gain, loss))
+	}
+	return rsi, nil
+}
+
+// Bollinger returns the Bollinger bands over period values: the SMA and the SMA plus and minus
+// deviations population standard deviations
+func Bollinger(values []float64, period int, deviations float64) ([]Band, error) {
+	sma, err := SMA(values, period)
+	if err != nil {
+		return nil, err
+	}
+	bands := make([]Band, len(sma))
+	for i, middle := range sma {
+		variance := 0.0
+		for _, value := range values[i : i+period] {
+			variance += (value - middle) * (value - middle)
+		}
+		width := deviations * math.Sqrt(variance/float64(period))
+		bands[i] = Band{Lower: middle - width, Middle: middle, Upper: middle + width}
+	}
+	return bands, nil
+}
+
+// ATR returns Wilder's average true range over period candles, in price units. It needs period+1
+// candles, the first one only provides the previous close.
+func ATR(candles []kraken.OHLCData, period int) ([]float64, error) {
+	if err := check(len(candles), period, period+1); err != nil {
+		return nil, err
+	}
+	trueRange := func(i int) float64 {
+		prevClose := candles[i-1].Close
+		return math.Max(candles[i].High-candles[i].Low, math.Max(math.Abs(candles[i].High-prevClose), math.Abs(candles[i].Low-prevClose)))
+	}
+	seed := 0.0
+	for i := 1; i <= period; i++ {
+		seed += trueRange(i)
+	}
+	atr := make([]float64, 0, len(candles)-period)
+	atr = append(atr, seed/float64(period))
+	for i := period + 1; i < len(candles); i++ {
+		prev := atr[len(atr)-1]
+		atr = append(atr, (prev*float64(period-1)+trueRange(i))/float64(period))
+	}
+	return atr, nil
+}
+
+// rsiOf converts average gain and loss to the RSI
+func rsiOf(gain float64, loss float64) float64 {
+	switch {
+	case gain == 0 && loss == 0:
+		return 50
+	case loss == 0:
+		return 100
+	}
+	return 100 - 100/(1+gain/loss)
+}
+
+// check validates the period and that there are enough values for it
+func check(count int, period int, needed int) error {
+	if period < 1 {
+		return fmt.Errorf("period must be at least 1, got %d", period)
+	}
+	if count < needed {
+		return fmt.Errorf("need at least %d values for period %d, got %d", needed, period, count)
+	}
+	return nil
+}
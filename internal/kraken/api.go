@@ -1,6 +1,7 @@
 package kraken
 
 import (
+	"context"
 	"crypto/hmac"
 	"crypto/sha256"
 	"crypto/sha512"
@@ -8,10 +9,75 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"log/slog"
 	"net/http"
+	"net/url"
+	"os"
 	"strings"
+	"time"
+
+	"github.com/jkosik/crypto-trader/internal/redact"
 )
 
+// DefaultBaseURL is the host of Kraken's production REST API
+const DefaultBaseURL = "https://api.kraken.com"
+
+// BaseURL is the host public and private requests are sent to, e.g. a mock server or a recording
+// proxy instead of production. KRAKEN_API_URL sets it for every command, see SetBaseURL.
+var BaseURL = baseURLFromEnv()
+
+// baseURLFromEnv returns KRAKEN_API_URL, or the production host if it's unset or invalid
+func baseURLFromEnv() string {
+	raw := os.Getenv("KRAKEN_API_URL")
+	if raw == "" {
+		return DefaultBaseURL
+	}
+	u, err := ParseBaseURL(raw)
+	if err != nil {
+		slog.Warn("Ignoring KRAKEN_API_URL", "error", err)
+		return DefaultBaseURL
+	}
+	return u
+}
+
+// ParseBaseURL checks an http(s) URL of an API host and returns it without a trailing slash
+func ParseBaseURL(raw string) (string, error) {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return "", fmt.Errorf("invalid API URL %q: %v", raw, err)
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || u.RawQuery != "" {
+		return "", fmt.Errorf("invalid API URL %q: must be http(s)://host[:port][/path]", raw)
+	}
+	return strings.TrimRight(raw, "/"), nil
+}
+
+// SetBaseURL points the client at another API host, empty keeps the current one
+func SetBaseURL(raw string) error {
+	if raw == "" {
+		return nil
+	}
+	u, err := ParseBaseURL(raw)
+	if err != nil {
+		return err
+	}
+	BaseURL = u
+	return nil
+}
+
+// sessionKey names a request in session recordings by its production URL, so sessions recorded
+// against a mock server replay against production settings and the other way around
+func sessionKey(requestURL string) string {
+	if BaseURL != DefaultBaseURL && strings.HasPrefix(requestURL, BaseURL) {
+		return DefaultBaseURL + strings.TrimPrefix(requestURL, BaseURL)
+	}
+	return requestURL
+}
+
+// RequestTimeout is applied to API requests whose context carries no deadline,
+// so a hung connection can't block the caller forever
+var RequestTimeout = 30 * time.Second
+
 // GetKrakenSignature generates the API signature for private Kraken API endpoints
 func GetKrakenSignature(urlPath string, payload string, secret string) (string, error) {
 	// Parse the JSON payload
@@ -26,14 +92,15 @@ func GetKrakenSignature(urlPath string, payload string, secret string) (string,
 		return "", fmt.Errorf("Nonce not found in payload or not a string")
 	}
 
-	// Create the encoded data string
-	encodedData := nonce + payload
-
-	sha := sha256.New()
-	sha.Write([]byte(encodedData))
-	shaSum := sha.Sum(nil)
+	return SignMessage(urlPath, nonce, payload, secret)
+}
 
-	message := append([]byte(urlPath), shaSum...)
+// SignMessage signs the post data of a private request: HMAC-SHA512 of the URL path followed by
+// the SHA-256 of the nonce and the post data, keyed with the base64-decoded secret. The post data
+// is signed byte for byte, JSON and form-encoded bodies alike.
+func SignMessage(urlPath string, nonce string, postData string, secret string) (string, error) {
+	shaSum := sha256.Sum256([]byte(nonce + postData))
+	message := append([]byte(urlPath), shaSum[:]...)
 
 	decodedSecret, err := base64.StdEncoding.DecodeString(secret)
 	if err != nil {
@@ -42,15 +109,35 @@ func GetKrakenSignature(urlPath string, payload string, secret string) (string,
 
 	mac := hmac.New(sha512.New, decodedSecret)
 	mac.Write(message)
-	macSum := mac.Sum(nil)
-	sigDigest := base64.StdEncoding.EncodeToString(macSum)
-	return sigDigest, nil
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil)), nil
+}
+
+// withDefaultTimeout applies RequestTimeout when the context has no deadline set
+func withDefaultTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if _, ok := ctx.Deadline(); ok {
+		return ctx, func() {}
+	}
+	return context.WithTimeout(ctx, RequestTimeout)
 }
 
 // MakePublicRequest makes a request to Kraken's public API endpoints
-func MakePublicRequest(url string, method string) ([]byte, error) {
+func MakePublicRequest(ctx context.Context, url string, method string) ([]byte, error) {
+	if body, ok, err := recordedResponse(sessionKey(url)); ok {
+		return body, err
+	}
+	body, err := makePublicRequest(ctx, url, method)
+	err = redact.Error(err)
+	recordResponse(sessionKey(url), body, err)
+	return body, err
+}
+
+// makePublicRequest sends a public API request over the network
+func makePublicRequest(ctx context.Context, url string, method string) ([]byte, error) {
+	ctx, cancel := withDefaultTimeout(ctx)
+	defer cancel()
+
 	client := &http.Client{}
-	req, err := http.NewRequest(method, url, nil)
+	req, err := http.NewRequestWithContext(ctx, method, url, nil)
 	if err != nil {
 		return nil, fmt.Errorf("error creating request: %v", err)
 	}
@@ -72,9 +159,24 @@ func MakePublicRequest(url string, method string) ([]byte, error) {
 }
 
 // MakePrivateRequest makes a request to Kraken's private API endpoints with auth
-func MakePrivateRequest(url string, method string, payload string, apiKey string, signature string) ([]byte, error) {
+func MakePrivateRequest(ctx context.Context, url string, method string, payload string, apiKey string, signature string) ([]byte, error) {
+	// Payloads carry a nonce, so recorded responses are matched by URL and order only
+	if body, ok, err := recordedResponse(sessionKey(url)); ok {
+		return body, err
+	}
+	body, err := makePrivateRequest(ctx, url, method, payload, apiKey, signature)
+	err = redact.Error(err)
+	recordResponse(sessionKey(url), body, err)
+	return body, err
+}
+
+// makePrivateRequest sends an authenticated API request over the network
+func makePrivateRequest(ctx context.Context, url string, method string, payload string, apiKey string, signature string) ([]byte, error) {
+	ctx, cancel := withDefaultTimeout(ctx)
+	defer cancel()
+
 	client := &http.Client{}
-	req, err := http.NewRequest(method, url, strings.NewReader(payload))
+	req, err := http.NewRequestWithContext(ctx, method, url, strings.NewReader(payload))
 	if err != nil {
 		return nil, fmt.Errorf("error creating request: %v", err)
 	}
@@ -0,0 +1,151 @@
+package kraken
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"testing"
+)
+
+// Reference request of Kraken's REST authentication guide with the signature it publishes for it
+const (
+	referenceSecret    = "kQH5HW/8p1uGOVjbgWA7FunAmGO8lsSUXNsu3eow76sz84Q18fWxnyRzBHCd3pd5nE9qa99HAZtuZuj6F1huXg=="
+	referenceNonce     = "1616492376594"
+	referencePostData  = "nonce=1616492376594&ordertype=limit&pair=XBTUSD&price=37500&type=buy&volume=1.25"
+	referencePath      = "/0/private/AddOrder"
+	referenceSignature = "4/dpxb3iT4tp/ZCVEwSnEsLxx0bqyhLpdfOpc6fn7OR8+UClSV5n9E6aSS8MPtnRfp32bAb0nmbRn6H8ndwLUQ=="
+)
+
+// expectedSignature computes the signature the way Kraken's guide describes it
+func expectedSignature(t testing.TB, urlPath, nonce, postData, secret string) string {
+	t.Helper()
+	key, err := base64.StdEncoding.DecodeString(secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sum := sha256.Sum256([]byte(nonce + postData))
+	mac := hmac.New(sha512.New, key)
+	mac.Write([]byte(urlPath))
+	mac.Write(sum[:])
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func TestSignMessage(t *testing.T) {
+	tests := []struct {
+		name     string
+		path     string
+		nonce    string
+		postData string
+		secret   string
+		want     string
+		wantErr  bool
+	}{
+		{"kraken reference", referencePath, referenceNonce, referencePostData, referenceSecret, referenceSignature, false},
+		{"other path", referencePath + "x", referenceNonce, referencePostData, referenceSecret, "", false},
+		{"other post data", referencePath, referenceNonce, referencePostData + " ", referenceSecret, "", false},
+		{"invalid secret", referencePath, referenceNonce, referencePostData, "not base64!", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := SignMessage(tt.path, tt.nonce, tt.postData, tt.secret)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("SignMessage succeeded with %q", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.want != "" && got != tt.want {
+				t.Errorf("SignMessage = %s, want %s", got, tt.want)
+			}
+			// Any change of the signed data must change the signature
+			if tt.want == "" && got == referenceSignature {
+				t.Errorf("SignMessage = the reference signature for changed data")
+			}
+		})
+	}
+}
+
+func TestGetKrakenSignature(t *testing.T) {
+	tests := []struct {
+		name    string
+		payload string
+		nonce   string
+		wantErr bool
+	}{
+		{"order", `{"nonce": "1616492376594", "ordertype": "limit", "pair": "XBTUSD", "price": "37500", "type": "buy", "volume": "1.25"}`, "1616492376594", false},
+		{"nonce only", `{"nonce":"1"}`, "1", false},
+		{"19-digit nonce", `{"nonce": "9223372036854775807", "pair": "XBTUSD"}`, "9223372036854775807", false},
+		{"unicode", `{"nonce": "1616492376594", "note": "žluťoučký kůň ✓ 🚀"}`, "1616492376594", false},
+		{"nested", `{"nonce": "1616492376594", "orders": [{"ordertype": "limit", "price": "37500"}], "validate": true}`, "1616492376594", false},
+		{"numeric nonce", `{"nonce": 1616492376594}`, "", true},
+		{"no nonce", `{"pair": "XBTUSD"}`, "", true},
+		{"not json", referencePostData, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := GetKrakenSignature(referencePath, tt.payload, referenceSecret)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("GetKrakenSignature succeeded with %q", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			// The payload is signed byte for byte, as it is sent
+			if want := expectedSignature(t, referencePath, tt.nonce, tt.payload, referenceSecret); got != want {
+				t.Errorf("GetKrakenSignature = %s, want %s", got, want)
+			}
+		})
+	}
+}
+
+func FuzzGetKrakenSignature(f *testing.F) {
+	f.Add(referencePath, referenceNonce, "XBTUSD", "1.25")
+	f.Add("/0/private/Balance", "1", "", "")
+	f.Add(referencePath, "9223372036854775807", "PAXGUSD", "0.00000001")
+	f.Add(referencePath, "18446744073709551615000", "žluťoučký kůň ✓ 🚀", "\"quoted\" \\ \n\t")
+	f.Add("/0/private/AddOrderBatch", "1700000000000000", "\u0000 ", "<>&")
+	f.Fuzz(func(t *testing.T, urlPath, nonce, pair, volume string) {
+		body, err := json.Marshal(map[string]string{"nonce": nonce, "pair": pair, "volume": volume})
+		if err != nil {
+			t.Skip()
+		}
+		payload := string(body)
+		got, err := GetKrakenSignature(urlPath, payload, referenceSecret)
+		if err != nil {
+			t.Fatalf("GetKrakenSignature(%q): %v", payload, err)
+		}
+		// json.Marshal replaces invalid UTF-8, the nonce signed is the one in the payload
+		var parsed map[string]string
+		if err := json.Unmarshal(body, &parsed); err != nil {
+			t.Fatal(err)
+		}
+		if want := expectedSignature(t, urlPath, parsed["nonce"], payload, referenceSecret); got != want {
+			t.Errorf("GetKrakenSignature(%q, %q) = %s, want %s", urlPath, payload, got, want)
+		}
+		if decoded, err := base64.StdEncoding.DecodeString(got); err != nil || len(decoded) != sha512.Size {
+			t.Errorf("signature %q is not a base64 HMAC-SHA512", got)
+		}
+		if other, _ := SignMessage(urlPath, parsed["nonce"], payload+" ", referenceSecret); other == got {
+			t.Errorf("signature of %q doesn't depend on the payload", payload)
+		}
+	})
+}
+
+func BenchmarkGetKrakenSignature(b *testing.B) {
+	secret := base64.StdEncoding.EncodeToString([]byte("benchmark-secret-of-a-realistic-length-for-kraken-api-keys-0123456789"))
+	payload := limitOrderPayload(1700000000000000, "buy", benchPair, 0.00309, 3000, UserRef("5f2c9a01b7e4"), "GTC")
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := GetKrakenSignature("/0/private/AddOrder", payload, secret); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
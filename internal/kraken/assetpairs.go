@@ -0,0 +1,212 @@
+package kraken
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// AssetPair holds the trading metadata of a Kraken pair from the AssetPairs endpoint
+type AssetPair struct {
+	Name         string  // Pair key used by Kraken (e.g. XXBTZUSD)
+	Altname      string  // Alternative pair name (e.g. XBTUSD)
+	WSName       string  // WebSocket pair name (e.g. XBT/USD)
+	Base         string  // Base asset code (e.g. XXBT)
+	Quote        string  // Quote asset code (e.g. ZUSD)
+	PairDecimals int     // Price precision
+	LotDecimals  int     // Volume precision
+	OrderMin     float64 // Minimum order volume in base currency
+	CostMin      float64 // Minimum order cost in quote currency
+	TickSize     float64 // Minimum price increment
+	Status       string  // Trading status (online, cancel_only, post_only, limit_only, reduce_only)
+	LeverageBuy  []int   // Leverages buys can use on margin, empty if the pair isn't marginable
+	LeverageSell []int   // Leverages sells (shorts) can use on margin
+}
+
+// assetPairResult is the raw AssetPairs entry as returned by the API
+type assetPairResult struct {
+	Altname      string `json:"altname"`
+	WSName       string `json:"wsname"`
+	Base         string `json:"base"`
+	Quote        string `json:"quote"`
+	PairDecimals int    `json:"pair_decimals"`
+	LotDecimals  int    `json:"lot_decimals"`
+	OrderMin     string `json:"ordermin"`
+	CostMin      string `json:"costmin"`
+	TickSize     string `json:"tick_size"`
+	Status       string `json:"status"`
+	LeverageBuy  []int  `json:"leverage_buy"`
+	LeverageSell []int  `json:"leverage_sell"`
+}
+
+// Asset pairs cache, loaded once per process
+var (
+	assetPairsMu  sync.Mutex
+	assetPairs    map[string]*AssetPair
+	assetAltnames map[string]string // asset code to altname, e.g. XXBT to XBT
+)
+
+// LoadAssetPairs fetches metadata for all tradable pairs and caches it for the process lifetime
+func LoadAssetPairs(ctx context.Context) (map[string]*AssetPair, error) {
+	assetPairsMu.Lock()
+	defer assetPairsMu.Unlock()
+
+	if assetPairs != nil {
+		return assetPairs, nil
+	}
+
+	url := BaseURL + "/0/public/AssetPairs"
+	body, err := publicRequest(ctx, url)
+	if err != nil {
+		return nil, fmt.Errorf("error making request: %v", err)
+	}
+
+	var response struct {
+		Error  []string                   `json:"error"`
+		Result map[string]assetPairResult `json:"result"`
+	}
+	if err := json.Unmarshal(body, &response); err != nil {
+		return nil, fmt.Errorf("error parsing asset pairs response: %v", err)
+	}
+
+	if len(response.Error) > 0 {
+		return nil, fmt.Errorf("API error: %v", response.Error)
+	}
+
+	pairs := make(map[string]*AssetPair, len(response.Result))
+	for name, raw := range response.Result {
+		pairs[name] = &AssetPair{
+			Name:         name,
+			Altname:      raw.Altname,
+			WSName:       raw.WSName,
+			Base:         raw.Base,
+			Quote:        raw.Quote,
+			PairDecimals: raw.PairDecimals,
+			LotDecimals:  raw.LotDecimals,
+			OrderMin:     ParseFloat(raw.OrderMin),
+			CostMin:      ParseFloat(raw.CostMin),
+			TickSize:     ParseFloat(raw.TickSize),
+			Status:       raw.Status,
+			LeverageBuy:  raw.LeverageBuy,
+			LeverageSell: raw.LeverageSell,
+		}
+	}
+
+	altnames := make(map[string]string)
+	for _, pair := range pairs {
+		altnames[pair.Base] = pair.BaseAltname()
+		altnames[pair.Quote] = pair.QuoteAltname()
+	}
+
+	assetPairs, assetAltnames = pairs, altnames
+	return assetPairs, nil
+}
+
+// AssetAltname resolves an asset code to its altname through the loaded AssetPairs metadata, e.g.
+// XXBT or BTC to XBT and ZUSD to USD. Codes of assets in no loaded pair are returned as given.
+func AssetAltname(code string) string {
+	code = Altname(code)
+	assetPairsMu.Lock()
+	defer assetPairsMu.Unlock()
+	if altname, ok := assetAltnames[code]; ok {
+		return altname
+	}
+	return code
+}
+
+// GetAssetPair resolves the pair metadata for a base coin and quote currency (e.g. "BTC", "USD")
+func GetAssetPair(ctx context.Context, coin string, quote string) (*AssetPair, error) {
+	pairs, err := LoadAssetPairs(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// Kraken names bitcoin XBT internally
+	base := Altname(coin)
+	quote = Altname(quote)
+
+	for _, pair := range pairs {
+		if pair.WSName == base+"/"+quote || pair.Altname == base+quote {
+			return pair, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown asset pair: %s/%s", coin, quote)
+}
+
+// BaseAltname returns the human-readable base asset code (e.g. XBT for XXBT)
+func (p *AssetPair) BaseAltname() string {
+	if idx := strings.Index(p.WSName, "/"); idx != -1 {
+		return p.WSName[:idx]
+	}
+	return p.Base
+}
+
+// QuoteAltname returns the human-readable quote asset code (e.g. USD for ZUSD)
+func (p *AssetPair) QuoteAltname() string {
+	if idx := strings.Index(p.WSName, "/"); idx != -1 {
+		return p.WSName[idx+1:]
+	}
+	return p.Quote
+}
+
+// RoundPrice rounds a price to the pair's tick size and price decimals
+func (p *AssetPair) RoundPrice(price float64) float64 {
+	if p.TickSize > 0 {
+		price = math.Round(price/p.TickSize) * p.TickSize
+	}
+	multiplier := math.Pow10(p.PairDecimals)
+	return math.Round(price*multiplier) / multiplier
+}
+
+// RoundVolume rounds a volume down to the pair's lot decimals, so it never exceeds the requested amount
+func (p *AssetPair) RoundVolume(volume float64) float64 {
+	multiplier := math.Pow10(p.LotDecimals)
+	// The epsilon keeps exact values like 0.3 from flooring to 0.29999
+	return math.Floor(volume*multiplier+1e-9) / multiplier
+}
+
+// FormatPrice formats a price with the pair's price decimals for API payloads
+func (p *AssetPair) FormatPrice(price float64) string {
+	return strconv.FormatFloat(price, 'f', p.PairDecimals, 64)
+}
+
+// FormatVolume formats a volume with the pair's lot decimals for API payloads
+func (p *AssetPair) FormatVolume(volume float64) string {
+	return strconv.FormatFloat(volume, 'f', p.LotDecimals, 64)
+}
+
+// ValidateOrder checks an order against the pair's minimum volume and minimum cost
+func (p *AssetPair) ValidateOrder(price float64, volume float64) error {
+	if p.OrderMin > 0 && volume < p.OrderMin {
+		return fmt.Errorf("volume %s is below the minimum order size %g for %s", p.FormatVolume(volume), p.OrderMin, p.WSName)
+	}
+	if p.CostMin > 0 && price*volume < p.CostMin {
+		return fmt.Errorf("order cost %.8g is below the minimum order cost %g for %s", price*volume, p.CostMin, p.WSName)
+	}
+	return nil
+}
+
+// Quote is the quote currency of the traded pairs, e.g. USD, EUR, USDT or a crypto like BTC for
+// ETH/BTC, the trader sets it from -quote
+var Quote = "USD"
+
+// PairName returns the coin's pair in the quote currency, e.g. SOL/USD or ETH/XBT
+func PairName(coin string) string {
+	return coin + "/" + Altname(Quote)
+}
+
+// Altname converts standard coin codes to the altnames Kraken uses, e.g. BTC to XBT
+func Altname(code string) string {
+	code = strings.ToUpper(code)
+	switch code {
+	case "BTC":
+		return "XBT"
+	case "DOGE":
+		return "XDG"
+	}
+	return code
+}
@@ -0,0 +1,126 @@
+package kraken
+
+import (
+	"math"
+	"strings"
+	"testing"
+)
+
+// paxgPair is a two-decimal pair of an asset worth thousands of dollars
+var paxgPair = &AssetPair{
+	Name: "PAXGUSD", Altname: "PAXGUSD", WSName: "PAXG/USD", Base: "PAXG", Quote: "ZUSD",
+	PairDecimals: 2, LotDecimals: 8, OrderMin: 0.003, CostMin: 0.5, TickSize: 0.01,
+}
+
+// memePair is a meme coin priced at a few millionths of a dollar, traded in whole coins with a
+// large minimum order
+var memePair = &AssetPair{
+	Name: "MEMEUSD", Altname: "MEMEUSD", WSName: "MEME/USD", Base: "MEME", Quote: "ZUSD",
+	PairDecimals: 8, LotDecimals: 0, OrderMin: 500000, CostMin: 0.5, TickSize: 0.00000001,
+}
+
+func TestRoundAndFormatPrice(t *testing.T) {
+	tests := []struct {
+		name      string
+		pair      *AssetPair
+		price     float64
+		rounded   float64
+		formatted string
+	}{
+		{"paxg up", paxgPair, 2654.678, 2654.68, "2654.68"},
+		{"paxg down", paxgPair, 2654.674, 2654.67, "2654.67"},
+		{"paxg pads decimals", paxgPair, 2654.6, 2654.6, "2654.60"},
+		{"meme up", memePair, 0.0000123456, 0.00001235, "0.00001235"},
+		{"meme down", memePair, 0.0000123449, 0.00001234, "0.00001234"},
+		{"meme one tick", memePair, 0.00000001, 0.00000001, "0.00000001"},
+		{"meme below half a tick", memePair, 0.000000004, 0, "0.00000000"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rounded := tt.pair.RoundPrice(tt.price)
+			if math.Abs(rounded-tt.rounded) > 1e-12 {
+				t.Errorf("RoundPrice(%v) = %v, want %v", tt.price, rounded, tt.rounded)
+			}
+			if got := tt.pair.FormatPrice(rounded); got != tt.formatted {
+				t.Errorf("FormatPrice(%v) = %q, want %q", rounded, got, tt.formatted)
+			}
+		})
+	}
+}
+
+func TestRoundAndFormatVolume(t *testing.T) {
+	tests := []struct {
+		name      string
+		pair      *AssetPair
+		volume    float64
+		rounded   float64
+		formatted string
+	}{
+		{"paxg truncates", paxgPair, 0.123456789, 0.12345678, "0.12345678"},
+		{"paxg never rounds up", paxgPair, 0.003999999999, 0.00399999, "0.00399999"},
+		{"paxg exact", paxgPair, 0.3, 0.3, "0.30000000"},
+		{"meme whole coins", memePair, 1234567.9, 1234567, "1234567"},
+		{"meme exact", memePair, 500000, 500000, "500000"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rounded := tt.pair.RoundVolume(tt.volume)
+			if rounded != tt.rounded {
+				t.Errorf("RoundVolume(%v) = %v, want %v", tt.volume, rounded, tt.rounded)
+			}
+			if got := tt.pair.FormatVolume(rounded); got != tt.formatted {
+				t.Errorf("FormatVolume(%v) = %q, want %q", rounded, got, tt.formatted)
+			}
+		})
+	}
+}
+
+func TestValidateOrder(t *testing.T) {
+	tests := []struct {
+		name   string
+		pair   *AssetPair
+		price  float64
+		volume float64
+		err    string // substring of the error, empty for none
+	}{
+		{"paxg ok", paxgPair, 2654.68, 0.003, ""},
+		{"paxg below order min", paxgPair, 2654.68, 0.00299999, "below the minimum order size"},
+		{"meme ok", memePair, 0.00001235, 500000, ""},
+		{"meme below order min", memePair, 0.00001235, 499999, "volume 499999 is below the minimum order size 500000"},
+		{"meme below cost min", memePair, 0.00000001, 500000, "below the minimum order cost"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.pair.ValidateOrder(tt.price, tt.volume)
+			switch {
+			case tt.err == "" && err != nil:
+				t.Errorf("ValidateOrder(%v, %v) = %v, want nil", tt.price, tt.volume, err)
+			case tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)):
+				t.Errorf("ValidateOrder(%v, %v) = %v, want an error containing %q", tt.price, tt.volume, err, tt.err)
+			}
+		})
+	}
+}
+
+// Order payloads carry the pair's precision, not a fixed number of decimals or exponents
+func TestLimitOrderPayloadPrecision(t *testing.T) {
+	tests := []struct {
+		pair   *AssetPair
+		price  float64
+		volume float64
+		want   []string
+	}{
+		{paxgPair, 2654.6, 0.0035, []string{`"price": "2654.60"`, `"volume": "0.00350000"`}},
+		{memePair, 0.00001235, 500000, []string{`"price": "0.00001235"`, `"volume": "500000"`}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.pair.WSName, func(t *testing.T) {
+			payload := limitOrderPayload(1, "buy", tt.pair, tt.price, tt.volume, 0, "GTC")
+			for _, want := range tt.want {
+				if !strings.Contains(payload, want) {
+					t.Errorf("payload lacks %s:\n%s", want, payload)
+				}
+			}
+		})
+	}
+}
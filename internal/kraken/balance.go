@@ -1,78 +1,154 @@
 package kraken
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
+	"sort"
 	"strconv"
 	"strings"
 )
 
-// Balance represents a currency balance
+// Balance represents a currency balance from BalanceEx
 type Balance struct {
-	Currency  string
-	Available float64
+	Currency   string
+	Total      float64 // balance including amounts on hold
+	Hold       float64 // held by open orders
+	Credit     float64
+	CreditUsed float64
+	Available  float64 // Total + Credit - CreditUsed - Hold, what new orders can use
 }
 
-// GetBalance returns the available balance for a coin
-func GetBalance(balanceBody []byte, coin string) (*Balance, error) {
-	// Get balance string for the coin
-	balanceStr, err := getCoinBalance(balanceBody, coin)
-	if err != nil {
-		return nil, fmt.Errorf("error getting %s balance: %v", coin, err)
-	}
+// GetAccountBalance retrieves the raw extended balance (BalanceEx) response for the account
+func GetAccountBalance(ctx context.Context) ([]byte, error) {
+	urlPath := "/0/private/BalanceEx"
 
-	// Convert balance to float64
-	balanceFloat, err := strconv.ParseFloat(balanceStr, 64)
+	body, err := privateRequest(ctx, urlPath, true, func(nonce int64) string {
+		return fmt.Sprintf(`{
+			"nonce": "%d"
+		}`, nonce)
+	})
 	if err != nil {
-		return nil, fmt.Errorf("error converting %s balance: %v", coin, err)
+		return nil, fmt.Errorf("error making request: %v", err)
+	}
+	if errs := apiErrors(body); len(errs) > 0 {
+		return nil, fmt.Errorf("API error: %v", errs)
 	}
 
-	return &Balance{
-		Currency:  coin,
-		Available: balanceFloat,
-	}, nil
+	return body, nil
 }
 
-// getCoinBalance is a helper function to extract balance string from the response
-func getCoinBalance(body []byte, coin string) (string, error) {
+// GetAllBalances parses a BalanceEx response into balances keyed by asset code
+func GetAllBalances(balanceBody []byte) (map[string]Balance, error) {
 	var response struct {
 		Error  []string `json:"error"`
 		Result map[string]struct {
-			Balance string `json:"balance"`
+			Balance    string `json:"balance"`
+			HoldTrade  string `json:"hold_trade"`
+			Credit     string `json:"credit"`
+			CreditUsed string `json:"credit_used"`
 		} `json:"result"`
 	}
-
-	if err := json.Unmarshal(body, &response); err != nil {
-		return "", fmt.Errorf("error parsing response: %v", err)
+	if err := json.Unmarshal(balanceBody, &response); err != nil {
+		return nil, fmt.Errorf("error parsing response: %v", err)
+	}
+	if len(response.Error) > 0 {
+		return nil, fmt.Errorf("API error: %v", response.Error)
 	}
 
-	balanceData, exists := response.Result[coin]
-	if !exists {
-		return "", fmt.Errorf("balance for %s not found in response", coin)
+	balances := make(map[string]Balance, len(response.Result))
+	for code, raw := range response.Result {
+		values := make([]float64, 4)
+		for i, s := range []string{raw.Balance, raw.HoldTrade, raw.Credit, raw.CreditUsed} {
+			// Fields other than balance are omitted for most accounts
+			if s == "" {
+				continue
+			}
+			v, err := strconv.ParseFloat(s, 64)
+			if err != nil {
+				return nil, fmt.Errorf("error converting %s balance: %v", code, err)
+			}
+			values[i] = v
+		}
+		balances[code] = Balance{
+			Currency:   code,
+			Total:      values[0],
+			Hold:       values[1],
+			Credit:     values[2],
+			CreditUsed: values[3],
+			Available:  values[0] + values[2] - values[3] - values[1],
+		}
 	}
+	return balances, nil
+}
 
-	return balanceData.Balance, nil
+// AssetBalance is the balance of an asset summed over all variants Kraken reports it under: its
+// asset code (XXBT, ZUSD), its altname (XBT, USD), the Auto Earn variant (XBT.F, USD.F) and the
+// staked, bonded and opt-in rewards variants (.S, .B, .M, .P)
+type AssetBalance struct {
+	Asset     string    // altname, e.g. XBT or USD
+	Total     float64   // of the tradable variants, amounts on hold included
+	Hold      float64   // held by open orders
+	Available float64   // what new orders can use
+	Locked    float64   // staked or bonded, not tradable until unstaked
+	Variants  []Balance // by code
 }
 
-// KrakenAssetCode converts standard coin codes to Kraken's format
-func KrakenAssetCode(standardCode string) (string, error) {
-	hardcodedMap := map[string]string{
-		"BTC":     "XBT.F",
-		"ETH":     "ETH",
-		"SOL":     "SOL.F",
-		"SUNDOG":  "SUNDOG",
-		"TRUMP":   "TRUMP",
-		"GUN":     "GUN",
-		"OCEAN":   "OCEAN",
-		"GHIBLI":  "GHIBLI",
-		"TITCOIN": "TITCOIN",
-		"PAXG":    "PAXG",
-		"FWOG":    "FWOG",
+// GetBalance returns the balance of a coin, given by any of its codes (XXBT, XBT, BTC, XBT.F),
+// summed over all its variants from balances parsed by GetAllBalances. Codes are resolved through
+// the AssetPairs metadata, load it first.
+func GetBalance(balances map[string]Balance, coin string) (*AssetBalance, error) {
+	asset, _ := AssetVariant(coin)
+	result := &AssetBalance{Asset: asset}
+	for code, balance := range balances {
+		if variant, _ := AssetVariant(code); variant != asset {
+			continue
+		}
+		result.Variants = append(result.Variants, balance)
+		if Tradable(code) {
+			result.Total += balance.Total
+			result.Hold += balance.Hold
+			result.Available += balance.Available
+		} else {
+			result.Locked += balance.Total
+		}
+	}
+	if len(result.Variants) == 0 {
+		return nil, fmt.Errorf("balance for %s not found in response", coin)
 	}
+	sort.Slice(result.Variants, func(i, j int) bool { return result.Variants[i].Currency < result.Variants[j].Currency })
+	return result, nil
+}
+
+// Breakdown describes the variants, e.g. "XBT.F 0.2, XBT.S 1 (locked), XXBT 0.5 (0.1 on hold)"
+func (a *AssetBalance) Breakdown() string {
+	parts := make([]string, 0, len(a.Variants))
+	for _, v := range a.Variants {
+		part := v.Currency + " " + strconv.FormatFloat(v.Total, 'f', -1, 64)
+		switch {
+		case !Tradable(v.Currency):
+			part += " (locked)"
+		case v.Hold > 0:
+			part += " (" + strconv.FormatFloat(v.Hold, 'f', -1, 64) + " on hold)"
+		}
+		parts = append(parts, part)
+	}
+	return strings.Join(parts, ", ")
+}
 
-	code, ok := hardcodedMap[strings.ToUpper(standardCode)]
-	if !ok {
-		return "", fmt.Errorf("unknown standard code: %s", standardCode)
+// AssetVariant splits a balance code into the asset's altname and the variant suffix, e.g. XXBT
+// to XBT and "", XBT.F to XBT and F
+func AssetVariant(code string) (string, string) {
+	suffix := ""
+	if i := strings.Index(code, "."); i != -1 {
+		code, suffix = code[:i], code[i+1:]
 	}
-	return code, nil
+	return AssetAltname(code), suffix
+}
+
+// Tradable reports whether a balance code's variant can be traded: the plain asset and its Auto
+// Earn variant (.F), not the staked, bonded or opt-in rewards ones
+func Tradable(code string) bool {
+	_, suffix := AssetVariant(code)
+	return suffix == "" || suffix == "F"
 }
@@ -0,0 +1,85 @@
+package kraken
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+)
+
+// PriceBands holds percentile-based price boundaries computed from recent candles
+type PriceBands struct {
+	Lower      float64 // (100-Percentile)th percentile of candle lows
+	Upper      float64 // Percentile-th percentile of candle highs
+	Percentile float64
+	Window     time.Duration
+}
+
+// GetPriceBands computes volatility bands from the 1-minute candles within window.
+// E.g. percentile 95 gives the 5th percentile of lows and the 95th percentile of highs.
+func GetPriceBands(ctx context.Context, coin string, window time.Duration, percentile float64) (*PriceBands, error) {
+	if percentile <= 50 || percentile > 100 {
+		return nil, fmt.Errorf("band percentile must be between 50 and 100, got %.2f", percentile)
+	}
+
+	candles, err := GetMinuteCandles(ctx, coin)
+	if err != nil {
+		return nil, err
+	}
+	return PriceBandsFrom(candles, window, percentile)
+}
+
+// PriceBandsFrom computes volatility bands from the 1-minute candles within window of the
+// latest one, oldest first. A window longer than the candles uses all of them.
+func PriceBandsFrom(candles []OHLCData, window time.Duration, percentile float64) (*PriceBands, error) {
+	if percentile <= 50 || percentile > 100 {
+		return nil, fmt.Errorf("band percentile must be between 50 and 100, got %.2f", percentile)
+	}
+
+	if len(candles) == 0 {
+		return nil, fmt.Errorf("no OHLC data to compute price bands")
+	}
+	// Selected by time rather than count, cached histories may have gaps
+	count := int(window.Minutes())
+	recent := candles
+	if count >= 1 {
+		since := candles[len(candles)-1].Time - int64(count-1)*60
+		first := sort.Search(len(candles), func(i int) bool { return candles[i].Time >= since })
+		recent = candles[first:]
+	}
+
+	lows := make([]float64, len(recent))
+	highs := make([]float64, len(recent))
+	for i, candle := range recent {
+		lows[i] = candle.Low
+		highs[i] = candle.High
+	}
+
+	return &PriceBands{
+		Lower:      percentileOf(lows, 100-percentile),
+		Upper:      percentileOf(highs, percentile),
+		Percentile: percentile,
+		Window:     time.Duration(recent[len(recent)-1].Time-recent[0].Time)*time.Second + time.Minute,
+	}, nil
+}
+
+// Clamp keeps a buy price at or below the upper band and a sell price at or above the lower band,
+// so the bot doesn't buy into a spike or sell into a crash
+func (b *PriceBands) Clamp(buyPrice float64, sellPrice float64) (float64, float64) {
+	return math.Min(buyPrice, b.Upper), math.Max(sellPrice, b.Lower)
+}
+
+// percentileOf returns the p-th percentile of values using linear interpolation
+func percentileOf(values []float64, p float64) float64 {
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+
+	rank := p / 100 * float64(len(sorted)-1)
+	lower := int(math.Floor(rank))
+	upper := int(math.Ceil(rank))
+	if lower == upper {
+		return sorted[lower]
+	}
+	return sorted[lower] + (sorted[upper]-sorted[lower])*(rank-float64(lower))
+}
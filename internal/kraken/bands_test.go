@@ -0,0 +1,31 @@
+package kraken
+
+import (
+	"testing"
+	"time"
+)
+
+// BenchmarkPriceBandsFrom computes the volatility bands over a day of 1-minute candles, like a
+// warm market cache keeps
+func BenchmarkPriceBandsFrom(b *testing.B) {
+	start := time.Now().Add(-24 * time.Hour).Truncate(time.Minute)
+	candles := make([]OHLCData, 0, 24*60)
+	for i := 0; i < 24*60; i++ {
+		base := 0.003 + float64(i%90)*0.000001
+		candles = append(candles, OHLCData{
+			Time:   start.Add(time.Duration(i) * time.Minute).Unix(),
+			Open:   base,
+			High:   base * 1.004,
+			Low:    base * 0.996,
+			Close:  base * 1.001,
+			Volume: 1000 + float64(i%17)*100,
+		})
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := PriceBandsFrom(candles, 24*time.Hour, 90); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,272 @@
+package kraken
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/jkosik/crypto-trader/internal/logging"
+)
+
+// LoneLegAction is what happens when only one leg of a spread could be placed: "cancel" cancels the
+// placed leg, "reprice" places the failed leg again at the price of a fresh quote
+var LoneLegAction = "cancel"
+
+// loneLeg is a leg of a spread placed while its counterpart failed
+type loneLeg struct {
+	side       string
+	txId       string
+	price      float64
+	failedSide string
+	reason     string
+}
+
+// batchLeg is a leg of a spread as submitted in an AddOrderBatch request
+type batchLeg struct {
+	orderType string
+	price     float64
+	volume    float64
+}
+
+// placeSpreadLegs places the buy and sell leg of a spread in a single AddOrderBatch request.
+// Kraken validates the whole batch before placing any order, but a leg can still fail on its own;
+// a leg placed alone is returned for resolveLoneLeg instead of the transaction IDs. With ValidateOnly
+// the legs are only validated and no transaction IDs are returned.
+func placeSpreadLegs(ctx context.Context, pair *AssetPair, buyPrice float64, sellPrice float64, volume float64, untradeable bool, userref int32) (string, string, *loneLeg, error) {
+	urlPath := "/0/private/AddOrderBatch"
+	log := logging.FromContext(ctx)
+
+	// Paper orders never reach the exchange, they are placed one by one
+	if Paper() {
+		buyTxId, err := PlaceLimitOrder(ctx, pair, buyPrice, volume, true, untradeable, userref)
+		if err != nil {
+			return "", "", nil, fmt.Errorf("error placing buy order: %v", err)
+		}
+		sellTxId, err := PlaceLimitOrder(ctx, pair, sellPrice, volume, false, untradeable, userref)
+		if err != nil {
+			return "", "", &loneLeg{side: "buy", txId: buyTxId, price: buyPrice, failedSide: "sell", reason: err.Error()}, nil
+		}
+		return buyTxId, sellTxId, nil, nil
+	}
+
+	var legs [2]batchLeg
+	for i, price := range []float64{buyPrice, sellPrice} {
+		orderType, price, legVolume, err := prepareLimitOrder(ctx, pair, price, volume, i == 0, untradeable)
+		if err != nil {
+			return "", "", nil, err
+		}
+		legs[i] = batchLeg{orderType: orderType, price: price, volume: legVolume}
+	}
+
+	// Respect the per-pair trading counter, each order of the batch counts
+	if err := waitOrder(ctx, pair.Name, 2); err != nil {
+		return "", "", nil, err
+	}
+
+	// Network errors are not retried to avoid duplicate orders, the legs are looked up by their
+	// userref, side, price and volume instead
+	sent := time.Now()
+	body, err := privateRequest(ctx, urlPath, false, func(nonce int64) string {
+		return fmt.Sprintf(`{
+			"nonce": "%d",
+			"pair": "%s",
+			"orders": [{
+			%s
+		}, {
+			%s
+		}]%s
+		}`, nonce, pair.Altname,
+			limitOrderFields(legs[0].orderType, pair, legs[0].price, legs[0].volume, userref, TimeInForce),
+			limitOrderFields(legs[1].orderType, pair, legs[1].price, legs[1].volume, userref, TimeInForce),
+			validateField())
+	})
+
+	var txIds, legErrs [2]string
+	if err != nil && ValidateOnly {
+		return "", "", nil, fmt.Errorf("error making request: %v", err)
+	}
+	if err != nil {
+		for i, leg := range legs {
+			txId, _, findErr := findPlacedOrder(ctx, userref, leg.orderType, "limit", leg.price, leg.volume, sent)
+			if findErr != nil {
+				log.Warn("Failed to look up the order after a request error", "type", leg.orderType, "userref", userref, "error", findErr)
+			}
+			txIds[i], legErrs[i] = txId, err.Error()
+		}
+		if txIds[0] == "" && txIds[1] == "" {
+			return "", "", nil, fmt.Errorf("error making request: %v", err)
+		}
+		log.Warn("Orders were placed despite the request error", "buy_txid", txIds[0], "sell_txid", txIds[1], "error", err)
+	} else {
+		var response struct {
+			Error  []string `json:"error"`
+			Result struct {
+				Orders []struct {
+					TxID  string `json:"txid"`
+					Error string `json:"error"`
+					Descr struct {
+						Order string `json:"order"`
+					} `json:"descr"`
+				} `json:"orders"`
+			} `json:"result"`
+		}
+		if err := json.Unmarshal(body, &response); err != nil {
+			return "", "", nil, fmt.Errorf("error parsing response: %v", err)
+		}
+		// A rejected batch places no order at all
+		if len(response.Error) > 0 {
+			return "", "", nil, fmt.Errorf("API error: %v", response.Error)
+		}
+		if ValidateOnly {
+			// Validated orders have no transaction IDs, placed ones must not be left untracked
+			var placed []string
+			for _, order := range response.Result.Orders {
+				if order.TxID != "" {
+					placed = append(placed, order.TxID)
+				}
+			}
+			if len(placed) > 0 {
+				for _, txId := range placed {
+					if err := CancelOrder(ctx, txId); err != nil {
+						log.Error("Failed to cancel an order placed by a validate-only batch", "txid", txId, "error", err)
+					}
+				}
+				return "", "", nil, fmt.Errorf("validate-only batch placed orders %v, canceled them", placed)
+			}
+			for i, leg := range legs {
+				if i < len(response.Result.Orders) && response.Result.Orders[i].Error != "" {
+					legErrs[i] = response.Result.Orders[i].Error
+					continue
+				}
+				log.Info("Validated order",
+					"type", leg.orderType,
+					"price", pair.FormatPrice(leg.price),
+					"volume", pair.FormatVolume(leg.volume))
+			}
+			if legErrs[0] != "" || legErrs[1] != "" {
+				return "", "", nil, fmt.Errorf("error validating orders: buy: %s, sell: %s", legErrs[0], legErrs[1])
+			}
+			return "", "", nil, nil
+		}
+		// Results come in the order of the submitted orders
+		for i := range legs {
+			if i < len(response.Result.Orders) {
+				txIds[i], legErrs[i] = response.Result.Orders[i].TxID, response.Result.Orders[i].Error
+			}
+			if txIds[i] == "" && legErrs[i] == "" {
+				legErrs[i] = "no transaction ID returned"
+			}
+		}
+	}
+
+	for i, leg := range legs {
+		if txIds[i] == "" {
+			continue
+		}
+		recordOrderPlaced(txIds[i], pair.Name)
+		log.Info("Placed order",
+			"type", leg.orderType,
+			"txid", txIds[i],
+			"price", pair.FormatPrice(leg.price),
+			"volume", pair.FormatVolume(leg.volume),
+			"untradeable", untradeable,
+			"post_only", PostOnly,
+			"time_in_force", TimeInForce,
+			"userref", userref)
+	}
+
+	switch {
+	case txIds[0] != "" && txIds[1] != "":
+		return txIds[0], txIds[1], nil, nil
+	case txIds[0] != "":
+		return "", "", &loneLeg{side: "buy", txId: txIds[0], price: legs[0].price, failedSide: "sell", reason: legErrs[1]}, nil
+	case txIds[1] != "":
+		return "", "", &loneLeg{side: "sell", txId: txIds[1], price: legs[1].price, failedSide: "buy", reason: legErrs[0]}, nil
+	}
+	return "", "", nil, fmt.Errorf("error placing orders: buy: %s, sell: %s", legErrs[0], legErrs[1])
+}
+
+// resolveLoneLeg handles a leg placed without its counterpart according to LoneLegAction and
+// reports the incident on Slack. With "reprice" the failed leg is placed again at the price of a
+// fresh quote, as long as the spread stays profitable after fees; otherwise, or if placing it fails
+// again, the placed leg is canceled. It returns the transaction ID and price of the re-placed leg.
+func resolveLoneLeg(ctx context.Context, coin string, pair *AssetPair, lone *loneLeg, volume float64, untradeable bool, narrowFactor float64, bands *PriceBands, makerFeePercent float64, userref int32) (string, float64, error) {
+	log := logging.FromContext(ctx)
+	log.Error("Spread leg placed without its counterpart",
+		"type", lone.side,
+		"txid", lone.txId,
+		"failed_type", lone.failedSide,
+		"reason", lone.reason,
+		"action", LoneLegAction)
+	RecordDecision("lone_leg", map[string]string{"side": lone.side, "txid": lone.txId, "action": LoneLegAction})
+
+	reason := lone.reason
+	if LoneLegAction == "reprice" {
+		txId, price, err := repriceFailedLeg(ctx, coin, pair, lone, volume, untradeable, narrowFactor, bands, makerFeePercent, userref)
+		if err == nil {
+			log.Info("Re-placed the failed leg", "type", lone.failedSide, "txid", txId, "price", pair.FormatPrice(price))
+			notifyLoneLeg(ctx, coin, pair, lone, fmt.Sprintf("The %s order was re-placed at %s: %s", lone.failedSide, pair.FormatPrice(price), txId))
+			return txId, price, nil
+		}
+		log.Warn("Failed to re-place the failed leg", "type", lone.failedSide, "error", err)
+		reason = fmt.Sprintf("%s; re-placing it failed: %v", reason, err)
+	}
+
+	err := cancelLoneLeg(ctx, lone.side, lone.txId, lone.failedSide, reason)
+	notifyLoneLeg(ctx, coin, pair, lone, err.Error())
+	return "", 0, err
+}
+
+// repriceFailedLeg places the failed leg of a spread again at the price of a fresh quote
+func repriceFailedLeg(ctx context.Context, coin string, pair *AssetPair, lone *loneLeg, volume float64, untradeable bool, narrowFactor float64, bands *PriceBands, makerFeePercent float64, userref int32) (string, float64, error) {
+	spreadInfo, err := GetTickerInfo(ctx, coin)
+	if err != nil {
+		return "", 0, fmt.Errorf("error getting ticker: %v", err)
+	}
+	buyPrice, sellPrice := SpreadOrderPrices(pair, spreadInfo, narrowFactor, bands)
+	isBuy := lone.failedSide == "buy"
+	price := sellPrice
+	if isBuy {
+		price, sellPrice = buyPrice, lone.price
+	} else {
+		buyPrice = lone.price
+	}
+	if _, _, net := SpreadNetProfit(buyPrice, sellPrice, volume, makerFeePercent); net <= 0 {
+		return "", 0, fmt.Errorf("the fresh %s price %s leaves no profit against the %s at %s", lone.failedSide, pair.FormatPrice(price), lone.side, pair.FormatPrice(lone.price))
+	}
+	txId, err := PlaceLimitOrder(ctx, pair, price, volume, isBuy, untradeable, userref)
+	if err != nil {
+		return "", 0, err
+	}
+	return txId, price, nil
+}
+
+// notifyLoneLeg reports a spread placed with one leg only on Slack
+func notifyLoneLeg(ctx context.Context, coin string, pair *AssetPair, lone *loneLeg, outcome string) {
+	slackErr := SendSlackMessage(ctx, fmt.Sprintf(
+		"⚠️ Only one leg of the %s spread was placed\n"+
+			"Placed %s order: %s at %s\n"+
+			"Failed %s order: %s\n"+
+			"%s",
+		PairName(coin),
+		lone.side, lone.txId, pair.FormatPrice(lone.price),
+		lone.failedSide, lone.reason,
+		outcome,
+	))
+	if slackErr != nil {
+		logging.FromContext(ctx).Warn("Failed to send Slack notification", "error", slackErr)
+	}
+}
+
+// cancelLoneLeg cancels a leg placed without its counterpart and returns the placement error.
+// If the cancellation fails too, the error names the order left open.
+func cancelLoneLeg(ctx context.Context, side string, txId string, failedSide string, reason string) error {
+	log := logging.FromContext(ctx)
+	log.Warn("Canceling the leg placed without its counterpart", "type", side, "txid", txId, "failed_type", failedSide, "reason", reason)
+	if err := CancelOrder(ctx, txId); err != nil {
+		log.Error("Failed to cancel the leg placed alone, it's left open unhedged", "type", side, "txid", txId, "error", err)
+		return fmt.Errorf("error placing %s order: %s; the %s order %s is left open, canceling it failed: %v", failedSide, reason, side, txId, err)
+	}
+	return fmt.Errorf("error placing %s order: %s; the %s order %s was canceled", failedSide, reason, side, txId)
+}
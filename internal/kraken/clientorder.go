@@ -0,0 +1,83 @@
+package kraken
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// UserRef returns the Kraken userref shared by the orders of a trade. It's derived from the trade
+// ID, so the legs of one trade can be matched in QueryOrders, OpenOrders and ClosedOrders
+// (which filter by userref) and traced back to the journal. Trade IDs that aren't hex get 0.
+func UserRef(tradeID string) int32 {
+	if len(tradeID) > 8 {
+		tradeID = tradeID[:8]
+	}
+	ref, err := strconv.ParseUint(tradeID, 16, 32)
+	if err != nil {
+		return 0
+	}
+	// userref is a signed 32-bit integer, keep it positive
+	return int32(ref & 0x7fffffff)
+}
+
+// placementSlack allows for clock skew between this host and the exchange when an order's opentm
+// is compared with the local time its request was sent
+const placementSlack = 5 * time.Second
+
+// findPlacedOrder looks up an order whose request failed in transit among the open and then the
+// closed orders tagged with userref: the newest order of the side, order type, price and volume
+// opened since the request was sent and not already known to this process. A zero price matches
+// any price (market orders). It returns an empty transaction ID if the exchange has no such order.
+func findPlacedOrder(ctx context.Context, userref int32, orderType string, kind string, price float64, volume float64, sent time.Time) (string, *OrderStatus, error) {
+	since := sent.Add(-placementSlack)
+	for _, urlPath := range []string{"/0/private/OpenOrders", "/0/private/ClosedOrders"} {
+		body, err := privateRequest(ctx, urlPath, true, func(nonce int64) string {
+			return fmt.Sprintf(`{
+			"nonce": "%d",
+			"userref": %d,
+			"start": %d
+		}`, nonce, userref, since.Unix())
+		})
+		if err != nil {
+			return "", nil, fmt.Errorf("error making request: %v", err)
+		}
+
+		var response struct {
+			Error  []string `json:"error"`
+			Result struct {
+				Open   map[string]OrderStatus `json:"open"`
+				Closed map[string]OrderStatus `json:"closed"`
+			} `json:"result"`
+		}
+		if err := json.Unmarshal(body, &response); err != nil {
+			return "", nil, fmt.Errorf("error parsing response: %v", err)
+		}
+		if len(response.Error) > 0 {
+			return "", nil, fmt.Errorf("API error: %v", response.Error)
+		}
+
+		var found string
+		var match OrderStatus
+		orders := response.Result.Open
+		if urlPath == "/0/private/ClosedOrders" {
+			orders = response.Result.Closed
+		}
+		for txId, order := range orders {
+			if order.UserRef != userref || order.Descr.Type != orderType || order.Descr.OrderType != kind ||
+				ParseFloat(order.Vol) != volume || (price > 0 && ParseFloat(order.Descr.Price) != price) ||
+				order.OpenTm < float64(since.UnixNano())/1e9 || orderPlaced(txId) {
+				continue
+			}
+			if found == "" || order.OpenTm > match.OpenTm {
+				found, match = txId, order
+			}
+		}
+		if found != "" {
+			return found, &match, nil
+		}
+	}
+	return "", nil, nil
+}
@@ -0,0 +1,88 @@
+package kraken
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// ClosedOrder is an order of the account that was filled, canceled or expired
+type ClosedOrder struct {
+	TxID string
+	OrderStatus
+}
+
+// Opened returns the time the order was placed
+func (o ClosedOrder) Opened() time.Time {
+	return time.Unix(0, int64(o.OpenTm*float64(time.Second)))
+}
+
+// Closed returns the time the order was closed
+func (o ClosedOrder) Closed() time.Time {
+	return time.Unix(0, int64(o.CloseTm*float64(time.Second)))
+}
+
+// closedOrdersPageSize is the number of orders Kraken returns per ClosedOrders call
+const closedOrdersPageSize = 50
+
+// GetClosedOrders retrieves the account's orders closed between start and end (zero = open),
+// oldest first
+func GetClosedOrders(ctx context.Context, start time.Time, end time.Time) ([]ClosedOrder, error) {
+	urlPath := "/0/private/ClosedOrders"
+
+	var orders []ClosedOrder
+	// Like TradesHistory, orders closed while paging shift seen ones onto the next page
+	seen := map[string]bool{}
+	for offset := 0; ; offset += closedOrdersPageSize {
+		body, err := privateRequest(ctx, urlPath, true, func(nonce int64) string {
+			payload := fmt.Sprintf(`{
+			"nonce": "%d",
+			"closetime": "close",
+			"ofs": %d`, nonce, offset)
+			if !start.IsZero() {
+				payload += fmt.Sprintf(`,
+			"start": %d`, start.Unix())
+			}
+			if !end.IsZero() {
+				payload += fmt.Sprintf(`,
+			"end": %d`, end.Unix())
+			}
+			return payload + `
+		}`
+		})
+		if err != nil {
+			return nil, fmt.Errorf("error making request: %v", err)
+		}
+
+		var response struct {
+			Error  []string `json:"error"`
+			Result struct {
+				Closed map[string]OrderStatus `json:"closed"`
+				Count  int                    `json:"count"`
+			} `json:"result"`
+		}
+		if err := json.Unmarshal(body, &response); err != nil {
+			return nil, fmt.Errorf("error parsing response: %v", err)
+		}
+		if len(response.Error) > 0 {
+			return nil, fmt.Errorf("API error: %v", response.Error)
+		}
+
+		for txId, order := range response.Result.Closed {
+			if seen[txId] {
+				continue
+			}
+			seen[txId] = true
+			orders = append(orders, ClosedOrder{TxID: txId, OrderStatus: order})
+		}
+
+		if len(response.Result.Closed) < closedOrdersPageSize || offset+closedOrdersPageSize >= response.Result.Count {
+			break
+		}
+	}
+
+	sort.Slice(orders, func(i, j int) bool { return orders[i].CloseTm < orders[j].CloseTm })
+	return orders, nil
+}
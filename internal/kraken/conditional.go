@@ -0,0 +1,113 @@
+package kraken
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/jkosik/crypto-trader/internal/logging"
+)
+
+// Conditional order types. Stop-loss and take-profit orders become market orders once the market
+// trades through their trigger price, the -limit variants become limit orders at their limit price.
+const (
+	StopLoss        = "stop-loss"
+	TakeProfit      = "take-profit"
+	StopLossLimit   = "stop-loss-limit"
+	TakeProfitLimit = "take-profit-limit"
+)
+
+// ConditionalOrderTypes lists the conditional order types
+var ConditionalOrderTypes = map[string]bool{StopLoss: true, TakeProfit: true, StopLossLimit: true, TakeProfitLimit: true}
+
+// Conditional close attached to every placed limit order (close[ordertype] and close[price] of
+// AddOrder): once the order fills, Kraken places the opposite order for the filled volume,
+// triggered ClosePercent away from the order's price. A stop-loss triggers against the position
+// (below a filled buy, above a filled sell), a take-profit in its favor. Empty disables.
+var (
+	CloseOrderType string
+	ClosePercent   float64
+)
+
+// CloseTrigger returns the trigger price of the conditional close of an order at price
+func CloseTrigger(isBuy bool, price float64) float64 {
+	stop := CloseOrderType == StopLoss || CloseOrderType == StopLossLimit
+	if stop == isBuy {
+		return price * (1 - ClosePercent/100)
+	}
+	return price * (1 + ClosePercent/100)
+}
+
+// closeFields builds the conditional close of an order at price, the limit variants are limited
+// at their trigger price
+func closeFields(pair *AssetPair, isBuy bool, price float64) string {
+	trigger := pair.FormatPrice(pair.RoundPrice(CloseTrigger(isBuy, price)))
+	price2 := ""
+	if CloseOrderType == StopLossLimit || CloseOrderType == TakeProfitLimit {
+		price2 = fmt.Sprintf(`,
+				"price2": "%s"`, trigger)
+	}
+	return fmt.Sprintf(`,
+			"close": {
+				"ordertype": "%s",
+				"price": "%s"%s
+			}`, CloseOrderType, trigger, price2)
+}
+
+// PlaceConditionalOrder places a stop-loss or take-profit order (or their -limit variants) for
+// volume, triggered at trigger. Limit variants become a limit order at limit once triggered, the
+// others ignore limit. Prices and volume are rounded to the pair's precision and checked against
+// its minimums at the trigger price.
+func PlaceConditionalOrder(ctx context.Context, pair *AssetPair, orderType string, trigger float64, limit float64, volume float64, isBuy bool, userref int32) (string, error) {
+	if !ConditionalOrderTypes[orderType] {
+		return "", fmt.Errorf("unknown conditional order type %q", orderType)
+	}
+	trigger = pair.RoundPrice(trigger)
+	volume = pair.RoundVolume(volume)
+	if err := pair.ValidateOrder(trigger, volume); err != nil {
+		return "", err
+	}
+	fields := fmt.Sprintf(`"ordertype": "%s",
+			"price": "%s",
+			"volume": "%s"`, orderType, pair.FormatPrice(trigger), pair.FormatVolume(volume))
+	if orderType == StopLossLimit || orderType == TakeProfitLimit {
+		fields += fmt.Sprintf(`,
+			"price2": "%s"`, pair.FormatPrice(pair.RoundPrice(limit)))
+	}
+	return addOrder(ctx, pair, isBuy, userref, orderType, trigger, volume, fields)
+}
+
+// CancelConditionalCloses cancels the coin's open orders tagged with userref other than keep, the
+// conditional closes Kraken placed for filled orders of a trade (they carry the userref of their
+// order). A trade whose legs both filled cancels them, they would otherwise close a position it
+// no longer has. It returns the canceled transaction IDs.
+func CancelConditionalCloses(ctx context.Context, coin string, userref int32, keep ...string) ([]string, error) {
+	if Paper() || CloseOrderType == "" {
+		return nil, nil
+	}
+	open, err := GetOpenOrders(ctx, coin)
+	if err != nil {
+		return nil, err
+	}
+	kept := map[string]bool{}
+	for _, txId := range keep {
+		kept[txId] = true
+	}
+	txIds := make([]string, 0, len(open))
+	for txId, order := range open {
+		if order.UserRef == userref && !kept[txId] {
+			txIds = append(txIds, txId)
+		}
+	}
+	sort.Strings(txIds)
+
+	var canceled []string
+	for _, txId := range txIds {
+		if err := CancelOrder(ctx, txId); err != nil {
+			return canceled, fmt.Errorf("error canceling conditional close %s: %v", txId, err)
+		}
+		logging.FromContext(ctx).Info("Canceled conditional close", "txid", txId, "userref", userref)
+		canceled = append(canceled, txId)
+	}
+	return canceled, nil
+}
@@ -0,0 +1,132 @@
+package kraken
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/jkosik/crypto-trader/internal/logging"
+)
+
+// deadMansSwitch keeps Kraken's CancelAllOrdersAfter timer from firing while the process lives
+type deadMansSwitch struct {
+	stop    chan struct{}
+	done    chan struct{}
+	holders int // trades that armed the switch and haven't disarmed it yet
+}
+
+// activeSwitch is the process-wide dead man's switch, nil unless armed. Trades running side by side
+// (cmd/loop, cmd/monitor) share it, it is disarmed on the exchange once the last of them is done.
+var (
+	activeSwitch   *deadMansSwitch
+	activeSwitchMu sync.Mutex
+)
+
+// CancelAllOrdersAfter sets the exchange's dead man's switch: unless called again within timeout,
+// Kraken cancels all open orders of the account. A zero timeout disarms it. It returns the time
+// the orders will be canceled at, zero when disarmed.
+func CancelAllOrdersAfter(ctx context.Context, timeout time.Duration) (time.Time, error) {
+	urlPath := "/0/private/CancelAllOrdersAfter"
+
+	// Resetting the timer is idempotent, retry it like reads
+	body, err := privateRequest(ctx, urlPath, true, func(nonce int64) string {
+		return fmt.Sprintf(`{
+			"nonce": "%d",
+			"timeout": %d
+		}`, nonce, int64(math.Ceil(timeout.Seconds())))
+	})
+	if err != nil {
+		return time.Time{}, fmt.Errorf("error making request: %v", err)
+	}
+
+	var response struct {
+		Error  []string `json:"error"`
+		Result struct {
+			CurrentTime string `json:"currentTime"`
+			TriggerTime string `json:"triggerTime"`
+		} `json:"result"`
+	}
+	if err := json.Unmarshal(body, &response); err != nil {
+		return time.Time{}, fmt.Errorf("error parsing response: %v", err)
+	}
+	if len(response.Error) > 0 {
+		return time.Time{}, fmt.Errorf("API error: %v", response.Error)
+	}
+
+	// Disarming reports a zero trigger time
+	trigger, err := time.Parse(time.RFC3339, response.Result.TriggerTime)
+	if err != nil || trigger.Unix() <= 0 {
+		return time.Time{}, nil
+	}
+	return trigger, nil
+}
+
+// ArmDeadMansSwitch arms the exchange's dead man's switch and keeps resetting it every quarter of
+// timeout until DisarmDeadMansSwitch. If the process crashes or loses connectivity, Kraken
+// cancels all open orders of the account once timeout passes without a reset. If the switch is
+// already armed, the caller only becomes one more holder of it, every call must be paired with a
+// DisarmDeadMansSwitch.
+func ArmDeadMansSwitch(ctx context.Context, timeout time.Duration) error {
+	log := logging.FromContext(ctx)
+
+	activeSwitchMu.Lock()
+	defer activeSwitchMu.Unlock()
+	if activeSwitch != nil {
+		activeSwitch.holders++
+		return nil
+	}
+
+	trigger, err := CancelAllOrdersAfter(ctx, timeout)
+	if err != nil {
+		return err
+	}
+	log.Info("Armed dead man's switch", "timeout", timeout, "trigger_time", trigger)
+
+	// The resets outlive the arming trade while others hold the switch, only disarming stops them
+	ctx = context.WithoutCancel(ctx)
+	s := &deadMansSwitch{stop: make(chan struct{}), done: make(chan struct{}), holders: 1}
+	go func() {
+		defer close(s.done)
+		ticker := time.NewTicker(timeout / 4)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-s.stop:
+				return
+			case <-ticker.C:
+			}
+			// A failed reset is retried on the next tick, the timer only fires after several
+			if _, err := CancelAllOrdersAfter(ctx, timeout); err != nil {
+				log.Warn("Failed to reset dead man's switch", "timeout", timeout, "error", err)
+			}
+		}
+	}()
+	activeSwitch = s
+	return nil
+}
+
+// DisarmDeadMansSwitch releases a hold of the dead man's switch. The last holder stops resetting it
+// and disarms it on the exchange, orders left open on purpose stay open. It does nothing unless
+// the switch is armed.
+func DisarmDeadMansSwitch(ctx context.Context) error {
+	activeSwitchMu.Lock()
+	defer activeSwitchMu.Unlock()
+	if activeSwitch == nil {
+		return nil
+	}
+	if activeSwitch.holders--; activeSwitch.holders > 0 {
+		return nil
+	}
+	close(activeSwitch.stop)
+	<-activeSwitch.done
+	activeSwitch = nil
+
+	if _, err := CancelAllOrdersAfter(ctx, 0); err != nil {
+		return err
+	}
+	logging.FromContext(ctx).Info("Disarmed dead man's switch")
+	return nil
+}
@@ -0,0 +1,118 @@
+package kraken
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"time"
+)
+
+// BookLevel is a price level of the order book
+type BookLevel struct {
+	Price  float64   `json:"price"`
+	Volume float64   `json:"volume"`
+	Time   time.Time `json:"time"` // last update of the level
+}
+
+// OrderBook is the top of a pair's order book, best prices first
+type OrderBook struct {
+	Bids []BookLevel `json:"bids"`
+	Asks []BookLevel `json:"asks"`
+}
+
+// GetOrderBook retrieves up to count levels on each side of a pair's order book (e.g. XBTUSD)
+func GetOrderBook(ctx context.Context, pair string, count int) (*OrderBook, error) {
+	url := fmt.Sprintf("%s/0/public/Depth?pair=%s&count=%d", BaseURL, pair, count)
+
+	body, err := publicRequest(ctx, url)
+	if err != nil {
+		return nil, fmt.Errorf("error getting order book: %v", err)
+	}
+
+	var response struct {
+		Error  []string `json:"error"`
+		Result map[string]struct {
+			Asks [][]interface{} `json:"asks"` // price, volume, timestamp
+			Bids [][]interface{} `json:"bids"` // price, volume, timestamp
+		} `json:"result"`
+	}
+	if err := json.Unmarshal(body, &response); err != nil {
+		return nil, fmt.Errorf("error parsing order book response: %v", err)
+	}
+	if len(response.Error) > 0 {
+		return nil, fmt.Errorf("API error: %v", response.Error)
+	}
+
+	for _, book := range response.Result {
+		return &OrderBook{Bids: bookLevels(book.Bids), Asks: bookLevels(book.Asks)}, nil
+	}
+	return nil, fmt.Errorf("pair %s not found in order book response", pair)
+}
+
+// bookLevels parses the raw levels of one side of the book, skipping malformed ones
+func bookLevels(raw [][]interface{}) []BookLevel {
+	levels := make([]BookLevel, 0, len(raw))
+	for _, level := range raw {
+		if len(level) < 3 {
+			continue
+		}
+		priceStr, _ := level[0].(string)
+		volumeStr, _ := level[1].(string)
+		ts, _ := level[2].(float64)
+		levels = append(levels, BookLevel{
+			Price:  ParseFloat(priceStr),
+			Volume: ParseFloat(volumeStr),
+			Time:   time.Unix(int64(ts), 0).UTC(),
+		})
+	}
+	return levels
+}
+
+// DepthWeighted returns the volume-weighted average price of the best levels of one side of the
+// book holding minVolume, so levels of negligible size at the touch don't set the price. It
+// returns false if the levels hold less than minVolume.
+func DepthWeighted(levels []BookLevel, minVolume float64) (float64, bool) {
+	var volume, cost float64
+	for _, level := range levels {
+		take := math.Min(level.Volume, minVolume-volume)
+		volume += take
+		cost += take * level.Price
+		if volume >= minVolume {
+			return cost / volume, true
+		}
+	}
+	return 0, false
+}
+
+// DepthSpread returns the quote of the book's depth-weighted bid and ask, each holding minVolume.
+// High and low prices are taken over from quote. It returns an error if either side is too thin.
+func (b *OrderBook) DepthSpread(quote *SpreadInfo, minVolume float64) (*SpreadInfo, error) {
+	bid, ok := DepthWeighted(b.Bids, minVolume)
+	if !ok {
+		return nil, fmt.Errorf("bids hold less than %g within %d levels", minVolume, len(b.Bids))
+	}
+	ask, ok := DepthWeighted(b.Asks, minVolume)
+	if !ok {
+		return nil, fmt.Errorf("asks hold less than %g within %d levels", minVolume, len(b.Asks))
+	}
+	return &SpreadInfo{
+		BidPrice:  bid,
+		AskPrice:  ask,
+		Spread:    ask - bid,
+		HighPrice: quote.HighPrice,
+		LowPrice:  quote.LowPrice,
+	}, nil
+}
+
+// TopVolume returns the volume resting on the best levels of each side of the book
+func (b *OrderBook) TopVolume(levels int) (float64, float64) {
+	sum := func(side []BookLevel) float64 {
+		total := 0.0
+		for i := 0; i < len(side) && i < levels; i++ {
+			total += side[i].Volume
+		}
+		return total
+	}
+	return sum(b.Bids), sum(b.Asks)
+}
@@ -0,0 +1,317 @@
+package kraken
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/jkosik/crypto-trader/internal/logging"
+)
+
+// EarnStrategy is a Kraken Earn strategy an asset can be allocated to
+type EarnStrategy struct {
+	ID            string
+	Asset         string  // asset code as Earn reports it, e.g. DOT or USD
+	LockType      string  // flex, bonded, timed or instant
+	APRLow        float64 // estimated yearly reward range, in %
+	APRHigh       float64
+	MinAllocation float64 // smallest amount the account may allocate
+	CanAllocate   bool
+	CanDeallocate bool
+}
+
+// Flexible reports whether allocations of the strategy can be pulled back without an unbonding
+// period, so funds parked in it are available to a trade within moments
+func (s EarnStrategy) Flexible() bool {
+	return s.LockType == "flex" || s.LockType == "instant"
+}
+
+// EarnAllocation is the account's allocation to an earn strategy
+type EarnAllocation struct {
+	StrategyID string
+	Asset      string  // native asset code, e.g. DOT or USD
+	Allocated  float64 // in the native asset, pending and bonding amounts included
+	Rewarded   float64 // rewards earned so far, in the native asset
+	ValueUSD   float64 // allocated amount converted to USD by Kraken
+}
+
+// earnPageSize is the number of strategies requested per Earn/Strategies call
+const earnPageSize = 100
+
+// GetEarnStrategies lists the earn strategies of an asset (empty lists all), ordered by asset
+// and then by highest estimated reward
+func GetEarnStrategies(ctx context.Context, asset string) ([]EarnStrategy, error) {
+	urlPath := "/0/private/Earn/Strategies"
+
+	var strategies []EarnStrategy
+	cursor := ""
+	for {
+		body, err := privateRequest(ctx, urlPath, true, func(nonce int64) string {
+			payload := fmt.Sprintf(`{
+			"nonce": "%d",
+			"limit": %d`, nonce, earnPageSize)
+			if asset != "" {
+				payload += fmt.Sprintf(`,
+			"asset": %q`, AssetAltname(asset))
+			}
+			if cursor != "" {
+				payload += fmt.Sprintf(`,
+			"cursor": %q`, cursor)
+			}
+			return payload + `
+		}`
+		})
+		if err != nil {
+			return nil, fmt.Errorf("error making request: %v", err)
+		}
+
+		var response struct {
+			Error  []string `json:"error"`
+			Result struct {
+				NextCursor string `json:"next_cursor"`
+				Items      []struct {
+					ID       string `json:"id"`
+					Asset    string `json:"asset"`
+					LockType struct {
+						Type string `json:"type"`
+					} `json:"lock_type"`
+					APREstimate *struct {
+						Low  string `json:"low"`
+						High string `json:"high"`
+					} `json:"apr_estimate"`
+					UserMinAllocation string `json:"user_min_allocation"`
+					CanAllocate       bool   `json:"can_allocate"`
+					CanDeallocate     bool   `json:"can_deallocate"`
+				} `json:"items"`
+			} `json:"result"`
+		}
+		if err := json.Unmarshal(body, &response); err != nil {
+			return nil, fmt.Errorf("error parsing response: %v", err)
+		}
+		if len(response.Error) > 0 {
+			return nil, fmt.Errorf("API error: %v", response.Error)
+		}
+
+		for _, item := range response.Result.Items {
+			strategy := EarnStrategy{
+				ID:            item.ID,
+				Asset:         item.Asset,
+				LockType:      item.LockType.Type,
+				MinAllocation: ParseFloat(item.UserMinAllocation),
+				CanAllocate:   item.CanAllocate,
+				CanDeallocate: item.CanDeallocate,
+			}
+			if item.APREstimate != nil {
+				strategy.APRLow, strategy.APRHigh = ParseFloat(item.APREstimate.Low), ParseFloat(item.APREstimate.High)
+			}
+			strategies = append(strategies, strategy)
+		}
+
+		if response.Result.NextCursor == "" || len(response.Result.Items) == 0 {
+			break
+		}
+		cursor = response.Result.NextCursor
+	}
+
+	sort.SliceStable(strategies, func(i, j int) bool {
+		if strategies[i].Asset != strategies[j].Asset {
+			return strategies[i].Asset < strategies[j].Asset
+		}
+		return strategies[i].APRHigh > strategies[j].APRHigh
+	})
+	return strategies, nil
+}
+
+// GetEarnAllocations lists the account's non-zero earn allocations
+func GetEarnAllocations(ctx context.Context) ([]EarnAllocation, error) {
+	urlPath := "/0/private/Earn/Allocations"
+
+	body, err := privateRequest(ctx, urlPath, true, func(nonce int64) string {
+		return fmt.Sprintf(`{
+			"nonce": "%d",
+			"converted_asset": "USD",
+			"hide_zero_allocations": true
+		}`, nonce)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error making request: %v", err)
+	}
+
+	type amount struct {
+		Native    string `json:"native"`
+		Converted string `json:"converted"`
+	}
+	var response struct {
+		Error  []string `json:"error"`
+		Result struct {
+			Items []struct {
+				StrategyID      string `json:"strategy_id"`
+				NativeAsset     string `json:"native_asset"`
+				AmountAllocated struct {
+					Total amount `json:"total"`
+				} `json:"amount_allocated"`
+				TotalRewarded amount `json:"total_rewarded"`
+			} `json:"items"`
+		} `json:"result"`
+	}
+	if err := json.Unmarshal(body, &response); err != nil {
+		return nil, fmt.Errorf("error parsing response: %v", err)
+	}
+	if len(response.Error) > 0 {
+		return nil, fmt.Errorf("API error: %v", response.Error)
+	}
+
+	allocations := make([]EarnAllocation, 0, len(response.Result.Items))
+	for _, item := range response.Result.Items {
+		allocations = append(allocations, EarnAllocation{
+			StrategyID: item.StrategyID,
+			Asset:      item.NativeAsset,
+			Allocated:  ParseFloat(item.AmountAllocated.Total.Native),
+			Rewarded:   ParseFloat(item.TotalRewarded.Native),
+			ValueUSD:   ParseFloat(item.AmountAllocated.Total.Converted),
+		})
+	}
+	sort.Slice(allocations, func(i, j int) bool { return allocations[i].ValueUSD > allocations[j].ValueUSD })
+	return allocations, nil
+}
+
+// AllocateEarn moves amount of the strategy's asset from the spot balance into the strategy.
+// Kraken processes the allocation asynchronously, WaitEarn waits for it.
+func AllocateEarn(ctx context.Context, strategyID string, amount float64) error {
+	return earnTransfer(ctx, "/0/private/Earn/Allocate", strategyID, amount)
+}
+
+// DeallocateEarn moves amount of the strategy's asset back to the spot balance. Kraken processes
+// the deallocation asynchronously, WaitEarn waits for it.
+func DeallocateEarn(ctx context.Context, strategyID string, amount float64) error {
+	return earnTransfer(ctx, "/0/private/Earn/Deallocate", strategyID, amount)
+}
+
+// earnTransfer allocates or deallocates an amount
+func earnTransfer(ctx context.Context, urlPath string, strategyID string, amount float64) error {
+	// Moving funds twice is not harmless, don't retry after network errors
+	body, err := privateRequest(ctx, urlPath, false, func(nonce int64) string {
+		return fmt.Sprintf(`{
+			"nonce": "%d",
+			"strategy_id": %q,
+			"amount": %q
+		}`, nonce, strategyID, strconv.FormatFloat(amount, 'f', -1, 64))
+	})
+	if err != nil {
+		return fmt.Errorf("error making request: %v", err)
+	}
+	if errs := apiErrors(body); len(errs) > 0 {
+		return fmt.Errorf("API error: %v", errs)
+	}
+	return nil
+}
+
+// EarnPending reports whether an allocation (or with deallocate set, a deallocation) of the
+// strategy is still being processed
+func EarnPending(ctx context.Context, strategyID string, deallocate bool) (bool, error) {
+	urlPath := "/0/private/Earn/AllocateStatus"
+	if deallocate {
+		urlPath = "/0/private/Earn/DeallocateStatus"
+	}
+
+	body, err := privateRequest(ctx, urlPath, true, func(nonce int64) string {
+		return fmt.Sprintf(`{
+			"nonce": "%d",
+			"strategy_id": %q
+		}`, nonce, strategyID)
+	})
+	if err != nil {
+		return false, fmt.Errorf("error making request: %v", err)
+	}
+
+	var response struct {
+		Error  []string `json:"error"`
+		Result struct {
+			Pending bool `json:"pending"`
+		} `json:"result"`
+	}
+	if err := json.Unmarshal(body, &response); err != nil {
+		return false, fmt.Errorf("error parsing response: %v", err)
+	}
+	if len(response.Error) > 0 {
+		return false, fmt.Errorf("API error: %v", response.Error)
+	}
+	return response.Result.Pending, nil
+}
+
+// WaitEarn polls until the strategy's allocation (or deallocation) is no longer pending, giving up
+// after timeout
+func WaitEarn(ctx context.Context, strategyID string, deallocate bool, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		pending, err := EarnPending(ctx, strategyID, deallocate)
+		if err != nil {
+			return err
+		}
+		if !pending {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("earn strategy %s still pending after %s", strategyID, timeout)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(2 * time.Second):
+		}
+	}
+}
+
+// PullFromEarn deallocates up to amount of the asset (e.g. USD or XBT) from the account's flexible
+// earn allocations, largest first, and waits until the funds are back in the spot balance. It
+// returns the amount deallocated, which falls short when less is parked in flexible strategies.
+func PullFromEarn(ctx context.Context, asset string, amount float64, timeout time.Duration) (float64, error) {
+	log := logging.FromContext(ctx)
+	strategies, err := GetEarnStrategies(ctx, asset)
+	if err != nil {
+		return 0, err
+	}
+	flexible := map[string]bool{}
+	for _, strategy := range strategies {
+		if strategy.Flexible() && strategy.CanDeallocate {
+			flexible[strategy.ID] = true
+		}
+	}
+	allocations, err := GetEarnAllocations(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	pulled := 0.0
+	for _, allocation := range allocations {
+		if pulled >= amount {
+			break
+		}
+		if !flexible[allocation.StrategyID] || !SameEarnAsset(allocation.Asset, asset) || allocation.Allocated <= 0 {
+			continue
+		}
+		take := allocation.Allocated
+		if rest := amount - pulled; take > rest {
+			take = rest
+		}
+		if err := DeallocateEarn(ctx, allocation.StrategyID, take); err != nil {
+			return pulled, fmt.Errorf("error deallocating %g %s from %s: %v", take, asset, allocation.StrategyID, err)
+		}
+		if err := WaitEarn(ctx, allocation.StrategyID, true, timeout); err != nil {
+			return pulled, err
+		}
+		log.Info("Pulled funds from earn", "asset", asset, "amount", take, "strategy_id", allocation.StrategyID)
+		pulled += take
+	}
+	return pulled, nil
+}
+
+// SameEarnAsset reports whether two asset codes name the same asset, whether given as Earn or
+// BalanceEx codes (ZUSD, XXBT) or altnames (USD, XBT, BTC), resolved through the AssetPairs
+// metadata. Rewards and staked variants (XBT.F, DOT.S) are not the same asset.
+func SameEarnAsset(a string, b string) bool {
+	return AssetAltname(a) == AssetAltname(b)
+}
@@ -0,0 +1,15 @@
+//go:build !unix
+
+package kraken
+
+import "os"
+
+// lockFile is a no-op without flock, processes sharing a nonce file must not run side by side
+func lockFile(file *os.File) error {
+	return nil
+}
+
+// unlockFile is a no-op without flock
+func unlockFile(file *os.File) error {
+	return nil
+}
@@ -0,0 +1,46 @@
+package kraken
+
+import (
+	"math"
+	"time"
+)
+
+// FillEstimate is what the recent prints say about the chance of a spread's quotes filling: the
+// taker volume that traded through each quote price within the window would have reached it
+type FillEstimate struct {
+	Window      time.Duration
+	Trades      int     // prints within the window
+	BuyVolume   float64 // volume takers sold at or below the buy price
+	BuyPrints   int
+	SellVolume  float64 // volume takers bought at or above the sell price
+	SellPrints  int
+	BuyPercent  float64 // BuyVolume as % of the trade volume, capped at 100
+	SellPercent float64 // SellVolume as % of the trade volume, capped at 100
+}
+
+// EstimateFills measures the prints within window before now against the buy and sell price of a
+// spread trading volume. Queue priority isn't known, so prints at the quote price count in full.
+func EstimateFills(trades []PublicTrade, now time.Time, window time.Duration, buyPrice float64, sellPrice float64, volume float64) FillEstimate {
+	estimate := FillEstimate{Window: window}
+	since := now.Add(-window)
+	for _, trade := range trades {
+		if trade.Time.Before(since) || trade.Time.After(now) {
+			continue
+		}
+		estimate.Trades++
+		// "s" is a taker selling into the bids, "b" a taker buying from the asks
+		switch {
+		case trade.Side == "s" && trade.Price <= buyPrice:
+			estimate.BuyVolume += trade.Volume
+			estimate.BuyPrints++
+		case trade.Side == "b" && trade.Price >= sellPrice:
+			estimate.SellVolume += trade.Volume
+			estimate.SellPrints++
+		}
+	}
+	if volume > 0 {
+		estimate.BuyPercent = math.Min(100, estimate.BuyVolume/volume*100)
+		estimate.SellPercent = math.Min(100, estimate.SellVolume/volume*100)
+	}
+	return estimate
+}
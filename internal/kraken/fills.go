@@ -0,0 +1,60 @@
+package kraken
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+// OrderDone reports whether an order status is final: filled, canceled or expired
+func OrderDone(status string) bool {
+	return status == "closed" || status == "canceled" || status == "expired"
+}
+
+// OrderAmended describes how an order's price or volume changed between two observations, empty
+// if neither did. Kraken's AmendOrder changes them in place, keeping the transaction ID.
+func OrderAmended(before *OrderStatus, after *OrderStatus) string {
+	var changes []string
+	if before.Descr.Price != after.Descr.Price {
+		changes = append(changes, fmt.Sprintf("price %s -> %s", before.Descr.Price, after.Descr.Price))
+	}
+	if before.Vol != after.Vol {
+		changes = append(changes, fmt.Sprintf("volume %s -> %s", before.Vol, after.Vol))
+	}
+	return strings.Join(changes, ", ")
+}
+
+// Execution is what the two legs of a spread trade actually executed. The P&L covers only the
+// matched volume, bought and sold; the rest of the larger leg is an open position.
+type Execution struct {
+	BuyVolume   float64 // executed volume of the buy leg
+	SellVolume  float64 // executed volume of the sell leg
+	Matched     float64 // volume both legs executed
+	Unmatched   float64 // volume bought but not sold, negative if sold but not bought
+	BuyPrice    float64 // average executed buy price
+	SellPrice   float64 // average executed sell price
+	BuyFee      float64 // fee of the buy leg's matched volume
+	SellFee     float64 // fee of the sell leg's matched volume
+	GrossProfit float64 // sell minus buy value of the matched volume
+}
+
+// ExecutionOf computes the execution of a spread trade from its orders. Fees of the unmatched
+// volume belong to the open position and are left out.
+func ExecutionOf(buy *OrderStatus, sell *OrderStatus) Execution {
+	e := Execution{
+		BuyVolume:  ParseFloat(buy.VolExec),
+		SellVolume: ParseFloat(sell.VolExec),
+	}
+	e.Matched = math.Min(e.BuyVolume, e.SellVolume)
+	e.Unmatched = e.BuyVolume - e.SellVolume
+	if e.BuyVolume > 0 {
+		e.BuyPrice = ParseFloat(buy.Cost) / e.BuyVolume
+		e.BuyFee = ParseFloat(buy.Fee) * e.Matched / e.BuyVolume
+	}
+	if e.SellVolume > 0 {
+		e.SellPrice = ParseFloat(sell.Cost) / e.SellVolume
+		e.SellFee = ParseFloat(sell.Fee) * e.Matched / e.SellVolume
+	}
+	e.GrossProfit = (e.SellPrice - e.BuyPrice) * e.Matched
+	return e
+}
@@ -0,0 +1,437 @@
+package kraken_test
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/jkosik/crypto-trader/internal/kraken"
+	"github.com/jkosik/crypto-trader/internal/krakenmock"
+)
+
+// TestMain keeps the nonce file out of the home directory and signs private requests with the
+// mock's secret
+func TestMain(m *testing.M) {
+	dir, err := os.MkdirTemp("", "kraken-test")
+	if err != nil {
+		panic(err)
+	}
+	os.Setenv("CRYPTO_TRADER_STATE_DIR", dir)
+	os.Setenv("KRAKEN_API_KEY", "mock")
+	os.Setenv("KRAKEN_PRIVATE_KEY", krakenmock.Secret)
+	code := m.Run()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+// mock starts a mock server checking signatures and points the kraken package at it
+func mock(t *testing.T) *krakenmock.Server {
+	t.Helper()
+	server := krakenmock.New(krakenmock.Secret)
+	restore := server.Use()
+	t.Cleanup(func() {
+		restore()
+		server.Close()
+	})
+	return server
+}
+
+// handleFixture answers an endpoint with its recorded response instead of the server's order book
+func handleFixture(t *testing.T, server *krakenmock.Server, endpoint string) {
+	t.Helper()
+	body, err := krakenmock.Fixture(endpoint)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server.Handle("/0/private/"+endpoint, body)
+}
+
+func btcPair(t *testing.T) *kraken.AssetPair {
+	t.Helper()
+	pair, err := kraken.GetAssetPair(context.Background(), "BTC", "USD")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pair
+}
+
+func TestTickerFixture(t *testing.T) {
+	mock(t)
+	info, err := kraken.GetTickerInfo(context.Background(), "BTC")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := kraken.SpreadInfo{BidPrice: 60000, AskPrice: 60010, Spread: 10, HighPrice: 60480, LowPrice: 59450}
+	if *info != want {
+		t.Errorf("GetTickerInfo = %+v, want %+v", *info, want)
+	}
+
+	volume, err := kraken.Get24hVolume(context.Background(), "BTC")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := 1350.12345678 * 60000; volume < want-1e-6 || volume > want+1e-6 {
+		t.Errorf("Get24hVolume = %v, want %v", volume, want)
+	}
+}
+
+func TestOHLCFixture(t *testing.T) {
+	mock(t)
+	candles, err := kraken.GetOHLC(context.Background(), "BTC", time.Minute, time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(candles) != 90 {
+		t.Fatalf("got %d candles, want 90", len(candles))
+	}
+	first := candles[0]
+	want := kraken.OHLCData{Time: 1767220200, Open: 59900, High: 59912.5, Low: 59889, Close: 59900, Volume: 0.35}
+	if first != want {
+		t.Errorf("first candle = %+v, want %+v", first, want)
+	}
+	for i := 1; i < len(candles); i++ {
+		if candles[i].Time-candles[i-1].Time != 60 {
+			t.Fatalf("candle %d is %ds after the previous one", i, candles[i].Time-candles[i-1].Time)
+		}
+	}
+}
+
+func TestAddOrderFixture(t *testing.T) {
+	server := mock(t)
+	handleFixture(t, server, "AddOrder")
+	pair := btcPair(t)
+
+	txid, err := kraken.PlaceLimitOrder(context.Background(), pair, 60000.04, 0.010000009, true, false, 42)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if txid != "OUF4EM-FRGI2-MQMWZD" {
+		t.Errorf("txid = %s, want OUF4EM-FRGI2-MQMWZD", txid)
+	}
+
+	requests := server.Requests("/0/private/AddOrder")
+	if len(requests) != 1 {
+		t.Fatalf("got %d AddOrder requests, want 1", len(requests))
+	}
+	payload := requests[0].Payload
+	// Rounded to the pair's tick size and lot decimals
+	for field, want := range map[string]interface{}{"pair": "XBTUSD", "type": "buy", "ordertype": "limit", "price": "60000.0", "volume": "0.01000000", "userref": float64(42)} {
+		if payload[field] != want {
+			t.Errorf("payload %s = %v, want %v", field, payload[field], want)
+		}
+	}
+}
+
+func TestQueryOrdersFixture(t *testing.T) {
+	server := mock(t)
+	handleFixture(t, server, "QueryOrders")
+
+	status, err := kraken.CheckOrderStatus(context.Background(), "OUF4EM-FRGI2-MQMWZD")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.Status != "closed" || status.VolExec != "0.01000000" || status.Cost != "600.00000" || status.Fee != "1.50000" {
+		t.Errorf("CheckOrderStatus = %+v, want a closed order of 0.01 for 600 with a 1.5 fee", status)
+	}
+	if status.Descr.Type != "buy" || status.Descr.Pair != "XBTUSD" || status.Descr.Price != "60000.0" {
+		t.Errorf("description = %+v, want a buy of XBTUSD at 60000.0", status.Descr)
+	}
+}
+
+func TestBalanceExFixture(t *testing.T) {
+	mock(t)
+	btcPair(t) // codes are resolved through the pair metadata
+
+	body, err := kraken.GetAccountBalance(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	balances, err := kraken.GetAllBalances(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for coin, want := range map[string]float64{"BTC": 0.5, "XXBT": 0.5, "USD": 10000, "ZUSD": 10000} {
+		balance, err := kraken.GetBalance(balances, coin)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if balance.Available != want {
+			t.Errorf("GetBalance(%s).Available = %v, want %v", coin, balance.Available, want)
+		}
+	}
+}
+
+// Variants of an asset are summed, staked ones are locked
+func TestBalanceExVariants(t *testing.T) {
+	server := mock(t)
+	btcPair(t)
+	server.Handle("/0/private/BalanceEx", `{"error":[],"result":{`+
+		`"XXBT":{"balance":"0.5","hold_trade":"0.1"},"XBT.F":{"balance":"0.2","hold_trade":"0"},`+
+		`"XBT.S":{"balance":"1","hold_trade":"0"},"ZUSD":{"balance":"100","hold_trade":"0"},"USD.F":{"balance":"5","hold_trade":"0"}}}`)
+
+	body, err := kraken.GetAccountBalance(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	balances, err := kraken.GetAllBalances(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	btc, err := kraken.GetBalance(balances, "XXBT")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if btc.Asset != "XBT" || !near(btc.Total, 0.7) || !near(btc.Hold, 0.1) || !near(btc.Available, 0.6) || !near(btc.Locked, 1) {
+		t.Errorf("XBT balance = %+v, want total 0.7, hold 0.1, available 0.6, locked 1", btc)
+	}
+	if got, want := btc.Breakdown(), "XBT.F 0.2, XBT.S 1 (locked), XXBT 0.5 (0.1 on hold)"; got != want {
+		t.Errorf("Breakdown = %q, want %q", got, want)
+	}
+
+	usd, err := kraken.GetBalance(balances, "USD")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !near(usd.Available, 105) || len(usd.Variants) != 2 {
+		t.Errorf("USD balance = %+v, want 105 available over 2 variants", usd)
+	}
+
+	if _, err := kraken.GetBalance(balances, "ETH"); err == nil {
+		t.Error("GetBalance(ETH) found a balance")
+	}
+}
+
+// A spread trade's round trip on the mock's order book: both legs placed inside the spread, open
+// until filled, then closed with their fill reported
+func TestSpreadTradeFlow(t *testing.T) {
+	server := mock(t)
+	ctx := context.Background()
+	pair := btcPair(t)
+
+	info, err := kraken.GetTickerInfo(ctx, "BTC")
+	if err != nil {
+		t.Fatal(err)
+	}
+	userref := kraken.UserRef("flowtest0001")
+	buyID, sellID, profit, _, err := kraken.PlaceSpreadOrders(ctx, "BTC", pair, info, 0.001, false, 0.5, nil, 0.25, userref)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Narrowed by half, 60002.5/60007.5 on the tick size
+	buyPrice, sellPrice := pair.RoundPrice(60002.5), pair.RoundPrice(60007.5)
+	if _, _, want := kraken.SpreadNetProfit(buyPrice, sellPrice, 0.001, 0.25); !near(profit, want) {
+		t.Errorf("estimated profit = %v, want %v", profit, want)
+	}
+
+	open, err := kraken.GetOpenOrders(ctx, "BTC")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(open) != 2 {
+		t.Fatalf("got %d open orders, want 2", len(open))
+	}
+
+	for _, txid := range []string{buyID, sellID} {
+		if err := server.Fill(txid, 0.001); err != nil {
+			t.Fatal(err)
+		}
+		status, err := kraken.CheckOrderStatus(ctx, txid)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if status.Status != "closed" || status.VolExec != "0.00100000" || status.UserRef != userref {
+			t.Errorf("order %s = %+v, want closed, 0.001 executed, userref %d", txid, status, userref)
+		}
+		want := pair.FormatPrice(buyPrice)
+		if txid == sellID {
+			want = pair.FormatPrice(sellPrice)
+		}
+		if status.Descr.Price != want {
+			t.Errorf("order %s at %s, want %s", txid, status.Descr.Price, want)
+		}
+	}
+
+	open, err = kraken.GetOpenOrders(ctx, "BTC")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(open) != 0 {
+		t.Errorf("%d orders still open after the fills", len(open))
+	}
+}
+
+func near(a, b float64) bool {
+	return a-b < 1e-9 && b-a < 1e-9
+}
+
+// Orders carry the trade's userref and no cl_ord_id, which Kraken only accepts without a userref
+func TestOrdersCarryUserRefOnly(t *testing.T) {
+	server := mock(t)
+	ctx := context.Background()
+	pair := btcPair(t)
+
+	userref := kraken.UserRef("5eed0001a2b3")
+	if _, err := kraken.PlaceLimitOrder(ctx, pair, 59000, 0.001, true, false, userref); err != nil {
+		t.Fatal(err)
+	}
+	info, err := kraken.GetTickerInfo(ctx, "BTC")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, _, _, err := kraken.PlaceSpreadOrders(ctx, "BTC", pair, info, 0.001, false, 0.5, nil, 0.25, userref); err != nil {
+		t.Fatal(err)
+	}
+
+	var orders []map[string]interface{}
+	for _, r := range server.Requests("/0/private/AddOrder") {
+		orders = append(orders, r.Payload)
+	}
+	for _, r := range server.Requests("/0/private/AddOrderBatch") {
+		for _, leg := range r.Payload["orders"].([]interface{}) {
+			orders = append(orders, leg.(map[string]interface{}))
+		}
+	}
+	if len(orders) != 3 {
+		t.Fatalf("got %d orders, want 3", len(orders))
+	}
+	for _, order := range orders {
+		if _, ok := order["cl_ord_id"]; ok || order["userref"] != float64(userref) {
+			t.Errorf("order %v, want userref %d and no cl_ord_id", order, userref)
+		}
+	}
+}
+
+// An order's own time-in-force, like the immediate-or-cancel legs of a triangle, leaves the
+// orders placed side by side with the TimeInForce in effect
+func TestPlaceLimitOrderTimeInForce(t *testing.T) {
+	server := mock(t)
+	ctx := context.Background()
+	pair := btcPair(t)
+
+	if _, err := kraken.PlaceLimitOrderTimeInForce(ctx, pair, 59000, 0.001, true, false, 42, "IOC"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := kraken.PlaceLimitOrder(ctx, pair, 58000, 0.001, true, false, 42); err != nil {
+		t.Fatal(err)
+	}
+	requests := server.Requests("/0/private/AddOrder")
+	if len(requests) != 2 {
+		t.Fatalf("got %d orders, want 2", len(requests))
+	}
+	if tif := requests[0].Payload["timeinforce"]; tif != "IOC" {
+		t.Errorf("first order's timeinforce %v, want IOC", tif)
+	}
+	if tif, ok := requests[1].Payload["timeinforce"]; ok || kraken.TimeInForce != "GTC" {
+		t.Errorf("second order's timeinforce %v with TimeInForce %s, want GTC", tif, kraken.TimeInForce)
+	}
+}
+
+// An order whose response was lost is found by its userref, side, price and volume instead of
+// failing or being placed twice
+func TestPlaceLimitOrderAfterLostResponse(t *testing.T) {
+	server := mock(t)
+	ctx := context.Background()
+	pair := btcPair(t)
+
+	userref := kraken.UserRef("10570001c4d5")
+	// An earlier order of the trade on the other side and one at another price don't match
+	if _, err := kraken.PlaceLimitOrder(ctx, pair, 61000, 0.001, false, false, userref); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := kraken.PlaceLimitOrder(ctx, pair, 58000, 0.001, true, false, userref); err != nil {
+		t.Fatal(err)
+	}
+
+	server.LoseResponses("/0/private/AddOrder", 1)
+	txid, err := kraken.PlaceLimitOrder(ctx, pair, 59000, 0.001, true, false, userref)
+	if err != nil {
+		t.Fatal(err)
+	}
+	open := server.OpenOrders()
+	if len(open) != 3 || txid != open[2] {
+		t.Errorf("PlaceLimitOrder = %s, want the order placed despite the lost response among %v", txid, open)
+	}
+
+	// An order the exchange never placed isn't made up
+	server.Queue("/0/private/AddOrder", "not json")
+	if txid, err := kraken.PlaceLimitOrder(ctx, pair, 57000, 0.001, true, false, userref); err == nil {
+		t.Errorf("PlaceLimitOrder = %s after a failed request that placed nothing", txid)
+	}
+}
+
+// A validate-only spread sends validate once for the whole batch and places nothing
+func TestValidateOnlyBatchPlacesNothing(t *testing.T) {
+	server := mock(t)
+	ctx := context.Background()
+	pair := btcPair(t)
+
+	kraken.ValidateOnly = true
+	defer func() { kraken.ValidateOnly = false }()
+	info, err := kraken.GetTickerInfo(ctx, "BTC")
+	if err != nil {
+		t.Fatal(err)
+	}
+	buyID, sellID, _, _, err := kraken.PlaceSpreadOrders(ctx, "BTC", pair, info, 0.001, false, 0.5, nil, 0.25, kraken.UserRef("7a11d0001b2c"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if buyID != "" || sellID != "" {
+		t.Errorf("PlaceSpreadOrders = %q, %q, want no transaction IDs", buyID, sellID)
+	}
+	if open := server.OpenOrders(); len(open) != 0 {
+		t.Errorf("validate-only batch placed orders %v", open)
+	}
+
+	requests := server.Requests("/0/private/AddOrderBatch")
+	if len(requests) != 1 {
+		t.Fatalf("got %d AddOrderBatch requests, want 1", len(requests))
+	}
+	if requests[0].Payload["validate"] != true {
+		t.Errorf("batch %v lacks validate", requests[0].Payload)
+	}
+	for _, leg := range requests[0].Payload["orders"].([]interface{}) {
+		if _, ok := leg.(map[string]interface{})["validate"]; ok {
+			t.Errorf("order %v of the batch carries validate", leg)
+		}
+	}
+}
+
+// Trades side by side share the switch, the first one done must not disarm it for the other
+func TestDeadMansSwitchSharedByTrades(t *testing.T) {
+	server := mock(t)
+	server.Handle("/0/private/CancelAllOrdersAfter", `{"error":[],"result":{"currentTime":"2026-10-17T12:00:00Z","triggerTime":"2026-10-17T12:01:00Z"}}`)
+	ctx := context.Background()
+
+	for i := 0; i < 2; i++ {
+		if err := kraken.ArmDeadMansSwitch(ctx, time.Minute); err != nil {
+			t.Fatal(err)
+		}
+	}
+	disarms := func() int {
+		n := 0
+		for _, r := range server.Requests("/0/private/CancelAllOrdersAfter") {
+			if r.Payload["timeout"] == float64(0) {
+				n++
+			}
+		}
+		return n
+	}
+	if n := len(server.Requests("/0/private/CancelAllOrdersAfter")); n != 1 {
+		t.Errorf("arming twice sent %d requests, want 1", n)
+	}
+
+	if err := kraken.DisarmDeadMansSwitch(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if disarms() != 0 {
+		t.Fatal("switch disarmed while a trade still holds it")
+	}
+	if err := kraken.DisarmDeadMansSwitch(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if n := disarms(); n != 1 {
+		t.Errorf("last holder sent %d disarms, want 1", n)
+	}
+}
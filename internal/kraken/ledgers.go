@@ -0,0 +1,99 @@
+package kraken
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// LedgerEntry is a single balance movement from the account's ledger
+type LedgerEntry struct {
+	ID      string
+	RefID   string // trade ID for trades, deposit/withdrawal reference otherwise
+	Time    time.Time
+	Type    string // trade, deposit, withdrawal, transfer, staking, ...
+	Asset   string // BalanceEx asset code, e.g. XXBT or ZUSD
+	Amount  float64
+	Fee     float64
+	Balance float64 // resulting balance of the asset
+}
+
+// ledgersPageSize is the number of entries Kraken returns per Ledgers call
+const ledgersPageSize = 50
+
+// GetLedgers retrieves the account's ledger entries between start and end (zero = open), oldest first
+func GetLedgers(ctx context.Context, start time.Time, end time.Time) ([]LedgerEntry, error) {
+	urlPath := "/0/private/Ledgers"
+
+	var entries []LedgerEntry
+	// Like TradesHistory, entries booked while paging shift seen ones onto the next page
+	seen := map[string]bool{}
+	for offset := 0; ; offset += ledgersPageSize {
+		body, err := privateRequest(ctx, urlPath, true, func(nonce int64) string {
+			payload := fmt.Sprintf(`{
+			"nonce": "%d",
+			"ofs": %d`, nonce, offset)
+			if !start.IsZero() {
+				payload += fmt.Sprintf(`,
+			"start": %d`, start.Unix())
+			}
+			if !end.IsZero() {
+				payload += fmt.Sprintf(`,
+			"end": %d`, end.Unix())
+			}
+			return payload + `
+		}`
+		})
+		if err != nil {
+			return nil, fmt.Errorf("error making request: %v", err)
+		}
+
+		var response struct {
+			Error  []string `json:"error"`
+			Result struct {
+				Ledger map[string]struct {
+					RefID   string  `json:"refid"`
+					Time    float64 `json:"time"`
+					Type    string  `json:"type"`
+					Asset   string  `json:"asset"`
+					Amount  string  `json:"amount"`
+					Fee     string  `json:"fee"`
+					Balance string  `json:"balance"`
+				} `json:"ledger"`
+				Count int `json:"count"`
+			} `json:"result"`
+		}
+		if err := json.Unmarshal(body, &response); err != nil {
+			return nil, fmt.Errorf("error parsing response: %v", err)
+		}
+		if len(response.Error) > 0 {
+			return nil, fmt.Errorf("API error: %v", response.Error)
+		}
+
+		for id, e := range response.Result.Ledger {
+			if seen[id] {
+				continue
+			}
+			seen[id] = true
+			entries = append(entries, LedgerEntry{
+				ID:      id,
+				RefID:   e.RefID,
+				Time:    time.Unix(0, int64(e.Time*float64(time.Second))),
+				Type:    e.Type,
+				Asset:   e.Asset,
+				Amount:  ParseFloat(e.Amount),
+				Fee:     ParseFloat(e.Fee),
+				Balance: ParseFloat(e.Balance),
+			})
+		}
+
+		if len(response.Result.Ledger) < ledgersPageSize || offset+ledgersPageSize >= response.Result.Count {
+			break
+		}
+	}
+
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Time.Before(entries[j].Time) })
+	return entries, nil
+}
@@ -0,0 +1,148 @@
+package kraken
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+)
+
+// Leverage places limit orders on margin with this leverage (leverage of AddOrder), e.g. 2 for
+// 2:1. A margin sell opens a short position, so a spread can be traded without holding the coin.
+// 0 trades spot. Paper orders ignore it.
+var Leverage int
+
+// Position is an open margin position from OpenPositions
+type Position struct {
+	TxID      string
+	OrderTxID string  `json:"ordertxid"` // order that opened the position
+	Status    string  `json:"posstatus"`
+	Pair      string  `json:"pair"`
+	Time      float64 `json:"time"`
+	Type      string  `json:"type"` // buy (long) or sell (short)
+	OrderType string  `json:"ordertype"`
+	Cost      string  `json:"cost"`
+	Fee       string  `json:"fee"`
+	Vol       string  `json:"vol"`
+	VolClosed string  `json:"vol_closed"`
+	Margin    string  `json:"margin"` // initial margin held, in the quote currency
+	Value     string  `json:"value"`  // current value of the remaining position
+	Net       string  `json:"net"`    // unrealized profit or loss of the remaining position
+	Terms     string  `json:"terms"`
+	Rollover  string  `json:"rollovertm"`
+}
+
+// Open returns the volume of the position not closed yet
+func (p Position) Open() float64 {
+	return ParseFloat(p.Vol) - ParseFloat(p.VolClosed)
+}
+
+// GetOpenPositions returns the open margin positions of a pair (all pairs if pair is nil), oldest
+// first, with their current value and unrealized P&L
+func GetOpenPositions(ctx context.Context, pair *AssetPair) ([]Position, error) {
+	urlPath := "/0/private/OpenPositions"
+
+	body, err := privateRequest(ctx, urlPath, true, func(nonce int64) string {
+		return fmt.Sprintf(`{
+			"nonce": "%d",
+			"docalcs": true
+		}`, nonce)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error making request: %v", err)
+	}
+
+	var response struct {
+		Error  []string            `json:"error"`
+		Result map[string]Position `json:"result"`
+	}
+	if err := json.Unmarshal(body, &response); err != nil {
+		return nil, fmt.Errorf("error parsing response: %v", err)
+	}
+	if len(response.Error) > 0 {
+		return nil, fmt.Errorf("API error: %v", response.Error)
+	}
+
+	var positions []Position
+	for txId, position := range response.Result {
+		if pair != nil && position.Pair != pair.Name && position.Pair != pair.Altname {
+			continue
+		}
+		position.TxID = txId
+		positions = append(positions, position)
+	}
+	sort.Slice(positions, func(i, j int) bool { return positions[i].Time < positions[j].Time })
+	return positions, nil
+}
+
+// TradeBalance is the margin summary of the account from TradeBalance, in the quote currency
+type TradeBalance struct {
+	Equity       float64 // trade balance plus unrealized P&L of open positions
+	MarginUsed   float64
+	FreeMargin   float64 // equity left for new margin orders
+	MarginLevel  float64 // equity / margin used in %, 0 without open positions
+	UnrealizedPL float64
+}
+
+// GetTradeBalance returns the account's margin summary valued in asset (e.g. ZUSD or USD)
+func GetTradeBalance(ctx context.Context, asset string) (*TradeBalance, error) {
+	urlPath := "/0/private/TradeBalance"
+
+	body, err := privateRequest(ctx, urlPath, true, func(nonce int64) string {
+		return fmt.Sprintf(`{
+			"nonce": "%d",
+			"asset": "%s"
+		}`, nonce, asset)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error making request: %v", err)
+	}
+
+	var response struct {
+		Error  []string `json:"error"`
+		Result struct {
+			Equity      string `json:"e"`
+			MarginUsed  string `json:"m"`
+			FreeMargin  string `json:"mf"`
+			MarginLevel string `json:"ml"`
+			Net         string `json:"n"`
+		} `json:"result"`
+	}
+	if err := json.Unmarshal(body, &response); err != nil {
+		return nil, fmt.Errorf("error parsing response: %v", err)
+	}
+	if len(response.Error) > 0 {
+		return nil, fmt.Errorf("API error: %v", response.Error)
+	}
+	r := response.Result
+	return &TradeBalance{
+		Equity:       ParseFloat(r.Equity),
+		MarginUsed:   ParseFloat(r.MarginUsed),
+		FreeMargin:   ParseFloat(r.FreeMargin),
+		MarginLevel:  ParseFloat(r.MarginLevel),
+		UnrealizedPL: ParseFloat(r.Net),
+	}, nil
+}
+
+// SupportsLeverage reports whether both sides of the pair can be traded on margin with leverage
+func (p *AssetPair) SupportsLeverage(leverage int) bool {
+	return containsInt(p.LeverageBuy, leverage) && containsInt(p.LeverageSell, leverage)
+}
+
+func containsInt(values []int, value int) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// marginFields builds the leverage field of a margin order, empty when trading spot
+func marginFields() string {
+	if Leverage <= 1 {
+		return ""
+	}
+	return fmt.Sprintf(`,
+			"leverage": "%d:1"`, Leverage)
+}
@@ -0,0 +1,175 @@
+package kraken
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// NonceGenerator produces strictly increasing nonces for private API requests.
+// Kraken rejects any nonce that is not greater than the last one seen for the API key,
+// so concurrent requests within the same millisecond must not reuse a timestamp.
+// If path is set, the last nonce is persisted there so a restarted process resumes above it, and
+// processes sharing the file (traders run side by side by cmd/loop) take turns under a file lock.
+// Handing out nonces in order isn't enough: a request with a later nonce that reaches Kraken first
+// invalidates the earlier one, so private requests hold the generator from nonce to response with
+// Acquire.
+type NonceGenerator struct {
+	mu   sync.Mutex
+	last int64
+	path string
+}
+
+// NewPersistentNonceGenerator creates a generator that stores the last used nonce in path
+// and resumes above the stored value
+func NewPersistentNonceGenerator(path string) (*NonceGenerator, error) {
+	g := &NonceGenerator{path: path}
+
+	data, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("error reading nonce file: %v", err)
+	}
+	if err == nil {
+		last, err := strconv.ParseInt(strings.TrimSpace(string(data)), 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing nonce file %s: %v", path, err)
+		}
+		g.last = last
+	}
+
+	return g, nil
+}
+
+// Next returns the current time in milliseconds, or last+1 if the clock hasn't advanced
+func (g *NonceGenerator) Next() int64 {
+	nonce, release := g.Acquire()
+	release()
+	return nonce
+}
+
+// Acquire returns the next nonce like Next and keeps the generator, and the file lock shared with
+// other processes, until release is called. Call release once the request carrying the nonce got
+// its response, so no later nonce can reach Kraken before it.
+func (g *NonceGenerator) Acquire() (int64, func()) {
+	g.mu.Lock()
+	release := g.mu.Unlock
+
+	if g.path != "" {
+		unlock, err := g.lock()
+		if err != nil {
+			slog.Warn("Failed to lock nonce file", "error", err)
+		} else {
+			release = func() {
+				unlock()
+				g.mu.Unlock()
+			}
+		}
+		// Another process may have issued nonces since
+		if last, err := g.stored(); err == nil && last > g.last {
+			g.last = last
+		}
+	}
+
+	nonce := time.Now().UnixNano() / int64(time.Millisecond)
+	if nonce <= g.last {
+		nonce = g.last + 1
+	}
+	g.last = nonce
+
+	if g.path != "" {
+		if err := g.persist(); err != nil {
+			slog.Warn("Failed to persist nonce", "error", err)
+		}
+	}
+	return nonce, release
+}
+
+// stored reads the last nonce persisted to the generator's file
+func (g *NonceGenerator) stored() (int64, error) {
+	data, err := os.ReadFile(g.path)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseInt(strings.TrimSpace(string(data)), 10, 64)
+}
+
+// lock takes the lock shared by all processes using the generator's file and returns its release
+func (g *NonceGenerator) lock() (func(), error) {
+	if err := os.MkdirAll(filepath.Dir(g.path), 0700); err != nil {
+		return nil, err
+	}
+	file, err := os.OpenFile(g.path+".lock", os.O_CREATE|os.O_RDWR, 0600)
+	if err != nil {
+		return nil, err
+	}
+	if err := lockFile(file); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return func() {
+		unlockFile(file)
+		file.Close()
+	}, nil
+}
+
+// persist atomically writes the last nonce to the generator's file
+func (g *NonceGenerator) persist() error {
+	if err := os.MkdirAll(filepath.Dir(g.path), 0700); err != nil {
+		return err
+	}
+	tmp := g.path + ".tmp"
+	if err := os.WriteFile(tmp, []byte(strconv.FormatInt(g.last, 10)), 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, g.path)
+}
+
+// NonceFilePath returns the nonce file location for an API key.
+// The key itself is never written to disk, only a short hash identifying the account.
+func NonceFilePath(apiKey string) (string, error) {
+	dir, err := StateDir()
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256([]byte(apiKey))
+	return filepath.Join(dir, "nonce-"+hex.EncodeToString(sum[:8])), nil
+}
+
+var (
+	// defaultNonceGenerator is shared by all private requests in the process
+	defaultNonceGenerator     *NonceGenerator
+	defaultNonceGeneratorOnce sync.Once
+)
+
+// AcquireNonce returns the next nonce from the process-wide generator, held until release is
+// called (see NonceGenerator.Acquire). The generator persists its state per KRAKEN_API_KEY and
+// falls back to memory only if the state directory is unavailable.
+func AcquireNonce() (int64, func()) {
+	defaultNonceGeneratorOnce.Do(func() {
+		defaultNonceGenerator = &NonceGenerator{}
+
+		apiKey := os.Getenv("KRAKEN_API_KEY")
+		if apiKey == "" {
+			return
+		}
+		path, err := NonceFilePath(apiKey)
+		if err != nil {
+			slog.Warn("Nonce persistence disabled", "error", err)
+			return
+		}
+		g, err := NewPersistentNonceGenerator(path)
+		if err != nil {
+			slog.Warn("Nonce persistence disabled", "error", err)
+			return
+		}
+		defaultNonceGenerator = g
+	})
+	return defaultNonceGenerator.Acquire()
+}
@@ -0,0 +1,70 @@
+//go:build unix
+
+package kraken
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// Two generators on one file stand in for two traders run by cmd/loop
+func TestAcquireHoldsAcrossProcesses(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "nonce")
+	first, err := NewPersistentNonceGenerator(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := NewPersistentNonceGenerator(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	n1, release := first.Acquire()
+	acquired := make(chan int64)
+	go func() {
+		n2, release := second.Acquire()
+		release()
+		acquired <- n2
+	}()
+
+	select {
+	case n2 := <-acquired:
+		t.Fatalf("second generator got nonce %d while %d was held", n2, n1)
+	case <-time.After(50 * time.Millisecond):
+	}
+	release()
+
+	select {
+	case n2 := <-acquired:
+		if n2 <= n1 {
+			t.Errorf("nonce %d issued after release is not above %d", n2, n1)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("second generator still blocked after release")
+	}
+}
+
+func TestNextIsStrictlyIncreasingAndPersisted(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "nonce")
+	g, err := NewPersistentNonceGenerator(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	last := int64(0)
+	for i := 0; i < 100; i++ {
+		n := g.Next()
+		if n <= last {
+			t.Fatalf("nonce %d after %d", n, last)
+		}
+		last = n
+	}
+
+	restarted, err := NewPersistentNonceGenerator(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := restarted.Next(); n <= last {
+		t.Errorf("restarted generator issued %d, not above the persisted %d", n, last)
+	}
+}
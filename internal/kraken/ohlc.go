@@ -1,10 +1,15 @@
 package kraken
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
+	"sort"
 	"strconv"
+	"strings"
 	"time"
+
+	"github.com/jkosik/crypto-trader/internal/logging"
 )
 
 // OHLCResponse represents the response from the Kraken API OHLC endpoint
@@ -23,35 +28,50 @@ type OHLCData struct {
 	Volume float64
 }
 
-// GetOHLCData retrieves OHLC data for a given coin and time interval
-func GetOHLCData(coin string, duration time.Duration) error {
-	// Limit duration to 8 hours
-	if duration > 8*time.Hour {
-		duration = 8 * time.Hour
-		fmt.Printf("Note: Duration limited to 8 hours\n")
-	}
+// OHLCIntervals are the candle intervals Kraken serves
+var OHLCIntervals = []time.Duration{
+	time.Minute,
+	5 * time.Minute,
+	15 * time.Minute,
+	30 * time.Minute,
+	time.Hour,
+	4 * time.Hour,
+	24 * time.Hour,
+	7 * 24 * time.Hour,
+	15 * 24 * time.Hour,
+}
 
-	// Calculate number of candles needed (1 candle per minute)
-	minutesNeeded := int(duration.Minutes())
-	candlesNeeded := minutesNeeded + 1 // +1 for current candle
+// maxOHLCCandles is how many of the most recent candles Kraken serves per interval
+const maxOHLCCandles = 720
+
+// GetOHLC retrieves the coin's candles of one of OHLCIntervals after since, oldest first, checked
+// and cleaned according to DefaultOHLCQualityPolicy. Kraken serves only the last 720 candles of an
+// interval whatever since is, a zero since gets all of them. The last candle is still open.
+func GetOHLC(ctx context.Context, coin string, interval time.Duration, since time.Time) ([]OHLCData, error) {
+	if !validOHLCInterval(interval) {
+		return nil, fmt.Errorf("unsupported OHLC interval %s, Kraken serves %s", interval, formatIntervals())
+	}
 
 	// Convert coin to Kraken pair format (e.g., "SUNDOG" -> "SUNDOG/USD")
-	pair := coin + "/USD"
+	pair := PairName(coin)
 	// Get OHLC data from public API
-	url := fmt.Sprintf("https://api.kraken.com/0/public/OHLC?pair=%s&interval=1", pair)
+	url := fmt.Sprintf("%s/0/public/OHLC?pair=%s&interval=%d", BaseURL, pair, int(interval.Minutes()))
+	if !since.IsZero() {
+		url += fmt.Sprintf("&since=%d", since.Unix())
+	}
 
-	body, err := MakePublicRequest(url, "GET")
+	body, err := publicRequest(ctx, url)
 	if err != nil {
-		return fmt.Errorf("error getting OHLC data: %v", err)
+		return nil, fmt.Errorf("error getting OHLC data: %v", err)
 	}
 
 	var response OHLCResponse
 	if err := json.Unmarshal(body, &response); err != nil {
-		return fmt.Errorf("error parsing OHLC response: %v", err)
+		return nil, fmt.Errorf("error parsing OHLC response: %v", err)
 	}
 
 	if len(response.Error) > 0 {
-		return fmt.Errorf("API error: %v", response.Error)
+		return nil, fmt.Errorf("API error: %v", response.Error)
 	}
 
 	// Get the first (and only) pair from the result
@@ -63,41 +83,126 @@ func GetOHLCData(coin string, duration time.Duration) error {
 		}
 	}
 
-	if len(ohlcData) < candlesNeeded {
-		return fmt.Errorf("insufficient OHLC data: got %d candles, need at least %d", len(ohlcData), candlesNeeded)
+	// Parse all candles and run data-quality checks before computing anything from them
+	candles := make([]OHLCData, 0, len(ohlcData))
+	for _, raw := range ohlcData {
+		candle, err := parseOHLCData(raw)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing OHLC data: %v", err)
+		}
+		candles = append(candles, candle)
 	}
 
-	// Get current and historical data
-	currentData, err := parseOHLCData(ohlcData[len(ohlcData)-1])
+	candles, report, err := CleanOHLC(candles, interval, DefaultOHLCQualityPolicy)
 	if err != nil {
-		return fmt.Errorf("error parsing current OHLC data: %v", err)
+		return nil, err
+	}
+	if report.HasIssues() {
+		logging.FromContext(ctx).Warn("OHLC data quality issues", "interval", interval, "report", report.String())
 	}
 
-	oldData, err := parseOHLCData(ohlcData[len(ohlcData)-candlesNeeded])
-	if err != nil {
-		return fmt.Errorf("error parsing old OHLC data: %v", err)
+	return candles, nil
+}
+
+// GetMinuteCandles retrieves the 1-minute candles of the last 12 hours for a coin,
+// checked and cleaned according to DefaultOHLCQualityPolicy
+func GetMinuteCandles(ctx context.Context, coin string) ([]OHLCData, error) {
+	return GetOHLC(ctx, coin, time.Minute, time.Time{})
+}
+
+// OHLCIntervalFor returns the shortest of OHLCIntervals whose 720 candles span the duration
+func OHLCIntervalFor(duration time.Duration) (time.Duration, error) {
+	for _, interval := range OHLCIntervals {
+		// One candle is still open, the rest has to cover the duration
+		if time.Duration(maxOHLCCandles-1)*interval >= duration {
+			return interval, nil
+		}
 	}
+	return 0, fmt.Errorf("%s is longer than Kraken's candle history", duration)
+}
 
-	// Calculate price change
-	priceChange := ((currentData.Close - oldData.Close) / oldData.Close) * 100
+// PriceChange is the change between two closes
+type PriceChange struct {
+	Percent   float64
+	From      OHLCData
+	To        OHLCData
+	Timeframe time.Duration
+}
 
-	// Print the information
-	fmt.Printf("\n%s/USD Price Change in timeframe %s (OHLC API):\n", coin, duration)
-	fmt.Printf("Current Price: %.8f\n", currentData.Close)
-	fmt.Printf("Price %s ago: %.8f\n", duration, oldData.Close)
-	fmt.Printf("Price Change: %.2f%%\n", priceChange)
-	fmt.Printf("Time: %s\n", time.Unix(currentData.Time, 0).Format(time.RFC3339))
-	fmt.Printf("Time %s ago: %s\n", duration, time.Unix(oldData.Time, 0).Format(time.RFC3339))
+// String formats the change for logs and messages
+func (c *PriceChange) String() string {
+	return fmt.Sprintf("%+.2f%% over %s (%g at %s, %g at %s)", c.Percent, c.Timeframe,
+		c.From.Close, time.Unix(c.From.Time, 0).UTC().Format(time.RFC3339),
+		c.To.Close, time.Unix(c.To.Time, 0).UTC().Format(time.RFC3339))
+}
 
-	// Check if price change is significant (e.g., more than 5%)
-	priceChangeThreshold := 5.0
-	if priceChange > priceChangeThreshold {
-		fmt.Printf("WARNING: Price increased by more than %.1f%% in the last %s\n", priceChangeThreshold, duration)
-	} else if priceChange < -priceChangeThreshold {
-		fmt.Printf("WARNING: Price decreased by more than %.1f%% in the last %s\n", priceChangeThreshold, duration)
+// PriceChangeOf returns the change from the close of the latest candle at least duration older than
+// the latest one to the latest close
+func PriceChangeOf(candles []OHLCData, duration time.Duration) (*PriceChange, error) {
+	if len(candles) == 0 {
+		return nil, fmt.Errorf("no OHLC data to compute the price change")
+	}
+	latest := candles[len(candles)-1]
+	until := latest.Time - int64(duration.Seconds())
+	i := sort.Search(len(candles), func(i int) bool { return candles[i].Time > until }) - 1
+	if i < 0 {
+		return nil, fmt.Errorf("insufficient OHLC data: candles span %s, need %s",
+			time.Duration(latest.Time-candles[0].Time)*time.Second, duration)
 	}
+	from := candles[i]
+	if from.Close <= 0 {
+		return nil, fmt.Errorf("invalid close price %g", from.Close)
+	}
+	return &PriceChange{
+		Percent:   (latest.Close - from.Close) / from.Close * 100,
+		From:      from,
+		To:        latest,
+		Timeframe: time.Duration(latest.Time-from.Time) * time.Second,
+	}, nil
+}
+
+// GetPriceChange returns the coin's price change over the duration, from the closes of the
+// shortest candle interval covering it
+func GetPriceChange(ctx context.Context, coin string, duration time.Duration) (*PriceChange, error) {
+	interval, err := OHLCIntervalFor(duration)
+	if err != nil {
+		return nil, err
+	}
+	candles, err := GetOHLC(ctx, coin, interval, time.Time{})
+	if err != nil {
+		return nil, err
+	}
+	return PriceChangeOf(candles, duration)
+}
 
-	return nil
+// FormatOHLC formats candles as a table, one per line, with their open time in UTC
+func FormatOHLC(candles []OHLCData) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%-20s %14s %14s %14s %14s %16s\n", "TIME", "OPEN", "HIGH", "LOW", "CLOSE", "VOLUME")
+	for _, c := range candles {
+		fmt.Fprintf(&b, "%-20s %14g %14g %14g %14g %16g\n",
+			time.Unix(c.Time, 0).UTC().Format(time.RFC3339), c.Open, c.High, c.Low, c.Close, c.Volume)
+	}
+	return b.String()
+}
+
+// validOHLCInterval reports whether Kraken serves candles of the interval
+func validOHLCInterval(interval time.Duration) bool {
+	for _, valid := range OHLCIntervals {
+		if interval == valid {
+			return true
+		}
+	}
+	return false
+}
+
+// formatIntervals lists OHLCIntervals in Kraken's minutes
+func formatIntervals() string {
+	minutes := make([]string, len(OHLCIntervals))
+	for i, interval := range OHLCIntervals {
+		minutes[i] = strconv.Itoa(int(interval.Minutes()))
+	}
+	return strings.Join(minutes, ", ") + " minute candles"
 }
 
 // parseOHLCData converts raw OHLC data to structured format
@@ -0,0 +1,140 @@
+package kraken
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"time"
+)
+
+// OHLCQualityPolicy controls what happens to candles failing data-quality checks
+type OHLCQualityPolicy int
+
+const (
+	// OHLCInterpolate fills missing candles and clamps absurd wicks
+	OHLCInterpolate OHLCQualityPolicy = iota
+	// OHLCReject fails the whole series if any check fails
+	OHLCReject
+)
+
+// DefaultOHLCQualityPolicy is applied to OHLC data before any price change or indicator is computed
+var DefaultOHLCQualityPolicy = OHLCInterpolate
+
+const (
+	// Wicks longer than this multiple of the median candle range are considered outliers
+	outlierRangeMultiple = 10.0
+	// Wicks shorter than this share of the close price are never outliers, avoids flagging flat markets
+	outlierMinWickPercent = 5.0
+	// Series with a larger share of zero-volume candles are rejected under OHLCReject
+	maxZeroVolumePercent = 50.0
+)
+
+// ParseOHLCQualityPolicy converts a policy name (interpolate, reject) to a policy
+func ParseOHLCQualityPolicy(name string) (OHLCQualityPolicy, error) {
+	switch name {
+	case "interpolate":
+		return OHLCInterpolate, nil
+	case "reject":
+		return OHLCReject, nil
+	}
+	return 0, fmt.Errorf("unknown OHLC quality policy: %s", name)
+}
+
+// OHLCQualityReport summarizes data-quality issues found in a candle series
+type OHLCQualityReport struct {
+	Missing    int // Candles missing between first and last timestamp
+	ZeroVolume int // Candles without any trades
+	Outliers   int // Candles with absurd wicks
+}
+
+// HasIssues reports whether any check found a problem
+func (r OHLCQualityReport) HasIssues() bool {
+	return r.Missing > 0 || r.ZeroVolume > 0 || r.Outliers > 0
+}
+
+// String formats the report for logging
+func (r OHLCQualityReport) String() string {
+	return fmt.Sprintf("%d missing, %d zero-volume, %d outlier candles", r.Missing, r.ZeroVolume, r.Outliers)
+}
+
+// CleanOHLC checks candles (sorted by time) for gaps, zero-volume candles and absurd wicks.
+// With OHLCInterpolate, missing candles are linearly interpolated and outlier wicks are clamped
+// to the candle body; with OHLCReject, an error is returned instead.
+func CleanOHLC(candles []OHLCData, interval time.Duration, policy OHLCQualityPolicy) ([]OHLCData, OHLCQualityReport, error) {
+	var report OHLCQualityReport
+	if len(candles) == 0 {
+		return candles, report, nil
+	}
+
+	step := int64(interval.Seconds())
+	medianRange := medianCandleRange(candles)
+
+	cleaned := make([]OHLCData, 0, len(candles))
+	for i, candle := range candles {
+		// Fill gaps between the previous and current candle
+		if i > 0 && step > 0 {
+			prev := cleaned[len(cleaned)-1]
+			missing := int((candle.Time-prev.Time)/step) - 1
+			if missing > 0 {
+				report.Missing += missing
+				if policy == OHLCInterpolate {
+					for m := 1; m <= missing; m++ {
+						ratio := float64(m) / float64(missing+1)
+						price := prev.Close + (candle.Open-prev.Close)*ratio
+						cleaned = append(cleaned, OHLCData{
+							Time:  prev.Time + int64(m)*step,
+							Open:  price,
+							High:  price,
+							Low:   price,
+							Close: price,
+						})
+					}
+				}
+			}
+		}
+
+		if candle.Volume == 0 {
+			report.ZeroVolume++
+		}
+
+		// Clamp wicks that are absurdly long compared to typical candles
+		bodyHigh := math.Max(candle.Open, candle.Close)
+		bodyLow := math.Min(candle.Open, candle.Close)
+		if isOutlierWick(candle.High-bodyHigh, candle.Close, medianRange) || isOutlierWick(bodyLow-candle.Low, candle.Close, medianRange) {
+			report.Outliers++
+			if policy == OHLCInterpolate {
+				candle.High = bodyHigh
+				candle.Low = bodyLow
+			}
+		}
+
+		cleaned = append(cleaned, candle)
+	}
+
+	if policy == OHLCReject {
+		zeroVolumePercent := float64(report.ZeroVolume) / float64(len(candles)) * 100
+		if report.Missing > 0 || report.Outliers > 0 || zeroVolumePercent > maxZeroVolumePercent {
+			return nil, report, fmt.Errorf("OHLC data rejected: %s", report)
+		}
+	}
+
+	return cleaned, report, nil
+}
+
+// isOutlierWick reports whether a wick is far outside the typical candle range
+func isOutlierWick(wick float64, close float64, medianRange float64) bool {
+	if close <= 0 || wick/close*100 < outlierMinWickPercent {
+		return false
+	}
+	return wick > medianRange*outlierRangeMultiple
+}
+
+// medianCandleRange returns the median high-low range of the candles
+func medianCandleRange(candles []OHLCData) float64 {
+	ranges := make([]float64, len(candles))
+	for i, candle := range candles {
+		ranges[i] = candle.High - candle.Low
+	}
+	sort.Float64s(ranges)
+	return ranges[len(ranges)/2]
+}
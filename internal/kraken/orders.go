@@ -1,13 +1,37 @@
 package kraken
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"math"
-	"os"
 	"strconv"
 	"strings"
 	"time"
+
+	"github.com/jkosik/crypto-trader/internal/logging"
+	"github.com/jkosik/crypto-trader/internal/money"
+)
+
+// Price multipliers used in untradeable mode to keep orders from filling
+var (
+	UntradeableBuyFactor  = 0.1  // 90% below market for buy orders
+	UntradeableSellFactor = 10.0 // 900% above market for sell orders
+)
+
+// PostOnly places and edits limit orders with oflags=post: an order that would cross the book
+// is canceled by the exchange instead of executing as taker. Paper orders ignore it.
+var PostOnly bool
+
+// ValidateOnly submits limit orders with validate=true: the exchange checks them (price precision,
+// minimum size, order parameters) without creating them, so no transaction IDs are returned.
+// Paper orders ignore it.
+var ValidateOnly bool
+
+// Time-in-force of placed limit orders
+var (
+	TimeInForce = "GTC"       // GTC (good-til-canceled), IOC (immediate-or-cancel) or GTD (good-til-date)
+	OrderExpiry time.Duration // GTD orders expire on the exchange this long after placement
 )
 
 // OrderResponse represents the Kraken API response for order placement
@@ -33,15 +57,26 @@ type OrderResponse struct {
 type OrderStatus struct {
 	Status string `json:"status"`
 	Descr  struct {
-		Order string `json:"order"`
-		Type  string `json:"type"`
-		Price string `json:"price"`
-		Pair  string `json:"pair"`
+		Order     string `json:"order"`
+		Type      string `json:"type"`
+		OrderType string `json:"ordertype"`
+		Price     string `json:"price"`
+		Pair      string `json:"pair"`
 	} `json:"descr"`
-	Vol     string `json:"vol"`
-	VolExec string `json:"vol_exec"`
-	Cost    string `json:"cost"`
-	Fee     string `json:"fee"`
+	Vol     string  `json:"vol"`
+	VolExec string  `json:"vol_exec"`
+	Cost    string  `json:"cost"`
+	Fee     string  `json:"fee"`
+	Reason  string  `json:"reason"`  // why the order was canceled or expired
+	UserRef int32   `json:"userref"` // shared by the orders of a trade, see UserRef
+	OpenTm  float64 `json:"opentm"`  // unix time the order was placed
+	CloseTm float64 `json:"closetm"` // unix time the order was closed, 0 while open
+}
+
+// PostOnlyCanceled reports whether the exchange canceled a post-only order unfilled because it
+// would have crossed the book and taken liquidity
+func PostOnlyCanceled(order *OrderStatus) bool {
+	return order.Status == "canceled" && ParseFloat(order.VolExec) == 0 && strings.Contains(strings.ToLower(order.Reason), "post only")
 }
 
 // OpenOrdersResponse represents the response from the Kraken API for open orders
@@ -52,57 +87,61 @@ type OpenOrdersResponse struct {
 	} `json:"result"`
 }
 
-// PlaceLimitOrder places a limit order on Kraken
-func PlaceLimitOrder(coin string, price float64, volume float64, isBuy bool, untradeable bool) (string, error) {
-	urlBase := "https://api.kraken.com"
-	urlPath := "/0/private/AddOrder"
+// PlaceLimitOrder places a limit order on Kraken tagged with userref, with the TimeInForce in effect.
+// Price and volume are rounded to the pair's precision and checked against its order minimums.
+func PlaceLimitOrder(ctx context.Context, pair *AssetPair, price float64, volume float64, isBuy bool, untradeable bool, userref int32) (string, error) {
+	return PlaceLimitOrderTimeInForce(ctx, pair, price, volume, isBuy, untradeable, userref, TimeInForce)
+}
 
-	// Create nonce
-	nonce := time.Now().UnixNano() / int64(time.Millisecond)
+// PlaceLimitOrderTimeInForce places a limit order like PlaceLimitOrder with its own time-in-force
+// (GTC, IOC or GTD) instead of the TimeInForce in effect
+func PlaceLimitOrderTimeInForce(ctx context.Context, pair *AssetPair, price float64, volume float64, isBuy bool, untradeable bool, userref int32, timeInForce string) (string, error) {
+	urlPath := "/0/private/AddOrder"
+	log := logging.FromContext(ctx)
 
-	// Determine order type
-	orderType := "sell"
-	if isBuy {
-		orderType = "buy"
+	orderType, price, volume, err := prepareLimitOrder(ctx, pair, price, volume, isBuy, untradeable)
+	if err != nil {
+		return "", err
 	}
 
-	// In untradeable mode, use extreme prices to prevent order filling. Estimated profit still shows the spread size.
-	if untradeable {
-		if isBuy {
-			fmt.Printf("\nOriginal buy price: %.6f", price)
-			price = price * 0.1 // 90% below market for buy orders
-			fmt.Printf("\nSetting untradeable buy price: %.6f\n", price)
-		} else {
-			fmt.Printf("\nOriginal sell price: %.6f", price)
-			price = price * 10.0 // 900% above market for sell orders
-			fmt.Printf("\nSetting untradeable sell price: %.6f\n", price)
+	// Paper orders never reach the exchange
+	if Paper() {
+		txId, err := placePaperOrder(ctx, pair, price, volume, isBuy, timeInForce)
+		if err != nil {
+			return "", err
 		}
+		log.Info("Placed paper order", "type", orderType, "txid", txId, "price", pair.FormatPrice(price), "volume", pair.FormatVolume(volume))
+		return txId, nil
 	}
 
-	// Create payload
-	payload := fmt.Sprintf(`{
-		"nonce": "%d",
-		"ordertype": "limit",
-		"type": "%s",
-		"pair": "%s/USD",
-		"price": %.6f,
-		"volume": "%.5f"
-	}`, nonce, orderType, coin, price, volume)
-
-	// Debug: Print the payload
-	// fmt.Printf("[DEBUG] Payload: %s\n", payload)
-
-	// Get signature for the request
-	signature, err := GetKrakenSignature(urlPath, payload, os.Getenv("KRAKEN_PRIVATE_KEY"))
-	if err != nil {
-		return "", fmt.Errorf("error generating signature: %v", err)
+	// Respect the per-pair trading counter
+	if err := waitOrder(ctx, pair.Name, 1); err != nil {
+		return "", err
 	}
 
-	// Make request
-	body, err := MakePrivateRequest(urlBase+urlPath, "POST", payload, os.Getenv("KRAKEN_API_KEY"), signature)
-	if err != nil {
+	// Create payload and make request. Network errors are not retried to avoid duplicate orders,
+	// the order is looked up by its userref, side, price and volume instead: it may have been
+	// placed before the connection failed.
+	sent := time.Now()
+	body, err := privateRequest(ctx, urlPath, false, func(nonce int64) string {
+		return limitOrderPayload(nonce, orderType, pair, price, volume, userref, timeInForce)
+	})
+	// Validated orders are never created, there's nothing to look up
+	if err != nil && ValidateOnly {
 		return "", fmt.Errorf("error making request: %v", err)
 	}
+	if err != nil {
+		txId, _, findErr := findPlacedOrder(ctx, userref, orderType, "limit", price, volume, sent)
+		if findErr != nil {
+			log.Warn("Failed to look up the order after a request error", "userref", userref, "error", findErr)
+		}
+		if txId == "" {
+			return "", fmt.Errorf("error making request: %v", err)
+		}
+		log.Warn("Order was placed despite the request error", "type", orderType, "txid", txId, "userref", userref, "error", err)
+		recordOrderPlaced(txId, pair.Name)
+		return txId, nil
+	}
 
 	// Parse response
 	var response OrderResponse
@@ -114,20 +153,186 @@ func PlaceLimitOrder(coin string, price float64, volume float64, isBuy bool, unt
 		return "", fmt.Errorf("API error: %v", response.Error)
 	}
 
+	if ValidateOnly {
+		log.Info("Validated order",
+			"type", orderType,
+			"price", pair.FormatPrice(price),
+			"volume", pair.FormatVolume(volume),
+			"description", response.Result.Description.Order)
+		return "", nil
+	}
+
+	if len(response.Result.TransactionIds) == 0 {
+		return "", fmt.Errorf("no transaction ID returned")
+	}
+
+	recordOrderPlaced(response.Result.TransactionIds[0], pair.Name)
+
+	log.Info("Placed order",
+		"type", orderType,
+		"txid", response.Result.TransactionIds[0],
+		"price", pair.FormatPrice(price),
+		"volume", pair.FormatVolume(volume),
+		"description", response.Result.Description.Order,
+		"untradeable", untradeable,
+		"post_only", PostOnly,
+		"time_in_force", timeInForce,
+		"userref", userref)
+
+	return response.Result.TransactionIds[0], nil
+}
+
+// PlaceMarketOrder places a market order for volume, rounded down to the pair's lot decimals and
+// checked against its minimums at refPrice (the bid of a sell, the ask of a buy). It takes
+// liquidity and pays the taker fee, paper trading doesn't simulate it.
+func PlaceMarketOrder(ctx context.Context, pair *AssetPair, volume float64, isBuy bool, refPrice float64, userref int32) (string, error) {
+	volume = pair.RoundVolume(volume)
+	if err := pair.ValidateOrder(refPrice, volume); err != nil {
+		return "", err
+	}
+	return addOrder(ctx, pair, isBuy, userref, "market", 0, volume, fmt.Sprintf(`"ordertype": "market",
+			"volume": "%s"`, pair.FormatVolume(volume)))
+}
+
+// addOrder places an order other than the bot's limit orders from its ordertype and price fields.
+// Like limit orders, a request that failed in transit is looked up instead of retried, by the
+// order's price (0 for any) and volume as placed.
+func addOrder(ctx context.Context, pair *AssetPair, isBuy bool, userref int32, kind string, price float64, volume float64, fields string) (string, error) {
+	urlPath := "/0/private/AddOrder"
+	log := logging.FromContext(ctx)
+
+	if Paper() {
+		return "", fmt.Errorf("%s orders are not supported in paper trading", kind)
+	}
+	orderType := "sell"
+	if isBuy {
+		orderType = "buy"
+	}
+	if err := waitOrder(ctx, pair.Name, 1); err != nil {
+		return "", err
+	}
+
+	sent := time.Now()
+	body, err := privateRequest(ctx, urlPath, false, func(nonce int64) string {
+		return fmt.Sprintf(`{
+			"nonce": "%d",
+			"pair": "%s",
+			"type": "%s",
+			%s,
+			"userref": %d%s
+		}`, nonce, pair.Altname, orderType, fields, userref, validateField())
+	})
+	if err != nil && ValidateOnly {
+		return "", fmt.Errorf("error making request: %v", err)
+	}
+	if err != nil {
+		txId, _, findErr := findPlacedOrder(ctx, userref, orderType, kind, price, volume, sent)
+		if findErr != nil {
+			log.Warn("Failed to look up the order after a request error", "userref", userref, "error", findErr)
+		}
+		if txId == "" {
+			return "", fmt.Errorf("error making request: %v", err)
+		}
+		log.Warn("Order was placed despite the request error", "type", orderType, "ordertype", kind, "txid", txId, "userref", userref, "error", err)
+		recordOrderPlaced(txId, pair.Name)
+		return txId, nil
+	}
+
+	var response OrderResponse
+	if err := json.Unmarshal(body, &response); err != nil {
+		return "", fmt.Errorf("error parsing response: %v", err)
+	}
+	if len(response.Error) > 0 {
+		return "", fmt.Errorf("API error: %v", response.Error)
+	}
+	if ValidateOnly {
+		log.Info("Validated order", "type", orderType, "ordertype", kind, "description", response.Result.Description.Order)
+		return "", nil
+	}
 	if len(response.Result.TransactionIds) == 0 {
 		return "", fmt.Errorf("no transaction ID returned")
 	}
+	txId := response.Result.TransactionIds[0]
+	recordOrderPlaced(txId, pair.Name)
+	log.Info("Placed order", "type", orderType, "ordertype", kind, "txid", txId,
+		"description", response.Result.Description.Order, "userref", userref)
+	return txId, nil
+}
+
+// prepareLimitOrder returns the side of an order and its price and volume as placed: moved out
+// of reach in untradeable mode, rounded to the pair's precision and checked against its minimums
+func prepareLimitOrder(ctx context.Context, pair *AssetPair, price float64, volume float64, isBuy bool, untradeable bool) (string, float64, float64, error) {
+	orderType := "sell"
+	if isBuy {
+		orderType = "buy"
+	}
 
-	// Print order details
-	fmt.Printf("\nPlaced %s order:\n", orderType)
-	fmt.Printf("Price: %.6f\n", price)
-	fmt.Printf("Volume: %.5f\n", volume)
-	fmt.Printf("Order description: %s\n", response.Result.Description.Order)
+	// In untradeable mode, use extreme prices to prevent order filling. Estimated profit still shows the spread size.
 	if untradeable {
-		fmt.Println("UNTRADEABLE: Order placed with extreme price to prevent filling")
+		originalPrice := price
+		if isBuy {
+			price = price * UntradeableBuyFactor
+		} else {
+			price = price * UntradeableSellFactor
+		}
+		logging.FromContext(ctx).Info("Setting untradeable price", "type", orderType, "original_price", originalPrice, "price", price)
 	}
 
-	return response.Result.TransactionIds[0], nil
+	price = pair.RoundPrice(price)
+	volume = pair.RoundVolume(volume)
+	if err := pair.ValidateOrder(price, volume); err != nil {
+		return "", 0, 0, err
+	}
+	return orderType, price, volume, nil
+}
+
+// limitOrderPayload builds the AddOrder payload of a limit order with the order flags in effect
+// and timeInForce
+func limitOrderPayload(nonce int64, orderType string, pair *AssetPair, price float64, volume float64, userref int32, timeInForce string) string {
+	return fmt.Sprintf(`{
+			"nonce": "%d",
+			"pair": "%s",
+			%s%s
+		}`, nonce, pair.Altname, limitOrderFields(orderType, pair, price, volume, userref, timeInForce), validateField())
+}
+
+// validateField returns the validate parameter of an AddOrder or AddOrderBatch request with
+// ValidateOnly. It belongs to the request: Kraken ignores it inside the orders of a batch.
+func validateField() string {
+	if !ValidateOnly {
+		return ""
+	}
+	return `,
+			"validate": true`
+}
+
+// limitOrderFields builds the fields of a limit order shared by AddOrder and the orders of
+// AddOrderBatch, without the request's validate parameter
+func limitOrderFields(orderType string, pair *AssetPair, price float64, volume float64, userref int32, timeInForce string) string {
+	// userref and cl_ord_id are mutually exclusive, orders are correlated by userref alone
+	options := fmt.Sprintf(`,
+			"userref": %d`, userref)
+	if PostOnly {
+		options += `,
+			"oflags": "post"`
+	}
+	if timeInForce != "GTC" {
+		options += fmt.Sprintf(`,
+			"timeinforce": "%s"`, timeInForce)
+	}
+	if timeInForce == "GTD" {
+		// Relative expiration, counted by the exchange from when it accepts the order
+		options += fmt.Sprintf(`,
+			"expiretm": "+%d"`, int64(math.Ceil(OrderExpiry.Seconds())))
+	}
+	options += marginFields()
+	if CloseOrderType != "" {
+		options += closeFields(pair, orderType == "buy", price)
+	}
+	return fmt.Sprintf(`"ordertype": "limit",
+			"type": "%s",
+			"price": "%s",
+			"volume": "%s"%s`, orderType, pair.FormatPrice(price), pair.FormatVolume(volume), options)
 }
 
 // PlaceSpreadOrders places a spread of buy and sell orders
@@ -136,159 +341,206 @@ func PlaceLimitOrder(coin string, price float64, volume float64, isBuy bool, unt
 // - 0.5 means half the spread
 // - 0.25 means quarter of the spread
 // - 1.0 means place orders at center price (minimum spread)
-func PlaceSpreadOrders(coin string, spreadInfo *SpreadInfo, volume float64, untradeable bool, spreadNarrowFactor float64) (string, string, float64, float64, error) {
+// If bands is set, the narrowed prices are clamped inside the volatility bands.
+// The estimated profit is net of the maker fee of both legs.
+func PlaceSpreadOrders(ctx context.Context, coin string, pair *AssetPair, spreadInfo *SpreadInfo, volume float64, untradeable bool, spreadNarrowFactor float64, bands *PriceBands, makerFeePercent float64, userref int32) (string, string, float64, float64, error) {
 	// Ensure spreadNarrowFactor is between 0 and 1
-	if spreadNarrowFactor < 0 {
-		spreadNarrowFactor = 0
-	} else if spreadNarrowFactor > 1 {
-		spreadNarrowFactor = 1
-	}
+	spreadNarrowFactor = clampNarrowFactor(spreadNarrowFactor)
 
-	fmt.Printf("\nBid price: %.6f\n", spreadInfo.BidPrice)
-	fmt.Printf("Ask price: %.6f\n", spreadInfo.AskPrice)
+	log := logging.FromContext(ctx)
+	log.Debug("Spread boundary", "bid", spreadInfo.BidPrice, "ask", spreadInfo.AskPrice)
 
 	// Calculate the center price of the spread
 	centerPrice := (spreadInfo.AskPrice + spreadInfo.BidPrice) / 2
 
-	// Check decimal places in both bid and ask prices
-	bidStr := strconv.FormatFloat(spreadInfo.BidPrice, 'f', -1, 64)
-	askStr := strconv.FormatFloat(spreadInfo.AskPrice, 'f', -1, 64)
-
-	bidDecimals := 0
-	if idx := strings.Index(bidStr, "."); idx != -1 {
-		bidDecimals = len(bidStr) - idx - 1
+	// Narrow the spread, keep the prices inside the recent volatility bands and round them to the pair's precision
+	newBuyPrice, newSellPrice := SpreadOrderPrices(pair, spreadInfo, spreadNarrowFactor, bands)
+	if bands != nil {
+		narrowedBuy, narrowedSell := NarrowSpread(spreadInfo.BidPrice, spreadInfo.AskPrice, spreadNarrowFactor)
+		if clampedBuy, clampedSell := bands.Clamp(narrowedBuy, narrowedSell); clampedBuy != narrowedBuy || clampedSell != narrowedSell {
+			log.Info("Clamped prices to volatility bands",
+				"percentile", bands.Percentile,
+				"lower", bands.Lower,
+				"upper", bands.Upper,
+				"buy_price", narrowedBuy,
+				"clamped_buy_price", clampedBuy,
+				"sell_price", narrowedSell,
+				"clamped_sell_price", clampedSell)
+		}
 	}
+	log.Debug("Rounded prices to pair precision", "decimals", pair.PairDecimals, "tick_size", pair.TickSize)
 
-	askDecimals := 0
-	if idx := strings.Index(askStr, "."); idx != -1 {
-		askDecimals = len(askStr) - idx - 1
+	// Reject orders the exchange would refuse before placing any leg
+	volume = pair.RoundVolume(volume)
+	if err := pair.ValidateOrder(newBuyPrice, volume); err != nil {
+		return "", "", 0, 0, err
+	}
+	if err := pair.ValidateOrder(newSellPrice, volume); err != nil {
+		return "", "", 0, 0, err
 	}
-
-	// Use the higher number of decimals
-	decimals := max(bidDecimals, askDecimals)
-
-	fmt.Printf("\nBid: %s (%d decimals)\n", bidStr, bidDecimals)
-	fmt.Printf("Ask: %s (%d decimals)\n", askStr, askDecimals)
-	fmt.Printf("Using %d decimal places\n", decimals)
-
-	// Calculate new buy and sell prices based on the narrowing factor
-	newBuyPrice := spreadInfo.BidPrice + (centerPrice-spreadInfo.BidPrice)*spreadNarrowFactor
-	newSellPrice := spreadInfo.AskPrice - (spreadInfo.AskPrice-centerPrice)*spreadNarrowFactor
-
-	// Round to detected decimal places
-	multiplier := math.Pow10(decimals)
-	newBuyPrice = math.Round(newBuyPrice*multiplier) / multiplier
-	newSellPrice = math.Round(newSellPrice*multiplier) / multiplier
 
 	// Check if narrowed prices are too close or equal
 	if newSellPrice <= newBuyPrice {
+		RecordDecision("spread_rejected", map[string]float64{"buy": newBuyPrice, "sell": newSellPrice})
+
 		// Send Slack notification about the error
-		slackErr := SendSlackMessage(fmt.Sprintf(
-			"❌ Trade %s/USD cancelled\n"+
-				"Reason: Narrowed prices are too close (buy: %.6f, sell: %.6f)\n",
-			coin,
-			newBuyPrice,
-			newSellPrice,
+		slackErr := SendSlackMessage(ctx, fmt.Sprintf(
+			"❌ Trade %s cancelled\n"+
+				"Reason: Narrowed prices are too close (buy: %s, sell: %s)\n",
+			PairName(coin),
+			pair.FormatPrice(newBuyPrice),
+			pair.FormatPrice(newSellPrice),
 		))
 		if slackErr != nil {
-			fmt.Printf("Warning: Failed to send Slack notification: %v\n", slackErr)
+			log.Warn("Failed to send Slack notification", "error", slackErr)
 		}
 
-		return "", "", 0, 0, fmt.Errorf("narrowed prices are too close or equal (buy: %.6f, sell: %.6f). Please use a lower spread narrowing factor", newBuyPrice, newSellPrice)
+		return "", "", 0, 0, fmt.Errorf("narrowed prices are too close or equal (buy: %s, sell: %s). Please use a lower spread narrowing factor", pair.FormatPrice(newBuyPrice), pair.FormatPrice(newSellPrice))
 	}
 
-	// Calculate estimated profit based on the new prices
-	estimatedProfit := (newSellPrice - newBuyPrice) * volume
+	RecordDecision("spread_prices", map[string]float64{"buy": newBuyPrice, "sell": newSellPrice})
 
-	// Calculate estimated percent gain based on the buy price
-	estimatedPercentGain := ((newSellPrice - newBuyPrice) / newBuyPrice) * 100
+	// Calculate estimated profit based on the new prices, after the fees of both legs
+	_, estimatedFees, estimatedProfit := SpreadNetProfit(newBuyPrice, newSellPrice, volume, makerFeePercent)
 
-	// Print spread information
-	fmt.Printf("\n🔄 Placing spread orders for %s/USD:\n", coin)
-	fmt.Printf("Volume: %.5f\n", volume)
-	fmt.Printf("Original buy price: %.6f\n", spreadInfo.BidPrice)
-	fmt.Printf("Original sell price: %.6f\n", spreadInfo.AskPrice)
-	fmt.Printf("Original spread: %.6f (%.4f%%)\n", spreadInfo.Spread, (spreadInfo.Spread/spreadInfo.BidPrice)*100)
-	fmt.Printf("Spread narrowing: %.2f%%\n", spreadNarrowFactor*100)
-	fmt.Printf("Center price: %.6f\n", centerPrice)
-	fmt.Printf("Narrowed buy price: %.6f\n", newBuyPrice)
-	fmt.Printf("Narrowed sell price: %.6f\n", newSellPrice)
-	fmt.Printf("Estimated profit: %.2f USD (%.4f%%)\n", estimatedProfit, estimatedPercentGain)
+	// Calculate estimated percent gain based on the buy cost
+	estimatedPercentGain := estimatedProfit / (newBuyPrice * volume) * 100
 
-	// Place buy order at the new buy price
-	buyTxId, err := PlaceLimitOrder(coin, newBuyPrice, volume, true, untradeable)
-	if err != nil {
-		return "", "", 0, 0, fmt.Errorf("error placing buy order: %v", err)
-	}
+	log.Info("Placing spread orders",
+		"volume", volume,
+		"bid", spreadInfo.BidPrice,
+		"ask", spreadInfo.AskPrice,
+		"spread", spreadInfo.Spread,
+		"spread_percent", (spreadInfo.Spread/spreadInfo.BidPrice)*100,
+		"narrowing_percent", spreadNarrowFactor*100,
+		"center_price", centerPrice,
+		"buy_price", newBuyPrice,
+		"sell_price", newSellPrice,
+		"maker_fee_percent", makerFeePercent,
+		"estimated_fees_usd", estimatedFees,
+		"estimated_profit_usd", estimatedProfit,
+		"estimated_gain_percent", estimatedPercentGain)
 
-	// Place sell order at the new sell price
-	sellTxId, err := PlaceLimitOrder(coin, newSellPrice, volume, false, untradeable)
+	// Place both legs in one request, so a failing sell can't leave the buy unhedged
+	buyTxId, sellTxId, lone, err := placeSpreadLegs(ctx, pair, newBuyPrice, newSellPrice, volume, untradeable, userref)
 	if err != nil {
-		return "", "", 0, 0, fmt.Errorf("error placing sell order: %v", err)
+		return "", "", 0, 0, err
+	}
+	if ValidateOnly {
+		log.Info("Spread orders validated, nothing was placed", "buy_price", newBuyPrice, "sell_price", newSellPrice)
+		return "", "", estimatedProfit, estimatedPercentGain, nil
+	}
+	if lone != nil {
+		txId, price, err := resolveLoneLeg(ctx, coin, pair, lone, volume, untradeable, spreadNarrowFactor, bands, makerFeePercent, userref)
+		if err != nil {
+			return "", "", 0, 0, err
+		}
+		if lone.failedSide == "buy" {
+			buyTxId, sellTxId, newBuyPrice = txId, lone.txId, price
+		} else {
+			buyTxId, sellTxId, newSellPrice = lone.txId, txId, price
+		}
+		_, estimatedFees, estimatedProfit = SpreadNetProfit(newBuyPrice, newSellPrice, volume, makerFeePercent)
+		estimatedPercentGain = estimatedProfit / (newBuyPrice * volume) * 100
 	}
 
-	fmt.Printf("\nOrders placed successfully:\n")
-	fmt.Printf("Buy Order ID: %s\n", buyTxId)
-	fmt.Printf("Sell Order ID: %s\n", sellTxId)
+	log.Info("Spread orders placed", "buy_txid", buyTxId, "sell_txid", sellTxId)
 
 	// Send Slack notification about placed orders
-	slackErr := SendSlackMessage(fmt.Sprintf(
-		"🔄 Placing spread orders for %s/USD\n"+
-			"Volume: %.5f\n"+
-			"Original buy price: %.6f\n"+
-			"Original sell price: %.6f\n"+
-			"Original spread: %.6f (%.4f%%)\n"+
+	slackErr := SendSlackMessage(ctx, fmt.Sprintf(
+		"🔄 Placing spread orders for %s\n"+
+			"Volume: %s\n"+
+			"Original buy price: %s\n"+
+			"Original sell price: %s\n"+
+			"Original spread: %s (%.4f%%)\n"+
 			"Spread narrowing: %.2f%%\n"+
-			"Center price: %.6f\n"+
-			"Narrowed buy price: %.6f\n"+
-			"Narrowed sell price: %.6f\n"+
-			"Estimated profit: %.2f USD (%.4f%%)\n"+
+			"Center price: %s\n"+
+			"Narrowed buy price: %s\n"+
+			"Narrowed sell price: %s\n"+
+			"Estimated fees: %s %s (maker %.4f%%)\n"+
+			"Estimated profit after fees: %s %s (%.4f%%)\n"+
 			"Buy Order ID: %s\n"+
 			"Sell Order ID: %s",
-		coin,
-		volume,
-		spreadInfo.BidPrice,
-		spreadInfo.AskPrice,
-		spreadInfo.Spread,
+		PairName(coin),
+		pair.FormatVolume(volume),
+		pair.FormatPrice(spreadInfo.BidPrice),
+		pair.FormatPrice(spreadInfo.AskPrice),
+		pair.FormatPrice(spreadInfo.Spread),
 		(spreadInfo.Spread/spreadInfo.BidPrice)*100,
 		spreadNarrowFactor*100,
-		centerPrice,
-		newBuyPrice,
-		newSellPrice,
-		estimatedProfit,
+		pair.FormatPrice(centerPrice),
+		pair.FormatPrice(newBuyPrice),
+		pair.FormatPrice(newSellPrice),
+		money.Format(estimatedFees, pair.QuoteAltname()), pair.QuoteAltname(),
+		makerFeePercent,
+		money.Format(estimatedProfit, pair.QuoteAltname()), pair.QuoteAltname(),
 		estimatedPercentGain,
 		buyTxId,
 		sellTxId,
 	))
 	if slackErr != nil {
-		fmt.Printf("Warning: Failed to send Slack notification: %v\n", slackErr)
+		log.Warn("Failed to send Slack notification", "error", slackErr)
 	}
 
 	return buyTxId, sellTxId, estimatedProfit, estimatedPercentGain, nil
 }
 
-// CheckOrderStatus checks and prints the status of a transaction ID
-func CheckOrderStatus(txId string) (*OrderStatus, error) {
-	urlBase := "https://api.kraken.com"
-	urlPath := "/0/private/QueryOrders"
+// SpreadOrderPrices returns the buy and sell prices PlaceSpreadOrders places for a quote:
+// the spread narrowed by narrowFactor, clamped inside bands (optional) and rounded to the pair's precision
+func SpreadOrderPrices(pair *AssetPair, spreadInfo *SpreadInfo, narrowFactor float64, bands *PriceBands) (float64, float64) {
+	buy, sell := NarrowSpread(spreadInfo.BidPrice, spreadInfo.AskPrice, narrowFactor)
+	if bands != nil {
+		buy, sell = bands.Clamp(buy, sell)
+	}
+	return pair.RoundPrice(buy), pair.RoundPrice(sell)
+}
+
+// SpreadNetProfit returns the gross profit, the fees and the net profit of buying and selling
+// volume at the given prices, both legs paying the maker fee
+func SpreadNetProfit(buy float64, sell float64, volume float64, makerFeePercent float64) (float64, float64, float64) {
+	gross := (sell - buy) * volume
+	fees := (buy + sell) * volume * makerFeePercent / 100
+	return gross, fees, gross - fees
+}
+
+// NarrowSpread moves the bid and ask towards the center of the spread by narrowFactor
+// (clamped to 0..1) and returns the resulting buy and sell prices
+func NarrowSpread(bid float64, ask float64, narrowFactor float64) (float64, float64) {
+	narrowFactor = clampNarrowFactor(narrowFactor)
+	center := (ask + bid) / 2
+	return bid + (center-bid)*narrowFactor, ask - (ask-center)*narrowFactor
+}
 
-	// Create nonce
-	nonce := time.Now().UnixNano() / int64(time.Millisecond)
+// clampNarrowFactor limits a spread narrowing factor to 0..1
+func clampNarrowFactor(f float64) float64 {
+	if f < 0 {
+		return 0
+	} else if f > 1 {
+		return 1
+	}
+	return f
+}
 
-	// Create payload with transaction ID
-	payload := fmt.Sprintf(`{
-		"nonce": "%d",
-		"txid": "%s"
-	}`, nonce, txId)
+// CheckOrderStatus checks and logs the status of a transaction ID
+func CheckOrderStatus(ctx context.Context, txId string) (*OrderStatus, error) {
+	urlPath := "/0/private/QueryOrders"
 
-	// Get signature for the request
-	signature, err := GetKrakenSignature(urlPath, payload, os.Getenv("KRAKEN_PRIVATE_KEY"))
-	if err != nil {
-		return nil, fmt.Errorf("error generating signature: %v", err)
+	if Paper() {
+		order, err := checkPaperOrder(ctx, txId)
+		if err != nil {
+			return nil, err
+		}
+		logOrderStatus(ctx, txId, order)
+		return order, nil
 	}
 
 	// Make request
-	body, err := MakePrivateRequest(urlBase+urlPath, "POST", payload, os.Getenv("KRAKEN_API_KEY"), signature)
+	body, err := privateRequest(ctx, urlPath, true, func(nonce int64) string {
+		return fmt.Sprintf(`{
+			"nonce": "%d",
+			"txid": "%s"
+		}`, nonce, txId)
+	})
 	if err != nil {
 		return nil, fmt.Errorf("error making request: %v", err)
 	}
@@ -313,58 +565,50 @@ func CheckOrderStatus(txId string) (*OrderStatus, error) {
 		return nil, fmt.Errorf("order not found")
 	}
 
-	// Check if order is successfully closed
+	logOrderStatus(ctx, txId, &order)
+	return &order, nil
+}
+
+// logOrderStatus logs the state of an order
+func logOrderStatus(ctx context.Context, txId string, order *OrderStatus) {
+	log := logging.FromContext(ctx).With("txid", txId, "type", order.Descr.Type, "status", order.Status)
 	if order.Status == "closed" {
-		fmt.Println("✅ TRADE SUCCESSFUL: Order has been fully executed")
-	} else if order.Status == "partial" {
-		fmt.Printf("⚠️ PARTIAL FILL: %.2f%% of the order has been executed\n",
-			parseFloat(order.VolExec)/parseFloat(order.Vol)*100)
+		log.Info("Order has been fully executed")
+	} else if order.Status == "partial" || (order.Status == "open" && ParseFloat(order.VolExec) > 0) {
+		log.Info("Order has been partially filled", "filled_percent", ParseFloat(order.VolExec)/ParseFloat(order.Vol)*100)
 	} else if order.Status == "canceled" {
-		fmt.Println("❌ TRADE CANCELED: Order was canceled")
+		log.Warn("Order was canceled")
 	} else if order.Status == "rejected" {
-		fmt.Println("❌ TRADE REJECTED: Order was rejected")
+		log.Warn("Order was rejected")
 	} else if order.Status == "expired" {
-		fmt.Println("❌ TRADE EXPIRED: Order has expired")
+		log.Warn("Order has expired")
 	} else if order.Status == "open" {
-		fmt.Println("⏳ ORDER OPEN: Waiting for execution")
+		log.Info("Order open, waiting for execution")
 	}
-
-	return &order, nil
 }
 
-// Helper function to parse float from string
-func parseFloat(s string) float64 {
+// ParseFloat parses a number of an API response, malformed numbers count as 0
+func ParseFloat(s string) float64 {
 	f, _ := strconv.ParseFloat(s, 64)
 	return f
 }
 
 // GetOpenOrders retrieves all open orders for a given trading pair
-func GetOpenOrders(coin string) (map[string]OrderStatus, error) {
-	urlBase := "https://api.kraken.com"
+func GetOpenOrders(ctx context.Context, coin string) (map[string]OrderStatus, error) {
 	urlPath := "/0/private/OpenOrders"
 
-	// Create nonce
-	nonce := time.Now().UnixNano() / int64(time.Millisecond)
-
-	// Create payload
-	payload := fmt.Sprintf(`{
-		"nonce": "%d"
-	}`, nonce)
-
-	// Get signature for the request
-	signature, err := GetKrakenSignature(urlPath, payload, os.Getenv("KRAKEN_PRIVATE_KEY"))
-	if err != nil {
-		return nil, fmt.Errorf("error generating signature: %v", err)
-	}
-
 	// Make request
-	body, err := MakePrivateRequest(urlBase+urlPath, "POST", payload, os.Getenv("KRAKEN_API_KEY"), signature)
+	body, err := privateRequest(ctx, urlPath, true, func(nonce int64) string {
+		return fmt.Sprintf(`{
+			"nonce": "%d"
+		}`, nonce)
+	})
 	if err != nil {
 		return nil, fmt.Errorf("error making request: %v", err)
 	}
 
-	// Debug: Print raw response body
-	// fmt.Printf("\n[DEBUG] Raw API response body:\n%s\n", string(body))
+	log := logging.FromContext(ctx)
+	log.Debug("Open orders response", "body", string(body))
 
 	// Parse response
 	var response OpenOrdersResponse
@@ -376,31 +620,27 @@ func GetOpenOrders(coin string) (map[string]OrderStatus, error) {
 		return nil, fmt.Errorf("API error: %v", response.Error)
 	}
 
-	// Debug: Print all orders before filtering
-	// if len(response.Result.Open) == 0 {
-	// 	fmt.Println("[DEBUG] No open orders found in the account")
-	// } else {
-	// 	fmt.Printf("[DEBUG] Found %d total open orders (of any pairs) in the account\n", len(response.Result.Open))
-	// 	for txId, order := range response.Result.Open {
-	// 		fmt.Printf("[DEBUG] Order %s: Status=%s, Description=%s, Type=%s, Price=%s, Volume=%s\n", txId, order.Status, order.Descr.Order, order.Descr.Type, order.Descr.Price, order.Vol)
-	// 	}
-	// }
+	log.Debug("Open orders in the account (any pair)", "count", len(response.Result.Open))
+	for txId, order := range response.Result.Open {
+		log.Debug("Open order", "txid", txId, "status", order.Status, "description", order.Descr.Order, "type", order.Descr.Type, "price", order.Descr.Price, "volume", order.Vol)
+	}
 
-	// Filter orders for the specific coin
+	// Filter orders for the specific coin. Descriptions name the pair by its altname between spaces
+	// ("buy 1.0 XBTUSD @ limit 30000"), so SOLUSD doesn't match SOLUSDT orders.
 	filteredOrders := make(map[string]OrderStatus)
-	pair := coin + "USD"
+	pair := " " + Altname(coin) + Altname(Quote) + " "
 	for txId, order := range response.Result.Open {
 		// Skip empty orders
 		if order.Status == "" || order.Descr.Order == "" {
-			// fmt.Printf("[DEBUG] Skipping empty order %s\n", txId)
+			log.Debug("Skipping empty order", "txid", txId)
 			continue
 		}
 		// Check if the order description contains the pair
 		if strings.Contains(order.Descr.Order, pair) {
 			filteredOrders[txId] = order
-			// fmt.Printf("[DEBUG] Found matching order %s: %s\n", txId, order.Descr.Order)
+			log.Debug("Found matching order", "txid", txId, "description", order.Descr.Order)
 		} else {
-			// fmt.Printf("[DEBUG] Order %s does not match pair %s: %s\n", txId, pair, order.Descr.Order)
+			log.Debug("Order does not match pair", "txid", txId, "filter", pair, "description", order.Descr.Order)
 		}
 	}
 
@@ -408,27 +648,25 @@ func GetOpenOrders(coin string) (map[string]OrderStatus, error) {
 }
 
 // CancelOrder cancels a specific order by its transaction ID
-func CancelOrder(txId string) error {
-	urlBase := "https://api.kraken.com"
+func CancelOrder(ctx context.Context, txId string) error {
 	urlPath := "/0/private/CancelOrder"
 
-	// Create nonce
-	nonce := time.Now().UnixNano() / int64(time.Millisecond)
-
-	// Create payload
-	payload := fmt.Sprintf(`{
-		"nonce": "%d",
-		"txid": "%s"
-	}`, nonce, txId)
+	if Paper() {
+		return cancelPaperOrder(txId)
+	}
 
-	// Get signature for the request
-	signature, err := GetKrakenSignature(urlPath, payload, os.Getenv("KRAKEN_PRIVATE_KEY"))
-	if err != nil {
-		return fmt.Errorf("error generating signature: %v", err)
+	// Cancelling young orders costs extra trading counter points
+	if err := waitCancel(ctx, txId); err != nil {
+		return err
 	}
 
 	// Make request
-	body, err := MakePrivateRequest(urlBase+urlPath, "POST", payload, os.Getenv("KRAKEN_API_KEY"), signature)
+	body, err := privateRequest(ctx, urlPath, true, func(nonce int64) string {
+		return fmt.Sprintf(`{
+			"nonce": "%d",
+			"txid": "%s"
+		}`, nonce, txId)
+	})
 	if err != nil {
 		return fmt.Errorf("error making request: %v", err)
 	}
@@ -0,0 +1,25 @@
+package kraken
+
+import "testing"
+
+// benchPair is a typical small-cap USD pair
+var benchPair = &AssetPair{
+	Name:         "GHIBLIUSD",
+	Altname:      "GHIBLIUSD",
+	WSName:       "GHIBLI/USD",
+	Base:         "GHIBLI",
+	Quote:        "ZUSD",
+	PairDecimals: 5,
+	LotDecimals:  8,
+	OrderMin:     50,
+	CostMin:      0.5,
+	TickSize:     0.00001,
+	Status:       StatusOnline,
+}
+
+func BenchmarkLimitOrderPayload(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		limitOrderPayload(int64(i), "buy", benchPair, 0.00309, 3000, 1596758529, "GTC")
+	}
+}
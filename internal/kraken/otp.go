@@ -0,0 +1,82 @@
+package kraken
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base32"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/jkosik/crypto-trader/internal/redact"
+)
+
+// OTP is sent as the otp field of every private request, for API keys with two-factor
+// authentication: the key's static password, or a code if TOTPSecret is empty. KRAKEN_API_OTP
+// sets it for every command.
+var OTP = os.Getenv("KRAKEN_API_OTP")
+
+// TOTPSecret is the base32 secret of an API key secured with an authenticator app (TOTP): a
+// fresh code is generated for every request and takes precedence over OTP.
+// KRAKEN_API_TOTP_SECRET sets it for every command.
+var TOTPSecret = os.Getenv("KRAKEN_API_TOTP_SECRET")
+
+func init() {
+	redact.SecretEnv = append(redact.SecretEnv, "KRAKEN_API_OTP", "KRAKEN_API_TOTP_SECRET")
+	redact.Register(OTP, TOTPSecret)
+}
+
+// SetOTP sets the static password or code sent with private requests, empty keeps the current one
+func SetOTP(otp string) {
+	if otp == "" {
+		return
+	}
+	redact.Register(otp)
+	OTP = otp
+}
+
+// currentOTP returns the otp of a request made now, empty without two-factor authentication
+func currentOTP() (string, error) {
+	if TOTPSecret != "" {
+		return TOTP(TOTPSecret, time.Now())
+	}
+	return OTP, nil
+}
+
+// TOTP returns the 6-digit time-based one-time password (RFC 6238: HMAC-SHA1, 30 second steps)
+// of a base32 secret at t
+func TOTP(secret string, t time.Time) (string, error) {
+	normalized := strings.ToUpper(strings.ReplaceAll(strings.TrimSpace(secret), " ", ""))
+	key, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(strings.TrimRight(normalized, "="))
+	if err != nil {
+		return "", fmt.Errorf("invalid TOTP secret: %v", err)
+	}
+
+	var counter [8]byte
+	binary.BigEndian.PutUint64(counter[:], uint64(t.Unix()/30))
+	mac := hmac.New(sha1.New, key)
+	mac.Write(counter[:])
+	sum := mac.Sum(nil)
+
+	// Dynamic truncation
+	offset := sum[len(sum)-1] & 0x0f
+	code := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	return fmt.Sprintf("%06d", code%1000000), nil
+}
+
+// withOTP adds the otp field to a private request's JSON payload, which is signed afterwards
+func withOTP(payload string) (string, error) {
+	otp, err := currentOTP()
+	if err != nil || otp == "" {
+		return payload, err
+	}
+	i := strings.Index(payload, "{")
+	if i == -1 {
+		return "", fmt.Errorf("payload is not a JSON object")
+	}
+	quoted, _ := json.Marshal(otp)
+	return payload[:i+1] + `"otp": ` + string(quoted) + ", " + payload[i+1:], nil
+}
@@ -0,0 +1,72 @@
+package kraken
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// Pair and exchange trading statuses
+const (
+	StatusOnline      = "online"
+	StatusLimitOnly   = "limit_only"
+	StatusPostOnly    = "post_only"
+	StatusCancelOnly  = "cancel_only"
+	StatusReduceOnly  = "reduce_only"
+	StatusMaintenance = "maintenance"
+	StatusDelisted    = "delisted" // not a Kraken status, the pair is gone from AssetPairs
+)
+
+// GetTradingStatus returns the current trading status of a pair, taking the exchange status into
+// account: an exchange in maintenance, cancel_only or post_only mode restricts every pair.
+// Unlike GetAssetPair the status is fetched fresh on every call.
+func GetTradingStatus(ctx context.Context, pair *AssetPair) (string, error) {
+	system, err := GetSystemStatus(ctx)
+	if err != nil {
+		return "", err
+	}
+	if system != StatusOnline {
+		return system, nil
+	}
+
+	url := fmt.Sprintf("%s/0/public/AssetPairs?pair=%s", BaseURL, pair.Altname)
+	body, err := publicRequest(ctx, url)
+	if err != nil {
+		return "", fmt.Errorf("error making request: %v", err)
+	}
+
+	var response struct {
+		Error  []string                   `json:"error"`
+		Result map[string]assetPairResult `json:"result"`
+	}
+	if err := json.Unmarshal(body, &response); err != nil {
+		return "", fmt.Errorf("error parsing asset pairs response: %v", err)
+	}
+	// Delisted pairs disappear from AssetPairs
+	for _, e := range response.Error {
+		if strings.HasPrefix(e, "EQuery:Unknown asset pair") {
+			return StatusDelisted, nil
+		}
+	}
+	if len(response.Error) > 0 {
+		return "", fmt.Errorf("API error: %v", response.Error)
+	}
+
+	result, ok := response.Result[pair.Name]
+	if !ok {
+		return StatusDelisted, nil
+	}
+	return result.Status, nil
+}
+
+// EntriesAllowed reports whether new spread orders may be placed in a trading status.
+// Both legs are plain limit orders, so limit_only doesn't get in the way.
+func EntriesAllowed(status string) bool {
+	return status == StatusOnline || status == StatusLimitOnly
+}
+
+// MatchingHalted reports whether open orders can't fill in a trading status, only be canceled
+func MatchingHalted(status string) bool {
+	return status == StatusCancelOnly || status == StatusMaintenance || status == StatusDelisted
+}
@@ -0,0 +1,356 @@
+package kraken
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// PaperAccount is the persisted virtual account of paper trading
+type PaperAccount struct {
+	Balances map[string]float64 `json:"balances"` // by BalanceEx asset code
+	Fees     float64            `json:"fees"`     // total simulated fees in the quote currency
+	Fills    int                `json:"fills"`    // number of fully filled orders
+}
+
+// paperOrder is a simulated limit order, filled by public trades printing through its price
+type paperOrder struct {
+	pair     *AssetPair
+	isBuy    bool
+	price    float64
+	volume   float64
+	volExec  float64
+	cost     float64
+	fee      float64
+	cursor   string    // public trades cursor, only later prints can fill the order
+	expires  time.Time // GTD expiration, zero for orders good until canceled
+	canceled bool
+	expired  bool
+}
+
+// expire ends an unfilled order past its expiration like the exchange would, the caller holds p.mu
+func (o *paperOrder) expire(now time.Time) {
+	if o.expires.IsZero() || o.canceled || o.volExec >= o.volume || now.Before(o.expires) {
+		return
+	}
+	o.canceled = true
+	o.expired = true
+}
+
+// paperExchange replaces order placement and status checks while paper trading
+type paperExchange struct {
+	mu       sync.Mutex
+	path     string
+	feeRate  float64
+	account  PaperAccount
+	orders   map[string]*paperOrder
+	sequence int
+}
+
+// activePaper is the process-wide paper exchange, nil unless paper trading
+var (
+	activePaper   *paperExchange
+	activePaperMu sync.Mutex // guards activePaper and serializes StartPaper
+)
+
+// currentPaper returns the paper exchange, nil unless paper trading
+func currentPaper() *paperExchange {
+	activePaperMu.Lock()
+	defer activePaperMu.Unlock()
+	return activePaper
+}
+
+// StartPaper routes orders to a simulated exchange backed by the virtual account at path.
+// Assets missing from the account are seeded from seed, makerFeePercent is charged on every fill.
+// Trades of one process (cmd/loop's iterations and coins) share the exchange of an account
+// started before, with its open orders.
+func StartPaper(path string, seed map[string]float64, makerFeePercent float64) error {
+	activePaperMu.Lock()
+	defer activePaperMu.Unlock()
+	if p := activePaper; p != nil && p.path == path {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		for code, amount := range seed {
+			if _, exists := p.account.Balances[code]; !exists {
+				p.account.Balances[code] = amount
+			}
+		}
+		return p.save()
+	}
+
+	p := &paperExchange{
+		path:    path,
+		feeRate: makerFeePercent / 100,
+		account: PaperAccount{Balances: map[string]float64{}},
+		orders:  map[string]*paperOrder{},
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("error reading paper account: %v", err)
+	}
+	if err == nil {
+		if err := json.Unmarshal(data, &p.account); err != nil {
+			return fmt.Errorf("error parsing paper account %s: %v", path, err)
+		}
+		if p.account.Balances == nil {
+			p.account.Balances = map[string]float64{}
+		}
+	}
+	for code, amount := range seed {
+		if _, exists := p.account.Balances[code]; !exists {
+			p.account.Balances[code] = amount
+		}
+	}
+
+	activePaper = p
+	return p.save()
+}
+
+// Paper reports whether orders go to the simulated exchange
+func Paper() bool {
+	return currentPaper() != nil
+}
+
+// PaperBalances returns the virtual balances in the shape of GetAllBalances.
+// Open paper orders hold their volume (sells) or cost (buys) like on the exchange.
+func PaperBalances() map[string]Balance {
+	p := currentPaper()
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	holds := p.holds()
+	balances := make(map[string]Balance, len(p.account.Balances))
+	for code, amount := range p.account.Balances {
+		balances[code] = Balance{Currency: code, Total: amount, Hold: holds[code], Available: amount - holds[code]}
+	}
+	return balances
+}
+
+// PaperAccountSnapshot returns a copy of the virtual account
+func PaperAccountSnapshot() PaperAccount {
+	p := currentPaper()
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	snapshot := p.account
+	snapshot.Balances = make(map[string]float64, len(p.account.Balances))
+	for code, amount := range p.account.Balances {
+		snapshot.Balances[code] = amount
+	}
+	return snapshot
+}
+
+// placePaperOrder accepts a simulated limit order. Only trades printed after placement can fill it.
+func placePaperOrder(ctx context.Context, pair *AssetPair, price float64, volume float64, isBuy bool, timeInForce string) (string, error) {
+	p := currentPaper()
+
+	_, cursor, err := GetRecentTrades(ctx, pair.Altname, "")
+	if err != nil {
+		return "", err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	// Reject orders the virtual balance can't cover, like the exchange would
+	holds := p.holds()
+	code, need := pair.Base, volume
+	if isBuy {
+		code, need = pair.Quote, price*volume*(1+p.feeRate)
+	}
+	if available := p.account.Balances[code] - holds[code]; available < need {
+		return "", fmt.Errorf("API error: [EOrder:Insufficient funds] (paper %s: have %g, need %g)", code, available, need)
+	}
+
+	p.sequence++
+	txId := fmt.Sprintf("PAPER-%d-%d", time.Now().Unix(), p.sequence)
+	order := &paperOrder{pair: pair, isBuy: isBuy, price: price, volume: volume, cursor: cursor}
+	if timeInForce == "GTD" {
+		order.expires = time.Now().Add(OrderExpiry)
+	}
+	p.orders[txId] = order
+	return txId, nil
+}
+
+// holds returns the amounts held by open paper orders per asset, the caller holds p.mu
+func (p *paperExchange) holds() map[string]float64 {
+	holds := map[string]float64{}
+	now := time.Now()
+	for _, order := range p.orders {
+		order.expire(now)
+		remaining := order.volume - order.volExec
+		if remaining <= 0 || order.canceled {
+			continue
+		}
+		if order.isBuy {
+			holds[order.pair.Quote] += remaining * order.price * (1 + p.feeRate)
+		} else {
+			holds[order.pair.Base] += remaining
+		}
+	}
+	return holds
+}
+
+// checkPaperOrder advances a simulated order with the public trades printed since the last check.
+// A buy fills with the volume of trades below its price, a sell with trades above it; trades at
+// the price are skipped since the queue ahead of the order would fill first.
+func checkPaperOrder(ctx context.Context, txId string) (*OrderStatus, error) {
+	p := currentPaper()
+
+	p.mu.Lock()
+	order, exists := p.orders[txId]
+	if exists {
+		order.expire(time.Now())
+	}
+	p.mu.Unlock()
+	if !exists {
+		return nil, fmt.Errorf("order not found")
+	}
+
+	if order.volExec < order.volume && !order.canceled {
+		trades, cursor, err := GetRecentTrades(ctx, order.pair.Altname, order.cursor)
+		if err != nil {
+			return nil, err
+		}
+
+		p.mu.Lock()
+		order.cursor = cursor
+		for _, trade := range trades {
+			through := (order.isBuy && trade.Price < order.price) || (!order.isBuy && trade.Price > order.price)
+			if !through || order.volExec >= order.volume {
+				continue
+			}
+			p.fill(order, math.Min(trade.Volume, order.volume-order.volExec))
+		}
+		err = p.save()
+		p.mu.Unlock()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	status := &OrderStatus{
+		Status:  "open",
+		Vol:     order.pair.FormatVolume(order.volume),
+		VolExec: strconv.FormatFloat(order.volExec, 'f', -1, 64),
+		Cost:    strconv.FormatFloat(order.cost, 'f', -1, 64),
+		Fee:     strconv.FormatFloat(order.fee, 'f', -1, 64),
+	}
+	if order.volExec >= order.volume {
+		status.Status = "closed"
+	} else if order.expired {
+		status.Status = "expired"
+	} else if order.canceled {
+		status.Status = "canceled"
+	}
+	status.Descr.Type = "sell"
+	if order.isBuy {
+		status.Descr.Type = "buy"
+	}
+	status.Descr.Price = order.pair.FormatPrice(order.price)
+	status.Descr.Pair = order.pair.Altname
+	status.Descr.Order = fmt.Sprintf("%s %s %s @ limit %s (paper)", status.Descr.Type, status.Vol, order.pair.Altname, status.Descr.Price)
+	return status, nil
+}
+
+// cancelPaperOrder cancels the rest of a simulated order, filled volume stays settled
+func cancelPaperOrder(txId string) error {
+	p := currentPaper()
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	order, exists := p.orders[txId]
+	if exists {
+		order.expire(time.Now())
+	}
+	if !exists || order.canceled || order.volExec >= order.volume {
+		return fmt.Errorf("no orders were canceled")
+	}
+	order.canceled = true
+	return nil
+}
+
+// editPaperOrder replaces an unfilled simulated order with one at a new price or volume, zero
+// keeps the order's value, like EditOrder and ResizeOrder
+// the original is canceled and the replacement gets a new transaction ID
+func editPaperOrder(txId string, price float64, volume float64) (string, error) {
+	p := currentPaper()
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	order, exists := p.orders[txId]
+	if exists {
+		order.expire(time.Now())
+	}
+	if !exists || order.canceled || order.volExec >= order.volume {
+		return "", fmt.Errorf("API error: [EOrder:Unknown order]")
+	}
+	if order.volExec > 0 {
+		return "", fmt.Errorf("API error: [EOrder:Cannot edit partially filled order]")
+	}
+	order.canceled = true
+	if price == 0 {
+		price = order.price
+	}
+	if volume == 0 {
+		volume = order.volume
+	}
+
+	p.sequence++
+	newTxId := fmt.Sprintf("PAPER-%d-%d", time.Now().Unix(), p.sequence)
+	p.orders[newTxId] = &paperOrder{pair: order.pair, isBuy: order.isBuy, price: price, volume: volume, cursor: order.cursor, expires: order.expires}
+	return newTxId, nil
+}
+
+// fill settles volume of an order against the virtual account, the caller holds p.mu
+func (p *paperExchange) fill(order *paperOrder, volume float64) {
+	cost := volume * order.price
+	fee := cost * p.feeRate
+	order.volExec += volume
+	order.cost += cost
+	order.fee += fee
+
+	if order.isBuy {
+		p.account.Balances[order.pair.Base] += volume
+		p.account.Balances[order.pair.Quote] -= cost + fee
+	} else {
+		p.account.Balances[order.pair.Base] -= volume
+		p.account.Balances[order.pair.Quote] += cost - fee
+	}
+	p.account.Fees += fee
+	if order.volExec >= order.volume {
+		p.account.Fills++
+	}
+}
+
+// save writes the virtual account atomically, the caller holds p.mu (or owns p).
+// Replays never touch the account.
+func (p *paperExchange) save() error {
+	if Replaying() {
+		return nil
+	}
+	data, err := json.MarshalIndent(p.account, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error encoding paper account: %v", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(p.path), 0700); err != nil {
+		return fmt.Errorf("error creating paper account directory: %v", err)
+	}
+	tmp := p.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("error writing paper account: %v", err)
+	}
+	if err := os.Rename(tmp, p.path); err != nil {
+		return fmt.Errorf("error writing paper account: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,228 @@
+package kraken
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RateLimiter is a token bucket mirroring Kraken's decaying call counters.
+// The bucket holds up to capacity tokens and refills at perSecond tokens per second,
+// which is equivalent to a counter with that maximum decaying at the same rate.
+type RateLimiter struct {
+	mu        sync.Mutex
+	capacity  float64
+	perSecond float64
+	tokens    float64
+	last      time.Time
+}
+
+// NewRateLimiter creates a full token bucket
+func NewRateLimiter(capacity float64, perSecond float64) *RateLimiter {
+	return &RateLimiter{
+		capacity:  capacity,
+		perSecond: perSecond,
+		tokens:    capacity,
+		last:      time.Now(),
+	}
+}
+
+// Wait blocks until cost tokens are available or the context is done
+func (l *RateLimiter) Wait(ctx context.Context, cost float64) error {
+	for {
+		l.mu.Lock()
+		now := time.Now()
+		l.tokens += now.Sub(l.last).Seconds() * l.perSecond
+		if l.tokens > l.capacity {
+			l.tokens = l.capacity
+		}
+		l.last = now
+
+		// Costs above capacity would never fit, let them through on a full bucket
+		if l.tokens >= cost || l.tokens >= l.capacity {
+			l.tokens -= cost
+			l.mu.Unlock()
+			return nil
+		}
+		wait := time.Duration((cost - l.tokens) / l.perSecond * float64(time.Second))
+		l.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(wait):
+		}
+	}
+}
+
+// Tier describes the API rate limits of a Kraken verification tier
+type Tier struct {
+	MaxCounter          float64 // Private API counter maximum
+	DecayPerSecond      float64 // Private API counter decay
+	MaxOrderCounter     float64 // Per-pair trading counter maximum
+	OrderDecayPerSecond float64 // Per-pair trading counter decay
+}
+
+// Tiers lists the published Kraken rate limits per verification tier
+var Tiers = map[string]Tier{
+	"starter":      {MaxCounter: 15, DecayPerSecond: 0.33, MaxOrderCounter: 60, OrderDecayPerSecond: 1},
+	"intermediate": {MaxCounter: 20, DecayPerSecond: 0.5, MaxOrderCounter: 125, OrderDecayPerSecond: 2.34},
+	"pro":          {MaxCounter: 20, DecayPerSecond: 1, MaxOrderCounter: 180, OrderDecayPerSecond: 3.75},
+}
+
+// privateCallCosts lists private endpoints costing more than 1 counter point
+var privateCallCosts = map[string]float64{
+	"/0/private/Ledgers":       2,
+	"/0/private/QueryLedgers":  2,
+	"/0/private/TradesHistory": 2,
+}
+
+// orderCallPaths lists trading endpoints, which count against the per-pair trading counter instead
+var orderCallPaths = map[string]bool{
+	"/0/private/AddOrder":      true,
+	"/0/private/AddOrderBatch": true,
+	"/0/private/EditOrder":     true,
+	"/0/private/CancelOrder":   true,
+	"/0/private/CancelAll":     true,
+}
+
+// Process-wide limiters, shared by all API calls
+var (
+	rateLimitMu    sync.Mutex
+	currentTier    = Tiers["starter"]
+	rateShare      = 1.0
+	publicLimiter  = NewRateLimiter(1, 1)
+	privateLimiter = NewRateLimiter(currentTier.MaxCounter, currentTier.DecayPerSecond)
+	orderLimiters  = map[string]*RateLimiter{}
+	orderPlacedAt  = map[string]orderPlacement{}
+)
+
+// orderPlacement remembers where and when an order was placed to price its cancellation
+type orderPlacement struct {
+	pair string
+	at   time.Time
+}
+
+// SetTier configures the private and trading rate limits for a verification tier
+func SetTier(name string) error {
+	tier, ok := Tiers[strings.ToLower(name)]
+	if !ok {
+		return fmt.Errorf("unknown rate limit tier: %s", name)
+	}
+
+	rateLimitMu.Lock()
+	defer rateLimitMu.Unlock()
+	currentTier = tier
+	privateLimiter = NewRateLimiter(tier.MaxCounter*rateShare, tier.DecayPerSecond*rateShare)
+	orderLimiters = map[string]*RateLimiter{}
+	return nil
+}
+
+// SetRateShare limits the process to a share (0 to 1] of the account's private API counter and of
+// the public rate limit, for traders of different pairs running side by side on one key. Per-pair
+// trading counters aren't shared and stay whole. Call it before the first request.
+func SetRateShare(share float64) error {
+	if share <= 0 || share > 1 {
+		return fmt.Errorf("rate share must be greater than 0 and at most 1, got %g", share)
+	}
+
+	rateLimitMu.Lock()
+	defer rateLimitMu.Unlock()
+	rateShare = share
+	privateLimiter = NewRateLimiter(currentTier.MaxCounter*share, currentTier.DecayPerSecond*share)
+	publicLimiter = NewRateLimiter(1, share)
+	return nil
+}
+
+// SetPublicRateLimit replaces the public API limiter. Only for simulated markets, which don't need
+// Kraken's throttling; call it before the first request.
+func SetPublicRateLimit(capacity float64, perSecond float64) {
+	publicLimiter = NewRateLimiter(capacity, perSecond)
+}
+
+// SetPrivateRateLimit replaces the private API counter, like SetPublicRateLimit only for
+// simulated markets
+func SetPrivateRateLimit(capacity float64, perSecond float64) {
+	rateLimitMu.Lock()
+	defer rateLimitMu.Unlock()
+	privateLimiter = NewRateLimiter(capacity, perSecond)
+}
+
+// waitPrivate waits for the private counter unless the call is a trading call
+func waitPrivate(ctx context.Context, urlPath string) error {
+	if orderCallPaths[urlPath] {
+		return nil
+	}
+
+	cost, ok := privateCallCosts[urlPath]
+	if !ok {
+		cost = 1
+	}
+
+	rateLimitMu.Lock()
+	limiter := privateLimiter
+	rateLimitMu.Unlock()
+	return limiter.Wait(ctx, cost)
+}
+
+// waitOrder waits for the pair's trading counter
+func waitOrder(ctx context.Context, pair string, cost float64) error {
+	rateLimitMu.Lock()
+	limiter, ok := orderLimiters[pair]
+	if !ok {
+		limiter = NewRateLimiter(currentTier.MaxOrderCounter, currentTier.OrderDecayPerSecond)
+		orderLimiters[pair] = limiter
+	}
+	rateLimitMu.Unlock()
+	return limiter.Wait(ctx, cost)
+}
+
+// recordOrderPlaced remembers a placed order so its cancellation penalty can be computed
+func recordOrderPlaced(txId string, pair string) {
+	rateLimitMu.Lock()
+	defer rateLimitMu.Unlock()
+	orderPlacedAt[txId] = orderPlacement{pair: pair, at: time.Now()}
+}
+
+// orderPlaced reports whether this process placed an order that is still tracked for its
+// cancellation penalty
+func orderPlaced(txId string) bool {
+	rateLimitMu.Lock()
+	defer rateLimitMu.Unlock()
+	_, ok := orderPlacedAt[txId]
+	return ok
+}
+
+// waitCancel waits for the trading counter with Kraken's cancel penalty,
+// which is higher the younger the order is. Orders not placed by this process are not tracked.
+func waitCancel(ctx context.Context, txId string) error {
+	rateLimitMu.Lock()
+	placement, ok := orderPlacedAt[txId]
+	delete(orderPlacedAt, txId)
+	rateLimitMu.Unlock()
+	if !ok {
+		return nil
+	}
+
+	age := time.Since(placement.at)
+	var cost float64
+	switch {
+	case age < 5*time.Second:
+		cost = 8
+	case age < 10*time.Second:
+		cost = 6
+	case age < 15*time.Second:
+		cost = 5
+	case age < 45*time.Second:
+		cost = 4
+	case age < 90*time.Second:
+		cost = 2
+	case age < 300*time.Second:
+		cost = 1
+	default:
+		return nil
+	}
+	return waitOrder(ctx, placement.pair, cost)
+}
@@ -0,0 +1,46 @@
+package kraken
+
+import (
+	"context"
+	"testing"
+)
+
+func TestWaitPrivateSkipsTradingCalls(t *testing.T) {
+	rateLimitMu.Lock()
+	saved := privateLimiter
+	// An empty bucket that practically never refills: any draw from it waits until the context ends
+	privateLimiter = NewRateLimiter(1, 1e-9)
+	privateLimiter.Wait(context.Background(), 1)
+	rateLimitMu.Unlock()
+	defer func() {
+		rateLimitMu.Lock()
+		privateLimiter = saved
+		rateLimitMu.Unlock()
+	}()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	tests := []struct {
+		path    string
+		trading bool
+	}{
+		{"/0/private/AddOrder", true},
+		{"/0/private/AddOrderBatch", true},
+		{"/0/private/EditOrder", true},
+		{"/0/private/CancelOrder", true},
+		{"/0/private/CancelAll", true},
+		{"/0/private/OpenOrders", false},
+		{"/0/private/Ledgers", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			err := waitPrivate(ctx, tt.path)
+			if tt.trading && err != nil {
+				t.Errorf("waitPrivate(%s) drew from the private counter: %v", tt.path, err)
+			}
+			if !tt.trading && err == nil {
+				t.Errorf("waitPrivate(%s) didn't draw from the private counter", tt.path)
+			}
+		})
+	}
+}
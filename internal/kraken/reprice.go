@@ -0,0 +1,157 @@
+package kraken
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+
+	"github.com/jkosik/crypto-trader/internal/logging"
+)
+
+// EditOrder moves an open limit order to a new price. Kraken cancels the original order and
+// places a new one, the returned transaction ID replaces txId. Partially filled orders can't
+// be edited.
+func EditOrder(ctx context.Context, pair *AssetPair, txId string, price float64) (string, error) {
+	return editOrder(ctx, pair, txId, pair.RoundPrice(price), 0)
+}
+
+// ResizeOrder changes the volume of an open limit order, keeping its price. Like EditOrder the
+// returned transaction ID replaces txId and partially filled orders can't be resized.
+func ResizeOrder(ctx context.Context, pair *AssetPair, txId string, volume float64) (string, error) {
+	volume = pair.RoundVolume(volume)
+	if volume < pair.OrderMin {
+		return "", fmt.Errorf("volume %s is below the minimum order size %g", pair.FormatVolume(volume), pair.OrderMin)
+	}
+	return editOrder(ctx, pair, txId, 0, volume)
+}
+
+// editOrder replaces an order with a new price or volume, zero keeps the order's value
+func editOrder(ctx context.Context, pair *AssetPair, txId string, price float64, volume float64) (string, error) {
+	urlPath := "/0/private/EditOrder"
+	log := logging.FromContext(ctx).With("txid", txId)
+	if price > 0 {
+		log = log.With("price", pair.FormatPrice(price))
+	}
+	if volume > 0 {
+		log = log.With("volume", pair.FormatVolume(volume))
+	}
+
+	if Paper() {
+		newTxId, err := editPaperOrder(txId, price, volume)
+		if err != nil {
+			return "", err
+		}
+		log.Info("Edited paper order", "new_txid", newTxId)
+		return newTxId, nil
+	}
+
+	// An edit cancels the original order, so it carries the cancel penalty
+	if err := waitCancel(ctx, txId); err != nil {
+		return "", err
+	}
+
+	// Network errors are not retried, a lost response may still have replaced the order
+	body, err := privateRequest(ctx, urlPath, false, func(nonce int64) string {
+		payload := fmt.Sprintf(`{
+			"nonce": "%d",
+			"txid": "%s",
+			"pair": "%s"`, nonce, txId, pair.Altname)
+		if price > 0 {
+			payload += fmt.Sprintf(`,
+			"price": "%s"`, pair.FormatPrice(price))
+		}
+		if volume > 0 {
+			payload += fmt.Sprintf(`,
+			"volume": "%s"`, pair.FormatVolume(volume))
+		}
+		if PostOnly {
+			payload += `,
+			"oflags": "post"`
+		}
+		return payload + "\n\t\t}"
+	})
+	if err != nil {
+		return "", fmt.Errorf("error making request: %v", err)
+	}
+
+	var response struct {
+		Error  []string `json:"error"`
+		Result struct {
+			Status       string `json:"status"`
+			TxId         string `json:"txid"`
+			OriginalTxId string `json:"originaltxid"`
+			ErrorMessage string `json:"error_message"`
+		} `json:"result"`
+	}
+	if err := json.Unmarshal(body, &response); err != nil {
+		return "", fmt.Errorf("error parsing response: %v", err)
+	}
+
+	if len(response.Error) > 0 {
+		return "", fmt.Errorf("API error: %v", response.Error)
+	}
+	if response.Result.Status != "ok" || response.Result.TxId == "" {
+		return "", fmt.Errorf("order was not edited: %s", response.Result.ErrorMessage)
+	}
+
+	recordOrderPlaced(response.Result.TxId, pair.Name)
+	log.Info("Edited order", "new_txid", response.Result.TxId)
+	return response.Result.TxId, nil
+}
+
+// RepriceLimit returns the worst price a stalled leg may be moved to: a sell at most
+// maxLossPercent below the filled buy price, a buy at most maxLossPercent above the filled sell price
+func RepriceLimit(isBuy bool, filledPrice float64, maxLossPercent float64) float64 {
+	if isBuy {
+		return filledPrice * (1 + maxLossPercent/100)
+	}
+	return filledPrice * (1 - maxLossPercent/100)
+}
+
+// RepricePrice returns the next price of a stalled leg, moved step (0 to 1) of the way towards the
+// other side of the book: a sell walks down towards the bid, a buy up towards the ask. The price
+// is rounded to the pair and never passes limit. ok is false if the leg can't move any further.
+func RepricePrice(pair *AssetPair, isBuy bool, current float64, spreadInfo *SpreadInfo, step float64, limit float64) (float64, bool) {
+	// Small steps on coarse ticks still move the price by at least one tick
+	tick := math.Pow10(-pair.PairDecimals)
+	if isBuy {
+		target := math.Min(spreadInfo.AskPrice, limit)
+		if target <= current {
+			return current, false
+		}
+		price := pair.RoundPrice(current + (target-current)*step)
+		if price <= current {
+			price = pair.RoundPrice(current + tick)
+		}
+		if price > limit {
+			price = floorPrice(pair, limit)
+		}
+		return price, price > current
+	}
+
+	target := math.Max(spreadInfo.BidPrice, limit)
+	if target >= current {
+		return current, false
+	}
+	price := pair.RoundPrice(current - (current-target)*step)
+	if price >= current {
+		price = pair.RoundPrice(current - tick)
+	}
+	if price < limit {
+		price = ceilPrice(pair, limit)
+	}
+	return price, price < current
+}
+
+// floorPrice rounds a price down to the pair's price decimals
+func floorPrice(pair *AssetPair, price float64) float64 {
+	multiplier := math.Pow10(pair.PairDecimals)
+	return math.Floor(price*multiplier+1e-9) / multiplier
+}
+
+// ceilPrice rounds a price up to the pair's price decimals
+func ceilPrice(pair *AssetPair, price float64) float64 {
+	multiplier := math.Pow10(pair.PairDecimals)
+	return math.Ceil(price*multiplier-1e-9) / multiplier
+}
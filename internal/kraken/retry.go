@@ -0,0 +1,171 @@
+package kraken
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/jkosik/crypto-trader/internal/logging"
+)
+
+// RetryPolicy controls how transient API failures are retried.
+// Delays grow exponentially from BaseDelay up to MaxDelay with full jitter.
+type RetryPolicy struct {
+	MaxAttempts int           // Total attempts including the first one (1 disables retries)
+	BaseDelay   time.Duration // Delay cap for the first retry
+	MaxDelay    time.Duration // Upper bound for any single delay
+}
+
+// DefaultRetryPolicy is used by all API calls in the package
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts: 4,
+	BaseDelay:   500 * time.Millisecond,
+	MaxDelay:    10 * time.Second,
+}
+
+// transientAPIErrors are Kraken error codes after which the request was not processed
+// and can be safely retried
+var transientAPIErrors = map[string]bool{
+	"EService:Unavailable":       true,
+	"EService:Busy":              true,
+	"EAPI:Rate limit exceeded":   true,
+	"EGeneral:Temporary lockout": true,
+}
+
+// authAPIErrors are Kraken error codes caused by missing, invalid or under-privileged API keys
+var authAPIErrors = []string{
+	"EAPI:Invalid key",
+	"EAPI:Invalid signature",
+	"EAPI:Invalid nonce",
+	"EGeneral:Permission denied",
+}
+
+// IsAuthError reports whether an error returned by this package was caused by the API credentials
+func IsAuthError(err error) bool {
+	if err == nil {
+		return false
+	}
+	for _, code := range authAPIErrors {
+		if strings.Contains(err.Error(), code) {
+			return true
+		}
+	}
+	return false
+}
+
+// IsInsufficientFundsError reports whether an order was rejected for lack of funds
+func IsInsufficientFundsError(err error) bool {
+	return err != nil && strings.Contains(err.Error(), "EOrder:Insufficient funds")
+}
+
+// backoff returns a jittered delay before the given retry (1 = first retry)
+func (p RetryPolicy) backoff(retry int) time.Duration {
+	delay := p.BaseDelay << uint(retry-1)
+	if delay <= 0 || delay > p.MaxDelay {
+		delay = p.MaxDelay
+	}
+	if delay <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(delay) + 1))
+}
+
+// apiErrors extracts the error array from a raw Kraken response body
+func apiErrors(body []byte) []string {
+	var response struct {
+		Error []string `json:"error"`
+	}
+	if err := json.Unmarshal(body, &response); err != nil {
+		return nil
+	}
+	return response.Error
+}
+
+// isTransient reports whether any of the API errors is worth retrying
+func isTransient(errs []string) bool {
+	for _, e := range errs {
+		if transientAPIErrors[e] {
+			return true
+		}
+	}
+	return false
+}
+
+// withRetry runs do until it succeeds, returns a non-transient result or attempts run out.
+// Network errors are only retried if retryNetwork is set, because a request that failed
+// in transit may still have been processed by the exchange.
+// After the last attempt the raw body is returned so callers report the API error as usual.
+func withRetry(ctx context.Context, retryNetwork bool, do func() ([]byte, error)) ([]byte, error) {
+	policy := DefaultRetryPolicy
+	for attempt := 1; ; attempt++ {
+		body, err := do()
+
+		var reason string
+		if err != nil {
+			if !retryNetwork || ctx.Err() != nil {
+				return nil, err
+			}
+			reason = err.Error()
+		} else if errs := apiErrors(body); isTransient(errs) {
+			reason = fmt.Sprintf("API error: %v", errs)
+		} else {
+			return body, nil
+		}
+
+		if attempt >= policy.MaxAttempts {
+			return body, err
+		}
+
+		delay := policy.backoff(attempt)
+		logging.FromContext(ctx).Warn("Request failed, retrying",
+			"reason", reason,
+			"delay", delay.Round(time.Millisecond),
+			"attempt", attempt+1,
+			"max_attempts", policy.MaxAttempts)
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(delay):
+		}
+	}
+}
+
+// publicRequest makes a GET request to a public endpoint, retrying transient failures
+func publicRequest(ctx context.Context, url string) ([]byte, error) {
+	return withRetry(ctx, true, func() ([]byte, error) {
+		if err := publicLimiter.Wait(ctx, 1); err != nil {
+			return nil, err
+		}
+		return MakePublicRequest(ctx, url, "GET")
+	})
+}
+
+// privateRequest signs and sends a private API request, retrying transient failures.
+// buildPayload is called with a fresh nonce for every attempt since Kraken rejects reused nonces.
+// The nonce is held until the response arrived, so concurrent requests reach Kraken in nonce order.
+// Set idempotent only for requests that are safe to repeat after a network error.
+func privateRequest(ctx context.Context, urlPath string, idempotent bool, buildPayload func(nonce int64) string) ([]byte, error) {
+	return withRetry(ctx, idempotent, func() ([]byte, error) {
+		if err := waitPrivate(ctx, urlPath); err != nil {
+			return nil, err
+		}
+		nonce, release := AcquireNonce()
+		defer release()
+		payload, err := withOTP(buildPayload(nonce))
+		if err != nil {
+			return nil, fmt.Errorf("error adding the otp: %v", err)
+		}
+
+		signature, err := GetKrakenSignature(urlPath, payload, os.Getenv("KRAKEN_PRIVATE_KEY"))
+		if err != nil {
+			return nil, fmt.Errorf("error generating signature: %v", err)
+		}
+
+		return MakePrivateRequest(ctx, BaseURL+urlPath, "POST", payload, os.Getenv("KRAKEN_API_KEY"), signature)
+	})
+}
@@ -0,0 +1,263 @@
+package kraken
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/jkosik/crypto-trader/internal/redact"
+)
+
+// SessionEvent is a single entry of a recorded trading session.
+// Sessions are stored as JSON lines so they can be inspected and diffed by hand.
+type SessionEvent struct {
+	Time  time.Time       `json:"time"`
+	Kind  string          `json:"kind"`            // input, response or decision
+	Name  string          `json:"name"`            // input name, request URL or decision name
+	Body  string          `json:"body,omitempty"`  // raw API response body
+	Error string          `json:"error,omitempty"` // request error instead of a body
+	Data  json.RawMessage `json:"data,omitempty"`  // input value or decision details
+}
+
+// Session event kinds
+const (
+	SessionInput    = "input"
+	SessionResponse = "response"
+	SessionDecision = "decision"
+)
+
+// session is either recording events to a file or replaying them from one
+type session struct {
+	mu         sync.Mutex
+	file       *os.File
+	replay     bool
+	inputs     map[string]json.RawMessage
+	responses  map[string][]SessionEvent
+	decisions  []SessionEvent
+	mismatches []string
+	exhausted  bool
+}
+
+// activeSession is the process-wide recording or replay, nil if neither is active
+var activeSession *session
+
+// StartRecording starts writing all API responses, inputs and decisions to path
+func StartRecording(path string) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("error creating session file: %v", err)
+	}
+	activeSession = &session{file: file}
+	return nil
+}
+
+// StartReplay loads a recorded session. While replaying, API requests are answered from the
+// recording instead of the network and decisions are compared with the recorded ones.
+func StartReplay(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("error opening session file: %v", err)
+	}
+	defer file.Close()
+
+	s := &session{
+		replay:    true,
+		inputs:    map[string]json.RawMessage{},
+		responses: map[string][]SessionEvent{},
+	}
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 1024*1024), 64*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		var event SessionEvent
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			return fmt.Errorf("error parsing session file line %d: %v", line, err)
+		}
+		switch event.Kind {
+		case SessionInput:
+			s.inputs[event.Name] = event.Data
+		case SessionResponse:
+			s.responses[event.Name] = append(s.responses[event.Name], event)
+		case SessionDecision:
+			s.decisions = append(s.decisions, event)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("error reading session file: %v", err)
+	}
+
+	activeSession = s
+	return nil
+}
+
+// Replaying reports whether a recorded session is being replayed
+func Replaying() bool {
+	return activeSession != nil && activeSession.replay
+}
+
+// Recording reports whether the session is being recorded
+func Recording() bool {
+	return activeSession != nil && !activeSession.replay
+}
+
+// ReplayInput decodes a recorded input into value, returning false if it wasn't recorded
+func ReplayInput(name string, value interface{}) (bool, error) {
+	if !Replaying() {
+		return false, nil
+	}
+	data, ok := activeSession.inputs[name]
+	if !ok {
+		return false, nil
+	}
+	if err := json.Unmarshal(data, value); err != nil {
+		return false, fmt.Errorf("error decoding recorded input %s: %v", name, err)
+	}
+	return true, nil
+}
+
+// RecordInput records a run input (e.g. command line arguments)
+func RecordInput(name string, value interface{}) {
+	if activeSession == nil || activeSession.replay {
+		return
+	}
+	activeSession.write(SessionEvent{Kind: SessionInput, Name: name, Data: mustMarshal(value)})
+}
+
+// RecordDecision records a trading decision. While replaying, the decision is compared with
+// the next recorded one and any difference is reported by FinishSession.
+func RecordDecision(name string, details interface{}) {
+	s := activeSession
+	if s == nil {
+		return
+	}
+	data := mustMarshal(details)
+	if !s.replay {
+		s.write(SessionEvent{Kind: SessionDecision, Name: name, Data: data})
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.decisions) == 0 {
+		s.mismatches = append(s.mismatches, fmt.Sprintf("unexpected decision %s: %s", name, data))
+		return
+	}
+	expected := s.decisions[0]
+	s.decisions = s.decisions[1:]
+	if expected.Name != name || !jsonEqual(expected.Data, data) {
+		s.mismatches = append(s.mismatches, fmt.Sprintf("decision mismatch: recorded %s %s, got %s %s", expected.Name, expected.Data, name, data))
+	}
+}
+
+// FinishSession closes a recording or verifies a replay.
+// For replays an error lists every decision that differs from the recording.
+func FinishSession() error {
+	s := activeSession
+	if s == nil {
+		return nil
+	}
+	activeSession = nil
+
+	if !s.replay {
+		return s.file.Close()
+	}
+
+	for _, missing := range s.decisions {
+		s.mismatches = append(s.mismatches, fmt.Sprintf("missing decision %s: %s", missing.Name, missing.Data))
+	}
+	if len(s.mismatches) > 0 {
+		msg := fmt.Sprintf("replay diverged from recording in %d decision(s):", len(s.mismatches))
+		for _, m := range s.mismatches {
+			msg += "\n  - " + m
+		}
+		return fmt.Errorf("%s", msg)
+	}
+	return nil
+}
+
+// ReplayExhausted reports whether a replay has run out of recorded responses
+func ReplayExhausted() bool {
+	s := activeSession
+	if s == nil || !s.replay {
+		return false
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.exhausted
+}
+
+// recordedResponse returns the next recorded response for a request while replaying
+func recordedResponse(name string) ([]byte, bool, error) {
+	s := activeSession
+	if s == nil || !s.replay {
+		return nil, false, nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	queue := s.responses[name]
+	if len(queue) == 0 {
+		s.exhausted = true
+		return nil, true, fmt.Errorf("no recorded response left for %s", name)
+	}
+	event := queue[0]
+	s.responses[name] = queue[1:]
+	if event.Error != "" {
+		return nil, true, fmt.Errorf("%s", event.Error)
+	}
+	return []byte(event.Body), true, nil
+}
+
+// recordResponse records an API response (or request error) while recording
+func recordResponse(name string, body []byte, err error) {
+	s := activeSession
+	if s == nil || s.replay {
+		return
+	}
+	event := SessionEvent{Kind: SessionResponse, Name: name, Body: string(body)}
+	if err != nil {
+		event.Error = err.Error()
+	}
+	s.write(event)
+}
+
+// write appends an event to the recording
+func (s *session) write(event SessionEvent) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	event.Time = time.Now()
+	line, err := json.Marshal(event)
+	if err != nil {
+		slog.Warn("Failed to encode session event", "error", err)
+		return
+	}
+	// Recordings get shared to reproduce bugs, they must not carry credentials
+	line = []byte(redact.String(string(line)))
+	if _, err := s.file.Write(append(line, '\n')); err != nil {
+		slog.Warn("Failed to write session event", "error", err)
+	}
+}
+
+// mustMarshal encodes a value for the session file, falling back to its string form
+func mustMarshal(value interface{}) json.RawMessage {
+	data, err := json.Marshal(value)
+	if err != nil {
+		data, _ = json.Marshal(fmt.Sprintf("%v", value))
+	}
+	return data
+}
+
+// jsonEqual compares two JSON documents semantically
+func jsonEqual(a, b json.RawMessage) bool {
+	var va, vb interface{}
+	if json.Unmarshal(a, &va) != nil || json.Unmarshal(b, &vb) != nil {
+		return string(a) == string(b)
+	}
+	return reflect.DeepEqual(va, vb)
+}
@@ -2,10 +2,13 @@ package kraken
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
 	"os"
+
+	"github.com/jkosik/crypto-trader/internal/redact"
 )
 
 // SlackMessage represents the structure of a message to be sent to Slack
@@ -14,7 +17,12 @@ type SlackMessage struct {
 }
 
 // SendSlackMessage sends a text message to a Slack channel using a webhook URL
-func SendSlackMessage(message string) error {
+func SendSlackMessage(ctx context.Context, message string) error {
+	// Replayed sessions must not notify about trades that already happened, paper trades aren't real
+	if Replaying() || Paper() {
+		return nil
+	}
+
 	webhookURL := os.Getenv("SLACK_WEBHOOK")
 	if webhookURL == "" {
 		return fmt.Errorf("SLACK_WEBHOOK environment variable is not set")
@@ -29,9 +37,19 @@ func SendSlackMessage(message string) error {
 		return fmt.Errorf("error marshaling Slack message: %v", err)
 	}
 
-	resp, err := http.Post(webhookURL, "application/json", bytes.NewBuffer(jsonData))
+	ctx, cancel := withDefaultTimeout(ctx)
+	defer cancel()
+
+	// Request errors quote the webhook URL, which is the credential
+	req, err := http.NewRequestWithContext(ctx, "POST", webhookURL, bytes.NewBuffer(jsonData))
+	if err != nil {
+		return fmt.Errorf("error creating Slack request: %v", redact.Error(err))
+	}
+	req.Header.Add("Content-Type", "application/json")
+
+	resp, err := http.DefaultClient.Do(req)
 	if err != nil {
-		return fmt.Errorf("error sending message to Slack: %v", err)
+		return fmt.Errorf("error sending message to Slack: %v", redact.Error(err))
 	}
 	defer resp.Body.Close()
 
@@ -0,0 +1,74 @@
+package kraken
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// SpreadSnapshot is a historical best bid/ask from Kraken's Spread endpoint
+type SpreadSnapshot struct {
+	Time time.Time
+	Bid  float64
+	Ask  float64
+}
+
+// GetSpreadHistory retrieves the recent bid/ask history of a coin's pair (Kraken keeps a few hours), oldest first
+func GetSpreadHistory(ctx context.Context, coin string) ([]SpreadSnapshot, error) {
+	pair := PairName(coin)
+	url := fmt.Sprintf("%s/0/public/Spread?pair=%s", BaseURL, pair)
+
+	body, err := publicRequest(ctx, url)
+	if err != nil {
+		return nil, fmt.Errorf("error getting spread history: %v", err)
+	}
+
+	var response struct {
+		Error  []string                   `json:"error"`
+		Result map[string]json.RawMessage `json:"result"`
+	}
+	if err := json.Unmarshal(body, &response); err != nil {
+		return nil, fmt.Errorf("error parsing spread history response: %v", err)
+	}
+	if len(response.Error) > 0 {
+		return nil, fmt.Errorf("API error: %v", response.Error)
+	}
+
+	// The result holds the pair's entries and a "last" cursor
+	for key, raw := range response.Result {
+		if key == "last" {
+			continue
+		}
+		var entries [][]interface{}
+		if err := json.Unmarshal(raw, &entries); err != nil {
+			return nil, fmt.Errorf("error parsing spread history for %s: %v", key, err)
+		}
+
+		snapshots := make([]SpreadSnapshot, 0, len(entries))
+		for _, entry := range entries {
+			if len(entry) < 3 {
+				return nil, fmt.Errorf("invalid spread entry: %v", entry)
+			}
+			ts, ok := entry[0].(float64)
+			if !ok {
+				return nil, fmt.Errorf("invalid spread time: %v", entry[0])
+			}
+			bidStr, _ := entry[1].(string)
+			askStr, _ := entry[2].(string)
+			bid, err := strconv.ParseFloat(bidStr, 64)
+			if err != nil {
+				return nil, fmt.Errorf("error parsing bid: %v", err)
+			}
+			ask, err := strconv.ParseFloat(askStr, 64)
+			if err != nil {
+				return nil, fmt.Errorf("error parsing ask: %v", err)
+			}
+			snapshots = append(snapshots, SpreadSnapshot{Time: time.Unix(int64(ts), 0), Bid: bid, Ask: ask})
+		}
+		return snapshots, nil
+	}
+
+	return nil, fmt.Errorf("no spread history for %s", pair)
+}
@@ -0,0 +1,83 @@
+package kraken
+
+import (
+	"fmt"
+	"sort"
+)
+
+// SpreadSampler keeps the most recent spread samples of a pair, in % of the bid, for the
+// statistics of its typical spread. It holds a fixed number of samples rather than a time window,
+// so replays, which don't wait between polls, compute the same statistics.
+type SpreadSampler struct {
+	size    int
+	spreads []float64
+}
+
+// SpreadStats summarizes the sampled spreads, all in % of the bid
+type SpreadStats struct {
+	Samples int
+	Mean    float64
+	Median  float64
+	Min     float64
+	Max     float64
+	sorted  []float64
+}
+
+// NewSpreadSampler returns a sampler keeping the last size samples
+func NewSpreadSampler(size int) *SpreadSampler {
+	if size < 1 {
+		size = 1
+	}
+	return &SpreadSampler{size: size}
+}
+
+// Add samples the spread of bid/ask snapshots, oldest first, dropping the oldest samples beyond the
+// sampler's size. Snapshots without a bid or ask are skipped.
+func (s *SpreadSampler) Add(snapshots ...SpreadSnapshot) {
+	for _, snapshot := range snapshots {
+		if snapshot.Bid <= 0 || snapshot.Ask <= 0 {
+			continue
+		}
+		s.spreads = append(s.spreads, (snapshot.Ask-snapshot.Bid)/snapshot.Bid*100)
+	}
+	if len(s.spreads) > s.size {
+		s.spreads = append([]float64(nil), s.spreads[len(s.spreads)-s.size:]...)
+	}
+}
+
+// Len returns the number of samples held
+func (s *SpreadSampler) Len() int {
+	return len(s.spreads)
+}
+
+// Full reports whether the sampler holds all the samples it keeps
+func (s *SpreadSampler) Full() bool {
+	return len(s.spreads) >= s.size
+}
+
+// Stats returns the statistics of the samples held
+func (s *SpreadSampler) Stats() (*SpreadStats, error) {
+	if len(s.spreads) == 0 {
+		return nil, fmt.Errorf("no spread samples")
+	}
+	sorted := append([]float64(nil), s.spreads...)
+	sort.Float64s(sorted)
+	sum := 0.0
+	for _, spread := range sorted {
+		sum += spread
+	}
+	stats := &SpreadStats{
+		Samples: len(sorted),
+		Mean:    sum / float64(len(sorted)),
+		Min:     sorted[0],
+		Max:     sorted[len(sorted)-1],
+		sorted:  sorted,
+	}
+	stats.Median = stats.Percentile(50)
+	return stats, nil
+}
+
+// Percentile returns the p-th percentile of the sampled spreads
+func (s *SpreadStats) Percentile(p float64) float64 {
+	return percentileOf(s.sorted, p)
+}
@@ -0,0 +1,21 @@
+package kraken
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// StateDir returns the directory for local bot state (nonces, trade state).
+// It can be overridden with the CRYPTO_TRADER_STATE_DIR environment variable
+// and defaults to ~/.crypto-trader.
+func StateDir() (string, error) {
+	if dir := os.Getenv("CRYPTO_TRADER_STATE_DIR"); dir != "" {
+		return dir, nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("error getting home directory: %v", err)
+	}
+	return filepath.Join(home, ".crypto-trader"), nil
+}
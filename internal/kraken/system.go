@@ -0,0 +1,118 @@
+package kraken
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// TradeVolume holds the account's 30-day trade volume and the fee tier it puts the account in
+type TradeVolume struct {
+	Currency string
+	Volume   float64 // 30-day volume in Currency
+	TakerFee float64 // percent
+	MakerFee float64 // percent
+}
+
+// GetServerTime returns Kraken's server time
+func GetServerTime(ctx context.Context) (time.Time, error) {
+	body, err := publicRequest(ctx, BaseURL+"/0/public/Time")
+	if err != nil {
+		return time.Time{}, fmt.Errorf("error making request: %v", err)
+	}
+
+	var response struct {
+		Error  []string `json:"error"`
+		Result struct {
+			UnixTime int64 `json:"unixtime"`
+		} `json:"result"`
+	}
+	if err := json.Unmarshal(body, &response); err != nil {
+		return time.Time{}, fmt.Errorf("error parsing response: %v", err)
+	}
+	if len(response.Error) > 0 {
+		return time.Time{}, fmt.Errorf("API error: %v", response.Error)
+	}
+
+	return time.Unix(response.Result.UnixTime, 0), nil
+}
+
+// GetSystemStatus returns the exchange status: online, maintenance, cancel_only or post_only
+func GetSystemStatus(ctx context.Context) (string, error) {
+	body, err := publicRequest(ctx, BaseURL+"/0/public/SystemStatus")
+	if err != nil {
+		return "", fmt.Errorf("error making request: %v", err)
+	}
+
+	var response struct {
+		Error  []string `json:"error"`
+		Result struct {
+			Status string `json:"status"`
+		} `json:"result"`
+	}
+	if err := json.Unmarshal(body, &response); err != nil {
+		return "", fmt.Errorf("error parsing response: %v", err)
+	}
+	if len(response.Error) > 0 {
+		return "", fmt.Errorf("API error: %v", response.Error)
+	}
+
+	return response.Result.Status, nil
+}
+
+// GetTradeVolume retrieves the 30-day volume and the current maker/taker fees for a pair
+func GetTradeVolume(ctx context.Context, pair *AssetPair) (*TradeVolume, error) {
+	urlPath := "/0/private/TradeVolume"
+
+	body, err := privateRequest(ctx, urlPath, true, func(nonce int64) string {
+		return fmt.Sprintf(`{
+			"nonce": "%d",
+			"pair": "%s"
+		}`, nonce, pair.Altname)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error making request: %v", err)
+	}
+
+	type fee struct {
+		Fee string `json:"fee"`
+	}
+	var response struct {
+		Error  []string `json:"error"`
+		Result struct {
+			Currency  string         `json:"currency"`
+			Volume    string         `json:"volume"`
+			Fees      map[string]fee `json:"fees"`
+			FeesMaker map[string]fee `json:"fees_maker"`
+		} `json:"result"`
+	}
+	if err := json.Unmarshal(body, &response); err != nil {
+		return nil, fmt.Errorf("error parsing response: %v", err)
+	}
+	if len(response.Error) > 0 {
+		return nil, fmt.Errorf("API error: %v", response.Error)
+	}
+
+	volume, err := strconv.ParseFloat(response.Result.Volume, 64)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing trade volume: %v", err)
+	}
+	taker, ok := response.Result.Fees[pair.Name]
+	if !ok {
+		return nil, fmt.Errorf("no fee schedule for %s in response", pair.Name)
+	}
+	maker, ok := response.Result.FeesMaker[pair.Name]
+	if !ok {
+		// Pairs without a maker schedule charge the taker fee
+		maker = taker
+	}
+
+	return &TradeVolume{
+		Currency: response.Result.Currency,
+		Volume:   volume,
+		TakerFee: ParseFloat(taker.Fee),
+		MakerFee: ParseFloat(maker.Fee),
+	}, nil
+}
@@ -1,9 +1,12 @@
 package kraken
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"strconv"
+
+	"github.com/jkosik/crypto-trader/internal/logging"
 )
 
 // TickerResponse represents the response from the Kraken API ticker endpoint
@@ -18,6 +21,9 @@ type TickerResult struct {
 	Bid  []string `json:"b"` // Bid price and volume
 	High []string `json:"h"` // High price
 	Low  []string `json:"l"` // Low price
+	Vol  []string `json:"v"` // Volume today and over the last 24h
+	// Number of trades today and over the last 24h
+	Trades []int `json:"t"`
 }
 
 // TickerInfo represents the current ticker information for a trading pair
@@ -40,18 +46,72 @@ type SpreadInfo struct {
 }
 
 // GetTickerInfo retrieves the current ticker information for a given coin
-func GetTickerInfo(coin string) (*SpreadInfo, error) {
+func GetTickerInfo(ctx context.Context, coin string) (*SpreadInfo, error) {
 	// Convert coin to Kraken pair format (e.g., "SUNDOG" -> "SUNDOG/USD")
-	pair := coin + "/USD"
+	pair := PairName(coin)
 	// Get ticker data from public API
-	url := fmt.Sprintf("https://api.kraken.com/0/public/Ticker?pair=%s", pair)
+	url := fmt.Sprintf("%s/0/public/Ticker?pair=%s", BaseURL, pair)
 
 	// Make request
-	body, err := MakePublicRequest(url, "GET")
+	body, err := publicRequest(ctx, url)
 	if err != nil {
 		return nil, fmt.Errorf("error making request: %v", err)
 	}
 
+	info, err := parseTicker(body)
+	if err != nil {
+		return nil, err
+	}
+
+	logging.FromContext(ctx).Debug("Ticker information",
+		"bid", info.BidPrice,
+		"ask", info.AskPrice,
+		"spread", info.Spread,
+		"spread_percent", (info.Spread/info.BidPrice)*100,
+		"high_24h", info.HighPrice,
+		"low_24h", info.LowPrice)
+
+	return info, nil
+}
+
+// GetTickers retrieves the ticker of every pair, keyed by pair name (e.g. XXBTZUSD, XBTUSD.d for
+// dark pool pairs)
+func GetTickers(ctx context.Context) (map[string]TickerResult, error) {
+	body, err := publicRequest(ctx, BaseURL+"/0/public/Ticker")
+	if err != nil {
+		return nil, fmt.Errorf("error getting ticker data: %v", err)
+	}
+
+	var response TickerResponse
+	if err := json.Unmarshal(body, &response); err != nil {
+		return nil, fmt.Errorf("error parsing ticker response: %v", err)
+	}
+	if len(response.Error) > 0 {
+		return nil, fmt.Errorf("API error: %v", response.Error)
+	}
+	return response.Result, nil
+}
+
+// USDRate returns how many USD one unit of the asset is worth at the bid of its USD pair, 1 for USD
+// itself. It converts amounts in a crypto or foreign quote currency to USD for reporting.
+func USDRate(ctx context.Context, asset string) (float64, error) {
+	asset = Altname(asset)
+	if asset == "USD" || asset == "ZUSD" {
+		return 1, nil
+	}
+	body, err := publicRequest(ctx, fmt.Sprintf("%s/0/public/Ticker?pair=%s/USD", BaseURL, asset))
+	if err != nil {
+		return 0, fmt.Errorf("error making request: %v", err)
+	}
+	info, err := parseTicker(body)
+	if err != nil {
+		return 0, fmt.Errorf("%s/USD: %v", asset, err)
+	}
+	return info.BidPrice, nil
+}
+
+// parseTicker parses a Ticker response of a single pair
+func parseTicker(body []byte) (*SpreadInfo, error) {
 	var response TickerResponse
 	if err := json.Unmarshal(body, &response); err != nil {
 		return nil, fmt.Errorf("error parsing ticker response: %v", err)
@@ -95,15 +155,6 @@ func GetTickerInfo(coin string) (*SpreadInfo, error) {
 
 	spread := askPrice - bidPrice
 
-	// Print the ticker information
-	// spreadPercent := (spread / bidPrice) * 100
-	// fmt.Printf("\n%s/USD Spread & High/Low Information (Ticker API):\n", coin)
-	// fmt.Printf("Bid Price: %.8f\n", bidPrice)
-	// fmt.Printf("Ask Price: %.8f\n", askPrice)
-	// fmt.Printf("Spread: %.8f (%.4f%%)\n", spread, spreadPercent)
-	// fmt.Printf("24h High: %.8f\n", highPrice)
-	// fmt.Printf("24h Low: %.8f\n", lowPrice)
-
 	return &SpreadInfo{
 		BidPrice:  bidPrice,
 		AskPrice:  askPrice,
@@ -0,0 +1,18 @@
+package kraken
+
+import "testing"
+
+// benchTicker is a single-pair Ticker response as returned by Kraken
+var benchTicker = []byte(`{"error":[],"result":{"GHIBLIUSD":{` +
+	`"a":["0.00312000","21034","21034.000"],"b":["0.00309000","150000","150000.000"],` +
+	`"c":["0.00310000","1200.00000000"],"v":["1843502.66","9534210.11"],"p":["0.00311","0.00315"],` +
+	`"t":[412,2310],"l":["0.00301000","0.00298000"],"h":["0.00319000","0.00331000"],"o":"0.00307000"}}}`)
+
+func BenchmarkParseTicker(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := parseTicker(benchTicker); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
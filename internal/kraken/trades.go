@@ -0,0 +1,173 @@
+package kraken
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// ExecutedTrade is a single execution from the account's trade history
+type ExecutedTrade struct {
+	TxID      string
+	OrderTxID string
+	Pair      string // Kraken pair name, e.g. XXBTZUSD
+	Time      time.Time
+	Type      string // buy or sell
+	Price     float64
+	Cost      float64
+	Fee       float64
+	Volume    float64
+}
+
+// tradesHistoryPageSize is the number of trades Kraken returns per TradesHistory call
+const tradesHistoryPageSize = 50
+
+// GetTradesHistory retrieves the account's executions between start and end (zero = open), oldest first
+func GetTradesHistory(ctx context.Context, start time.Time, end time.Time) ([]ExecutedTrade, error) {
+	urlPath := "/0/private/TradesHistory"
+
+	var trades []ExecutedTrade
+	// Pages are offsets into the newest-first history, executions arriving while paging shift
+	// entries already seen onto the next page
+	seen := map[string]bool{}
+	for offset := 0; ; offset += tradesHistoryPageSize {
+		body, err := privateRequest(ctx, urlPath, true, func(nonce int64) string {
+			payload := fmt.Sprintf(`{
+			"nonce": "%d",
+			"ofs": %d`, nonce, offset)
+			if !start.IsZero() {
+				payload += fmt.Sprintf(`,
+			"start": %d`, start.Unix())
+			}
+			if !end.IsZero() {
+				payload += fmt.Sprintf(`,
+			"end": %d`, end.Unix())
+			}
+			return payload + `
+		}`
+		})
+		if err != nil {
+			return nil, fmt.Errorf("error making request: %v", err)
+		}
+
+		var response struct {
+			Error  []string `json:"error"`
+			Result struct {
+				Trades map[string]struct {
+					OrderTxID string  `json:"ordertxid"`
+					Pair      string  `json:"pair"`
+					Time      float64 `json:"time"`
+					Type      string  `json:"type"`
+					Price     string  `json:"price"`
+					Cost      string  `json:"cost"`
+					Fee       string  `json:"fee"`
+					Vol       string  `json:"vol"`
+				} `json:"trades"`
+				Count int `json:"count"`
+			} `json:"result"`
+		}
+		if err := json.Unmarshal(body, &response); err != nil {
+			return nil, fmt.Errorf("error parsing response: %v", err)
+		}
+		if len(response.Error) > 0 {
+			return nil, fmt.Errorf("API error: %v", response.Error)
+		}
+
+		for txId, t := range response.Result.Trades {
+			if seen[txId] {
+				continue
+			}
+			seen[txId] = true
+			trades = append(trades, ExecutedTrade{
+				TxID:      txId,
+				OrderTxID: t.OrderTxID,
+				Pair:      t.Pair,
+				Time:      time.Unix(0, int64(t.Time*float64(time.Second))),
+				Type:      t.Type,
+				Price:     ParseFloat(t.Price),
+				Cost:      ParseFloat(t.Cost),
+				Fee:       ParseFloat(t.Fee),
+				Volume:    ParseFloat(t.Vol),
+			})
+		}
+
+		if len(response.Result.Trades) < tradesHistoryPageSize || offset+tradesHistoryPageSize >= response.Result.Count {
+			break
+		}
+	}
+
+	sort.Slice(trades, func(i, j int) bool { return trades[i].Time.Before(trades[j].Time) })
+	return trades, nil
+}
+
+// PublicTrade is a single print from the public trades feed of a pair
+type PublicTrade struct {
+	Time   time.Time `json:"time"`
+	Price  float64   `json:"price"`
+	Volume float64   `json:"volume"`
+	Side   string    `json:"side"` // b (buyer was the taker) or s
+}
+
+// GetRecentTrades retrieves the public trades of a pair (e.g. XBTUSD) after the since cursor,
+// oldest first, and the cursor to continue from. An empty since returns the most recent trades.
+func GetRecentTrades(ctx context.Context, pair string, since string) ([]PublicTrade, string, error) {
+	url := fmt.Sprintf("%s/0/public/Trades?pair=%s", BaseURL, pair)
+	if since != "" {
+		url += "&since=" + since
+	}
+
+	body, err := publicRequest(ctx, url)
+	if err != nil {
+		return nil, "", fmt.Errorf("error getting recent trades: %v", err)
+	}
+
+	var response struct {
+		Error  []string                   `json:"error"`
+		Result map[string]json.RawMessage `json:"result"`
+	}
+	if err := json.Unmarshal(body, &response); err != nil {
+		return nil, "", fmt.Errorf("error parsing recent trades response: %v", err)
+	}
+	if len(response.Error) > 0 {
+		return nil, "", fmt.Errorf("API error: %v", response.Error)
+	}
+
+	// The result holds the pair's trades and a "last" cursor
+	var last string
+	if raw, ok := response.Result["last"]; ok {
+		if err := json.Unmarshal(raw, &last); err != nil {
+			return nil, "", fmt.Errorf("error parsing recent trades cursor: %v", err)
+		}
+	}
+	for key, raw := range response.Result {
+		if key == "last" {
+			continue
+		}
+		var entries [][]interface{}
+		if err := json.Unmarshal(raw, &entries); err != nil {
+			return nil, "", fmt.Errorf("error parsing recent trades for %s: %v", key, err)
+		}
+
+		trades := make([]PublicTrade, 0, len(entries))
+		for _, entry := range entries {
+			if len(entry) < 4 {
+				return nil, "", fmt.Errorf("invalid trade entry: %v", entry)
+			}
+			priceStr, _ := entry[0].(string)
+			volumeStr, _ := entry[1].(string)
+			ts, _ := entry[2].(float64)
+			side, _ := entry[3].(string)
+			trades = append(trades, PublicTrade{
+				Time:   time.Unix(0, int64(ts*float64(time.Second))),
+				Price:  ParseFloat(priceStr),
+				Volume: ParseFloat(volumeStr),
+				Side:   side,
+			})
+		}
+		return trades, last, nil
+	}
+
+	return nil, last, nil
+}
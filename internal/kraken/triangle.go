@@ -0,0 +1,220 @@
+package kraken
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jkosik/crypto-trader/internal/logging"
+)
+
+// BookTop is the best bid and ask of a pair
+type BookTop struct {
+	Bid float64
+	Ask float64
+}
+
+// TriangleLeg is one conversion of a triangle: buying the pair's base with its quote at the ask,
+// or selling the base for the quote at the bid
+type TriangleLeg struct {
+	Pair  *AssetPair
+	Buy   bool
+	Price float64
+	From  string // asset code spent
+	To    string // asset code received
+}
+
+// Triangle is a round trip through three pairs back to the start asset
+type Triangle struct {
+	Legs         [3]TriangleLeg
+	GrossPercent float64 // round-trip profit at the quoted prices
+	NetPercent   float64 // round-trip profit after the taker fee of every leg
+}
+
+// Path names the triangle's assets, e.g. USD→XBT→ETH→USD
+func (t *Triangle) Path() string {
+	assets := []string{t.Legs[0].FromName()}
+	for _, leg := range t.Legs {
+		assets = append(assets, leg.ToName())
+	}
+	return strings.Join(assets, "→")
+}
+
+// GetBookTops retrieves the best bid and ask of every pair, keyed by Kraken pair name
+func GetBookTops(ctx context.Context) (map[string]BookTop, error) {
+	body, err := publicRequest(ctx, BaseURL+"/0/public/Ticker")
+	if err != nil {
+		return nil, fmt.Errorf("error getting ticker data: %v", err)
+	}
+	var response struct {
+		Error  []string `json:"error"`
+		Result map[string]struct {
+			Ask []string `json:"a"`
+			Bid []string `json:"b"`
+		} `json:"result"`
+	}
+	if err := json.Unmarshal(body, &response); err != nil {
+		return nil, fmt.Errorf("error parsing ticker response: %v", err)
+	}
+	if len(response.Error) > 0 {
+		return nil, fmt.Errorf("API error: %v", response.Error)
+	}
+	tops := make(map[string]BookTop, len(response.Result))
+	for name, data := range response.Result {
+		if len(data.Ask) == 0 || len(data.Bid) == 0 {
+			continue
+		}
+		tops[name] = BookTop{Bid: ParseFloat(data.Bid[0]), Ask: ParseFloat(data.Ask[0])}
+	}
+	return tops, nil
+}
+
+// FindTriangles returns every round trip from the start asset (e.g. ZUSD) through two other assets
+// and back over online pairs with a quote, best net profit first. Each leg pays takerFeePercent.
+func FindTriangles(pairs map[string]*AssetPair, tops map[string]BookTop, start string, takerFeePercent float64) []Triangle {
+	// Pairs by the assets they convert between
+	byAsset := map[string][]*AssetPair{}
+	for name, pair := range pairs {
+		top, ok := tops[name]
+		if !ok || top.Bid <= 0 || top.Ask <= 0 || strings.HasSuffix(pair.Altname, ".d") || (pair.Status != "" && pair.Status != StatusOnline) {
+			continue
+		}
+		byAsset[pair.Base] = append(byAsset[pair.Base], pair)
+		byAsset[pair.Quote] = append(byAsset[pair.Quote], pair)
+	}
+
+	fee := 1 - takerFeePercent/100
+	var triangles []Triangle
+	for _, first := range byAsset[start] {
+		a := triangleLeg(first, start, tops)
+		for _, second := range byAsset[a.To] {
+			if second == first {
+				continue
+			}
+			b := triangleLeg(second, a.To, tops)
+			if b.To == start {
+				continue
+			}
+			for _, third := range byAsset[b.To] {
+				if third == second || third == first {
+					continue
+				}
+				c := triangleLeg(third, b.To, tops)
+				if c.To != start {
+					continue
+				}
+				gross := a.rate() * b.rate() * c.rate()
+				triangles = append(triangles, Triangle{
+					Legs:         [3]TriangleLeg{a, b, c},
+					GrossPercent: (gross - 1) * 100,
+					NetPercent:   (gross*fee*fee*fee - 1) * 100,
+				})
+			}
+		}
+	}
+	sort.Slice(triangles, func(i, j int) bool { return triangles[i].NetPercent > triangles[j].NetPercent })
+	return triangles
+}
+
+// triangleLeg converts from the asset over the pair: buying the base when the asset is the quote,
+// selling it otherwise
+func triangleLeg(pair *AssetPair, from string, tops map[string]BookTop) TriangleLeg {
+	top := tops[pair.Name]
+	if pair.Quote == from {
+		return TriangleLeg{Pair: pair, Buy: true, Price: top.Ask, From: from, To: pair.Base}
+	}
+	return TriangleLeg{Pair: pair, Buy: false, Price: top.Bid, From: from, To: pair.Quote}
+}
+
+// rate returns how much of To one unit of From converts to, before fees
+func (l TriangleLeg) rate() float64 {
+	if l.Buy {
+		return 1 / l.Price
+	}
+	return l.Price
+}
+
+// TriangleFill is what a leg of an executed triangle traded
+type TriangleFill struct {
+	Leg      TriangleLeg
+	TxID     string
+	Status   string
+	Volume   float64 // base coin volume executed
+	Cost     float64 // quote currency spent or received
+	Fee      float64 // in the quote currency
+	Received float64 // amount of the leg's To asset received after fees
+}
+
+// ExecuteTriangle trades amount of the start asset around the triangle with immediate-or-cancel
+// limit orders at the quoted prices, every leg sized from what the previous one received. A buy
+// leg leaves room for its taker fee. It stops at the first leg that executes nothing, the fills so
+// far tell which asset the amount is left in.
+func ExecuteTriangle(ctx context.Context, t *Triangle, amount float64, takerFeePercent float64, userref int32) ([]TriangleFill, error) {
+	log := logging.FromContext(ctx)
+	var fills []TriangleFill
+	for i, leg := range t.Legs {
+		volume := amount
+		if leg.Buy {
+			volume = amount / (leg.Price * (1 + takerFeePercent/100))
+		}
+		volume = leg.Pair.RoundVolume(volume)
+		if err := leg.Pair.ValidateOrder(leg.Price, volume); err != nil {
+			return fills, fmt.Errorf("leg %d (%s): %v", i+1, leg.Pair.Altname, err)
+		}
+		txId, err := PlaceLimitOrderTimeInForce(ctx, leg.Pair, leg.Price, volume, leg.Buy, false, userref, "IOC")
+		if err != nil {
+			return fills, fmt.Errorf("leg %d (%s): %v", i+1, leg.Pair.Altname, err)
+		}
+
+		// Immediate-or-cancel orders are done right away, the status may lag a moment
+		var status *OrderStatus
+		for attempt := 0; ; attempt++ {
+			status, err = CheckOrderStatus(ctx, txId)
+			if err == nil && OrderDone(status.Status) {
+				break
+			}
+			if attempt == 10 {
+				return fills, fmt.Errorf("leg %d (%s): order %s not done: %v", i+1, leg.Pair.Altname, txId, err)
+			}
+			select {
+			case <-ctx.Done():
+				return fills, ctx.Err()
+			case <-time.After(time.Second):
+			}
+		}
+
+		fill := TriangleFill{Leg: leg, TxID: txId, Status: status.Status, Volume: ParseFloat(status.VolExec), Cost: ParseFloat(status.Cost), Fee: ParseFloat(status.Fee)}
+		// Fees are charged in the quote currency: on top of a buy's cost, out of a sale's proceeds
+		fill.Received = fill.Volume
+		if !leg.Buy {
+			fill.Received = fill.Cost - fill.Fee
+		}
+		fills = append(fills, fill)
+		log.Info("Triangle leg executed", "leg", i+1, "pair", leg.Pair.Altname, "buy", leg.Buy, "txid", txId, "status", fill.Status,
+			"volume", leg.Pair.FormatVolume(fill.Volume), "received", fill.Received, "to", leg.ToName())
+		if fill.Volume == 0 {
+			return fills, fmt.Errorf("leg %d (%s) executed nothing at %s", i+1, leg.Pair.Altname, leg.Pair.FormatPrice(leg.Price))
+		}
+		amount = fill.Received
+	}
+	return fills, nil
+}
+
+// FromName returns the human-readable code of the asset the leg spends
+func (l TriangleLeg) FromName() string {
+	if l.Buy {
+		return l.Pair.QuoteAltname()
+	}
+	return l.Pair.BaseAltname()
+}
+
+// ToName returns the human-readable code of the asset the leg receives
+func (l TriangleLeg) ToName() string {
+	if l.Buy {
+		return l.Pair.BaseAltname()
+	}
+	return l.Pair.QuoteAltname()
+}
@@ -0,0 +1,66 @@
+package kraken
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"time"
+)
+
+// Volatility is the realized volatility of recent 1-minute candles
+type Volatility struct {
+	Percent float64 // standard deviation of the close-to-close returns, % per minute
+	Returns int     // returns it was computed from
+	Window  time.Duration
+}
+
+// VolatilityFrom computes the realized volatility from the 1-minute candles within window of the
+// latest one, oldest first. A window longer than the candles uses all of them. Returns across a
+// gap in the candles are skipped rather than counted as one minute.
+func VolatilityFrom(candles []OHLCData, window time.Duration) (*Volatility, error) {
+	if len(candles) == 0 {
+		return nil, fmt.Errorf("no OHLC data to compute volatility")
+	}
+	recent := candles
+	if count := int(window.Minutes()); count >= 1 {
+		since := candles[len(candles)-1].Time - int64(count-1)*60
+		first := sort.Search(len(candles), func(i int) bool { return candles[i].Time >= since })
+		recent = candles[first:]
+	}
+
+	var returns []float64
+	for i := 1; i < len(recent); i++ {
+		if recent[i].Time-recent[i-1].Time != 60 || recent[i-1].Close <= 0 {
+			continue
+		}
+		returns = append(returns, (recent[i].Close/recent[i-1].Close-1)*100)
+	}
+	if len(returns) < 2 {
+		return nil, fmt.Errorf("need at least 2 one-minute returns to compute volatility, got %d", len(returns))
+	}
+
+	mean := 0.0
+	for _, r := range returns {
+		mean += r
+	}
+	mean /= float64(len(returns))
+	variance := 0.0
+	for _, r := range returns {
+		variance += (r - mean) * (r - mean)
+	}
+	variance /= float64(len(returns) - 1)
+
+	return &Volatility{
+		Percent: math.Sqrt(variance),
+		Returns: len(returns),
+		Window:  time.Duration(recent[len(recent)-1].Time-recent[0].Time)*time.Second + time.Minute,
+	}, nil
+}
+
+// ScaleMinSpread scales a minimum spread by the volatility relative to referencePercent, the
+// volatility at which the minimum applies unchanged, keeping the factor within minScale and maxScale:
+// fast markets require wider spreads, quiet ones accept narrower spreads
+func (v *Volatility) ScaleMinSpread(minSpreadPercent float64, referencePercent float64, minScale float64, maxScale float64) float64 {
+	scale := math.Max(minScale, math.Min(maxScale, v.Percent/referencePercent))
+	return minSpreadPercent * scale
+}
@@ -1,11 +1,17 @@
 package kraken
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"strconv"
+	"strings"
 )
 
+// DarkPoolSuffix marks Kraken dark pool pairs (e.g. XBTUSD.d). Their prints don't show in the
+// public order book, so the bot can't interact with that liquidity.
+const DarkPoolSuffix = ".d"
+
 // VolumeResponse represents the response from the Kraken API ticker endpoint for volume
 type VolumeResponse struct {
 	Error  []string                `json:"error"`
@@ -21,16 +27,22 @@ type VolumeResult struct {
 	Bid []string `json:"b"` // Bid price
 }
 
-// Get24hVolume returns the 24-hour trading volume in USD for a given coin
-// It uses the last 24h volume (Vol[1]) from Kraken's ticker API and multiplies it by the bid price
-func Get24hVolume(coin string) (float64, error) {
+// IsDarkPoolPair reports whether a pair name refers to a dark pool pair
+func IsDarkPoolPair(pair string) bool {
+	return strings.HasSuffix(pair, DarkPoolSuffix)
+}
+
+// Get24hVolume returns the 24-hour trading volume in the quote currency for a given coin
+// It uses the last 24h volume (Vol[1]) from Kraken's ticker API and multiplies it by the bid price.
+// Only the lit pair is considered, dark pool prints are reported by GetDarkPool24hVolume.
+func Get24hVolume(ctx context.Context, coin string) (float64, error) {
 	// Convert coin to Kraken pair format (e.g., "SUNDOG" -> "SUNDOG/USD")
-	pair := coin + "/USD"
+	pair := PairName(coin)
 
 	// Get ticker data from public API
-	url := fmt.Sprintf("https://api.kraken.com/0/public/Ticker?pair=%s", pair)
+	url := fmt.Sprintf("%s/0/public/Ticker?pair=%s", BaseURL, pair)
 
-	body, err := MakePublicRequest(url, "GET")
+	body, err := publicRequest(ctx, url)
 	if err != nil {
 		return 0, fmt.Errorf("error making request: %v", err)
 	}
@@ -51,6 +63,43 @@ func Get24hVolume(coin string) (float64, error) {
 		return 0, fmt.Errorf("pair %s not found in response", pair)
 	}
 
+	return volumeUSD(pair, result)
+}
+
+// GetDarkPool24hVolume returns the 24-hour volume in the quote currency of the coin's dark pool pair.
+// Most coins have no dark pool pair, in which case 0 is returned without an error.
+func GetDarkPool24hVolume(ctx context.Context, coin string) (float64, error) {
+	pair := coin + Altname(Quote) + DarkPoolSuffix
+	url := fmt.Sprintf("%s/0/public/Ticker?pair=%s", BaseURL, pair)
+
+	body, err := publicRequest(ctx, url)
+	if err != nil {
+		return 0, fmt.Errorf("error making request: %v", err)
+	}
+
+	var response VolumeResponse
+	if err := json.Unmarshal(body, &response); err != nil {
+		return 0, fmt.Errorf("error parsing response: %v", err)
+	}
+
+	if len(response.Error) > 0 {
+		for _, e := range response.Error {
+			if e == "EQuery:Unknown asset pair" {
+				return 0, nil
+			}
+		}
+		return 0, fmt.Errorf("API error: %v", response.Error)
+	}
+
+	// Get the first (and only) pair from the result
+	for _, result := range response.Result {
+		return volumeUSD(pair, result)
+	}
+	return 0, nil
+}
+
+// volumeUSD converts the last 24h base volume of a ticker result to USD using the bid price
+func volumeUSD(pair string, result VolumeResult) (float64, error) {
 	if len(result.Vol) < 2 {
 		return 0, fmt.Errorf("insufficient volume data for pair %s", pair)
 	}
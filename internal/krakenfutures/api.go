@@ -0,0 +1,209 @@
+// Package krakenfutures is a client of the Kraken Futures API (perpetuals and fixed maturity
+// futures). It runs on its own host with its own keys and signing scheme, separate from the spot
+// API of package kraken. The demo environment (UseDemo) trades with paper funds against a live-like
+// book, for testing strategies without risk.
+package krakenfutures
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/jkosik/crypto-trader/internal/kraken"
+	"github.com/jkosik/crypto-trader/internal/redact"
+)
+
+// Hosts of the production and demo environments
+const (
+	ProductionURL = "https://futures.kraken.com"
+	DemoURL       = "https://demo-futures.kraken.com"
+)
+
+// BaseURL is the host requests are sent to, KRAKEN_FUTURES_API_URL sets it (e.g. DemoURL or a
+// mock server) for every command
+var BaseURL = baseURLFromEnv()
+
+// baseURLFromEnv returns KRAKEN_FUTURES_API_URL, or the production host if it's unset or invalid
+func baseURLFromEnv() string {
+	raw := os.Getenv("KRAKEN_FUTURES_API_URL")
+	if raw == "" {
+		return ProductionURL
+	}
+	u, err := kraken.ParseBaseURL(raw)
+	if err != nil {
+		slog.Warn("Ignoring KRAKEN_FUTURES_API_URL", "error", err)
+		return ProductionURL
+	}
+	return u
+}
+
+// SetBaseURL points the client at another host, empty keeps the current one
+func SetBaseURL(raw string) error {
+	if raw == "" {
+		return nil
+	}
+	u, err := kraken.ParseBaseURL(raw)
+	if err != nil {
+		return err
+	}
+	BaseURL = u
+	return nil
+}
+
+// Environment variables holding the futures API credentials, demo accounts have keys of their own
+const (
+	APIKeyEnv     = "KRAKEN_FUTURES_API_KEY"
+	PrivateKeyEnv = "KRAKEN_FUTURES_PRIVATE_KEY"
+)
+
+func init() {
+	redact.SecretEnv = append(redact.SecretEnv, APIKeyEnv, PrivateKeyEnv)
+	redact.Register(os.Getenv(APIKeyEnv), os.Getenv(PrivateKeyEnv))
+}
+
+// UseDemo points the client at the demo environment
+func UseDemo() {
+	BaseURL = DemoURL
+}
+
+// Demo reports whether requests go to the demo environment
+func Demo() bool {
+	return BaseURL == DemoURL
+}
+
+// Sign generates the Authent header of a private request: the SHA-256 of the post data, the
+// nonce and the endpoint path (without the /derivatives prefix), signed with HMAC-SHA512 using
+// the base64-decoded secret
+func Sign(endpointPath string, postData string, nonce string, secret string) (string, error) {
+	sha := sha256.Sum256([]byte(postData + nonce + strings.TrimPrefix(endpointPath, "/derivatives")))
+
+	decodedSecret, err := base64.StdEncoding.DecodeString(secret)
+	if err != nil {
+		return "", fmt.Errorf("failed to decode secret: %v", err)
+	}
+	mac := hmac.New(sha512.New, decodedSecret)
+	mac.Write(sha[:])
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil)), nil
+}
+
+var (
+	// nonces is shared by all private requests of the process, persisted per futures key
+	nonces     *kraken.NonceGenerator
+	noncesOnce sync.Once
+)
+
+// acquireNonce returns the next nonce, persisted like spot nonces if the state directory is
+// available, held until release is called once the request carrying it got its response
+func acquireNonce() (int64, func()) {
+	noncesOnce.Do(func() {
+		nonces = &kraken.NonceGenerator{}
+		apiKey := os.Getenv(APIKeyEnv)
+		if apiKey == "" {
+			return
+		}
+		path, err := kraken.NonceFilePath("futures:" + apiKey)
+		if err != nil {
+			slog.Warn("Futures nonce persistence disabled", "error", err)
+			return
+		}
+		g, err := kraken.NewPersistentNonceGenerator(path)
+		if err != nil {
+			slog.Warn("Futures nonce persistence disabled", "error", err)
+			return
+		}
+		nonces = g
+	})
+	return nonces.Acquire()
+}
+
+// response is the envelope of every futures API response
+type response struct {
+	Result string `json:"result"` // success or error
+	Error  string `json:"error"`
+}
+
+// publicRequest sends a GET request to a public endpoint and checks the response envelope
+func publicRequest(ctx context.Context, endpointPath string) ([]byte, error) {
+	return send(ctx, http.MethodGet, endpointPath, "", nil)
+}
+
+// privateRequest sends a signed request to a private endpoint, params are sent as the form body
+// of POST requests and as the query of GET requests
+func privateRequest(ctx context.Context, method string, endpointPath string, params url.Values) ([]byte, error) {
+	apiKey, secret := os.Getenv(APIKeyEnv), os.Getenv(PrivateKeyEnv)
+	if apiKey == "" || secret == "" {
+		return nil, fmt.Errorf("%s and %s environment variables must be set", APIKeyEnv, PrivateKeyEnv)
+	}
+	postData := params.Encode()
+	n, release := acquireNonce()
+	defer release()
+	nonce := strconv.FormatInt(n, 10)
+	authent, err := Sign(endpointPath, postData, nonce, secret)
+	if err != nil {
+		return nil, fmt.Errorf("error generating signature: %v", err)
+	}
+	return send(ctx, method, endpointPath, postData, http.Header{
+		"APIKey":  {apiKey},
+		"Nonce":   {nonce},
+		"Authent": {authent},
+	})
+}
+
+// send makes a request and returns its body once the envelope reports success
+func send(ctx context.Context, method string, endpointPath string, postData string, header http.Header) ([]byte, error) {
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, kraken.RequestTimeout)
+		defer cancel()
+	}
+
+	target := BaseURL + endpointPath
+	var reqBody io.Reader
+	if method == http.MethodGet && postData != "" {
+		target += "?" + postData
+	} else if postData != "" {
+		reqBody = strings.NewReader(postData)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, target, reqBody)
+	if err != nil {
+		return nil, fmt.Errorf("error creating request: %v", err)
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	req.Header.Set("Accept", "application/json")
+	if reqBody != nil {
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, redact.Error(fmt.Errorf("error making request: %v", err))
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("error reading response: %v", err)
+	}
+
+	var envelope response
+	if err := json.Unmarshal(body, &envelope); err != nil {
+		return nil, fmt.Errorf("error parsing response (HTTP %d): %v", resp.StatusCode, err)
+	}
+	if envelope.Result != "success" {
+		return nil, fmt.Errorf("API error: %s", envelope.Error)
+	}
+	return body, nil
+}
@@ -0,0 +1,288 @@
+package krakenfutures
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// Ticker is the market of a futures contract
+type Ticker struct {
+	Symbol       string  `json:"symbol"` // e.g. PF_XBTUSD (perpetual, multi-collateral)
+	Tag          string  `json:"tag"`    // perpetual, month, quarter, ...
+	Bid          float64 `json:"bid"`
+	BidSize      float64 `json:"bidSize"`
+	Ask          float64 `json:"ask"`
+	AskSize      float64 `json:"askSize"`
+	Last         float64 `json:"last"`
+	MarkPrice    float64 `json:"markPrice"`
+	Vol24h       float64 `json:"vol24h"` // contracts traded over the last 24h
+	OpenInterest float64 `json:"openInterest"`
+	FundingRate  float64 `json:"fundingRate"` // current hourly funding rate of perpetuals
+	Suspended    bool    `json:"suspended"`
+}
+
+// Spread returns the absolute and percentage spread of the ticker
+func (t Ticker) Spread() (float64, float64) {
+	if t.Bid <= 0 {
+		return 0, 0
+	}
+	return t.Ask - t.Bid, (t.Ask - t.Bid) / t.Bid * 100
+}
+
+// GetTickers returns the tickers of all contracts
+func GetTickers(ctx context.Context) ([]Ticker, error) {
+	body, err := publicRequest(ctx, "/derivatives/api/v3/tickers")
+	if err != nil {
+		return nil, err
+	}
+	var response struct {
+		Tickers []Ticker `json:"tickers"`
+	}
+	if err := json.Unmarshal(body, &response); err != nil {
+		return nil, fmt.Errorf("error parsing response: %v", err)
+	}
+	return response.Tickers, nil
+}
+
+// GetTicker returns the ticker of a contract
+func GetTicker(ctx context.Context, symbol string) (*Ticker, error) {
+	tickers, err := GetTickers(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, t := range tickers {
+		if strings.EqualFold(t.Symbol, symbol) {
+			return &t, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown futures contract: %s", symbol)
+}
+
+// Instrument is the contract specification of a futures contract
+type Instrument struct {
+	Symbol          string  `json:"symbol"`
+	Type            string  `json:"type"` // flexible_futures for multi-collateral contracts
+	Tradeable       bool    `json:"tradeable"`
+	TickSize        float64 `json:"tickSize"`
+	ContractSize    float64 `json:"contractSize"`
+	VolumeDecimals  int     `json:"contractValueTradePrecision"` // size precision, negative for multiples of 10
+	ImpactMidSize   float64 `json:"impactMidSize"`
+	MaxPositionSize float64 `json:"maxPositionSize"`
+}
+
+// GetInstrument returns the specification of a contract
+func GetInstrument(ctx context.Context, symbol string) (*Instrument, error) {
+	body, err := publicRequest(ctx, "/derivatives/api/v3/instruments")
+	if err != nil {
+		return nil, err
+	}
+	var response struct {
+		Instruments []Instrument `json:"instruments"`
+	}
+	if err := json.Unmarshal(body, &response); err != nil {
+		return nil, fmt.Errorf("error parsing response: %v", err)
+	}
+	for _, i := range response.Instruments {
+		if strings.EqualFold(i.Symbol, symbol) {
+			return &i, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown futures contract: %s", symbol)
+}
+
+// RoundPrice rounds a price to the contract's tick size
+func (i *Instrument) RoundPrice(price float64) float64 {
+	if i.TickSize <= 0 {
+		return price
+	}
+	ticks := math.Round(price / i.TickSize)
+	// Format through the tick size's decimals, so 0.1 ticks don't leave float noise
+	decimals := int(math.Max(0, math.Ceil(-math.Log10(i.TickSize))))
+	rounded, _ := strconv.ParseFloat(strconv.FormatFloat(ticks*i.TickSize, 'f', decimals, 64), 64)
+	return rounded
+}
+
+// RoundSize rounds a size down to the contract's size precision
+func (i *Instrument) RoundSize(size float64) float64 {
+	factor := math.Pow10(i.VolumeDecimals)
+	return math.Floor(size*factor+1e-9) / factor
+}
+
+// Order types of SendOrder
+const (
+	Limit      = "lmt"
+	PostOnly   = "post" // limit order canceled instead of crossing the book
+	Market     = "mkt"
+	IOC        = "ioc"
+	Stop       = "stp"
+	TakeProfit = "take_profit"
+)
+
+// OrderRequest is an order to send
+type OrderRequest struct {
+	Symbol     string
+	Side       string // buy or sell
+	OrderType  string // Limit, PostOnly, Market, IOC, Stop or TakeProfit
+	Size       float64
+	LimitPrice float64 // limit orders, and stops that become limit orders
+	StopPrice  float64 // trigger of Stop and TakeProfit orders
+	ReduceOnly bool    // may only reduce an open position, never open or flip one
+	ClientID   string  // cliOrdId, unique per order
+}
+
+// SendStatus is the outcome of SendOrder. Status is placed for accepted orders, anything else
+// (e.g. insufficientAvailableFunds, postWouldExecute, invalidPrice) means no order was created.
+type SendStatus struct {
+	OrderID      string `json:"order_id"`
+	Status       string `json:"status"`
+	ReceivedTime string `json:"receivedTime"`
+	ClientID     string `json:"cliOrdId"`
+}
+
+// SendOrder places an order
+func SendOrder(ctx context.Context, order OrderRequest) (*SendStatus, error) {
+	params := url.Values{
+		"symbol":    {order.Symbol},
+		"side":      {order.Side},
+		"orderType": {order.OrderType},
+		"size":      {formatFloat(order.Size)},
+	}
+	if order.LimitPrice > 0 {
+		params.Set("limitPrice", formatFloat(order.LimitPrice))
+	}
+	if order.StopPrice > 0 {
+		params.Set("stopPrice", formatFloat(order.StopPrice))
+	}
+	if order.ReduceOnly {
+		params.Set("reduceOnly", "true")
+	}
+	if order.ClientID != "" {
+		params.Set("cliOrdId", order.ClientID)
+	}
+
+	body, err := privateRequest(ctx, http.MethodPost, "/derivatives/api/v3/sendorder", params)
+	if err != nil {
+		return nil, err
+	}
+	var response struct {
+		SendStatus SendStatus `json:"sendStatus"`
+	}
+	if err := json.Unmarshal(body, &response); err != nil {
+		return nil, fmt.Errorf("error parsing response: %v", err)
+	}
+	status := response.SendStatus
+	if status.Status != "placed" {
+		return &status, fmt.Errorf("order not placed: %s", status.Status)
+	}
+	return &status, nil
+}
+
+// CancelOrder cancels an open order. An order that is no longer open (filled or canceled) isn't an
+// error.
+func CancelOrder(ctx context.Context, orderID string) error {
+	body, err := privateRequest(ctx, http.MethodPost, "/derivatives/api/v3/cancelorder", url.Values{"order_id": {orderID}})
+	if err != nil {
+		return err
+	}
+	var response struct {
+		CancelStatus struct {
+			Status string `json:"status"` // cancelled, filled or notFound
+		} `json:"cancelStatus"`
+	}
+	if err := json.Unmarshal(body, &response); err != nil {
+		return fmt.Errorf("error parsing response: %v", err)
+	}
+	switch response.CancelStatus.Status {
+	case "cancelled", "filled", "notFound":
+		return nil
+	default:
+		return fmt.Errorf("order %s not canceled: %s", orderID, response.CancelStatus.Status)
+	}
+}
+
+// OpenOrder is an order resting on the book
+type OpenOrder struct {
+	OrderID      string  `json:"order_id"`
+	ClientID     string  `json:"cliOrdId"`
+	Symbol       string  `json:"symbol"`
+	Side         string  `json:"side"`
+	OrderType    string  `json:"orderType"`
+	LimitPrice   float64 `json:"limitPrice"`
+	StopPrice    float64 `json:"stopPrice"`
+	UnfilledSize float64 `json:"unfilledSize"`
+	FilledSize   float64 `json:"filledSize"`
+	ReceivedTime string  `json:"receivedTime"`
+	Status       string  `json:"status"` // untouched or partiallyFilled
+	ReduceOnly   bool    `json:"reduceOnly"`
+}
+
+// GetOpenOrders returns the account's open orders, of one contract unless symbol is empty
+func GetOpenOrders(ctx context.Context, symbol string) ([]OpenOrder, error) {
+	body, err := privateRequest(ctx, http.MethodGet, "/derivatives/api/v3/openorders", nil)
+	if err != nil {
+		return nil, err
+	}
+	var response struct {
+		OpenOrders []OpenOrder `json:"openOrders"`
+	}
+	if err := json.Unmarshal(body, &response); err != nil {
+		return nil, fmt.Errorf("error parsing response: %v", err)
+	}
+	var orders []OpenOrder
+	for _, o := range response.OpenOrders {
+		if symbol == "" || strings.EqualFold(o.Symbol, symbol) {
+			orders = append(orders, o)
+		}
+	}
+	return orders, nil
+}
+
+// Position is an open futures position
+type Position struct {
+	Symbol            string  `json:"symbol"`
+	Side              string  `json:"side"` // long or short
+	Size              float64 `json:"size"`
+	Price             float64 `json:"price"` // average entry price
+	FillTime          string  `json:"fillTime"`
+	UnrealizedFunding float64 `json:"unrealizedFunding"`
+}
+
+// Signed returns the position's size, negative for shorts
+func (p Position) Signed() float64 {
+	if p.Side == "short" {
+		return -p.Size
+	}
+	return p.Size
+}
+
+// GetOpenPositions returns the account's open positions, of one contract unless symbol is empty
+func GetOpenPositions(ctx context.Context, symbol string) ([]Position, error) {
+	body, err := privateRequest(ctx, http.MethodGet, "/derivatives/api/v3/openpositions", nil)
+	if err != nil {
+		return nil, err
+	}
+	var response struct {
+		OpenPositions []Position `json:"openPositions"`
+	}
+	if err := json.Unmarshal(body, &response); err != nil {
+		return nil, fmt.Errorf("error parsing response: %v", err)
+	}
+	var positions []Position
+	for _, p := range response.OpenPositions {
+		if symbol == "" || strings.EqualFold(p.Symbol, symbol) {
+			positions = append(positions, p)
+		}
+	}
+	return positions, nil
+}
+
+// formatFloat formats a price or size without exponent or trailing zeros
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
@@ -0,0 +1,265 @@
+package krakenmock
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// order is an order kept by the server
+type order struct {
+	seq     int
+	txid    string
+	pair    string
+	side    string
+	kind    string // ordertype
+	price   float64
+	volume  float64
+	volExec float64
+	cost    float64
+	status  string
+	userref int64
+	clOrdID string
+	opened  time.Time
+	closed  time.Time
+}
+
+// FeePercent is charged on the cost of filled orders
+const FeePercent = 0.25
+
+// orderBook keeps the orders placed against the server
+type orderBook struct {
+	orders map[string]*order
+	next   int
+	now    func() time.Time
+}
+
+// placed numbers the transaction IDs of all servers of the process: like Kraken's they are never
+// reused, also across tests, where the kraken package keeps tracking orders of earlier servers
+var placed atomic.Int64
+
+func newOrderBook() *orderBook {
+	return &orderBook{orders: map[string]*order{}, now: time.Now}
+}
+
+// serve answers the order endpoints with a result or Kraken's error message, ok is false for the
+// other endpoints. The caller holds the server's lock.
+func (b *orderBook) serve(endpoint string, payload map[string]interface{}) (result interface{}, message string, ok bool) {
+	switch endpoint {
+	case "AddOrder":
+		if message := invalidOrder(payload); message != "" {
+			return nil, message, true
+		}
+		o := b.add(stringField(payload, "pair"), payload)
+		if payload["validate"] == true {
+			return map[string]interface{}{"descr": map[string]string{"order": o.description()}}, "", true
+		}
+		b.orders[o.txid] = o
+		return map[string]interface{}{"descr": map[string]string{"order": o.description()}, "txid": []string{o.txid}}, "", true
+	case "AddOrderBatch":
+		legs, _ := payload["orders"].([]interface{})
+		// Kraken validates the whole batch before placing any order. validate is a parameter of
+		// the batch, the mock refuses it inside an order rather than placing the order for real.
+		for _, leg := range legs {
+			fields, _ := leg.(map[string]interface{})
+			if message := invalidOrder(fields); message != "" {
+				return nil, message, true
+			}
+			if _, ok := fields["validate"]; ok {
+				return nil, "EGeneral:Invalid arguments:validate is a parameter of the batch, not of its orders", true
+			}
+		}
+		var results []interface{}
+		for _, leg := range legs {
+			fields, _ := leg.(map[string]interface{})
+			o := b.add(stringField(payload, "pair"), fields)
+			if payload["validate"] == true {
+				results = append(results, map[string]interface{}{"descr": map[string]string{"order": o.description()}})
+				continue
+			}
+			b.orders[o.txid] = o
+			results = append(results, map[string]interface{}{"txid": o.txid, "descr": map[string]string{"order": o.description()}})
+		}
+		return map[string]interface{}{"orders": results}, "", true
+	case "QueryOrders":
+		result := map[string]interface{}{}
+		for _, txid := range strings.Split(stringField(payload, "txid"), ",") {
+			if o, found := b.orders[strings.TrimSpace(txid)]; found {
+				result[o.txid] = o.render()
+			}
+		}
+		return result, "", true
+	case "OpenOrders", "ClosedOrders":
+		key := "open"
+		if endpoint == "ClosedOrders" {
+			key = "closed"
+		}
+		listed := map[string]interface{}{}
+		for _, o := range b.sorted() {
+			open := o.status == "open"
+			if open != (key == "open") {
+				continue
+			}
+			if id := stringField(payload, "cl_ord_id"); id != "" && id != o.clOrdID {
+				continue
+			}
+			if userref, ok := payload["userref"].(float64); ok && int64(userref) != o.userref {
+				continue
+			}
+			if start := floatField(payload, "start"); start > 0 && float64(o.opened.Unix()) < start {
+				continue
+			}
+			listed[o.txid] = o.render()
+		}
+		result := map[string]interface{}{key: listed}
+		if key == "closed" {
+			result["count"] = len(listed)
+		}
+		return result, "", true
+	case "CancelOrder":
+		o, found := b.orders[stringField(payload, "txid")]
+		if !found || o.status != "open" {
+			return nil, "EOrder:Unknown order", true
+		}
+		o.status, o.closed = "canceled", b.now()
+		return map[string]int{"count": 1}, "", true
+	}
+	return nil, "", false
+}
+
+// invalidOrder returns Kraken's error for order fields it rejects, "" for valid ones
+func invalidOrder(fields map[string]interface{}) string {
+	_, userref := fields["userref"]
+	if _, clOrdID := fields["cl_ord_id"]; userref && clOrdID {
+		return "EGeneral:Invalid arguments:userref and cl_ord_id are mutually exclusive"
+	}
+	return ""
+}
+
+// add creates an open order from the fields of an AddOrder or AddOrderBatch request
+func (b *orderBook) add(pair string, fields map[string]interface{}) *order {
+	b.next++
+	id := placed.Add(1)
+	o := &order{
+		seq:     b.next,
+		txid:    fmt.Sprintf("OMOCK%d-%05d-KRKMCK", id/100000, id%100000),
+		pair:    pair,
+		side:    stringField(fields, "type"),
+		kind:    stringField(fields, "ordertype"),
+		price:   floatField(fields, "price"),
+		volume:  floatField(fields, "volume"),
+		status:  "open",
+		clOrdID: stringField(fields, "cl_ord_id"),
+		opened:  b.now(),
+	}
+	if userref, ok := fields["userref"].(float64); ok {
+		o.userref = int64(userref)
+	}
+	return o
+}
+
+// sorted returns the orders in the order they were placed
+func (b *orderBook) sorted() []*order {
+	orders := make([]*order, 0, len(b.orders))
+	for _, o := range b.orders {
+		orders = append(orders, o)
+	}
+	sort.Slice(orders, func(i, j int) bool { return orders[i].seq < orders[j].seq })
+	return orders
+}
+
+func (o *order) description() string {
+	return fmt.Sprintf("%s %s %s @ %s %s", o.side, strconv.FormatFloat(o.volume, 'f', 8, 64), o.pair, o.kind,
+		strconv.FormatFloat(o.price, 'f', -1, 64))
+}
+
+// render returns the order as QueryOrders reports it
+func (o *order) render() map[string]interface{} {
+	closeTm := 0.0
+	if !o.closed.IsZero() {
+		closeTm = float64(o.closed.UnixNano()) / 1e9
+	}
+	return map[string]interface{}{
+		"status": o.status,
+		"descr": map[string]string{
+			"pair":      o.pair,
+			"type":      o.side,
+			"ordertype": o.kind,
+			"price":     strconv.FormatFloat(o.price, 'f', -1, 64),
+			"order":     o.description(),
+		},
+		"vol":       strconv.FormatFloat(o.volume, 'f', 8, 64),
+		"vol_exec":  strconv.FormatFloat(o.volExec, 'f', 8, 64),
+		"cost":      strconv.FormatFloat(o.cost, 'f', 5, 64),
+		"fee":       strconv.FormatFloat(o.cost*FeePercent/100, 'f', 5, 64),
+		"userref":   o.userref,
+		"cl_ord_id": o.clOrdID,
+		"opentm":    float64(o.opened.UnixNano()) / 1e9,
+		"closetm":   closeTm,
+	}
+}
+
+// Fill executes volume of an open order at its limit price, closing it once fully executed
+func (s *Server) Fill(txid string, volume float64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	o, found := s.orders.orders[txid]
+	if !found {
+		return fmt.Errorf("unknown order %s", txid)
+	}
+	if o.status != "open" {
+		return fmt.Errorf("order %s is %s", txid, o.status)
+	}
+	volume = minFloat(volume, o.volume-o.volExec)
+	o.volExec += volume
+	o.cost += volume * o.price
+	if o.volExec >= o.volume {
+		o.status, o.closed = "closed", s.orders.now()
+	}
+	return nil
+}
+
+// FillAll fully executes every open order
+func (s *Server) FillAll() {
+	for _, txid := range s.OpenOrders() {
+		s.Fill(txid, 1e18)
+	}
+}
+
+// OpenOrders returns the transaction IDs of the open orders in the order they were placed
+func (s *Server) OpenOrders() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var txids []string
+	for _, o := range s.orders.sorted() {
+		if o.status == "open" {
+			txids = append(txids, o.txid)
+		}
+	}
+	return txids
+}
+
+func stringField(fields map[string]interface{}, name string) string {
+	switch v := fields[name].(type) {
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	}
+	return ""
+}
+
+func floatField(fields map[string]interface{}, name string) float64 {
+	f, _ := strconv.ParseFloat(stringField(fields, name), 64)
+	return f
+}
+
+func minFloat(a, b float64) float64 {
+	if a < b {
+		return a
+	}
+	return b
+}
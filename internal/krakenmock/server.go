@@ -0,0 +1,274 @@
+// Package krakenmock serves Kraken's REST API from golden-file fixtures on a local HTTP server, so
+// the kraken package and the trader flow run deterministically without touching the exchange.
+// Point the client at it with Use (in process) or KRAKEN_API_URL (cmd/mockkraken).
+//
+// Every endpoint answers with its fixture (fixtures/<Endpoint>.json, recorded Kraken responses of
+// the XBT/USD pair), unless a response was set with Handle or queued with Queue. Orders are kept
+// by the server: AddOrder and AddOrderBatch create open orders, QueryOrders, OpenOrders and
+// ClosedOrders report them, CancelOrder cancels them and Fill executes them. Private requests
+// must carry an API key and, if a secret is set, a valid signature.
+package krakenmock
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"strings"
+	"sync"
+
+	"github.com/jkosik/crypto-trader/internal/kraken"
+)
+
+//go:embed fixtures/*.json
+var fixtures embed.FS
+
+// Secret is a base64 API secret for signed requests against the mock, it isn't a real key
+const Secret = "a3Jha2VubW9jay1zZWNyZXQta3Jha2VubW9jay1zZWNyZXQta3Jha2VubW9jay1zZWNyZXQ="
+
+// Request is a request the server received
+type Request struct {
+	Path    string
+	Query   string                 // of public requests
+	Payload map[string]interface{} // JSON body of private requests
+}
+
+// Server is a mock Kraken REST API
+type Server struct {
+	mu        sync.Mutex
+	fixtures  fs.FS
+	secret    string
+	responses map[string][]string // queued responses by path, the last one repeats
+	lost      map[string]int      // responses to drop by path, see LoseResponses
+	requests  []Request
+	orders    *orderBook
+	http      *httptest.Server
+}
+
+// New starts a server answering from the embedded fixtures. Private requests are checked against
+// secret unless it's empty.
+func New(secret string) *Server {
+	sub, _ := fs.Sub(fixtures, "fixtures")
+	s := &Server{fixtures: sub, secret: secret, responses: map[string][]string{}, lost: map[string]int{}, orders: newOrderBook()}
+	s.http = httptest.NewServer(s)
+	return s
+}
+
+// NewFromDir starts a server answering from the fixtures in dir, falling back to the embedded ones
+func NewFromDir(dir string, secret string) *Server {
+	s := New(secret)
+	s.fixtures = overlay{dir: os.DirFS(dir), fallback: s.fixtures}
+	return s
+}
+
+// Fixture returns an embedded fixture by endpoint name (e.g. QueryOrders), for answering an
+// endpoint with the recorded response through Handle instead of the server's order book
+func Fixture(endpoint string) (string, error) {
+	body, err := fixtures.ReadFile("fixtures/" + endpoint + ".json")
+	if err != nil {
+		return "", fmt.Errorf("no fixture for %s", endpoint)
+	}
+	return string(body), nil
+}
+
+// URL returns the base URL of the server
+func (s *Server) URL() string {
+	return s.http.URL
+}
+
+// Close shuts the server down
+func (s *Server) Close() {
+	s.http.Close()
+}
+
+// Use points the kraken package at the server and returns a function restoring the previous host
+func (s *Server) Use() func() {
+	previous := kraken.BaseURL
+	kraken.BaseURL = s.URL()
+	return func() { kraken.BaseURL = previous }
+}
+
+// Handle answers every request to an endpoint path (e.g. /0/public/Ticker) with body
+func (s *Server) Handle(endpoint string, body string) {
+	s.Queue(endpoint, body)
+}
+
+// Queue answers the next requests to an endpoint path with bodies in turn, the last one repeats
+func (s *Server) Queue(endpoint string, bodies ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.responses[endpoint] = bodies
+}
+
+// LoseResponses handles the next n requests to an endpoint path but closes the connection instead
+// of answering, like a response lost in transit: an order is placed without the client learning it
+func (s *Server) LoseResponses(endpoint string, n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lost[endpoint] = n
+}
+
+// Requests returns the requests received for an endpoint path, all of them if it's empty
+func (s *Server) Requests(endpoint string) []Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var requests []Request
+	for _, r := range s.requests {
+		if endpoint == "" || r.Path == endpoint {
+			requests = append(requests, r)
+		}
+	}
+	return requests
+}
+
+// ServeHTTP answers a request with a queued response, the order book or the endpoint's fixture
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	request := Request{Path: r.URL.Path, Query: r.URL.RawQuery}
+	private := strings.HasPrefix(r.URL.Path, "/0/private/")
+	if private {
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			writeError(w, "EGeneral:Internal error")
+			return
+		}
+		if message := s.authenticate(r, string(body)); message != "" {
+			writeError(w, message)
+			return
+		}
+		if err := json.Unmarshal(body, &request.Payload); err != nil {
+			writeError(w, "EGeneral:Invalid arguments")
+			return
+		}
+	}
+
+	s.mu.Lock()
+	s.requests = append(s.requests, request)
+	queued := s.responses[r.URL.Path]
+	if len(queued) > 1 {
+		s.responses[r.URL.Path] = queued[1:]
+	}
+	lose := s.lost[r.URL.Path] > 0
+	if lose {
+		s.lost[r.URL.Path]--
+	}
+	s.mu.Unlock()
+	if lose {
+		// Aborting the handler once it's done closes the connection without a response
+		w = lostResponse{w}
+		defer panic(http.ErrAbortHandler)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if len(queued) > 0 {
+		io.WriteString(w, queued[0])
+		return
+	}
+	if private {
+		s.mu.Lock()
+		result, message, ok := s.orders.serve(path.Base(r.URL.Path), request.Payload)
+		s.mu.Unlock()
+		if message != "" {
+			writeError(w, message)
+			return
+		}
+		if ok {
+			writeResult(w, result)
+			return
+		}
+	}
+	body, err := fs.ReadFile(s.fixtures, path.Base(r.URL.Path)+".json")
+	if err != nil {
+		writeError(w, "EGeneral:Unknown method")
+		return
+	}
+	w.Write(rekey(body, r.URL.Query().Get("pair")))
+}
+
+// lostResponse discards what the handler writes
+type lostResponse struct {
+	http.ResponseWriter
+}
+
+func (w lostResponse) Write(b []byte) (int, error) {
+	return len(b), nil
+}
+
+func (w lostResponse) WriteHeader(int) {}
+
+// rekey keys the result of a fixture by the requested pair if it was given as a WebSocket name
+// (e.g. BTC/USD), like Kraken does, instead of the recorded pair key (XXBTZUSD)
+func rekey(body []byte, pair string) []byte {
+	if !strings.Contains(pair, "/") {
+		return body
+	}
+	var response struct {
+		Error  []string                   `json:"error"`
+		Result map[string]json.RawMessage `json:"result"`
+	}
+	if err := json.Unmarshal(body, &response); err != nil {
+		return body
+	}
+	rekeyed := map[string]json.RawMessage{}
+	for key, value := range response.Result {
+		if key != "last" {
+			key = pair
+		}
+		rekeyed[key] = value
+	}
+	response.Result = rekeyed
+	if response.Error == nil {
+		response.Error = []string{}
+	}
+	out, err := json.Marshal(response)
+	if err != nil {
+		return body
+	}
+	return out
+}
+
+// authenticate checks the API key and signature of a private request, returning Kraken's error
+// message if they're missing or invalid
+func (s *Server) authenticate(r *http.Request, payload string) string {
+	if r.Header.Get("API-Key") == "" {
+		return "EAPI:Invalid key"
+	}
+	if s.secret == "" {
+		return ""
+	}
+	expected, err := kraken.GetKrakenSignature(r.URL.Path, payload, s.secret)
+	if err != nil || expected != r.Header.Get("API-Sign") {
+		return "EAPI:Invalid signature"
+	}
+	return ""
+}
+
+func writeResult(w http.ResponseWriter, result interface{}) {
+	json.NewEncoder(w).Encode(map[string]interface{}{"error": []string{}, "result": result})
+}
+
+func writeError(w http.ResponseWriter, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"error": []string{message}})
+}
+
+// overlay reads files from dir, and from fallback if dir doesn't have them
+type overlay struct {
+	dir      fs.FS
+	fallback fs.FS
+}
+
+func (o overlay) Open(name string) (fs.File, error) {
+	f, err := o.dir.Open(name)
+	if err == nil {
+		return f, nil
+	}
+	if !os.IsNotExist(err) {
+		return nil, fmt.Errorf("error reading fixture %s: %v", name, err)
+	}
+	return o.fallback.Open(name)
+}
@@ -0,0 +1,70 @@
+// Package logging configures structured logging and carries per-trade loggers in contexts.
+package logging
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+
+	"github.com/jkosik/crypto-trader/internal/redact"
+)
+
+// contextKey is the type for values stored in a context by this package
+type contextKey struct{}
+
+// Setup configures the process-wide default logger. Secrets are scrubbed from every record, warnings
+// and errors are collected for LogSummary.
+// format is "text" (logfmt-style key=value lines) or "json"; level is debug, info, warn or error.
+func Setup(w io.Writer, format string, level string) error {
+	var lvl slog.Level
+	if err := lvl.UnmarshalText([]byte(level)); err != nil {
+		return fmt.Errorf("unknown log level: %s", level)
+	}
+
+	opts := &slog.HandlerOptions{Level: lvl}
+	var handler slog.Handler
+	switch strings.ToLower(format) {
+	case "text":
+		handler = slog.NewTextHandler(w, opts)
+	case "json":
+		handler = slog.NewJSONHandler(w, opts)
+	default:
+		return fmt.Errorf("unknown log format: %s", format)
+	}
+
+	slog.SetDefault(slog.New(redact.Handler(&collector{next: handler})))
+	return nil
+}
+
+// NewTradeID generates a random correlation ID for a single trade
+func NewTradeID() string {
+	b := make([]byte, 6)
+	if _, err := rand.Read(b); err != nil {
+		return "unknown"
+	}
+	return hex.EncodeToString(b)
+}
+
+// WithTradeID returns a context whose logger tags every record with the trade ID
+func WithTradeID(ctx context.Context, tradeID string) context.Context {
+	return NewContext(ctx, FromContext(ctx).With("trade_id", tradeID))
+}
+
+// NewContext returns a context carrying the logger
+func NewContext(ctx context.Context, logger *slog.Logger) context.Context {
+	return context.WithValue(ctx, contextKey{}, logger)
+}
+
+// FromContext returns the logger carried by the context, or the default logger
+func FromContext(ctx context.Context) *slog.Logger {
+	if ctx != nil {
+		if logger, ok := ctx.Value(contextKey{}).(*slog.Logger); ok {
+			return logger
+		}
+	}
+	return slog.Default()
+}
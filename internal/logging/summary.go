@@ -0,0 +1,119 @@
+package logging
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+)
+
+// Issue is a warning or error logged during the run, counted by its message
+type Issue struct {
+	Level     slog.Level
+	Message   string
+	Count     int
+	LastError string // error attribute of the last occurrence, if any
+}
+
+// issues collects the warnings and errors of the process for the summary at exit
+var issues = &issueLog{index: map[string]int{}}
+
+type issueLog struct {
+	mu     sync.Mutex
+	list   []Issue
+	index  map[string]int // level and message to the position in list
+	closed bool
+}
+
+func (l *issueLog) add(r slog.Record, attrs []slog.Attr) {
+	var lastError string
+	for _, a := range attrs {
+		if a.Key == "error" {
+			lastError = a.Value.String()
+		}
+	}
+	r.Attrs(func(a slog.Attr) bool {
+		if a.Key == "error" {
+			lastError = a.Value.String()
+		}
+		return true
+	})
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.closed {
+		return
+	}
+	key := r.Level.String() + " " + r.Message
+	i, ok := l.index[key]
+	if !ok {
+		i = len(l.list)
+		l.index[key] = i
+		l.list = append(l.list, Issue{Level: r.Level, Message: r.Message})
+	}
+	l.list[i].Count++
+	if lastError != "" {
+		l.list[i].LastError = lastError
+	}
+}
+
+// collector passes records on to the next handler and keeps the warnings and errors in issues
+type collector struct {
+	next  slog.Handler
+	attrs []slog.Attr
+}
+
+func (h *collector) Enabled(ctx context.Context, level slog.Level) bool {
+	// Warnings are collected even if the log level hides them
+	return level >= slog.LevelWarn || h.next.Enabled(ctx, level)
+}
+
+func (h *collector) Handle(ctx context.Context, r slog.Record) error {
+	if r.Level >= slog.LevelWarn {
+		issues.add(r, h.attrs)
+	}
+	if !h.next.Enabled(ctx, r.Level) {
+		return nil
+	}
+	return h.next.Handle(ctx, r)
+}
+
+func (h *collector) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &collector{next: h.next.WithAttrs(attrs), attrs: append(append([]slog.Attr{}, h.attrs...), attrs...)}
+}
+
+func (h *collector) WithGroup(name string) slog.Handler {
+	return &collector{next: h.next.WithGroup(name), attrs: h.attrs}
+}
+
+// Issues returns the warnings and errors logged so far, in the order they first occurred
+func Issues() []Issue {
+	issues.mu.Lock()
+	defer issues.mu.Unlock()
+	return append([]Issue{}, issues.list...)
+}
+
+// LogSummary logs the warnings and errors of the run once more, one record per distinct message
+// with its count, so the ones that scrolled by in a long log stream are noticed at exit. Records
+// logged afterwards aren't collected anymore.
+func LogSummary() {
+	issues.mu.Lock()
+	list := issues.list
+	issues.closed = true
+	issues.mu.Unlock()
+	if len(list) == 0 {
+		return
+	}
+
+	total := 0
+	for _, issue := range list {
+		total += issue.Count
+	}
+	slog.Warn("Warnings and errors during this run", "distinct", len(list), "total", total)
+	for _, issue := range list {
+		attrs := []any{"level", issue.Level.String(), "message", issue.Message, "count", issue.Count}
+		if issue.LastError != "" {
+			attrs = append(attrs, "last_error", issue.LastError)
+		}
+		slog.Warn("Summary", attrs...)
+	}
+}
@@ -0,0 +1,44 @@
+package maker
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/jkosik/crypto-trader/internal/kraken"
+)
+
+// Level is a rung of a quote ladder
+type Level struct {
+	Offset float64 // fraction of the price the level's quotes sit further out than the innermost ones
+	Volume float64 // base coin volume of the level's quote on each side
+}
+
+// Ladder splits volume across levels on each side, stepPercent apart, every level sizeFactor times
+// the previous one's volume: 1 splits it evenly, above 1 puts more volume on the outer levels where
+// fills come at better prices. Every level must still make a valid order for the pair.
+func Ladder(pair *kraken.AssetPair, volume float64, levels int, stepPercent float64, sizeFactor float64) ([]Level, error) {
+	if levels < 1 {
+		levels = 1
+	}
+	weights := 0.0
+	for i := 0; i < levels; i++ {
+		weights += math.Pow(sizeFactor, float64(i))
+	}
+	ladder := make([]Level, levels)
+	for i := range ladder {
+		ladder[i] = Level{
+			Offset: float64(i) * stepPercent / 100,
+			Volume: pair.RoundVolume(volume * math.Pow(sizeFactor, float64(i)) / weights),
+		}
+		if pair.OrderMin > 0 && ladder[i].Volume < pair.OrderMin {
+			return nil, fmt.Errorf("level %d of %d gets volume %s, below the minimum order size %g for %s",
+				i+1, levels, pair.FormatVolume(ladder[i].Volume), pair.OrderMin, pair.WSName)
+		}
+	}
+	return ladder, nil
+}
+
+// prices returns the level's buy and sell price given the innermost ones
+func (l Level) prices(pair *kraken.AssetPair, buyPrice float64, sellPrice float64) (float64, float64) {
+	return pair.RoundPrice(buyPrice * (1 - l.Offset)), pair.RoundPrice(sellPrice * (1 + l.Offset))
+}
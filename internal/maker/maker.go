@@ -0,0 +1,376 @@
+// Package maker is the continuous market maker behind `trader maker`: it keeps a buy and a sell
+// limit order live inside the spread, or a ladder of them on each side, and re-quotes an order at
+// the current spread as soon as it's done, instead of stopping after one round trip like the spread
+// trade.
+package maker
+
+import (
+	"context"
+	"errors"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/jkosik/crypto-trader/internal/kraken"
+	"github.com/jkosik/crypto-trader/internal/logging"
+	"github.com/jkosik/crypto-trader/internal/risk"
+	"github.com/jkosik/crypto-trader/internal/store"
+)
+
+// Result is the journaled result of a market maker session
+const Result = "maker"
+
+// ErrLossLimit stops the maker once its realized loss uses up Options.LossBudget
+var ErrLossLimit = errors.New("realized loss reached the daily loss limit")
+
+// Options tune the maker
+type Options struct {
+	Volume              float64       // base coin volume quoted on each side, split across Ladder
+	Ladder              []Level       // price levels on each side, see Ladder; nil quotes the whole volume at the innermost prices
+	NarrowFactor        float64       // spread narrowing of the quotes, like spread_narrow_factor
+	MinNetProfitPercent float64       // quote only while the spread pays both maker fees with this margin, % of the buy cost
+	MakerFeePercent     float64       // fee of each leg
+	PollInterval        time.Duration // time between order status checks
+	Limits              risk.Limits   // checked before every new buy quote, except on paper
+	LossBudget          float64       // stop once the realized loss reaches this many USD, 0 disables
+	MaxRoundTrips       int           // stop after this many filled buy and sell quotes each, 0 runs until canceled
+
+	// Inventory skew: new quotes move against the base coin balance's deviation from the target,
+	// by up to InventorySkew of the half-spread at MaxInventory, so fills revert the inventory
+	StartInventory  float64 // base coin balance when the maker started
+	InventoryTarget float64 // base coin balance to revert to
+	MaxInventory    float64 // deviation at full skew, beyond it the side growing it isn't quoted; 0 disables skew
+	InventorySkew   float64 // fraction of the half-spread the quotes move at full skew
+}
+
+// Quote is an order of the maker with the fills seen so far
+type Quote struct {
+	TxID    string
+	Side    string // buy or sell
+	Level   int    // ladder level, 0 is the innermost
+	Price   float64
+	Volume  float64
+	Status  string
+	VolExec float64
+	Cost    float64
+	Fee     float64
+}
+
+// Stats are the maker's fills so far
+type Stats struct {
+	Bought    float64 // base coin bought
+	BoughtUSD float64
+	Sold      float64 // base coin sold
+	SoldUSD   float64
+	Fees      float64
+	BuyFills  int // buy quotes filled completely
+	SellFills int // sell quotes filled completely
+}
+
+// Inventory returns the base coin bought beyond what was sold, negative if more was sold
+func (s Stats) Inventory() float64 {
+	return s.Bought - s.Sold
+}
+
+// RoundTrips returns the number of buy quotes filled completely that a filled sell quote matches
+func (s Stats) RoundTrips() int {
+	if s.BuyFills < s.SellFills {
+		return s.BuyFills
+	}
+	return s.SellFills
+}
+
+// Realized returns the gross profit of the volume both bought and sold at the average prices, and
+// the net profit after all fees paid
+func (s Stats) Realized() (float64, float64) {
+	matched := math.Min(s.Bought, s.Sold)
+	if matched == 0 {
+		return 0, -s.Fees
+	}
+	gross := matched * (s.SoldUSD/s.Sold - s.BoughtUSD/s.Bought)
+	return gross, gross - s.Fees
+}
+
+// Maker quotes one pair. All its orders share the userref of the session and are journaled under
+// one trade, started with the first order.
+type Maker struct {
+	coin    string
+	pair    *kraken.AssetPair
+	opts    Options
+	journal *store.Store // nil disables journaling
+	tradeID string
+	userref int32
+	started bool
+	quotes  map[string]*Quote // live quotes by quoteKey
+	stats   Stats
+}
+
+// New returns a maker for the coin's USD pair, journaling its orders under tradeID
+func New(coin string, pair *kraken.AssetPair, journal *store.Store, tradeID string, opts Options) *Maker {
+	if len(opts.Ladder) == 0 {
+		opts.Ladder = []Level{{Volume: opts.Volume}}
+	}
+	return &Maker{
+		coin:    coin,
+		pair:    pair,
+		opts:    opts,
+		journal: journal,
+		tradeID: tradeID,
+		userref: kraken.UserRef(tradeID),
+		quotes:  map[string]*Quote{},
+	}
+}
+
+// Stats returns the fills so far
+func (m *Maker) Stats() Stats {
+	return m.stats
+}
+
+// Inventory returns the base coin balance: the starting one plus the fills so far
+func (m *Maker) Inventory() float64 {
+	return m.opts.StartInventory + m.stats.Inventory()
+}
+
+// skew returns the inventory's deviation from the target relative to MaxInventory: positive when
+// long, negative when short, beyond ±1 once the limit is passed. Zero without MaxInventory.
+func (m *Maker) skew() float64 {
+	if m.opts.MaxInventory <= 0 {
+		return 0
+	}
+	return (m.Inventory() - m.opts.InventoryTarget) / m.opts.MaxInventory
+}
+
+// Run keeps the quotes live until the context is canceled, MaxRoundTrips are filled or the loss
+// budget is used up, calling notify whenever a quote changes status or fills. Failed requests are
+// logged and retried on the next poll. Quotes still live are left for Finish.
+func (m *Maker) Run(ctx context.Context, notify func(*Quote)) error {
+	log := logging.FromContext(ctx)
+	ticker := time.NewTicker(m.opts.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		for _, quote := range m.quotes {
+			if err := m.poll(ctx, quote, notify); err != nil {
+				if ctx.Err() != nil {
+					return ctx.Err()
+				}
+				log.Warn("Failed to check quote", "txid", quote.TxID, "type", quote.Side, "error", err)
+			}
+		}
+
+		if _, net := m.stats.Realized(); m.opts.LossBudget > 0 && net <= -m.opts.LossBudget {
+			return ErrLossLimit
+		}
+		if m.opts.MaxRoundTrips > 0 && m.stats.RoundTrips() >= m.opts.MaxRoundTrips {
+			log.Info("Round trips done", "round_trips", m.stats.RoundTrips())
+			return nil
+		}
+
+		if err := m.requote(ctx); err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			log.Warn("Failed to re-quote", "error", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// poll refreshes a quote's status, accounts its new fills and drops it once done
+func (m *Maker) poll(ctx context.Context, quote *Quote, notify func(*Quote)) error {
+	status, err := kraken.CheckOrderStatus(ctx, quote.TxID)
+	if err != nil {
+		return err
+	}
+	volExec, cost, fee := kraken.ParseFloat(status.VolExec), kraken.ParseFloat(status.Cost), kraken.ParseFloat(status.Fee)
+	if status.Status == quote.Status && volExec == quote.VolExec {
+		return nil
+	}
+
+	// Kraken reports cumulative amounts, only the difference is new
+	if quote.Side == "buy" {
+		m.stats.Bought += volExec - quote.VolExec
+		m.stats.BoughtUSD += cost - quote.Cost
+	} else {
+		m.stats.Sold += volExec - quote.VolExec
+		m.stats.SoldUSD += cost - quote.Cost
+	}
+	m.stats.Fees += fee - quote.Fee
+	quote.Status, quote.VolExec, quote.Cost, quote.Fee = status.Status, volExec, cost, fee
+
+	if m.journal != nil {
+		fill := store.Fill{
+			TxID:       quote.TxID,
+			Status:     quote.Status,
+			Price:      kraken.ParseFloat(status.Descr.Price),
+			VolExec:    quote.VolExec,
+			Cost:       quote.Cost,
+			Fee:        quote.Fee,
+			ObservedAt: time.Now(),
+		}
+		if err := m.journal.RecordFill(fill); err != nil {
+			logging.FromContext(ctx).Warn("Failed to record fill in journal", "txid", quote.TxID, "error", err)
+		}
+	}
+
+	if kraken.OrderDone(quote.Status) {
+		if quote.Status == "closed" && quote.Side == "buy" {
+			m.stats.BuyFills++
+		} else if quote.Status == "closed" {
+			m.stats.SellFills++
+		}
+		delete(m.quotes, quoteKey(quote.Side, quote.Level))
+	}
+	notify(quote)
+	return nil
+}
+
+// requote places the missing quotes at the current spread, skewed against the inventory and stepped
+// out by their ladder level, as long as the innermost level pays both maker fees with the configured
+// margin. A buy quote is checked against the risk limits first.
+func (m *Maker) requote(ctx context.Context) error {
+	if len(m.quotes) == 2*len(m.opts.Ladder) {
+		return nil
+	}
+	log := logging.FromContext(ctx)
+
+	market, err := kraken.GetTickerInfo(ctx, m.coin)
+	if err != nil {
+		return err
+	}
+	buyPrice, sellPrice := kraken.SpreadOrderPrices(m.pair, market, m.opts.NarrowFactor, nil)
+
+	// Long inventory lowers both quotes so the sell fills sooner and the buy later, short raises them
+	skew := math.Max(-1, math.Min(1, m.skew()))
+	if shift := skew * m.opts.InventorySkew * (sellPrice - buyPrice) / 2; shift != 0 {
+		buyPrice, sellPrice = m.pair.RoundPrice(buyPrice-shift), m.pair.RoundPrice(sellPrice-shift)
+		log.Debug("Skewed quotes", "inventory", m.Inventory(), "inventory_target", m.opts.InventoryTarget, "skew", skew, "buy", buyPrice, "sell", sellPrice)
+	}
+	innermost := m.opts.Ladder[0].Volume
+	_, _, netProfit := kraken.SpreadNetProfit(buyPrice, sellPrice, innermost, m.opts.MakerFeePercent)
+	netProfitPercent := netProfit / (buyPrice * innermost) * 100
+	if netProfitPercent < m.opts.MinNetProfitPercent {
+		log.Info("Spread doesn't pay the fees, waiting to quote",
+			"bid", market.BidPrice,
+			"ask", market.AskPrice,
+			"net_profit_percent", netProfitPercent,
+			"min_net_profit_percent", m.opts.MinNetProfitPercent)
+		return nil
+	}
+
+	for level, rung := range m.opts.Ladder {
+		levelBuy, levelSell := rung.prices(m.pair, buyPrice, sellPrice)
+
+		// Past max_inventory the side growing the deviation waits until the other one fills
+		if m.quotes[quoteKey("buy", level)] == nil && m.skew() >= 1 {
+			log.Info("Inventory above the target by max_inventory, not quoting the buy side", "level", level, "inventory", m.Inventory(), "inventory_target", m.opts.InventoryTarget)
+		} else if m.quotes[quoteKey("buy", level)] == nil {
+			if err := m.checkLimits(ctx, levelBuy*rung.Volume); err != nil {
+				log.Warn("Risk limit reached, not quoting the buy side", "level", level, "error", err)
+			} else if err := m.place(ctx, true, level, levelBuy); err != nil {
+				return err
+			}
+		}
+		if m.quotes[quoteKey("sell", level)] == nil && m.skew() <= -1 {
+			log.Info("Inventory below the target by max_inventory, not quoting the sell side", "level", level, "inventory", m.Inventory(), "inventory_target", m.opts.InventoryTarget)
+		} else if m.quotes[quoteKey("sell", level)] == nil {
+			if err := m.place(ctx, false, level, levelSell); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// checkLimits checks a new buy quote costing buyUSD against the account's open orders. The maker's
+// own live quotes already count as its open spread.
+func (m *Maker) checkLimits(ctx context.Context, buyUSD float64) error {
+	if kraken.Paper() || (m.opts.Limits.MaxExposureUSD == 0 && m.opts.Limits.MaxOpenSpreads == 0) {
+		return nil
+	}
+	openOrders, err := kraken.GetOpenOrders(ctx, "")
+	if err != nil {
+		return err
+	}
+	exposure := risk.Measure(openOrders, m.pair)
+	if len(m.quotes) > 0 {
+		exposure.OpenSpreads--
+	}
+	return m.opts.Limits.Check(exposure, buyUSD)
+}
+
+// place places a ladder level's quote and journals it
+func (m *Maker) place(ctx context.Context, isBuy bool, level int, price float64) error {
+	volume := m.opts.Ladder[level].Volume
+	txId, err := kraken.PlaceLimitOrder(ctx, m.pair, price, volume, isBuy, false, m.userref)
+	if err != nil {
+		return err
+	}
+	quote := &Quote{TxID: txId, Side: side(isBuy), Level: level, Price: price, Volume: volume, Status: "open"}
+	m.quotes[quoteKey(quote.Side, level)] = quote
+	logging.FromContext(ctx).Info("Quoted", "type", quote.Side, "level", level, "txid", txId, "volume", m.pair.FormatVolume(volume), "price", m.pair.FormatPrice(price), "inventory", m.stats.Inventory())
+
+	if m.journal == nil {
+		return nil
+	}
+	log := logging.FromContext(ctx)
+	if !m.started {
+		// The session trades any number of quotes, the trade carries the volume of one
+		if err := m.journal.StartTrade(store.Trade{ID: m.tradeID, Pair: kraken.PairName(m.coin), Volume: m.opts.Volume, StartedAt: time.Now()}); err != nil {
+			log.Warn("Failed to record trade in journal", "error", err)
+			return nil
+		}
+		m.started = true
+	}
+	if err := m.journal.RecordOrder(store.Order{TxID: txId, TradeID: m.tradeID, Side: quote.Side, Volume: quote.Volume, PlacedAt: time.Now()}); err != nil {
+		log.Warn("Failed to record order in journal", "txid", txId, "error", err)
+	}
+	return nil
+}
+
+// Finish cancels the live quotes, accounts their last fills and journals the session's result
+func (m *Maker) Finish(ctx context.Context, notify func(*Quote)) {
+	log := logging.FromContext(ctx)
+	for _, quote := range m.quotes {
+		if err := kraken.CancelOrder(ctx, quote.TxID); err != nil {
+			log.Error("Failed to cancel quote, it's left open", "txid", quote.TxID, "type", quote.Side, "error", err)
+			continue
+		}
+		if err := m.poll(ctx, quote, notify); err != nil {
+			log.Warn("Failed to check canceled quote", "txid", quote.TxID, "error", err)
+		}
+	}
+
+	if m.journal == nil || !m.started {
+		return
+	}
+	gross, net := m.stats.Realized()
+	result := store.TradeResult{Result: Result, Fees: m.stats.Fees, GrossProfit: gross, NetProfit: net, FinishedAt: time.Now()}
+	if m.stats.Bought > 0 {
+		result.BuyPrice = m.stats.BoughtUSD / m.stats.Bought
+	}
+	if m.stats.Sold > 0 {
+		result.SellPrice = m.stats.SoldUSD / m.stats.Sold
+	}
+	if err := m.journal.FinishTrade(m.tradeID, result); err != nil {
+		log.Warn("Failed to finish trade in journal", "error", err)
+	}
+}
+
+// quoteKey keys a live quote by its side and ladder level
+func quoteKey(side string, level int) string {
+	return side + "/" + strconv.Itoa(level)
+}
+
+// side names the side of an order
+func side(isBuy bool) string {
+	if isBuy {
+		return "buy"
+	}
+	return "sell"
+}
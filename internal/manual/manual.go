@@ -0,0 +1,320 @@
+// Package manual is the session behind `trader manual`: single limit orders placed, repriced and
+// canceled by hand, checked like the bot's own orders before they reach the exchange and
+// journaled like its trades.
+package manual
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/jkosik/crypto-trader/internal/kraken"
+	"github.com/jkosik/crypto-trader/internal/logging"
+	"github.com/jkosik/crypto-trader/internal/store"
+)
+
+// Result is the journaled result of a manual session, it has no spread P&L
+const Result = "manual"
+
+// Options are the bot-side limits on manual orders
+type Options struct {
+	MaxVolume           float64 // max base coin volume per order, 0 = unlimited
+	MaxDeviationPercent float64 // refuse prices further than this from the mid price, 0 = unlimited
+	AllowTaker          bool    // allow prices crossing the book, which fill at once as taker
+}
+
+// DefaultOptions are used by `trader manual` unless overridden by flags
+var DefaultOptions = Options{
+	MaxDeviationPercent: 5,
+}
+
+// Order is an order placed in the session with its last observed state
+type Order struct {
+	TxID    string
+	Side    string // buy or sell
+	Price   float64
+	Volume  float64
+	Status  string
+	VolExec float64
+	Cost    float64
+	Fee     float64
+}
+
+// Open reports whether the order is still on the book
+func (o *Order) Open() bool {
+	return o.Status == "open" || o.Status == "pending"
+}
+
+// Session is a manual trading session on one pair. All orders are journaled under one trade,
+// started with the first order.
+type Session struct {
+	ctx     context.Context
+	pair    *kraken.AssetPair
+	coin    string
+	opts    Options
+	journal *store.Store // nil disables journaling
+	tradeID string
+	started bool
+	orders  []*Order
+}
+
+// New starts a session on the coin's USD pair, journaling its orders under tradeID
+func New(ctx context.Context, coin string, pair *kraken.AssetPair, journal *store.Store, tradeID string, opts Options) *Session {
+	return &Session{ctx: ctx, pair: pair, coin: coin, opts: opts, journal: journal, tradeID: tradeID}
+}
+
+// Orders returns the orders placed in the session, oldest first. Edited orders are replaced.
+func (s *Session) Orders() []*Order {
+	return s.orders
+}
+
+// OpenOrders returns the orders still on the book
+func (s *Session) OpenOrders() []*Order {
+	var open []*Order
+	for _, order := range s.orders {
+		if order.Open() {
+			open = append(open, order)
+		}
+	}
+	return open
+}
+
+// Validate checks an order against the pair's minimums and the session limits at the current
+// market. Prices and volumes are rounded to the pair's precision first, like placed orders are.
+func (s *Session) Validate(isBuy bool, price float64, volume float64, market *kraken.SpreadInfo) error {
+	price = s.pair.RoundPrice(price)
+	volume = s.pair.RoundVolume(volume)
+	if price <= 0 || volume <= 0 {
+		return fmt.Errorf("price and volume must be positive")
+	}
+	if err := s.pair.ValidateOrder(price, volume); err != nil {
+		return err
+	}
+	if s.opts.MaxVolume > 0 && volume > s.opts.MaxVolume {
+		return fmt.Errorf("volume %s exceeds max_volume %g", s.pair.FormatVolume(volume), s.opts.MaxVolume)
+	}
+	if !s.opts.AllowTaker {
+		if isBuy && price >= market.AskPrice {
+			return fmt.Errorf("buy at %s crosses the ask %s and would fill as taker", s.pair.FormatPrice(price), s.pair.FormatPrice(market.AskPrice))
+		}
+		if !isBuy && price <= market.BidPrice {
+			return fmt.Errorf("sell at %s crosses the bid %s and would fill as taker", s.pair.FormatPrice(price), s.pair.FormatPrice(market.BidPrice))
+		}
+	}
+	if s.opts.MaxDeviationPercent > 0 {
+		mid := (market.BidPrice + market.AskPrice) / 2
+		deviation := math.Abs(price-mid) / mid * 100
+		if deviation > s.opts.MaxDeviationPercent {
+			return fmt.Errorf("price %s is %.2f%% from the mid price %s, more than %g%%",
+				s.pair.FormatPrice(price), deviation, s.pair.FormatPrice(mid), s.opts.MaxDeviationPercent)
+		}
+	}
+	return nil
+}
+
+// checkTradable refuses new orders while the pair doesn't accept them
+func (s *Session) checkTradable() error {
+	status, err := kraken.GetTradingStatus(s.ctx, s.pair)
+	if err != nil {
+		return err
+	}
+	if !kraken.EntriesAllowed(status) {
+		return fmt.Errorf("%s doesn't accept new orders (status %s)", s.pair.WSName, status)
+	}
+	return nil
+}
+
+// checkFunds refuses an order the available balance can't cover
+func (s *Session) checkFunds(isBuy bool, price float64, volume float64) error {
+	balanceBody, err := kraken.GetAccountBalance(s.ctx)
+	if err != nil {
+		return err
+	}
+	balances, err := kraken.GetAllBalances(balanceBody)
+	if err != nil {
+		return err
+	}
+
+	asset, need := s.pair.Quote, price*volume
+	if !isBuy {
+		asset, need = s.pair.Base, volume
+	}
+	balance, err := kraken.GetBalance(balances, asset)
+	if err != nil {
+		return err
+	}
+	if balance.Available < need {
+		return fmt.Errorf("insufficient %s balance: have %g, need %g", balance.Asset, balance.Available, need)
+	}
+	return nil
+}
+
+// Place validates and places a limit order, journaling it
+func (s *Session) Place(isBuy bool, price float64, volume float64, market *kraken.SpreadInfo) (*Order, error) {
+	if err := s.Validate(isBuy, price, volume, market); err != nil {
+		return nil, err
+	}
+	if err := s.checkTradable(); err != nil {
+		return nil, err
+	}
+	if err := s.checkFunds(isBuy, price, volume); err != nil {
+		return nil, err
+	}
+
+	txId, err := kraken.PlaceLimitOrder(s.ctx, s.pair, price, volume, isBuy, false, kraken.UserRef(s.tradeID))
+	if err != nil {
+		return nil, err
+	}
+	order := &Order{
+		TxID:   txId,
+		Side:   side(isBuy),
+		Price:  s.pair.RoundPrice(price),
+		Volume: s.pair.RoundVolume(volume),
+		Status: "open",
+	}
+	s.orders = append(s.orders, order)
+	logging.FromContext(s.ctx).Info("Placed manual order", "txid", txId, "side", order.Side,
+		"price", s.pair.FormatPrice(order.Price), "volume", s.pair.FormatVolume(order.Volume))
+	s.journalOrder(order)
+	return order, nil
+}
+
+// Edit moves an open order to a new price. Kraken replaces the order, the returned order has the
+// new transaction ID. Partially filled orders can't be edited.
+func (s *Session) Edit(order *Order, price float64, market *kraken.SpreadInfo) (*Order, error) {
+	if !order.Open() {
+		return nil, fmt.Errorf("order %s is %s", order.TxID, order.Status)
+	}
+	if order.VolExec > 0 {
+		return nil, fmt.Errorf("order %s is partially filled and can't be edited", order.TxID)
+	}
+	if err := s.Validate(order.Side == "buy", price, order.Volume, market); err != nil {
+		return nil, err
+	}
+
+	newTxId, err := kraken.EditOrder(s.ctx, s.pair, order.TxID, price)
+	if err != nil {
+		return nil, err
+	}
+	edited := &Order{
+		TxID:   newTxId,
+		Side:   order.Side,
+		Price:  s.pair.RoundPrice(price),
+		Volume: order.Volume,
+		Status: "open",
+	}
+	order.Status = "canceled"
+	for i, o := range s.orders {
+		if o == order {
+			s.orders[i] = edited
+		}
+	}
+	logging.FromContext(s.ctx).Info("Edited manual order", "old_txid", order.TxID, "new_txid", newTxId, "side", order.Side,
+		"old_price", s.pair.FormatPrice(order.Price), "new_price", s.pair.FormatPrice(edited.Price))
+	s.journalOrder(edited)
+	return edited, nil
+}
+
+// Cancel cancels an open order and records its final state
+func (s *Session) Cancel(order *Order) error {
+	if !order.Open() {
+		return fmt.Errorf("order %s is %s", order.TxID, order.Status)
+	}
+	if err := kraken.CancelOrder(s.ctx, order.TxID); err != nil {
+		return err
+	}
+	logging.FromContext(s.ctx).Info("Canceled manual order", "txid", order.TxID, "side", order.Side)
+	_, err := s.update(order)
+	return err
+}
+
+// Refresh updates the open orders from the exchange, journaling every change. It returns the
+// orders that changed.
+func (s *Session) Refresh() ([]*Order, error) {
+	var changed []*Order
+	for _, order := range s.OpenOrders() {
+		ok, err := s.update(order)
+		if err != nil {
+			return changed, err
+		}
+		if ok {
+			changed = append(changed, order)
+		}
+	}
+	return changed, nil
+}
+
+// update reads an order's state, journaling it if it changed
+func (s *Session) update(order *Order) (bool, error) {
+	status, err := kraken.CheckOrderStatus(s.ctx, order.TxID)
+	if err != nil {
+		return false, err
+	}
+	volExec := kraken.ParseFloat(status.VolExec)
+	if status.Status == order.Status && volExec == order.VolExec {
+		return false, nil
+	}
+	order.Status = status.Status
+	order.VolExec = volExec
+	order.Cost = kraken.ParseFloat(status.Cost)
+	order.Fee = kraken.ParseFloat(status.Fee)
+
+	if s.journal != nil {
+		fill := store.Fill{
+			TxID:       order.TxID,
+			Status:     order.Status,
+			Price:      kraken.ParseFloat(status.Descr.Price),
+			VolExec:    order.VolExec,
+			Cost:       order.Cost,
+			Fee:        order.Fee,
+			ObservedAt: time.Now(),
+		}
+		if err := s.journal.RecordFill(fill); err != nil {
+			logging.FromContext(s.ctx).Warn("Failed to record fill in journal", "txid", order.TxID, "error", err)
+		}
+	}
+	return true, nil
+}
+
+// journalOrder records an order, starting the session's trade with the first one
+func (s *Session) journalOrder(order *Order) {
+	if s.journal == nil {
+		return
+	}
+	log := logging.FromContext(s.ctx)
+	if !s.started {
+		// A session trades any volume on either side, the trade carries none
+		if err := s.journal.StartTrade(store.Trade{ID: s.tradeID, Pair: kraken.PairName(s.coin), StartedAt: time.Now()}); err != nil {
+			log.Warn("Failed to record trade in journal", "error", err)
+			return
+		}
+		s.started = true
+	}
+	if err := s.journal.RecordOrder(store.Order{TxID: order.TxID, TradeID: s.tradeID, Side: order.Side, Volume: order.Volume, PlacedAt: time.Now()}); err != nil {
+		log.Warn("Failed to record order in journal", "txid", order.TxID, "error", err)
+	}
+}
+
+// Finish journals the end of the session with the fees paid. Orders still open are left on the
+// exchange.
+func (s *Session) Finish() {
+	if s.journal == nil || !s.started {
+		return
+	}
+	var fees float64
+	for _, order := range s.orders {
+		fees += order.Fee
+	}
+	if err := s.journal.FinishTrade(s.tradeID, store.TradeResult{Result: Result, Fees: fees, FinishedAt: time.Now()}); err != nil {
+		logging.FromContext(s.ctx).Warn("Failed to finish trade in journal", "error", err)
+	}
+}
+
+// side names the side of an order
+func side(isBuy bool) string {
+	if isBuy {
+		return "buy"
+	}
+	return "sell"
+}
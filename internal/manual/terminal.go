@@ -0,0 +1,100 @@
+package manual
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// Key codes the line editor handles
+const (
+	keyEnter     = '\n'
+	keyReturn    = '\r'
+	keyEscape    = 27
+	keyBackspace = 127
+	keyCtrlH     = 8
+)
+
+// RawMode switches the terminal on stdin to reading single keys without echo, keeping Ctrl-C
+// working. The returned function restores the previous mode. It fails if stdin isn't a terminal,
+// keys are then read line by line.
+func RawMode() (func(), error) {
+	saved, err := stty("-g")
+	if err != nil {
+		return nil, err
+	}
+	if _, err := stty("-icanon", "-echo", "min", "1"); err != nil {
+		return nil, err
+	}
+	return func() { stty(strings.TrimSpace(saved)) }, nil
+}
+
+// stty runs stty on the terminal of stdin
+func stty(args ...string) (string, error) {
+	cmd := exec.Command("stty", args...)
+	cmd.Stdin = os.Stdin
+	out, err := cmd.Output()
+	return string(out), err
+}
+
+// Keys reads keys from r until it fails or the context is canceled
+func Keys(ctx context.Context, r io.Reader) <-chan byte {
+	keys := make(chan byte)
+	go func() {
+		defer close(keys)
+		reader := bufio.NewReader(r)
+		for {
+			key, err := reader.ReadByte()
+			if err != nil {
+				return
+			}
+			select {
+			case keys <- key:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return keys
+}
+
+// ReadLine reads a line of input from keys, echoing it to w. Enter submits, Escape aborts. It
+// returns false if the input was aborted, ended or the context was canceled.
+func ReadLine(ctx context.Context, keys <-chan byte, w io.Writer, prompt string) (string, bool) {
+	io.WriteString(w, prompt)
+	var line []byte
+	for {
+		var key byte
+		select {
+		case <-ctx.Done():
+			io.WriteString(w, "\n")
+			return "", false
+		case k, ok := <-keys:
+			if !ok {
+				return "", false
+			}
+			key = k
+		}
+		switch key {
+		case keyEnter, keyReturn:
+			io.WriteString(w, "\n")
+			return string(line), true
+		case keyEscape:
+			io.WriteString(w, "\n")
+			return "", false
+		case keyBackspace, keyCtrlH:
+			if len(line) > 0 {
+				line = line[:len(line)-1]
+				io.WriteString(w, "\b \b")
+			}
+		default:
+			if key >= ' ' && key < keyBackspace {
+				line = append(line, key)
+				w.Write([]byte{key})
+			}
+		}
+	}
+}
@@ -0,0 +1,174 @@
+// Package marketcache keeps the market data fetched from Kraken on disk: 1-minute candles and
+// bid/ask snapshots per coin. Indicators with lookback windows start warm after a restart
+// instead of being limited to what Kraken serves (720 candles, a few hours of spreads), and the
+// history grows past it with every run.
+package marketcache
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jkosik/crypto-trader/internal/kraken"
+)
+
+// candle is a cached 1-minute candle
+type candle struct {
+	Time   int64   `json:"t"`
+	Open   float64 `json:"o"`
+	High   float64 `json:"h"`
+	Low    float64 `json:"l"`
+	Close  float64 `json:"c"`
+	Volume float64 `json:"v"`
+}
+
+// quote is a cached bid/ask snapshot
+type quote struct {
+	Time time.Time `json:"t"`
+	Bid  float64   `json:"b"`
+	Ask  float64   `json:"a"`
+}
+
+// Cache is the market history of one coin, kept for a retention period
+type Cache struct {
+	path      string
+	retention time.Duration
+	candles   []kraken.OHLCData
+	spreads   []kraken.SpreadSnapshot
+}
+
+// file is the persisted form of a cache
+type file struct {
+	Candles []candle `json:"candles"`
+	Spreads []quote  `json:"spreads"`
+}
+
+// Path returns the cache file of a coin in dir
+func Path(dir string, coin string) string {
+	return filepath.Join(dir, strings.ToUpper(coin)+".json")
+}
+
+// Open loads the cached history of a coin from dir, an empty cache if there is none yet.
+// Data older than retention is dropped on save.
+func Open(dir string, coin string, retention time.Duration) (*Cache, error) {
+	c := &Cache{path: Path(dir, coin), retention: retention}
+	data, err := os.ReadFile(c.path)
+	if os.IsNotExist(err) {
+		return c, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading market cache: %v", err)
+	}
+
+	var f file
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("error parsing market cache %s: %v", c.path, err)
+	}
+	for _, k := range f.Candles {
+		c.candles = append(c.candles, kraken.OHLCData{Time: k.Time, Open: k.Open, High: k.High, Low: k.Low, Close: k.Close, Volume: k.Volume})
+	}
+	for _, q := range f.Spreads {
+		c.spreads = append(c.spreads, kraken.SpreadSnapshot{Time: q.Time, Bid: q.Bid, Ask: q.Ask})
+	}
+	return c, nil
+}
+
+// Candles returns the cached candles, oldest first
+func (c *Cache) Candles() []kraken.OHLCData {
+	return c.candles
+}
+
+// Spreads returns the cached bid/ask snapshots, oldest first
+func (c *Cache) Spreads() []kraken.SpreadSnapshot {
+	return c.spreads
+}
+
+// Span returns the time covered by the cached candles
+func (c *Cache) Span() time.Duration {
+	if len(c.candles) == 0 {
+		return 0
+	}
+	return time.Duration(c.candles[len(c.candles)-1].Time-c.candles[0].Time)*time.Second + time.Minute
+}
+
+// AddCandles merges fetched candles into the cache and returns the whole history, oldest first.
+// Fetched candles replace cached ones of the same minute, the last one may have been in progress.
+func (c *Cache) AddCandles(candles []kraken.OHLCData) []kraken.OHLCData {
+	byTime := make(map[int64]kraken.OHLCData, len(c.candles)+len(candles))
+	for _, k := range c.candles {
+		byTime[k.Time] = k
+	}
+	for _, k := range candles {
+		byTime[k.Time] = k
+	}
+	merged := make([]kraken.OHLCData, 0, len(byTime))
+	for _, k := range byTime {
+		merged = append(merged, k)
+	}
+	sort.Slice(merged, func(i, j int) bool { return merged[i].Time < merged[j].Time })
+	c.candles = merged
+	return c.candles
+}
+
+// AddSpreads merges fetched bid/ask snapshots into the cache and returns the whole history,
+// oldest first
+func (c *Cache) AddSpreads(spreads []kraken.SpreadSnapshot) []kraken.SpreadSnapshot {
+	byTime := make(map[int64]kraken.SpreadSnapshot, len(c.spreads)+len(spreads))
+	for _, s := range c.spreads {
+		byTime[s.Time.UnixNano()] = s
+	}
+	for _, s := range spreads {
+		byTime[s.Time.UnixNano()] = s
+	}
+	merged := make([]kraken.SpreadSnapshot, 0, len(byTime))
+	for _, s := range byTime {
+		merged = append(merged, s)
+	}
+	sort.Slice(merged, func(i, j int) bool { return merged[i].Time.Before(merged[j].Time) })
+	c.spreads = merged
+	return c.spreads
+}
+
+// prune drops data older than the retention period
+func (c *Cache) prune(now time.Time) {
+	cutoff := now.Add(-c.retention)
+	first := sort.Search(len(c.candles), func(i int) bool { return c.candles[i].Time >= cutoff.Unix() })
+	c.candles = c.candles[first:]
+	first = sort.Search(len(c.spreads), func(i int) bool { return !c.spreads[i].Time.Before(cutoff) })
+	c.spreads = c.spreads[first:]
+}
+
+// Save drops data past the retention period and writes the cache atomically
+func (c *Cache) Save() error {
+	c.prune(time.Now())
+
+	f := file{Candles: make([]candle, 0, len(c.candles)), Spreads: make([]quote, 0, len(c.spreads))}
+	for _, k := range c.candles {
+		f.Candles = append(f.Candles, candle{Time: k.Time, Open: k.Open, High: k.High, Low: k.Low, Close: k.Close, Volume: k.Volume})
+	}
+	for _, s := range c.spreads {
+		f.Spreads = append(f.Spreads, quote{Time: s.Time, Bid: s.Bid, Ask: s.Ask})
+	}
+	data, err := json.Marshal(f)
+	if err != nil {
+		return fmt.Errorf("error encoding market cache: %v", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(c.path), 0700); err != nil {
+		return fmt.Errorf("error creating market cache directory: %v", err)
+	}
+
+	// Concurrent runs of the same coin replace the file whole, the last writer wins
+	tmp := fmt.Sprintf("%s.%d.tmp", c.path, os.Getpid())
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("error writing market cache: %v", err)
+	}
+	if err := os.Rename(tmp, c.path); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("error writing market cache: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,141 @@
+// Package money rounds and formats currency amounts for the journal, reports and notifications.
+// Amounts are rounded to their currency's display precision when they are recorded or summed,
+// so totals always equal the sum of the lines they are built from.
+package money
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Rounding is a rounding mode
+type Rounding string
+
+// Rounding modes
+const (
+	HalfEven Rounding = "half_even" // ties to the even digit (banker's rounding), unbiased over many amounts
+	HalfUp   Rounding = "half_up"   // ties away from zero
+	Down     Rounding = "down"      // towards zero, never overstates an amount
+)
+
+// Policy sets how amounts are rounded and how many decimals each currency is shown with
+type Policy struct {
+	Rounding  Rounding       `yaml:"rounding"`
+	Precision map[string]int `yaml:"precision"` // decimals by currency code, e.g. USD: 2
+}
+
+// DefaultPrecision is used for currencies the policy doesn't list, e.g. crypto assets
+const DefaultPrecision = 8
+
+// Default is the built-in policy: fiat to the cent with banker's rounding
+func Default() Policy {
+	return Policy{
+		Rounding:  HalfEven,
+		Precision: map[string]int{"USD": 2, "EUR": 2, "GBP": 2, "CAD": 2, "CHF": 2, "AUD": 2, "JPY": 0},
+	}
+}
+
+var (
+	mu     sync.RWMutex
+	policy = Default()
+)
+
+// Validate checks the rounding mode and precisions
+func (p Policy) Validate() error {
+	switch p.Rounding {
+	case HalfEven, HalfUp, Down:
+	default:
+		return fmt.Errorf("rounding must be half_even, half_up or down, got %q", p.Rounding)
+	}
+	for currency, decimals := range p.Precision {
+		if decimals < 0 || decimals > 12 {
+			return fmt.Errorf("precision of %s must be between 0 and 12, got %d", currency, decimals)
+		}
+	}
+	return nil
+}
+
+// SetPolicy makes p the process-wide policy. Currencies p doesn't list keep their default precision.
+func SetPolicy(p Policy) error {
+	if err := p.Validate(); err != nil {
+		return err
+	}
+	merged := Default()
+	merged.Rounding = p.Rounding
+	for currency, decimals := range p.Precision {
+		merged.Precision[strings.ToUpper(currency)] = decimals
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	policy = merged
+	return nil
+}
+
+// Precision returns the display decimals of a currency. Kraken's fiat asset codes (ZUSD, ZEUR)
+// share the precision of the plain code.
+func Precision(currency string) int {
+	currency = strings.ToUpper(currency)
+	mu.RLock()
+	defer mu.RUnlock()
+	if decimals, ok := policy.Precision[currency]; ok {
+		return decimals
+	}
+	if len(currency) == 4 && currency[0] == 'Z' {
+		if decimals, ok := policy.Precision[currency[1:]]; ok {
+			return decimals
+		}
+	}
+	return DefaultPrecision
+}
+
+// Round rounds an amount to the precision of its currency with the policy's rounding mode
+func Round(amount float64, currency string) float64 {
+	mu.RLock()
+	rounding := policy.Rounding
+	mu.RUnlock()
+
+	multiplier := math.Pow10(Precision(currency))
+	// Drop binary noise first, 1.005 is stored as 1.00499999... and must round like 1.005
+	scaled := math.Round(amount*multiplier*1e6) / 1e6
+	switch rounding {
+	case HalfUp:
+		scaled = math.Round(scaled)
+	case Down:
+		scaled = math.Trunc(scaled)
+	default:
+		scaled = math.RoundToEven(scaled)
+	}
+	rounded := scaled / multiplier
+	if rounded == 0 {
+		// No negative zero in reports
+		return 0
+	}
+	return rounded
+}
+
+// Sum rounds each amount and returns their rounded total
+func Sum(currency string, amounts ...float64) float64 {
+	var total float64
+	for _, amount := range amounts {
+		total += Round(amount, currency)
+	}
+	return Round(total, currency)
+}
+
+// Format rounds an amount and formats it with the precision of its currency, without the code
+func Format(amount float64, currency string) string {
+	return strconv.FormatFloat(Round(amount, currency), 'f', Precision(currency), 64)
+}
+
+// FormatSigned is Format with an explicit + for positive amounts, for changes and deltas
+func FormatSigned(amount float64, currency string) string {
+	formatted := Format(amount, currency)
+	if Round(amount, currency) > 0 {
+		return "+" + formatted
+	}
+	return formatted
+}
@@ -0,0 +1,129 @@
+// Package numparse parses numbers typed by users in any common locale: "0.5", "0,5",
+// "1,234.5", "1.234,5", "1 234,5" or "1'234.5".
+package numparse
+
+import (
+	"flag"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Parse parses a decimal number with either a comma or a dot as decimal separator and
+// optional thousands separators (comma, dot, space, apostrophe or underscore).
+// Inputs that read differently in different locales, like "1,000", are rejected rather than guessed.
+func Parse(s string) (float64, error) {
+	normalized, err := Normalize(s)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseFloat(normalized, 64)
+}
+
+// Normalize rewrites a localized number to the form accepted by strconv.ParseFloat
+func Normalize(s string) (string, error) {
+	s = strings.TrimSpace(s)
+
+	// Unambiguous thousands separators
+	s = strings.NewReplacer(" ", "", " ", "", " ", "", "'", "", "_", "").Replace(s)
+	if s == "" {
+		return "", fmt.Errorf("empty number")
+	}
+
+	// Exponents and special values are left to strconv
+	if strings.ContainsAny(s, "eEnNiI") && !strings.Contains(s, ",") {
+		return s, nil
+	}
+
+	commas := strings.Count(s, ",")
+	dots := strings.Count(s, ".")
+
+	var decimal, thousands string
+	switch {
+	case commas == 0 && dots == 0:
+		return s, nil
+	case commas > 0 && dots > 0:
+		// The separator used last is the decimal one
+		if strings.LastIndex(s, ",") > strings.LastIndex(s, ".") {
+			decimal, thousands = ",", "."
+		} else {
+			decimal, thousands = ".", ","
+		}
+	case dots > 1:
+		thousands = "."
+	case commas > 1:
+		thousands = ","
+	case dots == 1:
+		// "1.000" has always meant one here, keep it that way
+		decimal = "."
+	default:
+		// A single comma: "0,5" is a decimal, "1,000" could be one or a thousand
+		integer, fraction, _ := strings.Cut(s, ",")
+		integer = strings.TrimLeft(integer, "+-")
+		if len(fraction) == 3 && integer != "" && strings.Trim(integer, "0") != "" {
+			return "", fmt.Errorf("ambiguous number %q: use %s or %s", s, integer+"."+fraction, integer+fraction)
+		}
+		decimal = ","
+	}
+
+	if decimal != "" && strings.Count(s, decimal) > 1 {
+		return "", fmt.Errorf("invalid number %q: more than one decimal separator", s)
+	}
+	integer, fraction, hasFraction := s, "", false
+	if decimal != "" {
+		integer, fraction, hasFraction = strings.Cut(s, decimal)
+	}
+
+	if thousands != "" {
+		groups := strings.Split(integer, thousands)
+		first := strings.TrimLeft(groups[0], "+-")
+		if len(first) == 0 || len(first) > 3 {
+			return "", fmt.Errorf("invalid number %q: misplaced thousands separator", s)
+		}
+		for _, g := range groups[1:] {
+			if len(g) != 3 {
+				return "", fmt.Errorf("invalid number %q: misplaced thousands separator", s)
+			}
+		}
+		integer = strings.Join(groups, "")
+	}
+
+	if hasFraction {
+		return integer + "." + fraction, nil
+	}
+	return integer, nil
+}
+
+// Float is a flag.Value accepting localized numbers
+type Float float64
+
+// String returns the value in canonical form
+func (f *Float) String() string {
+	if f == nil {
+		return "0"
+	}
+	return strconv.FormatFloat(float64(*f), 'f', -1, 64)
+}
+
+// Set parses a localized number
+func (f *Float) Set(s string) error {
+	v, err := Parse(s)
+	if err != nil {
+		return err
+	}
+	*f = Float(v)
+	return nil
+}
+
+// FloatVar defines a float flag on the command line accepting localized numbers
+func FloatVar(p *float64, name string, value float64, usage string) {
+	*p = value
+	flag.Var((*Float)(p), name, usage)
+}
+
+// FloatFlag is like flag.Float64 but accepts localized numbers
+func FloatFlag(name string, value float64, usage string) *float64 {
+	p := new(float64)
+	FloatVar(p, name, value, usage)
+	return p
+}
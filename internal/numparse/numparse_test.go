@@ -0,0 +1,87 @@
+package numparse
+
+import (
+	"flag"
+	"io"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    float64
+		wantErr bool
+	}{
+		{"0.5", 0.5, false},
+		{"0,5", 0.5, false},
+		{"1.234,5", 1234.5, false},
+		{"1,234.5", 1234.5, false},
+		{"1 234,5", 1234.5, false},
+		{"1\u00a0234,5", 1234.5, false},
+		{"1\u202f234,5", 1234.5, false},
+		{"1'234.5", 1234.5, false},
+		{"1_000", 1000, false},
+		{"1,234,567.89", 1234567.89, false},
+		{"1.234.567", 1234567, false},
+		{"1.000", 1, false},
+		{"-0,500", -0.5, false},
+		{"0,000", 0, false},
+		{"+12,75", 12.75, false},
+		{"  300  ", 300, false},
+		{".5", 0.5, false},
+		{"1e-3", 0.001, false},
+		{"1.5E2", 150, false},
+		{"-2e3", -2000, false},
+
+		// "1,000" is a thousand in some locales and one in others
+		{"1,000", 0, true},
+		{"-12,345", 0, true},
+
+		// Misplaced groups
+		{"1,23,456", 0, true},
+		{"12.34.567", 0, true},
+		{"1234.567,8", 0, true},
+		{"1.234.56", 0, true},
+		{",5.000", 0, true},
+		{"1.234,5,6", 0, true},
+
+		{"", 0, true},
+		{"  ", 0, true},
+		{"abc", 0, true},
+		{"1,5x", 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := Parse(tt.in)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("Parse(%q) = %v, want an error", tt.in, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Parse(%q): %v", tt.in, err)
+			}
+			if got != tt.want {
+				t.Errorf("Parse(%q) = %v, want %v", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFloatFlag(t *testing.T) {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	volume := 1.0
+	fs.Var((*Float)(&volume), "volume", "")
+
+	if err := fs.Parse([]string{"-volume", "1.234,5"}); err != nil || volume != 1234.5 {
+		t.Errorf("-volume 1.234,5 = %v, %v, want 1234.5", volume, err)
+	}
+	if err := fs.Parse([]string{"-volume", "1,000"}); err == nil {
+		t.Errorf("-volume 1,000 was accepted as %v", volume)
+	}
+	if got := (*Float)(&volume).String(); got != "1234.5" {
+		t.Errorf("String() = %s, want 1234.5", got)
+	}
+}
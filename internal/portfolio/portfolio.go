@@ -0,0 +1,160 @@
+// Package portfolio values the account's balances in USD for cmd/portfolio. Prices are the bids
+// of the assets' USD pairs, or of their XBT pairs converted at the XBT/USD bid.
+package portfolio
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jkosik/crypto-trader/internal/kraken"
+)
+
+// Holding is the valuation of one balance
+type Holding struct {
+	Asset      string  // BalanceEx code, e.g. XXBT, ZUSD or DOT.S
+	Name       string  // asset the price is of, e.g. XBT for XXBT and XBT.F
+	Amount     float64 // total balance, including amounts held by open orders
+	PriceUSD   float64
+	ValueUSD   float64
+	Allocation float64 // percentage of the total value
+	Priced     bool    // false when the asset has no USD or XBT pair
+}
+
+// Valuation is the value of the whole account
+type Valuation struct {
+	Time     time.Time
+	Holdings []Holding // highest value first, unpriced holdings last
+	TotalUSD float64
+}
+
+// Unpriced returns the holdings without a price, they are left out of the total
+func (v *Valuation) Unpriced() []Holding {
+	var unpriced []Holding
+	for _, h := range v.Holdings {
+		if !h.Priced {
+			unpriced = append(unpriced, h)
+		}
+	}
+	return unpriced
+}
+
+// Value prices every non-zero balance with the current tickers of all pairs
+func Value(ctx context.Context, balances map[string]kraken.Balance) (*Valuation, error) {
+	pairs, err := kraken.LoadAssetPairs(ctx)
+	if err != nil {
+		return nil, err
+	}
+	tops, err := kraken.GetBookTops(ctx)
+	if err != nil {
+		return nil, err
+	}
+	prices := &pricer{pairs: pairs, tops: tops}
+
+	valuation := &Valuation{Time: time.Now()}
+	for code, balance := range balances {
+		if balance.Total == 0 {
+			continue
+		}
+		name := prices.name(code)
+		price, ok := prices.usd(name)
+		holding := Holding{Asset: code, Name: name, Amount: balance.Total, PriceUSD: price, Priced: ok}
+		if ok {
+			holding.ValueUSD = balance.Total * price
+			valuation.TotalUSD += holding.ValueUSD
+		}
+		valuation.Holdings = append(valuation.Holdings, holding)
+	}
+
+	for i := range valuation.Holdings {
+		if valuation.TotalUSD > 0 {
+			valuation.Holdings[i].Allocation = valuation.Holdings[i].ValueUSD / valuation.TotalUSD * 100
+		}
+	}
+	sort.Slice(valuation.Holdings, func(i, j int) bool {
+		a, b := valuation.Holdings[i], valuation.Holdings[j]
+		if a.Priced != b.Priced {
+			return a.Priced
+		}
+		if a.ValueUSD != b.ValueUSD {
+			return a.ValueUSD > b.ValueUSD
+		}
+		return a.Asset < b.Asset
+	})
+	return valuation, nil
+}
+
+// pricer looks up USD prices in the tickers of all pairs
+type pricer struct {
+	pairs map[string]*kraken.AssetPair
+	tops  map[string]kraken.BookTop
+}
+
+// name resolves a BalanceEx code to the altname its pairs use. Staked, bonded and rewards
+// variants (DOT.S, XBT.F, ETH2.S) are priced like the asset itself.
+func (p *pricer) name(code string) string {
+	asset, _, _ := strings.Cut(code, ".")
+	for _, pair := range p.pairs {
+		// Dark pool pairs lack the WebSocket name the altnames come from
+		if kraken.IsDarkPoolPair(pair.Altname) {
+			continue
+		}
+		if pair.Base == asset {
+			return pair.BaseAltname()
+		}
+		if pair.Quote == asset {
+			return pair.QuoteAltname()
+		}
+	}
+	return asset
+}
+
+// usd returns the USD price of an asset: the bid of its USD pair, the inverse ask of a USD/asset
+// pair (e.g. USD/JPY), or the bid of its XBT pair at the XBT/USD bid
+func (p *pricer) usd(name string) (float64, bool) {
+	if name == "USD" {
+		return 1, true
+	}
+	if bid, ok := p.bid(name, "USD"); ok {
+		return bid, true
+	}
+	if ask, ok := p.ask("USD", name); ok {
+		return 1 / ask, true
+	}
+	if name == "XBT" {
+		return 0, false
+	}
+	if inXBT, ok := p.bid(name, "XBT"); ok {
+		if xbt, ok := p.bid("XBT", "USD"); ok {
+			return inXBT * xbt, true
+		}
+	}
+	return 0, false
+}
+
+// bid returns the best bid of the base/quote pair
+func (p *pricer) bid(base string, quote string) (float64, bool) {
+	top, ok := p.top(base, quote)
+	return top.Bid, ok
+}
+
+// ask returns the best ask of the base/quote pair
+func (p *pricer) ask(base string, quote string) (float64, bool) {
+	top, ok := p.top(base, quote)
+	return top.Ask, ok
+}
+
+// top returns the ticker of the lit base/quote pair
+func (p *pricer) top(base string, quote string) (kraken.BookTop, bool) {
+	for name, pair := range p.pairs {
+		if kraken.IsDarkPoolPair(pair.Altname) || pair.BaseAltname() != base || pair.QuoteAltname() != quote {
+			continue
+		}
+		top, ok := p.tops[name]
+		if ok && top.Bid > 0 && top.Ask > 0 {
+			return top, true
+		}
+	}
+	return kraken.BookTop{}, false
+}
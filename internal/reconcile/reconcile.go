@@ -0,0 +1,84 @@
+// Package reconcile compares the orders the exchange closed with the trade journal, so orders the
+// bot doesn't know about (e.g. placed during a crash window, or by hand) and orders whose final
+// state the journal missed are flagged.
+package reconcile
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/jkosik/crypto-trader/internal/kraken"
+	"github.com/jkosik/crypto-trader/internal/store"
+)
+
+// Kinds of discrepancies
+const (
+	Unknown = "unknown" // closed on the exchange, not in the journal
+	Status  = "status"  // the journal holds another status than the exchange's final one
+	Fill    = "fill"    // the journal holds another executed volume than the exchange
+)
+
+// Discrepancy is a closed order the journal disagrees with
+type Discrepancy struct {
+	Kind    string
+	Order   kraken.ClosedOrder
+	Journal *store.OrderRecord // nil for unknown orders
+}
+
+// String describes the discrepancy
+func (d Discrepancy) String() string {
+	switch d.Kind {
+	case Unknown:
+		return fmt.Sprintf("%s %s not in the journal: %s, %s, executed %s", d.Order.TxID, d.Order.Status, d.Order.Descr.Order,
+			d.Order.Closed().UTC().Format(time.RFC3339), d.Order.VolExec)
+	case Status:
+		return fmt.Sprintf("%s journaled as %s, %s on the exchange (trade %s)", d.Order.TxID, d.Journal.Status, d.Order.Status, d.Journal.TradeID)
+	default:
+		return fmt.Sprintf("%s journaled with %g executed, %s on the exchange (trade %s)", d.Order.TxID, d.Journal.VolExec, d.Order.VolExec, d.Journal.TradeID)
+	}
+}
+
+// Report is the outcome of a reconciliation
+type Report struct {
+	Start         time.Time
+	End           time.Time
+	Orders        int // closed on the exchange in [Start, End)
+	Journaled     int // of them found in the journal
+	Discrepancies []Discrepancy
+}
+
+// Run compares the orders the exchange closed in [start, end) with the journal
+func Run(ctx context.Context, journal *store.Store, start time.Time, end time.Time) (*Report, error) {
+	orders, err := kraken.GetClosedOrders(ctx, start, end)
+	if err != nil {
+		return nil, fmt.Errorf("error getting closed orders: %v", err)
+	}
+
+	report := &Report{Start: start, End: end}
+	for _, order := range orders {
+		// Kraken's end is inclusive, the day after starts at end
+		if closed := order.Closed(); closed.Before(start) || !closed.Before(end) {
+			continue
+		}
+		report.Orders++
+		journaled, err := journal.Order(order.TxID)
+		if err != nil {
+			return nil, err
+		}
+		if journaled == nil {
+			report.Discrepancies = append(report.Discrepancies, Discrepancy{Kind: Unknown, Order: order})
+			continue
+		}
+		report.Journaled++
+		volExec := kraken.ParseFloat(order.VolExec)
+		switch {
+		case journaled.Status != order.Status:
+			report.Discrepancies = append(report.Discrepancies, Discrepancy{Kind: Status, Order: order, Journal: journaled})
+		case math.Abs(journaled.VolExec-volExec) > 1e-9*math.Max(1, volExec):
+			report.Discrepancies = append(report.Discrepancies, Discrepancy{Kind: Fill, Order: order, Journal: journaled})
+		}
+	}
+	return report, nil
+}
@@ -0,0 +1,189 @@
+// Package redact scrubs secrets (API keys, request signatures, webhook URLs) from log records,
+// error strings, session recordings and panic traces. Secret values are registered once at
+// startup, well-known secret shapes are also caught by pattern.
+package redact
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"regexp"
+	"runtime/debug"
+	"strings"
+	"sync"
+)
+
+// Placeholder replaces every redacted secret
+const Placeholder = "[REDACTED]"
+
+// minSecretLength keeps short values (empty or placeholder env vars) from redacting common text
+const minSecretLength = 8
+
+// SecretEnv are the environment variables holding secrets, registered by RegisterEnv
+var SecretEnv = []string{"KRAKEN_API_KEY", "KRAKEN_PRIVATE_KEY", "SLACK_WEBHOOK"}
+
+// patterns catch secrets by shape, even if they were never registered
+var patterns = []struct {
+	re          *regexp.Regexp
+	replacement string
+}{
+	// Slack incoming webhook paths are the credential
+	{regexp.MustCompile(`(https://hooks\.slack\.com/)[A-Za-z0-9/_\-]+`), "${1}" + Placeholder},
+	// Kraken auth headers as they appear in dumped requests
+	{regexp.MustCompile(`(?i)(api-key|api-sign)(["']?\s*[:=]\s*["']?)[A-Za-z0-9+/=_\-]+`), "${1}${2}" + Placeholder},
+}
+
+var (
+	mu      sync.RWMutex
+	secrets []string
+)
+
+// The secrets of the environment are known before anything can log or fail
+func init() {
+	RegisterEnv()
+}
+
+// Register adds secret values to redact. Values shorter than 8 characters are ignored.
+func Register(values ...string) {
+	mu.Lock()
+	defer mu.Unlock()
+	for _, value := range values {
+		value = strings.TrimSpace(value)
+		if len(value) < minSecretLength {
+			continue
+		}
+		secrets = append(secrets, value)
+	}
+}
+
+// RegisterEnv registers the values of the SecretEnv environment variables
+func RegisterEnv() {
+	for _, name := range SecretEnv {
+		Register(os.Getenv(name))
+	}
+}
+
+// String returns s with all registered and pattern-matched secrets replaced by Placeholder
+func String(s string) string {
+	mu.RLock()
+	for _, secret := range secrets {
+		s = strings.ReplaceAll(s, secret, Placeholder)
+	}
+	mu.RUnlock()
+	for _, p := range patterns {
+		s = p.re.ReplaceAllString(s, p.replacement)
+	}
+	return s
+}
+
+// redactedError carries a scrubbed message while keeping the original error for errors.Is/As
+type redactedError struct {
+	msg string
+	err error
+}
+
+func (e *redactedError) Error() string { return e.msg }
+func (e *redactedError) Unwrap() error { return e.err }
+
+// Error returns err with a scrubbed message, or nil
+func Error(err error) error {
+	if err == nil {
+		return nil
+	}
+	if _, ok := err.(*redactedError); ok {
+		return err
+	}
+	return &redactedError{msg: String(err.Error()), err: err}
+}
+
+// Handler wraps a slog handler so messages and attribute values are scrubbed before they're written
+func Handler(h slog.Handler) slog.Handler {
+	return &handler{next: h}
+}
+
+type handler struct {
+	next slog.Handler
+}
+
+func (h *handler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.next.Enabled(ctx, level)
+}
+
+func (h *handler) Handle(ctx context.Context, r slog.Record) error {
+	scrubbed := slog.NewRecord(r.Time, r.Level, String(r.Message), r.PC)
+	r.Attrs(func(a slog.Attr) bool {
+		scrubbed.AddAttrs(attr(a))
+		return true
+	})
+	return h.next.Handle(ctx, scrubbed)
+}
+
+func (h *handler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	scrubbed := make([]slog.Attr, len(attrs))
+	for i, a := range attrs {
+		scrubbed[i] = attr(a)
+	}
+	return &handler{next: h.next.WithAttrs(scrubbed)}
+}
+
+func (h *handler) WithGroup(name string) slog.Handler {
+	return &handler{next: h.next.WithGroup(name)}
+}
+
+// attr scrubs an attribute value. Values other than strings, errors and groups are formatted
+// first since maps and structs may carry secrets too; numbers, bools and times are kept as is.
+func attr(a slog.Attr) slog.Attr {
+	v := a.Value.Resolve()
+	switch v.Kind() {
+	case slog.KindString:
+		return slog.String(a.Key, String(v.String()))
+	case slog.KindGroup:
+		group := v.Group()
+		scrubbed := make([]interface{}, len(group))
+		for i, g := range group {
+			scrubbed[i] = attr(g)
+		}
+		return slog.Group(a.Key, scrubbed...)
+	case slog.KindAny:
+		if err, ok := v.Any().(error); ok {
+			return slog.String(a.Key, String(err.Error()))
+		}
+		formatted := fmt.Sprintf("%v", v.Any())
+		if scrubbed := String(formatted); scrubbed != formatted {
+			return slog.String(a.Key, scrubbed)
+		}
+		return slog.Attr{Key: a.Key, Value: v}
+	default:
+		return slog.Attr{Key: a.Key, Value: v}
+	}
+}
+
+// Writer scrubs everything written through it. Each Write must hold complete secrets, which
+// holds for writers emitting whole lines or JSON documents.
+func Writer(w io.Writer) io.Writer {
+	return &writer{next: w}
+}
+
+type writer struct {
+	next io.Writer
+}
+
+func (w *writer) Write(p []byte) (int, error) {
+	if _, err := io.WriteString(w.next, String(string(p))); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Panics recovers a panic, prints its scrubbed value and stack trace to stderr and exits with
+// code 2 like the runtime would. Defer it first thing in main.
+func Panics() {
+	value := recover()
+	if value == nil {
+		return
+	}
+	fmt.Fprintf(os.Stderr, "panic: %s\n\n%s", String(fmt.Sprint(value)), String(string(debug.Stack())))
+	os.Exit(2)
+}
@@ -0,0 +1,138 @@
+package redact_test
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/jkosik/crypto-trader/internal/kraken"
+	"github.com/jkosik/crypto-trader/internal/krakenfutures"
+	"github.com/jkosik/crypto-trader/internal/redact"
+)
+
+const (
+	apiKey     = "HkZ8sQ0uVnB3pKqW7eLr2yTcXa5dGf9mJt1oNi4UbEs6Rv"
+	privateKey = "kQH5HW/8p1uz8uH6Sx1CoLrqzRNVvKG3xuzxNx8jY4Nyx1nX3rbPTO3d4Nf1xU7yJ1wXZ9bM2k0sA=="
+)
+
+func TestString(t *testing.T) {
+	redact.Register(apiKey, privateKey)
+
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{"api key", "using key " + apiKey, "using key " + redact.Placeholder},
+		{"private key", "secret=" + privateKey + " rest", "secret=" + redact.Placeholder + " rest"},
+		{"api-sign header", `API-Sign: 4/dpxb3iT4tp/ZCVEwSnEsLxx0bqyhLpdfOpc6fn7OR8+UClSV5n9E6aSS8MPtnRfp32bAb0nmbRn6H8ndwLUQ==`, "API-Sign: " + redact.Placeholder},
+		{"api-key json", `{"API-Key": "unregistered-key_123"}`, `{"API-Key": "` + redact.Placeholder + `"}`},
+		{"slack webhook", "post https://hooks.slack.com/services/T000/B000/XXXX failed", "post https://hooks.slack.com/" + redact.Placeholder + " failed"},
+		{"no secret", "balance 12.5 USD", "balance 12.5 USD"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := redact.String(tt.in); got != tt.want {
+				t.Errorf("String(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRegisterIgnoresShortValues(t *testing.T) {
+	redact.Register("", "  ", "short")
+	if got := redact.String("a short note"); got != "a short note" {
+		t.Errorf("short value was redacted: %q", got)
+	}
+}
+
+func TestError(t *testing.T) {
+	redact.Register(apiKey)
+	cause := errors.New("dial tcp: timeout")
+	err := redact.Error(fmt.Errorf("error sending message to https://hooks.slack.com/services/T000/B000/XXXX with key %s: %w", apiKey, cause))
+
+	if strings.Contains(err.Error(), "T000/B000") || strings.Contains(err.Error(), apiKey) {
+		t.Errorf("secret left in error: %q", err)
+	}
+	if !errors.Is(err, cause) {
+		t.Error("redacted error lost its cause")
+	}
+	if redact.Error(err) != err {
+		t.Error("redacting twice wrapped the error again")
+	}
+	if redact.Error(nil) != nil {
+		t.Error("Error(nil) is not nil")
+	}
+}
+
+// Session recordings are written line by line through redact.String
+func TestWriterSessionRecording(t *testing.T) {
+	redact.Register(apiKey)
+	var buf bytes.Buffer
+	w := redact.Writer(&buf)
+	line := fmt.Sprintf(`{"url":"https://api.kraken.com/0/private/BalanceEx","headers":{"API-Key":%q,"API-Sign":"c2lnbmF0dXJl"},"body":"{\"result\":{}}"}`+"\n", apiKey)
+
+	n, err := w.Write([]byte(line))
+	if err != nil || n != len(line) {
+		t.Fatalf("Write = %d, %v, want %d, nil", n, err, len(line))
+	}
+	if strings.Contains(buf.String(), apiKey) || strings.Contains(buf.String(), "c2lnbmF0dXJl") {
+		t.Errorf("secret left in recording: %s", buf.String())
+	}
+	if !strings.Contains(buf.String(), "BalanceEx") {
+		t.Errorf("recording lost its content: %s", buf.String())
+	}
+}
+
+func TestHandler(t *testing.T) {
+	redact.Register(apiKey)
+	var buf bytes.Buffer
+	log := slog.New(redact.Handler(slog.NewTextHandler(&buf, nil)))
+
+	log.With("key", apiKey).Info("request with "+apiKey,
+		"error", errors.New("bad key "+apiKey),
+		"headers", map[string]string{"API-Key": apiKey},
+		slog.Group("slack", "webhook", "https://hooks.slack.com/services/T000/B000/XXXX"),
+		"volume", 1.5)
+
+	out := buf.String()
+	if strings.Contains(out, apiKey) || strings.Contains(out, "T000/B000") {
+		t.Errorf("secret left in log: %s", out)
+	}
+	if !strings.Contains(out, "volume=1.5") {
+		t.Errorf("plain attribute was changed: %s", out)
+	}
+}
+
+// The OTP, TOTP and futures secrets are added to SecretEnv by the packages reading them
+func TestRegisterEnvLaterSecrets(t *testing.T) {
+	_ = kraken.OTP
+	_ = krakenfutures.APIKeyEnv
+
+	values := map[string]string{
+		"KRAKEN_API_OTP":            "otp-password-123",
+		"KRAKEN_API_TOTP_SECRET":    "JBSWY3DPEHPK3PXPJBSWY3DP",
+		krakenfutures.APIKeyEnv:     "futures-public-key-abcdef",
+		krakenfutures.PrivateKeyEnv: "futures-private-key-abcdef==",
+	}
+	for name, value := range values {
+		found := false
+		for _, env := range redact.SecretEnv {
+			found = found || env == name
+		}
+		if !found {
+			t.Errorf("%s is not in SecretEnv", name)
+		}
+		t.Setenv(name, value)
+	}
+	redact.RegisterEnv()
+
+	for name, value := range values {
+		if got := redact.String("value " + value); got != "value "+redact.Placeholder {
+			t.Errorf("%s not redacted: %q", name, got)
+		}
+	}
+}
@@ -0,0 +1,205 @@
+// Package report writes the loop's trade report: append-only text files rotated by day and size.
+// Every record is written with a single append and fsynced, so a crash or power loss can at
+// most lose the record being written, never the ones before it.
+package report
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultMaxSize is the size at which a day's report rolls over to a new part
+const DefaultMaxSize = 10 << 20
+
+// Writer appends records to the current report file
+type Writer struct {
+	mu      sync.Mutex
+	dir     string
+	prefix  string
+	maxSize int64
+	loc     *time.Location // days roll over at midnight in this zone
+
+	file *os.File
+	day  string
+	part int
+	size int64
+}
+
+// Open returns a writer for reports named <prefix>-<date>[.<part>].txt in dir, dated in loc.
+// maxSize <= 0 disables size-based rotation.
+func Open(dir string, prefix string, maxSize int64, loc *time.Location) (*Writer, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("error creating report directory: %v", err)
+	}
+	w := &Writer{dir: dir, prefix: prefix, maxSize: maxSize, loc: loc}
+	if err := w.rotate(); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+// Path returns the report file currently written to
+func (w *Writer) Path() string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.file == nil {
+		return ""
+	}
+	return w.file.Name()
+}
+
+// Append writes a record as one line and syncs it to disk
+func (w *Writer) Append(record string) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	line := []byte(strings.TrimRight(record, "\n") + "\n")
+	if w.today() != w.day || (w.maxSize > 0 && w.size > 0 && w.size+int64(len(line)) > w.maxSize) {
+		if err := w.rotate(); err != nil {
+			return err
+		}
+	}
+
+	// O_APPEND with a single write keeps records whole even with concurrent writers
+	n, err := w.file.Write(line)
+	w.size += int64(n)
+	if err != nil {
+		return fmt.Errorf("error writing report: %v", err)
+	}
+	if err := w.file.Sync(); err != nil {
+		return fmt.Errorf("error syncing report: %v", err)
+	}
+	return nil
+}
+
+// Close closes the current report file
+func (w *Writer) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.file == nil {
+		return nil
+	}
+	err := w.file.Close()
+	w.file = nil
+	return err
+}
+
+// rotate switches to today's report, skipping parts that are already full
+func (w *Writer) rotate() error {
+	day := w.today()
+	part := 0
+	if day == w.day {
+		part = w.part + 1
+	}
+
+	for {
+		path := w.path(day, part)
+		info, err := os.Stat(path)
+		if err == nil && w.maxSize > 0 && info.Size() >= w.maxSize {
+			part++
+			continue
+		}
+		if err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("error checking report file: %v", err)
+		}
+		created := os.IsNotExist(err)
+
+		file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0644)
+		if err != nil {
+			return fmt.Errorf("error opening report file: %v", err)
+		}
+		size, err := repairTail(file)
+		if err != nil {
+			file.Close()
+			return err
+		}
+		if created {
+			if err := syncDir(w.dir); err != nil {
+				file.Close()
+				return err
+			}
+		}
+
+		if w.file != nil {
+			w.file.Close()
+		}
+		w.file, w.day, w.part, w.size = file, day, part, size
+		return nil
+	}
+}
+
+// today returns the current day in the report's time zone
+func (w *Writer) today() string {
+	return time.Now().In(w.loc).Format("2006-01-02")
+}
+
+// path returns the report file name for a day and part
+func (w *Writer) path(day string, part int) string {
+	name := fmt.Sprintf("%s-%s.txt", w.prefix, day)
+	if part > 0 {
+		name = fmt.Sprintf("%s-%s.%d.txt", w.prefix, day, part)
+	}
+	return filepath.Join(w.dir, name)
+}
+
+// repairTail truncates a torn last line left by a crash mid-write and returns the file size
+func repairTail(file *os.File) (int64, error) {
+	info, err := file.Stat()
+	if err != nil {
+		return 0, fmt.Errorf("error checking report file: %v", err)
+	}
+	size := info.Size()
+	if size == 0 {
+		return 0, nil
+	}
+
+	// Records are short, the last newline is within the final few KB
+	const window = 4096
+	start := size - window
+	if start < 0 {
+		start = 0
+	}
+	tail := make([]byte, size-start)
+	if _, err := file.ReadAt(tail, start); err != nil && err != io.EOF {
+		return 0, fmt.Errorf("error reading report file: %v", err)
+	}
+	if tail[len(tail)-1] == '\n' {
+		return size, nil
+	}
+
+	i := bytes.LastIndexByte(tail, '\n')
+	if i < 0 && start > 0 {
+		// Not a record of ours, terminate it rather than guessing where it starts
+		if _, err := file.Write([]byte("\n")); err != nil {
+			return 0, fmt.Errorf("error repairing report file: %v", err)
+		}
+		return size + 1, nil
+	}
+	keep := start + int64(i) + 1
+	if err := file.Truncate(keep); err != nil {
+		return 0, fmt.Errorf("error repairing report file: %v", err)
+	}
+	if err := file.Sync(); err != nil {
+		return 0, fmt.Errorf("error syncing report file: %v", err)
+	}
+	return keep, nil
+}
+
+// syncDir makes a newly created file's directory entry durable
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return fmt.Errorf("error opening report directory: %v", err)
+	}
+	defer d.Close()
+	if err := d.Sync(); err != nil {
+		return fmt.Errorf("error syncing report directory: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,58 @@
+// Package risk enforces account-wide limits on new trades: the notional exposure per coin and the
+// number of spread pairs open at once. The limits are checked against the account's open orders
+// right before a trade places its orders.
+package risk
+
+import (
+	"fmt"
+
+	"github.com/jkosik/crypto-trader/internal/kraken"
+	"github.com/jkosik/crypto-trader/internal/money"
+)
+
+// Limits are the thresholds of Check, zero disables a limit
+type Limits struct {
+	MaxExposureUSD float64 // USD in open buy orders of the coin, the new trade's buy included
+	MaxOpenSpreads int     // spread pairs open across the account, the new trade included
+}
+
+// Exposure is what the account's open orders already commit
+type Exposure struct {
+	CoinUSD     float64 // USD in the unfilled volume of the coin's open buy orders
+	OpenSpreads int     // trades with an open order, counted by their shared userref
+	OtherOrders int     // open orders without a userref, placed by hand or by other clients
+}
+
+// Measure returns the exposure of the open orders. Orders of one trade share a userref (see
+// kraken.UserRef), so every distinct userref is one open spread pair, even with one leg filled.
+func Measure(orders map[string]kraken.OrderStatus, pair *kraken.AssetPair) Exposure {
+	var exposure Exposure
+	userrefs := map[int32]bool{}
+	for _, order := range orders {
+		if order.UserRef != 0 {
+			userrefs[order.UserRef] = true
+		} else {
+			exposure.OtherOrders++
+		}
+		if order.Descr.Type != "buy" || (order.Descr.Pair != pair.Altname && order.Descr.Pair != pair.Name) {
+			continue
+		}
+		remaining := kraken.ParseFloat(order.Vol) - kraken.ParseFloat(order.VolExec)
+		exposure.CoinUSD += remaining * kraken.ParseFloat(order.Descr.Price)
+	}
+	exposure.OpenSpreads = len(userrefs)
+	return exposure
+}
+
+// Check returns an error naming the breached limit if a new trade buying tradeUSD on top of the
+// exposure would exceed the limits
+func (l Limits) Check(exposure Exposure, tradeUSD float64) error {
+	if l.MaxExposureUSD > 0 && exposure.CoinUSD+tradeUSD > l.MaxExposureUSD {
+		return fmt.Errorf("exposure of %s USD in open buy orders plus %s USD of the new trade exceeds max_exposure_usd %s",
+			money.Format(exposure.CoinUSD, "USD"), money.Format(tradeUSD, "USD"), money.Format(l.MaxExposureUSD, "USD"))
+	}
+	if l.MaxOpenSpreads > 0 && exposure.OpenSpreads+1 > l.MaxOpenSpreads {
+		return fmt.Errorf("%d spread pairs are open, a new one exceeds max_open_spreads %d", exposure.OpenSpreads, l.MaxOpenSpreads)
+	}
+	return nil
+}
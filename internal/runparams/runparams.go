@@ -0,0 +1,191 @@
+// Package runparams remembers the effective trading parameters of the last run per coin, so a
+// run with changed config or flags can show what changed and stop on risk increases before
+// real orders are placed.
+package runparams
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Params are effective parameter values by name, formatted as the flags and config file spell them
+type Params map[string]string
+
+// Change is a parameter whose value differs from the last run. Old or New is empty for
+// parameters only present in one of the runs.
+type Change struct {
+	Name         string
+	Old          string
+	New          string
+	RiskIncrease bool
+}
+
+// riskRule describes how a parameter affects risk
+type riskRule struct {
+	higherIsRiskier bool
+	zeroIsUnlimited bool // 0 disables the limit, so it's the riskiest value
+}
+
+// riskRules lists the risk-relevant parameters: trade size, size caps, loss caps and the
+// minimums gating order placement
+var riskRules = map[string]riskRule{
+	"volume":                    {higherIsRiskier: true},
+	"usd":                       {higherIsRiskier: true},
+	"max_volume":                {higherIsRiskier: true, zeroIsUnlimited: true},
+	"max_participation_percent": {higherIsRiskier: true, zeroIsUnlimited: true},
+	"max_book_percent":          {higherIsRiskier: true, zeroIsUnlimited: true},
+	"max_exposure_usd":          {higherIsRiskier: true, zeroIsUnlimited: true},
+	"max_open_spreads":          {higherIsRiskier: true, zeroIsUnlimited: true},
+	"daily_loss_limit":          {higherIsRiskier: true, zeroIsUnlimited: true},
+	"max_loss_percent":          {higherIsRiskier: true},
+	"min_spread_percent":        {},
+	"min_volume_24h":            {},
+	"min_net_profit_percent":    {},
+	"untradeable":               {},
+}
+
+// Diff returns the changed parameters sorted by name, flagging changes that increase risk
+func Diff(old Params, new Params) []Change {
+	names := map[string]bool{}
+	for name := range old {
+		names[name] = true
+	}
+	for name := range new {
+		names[name] = true
+	}
+
+	var changes []Change
+	for name := range names {
+		if old[name] == new[name] {
+			continue
+		}
+		change := Change{Name: name, Old: old[name], New: new[name]}
+		if rule, ok := riskRules[name]; ok {
+			change.RiskIncrease = riskier(rule, old[name], new[name])
+		}
+		changes = append(changes, change)
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Name < changes[j].Name })
+	return changes
+}
+
+// RiskIncreased reports whether any of the changes increases risk
+func RiskIncreased(changes []Change) bool {
+	for _, change := range changes {
+		if change.RiskIncrease {
+			return true
+		}
+	}
+	return false
+}
+
+// riskier compares two values of a risk-relevant parameter. Values that can't be compared,
+// like a parameter new to this run, count as riskier.
+func riskier(rule riskRule, old string, new string) bool {
+	o, okOld := number(old)
+	n, okNew := number(new)
+	if !okOld || !okNew {
+		return true
+	}
+	if rule.zeroIsUnlimited {
+		if n == 0 {
+			return o != 0
+		}
+		if o == 0 {
+			return false
+		}
+	}
+	if rule.higherIsRiskier {
+		return n > o
+	}
+	return n < o
+}
+
+// number parses a parameter value as a float, boolean (1 or 0) or duration (seconds)
+func number(s string) (float64, bool) {
+	if f, err := strconv.ParseFloat(s, 64); err == nil {
+		return f, true
+	}
+	if b, err := strconv.ParseBool(s); err == nil {
+		if b {
+			return 1, true
+		}
+		return 0, true
+	}
+	if d, err := time.ParseDuration(s); err == nil {
+		return d.Seconds(), true
+	}
+	return 0, false
+}
+
+// Load returns the parameters of the last run for coin stored at path, or nil if there was none
+func Load(path string, coin string) (Params, error) {
+	runs, err := load(path)
+	if err != nil {
+		return nil, err
+	}
+	return runs[coin], nil
+}
+
+// saveMu serializes Save, whose read-modify-write would otherwise lose the runs of coins traded
+// side by side in one process (cmd/loop)
+var saveMu sync.Mutex
+
+// Save stores the parameters of this run for coin at path, keeping the other coins' runs
+func Save(path string, coin string, params Params) error {
+	saveMu.Lock()
+	defer saveMu.Unlock()
+
+	runs, err := load(path)
+	if err != nil {
+		return err
+	}
+	runs[coin] = params
+
+	data, err := json.MarshalIndent(runs, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error encoding run parameters: %v", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return fmt.Errorf("error creating state directory: %v", err)
+	}
+	// A temporary file of its own, traders in other processes may be saving too
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("error writing run parameters: %v", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("error writing run parameters: %v", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("error writing run parameters: %v", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("error writing run parameters: %v", err)
+	}
+	return nil
+}
+
+// load reads the stored runs of all coins
+func load(path string) (map[string]Params, error) {
+	runs := map[string]Params{}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return runs, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading run parameters: %v", err)
+	}
+	if err := json.Unmarshal(data, &runs); err != nil {
+		return nil, fmt.Errorf("error parsing run parameters %s: %v", path, err)
+	}
+	return runs, nil
+}
@@ -0,0 +1,48 @@
+package runparams
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+// Coins traded side by side in one process save their runs concurrently, none may be lost
+func TestSaveConcurrent(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "last-run.json")
+
+	coins := []string{"BTC", "ETH", "SOL", "DOT", "ADA", "XRP", "LTC", "LINK"}
+	var wg sync.WaitGroup
+	for _, coin := range coins {
+		wg.Add(1)
+		go func(coin string) {
+			defer wg.Done()
+			for i := 0; i < 10; i++ {
+				if err := Save(path, coin, Params{"volume": fmt.Sprint(i)}); err != nil {
+					t.Error(err)
+				}
+			}
+		}(coin)
+	}
+	wg.Wait()
+
+	for _, coin := range coins {
+		params, err := Load(path, coin)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if params["volume"] != "9" {
+			t.Errorf("%s run = %v, want volume 9", coin, params)
+		}
+	}
+	// Only the parameters file remains, no temporary files
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("state directory holds %d files, want 1", len(entries))
+	}
+}
@@ -0,0 +1,318 @@
+// Package scanner ranks Kraken's pairs of one quote currency by spread, volume, volatility and order book depth. It
+// backs the volume/spread scanner utility and the trader's -autoselect.
+package scanner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/jkosik/crypto-trader/internal/kraken"
+)
+
+// DepthLevels is the number of order book levels summed up for depth enrichment
+const DepthLevels = 10
+
+// stablecoins are the stablecoins and fiat currencies skipped with Options.ExcludeStable, their
+// pairs hardly move
+var stablecoins = map[string]bool{
+	"USDT": true, "USDC": true, "DAI": true, "TUSD": true, "PYUSD": true, "USDG": true, "USDS": true, "USDE": true,
+	"USDQ": true, "USDR": true, "RLUSD": true, "FDUSD": true, "EURT": true, "EURQ": true, "EURR": true, "EUROP": true,
+	"USD": true, "EUR": true, "GBP": true, "CHF": true, "CAD": true, "AUD": true, "JPY": true,
+}
+
+// ErrNoPair is returned by Best when no pair exceeds the thresholds of the scan
+var ErrNoPair = errors.New("no pair qualifies")
+
+// Pair is a trading pair with its metrics
+type Pair struct {
+	Pair      string  `json:"pair"`  // Kraken pair name, e.g. XXBTZUSD or SOLUSD
+	Base      string  `json:"base"`  // base asset code, e.g. XBT
+	Quote     string  `json:"quote"` // quote asset code, e.g. USD
+	AskPrice  float64 `json:"ask"`
+	BidPrice  float64 `json:"bid"`
+	Spread    float64 `json:"spread"`
+	SpreadPct float64 `json:"spread_pct"`
+	Volume24h float64 `json:"volume_24h"`
+	VolumeUSD float64 `json:"volume_usd"`    // in the quote currency for other quotes than USD
+	BidDepth  float64 `json:"bid_depth_usd"` // USD value of the top DepthLevels bids (depth enrichment only)
+	AskDepth  float64 `json:"ask_depth_usd"` // USD value of the top DepthLevels asks (depth enrichment only)
+
+	VolatilityPct float64 `json:"volatility_pct"` // 24h high-low range as percentage of the low
+	Score         float64 `json:"score"`          // Weighted combination of metrics, see config.ScoreMetrics
+
+	Trades24h    int     `json:"trades_24h"`
+	FillsPerHour float64 `json:"fills_per_hour"` // trades per hour over the last 24h, each a chance to fill a quote at the touch
+	NetEdgePct   float64 `json:"net_edge_pct"`   // spread minus a maker fee on both legs, in % of the bid
+	EdgePerHour  float64 `json:"edge_per_hour"`  // net edge captured per hour if every other fill completes a round trip, in %
+}
+
+// Options are the thresholds and settings of a scan
+type Options struct {
+	MinVolumeUSD  float64               // 24h volume in the quote currency a pair must exceed to qualify
+	MinSpreadPct  float64               // spread in % of the bid a pair must exceed to qualify
+	Depth         bool                  // enrich qualifying pairs with order book depth, one request per pair
+	Workers       int                   // concurrent depth requests, throttled by the kraken package's public rate limit
+	Weights       map[string]float64    // score weights by metric, see config.ScoreMetrics
+	MakerFeePct   float64               // maker fee in % paid on both legs of a round trip
+	Quote         string                // quote currency of the scanned pairs, e.g. USD, EUR or USDT (default USD)
+	MinPrice      float64               // bid in the quote currency a pair must reach to be scanned
+	ExcludeStable bool                  // skip pairs whose base is a stablecoin or fiat currency
+	ExcludeDark   bool                  // skip dark pool pairs instead of reporting them separately
+	Include       []string              // base coins to scan, empty scans all
+	Exclude       []string              // base coins never scanned
+	Progress      func(done, total int) // called as depth requests finish, nil for none
+}
+
+// Result is the outcome of a scan
+type Result struct {
+	Pairs       []Pair // pairs of the quote currency, scored, in no particular order
+	DarkPool    []Pair // dark pool pairs, excluded from rankings since their liquidity isn't in the public book
+	DepthFailed int    // pairs whose depth couldn't be retrieved
+	options     Options
+}
+
+// Scan retrieves the ticker of every pair and scores the pairs of the quote currency that pass the
+// filters. Depth enrichment is limited to the pairs that qualify, the others can't make it into a
+// ranking that needs depth.
+func Scan(ctx context.Context, opts Options) (*Result, error) {
+	if opts.Quote == "" {
+		opts.Quote = "USD"
+	}
+	assetPairs, err := kraken.LoadAssetPairs(ctx)
+	if err != nil {
+		return nil, err
+	}
+	tickers, err := kraken.GetTickers(ctx)
+	if err != nil {
+		return nil, err
+	}
+	result := parseTickers(tickers, assetPairs, opts)
+
+	if opts.Depth {
+		var candidates []*Pair
+		for i := range result.Pairs {
+			if result.Qualifies(result.Pairs[i]) {
+				candidates = append(candidates, &result.Pairs[i])
+			}
+		}
+		result.DepthFailed = enrichDepth(ctx, candidates, opts)
+	}
+
+	for i := range result.Pairs {
+		result.Pairs[i].Score = Score(result.Pairs[i], opts.Weights)
+	}
+	return result, nil
+}
+
+// parseTickers builds the pairs of the scan from the tickers of all pairs, unscored
+func parseTickers(tickers map[string]kraken.TickerResult, assetPairs map[string]*kraken.AssetPair, opts Options) *Result {
+	result := &Result{options: opts}
+	include, exclude := coinSet(opts.Include), coinSet(opts.Exclude)
+	for name, data := range tickers {
+		// Dark pool pairs (e.g. XBTUSD.d) are reported separately, their liquidity isn't in the public book.
+		// They lack a WebSocket name, the asset codes come from their public counterpart.
+		isDarkPool := strings.HasSuffix(name, ".d")
+		if isDarkPool && opts.ExcludeDark {
+			continue
+		}
+		assetPair, ok := assetPairs[strings.TrimSuffix(name, ".d")]
+		if !ok {
+			continue
+		}
+		base, quote := assetPair.BaseAltname(), assetPair.QuoteAltname()
+		if quote != kraken.Altname(opts.Quote) || exclude[base] || (len(include) > 0 && !include[base]) || (opts.ExcludeStable && stablecoins[base]) {
+			continue
+		}
+		if len(data.Ask) == 0 || len(data.Bid) == 0 || len(data.Vol) < 2 {
+			continue
+		}
+
+		// Parse prices and volume
+		askPrice, _ := strconv.ParseFloat(data.Ask[0], 64)
+		bidPrice, _ := strconv.ParseFloat(data.Bid[0], 64)
+		volume24h, _ := strconv.ParseFloat(data.Vol[1], 64) // 24h volume
+		if bidPrice <= 0 || bidPrice < opts.MinPrice {
+			continue
+		}
+
+		volatilityPct := 0.0
+		if len(data.High) > 1 && len(data.Low) > 1 {
+			high, _ := strconv.ParseFloat(data.High[1], 64)
+			low, _ := strconv.ParseFloat(data.Low[1], 64)
+			if low > 0 {
+				volatilityPct = (high - low) / low * 100
+			}
+		}
+
+		pair := Pair{
+			Pair:      name,
+			Base:      base,
+			Quote:     quote,
+			AskPrice:  askPrice,
+			BidPrice:  bidPrice,
+			Spread:    askPrice - bidPrice,
+			SpreadPct: (askPrice - bidPrice) / bidPrice * 100,
+			Volume24h: volume24h,
+			VolumeUSD: volume24h * bidPrice, // Approximate USD volume
+
+			VolatilityPct: volatilityPct,
+		}
+		if len(data.Trades) > 1 {
+			pair.Trades24h = data.Trades[1]
+		}
+		// A round trip needs a fill on both sides, so it pays the fee twice and takes two fills
+		pair.FillsPerHour = float64(pair.Trades24h) / 24
+		pair.NetEdgePct = pair.SpreadPct - 2*opts.MakerFeePct
+		pair.EdgePerHour = pair.NetEdgePct * pair.FillsPerHour / 2
+		if isDarkPool {
+			result.DarkPool = append(result.DarkPool, pair)
+			continue
+		}
+		result.Pairs = append(result.Pairs, pair)
+	}
+	return result
+}
+
+// Qualifies reports whether the pair exceeds both the volume and the spread threshold of the scan
+func (r *Result) Qualifies(pair Pair) bool {
+	return pair.VolumeUSD > r.options.MinVolumeUSD && pair.SpreadPct > r.options.MinSpreadPct
+}
+
+// Qualifying returns the pairs that qualify, best score first. Equal scores are ordered by pair
+// name, so the same tickers always pick the same pair.
+func (r *Result) Qualifying() []Pair {
+	var pairs []Pair
+	for _, pair := range r.Pairs {
+		if r.Qualifies(pair) {
+			pairs = append(pairs, pair)
+		}
+	}
+	sort.Slice(pairs, func(i, j int) bool {
+		if pairs[i].Score != pairs[j].Score {
+			return pairs[i].Score > pairs[j].Score
+		}
+		return pairs[i].Pair < pairs[j].Pair
+	})
+	return pairs
+}
+
+// Best returns the qualifying pair with the best score
+func (r *Result) Best() (*Pair, error) {
+	pairs := r.Qualifying()
+	if len(pairs) == 0 {
+		return nil, fmt.Errorf("%w: no %s pair has a 24h volume above %.0f and a spread above %g%%", ErrNoPair, r.options.Quote, r.options.MinVolumeUSD, r.options.MinSpreadPct)
+	}
+	return &pairs[0], nil
+}
+
+// coinSet returns the Kraken altnames of coins, so BTC matches XBT
+func coinSet(coins []string) map[string]bool {
+	set := make(map[string]bool, len(coins))
+	for _, coin := range coins {
+		set[kraken.Altname(strings.TrimSpace(coin))] = true
+	}
+	return set
+}
+
+// enrichDepth fetches the order book of every pair with a bounded worker pool and returns the
+// number of pairs whose depth is unavailable. The requests draw from the kraken package's public
+// rate limiter like every other public call, so the API limit holds regardless of the pool size.
+func enrichDepth(ctx context.Context, pairs []*Pair, opts Options) int {
+	workers := opts.Workers
+	if workers < 1 {
+		workers = 1
+	}
+
+	jobs := make(chan *Pair)
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	done := 0
+	failed := 0
+
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for pair := range jobs {
+				var err error
+				pair.BidDepth, pair.AskDepth, err = depthUSD(ctx, pair.Pair)
+
+				mu.Lock()
+				done++
+				if err != nil {
+					failed++
+				}
+				if opts.Progress != nil {
+					opts.Progress(done, len(pairs))
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+
+	for _, pair := range pairs {
+		jobs <- pair
+	}
+	close(jobs)
+	wg.Wait()
+	return failed
+}
+
+// depthUSD returns the USD value of the top DepthLevels bids and asks of a pair
+func depthUSD(ctx context.Context, pair string) (float64, float64, error) {
+	book, err := kraken.GetOrderBook(ctx, pair, DepthLevels)
+	if err != nil {
+		return 0, 0, err
+	}
+	return levelsUSD(book.Bids), levelsUSD(book.Asks), nil
+}
+
+// levelsUSD sums price*volume over order book levels
+func levelsUSD(levels []kraken.BookLevel) float64 {
+	total := 0.0
+	for _, level := range levels {
+		total += level.Price * level.Volume
+	}
+	return total
+}
+
+// Score combines the pair's metrics using the weights.
+// Volume and depth enter as log10 so they don't dwarf percentage metrics.
+func Score(pair Pair, weights map[string]float64) float64 {
+	metrics := map[string]float64{
+		"spread_pct":     pair.SpreadPct,
+		"volume_usd":     math.Log10(math.Max(pair.VolumeUSD, 1)),
+		"volatility_pct": pair.VolatilityPct,
+		"depth_usd":      math.Log10(math.Max(pair.BidDepth+pair.AskDepth, 1)),
+		"net_edge_pct":   pair.NetEdgePct,
+		"fills_per_hour": math.Log10(math.Max(pair.FillsPerHour, 1)),
+		"edge_per_hour":  pair.EdgePerHour,
+	}
+
+	score := 0.0
+	for metric, weight := range weights {
+		score += weight * metrics[metric]
+	}
+	return score
+}
+
+// FormatWeights prints score weights in a stable order
+func FormatWeights(weights map[string]float64) string {
+	metrics := make([]string, 0, len(weights))
+	for metric := range weights {
+		metrics = append(metrics, metric)
+	}
+	sort.Strings(metrics)
+
+	parts := make([]string, len(metrics))
+	for i, metric := range metrics {
+		parts[i] = fmt.Sprintf("%s*%g", metric, weights[metric])
+	}
+	return "(" + strings.Join(parts, " + ") + ")"
+}
@@ -0,0 +1,86 @@
+package scanner
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/jkosik/crypto-trader/internal/kraken"
+	"github.com/jkosik/crypto-trader/internal/krakenmock"
+)
+
+// The scan reads the tickers and the order books through the kraken package, like every public call
+func TestScanDepth(t *testing.T) {
+	server := krakenmock.New(krakenmock.Secret)
+	defer server.Close()
+	defer server.Use()()
+	kraken.SetPublicRateLimit(1000, 1000)
+	defer kraken.SetPublicRateLimit(1, 1)
+
+	result, err := Scan(context.Background(), Options{Quote: "USD", MinVolumeUSD: 1000, MinSpreadPct: 0.01, Depth: true, Workers: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.DepthFailed != 0 || len(result.Pairs) != 1 {
+		t.Fatalf("scan = %+v, want the mock's BTC/USD pair with its depth", result)
+	}
+	// The top levels of the mock's 60000/60010 book
+	pair := result.Pairs[0]
+	if pair.Base != "XBT" || pair.BidDepth != 713680.5 || pair.AskDepth != 735430.375 {
+		t.Errorf("%s depth = %v/%v, want 713680.5/735430.375", pair.Base, pair.BidDepth, pair.AskDepth)
+	}
+	if len(server.Requests("/0/public/Depth")) != 1 {
+		t.Errorf("got %d Depth requests, want 1", len(server.Requests("/0/public/Depth")))
+	}
+}
+
+// benchTickers is a Ticker response of n USD pairs plus as many EUR pairs and dark pool pairs the
+// scan skips or reports separately, with the pair metadata the scan resolves them by
+func benchTickers(n int) ([]byte, map[string]*kraken.AssetPair) {
+	pairs := make(map[string]*kraken.AssetPair, 3*n)
+	entries := make([]string, 0, 3*n)
+	for i := 0; i < n; i++ {
+		coin := fmt.Sprintf("COIN%d", i)
+		bid := 0.001 * float64(i+1)
+		for _, quote := range []string{"USD", "EUR"} {
+			name := coin + quote
+			pairs[name] = &kraken.AssetPair{Name: name, Altname: name, WSName: coin + "/" + quote, Base: coin, Quote: "Z" + quote}
+			entries = append(entries, fmt.Sprintf(`%q:{"a":["%g","100","100.000"],"b":["%g","250","250.000"],`+
+				`"c":["%g","10"],"v":["%d","%d"],"p":["%g","%g"],"t":[%d,%d],"l":["%g","%g"],"h":["%g","%g"],"o":"%g"}`,
+				name, bid*1.004, bid, bid, 1000*i, 24000*i, bid, bid, i, 24*i, bid*0.97, bid*0.95, bid*1.02, bid*1.06, bid))
+		}
+		entries = append(entries, fmt.Sprintf(`%q:{"a":["%g","1","1.000"],"b":["%g","1","1.000"],"c":["%g","1"],"v":["1","2"],"p":["1","1"],"t":[1,2],"l":["1","1"],"h":["1","1"],"o":"1"}`,
+			coin+"USD.d", bid*1.01, bid, bid))
+	}
+	return []byte(`{"error":[],"result":{` + strings.Join(entries, ",") + `}}`), pairs
+}
+
+// BenchmarkScanProcessing covers the scan after the Ticker request: parsing the tickers of
+// Kraken's ~1000 pairs, filtering the quote currency, scoring and ranking
+func BenchmarkScanProcessing(b *testing.B) {
+	body, pairs := benchTickers(400)
+	opts := Options{
+		Quote:        "USD",
+		MinVolumeUSD: 1000,
+		MinSpreadPct: 0.1,
+		MakerFeePct:  0.25,
+		Weights:      map[string]float64{"spread_pct": 1, "volume_usd": 0.5, "volatility_pct": 0.2, "edge_per_hour": 1},
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		var response kraken.TickerResponse
+		if err := json.Unmarshal(body, &response); err != nil {
+			b.Fatal(err)
+		}
+		result := parseTickers(response.Result, pairs, opts)
+		for j := range result.Pairs {
+			result.Pairs[j].Score = Score(result.Pairs[j], opts.Weights)
+		}
+		if _, err := result.Best(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,200 @@
+// Package selfupdate replaces the running trader binary with the latest GitHub release behind
+// `trader self-update`. Releases carry a checksums.txt signed with the release ed25519 key;
+// a binary is only installed if the signature and its SHA-256 checksum verify.
+package selfupdate
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// Repo is the GitHub repository publishing the releases
+var Repo = "jkosik/crypto-trader"
+
+// PublicKey is the base64 ed25519 key verifying checksums.txt.sig, set by scripts/release.sh with
+// -ldflags "-X github.com/jkosik/crypto-trader/internal/selfupdate.PublicKey=...".
+// Binaries built without it refuse to update.
+var PublicKey = ""
+
+// Release asset names besides the binaries
+const (
+	ChecksumsAsset = "checksums.txt"
+	SignatureAsset = "checksums.txt.sig"
+)
+
+// maxAssetSize bounds downloads so a broken release can't fill the disk
+const maxAssetSize = 200 << 20
+
+// Release is a published GitHub release
+type Release struct {
+	Tag    string
+	Assets map[string]string // download URL by asset name
+}
+
+// AssetName returns the release binary name for the running platform, e.g. trader_linux_amd64
+func AssetName() string {
+	name := fmt.Sprintf("trader_%s_%s", runtime.GOOS, runtime.GOARCH)
+	if runtime.GOOS == "windows" {
+		name += ".exe"
+	}
+	return name
+}
+
+// Latest retrieves the latest release of Repo
+func Latest(ctx context.Context) (*Release, error) {
+	body, err := download(ctx, fmt.Sprintf("https://api.github.com/repos/%s/releases/latest", Repo))
+	if err != nil {
+		return nil, fmt.Errorf("error getting latest release: %v", err)
+	}
+
+	var response struct {
+		TagName string `json:"tag_name"`
+		Assets  []struct {
+			Name string `json:"name"`
+			URL  string `json:"browser_download_url"`
+		} `json:"assets"`
+	}
+	if err := json.Unmarshal(body, &response); err != nil {
+		return nil, fmt.Errorf("error parsing release: %v", err)
+	}
+
+	release := &Release{Tag: response.TagName, Assets: map[string]string{}}
+	for _, asset := range response.Assets {
+		release.Assets[asset.Name] = asset.URL
+	}
+	return release, nil
+}
+
+// Install downloads the release binary for the running platform, verifies it and atomically
+// replaces the executable at path with it
+func Install(ctx context.Context, release *Release, path string) error {
+	if PublicKey == "" {
+		return fmt.Errorf("this binary was built without a release signing key, update it with go build instead")
+	}
+	publicKey, err := base64.StdEncoding.DecodeString(PublicKey)
+	if err != nil || len(publicKey) != ed25519.PublicKeySize {
+		return fmt.Errorf("invalid release signing key")
+	}
+
+	name := AssetName()
+	for _, asset := range []string{name, ChecksumsAsset, SignatureAsset} {
+		if release.Assets[asset] == "" {
+			return fmt.Errorf("release %s has no %s", release.Tag, asset)
+		}
+	}
+
+	checksums, err := download(ctx, release.Assets[ChecksumsAsset])
+	if err != nil {
+		return fmt.Errorf("error downloading %s: %v", ChecksumsAsset, err)
+	}
+	signature, err := download(ctx, release.Assets[SignatureAsset])
+	if err != nil {
+		return fmt.Errorf("error downloading %s: %v", SignatureAsset, err)
+	}
+	if !ed25519.Verify(publicKey, checksums, signature) {
+		return fmt.Errorf("signature of %s does not verify, refusing to update", ChecksumsAsset)
+	}
+
+	expected, err := checksum(checksums, name)
+	if err != nil {
+		return err
+	}
+	binary, err := download(ctx, release.Assets[name])
+	if err != nil {
+		return fmt.Errorf("error downloading %s: %v", name, err)
+	}
+	sum := sha256.Sum256(binary)
+	if hex.EncodeToString(sum[:]) != expected {
+		return fmt.Errorf("checksum of %s does not match %s, refusing to update", name, ChecksumsAsset)
+	}
+
+	return replace(path, binary)
+}
+
+// checksum returns the SHA-256 listed for name in a sha256sum formatted file
+func checksum(checksums []byte, name string) (string, error) {
+	scanner := bufio.NewScanner(bytes.NewReader(checksums))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 2 && strings.TrimPrefix(fields[1], "*") == name {
+			return strings.ToLower(fields[0]), nil
+		}
+	}
+	return "", fmt.Errorf("%s has no checksum for %s", ChecksumsAsset, name)
+}
+
+// replace writes the new binary next to path and renames it over path, so the executable is
+// never partially written. The old binary's permissions are kept.
+func replace(path string, binary []byte) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return fmt.Errorf("error reading current executable: %v", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".new-")
+	if err != nil {
+		return fmt.Errorf("error creating update file: %v", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(binary); err != nil {
+		tmp.Close()
+		return fmt.Errorf("error writing update file: %v", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("error writing update file: %v", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("error writing update file: %v", err)
+	}
+	if err := os.Chmod(tmp.Name(), info.Mode().Perm()); err != nil {
+		return fmt.Errorf("error setting update file permissions: %v", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("error replacing %s: %v", path, err)
+	}
+	return nil
+}
+
+// download fetches a URL, failing on non-200 responses and bodies above maxAssetSize
+func download(ctx context.Context, url string) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Minute)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s returned status %d", url, resp.StatusCode)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxAssetSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(body) > maxAssetSize {
+		return nil, fmt.Errorf("%s is larger than %d bytes", url, maxAssetSize)
+	}
+	return body, nil
+}
@@ -0,0 +1,238 @@
+package soak
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// maxTrades bounds the public trades the market keeps, older prints are dropped like on Kraken
+const maxTrades = 5000
+
+// marketTrade is a simulated public trade
+type marketTrade struct {
+	at     time.Time
+	price  float64
+	volume float64
+	side   string
+}
+
+// Market is a simulated Kraken public API for a single coin quoted in USD. Prices follow a random
+// walk on a clock running speed times faster than real time. It replaces http.DefaultTransport,
+// so the kraken package talks to it instead of the exchange; private endpoints are refused, only
+// paper trading works against it.
+type Market struct {
+	mu         sync.Mutex
+	coin       string
+	speed      float64
+	started    time.Time // real time the simulation started
+	simStart   time.Time // simulated time at the start
+	simNow     time.Time // simulated time the market has advanced to
+	mid        float64
+	spread     float64 // relative spread, e.g. 0.01 for 1%
+	volatility float64 // standard deviation of the relative price change per simulated minute
+	rng        *rand.Rand
+	trades     []marketTrade
+	high, low  float64
+	volume24h  float64
+	requests   int
+}
+
+// NewMarket starts a simulated market for coin at price, with a relative spread and a per-minute
+// volatility, running speed times faster than real time
+func NewMarket(coin string, price float64, spread float64, volatility float64, speed float64, seed int64) *Market {
+	now := time.Now()
+	return &Market{
+		coin:       coin,
+		speed:      speed,
+		started:    now,
+		simStart:   now,
+		simNow:     now,
+		mid:        price,
+		spread:     spread,
+		volatility: volatility,
+		rng:        rand.New(rand.NewSource(seed)),
+		high:       price,
+		low:        price,
+	}
+}
+
+// Now returns the simulated time
+func (m *Market) Now() time.Time {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.advance()
+	return m.simNow
+}
+
+// Requests returns the number of API requests served
+func (m *Market) Requests() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.requests
+}
+
+// advance moves the market to the current simulated time, printing a trade every few simulated
+// seconds. The caller holds m.mu.
+func (m *Market) advance() {
+	target := m.simStart.Add(time.Duration(float64(time.Since(m.started)) * m.speed))
+	for {
+		step := time.Duration((1 + m.rng.ExpFloat64()*4) * float64(time.Second))
+		if m.simNow.Add(step).After(target) {
+			return
+		}
+		m.simNow = m.simNow.Add(step)
+
+		// Geometric random walk scaled to the step
+		minutes := step.Minutes()
+		m.mid *= math.Exp(m.rng.NormFloat64() * m.volatility * math.Sqrt(minutes))
+
+		// Prints land around the book, sometimes through it, so resting orders inside the spread fill
+		side := "b"
+		price := m.mid * (1 + m.spread/2*m.rng.Float64()*1.5)
+		if m.rng.Intn(2) == 0 {
+			side = "s"
+			price = m.mid * (1 - m.spread/2*m.rng.Float64()*1.5)
+		}
+		volume := 0.05 + m.rng.ExpFloat64()*0.5
+
+		m.trades = append(m.trades, marketTrade{at: m.simNow, price: price, volume: volume, side: side})
+		if len(m.trades) > maxTrades {
+			m.trades = append(m.trades[:0], m.trades[len(m.trades)-maxTrades:]...)
+		}
+		m.high = math.Max(m.high, price)
+		m.low = math.Min(m.low, price)
+		m.volume24h += volume
+	}
+}
+
+// pairName is the pair's key in the API responses
+func (m *Market) pairName() string {
+	return m.coin + "USD"
+}
+
+// RoundTrip serves the public endpoints the trader uses
+func (m *Market) RoundTrip(req *http.Request) (*http.Response, error) {
+	if err := req.Context().Err(); err != nil {
+		return nil, err
+	}
+
+	m.mu.Lock()
+	m.requests++
+	m.advance()
+	var result interface{}
+	switch req.URL.Path {
+	case "/0/public/Time":
+		result = map[string]int64{"unixtime": m.simNow.Unix()}
+	case "/0/public/SystemStatus":
+		result = map[string]string{"status": "online", "timestamp": m.simNow.UTC().Format(time.RFC3339)}
+	case "/0/public/AssetPairs":
+		result = m.assetPairs()
+	case "/0/public/Ticker":
+		result = m.ticker()
+	case "/0/public/Trades":
+		result = m.publicTrades(req.URL.Query().Get("since"))
+	}
+	m.mu.Unlock()
+
+	if result == nil {
+		return respond(req, []string{fmt.Sprintf("EGeneral:Not simulated: %s", req.URL.Path)}, nil)
+	}
+	return respond(req, []string{}, result)
+}
+
+// assetPairs returns the metadata of the simulated pair
+func (m *Market) assetPairs() interface{} {
+	return map[string]interface{}{
+		m.pairName(): map[string]interface{}{
+			"altname":       m.pairName(),
+			"wsname":        m.coin + "/USD",
+			"base":          m.coin,
+			"quote":         "ZUSD",
+			"pair_decimals": 2,
+			"lot_decimals":  8,
+			"ordermin":      "0.0001",
+			"costmin":       "0.5",
+			"tick_size":     "0.01",
+			"status":        "online",
+		},
+	}
+}
+
+// ticker returns the best bid and ask around the mid price
+func (m *Market) ticker() interface{} {
+	bid := m.mid * (1 - m.spread/2)
+	ask := m.mid * (1 + m.spread/2)
+	volume := strconv.FormatFloat(m.volume24h, 'f', 8, 64)
+	return map[string]interface{}{
+		m.pairName(): map[string][]string{
+			"a": {formatPrice(ask), "1", "1.000"},
+			"b": {formatPrice(bid), "1", "1.000"},
+			"h": {formatPrice(m.high), formatPrice(m.high)},
+			"l": {formatPrice(m.low), formatPrice(m.low)},
+			"v": {volume, volume},
+		},
+	}
+}
+
+// publicTrades returns the trades after the since cursor (nanoseconds), or the latest ones
+func (m *Market) publicTrades(since string) interface{} {
+	var after int64
+	if since != "" {
+		after, _ = strconv.ParseInt(since, 10, 64)
+	}
+
+	start := len(m.trades)
+	for start > 0 && m.trades[start-1].at.UnixNano() > after {
+		start--
+	}
+	if since == "" && len(m.trades)-start > 100 {
+		start = len(m.trades) - 100
+	}
+
+	entries := make([][]interface{}, 0, len(m.trades)-start)
+	for _, t := range m.trades[start:] {
+		entries = append(entries, []interface{}{
+			formatPrice(t.price),
+			strconv.FormatFloat(t.volume, 'f', 8, 64),
+			float64(t.at.UnixNano()) / float64(time.Second),
+			t.side, "l", "", 0,
+		})
+	}
+	// Trades are never printed after the simulated now, so it's a safe cursor
+	return map[string]interface{}{
+		m.pairName(): entries,
+		"last":       strconv.FormatInt(m.simNow.UnixNano(), 10),
+	}
+}
+
+// formatPrice formats a price with the pair's decimals
+func formatPrice(price float64) string {
+	return strconv.FormatFloat(price, 'f', 2, 64)
+}
+
+// respond encodes a Kraken-style response
+func respond(req *http.Request, errs []string, result interface{}) (*http.Response, error) {
+	body, err := json.Marshal(map[string]interface{}{"error": errs, "result": result})
+	if err != nil {
+		return nil, err
+	}
+	return &http.Response{
+		StatusCode:    http.StatusOK,
+		Status:        "200 OK",
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        http.Header{"Content-Type": []string{"application/json"}},
+		Body:          io.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}, nil
+}
@@ -0,0 +1,396 @@
+// Package soak runs the trading pipeline against the paper exchange and a simulated market for
+// hours at accelerated time, watching goroutines, heap and emitted events for leaks and losses
+// that only show up in long-running processes.
+package soak
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"path/filepath"
+	"runtime"
+	"sync"
+	"time"
+
+	"github.com/jkosik/crypto-trader/internal/events"
+	"github.com/jkosik/crypto-trader/internal/kraken"
+	"github.com/jkosik/crypto-trader/internal/logging"
+	"github.com/jkosik/crypto-trader/internal/store"
+)
+
+// Options configure a soak run
+type Options struct {
+	Coin            string
+	Volume          float64       // base volume per trade
+	Duration        time.Duration // real time to run for
+	CheckInterval   time.Duration // real time between order status checks
+	SampleInterval  time.Duration // real time between resource samples
+	NarrowFactor    float64
+	MakerFeePercent float64
+	LegTimeout      int     // checks a leg may stall before it's repriced
+	MaxWait         int     // checks to wait for a first fill before canceling both orders
+	MaxHold         int     // checks to wait for the second leg before abandoning it
+	RepriceStep     float64 // fraction of the way to the other side of the book per reprice
+	MaxLossPercent  float64
+
+	MaxGoroutineGrowth int     // allowed goroutines above the baseline
+	MaxHeapGrowthMB    float64 // allowed live heap above the baseline
+
+	Dir      string       // directory of the paper account and journal
+	OnSample func(Sample) // called with every sample as it's taken, optional
+}
+
+// Sample is a resource measurement
+type Sample struct {
+	Elapsed    time.Duration // real time since the start
+	Simulated  time.Duration // simulated market time since the start
+	Goroutines int
+	HeapMB     float64 // live heap after a collection
+	Trades     int
+	Events     int
+}
+
+// Report is the outcome of a soak run
+type Report struct {
+	Samples        []Sample
+	Trades         int
+	Results        map[string]int // finished trades by result
+	Errors         int            // trades that failed with an error
+	EventsEmitted  int
+	EventsReceived int
+	EventLosses    []string // trades whose events were lost or out of order
+	Requests       int      // API requests served by the simulated market
+	Failures       []string // limits exceeded, empty if the run passed
+}
+
+// Passed reports whether the run stayed within its limits
+func (r *Report) Passed() bool {
+	return len(r.Failures) == 0
+}
+
+// tradeEvents is what the consumer saw of a trade's events
+type tradeEvents struct {
+	count int
+	types []string
+}
+
+// eventSink consumes the JSON lines of the events package like an orchestrator would
+type eventSink struct {
+	mu     sync.Mutex
+	total  int
+	trades map[string]*tradeEvents
+}
+
+// consume reads events until r is closed
+func (s *eventSink) consume(r io.Reader) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var event events.Event
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			slog.Warn("Unparsable event", "line", scanner.Text(), "error", err)
+			continue
+		}
+		s.mu.Lock()
+		s.total++
+		t, ok := s.trades[event.TradeID]
+		if !ok {
+			t = &tradeEvents{}
+			s.trades[event.TradeID] = t
+		}
+		t.count++
+		// Only the shape of the sequence matters, fills may repeat
+		if len(t.types) == 0 || t.types[len(t.types)-1] != event.Type {
+			t.types = append(t.types, event.Type)
+		}
+		s.mu.Unlock()
+	}
+}
+
+// Run soaks the pipeline until the duration passes or ctx is done. The market must already be
+// installed as http.DefaultTransport.
+func Run(ctx context.Context, market *Market, opts Options) (*Report, error) {
+	log := logging.FromContext(ctx)
+
+	kraken.SetPublicRateLimit(1000, 1000)
+	if err := kraken.StartPaper(filepath.Join(opts.Dir, "paper-account.json"), map[string]float64{"ZUSD": 1e9, opts.Coin: 1e6}, opts.MakerFeePercent); err != nil {
+		return nil, err
+	}
+	journal, err := store.Open(filepath.Join(opts.Dir, "journal.db"))
+	if err != nil {
+		return nil, err
+	}
+	defer journal.Close()
+
+	pair, err := kraken.GetAssetPair(ctx, opts.Coin, "USD")
+	if err != nil {
+		return nil, err
+	}
+
+	reader, writer := io.Pipe()
+	sink := &eventSink{trades: map[string]*tradeEvents{}}
+	consumed := make(chan struct{})
+	go func() {
+		sink.consume(reader)
+		close(consumed)
+	}()
+
+	report := &Report{Results: map[string]int{}}
+	emitted := map[string]int{}
+	ctx, cancel := context.WithTimeout(ctx, opts.Duration)
+	defer cancel()
+
+	started := time.Now()
+	simStarted := market.Now()
+	var baseline *Sample
+	nextSample := started
+	sample := func() {
+		runtime.GC()
+		var mem runtime.MemStats
+		runtime.ReadMemStats(&mem)
+		sink.mu.Lock()
+		received := sink.total
+		sink.mu.Unlock()
+		s := Sample{
+			Elapsed:    time.Since(started),
+			Simulated:  market.Now().Sub(simStarted),
+			Goroutines: runtime.NumGoroutine(),
+			HeapMB:     float64(mem.HeapAlloc) / (1 << 20),
+			Trades:     report.Trades,
+			Events:     received,
+		}
+		report.Samples = append(report.Samples, s)
+		if opts.OnSample != nil {
+			opts.OnSample(s)
+		}
+		// The baseline is taken once the first trade has warmed up caches and connections
+		if baseline == nil && report.Trades > 0 {
+			baseline = &s
+		}
+	}
+
+	for ctx.Err() == nil {
+		report.Trades++
+		tradeID := fmt.Sprintf("soak-%d", report.Trades)
+		events.Enable(writer, tradeID)
+		emit := func(eventType string, data interface{}) {
+			emitted[tradeID]++
+			report.EventsEmitted++
+			events.Emit(eventType, data)
+		}
+
+		result, err := runTrade(logging.NewContext(ctx, log.With("trade_id", tradeID)), journal, pair, tradeID, opts, emit)
+		if err != nil && ctx.Err() == nil {
+			report.Errors++
+			log.Warn("Soak trade failed", "trade_id", tradeID, "error", err)
+		}
+		if result != "" {
+			report.Results[result]++
+		}
+
+		if !time.Now().Before(nextSample) {
+			sample()
+			nextSample = time.Now().Add(opts.SampleInterval)
+		}
+	}
+	sample()
+
+	// Drain the consumer before comparing what was emitted with what arrived
+	writer.Close()
+	<-consumed
+	events.Enable(io.Discard, "")
+
+	report.EventsReceived = sink.total
+	for tradeID, count := range emitted {
+		t := sink.trades[tradeID]
+		switch {
+		case t == nil || t.count != count:
+			received := 0
+			if t != nil {
+				received = t.count
+			}
+			report.EventLosses = append(report.EventLosses, fmt.Sprintf("%s: emitted %d events, received %d", tradeID, count, received))
+		case !wellFormed(t.types):
+			report.EventLosses = append(report.EventLosses, fmt.Sprintf("%s: unexpected event sequence %v", tradeID, t.types))
+		}
+	}
+	report.Requests = market.Requests()
+
+	if len(report.EventLosses) > 0 {
+		report.Failures = append(report.Failures, fmt.Sprintf("%d trades lost events", len(report.EventLosses)))
+	}
+	if baseline != nil {
+		last := report.Samples[len(report.Samples)-1]
+		if growth := last.Goroutines - baseline.Goroutines; growth > opts.MaxGoroutineGrowth {
+			report.Failures = append(report.Failures, fmt.Sprintf("goroutines grew by %d (from %d to %d), limit %d", growth, baseline.Goroutines, last.Goroutines, opts.MaxGoroutineGrowth))
+		}
+		if growth := last.HeapMB - baseline.HeapMB; growth > opts.MaxHeapGrowthMB {
+			report.Failures = append(report.Failures, fmt.Sprintf("live heap grew by %.1f MB (from %.1f to %.1f MB), limit %.1f MB", growth, baseline.HeapMB, last.HeapMB, opts.MaxHeapGrowthMB))
+		}
+	} else {
+		report.Failures = append(report.Failures, "no trade finished, nothing to compare")
+	}
+	return report, nil
+}
+
+// wellFormed checks a trade's event sequence: a ticker, then either nothing more (orders weren't
+// placed) or orders_placed followed by fills and reprices and exactly one final result
+func wellFormed(types []string) bool {
+	if len(types) == 0 || types[0] != events.Ticker {
+		return false
+	}
+	if len(types) == 1 {
+		return true
+	}
+	if types[1] != events.OrdersPlaced || types[len(types)-1] != events.Result {
+		return false
+	}
+	for _, t := range types[2 : len(types)-1] {
+		if t != events.Fill && t != events.Reprice {
+			return false
+		}
+	}
+	return true
+}
+
+// runTrade places a spread trade on the paper exchange and monitors it like the trader does,
+// repricing a stalled leg and canceling orders that wait too long. It returns the trade's result.
+func runTrade(ctx context.Context, journal *store.Store, pair *kraken.AssetPair, tradeID string, opts Options, emit func(string, interface{})) (string, error) {
+	status, err := kraken.GetTradingStatus(ctx, pair)
+	if err != nil {
+		return "", err
+	}
+	spreadInfo, err := kraken.GetTickerInfo(ctx, opts.Coin)
+	if err != nil {
+		return "", err
+	}
+	emit(events.Ticker, map[string]interface{}{"bid": spreadInfo.BidPrice, "ask": spreadInfo.AskPrice, "status": status})
+	if !kraken.EntriesAllowed(status) {
+		return "", nil
+	}
+
+	buyTxId, sellTxId, estimatedProfit, _, err := kraken.PlaceSpreadOrders(ctx, opts.Coin, pair, spreadInfo, opts.Volume, false, opts.NarrowFactor, nil, opts.MakerFeePercent, kraken.UserRef(tradeID))
+	if err != nil {
+		return "", err
+	}
+	if err := journal.StartTrade(store.Trade{ID: tradeID, Pair: pair.WSName, Volume: opts.Volume, StartedAt: time.Now()}); err != nil {
+		return "", err
+	}
+	for side, txId := range map[string]string{"buy": buyTxId, "sell": sellTxId} {
+		if err := journal.RecordOrder(store.Order{TxID: txId, TradeID: tradeID, Side: side, Volume: opts.Volume, PlacedAt: time.Now()}); err != nil {
+			return "", err
+		}
+	}
+	emit(events.OrdersPlaced, map[string]interface{}{"buy_txid": buyTxId, "sell_txid": sellTxId, "estimated_profit_usd": estimatedProfit})
+
+	finish := func(result string, buy *kraken.OrderStatus, sell *kraken.OrderStatus) (string, error) {
+		r := store.TradeResult{Result: result, EstimatedProfit: estimatedProfit, FinishedAt: time.Now()}
+		if buy != nil && sell != nil {
+			// P&L of the volume both legs executed, like the trader reports it
+			execution := kraken.ExecutionOf(buy, sell)
+			r.BuyPrice, r.SellPrice = execution.BuyPrice, execution.SellPrice
+			r.Fees = execution.BuyFee + execution.SellFee
+			r.GrossProfit = execution.GrossProfit
+		}
+		emit(events.Result, map[string]interface{}{"result": result, "gross_profit": r.GrossProfit, "fees": r.Fees})
+		return result, journal.FinishTrade(tradeID, r)
+	}
+	// cancelOpen cancels the legs that are still open, e.g. when the run ends mid-trade
+	cancelOpen := func(result string, buy *kraken.OrderStatus, sell *kraken.OrderStatus) (string, error) {
+		for _, leg := range []struct {
+			txId  string
+			order *kraken.OrderStatus
+		}{{buyTxId, buy}, {sellTxId, sell}} {
+			if leg.order == nil || leg.order.Status == "open" {
+				if err := kraken.CancelOrder(context.WithoutCancel(ctx), leg.txId); err != nil {
+					slog.Warn("Failed to cancel soak order", "txid", leg.txId, "error", err)
+				}
+			}
+		}
+		return finish(result, buy, sell)
+	}
+
+	lastFill := map[string]string{}
+	var buy, sell *kraken.OrderStatus
+	checks, legWaited := 0, 0
+	for {
+		select {
+		case <-ctx.Done():
+			return cancelOpen("interrupted", buy, sell)
+		case <-time.After(opts.CheckInterval):
+		}
+		checks++
+
+		for _, leg := range []struct {
+			txId  *string
+			order **kraken.OrderStatus
+		}{{&buyTxId, &buy}, {&sellTxId, &sell}} {
+			order, err := kraken.CheckOrderStatus(ctx, *leg.txId)
+			if err != nil {
+				if ctx.Err() != nil {
+					return cancelOpen("interrupted", buy, sell)
+				}
+				result, _ := cancelOpen("failed", buy, sell)
+				return result, err
+			}
+			*leg.order = order
+			if state := order.Status + "/" + order.VolExec; lastFill[*leg.txId] != state {
+				lastFill[*leg.txId] = state
+				emit(events.Fill, map[string]interface{}{"txid": *leg.txId, "status": order.Status, "vol_exec": order.VolExec})
+				if err := journal.RecordFill(store.Fill{TxID: *leg.txId, Status: order.Status, Price: kraken.ParseFloat(order.Descr.Price), VolExec: kraken.ParseFloat(order.VolExec), Cost: kraken.ParseFloat(order.Cost), Fee: kraken.ParseFloat(order.Fee), ObservedAt: time.Now()}); err != nil {
+					return "", err
+				}
+			}
+		}
+
+		buyDone, sellDone := buy.Status == "closed", sell.Status == "closed"
+		switch {
+		case buyDone && sellDone:
+			return finish("complete", buy, sell)
+		case !buyDone && !sellDone:
+			if kraken.ParseFloat(buy.VolExec) == 0 && kraken.ParseFloat(sell.VolExec) == 0 && checks >= opts.MaxWait {
+				return cancelOpen("order_timeout", buy, sell)
+			}
+			// Both legs partially filled
+			if checks >= opts.MaxWait+opts.MaxHold {
+				return cancelOpen("abandoned", buy, sell)
+			}
+			continue
+		}
+
+		// One leg filled, reprice the other once it stalls and give up after MaxHold checks
+		legWaited++
+		if legWaited >= opts.MaxHold {
+			return cancelOpen("abandoned", buy, sell)
+		}
+		stalledTxId, stalled, filled, isBuy := &sellTxId, sell, buy, false
+		if sellDone {
+			stalledTxId, stalled, filled, isBuy = &buyTxId, buy, sell, true
+		}
+		if legWaited%opts.LegTimeout != 0 || kraken.ParseFloat(stalled.VolExec) > 0 {
+			continue
+		}
+		market, err := kraken.GetTickerInfo(ctx, opts.Coin)
+		if err != nil {
+			continue
+		}
+		limit := kraken.RepriceLimit(isBuy, kraken.ParseFloat(filled.Descr.Price), opts.MaxLossPercent)
+		price, move := kraken.RepricePrice(pair, isBuy, kraken.ParseFloat(stalled.Descr.Price), market, opts.RepriceStep, limit)
+		if !move {
+			continue
+		}
+		newTxId, err := kraken.EditOrder(ctx, pair, *stalledTxId, price)
+		if err != nil {
+			// The leg may have filled in the meantime, the next check tells
+			continue
+		}
+		emit(events.Reprice, map[string]interface{}{"txid": *stalledTxId, "new_txid": newTxId, "price": price})
+		if err := journal.RecordOrder(store.Order{TxID: newTxId, TradeID: tradeID, Side: stalled.Descr.Type, Volume: opts.Volume, PlacedAt: time.Now()}); err != nil {
+			return "", err
+		}
+		*stalledTxId = newTxId
+	}
+}
@@ -0,0 +1,174 @@
+package store
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// Execution is a fill from the exchange's own trade history (TradesHistory), imported to
+// reconcile the journal against and to report on trades the journal doesn't know
+type Execution struct {
+	TxID       string // trade ID of the execution
+	OrderTxID  string
+	Pair       string // Kraken pair name, e.g. XXBTZUSD
+	ExecutedAt time.Time
+	Side       string // buy or sell
+	Price      float64
+	Volume     float64
+	Cost       float64
+	Fee        float64
+}
+
+// LedgerEntry is a balance movement from the exchange's ledger
+type LedgerEntry struct {
+	ID       string
+	RefID    string
+	BookedAt time.Time
+	Type     string // trade, deposit, withdrawal, transfer, staking, ...
+	Asset    string
+	Amount   float64
+	Fee      float64
+	Balance  float64
+}
+
+// ImportExecutions stores executions not imported yet and returns how many were new
+func (s *Store) ImportExecutions(executions []Execution) (int, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("error importing executions: %v", err)
+	}
+	defer tx.Rollback()
+
+	imported := 0
+	for _, e := range executions {
+		result, err := tx.Exec(`INSERT OR IGNORE INTO executions (txid, order_txid, pair, executed_at, side, price, volume, cost, fee)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			e.TxID, e.OrderTxID, e.Pair, e.ExecutedAt.UTC(), e.Side, e.Price, e.Volume, e.Cost, e.Fee)
+		if err != nil {
+			return 0, fmt.Errorf("error importing execution %s: %v", e.TxID, err)
+		}
+		if n, _ := result.RowsAffected(); n > 0 {
+			imported++
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("error importing executions: %v", err)
+	}
+	return imported, nil
+}
+
+// ImportLedger stores ledger entries not imported yet and returns how many were new
+func (s *Store) ImportLedger(entries []LedgerEntry) (int, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("error importing ledger: %v", err)
+	}
+	defer tx.Rollback()
+
+	imported := 0
+	for _, e := range entries {
+		result, err := tx.Exec(`INSERT OR IGNORE INTO ledger (id, refid, booked_at, type, asset, amount, fee, balance)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+			e.ID, e.RefID, e.BookedAt.UTC(), e.Type, e.Asset, e.Amount, e.Fee, e.Balance)
+		if err != nil {
+			return 0, fmt.Errorf("error importing ledger entry %s: %v", e.ID, err)
+		}
+		if n, _ := result.RowsAffected(); n > 0 {
+			imported++
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("error importing ledger: %v", err)
+	}
+	return imported, nil
+}
+
+// LastExecution returns the time of the latest imported execution, zero if none was imported
+func (s *Store) LastExecution() (time.Time, error) {
+	return s.latest(`SELECT executed_at FROM executions ORDER BY executed_at DESC LIMIT 1`)
+}
+
+// LastLedgerEntry returns the time of the latest imported ledger entry, zero if none was imported
+func (s *Store) LastLedgerEntry() (time.Time, error) {
+	return s.latest(`SELECT booked_at FROM ledger ORDER BY booked_at DESC LIMIT 1`)
+}
+
+// latest runs a query selecting a single time, zero without rows
+func (s *Store) latest(query string) (time.Time, error) {
+	var t time.Time
+	err := s.db.QueryRow(query).Scan(&t)
+	if err == sql.ErrNoRows {
+		return time.Time{}, nil
+	}
+	if err != nil {
+		return time.Time{}, fmt.Errorf("error querying the last import: %v", err)
+	}
+	return t, nil
+}
+
+// Executions returns the imported executions in [since, until), oldest first. Zero times leave the
+// range open.
+func (s *Store) Executions(since time.Time, until time.Time) ([]Execution, error) {
+	query := `SELECT txid, order_txid, pair, executed_at, side, price, volume, cost, fee FROM executions WHERE 1 = 1`
+	query, args := timeRange(query, "executed_at", since, until)
+	rows, err := s.db.Query(query+" ORDER BY executed_at, txid", args...)
+	if err != nil {
+		return nil, fmt.Errorf("error querying executions: %v", err)
+	}
+	defer rows.Close()
+
+	var executions []Execution
+	for rows.Next() {
+		var e Execution
+		if err := rows.Scan(&e.TxID, &e.OrderTxID, &e.Pair, &e.ExecutedAt, &e.Side, &e.Price, &e.Volume, &e.Cost, &e.Fee); err != nil {
+			return nil, fmt.Errorf("error reading execution: %v", err)
+		}
+		executions = append(executions, e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error reading executions: %v", err)
+	}
+	return executions, nil
+}
+
+// Ledger returns the imported ledger entries booked in [since, until), oldest first. Zero times
+// leave the range open.
+func (s *Store) Ledger(since time.Time, until time.Time) ([]LedgerEntry, error) {
+	query := `SELECT id, refid, booked_at, type, asset, amount, fee, balance FROM ledger WHERE 1 = 1`
+	query, args := timeRange(query, "booked_at", since, until)
+	rows, err := s.db.Query(query+" ORDER BY booked_at, id", args...)
+	if err != nil {
+		return nil, fmt.Errorf("error querying ledger: %v", err)
+	}
+	defer rows.Close()
+
+	var entries []LedgerEntry
+	for rows.Next() {
+		var e LedgerEntry
+		if err := rows.Scan(&e.ID, &e.RefID, &e.BookedAt, &e.Type, &e.Asset, &e.Amount, &e.Fee, &e.Balance); err != nil {
+			return nil, fmt.Errorf("error reading ledger entry: %v", err)
+		}
+		entries = append(entries, e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error reading ledger: %v", err)
+	}
+	return entries, nil
+}
+
+// timeRange restricts a query to column in [since, until), zero times leave the range open
+func timeRange(query string, column string, since time.Time, until time.Time) (string, []interface{}) {
+	var args []interface{}
+	if !since.IsZero() {
+		query += " AND " + column + " >= ?"
+		args = append(args, since.UTC())
+	}
+	if !until.IsZero() {
+		query += " AND " + column + " < ?"
+		args = append(args, until.UTC())
+	}
+	return query, args
+}
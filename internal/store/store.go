@@ -0,0 +1,393 @@
+// Package store keeps a local SQLite journal of trades: every placed order, each observed
+// fill, the fees and the realised P&L.
+package store
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/jkosik/crypto-trader/internal/money"
+	_ "modernc.org/sqlite"
+)
+
+// schema is applied on every open, statements must be idempotent
+const schema = `
+CREATE TABLE IF NOT EXISTS trades (
+	id               TEXT PRIMARY KEY,
+	pair             TEXT NOT NULL,
+	volume           REAL NOT NULL,
+	untradeable      INTEGER NOT NULL,
+	started_at       TIMESTAMP NOT NULL,
+	finished_at      TIMESTAMP,
+	result           TEXT,
+	buy_price        REAL,
+	sell_price       REAL,
+	fees             REAL,
+	gross_profit     REAL,
+	net_profit       REAL,
+	estimated_profit REAL
+);
+CREATE TABLE IF NOT EXISTS orders (
+	txid       TEXT PRIMARY KEY,
+	trade_id   TEXT NOT NULL REFERENCES trades(id),
+	side       TEXT NOT NULL,
+	volume     REAL NOT NULL,
+	price      REAL,
+	status     TEXT NOT NULL,
+	vol_exec   REAL NOT NULL DEFAULT 0,
+	cost       REAL NOT NULL DEFAULT 0,
+	fee        REAL NOT NULL DEFAULT 0,
+	placed_at  TIMESTAMP NOT NULL,
+	updated_at TIMESTAMP NOT NULL
+);
+CREATE TABLE IF NOT EXISTS fills (
+	id          INTEGER PRIMARY KEY AUTOINCREMENT,
+	txid        TEXT NOT NULL REFERENCES orders(txid),
+	status      TEXT NOT NULL,
+	price       REAL,
+	vol_exec    REAL NOT NULL,
+	cost        REAL NOT NULL,
+	fee         REAL NOT NULL,
+	observed_at TIMESTAMP NOT NULL
+);
+CREATE TABLE IF NOT EXISTS snapshots (
+	id       INTEGER PRIMARY KEY AUTOINCREMENT,
+	trade_id TEXT NOT NULL REFERENCES trades(id),
+	reason   TEXT NOT NULL,
+	taken_at TIMESTAMP NOT NULL,
+	book     TEXT NOT NULL,
+	trades   TEXT NOT NULL
+);
+CREATE TABLE IF NOT EXISTS executions (
+	txid        TEXT PRIMARY KEY,
+	order_txid  TEXT NOT NULL,
+	pair        TEXT NOT NULL,
+	executed_at TIMESTAMP NOT NULL,
+	side        TEXT NOT NULL,
+	price       REAL NOT NULL,
+	volume      REAL NOT NULL,
+	cost        REAL NOT NULL,
+	fee         REAL NOT NULL
+);
+CREATE TABLE IF NOT EXISTS ledger (
+	id        TEXT PRIMARY KEY,
+	refid     TEXT NOT NULL,
+	booked_at TIMESTAMP NOT NULL,
+	type      TEXT NOT NULL,
+	asset     TEXT NOT NULL,
+	amount    REAL NOT NULL,
+	fee       REAL NOT NULL,
+	balance   REAL NOT NULL
+);
+CREATE INDEX IF NOT EXISTS orders_trade_id ON orders(trade_id);
+CREATE INDEX IF NOT EXISTS fills_txid ON fills(txid);
+CREATE INDEX IF NOT EXISTS snapshots_trade_id ON snapshots(trade_id);
+CREATE INDEX IF NOT EXISTS executions_order_txid ON executions(order_txid);
+CREATE INDEX IF NOT EXISTS executions_executed_at ON executions(executed_at);
+CREATE INDEX IF NOT EXISTS ledger_booked_at ON ledger(booked_at);
+`
+
+// Trade is a single spread trade (one buy and one sell order)
+type Trade struct {
+	ID          string
+	Pair        string
+	Volume      float64
+	Untradeable bool
+	StartedAt   time.Time
+}
+
+// Order is an order accepted by the exchange
+type Order struct {
+	TxID     string
+	TradeID  string
+	Side     string // buy or sell
+	Volume   float64
+	PlacedAt time.Time
+}
+
+// Fill is an observed order state. Kraken reports cumulative executed volume, cost and fee.
+type Fill struct {
+	TxID       string
+	Status     string
+	Price      float64
+	VolExec    float64
+	Cost       float64
+	Fee        float64
+	ObservedAt time.Time
+}
+
+// TradeResult is the final outcome of a trade
+type TradeResult struct {
+	Result          string // complete or canceled
+	BuyPrice        float64
+	SellPrice       float64
+	Fees            float64
+	GrossProfit     float64
+	NetProfit       float64
+	EstimatedProfit float64
+	FinishedAt      time.Time
+}
+
+// Snapshot is the market at a moment a trade went wrong, for post-mortems: the top of the
+// order book and the last public trades, both as JSON documents
+type Snapshot struct {
+	TradeID string
+	Reason  string // e.g. cancel_incomplete, leg_at_max_loss, leg_abandoned, external_activity
+	TakenAt time.Time
+	Book    json.RawMessage
+	Trades  json.RawMessage
+}
+
+// Store is an open trade journal
+type Store struct {
+	db *sql.DB
+}
+
+// Open opens or creates the journal at path
+func Open(path string) (*Store, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, fmt.Errorf("error creating journal directory: %v", err)
+	}
+	// WAL keeps the journal consistent if the process dies mid-write
+	db, err := sql.Open("sqlite", path+"?_pragma=journal_mode(WAL)&_pragma=busy_timeout(5000)&_pragma=foreign_keys(1)")
+	if err != nil {
+		return nil, fmt.Errorf("error opening journal: %v", err)
+	}
+	if _, err := db.Exec(schema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("error creating journal schema: %v", err)
+	}
+	return &Store{db: db}, nil
+}
+
+// Close closes the journal
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+// StartTrade records a new trade
+func (s *Store) StartTrade(t Trade) error {
+	_, err := s.db.Exec(`INSERT INTO trades (id, pair, volume, untradeable, started_at) VALUES (?, ?, ?, ?, ?)`,
+		t.ID, t.Pair, t.Volume, t.Untradeable, t.StartedAt.UTC())
+	if err != nil {
+		return fmt.Errorf("error recording trade %s: %v", t.ID, err)
+	}
+	return nil
+}
+
+// RecordOrder records an order placed for a trade
+func (s *Store) RecordOrder(o Order) error {
+	_, err := s.db.Exec(`INSERT INTO orders (txid, trade_id, side, volume, status, placed_at, updated_at) VALUES (?, ?, ?, ?, 'open', ?, ?)`,
+		o.TxID, o.TradeID, o.Side, o.Volume, o.PlacedAt.UTC(), o.PlacedAt.UTC())
+	if err != nil {
+		return fmt.Errorf("error recording order %s: %v", o.TxID, err)
+	}
+	return nil
+}
+
+// RecordFill appends an observed order state and updates the order with it
+func (s *Store) RecordFill(f Fill) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("error recording fill for %s: %v", f.TxID, err)
+	}
+	defer tx.Rollback()
+
+	observedAt := f.ObservedAt.UTC()
+	if _, err := tx.Exec(`INSERT INTO fills (txid, status, price, vol_exec, cost, fee, observed_at) VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		f.TxID, f.Status, f.Price, f.VolExec, f.Cost, f.Fee, observedAt); err != nil {
+		return fmt.Errorf("error recording fill for %s: %v", f.TxID, err)
+	}
+	if _, err := tx.Exec(`UPDATE orders SET status = ?, price = ?, vol_exec = ?, cost = ?, fee = ?, updated_at = ? WHERE txid = ?`,
+		f.Status, f.Price, f.VolExec, f.Cost, f.Fee, observedAt, f.TxID); err != nil {
+		return fmt.Errorf("error updating order %s: %v", f.TxID, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error recording fill for %s: %v", f.TxID, err)
+	}
+	return nil
+}
+
+// FinishTrade records the outcome and P&L of a trade. Fees and profits are rounded with the
+// money policy in the trade's quote currency, the net profit is the rounded gross minus the rounded fees.
+func (s *Store) FinishTrade(id string, r TradeResult) error {
+	var pair string
+	if err := s.db.QueryRow(`SELECT pair FROM trades WHERE id = ?`, id).Scan(&pair); err != nil {
+		return fmt.Errorf("error finishing trade %s: %v", id, err)
+	}
+	_, quote, _ := strings.Cut(pair, "/")
+	r.Fees = money.Round(r.Fees, quote)
+	r.GrossProfit = money.Round(r.GrossProfit, quote)
+	r.NetProfit = money.Round(r.GrossProfit-r.Fees, quote)
+	r.EstimatedProfit = money.Round(r.EstimatedProfit, quote)
+
+	_, err := s.db.Exec(`UPDATE trades SET finished_at = ?, result = ?, buy_price = ?, sell_price = ?, fees = ?,
+		gross_profit = ?, net_profit = ?, estimated_profit = ? WHERE id = ?`,
+		r.FinishedAt.UTC(), r.Result, r.BuyPrice, r.SellPrice, r.Fees, r.GrossProfit, r.NetProfit, r.EstimatedProfit, id)
+	if err != nil {
+		return fmt.Errorf("error finishing trade %s: %v", id, err)
+	}
+	return nil
+}
+
+// TradeRecord is a journaled trade with its outcome
+type TradeRecord struct {
+	ID              string
+	Pair            string
+	Volume          float64
+	Untradeable     bool
+	StartedAt       time.Time
+	FinishedAt      time.Time // zero while the trade is open
+	Result          string    // complete, canceled or empty while open
+	BuyPrice        float64
+	SellPrice       float64
+	Fees            float64
+	GrossProfit     float64
+	NetProfit       float64
+	EstimatedProfit float64
+}
+
+// Trades returns the trades started in [since, until), oldest first. Zero times leave the range open.
+func (s *Store) Trades(since time.Time, until time.Time) ([]TradeRecord, error) {
+	query := `SELECT id, pair, volume, untradeable, started_at, finished_at, COALESCE(result, ''),
+		COALESCE(buy_price, 0), COALESCE(sell_price, 0), COALESCE(fees, 0), COALESCE(gross_profit, 0),
+		COALESCE(net_profit, 0), COALESCE(estimated_profit, 0)
+		FROM trades WHERE 1 = 1`
+	var args []interface{}
+	if !since.IsZero() {
+		query += " AND started_at >= ?"
+		args = append(args, since.UTC())
+	}
+	if !until.IsZero() {
+		query += " AND started_at < ?"
+		args = append(args, until.UTC())
+	}
+	query += " ORDER BY started_at"
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("error querying trades: %v", err)
+	}
+	defer rows.Close()
+
+	var trades []TradeRecord
+	for rows.Next() {
+		var t TradeRecord
+		var finishedAt sql.NullTime
+		if err := rows.Scan(&t.ID, &t.Pair, &t.Volume, &t.Untradeable, &t.StartedAt, &finishedAt, &t.Result,
+			&t.BuyPrice, &t.SellPrice, &t.Fees, &t.GrossProfit, &t.NetProfit, &t.EstimatedProfit); err != nil {
+			return nil, fmt.Errorf("error reading trade: %v", err)
+		}
+		t.FinishedAt = finishedAt.Time
+		trades = append(trades, t)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error reading trades: %v", err)
+	}
+	return trades, nil
+}
+
+// RealizedPnL returns the net profit of the trades finished in [since, until), losses negative.
+// A zero until leaves the range open.
+func (s *Store) RealizedPnL(since time.Time, until time.Time) (float64, error) {
+	query := `SELECT COALESCE(SUM(net_profit), 0) FROM trades WHERE finished_at IS NOT NULL AND finished_at >= ?`
+	args := []interface{}{since.UTC()}
+	if !until.IsZero() {
+		query += " AND finished_at < ?"
+		args = append(args, until.UTC())
+	}
+	var pnl float64
+	if err := s.db.QueryRow(query, args...).Scan(&pnl); err != nil {
+		return 0, fmt.Errorf("error summing realized P&L: %v", err)
+	}
+	return pnl, nil
+}
+
+// HasOrder reports whether the order was placed by the bot
+func (s *Store) HasOrder(txid string) (bool, error) {
+	var count int
+	if err := s.db.QueryRow(`SELECT COUNT(*) FROM orders WHERE txid = ?`, txid).Scan(&count); err != nil {
+		return false, fmt.Errorf("error querying order %s: %v", txid, err)
+	}
+	return count > 0, nil
+}
+
+// OrderRecord is a journaled order with its last observed state
+type OrderRecord struct {
+	TxID     string
+	TradeID  string
+	Side     string
+	Volume   float64
+	Status   string
+	VolExec  float64
+	Cost     float64
+	Fee      float64
+	PlacedAt time.Time
+}
+
+// Order returns a journaled order, nil if the order isn't journaled
+func (s *Store) Order(txid string) (*OrderRecord, error) {
+	var o OrderRecord
+	err := s.db.QueryRow(`SELECT txid, trade_id, side, volume, status, vol_exec, cost, fee, placed_at FROM orders WHERE txid = ?`, txid).
+		Scan(&o.TxID, &o.TradeID, &o.Side, &o.Volume, &o.Status, &o.VolExec, &o.Cost, &o.Fee, &o.PlacedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error querying order %s: %v", txid, err)
+	}
+	return &o, nil
+}
+
+// TradeOfOrder returns the ID of the trade an order belongs to, "" if the order isn't journaled
+func (s *Store) TradeOfOrder(txid string) (string, error) {
+	var id string
+	err := s.db.QueryRow(`SELECT trade_id FROM orders WHERE txid = ?`, txid).Scan(&id)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("error querying order %s: %v", txid, err)
+	}
+	return id, nil
+}
+
+// RecordSnapshot stores a market snapshot taken for a trade
+func (s *Store) RecordSnapshot(snap Snapshot) error {
+	_, err := s.db.Exec(`INSERT INTO snapshots (trade_id, reason, taken_at, book, trades) VALUES (?, ?, ?, ?, ?)`,
+		snap.TradeID, snap.Reason, snap.TakenAt.UTC(), string(snap.Book), string(snap.Trades))
+	if err != nil {
+		return fmt.Errorf("error recording snapshot for trade %s: %v", snap.TradeID, err)
+	}
+	return nil
+}
+
+// Snapshots returns the market snapshots of a trade, oldest first
+func (s *Store) Snapshots(tradeID string) ([]Snapshot, error) {
+	rows, err := s.db.Query(`SELECT trade_id, reason, taken_at, book, trades FROM snapshots WHERE trade_id = ? ORDER BY id`, tradeID)
+	if err != nil {
+		return nil, fmt.Errorf("error querying snapshots: %v", err)
+	}
+	defer rows.Close()
+
+	var snapshots []Snapshot
+	for rows.Next() {
+		var snap Snapshot
+		var book, trades string
+		if err := rows.Scan(&snap.TradeID, &snap.Reason, &snap.TakenAt, &book, &trades); err != nil {
+			return nil, fmt.Errorf("error reading snapshot: %v", err)
+		}
+		snap.Book, snap.Trades = json.RawMessage(book), json.RawMessage(trades)
+		snapshots = append(snapshots, snap)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error reading snapshots: %v", err)
+	}
+	return snapshots, nil
+}
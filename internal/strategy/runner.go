@@ -0,0 +1,273 @@
+package strategy
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/jkosik/crypto-trader/internal/kraken"
+	"github.com/jkosik/crypto-trader/internal/logging"
+	"github.com/jkosik/crypto-trader/internal/maker"
+	"github.com/jkosik/crypto-trader/internal/store"
+)
+
+// ErrLossLimit stops the runner once the realized loss uses up its loss budget
+var ErrLossLimit = errors.New("realized loss reached the daily loss limit")
+
+// Runner runs a strategy on one pair. All its orders share the userref of the session and are
+// journaled under one trade, started with the first order and finished with the strategy's name
+// as the result.
+type Runner struct {
+	name         string
+	coin         string
+	pair         *kraken.AssetPair
+	strategy     Strategy
+	journal      *store.Store // nil disables journaling
+	tradeID      string
+	userref      int32
+	pollInterval time.Duration
+	lossBudget   float64 // stop once the realized loss reaches this many USD, 0 disables
+	started      bool
+	live         map[string]*liveOrder // by Order.Key
+	stats        maker.Stats
+}
+
+// liveOrder is an order of the strategy with the fills seen so far
+type liveOrder struct {
+	order   Order
+	txId    string
+	status  string
+	volExec float64
+	cost    float64
+	fee     float64
+}
+
+// NewRunner returns a runner of the strategy registered as name on the coin's USD pair
+func NewRunner(name string, coin string, pair *kraken.AssetPair, s Strategy, journal *store.Store, tradeID string, pollInterval time.Duration, lossBudget float64) *Runner {
+	return &Runner{
+		name:         name,
+		coin:         coin,
+		pair:         pair,
+		strategy:     s,
+		journal:      journal,
+		tradeID:      tradeID,
+		userref:      kraken.UserRef(tradeID),
+		pollInterval: pollInterval,
+		lossBudget:   lossBudget,
+		live:         map[string]*liveOrder{},
+	}
+}
+
+// Stats returns the fills so far
+func (r *Runner) Stats() maker.Stats {
+	return r.stats
+}
+
+// Run feeds the strategy market updates and fills and keeps its desired orders live until the
+// context is canceled, a Finisher is done or the loss budget is used up. Failed requests are logged
+// and retried on the next poll, an error of the strategy stops the run. Orders still live are left
+// for Finish.
+func (r *Runner) Run(ctx context.Context) error {
+	log := logging.FromContext(ctx)
+	ticker := time.NewTicker(r.pollInterval)
+	defer ticker.Stop()
+
+	for {
+		for _, key := range r.keys() {
+			if err := r.poll(ctx, r.live[key]); err != nil {
+				if ctx.Err() != nil {
+					return ctx.Err()
+				}
+				log.Warn("Failed to check order", "txid", r.live[key].txId, "key", key, "error", err)
+			}
+		}
+
+		if _, net := r.stats.Realized(); r.lossBudget > 0 && net <= -r.lossBudget {
+			return ErrLossLimit
+		}
+		if f, ok := r.strategy.(Finisher); ok && f.Done() && len(r.live) == 0 {
+			return nil
+		}
+
+		spread, err := kraken.GetTickerInfo(ctx, r.coin)
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			log.Warn("Failed to get ticker", "error", err)
+		} else if err := r.strategy.OnTick(ctx, Tick{Time: time.Now(), Spread: spread, Inventory: r.stats.Inventory()}); err != nil {
+			return err
+		}
+
+		if err := r.reconcile(ctx); err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			log.Warn("Failed to update orders", "error", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// reconcile cancels the live orders the strategy no longer wants as they are and places the
+// desired ones that aren't live
+func (r *Runner) reconcile(ctx context.Context) error {
+	desired := map[string]Order{}
+	for _, order := range r.strategy.DesiredOrders() {
+		desired[order.Key] = order
+	}
+
+	for _, key := range r.keys() {
+		live := r.live[key]
+		if want, ok := desired[key]; ok && want == live.order {
+			continue
+		}
+		if err := kraken.CancelOrder(ctx, live.txId); err != nil {
+			return err
+		}
+		logging.FromContext(ctx).Info("Canceled order", "key", key, "txid", live.txId)
+		// The last fills are accounted before the order is placed again
+		if err := r.poll(ctx, live); err != nil {
+			return err
+		}
+	}
+
+	keys := make([]string, 0, len(desired))
+	for key := range desired {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if r.live[key] != nil {
+			continue
+		}
+		if err := r.place(ctx, desired[key]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// poll refreshes an order's status, accounts its new fills, drops it once done and reports the
+// change to the strategy
+func (r *Runner) poll(ctx context.Context, live *liveOrder) error {
+	status, err := kraken.CheckOrderStatus(ctx, live.txId)
+	if err != nil {
+		return err
+	}
+	volExec, cost, fee := kraken.ParseFloat(status.VolExec), kraken.ParseFloat(status.Cost), kraken.ParseFloat(status.Fee)
+	if status.Status == live.status && volExec == live.volExec {
+		return nil
+	}
+
+	// Kraken reports cumulative amounts, only the difference is new
+	if live.order.Side == "buy" {
+		r.stats.Bought += volExec - live.volExec
+		r.stats.BoughtUSD += cost - live.cost
+	} else {
+		r.stats.Sold += volExec - live.volExec
+		r.stats.SoldUSD += cost - live.cost
+	}
+	r.stats.Fees += fee - live.fee
+	live.status, live.volExec, live.cost, live.fee = status.Status, volExec, cost, fee
+
+	if r.journal != nil {
+		fill := store.Fill{
+			TxID:       live.txId,
+			Status:     live.status,
+			Price:      kraken.ParseFloat(status.Descr.Price),
+			VolExec:    live.volExec,
+			Cost:       live.cost,
+			Fee:        live.fee,
+			ObservedAt: time.Now(),
+		}
+		if err := r.journal.RecordFill(fill); err != nil {
+			logging.FromContext(ctx).Warn("Failed to record fill in journal", "txid", live.txId, "error", err)
+		}
+	}
+
+	if kraken.OrderDone(live.status) {
+		if live.status == "closed" && live.order.Side == "buy" {
+			r.stats.BuyFills++
+		} else if live.status == "closed" {
+			r.stats.SellFills++
+		}
+		delete(r.live, live.order.Key)
+	}
+	logging.FromContext(ctx).Info("Order updated", "key", live.order.Key, "txid", live.txId, "status", live.status,
+		"vol_exec", r.pair.FormatVolume(live.volExec), "price", r.pair.FormatPrice(live.order.Price))
+	return r.strategy.OnFill(ctx, Fill{Order: live.order, TxID: live.txId, Status: live.status, VolExec: live.volExec, Cost: live.cost, Fee: live.fee})
+}
+
+// place places a desired order and journals it
+func (r *Runner) place(ctx context.Context, order Order) error {
+	txId, err := kraken.PlaceLimitOrder(ctx, r.pair, order.Price, order.Volume, order.Side == "buy", false, r.userref)
+	if err != nil {
+		return err
+	}
+	r.live[order.Key] = &liveOrder{order: order, txId: txId, status: "open"}
+	log := logging.FromContext(ctx)
+	log.Info("Placed strategy order", "key", order.Key, "type", order.Side, "txid", txId,
+		"price", r.pair.FormatPrice(order.Price), "volume", r.pair.FormatVolume(order.Volume))
+
+	if r.journal == nil {
+		return nil
+	}
+	if !r.started {
+		if err := r.journal.StartTrade(store.Trade{ID: r.tradeID, Pair: kraken.PairName(r.coin), Volume: order.Volume, StartedAt: time.Now()}); err != nil {
+			log.Warn("Failed to record trade in journal", "error", err)
+			return nil
+		}
+		r.started = true
+	}
+	if err := r.journal.RecordOrder(store.Order{TxID: txId, TradeID: r.tradeID, Side: order.Side, Volume: order.Volume, PlacedAt: time.Now()}); err != nil {
+		log.Warn("Failed to record order in journal", "txid", txId, "error", err)
+	}
+	return nil
+}
+
+// Finish cancels the live orders, accounts their last fills and journals the session's result
+func (r *Runner) Finish(ctx context.Context) {
+	log := logging.FromContext(ctx)
+	for _, key := range r.keys() {
+		live := r.live[key]
+		if err := kraken.CancelOrder(ctx, live.txId); err != nil {
+			log.Error("Failed to cancel order, it's left open", "txid", live.txId, "key", key, "error", err)
+			continue
+		}
+		if err := r.poll(ctx, live); err != nil {
+			log.Warn("Failed to check canceled order", "txid", live.txId, "error", err)
+		}
+	}
+
+	if r.journal == nil || !r.started {
+		return
+	}
+	gross, net := r.stats.Realized()
+	result := store.TradeResult{Result: r.name, Fees: r.stats.Fees, GrossProfit: gross, NetProfit: net, FinishedAt: time.Now()}
+	if r.stats.Bought > 0 {
+		result.BuyPrice = r.stats.BoughtUSD / r.stats.Bought
+	}
+	if r.stats.Sold > 0 {
+		result.SellPrice = r.stats.SoldUSD / r.stats.Sold
+	}
+	if err := r.journal.FinishTrade(r.tradeID, result); err != nil {
+		log.Warn("Failed to finish trade in journal", "error", err)
+	}
+}
+
+// keys returns the keys of the live orders in order, so orders are handled deterministically
+func (r *Runner) keys() []string {
+	keys := make([]string, 0, len(r.live))
+	for key := range r.live {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
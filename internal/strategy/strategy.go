@@ -0,0 +1,104 @@
+// Package strategy defines the interface of the trading strategies behind `trader strategy` and the
+// runner that turns the orders a strategy wants into placed and canceled limit orders. A strategy
+// registers itself by name from its own file, so grid, DCA or momentum strategies can be added
+// without touching cmd/trader. The spread trade is registered as spread by internal/trader.
+package strategy
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/jkosik/crypto-trader/internal/config"
+	"github.com/jkosik/crypto-trader/internal/kraken"
+)
+
+// Strategy decides which limit orders should be live. The runner calls OnTick with every market
+// update, OnFill whenever one of the strategy's orders changes, and then reconciles the live
+// orders with DesiredOrders.
+type Strategy interface {
+	OnTick(ctx context.Context, tick Tick) error
+	OnFill(ctx context.Context, fill Fill) error
+	DesiredOrders() []Order
+}
+
+// Finisher is implemented by strategies that end on their own, like the spread trade.
+// The runner stops once Done reports true and no order is live.
+type Finisher interface {
+	Done() bool
+}
+
+// Tick is a market update
+type Tick struct {
+	Time      time.Time
+	Spread    *kraken.SpreadInfo // nil if the caller didn't fetch the ticker, the strategy fetches it when it needs it
+	Inventory float64            // base coin bought beyond what was sold since the start
+}
+
+// Order is a limit order a strategy wants live. The key identifies it across ticks: a desired key
+// without a live order is placed, a live order whose key is no longer desired, or whose price or
+// volume changed, is canceled (and placed again at the new price or volume).
+type Order struct {
+	Key    string
+	Side   string // buy or sell
+	Price  float64
+	Volume float64
+}
+
+// Fill is a change of one of the strategy's orders, amounts are cumulative like Kraken reports them
+type Fill struct {
+	Order   Order
+	TxID    string
+	Status  string
+	VolExec float64
+	Cost    float64
+	Fee     float64
+}
+
+// Params are what every strategy is created with
+type Params struct {
+	Coin            string // base coin, e.g. BTC
+	Pair            *kraken.AssetPair
+	Volume          float64 // base coin volume of a trade
+	MakerFeePercent float64
+	Config          *config.Config // the coin's effective config
+}
+
+// Factory creates a strategy
+type Factory func(params Params) (Strategy, error)
+
+var factories = map[string]Factory{}
+
+// Register makes a strategy available by name, strategies call it from init
+func Register(name string, factory Factory) {
+	if _, exists := factories[name]; exists {
+		panic("strategy " + name + " registered twice")
+	}
+	factories[name] = factory
+}
+
+// New creates the strategy registered by name
+func New(name string, params Params) (Strategy, error) {
+	factory, ok := factories[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown strategy %q, available: %v", name, Names())
+	}
+	return factory(params)
+}
+
+// Registered reports whether a strategy is registered by name
+func Registered(name string) bool {
+	_, ok := factories[name]
+	return ok
+}
+
+// Names returns the registered strategies in alphabetical order
+func Names() []string {
+	names := make([]string, 0, len(factories))
+	for name := range factories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
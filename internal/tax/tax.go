@@ -0,0 +1,144 @@
+// Package tax matches the account's sells against earlier buys first in, first out, for a
+// yearly report of disposals with their cost basis, proceeds, fees and gain or loss.
+package tax
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// Fiat are the currencies that are money rather than assets: paying or receiving them is no
+// disposal or acquisition. Any other quote currency, e.g. BTC of ETH/BTC, is an asset of its own.
+var Fiat = map[string]bool{
+	"USD": true, "EUR": true, "GBP": true, "CHF": true, "CAD": true, "AUD": true, "JPY": true,
+}
+
+// Rate returns the value of one unit of a currency or asset in the reporting currency at a time
+type Rate func(currency string, t time.Time) (float64, error)
+
+// Execution is a buy or sell of a coin for a quote currency
+type Execution struct {
+	TxID   string
+	Time   time.Time
+	Asset  string // base coin, e.g. BTC
+	Quote  string // quote currency the cost is in, e.g. USD, EUR or BTC
+	Side   string // buy or sell
+	Volume float64
+	Cost   float64 // quote currency paid (buy) or received (sell), fee excluded
+	Fee    float64 // in the quote currency
+}
+
+// Disposal is a sell matched against the lots it closed, amounts in the reporting currency
+type Disposal struct {
+	TxID      string
+	Time      time.Time
+	Asset     string
+	Quote     string // quote currency of the execution, e.g. EUR or for ETH/BTC buys, which dispose of BTC, ETH
+	Currency  string // reporting currency of the amounts
+	Volume    float64
+	Acquired  time.Time // when the oldest matched lot was acquired, zero without one
+	Proceeds  float64   // value received, fee excluded
+	CostBasis float64   // cost of the matched lots, their buy fees included
+	Fees      float64   // fee of the sell
+	Gain      float64   // Proceeds - CostBasis - Fees, losses negative
+	Unmatched float64   // volume sold without an earlier buy, e.g. deposited coins, its cost basis counts as zero
+}
+
+// lot is what is left of an acquisition
+type lot struct {
+	time   time.Time
+	volume float64
+	cost   float64 // cost of the remaining volume in the reporting currency, its share of the fee included
+}
+
+// fifo holds the remaining lots per asset, oldest first, whatever currency they were bought with
+type fifo map[string][]*lot
+
+// acquire adds a lot of an asset
+func (f fifo) acquire(asset string, t time.Time, volume float64, cost float64) {
+	if volume > 0 {
+		f[asset] = append(f[asset], &lot{time: t, volume: volume, cost: cost})
+	}
+}
+
+// dispose closes the oldest lots of the disposal's asset and completes its cost basis and gain
+func (f fifo) dispose(d *Disposal) {
+	remaining := d.Volume
+	for remaining > 0 && len(f[d.Asset]) > 0 {
+		l := f[d.Asset][0]
+		if d.Acquired.IsZero() {
+			d.Acquired = l.time
+		}
+		take := remaining
+		if take >= l.volume {
+			take = l.volume
+		}
+		share := l.cost * take / l.volume
+		d.CostBasis += share
+		l.cost -= share
+		l.volume -= take
+		remaining -= take
+		// Float remainders of a fully sold lot would otherwise linger as dust lots
+		if l.volume <= d.Volume*1e-12 {
+			f[d.Asset] = f[d.Asset][1:]
+		}
+	}
+	if remaining > d.Volume*1e-12 {
+		d.Unmatched = remaining
+	}
+	d.Gain = d.Proceeds - d.CostBasis - d.Fees
+}
+
+// FIFO matches every sell against the oldest remaining lots of the same asset, bought in any quote
+// currency, and returns the disposals of the year (in loc), oldest first. Amounts are converted
+// to the reporting currency with rate at the time of each execution. Trades against a quote that
+// isn't Fiat also dispose of (buys) or acquire (sells) the quote, e.g. buying ETH on ETH/BTC sells
+// BTC. The executions must cover the account's history from before the year, buys of earlier years
+// make up the cost basis.
+func FIFO(executions []Execution, year int, loc *time.Location, currency string, rate Rate) ([]Disposal, error) {
+	sorted := append([]Execution(nil), executions...)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].Time.Before(sorted[j].Time) })
+
+	lots := fifo{}
+	var disposals []Disposal
+	for _, e := range sorted {
+		if e.Side != "buy" && e.Side != "sell" {
+			return nil, fmt.Errorf("execution %s: unknown side %q", e.TxID, e.Side)
+		}
+		q := 1.0
+		if e.Quote != currency {
+			var err error
+			if q, err = rate(e.Quote, e.Time); err != nil {
+				return nil, fmt.Errorf("execution %s: %s rate: %v", e.TxID, e.Quote, err)
+			}
+		}
+		cost, fee := e.Cost*q, e.Fee*q
+		crypto := !Fiat[e.Quote]
+
+		var disposal *Disposal
+		switch {
+		case e.Side == "buy" && !crypto:
+			lots.acquire(e.Asset, e.Time, e.Volume, cost+fee)
+		case e.Side == "buy":
+			// The quote coins paid, fee included, are sold for the bought coins' value
+			lots.acquire(e.Asset, e.Time, e.Volume, cost)
+			disposal = &Disposal{TxID: e.TxID, Time: e.Time, Asset: e.Quote, Quote: e.Asset, Currency: currency,
+				Volume: e.Cost + e.Fee, Proceeds: cost, Fees: fee}
+		default:
+			disposal = &Disposal{TxID: e.TxID, Time: e.Time, Asset: e.Asset, Quote: e.Quote, Currency: currency,
+				Volume: e.Volume, Proceeds: cost, Fees: fee}
+		}
+		if disposal != nil {
+			lots.dispose(disposal)
+			if e.Time.In(loc).Year() == year {
+				disposals = append(disposals, *disposal)
+			}
+		}
+		// The quote coins received net of the fee are acquired at their value
+		if e.Side == "sell" && crypto {
+			lots.acquire(e.Quote, e.Time, e.Cost-e.Fee, cost-fee)
+		}
+	}
+	return disposals, nil
+}
@@ -0,0 +1,119 @@
+package tax
+
+import (
+	"fmt"
+	"math"
+	"testing"
+	"time"
+)
+
+// rates converts EUR and BTC to USD at fixed rates
+func rates(currency string, t time.Time) (float64, error) {
+	switch currency {
+	case "EUR":
+		return 1.1, nil
+	case "BTC":
+		return 50000, nil
+	}
+	return 0, fmt.Errorf("no rate for %s", currency)
+}
+
+func day(d int) time.Time {
+	return time.Date(2026, time.January, d, 12, 0, 0, 0, time.UTC)
+}
+
+func near(a, b float64) bool {
+	return math.Abs(a-b) < 1e-6
+}
+
+// A coin bought on BTC/USD and sold on BTC/EUR closes the USD lot, converted to one currency
+func TestFIFOAcrossQuoteCurrencies(t *testing.T) {
+	executions := []Execution{
+		{TxID: "B1", Time: day(1), Asset: "BTC", Quote: "USD", Side: "buy", Volume: 1, Cost: 40000, Fee: 100},
+		{TxID: "S1", Time: day(2), Asset: "BTC", Quote: "EUR", Side: "sell", Volume: 0.5, Cost: 25000, Fee: 50},
+	}
+	disposals, err := FIFO(executions, 2026, time.UTC, "USD", rates)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(disposals) != 1 {
+		t.Fatalf("got %d disposals, want 1", len(disposals))
+	}
+	d := disposals[0]
+	if d.Unmatched != 0 {
+		t.Errorf("Unmatched = %v, want 0", d.Unmatched)
+	}
+	if !d.Acquired.Equal(day(1)) {
+		t.Errorf("Acquired = %v, want %v", d.Acquired, day(1))
+	}
+	// 25000 EUR at 1.1, half the lot's 40100 USD, 50 EUR at 1.1
+	if !near(d.Proceeds, 27500) || !near(d.CostBasis, 20050) || !near(d.Fees, 55) || !near(d.Gain, 7395) {
+		t.Errorf("got proceeds %v, basis %v, fees %v, gain %v; want 27500, 20050, 55, 7395", d.Proceeds, d.CostBasis, d.Fees, d.Gain)
+	}
+	if d.Currency != "USD" || d.Quote != "EUR" {
+		t.Errorf("got currency %s quote %s, want USD EUR", d.Currency, d.Quote)
+	}
+}
+
+// Buying ETH on ETH/BTC disposes of the BTC paid, selling ETH for BTC acquires BTC
+func TestFIFOCryptoQuote(t *testing.T) {
+	executions := []Execution{
+		{TxID: "B1", Time: day(1), Asset: "BTC", Quote: "USD", Side: "buy", Volume: 1, Cost: 40000},
+		{TxID: "B2", Time: day(2), Asset: "ETH", Quote: "BTC", Side: "buy", Volume: 10, Cost: 0.5, Fee: 0.001},
+		{TxID: "S1", Time: day(3), Asset: "ETH", Quote: "BTC", Side: "sell", Volume: 4, Cost: 0.25, Fee: 0.0005},
+		{TxID: "S2", Time: day(4), Asset: "BTC", Quote: "USD", Side: "sell", Volume: 0.7, Cost: 35000},
+	}
+	disposals, err := FIFO(executions, 2026, time.UTC, "USD", rates)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(disposals) != 3 {
+		t.Fatalf("got %d disposals, want 3: %+v", len(disposals), disposals)
+	}
+
+	btc := disposals[0]
+	if btc.TxID != "B2" || btc.Asset != "BTC" || !near(btc.Volume, 0.501) {
+		t.Fatalf("first disposal is %+v, want 0.501 BTC disposed by B2", btc)
+	}
+	// 0.5 BTC worth 25000 USD received as ETH, 0.001 BTC fee worth 50, 0.501 of the 40000 lot
+	if !near(btc.Proceeds, 25000) || !near(btc.Fees, 50) || !near(btc.CostBasis, 20040) {
+		t.Errorf("BTC disposal proceeds %v, fees %v, basis %v; want 25000, 50, 20040", btc.Proceeds, btc.Fees, btc.CostBasis)
+	}
+
+	eth := disposals[1]
+	// 4 of the 10 ETH bought for 25000 USD
+	if eth.Asset != "ETH" || !near(eth.CostBasis, 10000) || !near(eth.Proceeds, 12500) || !near(eth.Fees, 25) || eth.Unmatched != 0 {
+		t.Errorf("ETH disposal %+v, want basis 10000, proceeds 12500, fees 25", eth)
+	}
+
+	// 0.499 BTC left of the first lot, then 0.2495 BTC acquired by S1 at 12475 USD
+	last := disposals[2]
+	if last.Unmatched != 0 || !near(last.CostBasis, 0.499*40000+(0.7-0.499)*50000) {
+		t.Errorf("BTC sale basis %v, unmatched %v; want %v, 0", last.CostBasis, last.Unmatched, 0.499*40000+(0.7-0.499)*50000)
+	}
+}
+
+func TestFIFOUnmatchedAndYear(t *testing.T) {
+	executions := []Execution{
+		{TxID: "B1", Time: day(1).AddDate(-1, 0, 0), Asset: "SOL", Quote: "USD", Side: "buy", Volume: 1, Cost: 100},
+		{TxID: "S1", Time: day(1).AddDate(-1, 0, 1), Asset: "SOL", Quote: "USD", Side: "sell", Volume: 0.5, Cost: 60},
+		{TxID: "S2", Time: day(1), Asset: "SOL", Quote: "USD", Side: "sell", Volume: 1, Cost: 150},
+	}
+	disposals, err := FIFO(executions, 2026, time.UTC, "USD", rates)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(disposals) != 1 || disposals[0].TxID != "S2" {
+		t.Fatalf("got %+v, want only S2", disposals)
+	}
+	if d := disposals[0]; !near(d.Unmatched, 0.5) || !near(d.CostBasis, 50) || !near(d.Gain, 100) {
+		t.Errorf("got unmatched %v, basis %v, gain %v; want 0.5, 50, 100", d.Unmatched, d.CostBasis, d.Gain)
+	}
+}
+
+func TestFIFOMissingRate(t *testing.T) {
+	executions := []Execution{{TxID: "B1", Time: day(1), Asset: "BTC", Quote: "GBP", Side: "buy", Volume: 1, Cost: 30000}}
+	if _, err := FIFO(executions, 2026, time.UTC, "USD", rates); err == nil {
+		t.Error("FIFO converted GBP without a rate")
+	}
+}
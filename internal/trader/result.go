@@ -0,0 +1,42 @@
+package trader
+
+import "time"
+
+// TradeResult is the outcome of a trade
+type TradeResult struct {
+	Code               int // exitcode of the run, exitcode.OK for a completed trade or dry run
+	TradeID            string
+	Result             string // complete, partial, canceled, timeout, halted, interrupted; empty if the trade stopped before a result
+	Volume             float64
+	BuyPrice           float64
+	SellPrice          float64
+	FeesUSD            float64
+	GrossProfitUSD     float64
+	NetProfitUSD       float64
+	EstimatedProfitUSD float64
+	PlacedAt           time.Time // zero if no orders were placed
+	FinishedAt         time.Time // zero without a result
+}
+
+// finish records the trade's result
+func (r *TradeResult) finish(result string) {
+	r.Result = result
+	r.FinishedAt = time.Now()
+}
+
+// FillTime returns how long the trade took from placement to its result, zero if it has neither
+func (r *TradeResult) FillTime() time.Duration {
+	if r.PlacedAt.IsZero() || r.FinishedAt.IsZero() {
+		return 0
+	}
+	return r.FinishedAt.Sub(r.PlacedAt)
+}
+
+// SpreadCapturedPercent returns the executed spread as a percentage of the buy price, zero unless
+// both legs executed
+func (r *TradeResult) SpreadCapturedPercent() float64 {
+	if r.BuyPrice <= 0 || r.SellPrice <= 0 {
+		return 0
+	}
+	return (r.SellPrice - r.BuyPrice) / r.BuyPrice * 100
+}
@@ -0,0 +1,441 @@
+package trader
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jkosik/crypto-trader/internal/events"
+	"github.com/jkosik/crypto-trader/internal/kraken"
+	"github.com/jkosik/crypto-trader/internal/logging"
+	"github.com/jkosik/crypto-trader/internal/marketcache"
+	"github.com/jkosik/crypto-trader/internal/strategy"
+)
+
+func init() {
+	strategy.Register("spread", func(params strategy.Params) (strategy.Strategy, error) {
+		return newSpread(params), nil
+	})
+}
+
+// spreadStrategy is the spread trade behind the Strategy interface: it decides when the market
+// pays for a buy and a sell inside the spread, at which prices, and walks a stalled leg towards the
+// market once the other leg filled. Run drives it with the trade's safety nets (crash recovery,
+// halts, external changes, partial-fill reconciliation), the strategy runner like any strategy.
+type spreadStrategy struct {
+	params         strategy.Params
+	bandPercentile float64 // of the volatility bands clamping the prices, 0 disables them
+	bandWindow     time.Duration
+
+	// Market history warming the bands and the spread statistics, nil without a market cache
+	history      *marketcache.Cache
+	historySaved time.Time
+	sampler      *kraken.SpreadSampler // nil unless spread_stats_window is set
+
+	entered bool               // the spread qualified or the legs were handed over
+	quote   *kraken.SpreadInfo // the quote the legs were priced at, depth-weighted if configured
+	bands   *kraken.PriceBands // the bands the legs were clamped to, nil without them
+	orders  []strategy.Order   // the legs not filled yet
+	txIds   map[string]string  // by Order.Key
+	execVol map[string]float64 // by Order.Key
+
+	// Repricing of the leg left open once the other filled, counted in ticks of
+	// status_check_interval like the trader's other timers
+	filledPrice  float64
+	legWaited    time.Duration
+	sinceReprice time.Duration
+	limit        float64 // the stalled leg's max loss price
+	pinned       bool    // the stalled leg is held back by limit
+}
+
+// newSpread returns the spread strategy without market history or volatility bands
+func newSpread(params strategy.Params) *spreadStrategy {
+	s := &spreadStrategy{params: params, txIds: map[string]string{}, execVol: map[string]float64{}}
+	if cfg := params.Config; cfg.SpreadStatsWindow > 0 {
+		s.sampler = kraken.NewSpreadSampler(int(cfg.SpreadStatsWindow / cfg.SpreadSampleInterval))
+	}
+	return s
+}
+
+// useHistory keeps the market history up to date and seeds the spread statistics from it
+func (s *spreadStrategy) useHistory(history *marketcache.Cache) {
+	s.history = history
+	if history == nil || s.sampler == nil {
+		return
+	}
+	for _, snapshot := range history.Spreads() {
+		if time.Since(snapshot.Time) <= s.params.Config.SpreadStatsWindow {
+			s.sampler.Add(snapshot)
+		}
+	}
+}
+
+// saveHistory persists the market history at most once a minute unless forced
+func (s *spreadStrategy) saveHistory(ctx context.Context, force bool) {
+	if s.history == nil || (!force && time.Since(s.historySaved) < time.Minute) {
+		return
+	}
+	if err := s.history.Save(); err != nil {
+		logging.FromContext(ctx).Warn("Failed to save market history", "error", err)
+	}
+	s.historySaved = time.Now()
+}
+
+// warm reports whether the spread statistics hold a full window, always true without them
+func (s *spreadStrategy) warm() bool {
+	return s.sampler == nil || s.sampler.Full()
+}
+
+// sample adds the current spread to the statistics warming up
+func (s *spreadStrategy) sample(ctx context.Context) error {
+	info, err := kraken.GetTickerInfo(ctx, s.params.Coin)
+	if err != nil {
+		return err
+	}
+	s.addSpread(ctx, kraken.SpreadSnapshot{Time: time.Now(), Bid: info.BidPrice, Ask: info.AskPrice})
+	return nil
+}
+
+// addSpread records a spread in the statistics and the market history
+func (s *spreadStrategy) addSpread(ctx context.Context, snapshot kraken.SpreadSnapshot) {
+	if s.sampler != nil {
+		s.sampler.Add(snapshot)
+	}
+	if s.history != nil {
+		s.history.AddSpreads([]kraken.SpreadSnapshot{snapshot})
+		s.saveHistory(ctx, false)
+	}
+}
+
+// prices returns the narrowed buy and sell prices inside a quote, clamped to the bands
+func (s *spreadStrategy) prices(quote *kraken.SpreadInfo) (float64, float64) {
+	return kraken.SpreadOrderPrices(s.params.Pair, quote, s.params.Config.SpreadNarrowFactor, s.bands)
+}
+
+// OnTick checks the entry gates until the spread qualifies, then reprices a stalled leg
+func (s *spreadStrategy) OnTick(ctx context.Context, tick strategy.Tick) error {
+	if s.entered {
+		return s.reprice(ctx, tick)
+	}
+	return s.enter(ctx, tick)
+}
+
+// enter prices the legs once the spread, the 24h volume, the order book depth, the profit after
+// fees and the fill estimate are within the boundaries. Without entering the trade it logs why,
+// the caller checks again after spread_check_interval.
+func (s *spreadStrategy) enter(ctx context.Context, tick strategy.Tick) error {
+	cfg, pair, volume, coin := s.params.Config, s.params.Pair, s.params.Volume, s.params.Coin
+	log := logging.FromContext(ctx)
+	spreadInfo := tick.Spread
+
+	spreadPercent := (spreadInfo.Spread / spreadInfo.BidPrice) * 100
+	s.addSpread(ctx, kraken.SpreadSnapshot{Time: tick.Time, Bid: spreadInfo.BidPrice, Ask: spreadInfo.AskPrice})
+	var spreadStats *kraken.SpreadStats
+	var typicalSpread float64
+	if s.sampler != nil {
+		if !s.sampler.Full() {
+			log.Info("Warming up spread statistics", "samples", s.sampler.Len(), "spread_stats_window", cfg.SpreadStatsWindow)
+			return nil
+		}
+		var err error
+		spreadStats, err = s.sampler.Stats()
+		if err != nil {
+			log.Error("Failed to compute spread statistics", "error", err)
+			return err
+		}
+		typicalSpread = spreadStats.Percentile(cfg.SpreadPercentile)
+	}
+
+	// Get 24h volume
+	volume24h, err := kraken.Get24hVolume(ctx, coin)
+	if err != nil {
+		log.Error("Failed to get 24h volume", "error", err)
+		return err
+	}
+	log.Info("Spread check", "spread_percent", spreadPercent, "volume_24h_usd", volume24h)
+	events.Emit(events.Ticker, tickerEvent(spreadInfo, volume24h))
+
+	// Dark pool prints are reported separately, the volume gate only counts lit liquidity
+	darkVolume24h, err := kraken.GetDarkPool24hVolume(ctx, coin)
+	if err != nil {
+		log.Warn("Failed to get dark pool 24h volume", "error", err)
+	} else if darkVolume24h > 0 {
+		log.Info("Dark pool volume (not counted)", "volume_24h_usd", darkVolume24h)
+	}
+
+	// Optional realized volatility scales the minimum spread: fast markets require wider
+	// spreads, quiet ones accept narrower spreads
+	minSpread := cfg.MinSpreadPercent
+	var candles []kraken.OHLCData
+	if cfg.VolatilityWindow > 0 {
+		candles, err = kraken.GetMinuteCandles(ctx, coin)
+		if err != nil {
+			log.Error("Failed to get OHLC data for volatility", "error", err)
+			return err
+		}
+		if s.history != nil {
+			candles = s.history.AddCandles(candles)
+			s.saveHistory(ctx, false)
+		}
+		volatility, err := kraken.VolatilityFrom(candles, cfg.VolatilityWindow)
+		if err != nil {
+			log.Warn("Failed to compute volatility, using the fixed min. spread", "error", err)
+		} else {
+			minSpread = volatility.ScaleMinSpread(cfg.MinSpreadPercent, cfg.VolatilityReference, cfg.VolatilityScaleMin, cfg.VolatilityScaleMax)
+			log.Info("Volatility", "volatility_percent", volatility.Percent, "returns", volatility.Returns, "window", volatility.Window, "min_spread_percent", minSpread)
+		}
+	}
+
+	kraken.RecordDecision("spread_gate", map[string]interface{}{
+		"spread_percent": spreadPercent,
+		"volume_24h":     volume24h,
+		"pass":           spreadPercent >= minSpread && spreadPercent >= typicalSpread && volume24h >= cfg.MinVolume24h,
+	})
+
+	// Skip and re-try if spread and volume are not within the boundaries
+	if spreadPercent < minSpread {
+		log.Info("Spread is not within the boundaries, sleeping", "min_spread_percent", minSpread, "delay", cfg.SpreadCheckInterval)
+		return nil
+	}
+	if spreadStats != nil && spreadPercent < typicalSpread {
+		log.Info("Spread is below its recent typical value, sleeping",
+			"spread_percent", spreadPercent,
+			"typical_spread_percent", typicalSpread,
+			"spread_percentile", cfg.SpreadPercentile,
+			"median_spread_percent", spreadStats.Median,
+			"mean_spread_percent", spreadStats.Mean,
+			"samples", spreadStats.Samples,
+			"delay", cfg.SpreadCheckInterval)
+		return nil
+	}
+	if volume24h < cfg.MinVolume24h {
+		log.Info("24h volume is not within the boundaries, sleeping", "min_volume_24h_usd", cfg.MinVolume24h, "delay", cfg.SpreadCheckInterval)
+		return nil
+	}
+
+	// Optional volatility bands keep the narrowed prices away from short-lived spikes
+	if s.bandPercentile > 0 {
+		if candles == nil {
+			candles, err = kraken.GetMinuteCandles(ctx, coin)
+			if err != nil {
+				log.Error("Failed to get OHLC data for price bands", "error", err)
+				return err
+			}
+			if s.history != nil {
+				candles = s.history.AddCandles(candles)
+				s.saveHistory(ctx, false)
+			}
+		}
+		s.bands, err = kraken.PriceBandsFrom(candles, s.bandWindow, s.bandPercentile)
+		if err != nil {
+			log.Error("Failed to compute price bands", "error", err)
+			return err
+		}
+		log.Info("Price bands", "percentile", s.bands.Percentile, "window", s.bands.Window, "lower", s.bands.Lower, "upper", s.bands.Upper)
+	}
+
+	// Levels too small to matter don't set the quote: the bid and ask are the depth-weighted
+	// prices of the best levels holding the configured multiple of the trade volume
+	if cfg.DepthVolumeRatio > 0 {
+		book, err := kraken.GetOrderBook(ctx, pair.Altname, cfg.DepthLevels)
+		if err != nil {
+			log.Error("Failed to get order book for depth-weighted prices", "error", err)
+			return err
+		}
+		depthInfo, err := book.DepthSpread(spreadInfo, volume*cfg.DepthVolumeRatio)
+		kraken.RecordDecision("depth_gate", map[string]interface{}{
+			"min_volume": volume * cfg.DepthVolumeRatio,
+			"pass":       err == nil,
+		})
+		if err != nil {
+			log.Info("Order book is too thin for depth-weighted prices, sleeping", "depth_volume_ratio", cfg.DepthVolumeRatio, "reason", err, "delay", cfg.SpreadCheckInterval)
+			return nil
+		}
+		log.Info("Depth-weighted prices",
+			"bid", spreadInfo.BidPrice,
+			"ask", spreadInfo.AskPrice,
+			"depth_bid", depthInfo.BidPrice,
+			"depth_ask", depthInfo.AskPrice,
+			"min_volume", volume*cfg.DepthVolumeRatio)
+		spreadInfo = depthInfo
+	}
+
+	// The spread must pay for the fees of both legs with the configured margin left over
+	buyPrice, sellPrice := s.prices(spreadInfo)
+	grossProfit, fees, netProfit := kraken.SpreadNetProfit(buyPrice, sellPrice, volume, s.params.MakerFeePercent)
+	netProfitPercent := netProfit / (buyPrice * volume) * 100
+	kraken.RecordDecision("profit_gate", map[string]interface{}{
+		"net_profit":         netProfit,
+		"net_profit_percent": netProfitPercent,
+		"pass":               netProfitPercent >= cfg.MinNetProfitPercent,
+	})
+	if netProfitPercent < cfg.MinNetProfitPercent {
+		log.Info("Expected profit after fees is below the minimum, sleeping",
+			"gross_profit_usd", grossProfit,
+			"fees_usd", fees,
+			"net_profit_usd", netProfit,
+			"net_profit_percent", netProfitPercent,
+			"min_net_profit_percent", cfg.MinNetProfitPercent,
+			"delay", cfg.SpreadCheckInterval)
+		return nil
+	}
+
+	// The recent prints estimate how likely the quotes are to fill: taker volume that
+	// traded through a quote price within fill_window would have reached it
+	if cfg.FillWindow > 0 {
+		trades, _, err := kraken.GetRecentTrades(ctx, pair.Altname, "")
+		if err != nil {
+			log.Error("Failed to get recent trades for the fill estimate", "error", err)
+			return err
+		}
+		estimate := kraken.EstimateFills(trades, time.Now(), cfg.FillWindow, buyPrice, sellPrice, volume)
+		fillLog := log.With(
+			"fill_window", cfg.FillWindow,
+			"trades", estimate.Trades,
+			"buy_volume", estimate.BuyVolume,
+			"buy_fill_percent", estimate.BuyPercent,
+			"sell_volume", estimate.SellVolume,
+			"sell_fill_percent", estimate.SellPercent)
+		if cfg.MinFillPercent > 0 {
+			pass := estimate.BuyPercent >= cfg.MinFillPercent && estimate.SellPercent >= cfg.MinFillPercent
+			kraken.RecordDecision("fill_gate", map[string]interface{}{
+				"buy_fill_percent":  estimate.BuyPercent,
+				"sell_fill_percent": estimate.SellPercent,
+				"pass":              pass,
+			})
+			if !pass {
+				fillLog.Info("Too little volume traded through the quote prices recently, sleeping", "min_fill_percent", cfg.MinFillPercent, "delay", cfg.SpreadCheckInterval)
+				return nil
+			}
+		}
+		fillLog.Info("Fill estimate")
+	}
+
+	log.Info("Spread, volume and profit after fees are within the boundaries, placing orders", "net_profit_usd", netProfit)
+	s.saveHistory(ctx, true)
+	s.entered, s.quote = true, spreadInfo
+	s.orders = []strategy.Order{
+		{Key: "buy", Side: "buy", Price: buyPrice, Volume: volume},
+		{Key: "sell", Side: "sell", Price: sellPrice, Volume: volume},
+	}
+	return nil
+}
+
+// reprice walks the leg left open once the other filled towards the market: after leg_timeout,
+// every reprice_interval, never past max_loss_percent against the filled leg's price. Every tick
+// counts as a status check. A partially filled leg keeps its price.
+func (s *spreadStrategy) reprice(ctx context.Context, tick strategy.Tick) error {
+	cfg := s.params.Config
+	if cfg.LegTimeout == 0 || s.filledPrice == 0 || len(s.orders) != 1 || s.execVol[s.orders[0].Key] > 0 {
+		return nil
+	}
+	if s.legWaited == 0 {
+		s.sinceReprice = cfg.RepriceInterval
+	}
+	s.legWaited += cfg.StatusCheckInterval
+	s.sinceReprice += cfg.StatusCheckInterval
+	if s.legWaited < cfg.LegTimeout || s.sinceReprice < cfg.RepriceInterval {
+		return nil
+	}
+	s.sinceReprice = 0
+
+	stalled := &s.orders[0]
+	isBuy := stalled.Side == "buy"
+	s.limit = kraken.RepriceLimit(isBuy, s.filledPrice, cfg.MaxLossPercent)
+	market := tick.Spread
+	if market == nil {
+		var err error
+		if market, err = kraken.GetTickerInfo(ctx, s.params.Coin); err != nil {
+			return fmt.Errorf("error getting spread for repricing: %v", err)
+		}
+	}
+	newPrice, move := kraken.RepricePrice(s.params.Pair, isBuy, stalled.Price, market, cfg.RepriceStep, s.limit)
+	kraken.RecordDecision("reprice", map[string]interface{}{
+		"txid":  s.txIds[stalled.Key],
+		"price": newPrice,
+		"limit": s.limit,
+		"move":  move,
+	})
+	if !move {
+		// Pinned by the loss limit rather than already at the market
+		s.pinned = (isBuy && s.limit < market.AskPrice) || (!isBuy && s.limit > market.BidPrice)
+		logging.FromContext(ctx).Info("Stalled leg can't move closer to the market within the max loss, waiting",
+			"txid", s.txIds[stalled.Key],
+			"type", stalled.Side,
+			"price", stalled.Price,
+			"bid", market.BidPrice,
+			"ask", market.AskPrice,
+			"limit_price", s.limit)
+		return nil
+	}
+	stalled.Price = newPrice
+	return nil
+}
+
+// OnFill keeps the legs in step with the exchange: a filled leg is dropped and its price becomes
+// the reference of the max loss, an open one takes over the price and volume it was last seen at.
+// A leg ending unfilled at its desired price gives up the trade.
+func (s *spreadStrategy) OnFill(ctx context.Context, fill strategy.Fill) error {
+	key := fill.Order.Key
+	s.entered = true
+	s.txIds[key], s.execVol[key] = fill.TxID, fill.VolExec
+
+	i := s.leg(key)
+	switch {
+	case fill.Status == "closed":
+		if fill.VolExec > 0 {
+			s.filledPrice = fill.Cost / fill.VolExec
+		}
+		if i >= 0 {
+			s.orders = append(s.orders[:i:i], s.orders[i+1:]...)
+		}
+	case kraken.OrderDone(fill.Status):
+		// The runner cancels a leg whose price changed to place it again, that doesn't end the trade
+		if i >= 0 && s.orders[i] == fill.Order {
+			logging.FromContext(ctx).Warn("Spread leg ended unfilled, giving up the trade", "type", fill.Order.Side, "status", fill.Status)
+			s.orders = nil
+		}
+	case i >= 0:
+		s.orders[i] = fill.Order
+	default:
+		s.orders = append(s.orders, fill.Order)
+	}
+	return nil
+}
+
+// leg returns the index of the leg with key, -1 if it isn't open
+func (s *spreadStrategy) leg(key string) int {
+	for i, order := range s.orders {
+		if order.Key == key {
+			return i
+		}
+	}
+	return -1
+}
+
+// DesiredOrders returns the legs not filled yet
+func (s *spreadStrategy) DesiredOrders() []strategy.Order {
+	return s.orders
+}
+
+// Done reports whether both legs filled or the trade was given up
+func (s *spreadStrategy) Done() bool {
+	return s.entered && len(s.orders) == 0
+}
+
+// legFill is an order of the trade as the strategy sees it
+func legFill(txId string, order *kraken.OrderStatus) strategy.Fill {
+	return strategy.Fill{
+		Order: strategy.Order{
+			Key:    order.Descr.Type,
+			Side:   order.Descr.Type,
+			Price:  kraken.ParseFloat(order.Descr.Price),
+			Volume: kraken.ParseFloat(order.Vol),
+		},
+		TxID:    txId,
+		Status:  order.Status,
+		VolExec: kraken.ParseFloat(order.VolExec),
+		Cost:    kraken.ParseFloat(order.Cost),
+		Fee:     kraken.ParseFloat(order.Fee),
+	}
+}
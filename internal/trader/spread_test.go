@@ -0,0 +1,78 @@
+package trader
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/jkosik/crypto-trader/internal/config"
+	"github.com/jkosik/crypto-trader/internal/kraken"
+	"github.com/jkosik/crypto-trader/internal/strategy"
+)
+
+// The leg left open once the other filled walks towards the market after leg_timeout, one step
+// per reprice_interval, until the max loss price pins it
+func TestSpreadRepricesStalledLeg(t *testing.T) {
+	cfg := config.Default()
+	cfg.StatusCheckInterval = 10 * time.Millisecond
+	cfg.LegTimeout = 20 * time.Millisecond
+	cfg.RepriceInterval = 10 * time.Millisecond
+	cfg.RepriceStep = 0.5
+	cfg.MaxLossPercent = 0.001
+	pair := &kraken.AssetPair{PairDecimals: 1}
+	s := newSpread(strategy.Params{Coin: "BTC", Pair: pair, Volume: 0.001, Config: cfg})
+
+	ctx := context.Background()
+	buy := strategy.Order{Key: "buy", Side: "buy", Price: 60003.5, Volume: 0.001}
+	sell := strategy.Order{Key: "sell", Side: "sell", Price: 60006.5, Volume: 0.001}
+	s.OnFill(ctx, strategy.Fill{Order: buy, TxID: "OBUY", Status: "open"})
+	s.OnFill(ctx, strategy.Fill{Order: sell, TxID: "OSELL", Status: "open"})
+	s.OnFill(ctx, strategy.Fill{Order: buy, TxID: "OBUY", Status: "closed", VolExec: 0.001, Cost: 60.0035})
+
+	market := strategy.Tick{Spread: &kraken.SpreadInfo{BidPrice: 60000, AskPrice: 60010}}
+	price := func() float64 {
+		orders := s.DesiredOrders()
+		if len(orders) != 1 || orders[0].Key != "sell" {
+			t.Fatalf("desired orders %v, want the sell leg", orders)
+		}
+		return orders[0].Price
+	}
+	s.OnTick(ctx, market)
+	if got := price(); got != 60006.5 {
+		t.Errorf("sell at %v before leg_timeout, want 60006.5", got)
+	}
+	s.OnTick(ctx, market)
+	if got := price(); got != 60004.7 {
+		t.Errorf("sell at %v after leg_timeout, want half way to the 60002.9 limit at 60004.7", got)
+	}
+	for i := 0; i < 10 && !s.pinned; i++ {
+		s.OnTick(ctx, market)
+	}
+	if got := price(); !s.pinned || got < s.limit {
+		t.Errorf("sell at %v, pinned %v, want it held at the limit %v", got, s.pinned, s.limit)
+	}
+	if s.Done() {
+		t.Error("trade done while the sell leg is open")
+	}
+}
+
+// A leg canceled to be placed again at a new price doesn't end the trade, one that ends unfilled
+// at its desired price does
+func TestSpreadCanceledLeg(t *testing.T) {
+	pair := &kraken.AssetPair{PairDecimals: 1}
+	s := newSpread(strategy.Params{Coin: "BTC", Pair: pair, Volume: 0.001, Config: config.Default()})
+
+	ctx := context.Background()
+	sell := strategy.Order{Key: "sell", Side: "sell", Price: 60006.5, Volume: 0.001}
+	s.OnFill(ctx, strategy.Fill{Order: sell, TxID: "OSELL", Status: "open"})
+	s.orders[0].Price = 60004.7
+
+	s.OnFill(ctx, strategy.Fill{Order: sell, TxID: "OSELL", Status: "canceled"})
+	if s.Done() {
+		t.Fatal("canceling the leg to reprice it ended the trade")
+	}
+	s.OnFill(ctx, strategy.Fill{Order: s.orders[0], TxID: "OSELL2", Status: "expired"})
+	if !s.Done() {
+		t.Error("the leg expired at its desired price, want the trade given up")
+	}
+}
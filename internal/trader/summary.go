@@ -0,0 +1,64 @@
+package trader
+
+import (
+	"time"
+
+	"github.com/jkosik/crypto-trader/internal/money"
+)
+
+// Summary aggregates the results of several trades, like the iterations of cmd/loop
+type Summary struct {
+	Trades             int // runs that reported a result, including canceled and timed-out ones
+	Wins               int
+	Losses             int
+	GrossProfitUSD     float64
+	FeesUSD            float64
+	NetProfitUSD       float64
+	AvgFillTime        time.Duration // over the trades with both placement and result
+	BestSpreadPercent  float64       // executed spread of the trades with both legs executed
+	WorstSpreadPercent float64
+	Spreads            int // trades the best and worst spread are taken from
+}
+
+// Summarize aggregates the results, runs that stopped before a result are left out
+func Summarize(results []*TradeResult) Summary {
+	var s Summary
+	var gross, fees, net []float64
+	var fillTotal time.Duration
+	fills := 0
+	for _, r := range results {
+		if r == nil || r.Result == "" {
+			continue
+		}
+		s.Trades++
+		switch {
+		case r.NetProfitUSD > 0:
+			s.Wins++
+		case r.NetProfitUSD < 0:
+			s.Losses++
+		}
+		gross = append(gross, r.GrossProfitUSD)
+		fees = append(fees, r.FeesUSD)
+		net = append(net, r.NetProfitUSD)
+		if fill := r.FillTime(); fill > 0 {
+			fillTotal += fill
+			fills++
+		}
+		if spread := r.SpreadCapturedPercent(); r.BuyPrice > 0 && r.SellPrice > 0 {
+			if s.Spreads == 0 || spread > s.BestSpreadPercent {
+				s.BestSpreadPercent = spread
+			}
+			if s.Spreads == 0 || spread < s.WorstSpreadPercent {
+				s.WorstSpreadPercent = spread
+			}
+			s.Spreads++
+		}
+	}
+	s.GrossProfitUSD = money.Sum("USD", gross...)
+	s.FeesUSD = money.Sum("USD", fees...)
+	s.NetProfitUSD = money.Sum("USD", net...)
+	if fills > 0 {
+		s.AvgFillTime = fillTotal / time.Duration(fills)
+	}
+	return s
+}
@@ -0,0 +1,1672 @@
+// Package trader runs the one-shot spread trade of cmd/trader: the market, funds and risk gates,
+// placing a buy and a sell inside the spread, and monitoring them (repricing, partial-fill
+// reconciliation, crash recovery) until both are done. cmd/trader runs one trade per process,
+// cmd/loop runs one per iteration in-process and reads the outcome from the TradeResult.
+//
+// Settings of the kraken package (quote currency, API host, order flags, rate limits, paper
+// trading and session recording) are process-wide, the caller sets them up before Run.
+package trader
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jkosik/crypto-trader/internal/config"
+	"github.com/jkosik/crypto-trader/internal/events"
+	"github.com/jkosik/crypto-trader/internal/exitcode"
+	"github.com/jkosik/crypto-trader/internal/kraken"
+	"github.com/jkosik/crypto-trader/internal/logging"
+	"github.com/jkosik/crypto-trader/internal/marketcache"
+	"github.com/jkosik/crypto-trader/internal/money"
+	"github.com/jkosik/crypto-trader/internal/risk"
+	"github.com/jkosik/crypto-trader/internal/runparams"
+	"github.com/jkosik/crypto-trader/internal/store"
+	"github.com/jkosik/crypto-trader/internal/strategy"
+	"github.com/jkosik/crypto-trader/internal/tradestate"
+)
+
+// Options are the inputs of a trade, named after the trader's flags
+type Options struct {
+	Config           *config.Config // resolved for the coin (config.ForCoin), flag overrides applied
+	Coin             string
+	Volume           float64 // base coin volume, unless USD is set
+	USD              float64 // quote amount converted to volume at the bid
+	TradeID          string  // correlation ID of logs, events and the journal, generated if empty
+	Order            bool    // place real orders
+	Paper            bool    // simulate the orders against the virtual account
+	Validate         bool    // only validate the orders on the exchange
+	Untradeable      bool
+	Detach           bool
+	PostOnly         bool
+	PostOnlyRetries  int
+	MaxParticipation float64 // percent of the pair's 24h volume, 0 disables
+	BandPercentile   float64
+	BandWindow       time.Duration
+	MaxWait          time.Duration
+	OnSignal         string // cancel or leave
+	Yes              bool   // accept risk-relevant parameter increases without Confirm
+	USDValue         bool
+	JournalPath      string
+	PaperAccount     string
+	PaperUSD         float64
+	PaperBase        float64
+	PaperFee         float64
+	ParamsPath       string
+	MarketCache      string
+
+	// Confirm asks whether to place orders anyway after risk-relevant parameters increased,
+	// nil declines
+	Confirm func(question string) bool
+	// Shutdown is closed on SIGINT or SIGTERM: waits end and the trade stops at the next check,
+	// cleaning up its orders per OnSignal. Nil never shuts down.
+	Shutdown <-chan struct{}
+}
+
+// DefaultOptions returns the defaults of the trader's flags, the state files in the state directory
+func DefaultOptions() Options {
+	return Options{
+		OnSignal:         "cancel",
+		PostOnlyRetries:  3,
+		MaxParticipation: config.Default().MaxParticipationPercent,
+		BandWindow:       time.Hour,
+		JournalPath:      DefaultStatePath("journal.db"),
+		PaperAccount:     DefaultStatePath("paper.json"),
+		PaperUSD:         10000,
+		PaperFee:         0.25,
+		ParamsPath:       DefaultStatePath("last-run.json"),
+		MarketCache:      DefaultStatePath("market"),
+	}
+}
+
+// Configure applies the order settings of the config and flags to the kraken package. They are
+// process-wide: traders sharing a process share them.
+func Configure(cfg *config.Config, postOnly bool, validate bool) {
+	kraken.UntradeableBuyFactor = cfg.UntradeableBuyFactor
+	kraken.UntradeableSellFactor = cfg.UntradeableSellFactor
+	kraken.PostOnly = postOnly
+	kraken.ValidateOnly = validate
+	kraken.TimeInForce = cfg.TimeInForce
+	kraken.OrderExpiry = cfg.OrderExpiry
+	kraken.CloseOrderType = cfg.CloseOrderType
+	kraken.Leverage = cfg.Leverage
+	kraken.ClosePercent = cfg.ClosePercent
+	kraken.LoneLegAction = cfg.LoneLegAction
+}
+
+// Run runs a trade to its end and returns its outcome, Code is the exitcode of a standalone run
+func Run(ctx context.Context, opts Options) *TradeResult {
+	cfg := opts.Config
+	tradeID := opts.TradeID
+	if tradeID == "" {
+		tradeID = logging.NewTradeID()
+		ctx = logging.WithTradeID(ctx, tradeID)
+	}
+	outcome := &TradeResult{TradeID: tradeID}
+	done := func(code int) *TradeResult {
+		outcome.Code = code
+		return outcome
+	}
+
+	// stopping reports whether the trade is shutting down, pause sleeps between polls (replays run
+	// without waiting) and ends early on a shutdown
+	stopping := func() bool {
+		select {
+		case <-opts.Shutdown:
+			return true
+		default:
+			return false
+		}
+	}
+	pause := func(d time.Duration) {
+		if kraken.Replaying() {
+			return
+		}
+		select {
+		case <-time.After(d):
+		case <-opts.Shutdown:
+		}
+	}
+
+	volume, untradeable := opts.Volume, opts.Untradeable
+	pairName := kraken.PairName(opts.Coin)
+	log := logging.FromContext(ctx)
+
+	log = log.With("pair", pairName)
+	ctx = logging.NewContext(ctx, log)
+	log.Info("Starting trade", "volume", volume, "usd", opts.USD, "untradeable", untradeable, "paper", opts.Paper, "validate", opts.Validate)
+
+	// Show what changed since the last run of this coin. Increased volume or loosened limits
+	// need a confirmation before real orders are placed, dry and paper runs only show the diff.
+	// Only order runs become the baseline of the next diff.
+	if opts.ParamsPath != "" && !kraken.Replaying() {
+		params := runParams(cfg, volume, opts.USD, untradeable, opts.PostOnly, opts.MaxParticipation, opts.BandPercentile, opts.BandWindow)
+		last, err := runparams.Load(opts.ParamsPath, opts.Coin)
+		if err != nil {
+			log.Warn("Failed to read the last run's parameters", "error", err)
+		}
+		placing := opts.Order && !opts.Paper
+		if last != nil {
+			changes := runparams.Diff(last, params)
+			for _, change := range changes {
+				log.Info("Parameter changed since the last run", "name", change.Name, "old", change.Old, "new", change.New, "risk_increase", change.RiskIncrease)
+			}
+			if placing && runparams.RiskIncreased(changes) && !opts.Yes {
+				if opts.Confirm == nil || !opts.Confirm("Risk-relevant parameters increased since the last run, place orders anyway? [y/N] ") {
+					log.Error("Increased risk not confirmed, check the parameters or rerun with -yes")
+					return done(exitcode.Config)
+				}
+			}
+		}
+		if placing {
+			if err := runparams.Save(opts.ParamsPath, opts.Coin, params); err != nil {
+				log.Warn("Failed to store the run's parameters", "error", err)
+			}
+		}
+	}
+
+	// Grab env variables
+	apiKey := os.Getenv("KRAKEN_API_KEY")
+	apiSecret := os.Getenv("KRAKEN_PRIVATE_KEY")
+
+	if (apiKey == "" || apiSecret == "") && !kraken.Replaying() && !opts.Paper {
+		log.Error("KRAKEN_API_KEY and KRAKEN_PRIVATE_KEY environment variables must be set")
+		return done(exitcode.Auth)
+	}
+
+	// Resolve pair metadata (asset codes, precision, minimums)
+	assetPair, err := kraken.GetAssetPair(ctx, opts.Coin, kraken.Quote)
+	if err != nil {
+		log.Error("Failed to get asset pair metadata", "error", err)
+		return done(FailureCode(err))
+	}
+	// Per-coin profiles may force a coarser price precision than the exchange allows
+	if cfg.PriceDecimals >= 0 {
+		overridden := *assetPair
+		overridden.PairDecimals = cfg.PriceDecimals
+		assetPair = &overridden
+	}
+	log.Info("Resolved asset pair",
+		"name", assetPair.Name,
+		"base", assetPair.Base,
+		"quote", assetPair.Quote,
+		"price_decimals", assetPair.PairDecimals,
+		"volume_decimals", assetPair.LotDecimals,
+		"order_min", assetPair.OrderMin)
+	if cfg.Leverage > 1 && !assetPair.SupportsLeverage(cfg.Leverage) {
+		log.Error("The pair can't be traded on margin with this leverage", "leverage", cfg.Leverage,
+			"leverage_buy", assetPair.LeverageBuy, "leverage_sell", assetPair.LeverageSell)
+		return done(exitcode.Config)
+	}
+
+	// A crash or kill may have left a trade of this pair with orders on the exchange. It is resumed
+	// instead of placing a new trade on top of that exposure. Paper orders don't outlive the process.
+	statePath := ""
+	if opts.Order && !opts.Paper && !kraken.Replaying() {
+		statePath = DefaultStatePath(tradestate.FileName(opts.Coin, kraken.Quote))
+	}
+	// Detached orders are handed over to cmd/monitor through the trade state
+	if opts.Detach && statePath == "" {
+		log.Error("-detach needs a state directory for the trade state")
+		return done(exitcode.Config)
+	}
+	var resumed *tradestate.Trade
+	if statePath != "" {
+		// Older versions kept the trade by coin only, its quote is unknown
+		legacyPath := DefaultStatePath("active-" + strings.ToUpper(opts.Coin) + ".json")
+		if _, err := os.Stat(legacyPath); err == nil {
+			log.Error("An unfinished trade of this coin was saved without its quote, rename it to the pair's state file to resume it",
+				"path", legacyPath, "pair_path", statePath)
+			return done(exitcode.TradeFailed)
+		}
+		resumed, err = tradestate.Load(statePath)
+		if err != nil {
+			log.Error("Failed to read the unfinished trade state", "path", statePath, "error", err)
+			return done(exitcode.TradeFailed)
+		}
+	}
+	// A detached run never monitors, the unfinished trade is left to its monitor
+	if resumed != nil && opts.Detach {
+		log.Warn("A trade of this pair is still active, no new orders placed",
+			"trade_id", resumed.TradeID,
+			"buy_txid", resumed.BuyTxID,
+			"sell_txid", resumed.SellTxID,
+			"placed_at", resumed.PlacedAt)
+		return done(exitcode.OK)
+	}
+	if resumed != nil {
+		log.Warn("Resuming unfinished trade instead of starting a new one",
+			"trade_id", resumed.TradeID,
+			"buy_txid", resumed.BuyTxID,
+			"sell_txid", resumed.SellTxID,
+			"volume", resumed.Volume,
+			"placed_at", resumed.PlacedAt)
+		volume = resumed.Volume
+		untradeable = resumed.Untradeable
+		tradeID = resumed.TradeID
+		outcome.TradeID = tradeID
+	}
+
+	// Funds and volume are checked for new trades only, a resumed trade's orders hold them already
+	var spreadInfo *kraken.SpreadInfo
+	if resumed == nil {
+		// Get account balance, paper trades use the virtual account instead
+		var balances map[string]kraken.Balance
+		if opts.Paper {
+			seed := map[string]float64{assetPair.Base: opts.PaperBase, assetPair.Quote: opts.PaperUSD}
+			if err := kraken.StartPaper(opts.PaperAccount, seed, opts.PaperFee); err != nil {
+				log.Error("Failed to open paper account", "error", err)
+				return done(exitcode.Config)
+			}
+			balances = kraken.PaperBalances()
+			log.Info("Paper trading", "account", opts.PaperAccount, "maker_fee_percent", opts.PaperFee)
+		} else {
+			balanceBody, err := kraken.GetAccountBalance(ctx)
+			if err != nil {
+				log.Error("Failed to get account balance", "error", err)
+				return done(FailureCode(err))
+			}
+			log.Debug("Account balance", "body", string(balanceBody))
+			balances, err = kraken.GetAllBalances(balanceBody)
+			if err != nil {
+				log.Error("Failed to parse account balance", "error", err)
+				return done(exitcode.TradeFailed)
+			}
+		}
+
+		// Get spread boundary for base coin
+		spreadInfo, err = kraken.GetTickerInfo(ctx, opts.Coin)
+		if err != nil {
+			log.Error("Failed to get spread boundary", "error", err)
+			return done(FailureCode(err))
+		}
+		events.Emit(events.Ticker, tickerEvent(spreadInfo, 0))
+
+		// A USD amount buys the volume it's worth at the bid, rounded down to the pair's lot decimals
+		if opts.USD > 0 {
+			volume = assetPair.RoundVolume(opts.USD / spreadInfo.BidPrice)
+			log.Info("Converted USD amount to volume", "usd", opts.USD, "bid", spreadInfo.BidPrice, "volume", assetPair.FormatVolume(volume))
+			if volume < assetPair.OrderMin {
+				log.Error("USD amount is below the minimum order size",
+					"usd", opts.USD,
+					"volume", assetPair.FormatVolume(volume),
+					"order_min", assetPair.OrderMin,
+					"min_usd", assetPair.OrderMin*spreadInfo.BidPrice)
+				return done(exitcode.TradeFailed)
+			}
+		}
+
+		// Shrink the requested volume to the max participation rate, illiquid pairs can't absorb large orders
+		if opts.MaxParticipation > 0 {
+			volume24h, err := kraken.Get24hVolume(ctx, opts.Coin)
+			if err != nil {
+				log.Error("Failed to get 24h volume", "error", err)
+				return done(FailureCode(err))
+			}
+
+			maxVolume := assetPair.RoundVolume(volume24h / spreadInfo.BidPrice * (opts.MaxParticipation / 100))
+			if volume > maxVolume {
+				log.Warn("Volume exceeds the max participation rate, shrinking",
+					"volume", volume,
+					"max_participation_percent", opts.MaxParticipation,
+					"volume_24h_usd", volume24h,
+					"new_volume", maxVolume)
+				volume = maxVolume
+			}
+			if volume <= 0 {
+				log.Error("24h volume is too low to trade under the max participation rate")
+				return done(exitcode.TradeFailed)
+			}
+		}
+
+		// A book with little volume near the touch can't absorb a large order either, whatever the 24h
+		// volume: the order would sit alone at its price or walk through several levels
+		if cfg.MaxBookPercent > 0 {
+			book, err := kraken.GetOrderBook(ctx, assetPair.Altname, cfg.BookLevels)
+			if err != nil {
+				log.Error("Failed to get order book", "error", err)
+				return done(FailureCode(err))
+			}
+			bidVolume, askVolume := book.TopVolume(cfg.BookLevels)
+			maxVolume := assetPair.RoundVolume(math.Min(bidVolume, askVolume) * cfg.MaxBookPercent / 100)
+			log.Info("Order book liquidity",
+				"levels", cfg.BookLevels,
+				"bid_volume", bidVolume,
+				"ask_volume", askVolume,
+				"max_book_percent", cfg.MaxBookPercent,
+				"max_volume", maxVolume)
+			if volume > maxVolume {
+				log.Warn("Volume exceeds the order book liquidity, shrinking",
+					"volume", volume,
+					"max_book_percent", cfg.MaxBookPercent,
+					"new_volume", maxVolume)
+				volume = maxVolume
+			}
+			if volume <= 0 {
+				log.Error("Order book is too thin to trade under the max book percentage")
+				return done(exitcode.TradeFailed)
+			}
+		}
+
+		// Per-coin profiles cap the volume of a single trade
+		if cfg.MaxVolume > 0 && volume > cfg.MaxVolume {
+			log.Warn("Volume exceeds the configured max volume, shrinking", "volume", volume, "new_volume", cfg.MaxVolume)
+			volume = cfg.MaxVolume
+		}
+
+		// Orders are submitted with the pair's volume precision
+		if rounded := assetPair.RoundVolume(volume); rounded != volume {
+			log.Warn("Rounded volume down to the pair's lot decimals", "volume", volume, "new_volume", rounded, "lot_decimals", assetPair.LotDecimals)
+			volume = rounded
+		}
+		if volume < assetPair.OrderMin {
+			log.Error("Volume is below the minimum order size", "volume", assetPair.FormatVolume(volume), "order_min", assetPair.OrderMin)
+			return done(exitcode.TradeFailed)
+		}
+		kraken.RecordDecision("volume", volume)
+
+		// In a trending market one leg is likely to be picked off, the trend filter warns, blocks the
+		// trade or shrinks it in proportion to how far the price moved past max_trend_percent
+		change, err := kraken.GetPriceChange(ctx, opts.Coin, cfg.TrendWindow)
+		if err != nil {
+			log.Warn("Failed to get OHLC data", "error", err)
+		} else {
+			log.Info("Price change", "change", change)
+		}
+		if err == nil && cfg.MaxTrendPercent > 0 && math.Abs(change.Percent) > cfg.MaxTrendPercent {
+			priceChange, trend := change.Percent, math.Abs(change.Percent)
+			trendLog := log.With("change_percent", priceChange, "trend_window", cfg.TrendWindow, "max_trend_percent", cfg.MaxTrendPercent)
+			switch cfg.TrendAction {
+			case "block":
+				kraken.RecordDecision("trend_gate", map[string]interface{}{"change_percent": priceChange, "action": cfg.TrendAction})
+				trendLog.Error("Price is trending, not trading")
+				return done(exitcode.Trending)
+			case "shrink":
+				kraken.RecordDecision("trend_gate", map[string]interface{}{"change_percent": priceChange, "action": cfg.TrendAction})
+				shrunk := assetPair.RoundVolume(volume * cfg.MaxTrendPercent / trend)
+				if shrunk < assetPair.OrderMin {
+					trendLog.Error("Price is trending and the shrunk volume is below the minimum order size, not trading", "volume", assetPair.FormatVolume(shrunk), "order_min", assetPair.OrderMin)
+					return done(exitcode.Trending)
+				}
+				trendLog.Warn("Price is trending, shrinking the trade", "volume", volume, "new_volume", shrunk)
+				volume = shrunk
+			default:
+				trendLog.Warn("Price is trending")
+			}
+		}
+
+		// Check available balance for the base coin (net of holds from open orders), summed over the
+		// variants Kraken reports it under (e.g. XXBT and XBT.F)
+		baseBalance, err := kraken.GetBalance(balances, assetPair.Base)
+		if err != nil {
+			log.Error("Failed to get balance", "asset", assetPair.Base, "error", err)
+			return done(exitcode.TradeFailed)
+		}
+		log.Info("Available balance", "asset", baseBalance.Asset, "available", baseBalance.Available, "breakdown", baseBalance.Breakdown())
+
+		pullEarn := cfg.Earn.AutoDeallocate && opts.Order && !opts.Paper && !opts.Validate
+		// On margin the sell opens a short position instead of selling held coins, both legs need
+		// free margin instead of balances
+		margin := cfg.Leverage > 1 && !opts.Paper
+		if margin {
+			tradeBalance, err := kraken.GetTradeBalance(ctx, assetPair.Quote)
+			if err != nil {
+				log.Error("Failed to get trade balance", "error", err)
+				return done(FailureCode(err))
+			}
+			requiredMargin := 2 * volume * spreadInfo.AskPrice / float64(cfg.Leverage)
+			log.Info("Free margin", "asset", assetPair.Quote, "free_margin", tradeBalance.FreeMargin, "leverage", cfg.Leverage, "need", requiredMargin)
+			if tradeBalance.FreeMargin < requiredMargin {
+				kraken.RecordDecision("insufficient_margin", map[string]float64{"have": tradeBalance.FreeMargin, "need": requiredMargin})
+				log.Error("Insufficient free margin", "asset", assetPair.Quote, "have", tradeBalance.FreeMargin, "need", requiredMargin)
+				return done(exitcode.InsufficientFunds)
+			}
+		}
+		if baseBalance.Available < volume && pullEarn && !margin {
+			baseBalance.Available = pullFromEarn(ctx, cfg, assetPair.BaseAltname(), baseBalance.Available, volume)
+		}
+		if baseBalance.Available < volume && !margin {
+			kraken.RecordDecision("insufficient_balance", map[string]float64{"have": baseBalance.Available, "need": volume})
+			log.Error("Insufficient balance", "asset", baseBalance.Asset, "have", baseBalance.Available, "need", volume)
+			return done(exitcode.InsufficientFunds)
+		}
+
+		// Check the quote currency balance (ZUSD, ZEUR, USDT, ...) for the buy
+		quoteBalance, err := kraken.GetBalance(balances, assetPair.Quote)
+		if err != nil {
+			log.Error("Failed to get balance", "asset", assetPair.Quote, "error", err)
+			return done(exitcode.TradeFailed)
+		}
+		log.Info("Available balance", "asset", quoteBalance.Asset, "available", quoteBalance.Available, "breakdown", quoteBalance.Breakdown())
+
+		requiredQuote := volume * spreadInfo.BidPrice
+		if margin {
+			requiredQuote = 0
+		}
+		if quoteBalance.Available < requiredQuote && pullEarn {
+			quoteBalance.Available = pullFromEarn(ctx, cfg, assetPair.QuoteAltname(), quoteBalance.Available, requiredQuote)
+		}
+		if quoteBalance.Available < requiredQuote {
+			kraken.RecordDecision("insufficient_balance", map[string]float64{"have": quoteBalance.Available, "need": requiredQuote})
+			log.Error("Insufficient balance", "asset", quoteBalance.Asset, "have", quoteBalance.Available, "need", requiredQuote)
+			return done(exitcode.InsufficientFunds)
+		}
+	}
+
+	// Place spread orders, real, simulated or validated only
+	if opts.Order || opts.Paper || opts.Validate {
+		// The spread strategy decides when and at which prices the legs are placed and how a
+		// stalled leg is repriced, the rest of the trade keeps it safe
+		spread := newSpread(strategy.Params{Coin: opts.Coin, Pair: assetPair, Volume: volume, Config: cfg})
+		spread.bandPercentile, spread.bandWindow = opts.BandPercentile, opts.BandWindow
+		var makerFee float64
+		if resumed == nil {
+			// Both legs are limit orders inside the spread and pay the maker fee of the account's tier
+			makerFee = opts.PaperFee
+			if !opts.Paper {
+				tradeVolume, err := kraken.GetTradeVolume(ctx, assetPair)
+				if err != nil {
+					log.Error("Failed to get fee tier", "error", err)
+					return done(FailureCode(err))
+				}
+				makerFee = tradeVolume.MakerFee
+				log.Info("Fee tier", "volume_30d", tradeVolume.Volume, "maker_fee_percent", tradeVolume.MakerFee, "taker_fee_percent", tradeVolume.TakerFee)
+			}
+			spread.params.MakerFeePercent = makerFee
+
+			// Cached market history warms the volatility bands: windows longer than Kraken's 720
+			// candles are covered from the first check after a restart. Recorded sessions use only
+			// what the exchange served, so replays compute the same bands.
+			if opts.MarketCache != "" && cfg.WarmupPeriod > 0 && !kraken.Recording() && !kraken.Replaying() {
+				history, err := marketcache.Open(opts.MarketCache, opts.Coin, cfg.WarmupPeriod)
+				if err != nil {
+					log.Warn("Failed to load cached market history, starting cold", "error", err)
+				} else {
+					log.Info("Loaded cached market history", "candles", len(history.Candles()), "spreads", len(history.Spreads()), "span", history.Span())
+					// Kraken serves the last 12 hours itself, longer windows depend on the cache
+					if opts.BandPercentile > 0 && opts.BandWindow > 12*time.Hour && history.Span() < opts.BandWindow {
+						log.Warn("Cached history doesn't cover the band window yet, the bands use what there is",
+							"span", history.Span(), "bandwindow", opts.BandWindow, "warmup_period", cfg.WarmupPeriod)
+					}
+					spread.useHistory(history)
+				}
+			}
+
+			// Optionally the spread also has to beat its recent typical value. The statistics hold
+			// the last spread_stats_window / spread_sample_interval spreads, seeded from the cached
+			// history and warmed up by sampling the ticker before the first spread check.
+			if !spread.warm() {
+				log.Info("Warming up spread statistics", "samples", spread.sampler.Len(), "spread_stats_window", cfg.SpreadStatsWindow, "spread_sample_interval", cfg.SpreadSampleInterval)
+			}
+			for !spread.warm() {
+				if stopping() {
+					kraken.RecordDecision("interrupted", "spread_warmup")
+					log.Warn("Shutdown signal received, no orders were placed")
+					return done(exitcode.Interrupted)
+				}
+				if err := spread.sample(ctx); err != nil {
+					log.Error("Failed to sample the spread", "error", err)
+					return done(FailureCode(err))
+				}
+				if !spread.warm() {
+					pause(cfg.SpreadSampleInterval)
+				}
+			}
+
+			// Place order only if spread is within the boundaries. The waited time is counted in
+			// check intervals rather than wall time so replays time out at the same check.
+			var waited time.Duration
+			for {
+				if stopping() {
+					kraken.RecordDecision("interrupted", "spread_gate")
+					log.Warn("Shutdown signal received, no orders were placed")
+					return done(exitcode.Interrupted)
+				}
+				if cfg.SpreadTimeout > 0 && waited >= cfg.SpreadTimeout {
+					kraken.RecordDecision("spread_timeout", waited.String())
+					log.Error("Spread, volume and profit after fees did not meet the boundaries in time", "spread_timeout", cfg.SpreadTimeout)
+					return done(exitcode.SpreadTimeout)
+				}
+
+				// A halted or delisted pair takes no new entries, waiting for it makes no sense
+				pairStatus, err := kraken.GetTradingStatus(ctx, assetPair)
+				if err != nil {
+					log.Error("Failed to get pair trading status", "error", err)
+					return done(FailureCode(err))
+				}
+				if !kraken.EntriesAllowed(pairStatus) {
+					kraken.RecordDecision("pair_status", pairStatus)
+					log.Error("Pair is not taking new orders", "status", pairStatus)
+					alertPairStatus(ctx, opts.Coin, pairStatus, "", "")
+					return done(exitcode.PairHalted)
+				}
+
+				log.Debug("Getting fresh spread boundary to assess min. spread and min. volume")
+				spreadInfo, err = kraken.GetTickerInfo(ctx, opts.Coin)
+				if err != nil {
+					log.Error("Failed to get spread boundary", "error", err)
+					return done(FailureCode(err))
+				}
+				// The strategy logs why it failed or keeps waiting
+				if err := spread.OnTick(ctx, strategy.Tick{Time: time.Now(), Spread: spreadInfo}); err != nil {
+					return done(FailureCode(err))
+				}
+				if len(spread.DesiredOrders()) == 0 {
+					pause(cfg.SpreadCheckInterval)
+					waited += cfg.SpreadCheckInterval
+					continue
+				}
+				spreadInfo = spread.quote
+				break
+			}
+		}
+
+		// Account-wide limits are checked last, against the orders open right before placement.
+		// Paper orders don't touch the account.
+		limits := risk.Limits{MaxExposureUSD: cfg.MaxExposureUSD, MaxOpenSpreads: cfg.MaxOpenSpreads}
+		if resumed == nil && !opts.Paper && (limits.MaxExposureUSD > 0 || limits.MaxOpenSpreads > 0) {
+			openOrders, err := kraken.GetOpenOrders(ctx, "")
+			if err != nil {
+				log.Error("Failed to get open orders for the risk limits", "error", err)
+				return done(FailureCode(err))
+			}
+			exposure := risk.Measure(openOrders, assetPair)
+			tradeUSD := volume * spreadInfo.BidPrice
+			err = limits.Check(exposure, tradeUSD)
+			kraken.RecordDecision("risk_limits", map[string]interface{}{
+				"coin_exposure_usd": exposure.CoinUSD,
+				"open_spreads":      exposure.OpenSpreads,
+				"pass":              err == nil,
+			})
+			log.Info("Open exposure",
+				"coin_exposure_usd", exposure.CoinUSD,
+				"trade_usd", tradeUSD,
+				"max_exposure_usd", limits.MaxExposureUSD,
+				"open_spreads", exposure.OpenSpreads,
+				"max_open_spreads", limits.MaxOpenSpreads,
+				"other_orders", exposure.OtherOrders)
+			if err != nil {
+				log.Error("Risk limit reached, no orders placed", "error", err)
+				return done(exitcode.RiskLimit)
+			}
+		}
+
+		// Open the journal before placing orders, trades with real money must not go unrecorded.
+		// Every write is committed on its own, so exiting without closing loses nothing. Replays and paper trades never write to it.
+		var journal *store.Store
+		if opts.JournalPath != "" && !kraken.Replaying() && !opts.Paper && !opts.Validate {
+			journal, err = store.Open(opts.JournalPath)
+			if err != nil {
+				log.Error("Failed to open trade journal", "error", err)
+				return done(exitcode.TradeFailed)
+			}
+		}
+		// The kill switch: once the day's realized loss reaches the limit, no new trades until the
+		// next day in the configured time zone
+		if journal != nil && resumed == nil && cfg.DailyLossLimit > 0 {
+			now := time.Now().In(cfg.Location())
+			today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+			pnl, err := journal.RealizedPnL(today, time.Time{})
+			if err != nil {
+				log.Error("Failed to read the day's realized P&L", "error", err)
+				return done(exitcode.TradeFailed)
+			}
+			if pnl <= -cfg.DailyLossLimit {
+				log.Error("Daily loss limit reached, no orders placed",
+					"realized_pnl_usd", pnl,
+					"daily_loss_limit_usd", cfg.DailyLossLimit,
+					"day", today.Format("2006-01-02"))
+				message := fmt.Sprintf("🛑 Daily loss limit reached: realized %s USD today (limit %s USD), no new trades until tomorrow (%s)",
+					money.FormatSigned(pnl, "USD"), money.Format(cfg.DailyLossLimit, "USD"), cfg.TimeZone)
+				if cfg.DailyLossCancel {
+					canceled, failed := cancelJournaledOrders(ctx, journal)
+					message += fmt.Sprintf("\nCanceled %d open orders of the bot", canceled)
+					if failed > 0 {
+						message += fmt.Sprintf(", %d failed to cancel, check them manually", failed)
+					}
+				}
+				if err := kraken.SendSlackMessage(ctx, message); err != nil {
+					log.Warn("Failed to send Slack message", "error", err)
+				}
+				return done(exitcode.DailyLossLimit)
+			}
+			log.Info("Daily realized P&L", "realized_pnl_usd", pnl, "daily_loss_limit_usd", cfg.DailyLossLimit)
+		}
+		if journal != nil && resumed == nil {
+			if err := journal.StartTrade(store.Trade{ID: tradeID, Pair: pairName, Volume: volume, Untradeable: untradeable, StartedAt: time.Now()}); err != nil {
+				log.Error("Failed to record trade in journal", "error", err)
+				return done(exitcode.TradeFailed)
+			}
+		}
+
+		// Resumed trades continue with their recorded orders
+		var buyTxId, sellTxId string
+		var estimatedProfit, estimatedPercentGain float64
+
+		// saveState records the trade's current orders for a restarted trader, clearState removes
+		// them once the trade is over and no order of it is left open
+		saveState := func() bool {
+			if statePath == "" {
+				return false
+			}
+			state := tradestate.Trade{
+				TradeID:              tradeID,
+				Coin:                 opts.Coin,
+				Quote:                kraken.Quote,
+				BuyTxID:              buyTxId,
+				SellTxID:             sellTxId,
+				Volume:               volume,
+				Untradeable:          untradeable,
+				EstimatedProfit:      estimatedProfit,
+				EstimatedPercentGain: estimatedPercentGain,
+				PlacedAt:             time.Now(),
+			}
+			if resumed != nil {
+				state.PlacedAt = resumed.PlacedAt
+			}
+			if err := tradestate.Save(statePath, state); err != nil {
+				log.Warn("Failed to save trade state, a restarted trader won't resume this trade", "error", err)
+				return false
+			}
+			return true
+		}
+		clearState := func() {
+			if statePath == "" {
+				return
+			}
+			if err := tradestate.Clear(statePath); err != nil {
+				log.Warn("Failed to clear trade state", "error", err)
+			}
+		}
+
+		// snapshot journals the top of the order book and the last public trades at a moment the
+		// trade went wrong, so a post-mortem can tell a market move from a bot bug
+		snapshot := func(reason string) {
+			if journal == nil || cfg.SnapshotDepth == 0 {
+				return
+			}
+			book, err := kraken.GetOrderBook(ctx, assetPair.Altname, cfg.SnapshotDepth)
+			if err != nil {
+				log.Warn("Failed to get order book for the snapshot", "reason", reason, "error", err)
+				return
+			}
+			trades, _, err := kraken.GetRecentTrades(ctx, assetPair.Altname, "")
+			if err != nil {
+				log.Warn("Failed to get recent trades for the snapshot", "reason", reason, "error", err)
+			}
+			if len(trades) > cfg.SnapshotTrades {
+				trades = trades[len(trades)-cfg.SnapshotTrades:]
+			}
+			if trades == nil {
+				trades = []kraken.PublicTrade{}
+			}
+			bookJSON, err := json.Marshal(book)
+			if err != nil {
+				log.Warn("Failed to encode order book snapshot", "error", err)
+				return
+			}
+			tradesJSON, err := json.Marshal(trades)
+			if err != nil {
+				log.Warn("Failed to encode recent trades snapshot", "error", err)
+				return
+			}
+			if err := journal.RecordSnapshot(store.Snapshot{TradeID: tradeID, Reason: reason, TakenAt: time.Now(), Book: bookJSON, Trades: tradesJSON}); err != nil {
+				log.Warn("Failed to record market snapshot in journal", "error", err)
+				return
+			}
+			log.Info("Market snapshot journaled", "reason", reason, "levels", cfg.SnapshotDepth, "trades", len(trades))
+		}
+
+		// Armed before placement, so a crash between the two legs is covered as well. Recordings
+		// and replays leave it off, its timed resets would make them diverge.
+		if cfg.DeadManTimeout > 0 && !opts.Paper && !opts.Validate && !kraken.Recording() && !kraken.Replaying() {
+			if err := kraken.ArmDeadMansSwitch(ctx, cfg.DeadManTimeout); err != nil {
+				log.Error("Failed to arm dead man's switch", "error", err)
+				return done(FailureCode(err))
+			}
+			// Orders left open on purpose (-detach, -onsignal leave, manual checks) must outlive the trade
+			defer func() {
+				if err := kraken.DisarmDeadMansSwitch(context.Background()); err != nil {
+					log.Error("Failed to disarm dead man's switch, open orders will be canceled", "error", err)
+				}
+			}()
+		}
+
+		if resumed == nil {
+			buyTxId, sellTxId, estimatedProfit, estimatedPercentGain, err = kraken.PlaceSpreadOrders(ctx, opts.Coin, assetPair, spreadInfo, volume, untradeable, cfg.SpreadNarrowFactor, spread.bands, makerFee, kraken.UserRef(tradeID))
+			if err != nil {
+				log.Error("Failed to place spread orders", "error", err)
+				snapshot("placement_failed")
+				return done(FailureCode(err))
+			}
+			if opts.Validate {
+				log.Info("Preflight passed, the exchange accepted both orders",
+					"estimated_profit_usd", estimatedProfit,
+					"estimated_gain_percent", estimatedPercentGain)
+				return done(exitcode.OK)
+			}
+			if journal != nil {
+				for side, txId := range map[string]string{"buy": buyTxId, "sell": sellTxId} {
+					if err := journal.RecordOrder(store.Order{TxID: txId, TradeID: tradeID, Side: side, Volume: volume, PlacedAt: time.Now()}); err != nil {
+						log.Warn("Failed to record order in journal", "txid", txId, "error", err)
+					}
+				}
+			}
+			events.Emit(events.OrdersPlaced, map[string]interface{}{
+				"pair":                   pairName,
+				"buy_txid":               buyTxId,
+				"sell_txid":              sellTxId,
+				"volume":                 volume,
+				"untradeable":            untradeable,
+				"estimated_profit_usd":   estimatedProfit,
+				"estimated_gain_percent": estimatedPercentGain,
+			})
+			outcome.PlacedAt = time.Now()
+			saved := saveState()
+
+			// Without the state no monitor would find the orders, keep monitoring them here
+			if opts.Detach && !saved {
+				log.Error("Trade state not saved, monitoring the orders instead of detaching")
+			} else if opts.Detach {
+				log.Info("Orders placed, detaching, monitor them with cmd/monitor", "state", statePath)
+				if journal != nil {
+					if err := journal.Close(); err != nil {
+						log.Warn("Failed to close trade journal", "error", err)
+					}
+				}
+				return done(exitcode.OK)
+			}
+		} else {
+			buyTxId, sellTxId = resumed.BuyTxID, resumed.SellTxID
+			outcome.PlacedAt = resumed.PlacedAt
+			estimatedProfit, estimatedPercentGain = resumed.EstimatedProfit, resumed.EstimatedPercentGain
+		}
+
+		// Last reported state per order, fills are emitted and journaled on changes only
+		lastFill := map[string]string{}
+		reportFill := func(txId string, order *kraken.OrderStatus) {
+			state := order.Status + "/" + order.VolExec
+			if lastFill[txId] == state {
+				return
+			}
+			lastFill[txId] = state
+			events.Emit(events.Fill, map[string]interface{}{
+				"txid":     txId,
+				"side":     order.Descr.Type,
+				"status":   order.Status,
+				"price":    order.Descr.Price,
+				"volume":   order.Vol,
+				"vol_exec": order.VolExec,
+				"cost":     order.Cost,
+				"fee":      order.Fee,
+			})
+			if journal != nil {
+				fill := store.Fill{
+					TxID:       txId,
+					Status:     order.Status,
+					Price:      kraken.ParseFloat(order.Descr.Price),
+					VolExec:    kraken.ParseFloat(order.VolExec),
+					Cost:       kraken.ParseFloat(order.Cost),
+					Fee:        kraken.ParseFloat(order.Fee),
+					ObservedAt: time.Now(),
+				}
+				if err := journal.RecordFill(fill); err != nil {
+					log.Warn("Failed to record fill in journal", "txid", txId, "error", err)
+				}
+			}
+		}
+
+		// Orders the trader canceled itself and each order as first seen. A cancellation or amendment
+		// it didn't make was done outside it (the web UI, another client): the trade is reported and
+		// then only watched, no more cancels, edits or re-placements based on stale assumptions.
+		selfCanceled := map[string]bool{}
+		firstSeen := map[string]*kraken.OrderStatus{}
+		externalSeen := map[string]bool{}
+		external := false
+		checkExternal := func(txId string, order *kraken.OrderStatus) {
+			var change string
+			first, seen := firstSeen[txId]
+			switch {
+			case !seen:
+				firstSeen[txId] = order
+			case order.Status == "canceled" && !selfCanceled[txId] && !kraken.PostOnlyCanceled(order):
+				change = "canceled"
+			default:
+				change = kraken.OrderAmended(first, order)
+			}
+			if change == "" || externalSeen[txId] {
+				return
+			}
+			externalSeen[txId] = true
+			external = true
+			kraken.RecordDecision("external_activity", change)
+			log.Error("Order changed outside the trader, only watching the trade from now on",
+				"txid", txId,
+				"side", order.Descr.Type,
+				"change", change,
+				"status", order.Status,
+				"vol_exec", order.VolExec)
+			events.Emit(events.External, map[string]interface{}{
+				"txid":     txId,
+				"side":     order.Descr.Type,
+				"change":   change,
+				"status":   order.Status,
+				"price":    order.Descr.Price,
+				"volume":   order.Vol,
+				"vol_exec": order.VolExec,
+			})
+			snapshot("external_activity")
+			slackErr := kraken.SendSlackMessage(ctx, fmt.Sprintf(
+				"👀 Trade %s: %s order %s changed outside the trader (%s)\n"+
+					"The trader no longer cancels, reprices or resizes the orders, it only reports the outcome",
+				pairName, order.Descr.Type, txId, change))
+			if slackErr != nil {
+				log.Warn("Failed to send Slack message", "error", slackErr)
+			}
+		}
+
+		// cancelUnfilled cancels both orders if neither has filled and finishes the trade with
+		// result and exit code. A leg filling during the cancellation needs a manual check.
+		cancelUnfilled := func(result string, code int, message string) *TradeResult {
+			for _, txId := range []string{buyTxId, sellTxId} {
+				if err := kraken.CancelOrder(ctx, txId); err != nil {
+					log.Warn("Failed to cancel order", "txid", txId, "error", err)
+				}
+			}
+
+			// A leg may have filled between the last check and the cancellation
+			buyOrder, buyErr := kraken.CheckOrderStatus(ctx, buyTxId)
+			sellOrder, sellErr := kraken.CheckOrderStatus(ctx, sellTxId)
+			if buyErr != nil || sellErr != nil || kraken.ParseFloat(buyOrder.VolExec) > 0 || kraken.ParseFloat(sellOrder.VolExec) > 0 ||
+				buyOrder.Status != "canceled" || sellOrder.Status != "canceled" {
+				kraken.RecordDecision("trade_result", result+"_incomplete")
+				log.Error("Orders were not both canceled unfilled, check them manually",
+					"result", result,
+					"buy_txid", buyTxId,
+					"sell_txid", sellTxId,
+					"buy_error", buyErr,
+					"sell_error", sellErr)
+				slackErr := kraken.SendSlackMessage(ctx, fmt.Sprintf(
+					"⚠️ Trade %s (%s): the orders were not both canceled unfilled, check them manually\n"+
+						"Buy Order ID: %s\n"+
+						"Sell Order ID: %s",
+					pairName, result, buyTxId, sellTxId))
+				if slackErr != nil {
+					log.Warn("Failed to send Slack message", "error", slackErr)
+				}
+				snapshot("cancel_incomplete")
+				return done(exitcode.TradeFailed)
+			}
+			reportFill(buyTxId, buyOrder)
+			reportFill(sellTxId, sellOrder)
+
+			kraken.RecordDecision("trade_result", result)
+			log.Warn("Both orders canceled unfilled",
+				"result", result,
+				"unrealised_profit_usd", estimatedProfit,
+				"unrealised_gain_percent", estimatedPercentGain)
+			events.Emit(events.Result, map[string]interface{}{
+				"result":                  result,
+				"unrealised_profit_usd":   estimatedProfit,
+				"unrealised_gain_percent": estimatedPercentGain,
+			})
+			outcome.finish(result)
+			if journal != nil {
+				tradeResult := store.TradeResult{Result: result, EstimatedProfit: estimatedProfit, FinishedAt: time.Now()}
+				if err := journal.FinishTrade(tradeID, tradeResult); err != nil {
+					log.Warn("Failed to record trade result in journal", "error", err)
+				}
+			}
+			slackErr := kraken.SendSlackMessage(ctx, fmt.Sprintf("%s\nBuy Order ID: %s\nSell Order ID: %s", message, buyTxId, sellTxId))
+			if slackErr != nil {
+				log.Warn("Failed to send Slack message", "error", slackErr)
+			}
+			if opts.Paper {
+				LogPaperAccount(log, assetPair, nil)
+			}
+			clearState()
+			return done(code)
+		}
+
+		// shutdownTrade handles a shutdown signal once the orders are placed: open orders are
+		// canceled (or left with -onsignal leave), the outcome is journaled and sent to Slack
+		shutdownTrade := func() *TradeResult {
+			log.Warn("Shutdown signal received", "onsignal", opts.OnSignal)
+			var canceled, left []string
+			legFilled := false
+			for _, txId := range []string{buyTxId, sellTxId} {
+				order, err := kraken.CheckOrderStatus(ctx, txId)
+				if err == nil && order.Status != "open" && order.Status != "pending" {
+					legFilled = legFilled || order.Status == "closed"
+					continue
+				}
+				if opts.OnSignal == "leave" {
+					left = append(left, txId)
+					continue
+				}
+				if err := kraken.CancelOrder(ctx, txId); err != nil {
+					log.Warn("Failed to cancel order", "txid", txId, "error", err)
+					left = append(left, txId)
+					continue
+				}
+				canceled = append(canceled, txId)
+			}
+
+			kraken.RecordDecision("trade_result", "interrupted")
+			log.Warn("Trade interrupted", "canceled_txids", canceled, "open_txids", left)
+			// Canceling the other leg of a filled one leaves the position open at market risk
+			if legFilled && len(canceled) > 0 {
+				snapshot("leg_abandoned")
+			}
+			events.Emit(events.Result, map[string]interface{}{
+				"result":        "interrupted",
+				"canceled_txid": canceled,
+				"open_txid":     left,
+			})
+			outcome.finish("interrupted")
+			if journal != nil {
+				tradeResult := store.TradeResult{Result: "interrupted", EstimatedProfit: estimatedProfit, FinishedAt: time.Now()}
+				if err := journal.FinishTrade(tradeID, tradeResult); err != nil {
+					log.Warn("Failed to record trade result in journal", "error", err)
+				}
+				if err := journal.Close(); err != nil {
+					log.Warn("Failed to close trade journal", "error", err)
+				}
+			}
+			message := fmt.Sprintf("🛑 Trade %s interrupted by a shutdown signal", pairName)
+			if len(canceled) > 0 {
+				message += "\nCanceled: " + strings.Join(canceled, ", ")
+			}
+			if len(left) > 0 {
+				message += "\nStill open on the exchange: " + strings.Join(left, ", ")
+			}
+			if err := kraken.SendSlackMessage(ctx, message); err != nil {
+				log.Warn("Failed to send Slack message", "error", err)
+			}
+			if opts.Paper {
+				LogPaperAccount(log, assetPair, nil)
+			}
+			// Orders left open are resumed by the next run
+			if len(left) == 0 {
+				clearState()
+			}
+			return done(exitcode.Interrupted)
+		}
+
+		// Trading status of the pair as last seen, orders were placed while it was open
+		pairStatus := kraken.StatusOnline
+
+		// Time both orders have been open, counted in check intervals like the spread timeout so
+		// replays time out at the same check. The spread strategy times the stalled leg likewise.
+		var orderWaited time.Duration
+		// The stalled leg reached the max loss price, snapshotted once
+		atMaxLoss := false
+		// Post-only legs placed again after the exchange canceled them for crossing the book
+		postOnlyRetried := 0
+
+		// Orders as last seen through the private API, what's known of them if it's lost
+		lastSeen := map[string]*kraken.OrderStatus{}
+		// Time the private API has been rejecting the credentials and since the last alert about
+		// it, counted in check intervals like the other timers
+		var degradedFor, sinceDegradedAlert time.Duration
+		degraded := false
+
+		// degradedCheck runs instead of a status check while the private API rejects the
+		// credentials (key revoked, permissions changed): nothing can be canceled or repriced, so
+		// the orders are watched through public market data and the orders needing manual
+		// attention are alerted about until access is back
+		degradedCheck := func(apiErr error) {
+			if !degraded {
+				degraded = true
+				kraken.RecordDecision("private_api_lost", apiErr.Error())
+				snapshot("private_api_lost")
+			}
+			degradedFor += cfg.StatusCheckInterval
+			sinceDegradedAlert += cfg.StatusCheckInterval
+			if degradedFor > cfg.StatusCheckInterval && sinceDegradedAlert < degradedAlertInterval {
+				return
+			}
+			sinceDegradedAlert = 0
+
+			market, err := kraken.GetTickerInfo(ctx, opts.Coin)
+			if err != nil {
+				log.Warn("Failed to get public market data in degraded mode", "error", err)
+			}
+			var lines []string
+			for _, txId := range []string{buyTxId, sellTxId} {
+				order, ok := lastSeen[txId]
+				if !ok {
+					lines = append(lines, fmt.Sprintf("- %s: never seen, check it on the exchange", txId))
+					continue
+				}
+				line := fmt.Sprintf("- %s %s %s @ %s: last seen %s, executed %s", order.Descr.Type, txId, order.Vol, order.Descr.Price, order.Status, order.VolExec)
+				// A buy at or above the ask (a sell at or below the bid) has most likely filled since
+				price := kraken.ParseFloat(order.Descr.Price)
+				if market != nil && !kraken.OrderDone(order.Status) &&
+					((order.Descr.Type == "buy" && market.AskPrice <= price) || (order.Descr.Type == "sell" && market.BidPrice >= price)) {
+					line += ", the market has traded through its price, likely filled"
+				}
+				lines = append(lines, line)
+			}
+			log.Error("Private API access lost, the orders can't be checked, canceled or repriced, check them manually",
+				"error", apiErr,
+				"degraded_for", degradedFor,
+				"buy_txid", buyTxId,
+				"sell_txid", sellTxId)
+			message := fmt.Sprintf("🚨 Trade %s: private API access lost for %s (%v)\n"+
+				"The trader keeps watching the market but can't check, cancel or reprice the orders. Check them on the exchange:\n%s",
+				pairName, degradedFor, apiErr, strings.Join(lines, "\n"))
+			if market != nil {
+				message += fmt.Sprintf("\nMarket now: bid %s, ask %s", assetPair.FormatPrice(market.BidPrice), assetPair.FormatPrice(market.AskPrice))
+			}
+			if err := kraken.SendSlackMessage(ctx, message); err != nil {
+				log.Warn("Failed to send Slack message", "error", err)
+			}
+		}
+
+		// Check status of both orders until both are closed
+		for {
+			pause(cfg.StatusCheckInterval)
+			if stopping() {
+				return shutdownTrade()
+			}
+
+			buyOrder, err := kraken.CheckOrderStatus(ctx, buyTxId)
+			if err != nil {
+				log.Warn("Failed to check buy order status", "txid", buyTxId, "error", err)
+				if kraken.ReplayExhausted() {
+					return done(exitcode.TradeFailed)
+				}
+				if kraken.IsAuthError(err) {
+					degradedCheck(err)
+				}
+				continue
+			}
+			if degraded {
+				log.Warn("Private API access is back, resuming the trade", "degraded_for", degradedFor)
+				if err := kraken.SendSlackMessage(ctx, fmt.Sprintf("✅ Trade %s: private API access is back after %s, the trader resumed", pairName, degradedFor)); err != nil {
+					log.Warn("Failed to send Slack message", "error", err)
+				}
+				degraded, degradedFor, sinceDegradedAlert = false, 0, 0
+			}
+			lastSeen[buyTxId] = buyOrder
+			reportFill(buyTxId, buyOrder)
+			spread.OnFill(ctx, legFill(buyTxId, buyOrder))
+			checkExternal(buyTxId, buyOrder)
+
+			sellOrder, err := kraken.CheckOrderStatus(ctx, sellTxId)
+			if err != nil {
+				log.Warn("Failed to check sell order status", "txid", sellTxId, "error", err)
+				if kraken.ReplayExhausted() {
+					return done(exitcode.TradeFailed)
+				}
+				if kraken.IsAuthError(err) {
+					degradedCheck(err)
+				}
+				continue
+			}
+			lastSeen[sellTxId] = sellOrder
+			reportFill(sellTxId, sellOrder)
+			spread.OnFill(ctx, legFill(sellTxId, sellOrder))
+			checkExternal(sellTxId, sellOrder)
+
+			// A post-only leg the exchange canceled for crossing the book is placed again at the
+			// freshly narrowed price. The market moved towards the leg, so the new price is never
+			// worse than the canceled one and the trade's profit holds.
+			if opts.PostOnly && !external && postOnlyRetried < opts.PostOnlyRetries {
+				var canceled *kraken.OrderStatus
+				canceledTxId := &buyTxId
+				if kraken.PostOnlyCanceled(buyOrder) {
+					canceled = buyOrder
+				} else if kraken.PostOnlyCanceled(sellOrder) {
+					canceled, canceledTxId = sellOrder, &sellTxId
+				}
+				if canceled != nil {
+					postOnlyRetried++
+					isBuy := canceled.Descr.Type == "buy"
+					oldPrice := kraken.ParseFloat(canceled.Descr.Price)
+					marketInfo, err := kraken.GetTickerInfo(ctx, opts.Coin)
+					if err != nil {
+						log.Warn("Failed to get spread for re-placing a post-only leg", "error", err)
+						continue
+					}
+					freshBuy, freshSell := spread.prices(marketInfo)
+					newPrice := math.Max(freshSell, oldPrice)
+					if isBuy {
+						newPrice = math.Min(freshBuy, oldPrice)
+					}
+					newTxId, err := kraken.PlaceLimitOrder(ctx, assetPair, newPrice, kraken.ParseFloat(canceled.Vol), isBuy, untradeable, kraken.UserRef(tradeID))
+					if err != nil {
+						log.Warn("Failed to re-place post-only leg", "txid", *canceledTxId, "error", err)
+						continue
+					}
+					log.Warn("Re-placed post-only leg canceled for crossing the book",
+						"type", canceled.Descr.Type,
+						"attempt", postOnlyRetried,
+						"old_price", oldPrice,
+						"new_price", newPrice,
+						"bid", marketInfo.BidPrice,
+						"ask", marketInfo.AskPrice,
+						"old_txid", *canceledTxId,
+						"new_txid", newTxId)
+					events.Emit(events.Reprice, map[string]interface{}{
+						"side":      canceled.Descr.Type,
+						"old_txid":  *canceledTxId,
+						"new_txid":  newTxId,
+						"old_price": oldPrice,
+						"new_price": newPrice,
+						"reason":    "post_only",
+					})
+					if journal != nil {
+						if err := journal.RecordOrder(store.Order{TxID: newTxId, TradeID: tradeID, Side: canceled.Descr.Type, Volume: kraken.ParseFloat(canceled.Vol), PlacedAt: time.Now()}); err != nil {
+							log.Warn("Failed to record order in journal", "txid", newTxId, "error", err)
+						}
+					}
+					*canceledTxId = newTxId
+					saveState()
+					continue
+				}
+			}
+
+			// Once both orders are done, report the trade on the volume they executed and exit
+			execution := kraken.ExecutionOf(buyOrder, sellOrder)
+			if kraken.OrderDone(buyOrder.Status) && kraken.OrderDone(sellOrder.Status) && execution.BuyVolume+execution.SellVolume > 0 {
+				result := "complete"
+				if buyOrder.Status != "closed" || sellOrder.Status != "closed" {
+					result = "partial"
+				}
+				// Both legs filled and the position is flat again, the closes Kraken attached to
+				// them would reopen it. A partial trade keeps them guarding its unmatched volume.
+				if result == "complete" {
+					if _, err := kraken.CancelConditionalCloses(ctx, opts.Coin, kraken.UserRef(tradeID), buyTxId, sellTxId); err != nil {
+						log.Error("Failed to cancel the conditional closes of the trade", "error", err)
+					}
+				}
+				kraken.RecordDecision("trade_result", result)
+				// Get current spread information
+				currentSpreadInfo, err := kraken.GetTickerInfo(ctx, opts.Coin)
+				if err != nil {
+					log.Warn("Failed to get current spread info", "error", err)
+				}
+
+				// Calculate spread information
+				spread := currentSpreadInfo.Spread
+				spreadPercent := (spread / currentSpreadInfo.BidPrice) * 100
+
+				// Get 24h volume
+				volume24h, err := kraken.Get24hVolume(ctx, opts.Coin)
+				if err != nil {
+					log.Warn("Failed to get 24h volume", "error", err)
+				}
+
+				// Calculate the fees of the matched volume, rounded per leg so the legs add up to the total
+				quote := assetPair.QuoteAltname()
+				buyFee := money.Round(execution.BuyFee, quote)
+				sellFee := money.Round(execution.SellFee, quote)
+				totalFees := money.Sum(quote, buyFee, sellFee)
+
+				// Average executed prices, better than the limit prices if an order filled through the book
+				buyPrice, sellPrice := execution.BuyPrice, execution.SellPrice
+
+				if result == "complete" {
+					log.Info("Trade complete, both buy and sell orders have been executed",
+						"buy_price", buyPrice,
+						"sell_price", sellPrice,
+						"fees_usd", totalFees,
+						"buy_fee_usd", buyFee,
+						"sell_fee_usd", sellFee)
+				} else {
+					log.Warn("Trade partially executed, the P&L covers the volume both legs executed",
+						"buy_status", buyOrder.Status,
+						"sell_status", sellOrder.Status,
+						"buy_volume", execution.BuyVolume,
+						"sell_volume", execution.SellVolume,
+						"matched_volume", execution.Matched,
+						"unmatched_volume", execution.Unmatched,
+						"buy_price", buyPrice,
+						"sell_price", sellPrice,
+						"fees_usd", totalFees)
+				}
+
+				// Realised P&L of the matched volume
+				grossProfit := money.Round(execution.GrossProfit, quote)
+				netProfit := money.Round(grossProfit-totalFees, quote)
+				resultEvent := map[string]interface{}{
+					"result":                 result,
+					"volume":                 execution.Matched,
+					"buy_volume":             execution.BuyVolume,
+					"sell_volume":            execution.SellVolume,
+					"unmatched_volume":       execution.Unmatched,
+					"buy_price":              buyPrice,
+					"sell_price":             sellPrice,
+					"buy_cost_usd":           kraken.ParseFloat(buyOrder.Cost),
+					"sell_cost_usd":          kraken.ParseFloat(sellOrder.Cost),
+					"fees_usd":               totalFees,
+					"gross_profit_usd":       grossProfit,
+					"net_profit_usd":         netProfit,
+					"estimated_profit_usd":   estimatedProfit,
+					"estimated_gain_percent": estimatedPercentGain,
+					"quote":                  quote,
+				}
+
+				// Crypto and foreign quote currencies are converted for reporting only, the journal keeps the quote amounts
+				usdLine := ""
+				if opts.USDValue && kraken.Altname(quote) != "USD" {
+					rate, err := kraken.USDRate(ctx, quote)
+					if err != nil {
+						log.Warn("Failed to convert the P&L to USD", "quote", quote, "error", err)
+					} else {
+						netUSD, feesUSD := money.Round(netProfit*rate, "USD"), money.Round(totalFees*rate, "USD")
+						resultEvent["usd_rate"] = rate
+						resultEvent["net_profit_in_usd"] = netUSD
+						resultEvent["fees_in_usd"] = feesUSD
+						log.Info("P&L in USD", "usd_rate", rate, "net_profit", netUSD, "fees", feesUSD)
+						usdLine = fmt.Sprintf("\nIn USD: net profit %s USD, fees %s USD (1 %s = %g USD)",
+							money.FormatSigned(netUSD, "USD"), money.Format(feesUSD, "USD"), quote, rate)
+					}
+				}
+				events.Emit(events.Result, resultEvent)
+				outcome.finish(result)
+				outcome.Volume = execution.Matched
+				outcome.BuyPrice, outcome.SellPrice = buyPrice, sellPrice
+				outcome.FeesUSD, outcome.GrossProfitUSD, outcome.NetProfitUSD = totalFees, grossProfit, netProfit
+				outcome.EstimatedProfitUSD = estimatedProfit
+				if journal != nil {
+					tradeResult := store.TradeResult{
+						Result:          result,
+						BuyPrice:        buyPrice,
+						SellPrice:       sellPrice,
+						Fees:            totalFees,
+						GrossProfit:     grossProfit,
+						NetProfit:       netProfit,
+						EstimatedProfit: estimatedProfit,
+						FinishedAt:      time.Now(),
+					}
+					if err := journal.FinishTrade(tradeID, tradeResult); err != nil {
+						log.Warn("Failed to record trade result in journal", "error", err)
+					}
+				}
+				title := fmt.Sprintf("✅ Trade %s executed", pairName)
+				if result == "partial" {
+					title = fmt.Sprintf("⚠️ Trade %s partially executed (buy %s, sell %s)", pairName, buyOrder.Status, sellOrder.Status)
+				}
+				message := fmt.Sprintf(
+					"%s\n"+
+						"Volume: %s\n"+
+						"Buy price: %s\n"+
+						"Sell price: %s\n"+
+						"Estimated profit: %s %s (%.4f%%)\n"+
+						"Net profit: %s %s\n"+
+						"Buy Order ID: %s\n"+
+						"Sell Order ID: %s\n"+
+						"Spread now: %s (%.4f%%)\n"+
+						"24h Volume: %s %s\n"+
+						"Fees: %s %s (Buy: %s, Sell: %s)",
+					title,
+					assetPair.FormatVolume(execution.Matched),
+					assetPair.FormatPrice(buyPrice),
+					assetPair.FormatPrice(sellPrice),
+					money.Format(estimatedProfit, quote), quote,
+					estimatedPercentGain,
+					money.Format(netProfit, quote), quote,
+					buyTxId,
+					sellTxId,
+					assetPair.FormatPrice(spread),
+					spreadPercent,
+					money.Format(volume24h, quote), quote,
+					money.Format(totalFees, quote), quote,
+					money.Format(buyFee, quote),
+					money.Format(sellFee, quote),
+				)
+				message += usdLine
+				if execution.Unmatched > 0 {
+					message += fmt.Sprintf("\nUnmatched: %s %s bought but not sold, check the position manually", assetPair.FormatVolume(execution.Unmatched), opts.Coin)
+				} else if execution.Unmatched < 0 {
+					message += fmt.Sprintf("\nUnmatched: %s %s sold but not bought, check the position manually", assetPair.FormatVolume(-execution.Unmatched), opts.Coin)
+				}
+				if slackErr := kraken.SendSlackMessage(ctx, message); slackErr != nil {
+					log.Warn("Failed to send Slack message", "error", slackErr)
+				}
+				if opts.Paper {
+					LogPaperAccount(log, assetPair, currentSpreadInfo)
+				}
+				clearState()
+				// An open position left by unmatched volume needs a manual check
+				if execution.Unmatched != 0 {
+					return done(exitcode.TradeFailed)
+				}
+				return done(exitcode.OK)
+			}
+
+			if kraken.OrderDone(buyOrder.Status) && kraken.OrderDone(sellOrder.Status) {
+				kraken.RecordDecision("trade_result", "canceled")
+				log.Warn("Trade canceled, both buy and sell orders have been canceled",
+					"buy_status", buyOrder.Status,
+					"sell_status", sellOrder.Status,
+					"unrealised_profit_usd", estimatedProfit,
+					"unrealised_gain_percent", estimatedPercentGain)
+				events.Emit(events.Result, map[string]interface{}{
+					"result":                  "canceled",
+					"unrealised_profit_usd":   estimatedProfit,
+					"unrealised_gain_percent": estimatedPercentGain,
+				})
+				outcome.finish("canceled")
+				if journal != nil {
+					result := store.TradeResult{Result: "canceled", EstimatedProfit: estimatedProfit, FinishedAt: time.Now()}
+					if err := journal.FinishTrade(tradeID, result); err != nil {
+						log.Warn("Failed to record trade result in journal", "error", err)
+					}
+				}
+				if opts.Paper {
+					LogPaperAccount(log, assetPair, nil)
+				}
+				clearState()
+				// Orders expired by time_in_force GTD timed out on the exchange, like -maxwait
+				if buyOrder.Status == "expired" && sellOrder.Status == "expired" {
+					return done(exitcode.OrderTimeout)
+				}
+				return done(exitcode.TradeCanceled)
+			}
+
+			// A leg ended canceled or expired with part of its volume executed: shrink the open leg
+			// to that volume so the legs stay matched, or cancel its rest once it executed as much.
+			// Partially filled orders can't be resized, those are left to catch up.
+			if cfg.ReconcilePartialFills && !untradeable && !external {
+				var done, open *kraken.OrderStatus
+				openTxId := &sellTxId
+				if kraken.OrderDone(buyOrder.Status) && !kraken.OrderDone(sellOrder.Status) {
+					done, open = buyOrder, sellOrder
+				} else if kraken.OrderDone(sellOrder.Status) && !kraken.OrderDone(buyOrder.Status) {
+					done, open, openTxId = sellOrder, buyOrder, &buyTxId
+				}
+				if done != nil && done.Status != "closed" && kraken.ParseFloat(done.VolExec) > 0 {
+					target := kraken.ParseFloat(done.VolExec)
+					openExec := kraken.ParseFloat(open.VolExec)
+					log := log.With("side", open.Descr.Type, "txid", *openTxId, "target_volume", target, "vol_exec", openExec)
+					switch {
+					case openExec >= target:
+						log.Warn("Open leg executed the other leg's volume, canceling its rest")
+						selfCanceled[*openTxId] = true
+						if err := kraken.CancelOrder(ctx, *openTxId); err != nil {
+							log.Warn("Failed to cancel the rest of the open leg", "error", err)
+						}
+						continue
+					case openExec == 0 && kraken.ParseFloat(open.Vol) > target && kraken.EntriesAllowed(pairStatus):
+						newTxId, err := kraken.ResizeOrder(ctx, assetPair, *openTxId, target)
+						if err != nil {
+							log.Warn("Failed to shrink the open leg to the other leg's executed volume", "error", err)
+							break
+						}
+						log.Warn("Shrunk the open leg to the other leg's executed volume", "old_volume", open.Vol, "new_txid", newTxId)
+						events.Emit(events.Resize, map[string]interface{}{
+							"side":       open.Descr.Type,
+							"old_txid":   *openTxId,
+							"new_txid":   newTxId,
+							"old_volume": kraken.ParseFloat(open.Vol),
+							"new_volume": target,
+						})
+						if journal != nil {
+							if err := journal.RecordOrder(store.Order{TxID: newTxId, TradeID: tradeID, Side: open.Descr.Type, Volume: target, PlacedAt: time.Now()}); err != nil {
+								log.Warn("Failed to record order in journal", "txid", newTxId, "error", err)
+							}
+						}
+						*openTxId = newTxId
+						saveState()
+						continue
+					}
+				}
+			}
+
+			// The pair or the exchange stopped trading: alert on every change, and while matching
+			// is halted cancel orders that haven't filled, they would fill at stale prices on resumption
+			status, err := kraken.GetTradingStatus(ctx, assetPair)
+			if err != nil {
+				log.Warn("Failed to get pair trading status", "error", err)
+			} else if status != pairStatus {
+				kraken.RecordDecision("pair_status", status)
+				log.Warn("Pair trading status changed", "old_status", pairStatus, "status", status)
+				alertPairStatus(ctx, opts.Coin, status, buyTxId, sellTxId)
+				pairStatus = status
+			}
+			unfilled := kraken.ParseFloat(buyOrder.VolExec) == 0 && kraken.ParseFloat(sellOrder.VolExec) == 0 &&
+				buyOrder.Status == "open" && sellOrder.Status == "open"
+			if kraken.MatchingHalted(pairStatus) && unfilled && !external {
+				log.Warn("Pair trading halted, canceling both orders", "status", pairStatus)
+				return cancelUnfilled("halted", exitcode.PairHalted, fmt.Sprintf("🛑 Trade %s canceled, pair trading status is %s", pairName, pairStatus))
+			}
+
+			// Neither leg filled in time: the spread has moved away, cancel both and let the
+			// caller (cmd/loop) start over with fresh prices
+			orderWaited += cfg.StatusCheckInterval
+			if opts.MaxWait > 0 && orderWaited >= opts.MaxWait && unfilled && !external {
+				kraken.RecordDecision("order_timeout", orderWaited.String())
+				log.Warn("Neither order filled in time, canceling both", "maxwait", opts.MaxWait)
+				return cancelUnfilled("timeout", exitcode.OrderTimeout, fmt.Sprintf("⌛ Trade %s timed out, neither order filled within %s, both canceled", pairName, opts.MaxWait))
+			}
+
+			// One leg filled and the other stalls: the spread strategy walks the open leg towards
+			// the market after leg_timeout, never past max_loss_percent against the filled leg's
+			// price, and the new price is applied with EditOrder. Untradeable orders are meant to
+			// stay open and edits are rejected while the pair takes no new orders.
+			var stalled *kraken.OrderStatus
+			stalledTxId := &sellTxId
+			if buyOrder.Status == "closed" && sellOrder.Status == "open" {
+				stalled = sellOrder
+			} else if sellOrder.Status == "closed" && buyOrder.Status == "open" {
+				stalled, stalledTxId = buyOrder, &buyTxId
+			}
+			if untradeable || external || stalled == nil || !kraken.EntriesAllowed(pairStatus) {
+				continue
+			}
+			if err := spread.OnTick(ctx, strategy.Tick{Time: time.Now()}); err != nil {
+				log.Warn("Failed to get spread for repricing", "error", err)
+				continue
+			}
+			if spread.pinned && !atMaxLoss {
+				atMaxLoss = true
+				snapshot("leg_at_max_loss")
+			}
+			currentPrice := kraken.ParseFloat(stalled.Descr.Price)
+			leg := spread.leg(stalled.Descr.Type)
+			if leg < 0 || spread.orders[leg].Price == currentPrice {
+				continue
+			}
+			newPrice := spread.orders[leg].Price
+
+			newTxId, err := kraken.EditOrder(ctx, assetPair, *stalledTxId, newPrice)
+			if err != nil {
+				log.Warn("Failed to reprice stalled leg", "txid", *stalledTxId, "error", err)
+				continue
+			}
+			log.Warn("Repriced stalled leg",
+				"type", stalled.Descr.Type,
+				"waited", spread.legWaited,
+				"old_price", currentPrice,
+				"new_price", newPrice,
+				"limit_price", spread.limit,
+				"old_txid", *stalledTxId,
+				"new_txid", newTxId)
+			events.Emit(events.Reprice, map[string]interface{}{
+				"side":        stalled.Descr.Type,
+				"old_txid":    *stalledTxId,
+				"new_txid":    newTxId,
+				"old_price":   currentPrice,
+				"new_price":   newPrice,
+				"limit_price": spread.limit,
+			})
+			if journal != nil {
+				if err := journal.RecordOrder(store.Order{TxID: newTxId, TradeID: tradeID, Side: stalled.Descr.Type, Volume: kraken.ParseFloat(stalled.Vol), PlacedAt: time.Now()}); err != nil {
+					log.Warn("Failed to record order in journal", "txid", newTxId, "error", err)
+				}
+			}
+			*stalledTxId = newTxId
+			saveState()
+		}
+	} else {
+		log.Info("Order (-order) flag not set, skipping order placement (-paper simulates it)")
+	}
+	return done(exitcode.OK)
+}
+
+// degradedAlertInterval is how often the orders needing manual attention are alerted about while
+// the private API rejects the credentials
+const degradedAlertInterval = 15 * time.Minute
+
+// tickerEvent is the market snapshot emitted with the ticker event, volume24h is omitted when zero
+func tickerEvent(spreadInfo *kraken.SpreadInfo, volume24h float64) map[string]interface{} {
+	data := map[string]interface{}{
+		"bid":            spreadInfo.BidPrice,
+		"ask":            spreadInfo.AskPrice,
+		"spread":         spreadInfo.Spread,
+		"spread_percent": (spreadInfo.Spread / spreadInfo.BidPrice) * 100,
+	}
+	if volume24h > 0 {
+		data["volume_24h_usd"] = volume24h
+	}
+	return data
+}
+
+// FailureCode maps a failed API call to its exit code
+func FailureCode(err error) int {
+	switch {
+	case kraken.IsAuthError(err):
+		return exitcode.Auth
+	case kraken.IsInsufficientFundsError(err):
+		return exitcode.InsufficientFunds
+	default:
+		return exitcode.TradeFailed
+	}
+}
+
+// pullFromEarn deallocates the shortfall of an asset's available balance below need from its
+// flexible earn allocations and returns the balance available afterwards
+func pullFromEarn(ctx context.Context, cfg *config.Config, asset string, available float64, need float64) float64 {
+	pulled, err := kraken.PullFromEarn(ctx, asset, need-available, cfg.Earn.Timeout)
+	if err != nil {
+		logging.FromContext(ctx).Warn("Failed to pull funds from earn", "asset", asset, "pulled", pulled, "error", err)
+	}
+	if pulled > 0 {
+		kraken.RecordDecision("earn_deallocate", map[string]interface{}{"asset": asset, "amount": pulled})
+	}
+	return available + pulled
+}
+
+// DefaultStatePath returns the location of a file in the state directory, or "" if it's unavailable
+func DefaultStatePath(name string) string {
+	dir, err := kraken.StateDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, name)
+}
+
+// LogPaperAccount logs the virtual account after a paper trade. With a ticker, the pair's
+// balances are also valued at the mid price.
+func LogPaperAccount(log *slog.Logger, pair *kraken.AssetPair, spreadInfo *kraken.SpreadInfo) {
+	account := kraken.PaperAccountSnapshot()
+	args := []interface{}{
+		"balances", account.Balances,
+		"fees_usd", account.Fees,
+		"filled_orders", account.Fills,
+	}
+	if spreadInfo != nil {
+		mid := (spreadInfo.BidPrice + spreadInfo.AskPrice) / 2
+		args = append(args, "equity_usd", account.Balances[pair.Quote]+account.Balances[pair.Base]*mid)
+	}
+	log.Info("Paper account", args...)
+}
+
+// runParams collects the effective trading parameters of a run, named like the config file keys
+func runParams(cfg *config.Config, volume float64, usd float64, untradeable bool, postOnly bool, maxParticipation float64, bandPercentile float64, bandWindow time.Duration) runparams.Params {
+	format := func(f float64) string { return strconv.FormatFloat(f, 'f', -1, 64) }
+	return runparams.Params{
+		"volume":                    format(volume),
+		"usd":                       format(usd),
+		"untradeable":               strconv.FormatBool(untradeable),
+		"post_only":                 strconv.FormatBool(postOnly),
+		"max_participation_percent": format(maxParticipation),
+		"band_percentile":           format(bandPercentile),
+		"band_window":               bandWindow.String(),
+		"min_spread_percent":        format(cfg.MinSpreadPercent),
+		"min_volume_24h":            format(cfg.MinVolume24h),
+		"min_net_profit_percent":    format(cfg.MinNetProfitPercent),
+		"spread_narrow_factor":      format(cfg.SpreadNarrowFactor),
+		"spread_timeout":            cfg.SpreadTimeout.String(),
+		"max_volume":                format(cfg.MaxVolume),
+		"price_decimals":            strconv.Itoa(cfg.PriceDecimals),
+		"leg_timeout":               cfg.LegTimeout.String(),
+		"reprice_interval":          cfg.RepriceInterval.String(),
+		"reprice_step":              format(cfg.RepriceStep),
+		"max_loss_percent":          format(cfg.MaxLossPercent),
+		"reconcile_partial_fills":   strconv.FormatBool(cfg.ReconcilePartialFills),
+		"time_in_force":             cfg.TimeInForce,
+		"order_expiry":              cfg.OrderExpiry.String(),
+		"close_order_type":          cfg.CloseOrderType,
+		"close_percent":             format(cfg.ClosePercent),
+		"leverage":                  strconv.Itoa(cfg.Leverage),
+		"lone_leg_action":           cfg.LoneLegAction,
+		"max_exposure_usd":          format(cfg.MaxExposureUSD),
+		"max_open_spreads":          strconv.Itoa(cfg.MaxOpenSpreads),
+		"daily_loss_limit":          format(cfg.DailyLossLimit),
+		"daily_loss_cancel":         strconv.FormatBool(cfg.DailyLossCancel),
+		"max_book_percent":          format(cfg.MaxBookPercent),
+		"book_levels":               strconv.Itoa(cfg.BookLevels),
+		"depth_volume_ratio":        format(cfg.DepthVolumeRatio),
+		"depth_levels":              strconv.Itoa(cfg.DepthLevels),
+	}
+}
+
+// alertPairStatus notifies the operator of a pair trading status change, with the trade's
+// orders if they were placed
+func alertPairStatus(ctx context.Context, coin string, status string, buyTxId string, sellTxId string) {
+	message := fmt.Sprintf("🚨 %s trading status is now %s", kraken.PairName(coin), status)
+	if kraken.EntriesAllowed(status) {
+		message = fmt.Sprintf("ℹ️ %s trading status is back to %s", kraken.PairName(coin), status)
+	} else if buyTxId == "" {
+		message += ", no new orders are placed"
+	}
+	if buyTxId != "" {
+		message += fmt.Sprintf("\nBuy Order ID: %s\nSell Order ID: %s", buyTxId, sellTxId)
+	}
+	if err := kraken.SendSlackMessage(ctx, message); err != nil {
+		logging.FromContext(ctx).Warn("Failed to send Slack message", "error", err)
+	}
+}
+
+// cancelJournaledOrders cancels the open orders of the account the journal knows as placed by the
+// bot and returns how many were canceled and how many failed to
+func cancelJournaledOrders(ctx context.Context, journal *store.Store) (int, int) {
+	log := logging.FromContext(ctx)
+	orders, err := kraken.GetOpenOrders(ctx, "")
+	if err != nil {
+		log.Error("Failed to get open orders to cancel", "error", err)
+		return 0, 1
+	}
+	canceled, failed := 0, 0
+	for txId := range orders {
+		ours, err := journal.HasOrder(txId)
+		if err != nil {
+			log.Warn("Failed to look up the order in the journal", "txid", txId, "error", err)
+			failed++
+			continue
+		}
+		if !ours {
+			continue
+		}
+		if err := kraken.CancelOrder(ctx, txId); err != nil {
+			log.Error("Failed to cancel order", "txid", txId, "error", err)
+			failed++
+			continue
+		}
+		log.Info("Canceled open order of the bot", "txid", txId)
+		canceled++
+	}
+	return canceled, failed
+}
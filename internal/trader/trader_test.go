@@ -0,0 +1,192 @@
+package trader_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jkosik/crypto-trader/internal/config"
+	"github.com/jkosik/crypto-trader/internal/exitcode"
+	"github.com/jkosik/crypto-trader/internal/kraken"
+	"github.com/jkosik/crypto-trader/internal/krakenmock"
+	"github.com/jkosik/crypto-trader/internal/trader"
+	"github.com/jkosik/crypto-trader/internal/tradestate"
+)
+
+// TestMain keeps the nonce and trade state out of the home directory and signs private requests
+// with the mock's secret
+func TestMain(m *testing.M) {
+	dir, err := os.MkdirTemp("", "trader-test")
+	if err != nil {
+		panic(err)
+	}
+	os.Setenv("CRYPTO_TRADER_STATE_DIR", dir)
+	os.Setenv("KRAKEN_API_KEY", "mock")
+	os.Setenv("KRAKEN_PRIVATE_KEY", krakenmock.Secret)
+	// The mock needs no throttling
+	kraken.SetPublicRateLimit(1000, 1000)
+	kraken.SetPrivateRateLimit(1000, 1000)
+	code := m.Run()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+// mock starts a mock server and points the kraken package at it
+func mock(t *testing.T) *krakenmock.Server {
+	t.Helper()
+	server := krakenmock.New(krakenmock.Secret)
+	restore := server.Use()
+	t.Cleanup(func() {
+		restore()
+		server.Close()
+	})
+	return server
+}
+
+// options trade 0.001 BTC on the mock's 60000/60010 book, whose spread doesn't pay the fees, with
+// no journal, parameter history or market cache
+func options() trader.Options {
+	cfg := config.Default()
+	cfg.MinSpreadPercent = 0.001
+	cfg.MinNetProfitPercent = -5
+	cfg.SpreadCheckInterval = 10 * time.Millisecond
+	cfg.StatusCheckInterval = 10 * time.Millisecond
+
+	opts := trader.DefaultOptions()
+	opts.Config = cfg
+	opts.Coin = "BTC"
+	opts.Volume = 0.001
+	opts.Order = true
+	opts.JournalPath, opts.ParamsPath, opts.MarketCache = "", "", ""
+	return opts
+}
+
+// placed waits until the trade's orders are on the mock's book
+func placed(t *testing.T, server *krakenmock.Server) {
+	t.Helper()
+	for deadline := time.Now().Add(10 * time.Second); len(server.OpenOrders()) < 2; {
+		if time.Now().After(deadline) {
+			t.Fatal("orders were not placed")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestRunCompletesTrade(t *testing.T) {
+	server := mock(t)
+	go func() {
+		placed(t, server)
+		server.FillAll()
+	}()
+
+	result := trader.Run(context.Background(), options())
+	if result.Code != exitcode.OK || result.Result != "complete" {
+		t.Fatalf("Run = code %d, result %q, want a complete trade", result.Code, result.Result)
+	}
+	// Narrowed by spread_narrow_factor 0.7 inside 60000/60010, both legs paying 0.25%
+	if result.Volume != 0.001 || result.BuyPrice != 60003.5 || result.SellPrice != 60006.5 {
+		t.Errorf("trade of %v at %v/%v, want 0.001 at 60003.5/60006.5", result.Volume, result.BuyPrice, result.SellPrice)
+	}
+	if result.FeesUSD != 0.3 || result.NetProfitUSD != -0.3 {
+		t.Errorf("fees %v, net profit %v, want 0.3 and -0.3", result.FeesUSD, result.NetProfitUSD)
+	}
+	if result.TradeID == "" || result.PlacedAt.IsZero() || result.FillTime() <= 0 {
+		t.Errorf("result %+v lacks its trade ID or timing", result)
+	}
+}
+
+func TestRunShutdownCancelsOrders(t *testing.T) {
+	server := mock(t)
+	shutdown := make(chan struct{})
+	go func() {
+		placed(t, server)
+		close(shutdown)
+	}()
+
+	opts := options()
+	opts.Shutdown = shutdown
+	result := trader.Run(context.Background(), opts)
+	if result.Code != exitcode.Interrupted || result.Result != "interrupted" {
+		t.Fatalf("Run = code %d, result %q, want interrupted", result.Code, result.Result)
+	}
+	if open := server.OpenOrders(); len(open) != 0 {
+		t.Errorf("orders %v left open, want both canceled", open)
+	}
+}
+
+func TestRunSpreadTimeout(t *testing.T) {
+	mock(t)
+	opts := options()
+	opts.Config.MinSpreadPercent = 1
+	opts.Config.SpreadTimeout = 50 * time.Millisecond
+
+	result := trader.Run(context.Background(), opts)
+	if result.Code != exitcode.SpreadTimeout || result.Result != "" || !result.PlacedAt.IsZero() {
+		t.Errorf("Run = %+v, want a spread timeout without orders", result)
+	}
+}
+
+// A detached trade is handed over in the state file of its pair, with the quote to resume it on
+func TestRunDetachSavesPairState(t *testing.T) {
+	mock(t)
+	statePath := trader.DefaultStatePath(tradestate.FileName("BTC", kraken.Quote))
+	defer tradestate.Clear(statePath)
+
+	opts := options()
+	opts.Detach = true
+	opts.Yes = true
+	if result := trader.Run(context.Background(), opts); result.Code != exitcode.OK {
+		t.Fatalf("Run = code %d, want OK", result.Code)
+	}
+	trade, err := tradestate.Load(statePath)
+	if err != nil || trade == nil {
+		t.Fatalf("no trade state in %s: %v", statePath, err)
+	}
+	if trade.Coin != "BTC" || trade.Quote != "USD" {
+		t.Errorf("trade state of %s/%s, want BTC/USD", trade.Coin, trade.Quote)
+	}
+}
+
+// cmd/loop trades coins side by side in one process, sharing the state files
+func TestRunConcurrent(t *testing.T) {
+	server := mock(t)
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		for {
+			select {
+			case <-done:
+				return
+			case <-time.After(20 * time.Millisecond):
+				server.FillAll()
+			}
+		}
+	}()
+
+	paramsPath := filepath.Join(t.TempDir(), "last-run.json")
+	results := make([]*trader.TradeResult, 2)
+	var wg sync.WaitGroup
+	for i := range results {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			opts := options()
+			opts.ParamsPath = paramsPath
+			opts.Yes = true
+			results[i] = trader.Run(context.Background(), opts)
+		}(i)
+	}
+	wg.Wait()
+
+	for i, result := range results {
+		if result.Code != exitcode.OK || result.Result != "complete" {
+			t.Errorf("trade %d = code %d, result %q, want complete", i, result.Code, result.Result)
+		}
+	}
+	if _, err := os.Stat(paramsPath); err != nil {
+		t.Errorf("run parameters weren't saved: %v", err)
+	}
+}
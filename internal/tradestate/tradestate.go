@@ -0,0 +1,91 @@
+// Package tradestate persists the trade in progress, its orders and parameters, so a trader
+// restarted after a crash resumes monitoring the orders instead of placing a new trade on top of them.
+package tradestate
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Trade is the state of a trade whose orders were placed and that hasn't finished yet
+type Trade struct {
+	TradeID              string    `json:"trade_id"`
+	Coin                 string    `json:"coin"`
+	Quote                string    `json:"quote"`
+	BuyTxID              string    `json:"buy_txid"`
+	SellTxID             string    `json:"sell_txid"`
+	Volume               float64   `json:"volume"`
+	Untradeable          bool      `json:"untradeable"`
+	EstimatedProfit      float64   `json:"estimated_profit"`
+	EstimatedPercentGain float64   `json:"estimated_percent_gain"`
+	PlacedAt             time.Time `json:"placed_at"`
+}
+
+// FileName is the name of the state file of a pair's trade in the state directory, e.g.
+// active-BTC-EUR.json. Trades of one coin against different quotes don't share it.
+func FileName(coin string, quote string) string {
+	return "active-" + strings.ToUpper(coin) + "-" + strings.ToUpper(quote) + ".json"
+}
+
+// Load reads the trade state at path, nil if no trade is in progress
+func Load(path string) (*Trade, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading trade state: %v", err)
+	}
+	var t Trade
+	if err := json.Unmarshal(data, &t); err != nil {
+		return nil, fmt.Errorf("error parsing trade state %s: %v", path, err)
+	}
+	if t.BuyTxID == "" || t.SellTxID == "" {
+		return nil, fmt.Errorf("trade state %s has no orders", path)
+	}
+	return &t, nil
+}
+
+// Save writes the trade state atomically and syncs it, it must survive the crash it's for
+func Save(path string, t Trade) error {
+	data, err := json.MarshalIndent(t, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error encoding trade state: %v", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return fmt.Errorf("error creating state directory: %v", err)
+	}
+
+	tmp := path + ".tmp"
+	file, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return fmt.Errorf("error writing trade state: %v", err)
+	}
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		return fmt.Errorf("error writing trade state: %v", err)
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return fmt.Errorf("error writing trade state: %v", err)
+	}
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("error writing trade state: %v", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("error writing trade state: %v", err)
+	}
+	return nil
+}
+
+// Clear removes the trade state once the trade has finished
+func Clear(path string) error {
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("error removing trade state: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,21 @@
+#!/bin/bash
+
+# Run the hot path benchmarks and compare them with the baseline of this machine using benchstat
+# (go install golang.org/x/perf/cmd/benchstat@latest).
+# Pass -update to record a new baseline, e.g. before a performance refactor.
+set -e
+
+BASELINE=${BASELINE:-bench-baseline.txt}
+PACKAGES="./internal/kraken ./internal/scanner"
+
+if [ "$1" == "-update" ]; then
+    go test -run '^$' -bench . -benchmem -count 6 $PACKAGES | tee "$BASELINE"
+    exit 0
+fi
+
+go test -run '^$' -bench . -benchmem -count 6 $PACKAGES | tee bench_output.txt
+if [ ! -f "$BASELINE" ]; then
+    echo "No baseline $BASELINE yet, record one with $0 -update"
+    exit 0
+fi
+benchstat "$BASELINE" bench_output.txt
@@ -0,0 +1,42 @@
+#!/bin/bash
+# Builds the release binaries for all platforms, writes checksums.txt and signs it with the
+# release ed25519 key, so `trader self-update` can verify downloads.
+#
+# Usage: scripts/release.sh <tag> <signing-key.pem>
+#
+# Create the signing key once and keep it out of the repository:
+#   openssl genpkey -algorithm ed25519 -out release-key.pem
+# Upload everything in dist/ to the GitHub release <tag>.
+
+set -euo pipefail
+
+if [ $# -ne 2 ]; then
+    echo "Usage: $0 <tag> <signing-key.pem>"
+    exit 1
+fi
+tag="$1"
+key="$2"
+
+# Raw 32-byte public key (last bytes of the DER encoding), embedded into the binaries
+public_key=$(openssl pkey -in "$key" -pubout -outform DER | tail -c 32 | base64)
+
+rm -rf dist
+mkdir -p dist
+
+for platform in linux/amd64 linux/arm64 darwin/amd64 darwin/arm64 windows/amd64; do
+    os="${platform%/*}"
+    arch="${platform#*/}"
+    name="trader_${os}_${arch}"
+    if [ "$os" = "windows" ]; then
+        name="${name}.exe"
+    fi
+    echo "Building ${name}..."
+    CGO_ENABLED=0 GOOS="$os" GOARCH="$arch" go build -trimpath \
+        -ldflags "-s -w -X main.version=${tag} -X github.com/jkosik/crypto-trader/internal/selfupdate.PublicKey=${public_key}" \
+        -o "dist/${name}" ./cmd/trader
+done
+
+(cd dist && sha256sum trader_* > checksums.txt)
+openssl pkeyutl -sign -inkey "$key" -rawin -in dist/checksums.txt -out dist/checksums.txt.sig
+
+echo "Release ${tag} is in dist/, upload all files to the GitHub release"